@@ -0,0 +1,58 @@
+package awscmd
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// accountAlias returns the IAM alias of the account, read with client the
+// first time it is needed, or else AccountName. Accounts have at most one
+// alias. The error reading it is kept, so it is not retried.
+func (p *Provider) accountAlias(ctx context.Context, client IAMAPI) (string, error) {
+	alias, err := p.aliases.get(ctx, "", func() (string, error) {
+		reqCtx, cancel := requestContext(ctx)
+		defer cancel()
+		out, err := client.ListAccountAliases(reqCtx, &iam.ListAccountAliasesInput{})
+		if err != nil {
+			return "", err
+		}
+		if len(out.AccountAliases) == 0 {
+			return "", nil
+		}
+		return out.AccountAliases[0], nil
+	})
+	if alias == "" {
+		alias = p.AccountName
+	}
+	return alias, err
+}
+
+// accountCataloger records the alias and organizational unit of the account
+// on every service its Cataloger emits, and, when skipped is set, first
+// reports that the alias could not be read.
+type accountCataloger struct {
+	discovery.Cataloger
+	alias, unit string
+	skipped     error
+}
+
+func (c *accountCataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	if c.skipped != nil {
+		if err := emit(discovery.SkipDetail("iam:ListAccountAliases", c.skipped)); err != nil {
+			return err
+		}
+	}
+	if c.alias == "" && c.unit == "" {
+		return c.Cataloger.Catalog(ctx, emit)
+	}
+	return c.Cataloger.Catalog(ctx, func(r discovery.Result) error {
+		if r.Err == nil {
+			r.Service.AccountAlias = c.alias
+			r.Service.OrganizationalUnit = c.unit
+		}
+		return emit(r)
+	})
+}
@@ -0,0 +1,355 @@
+package awscmd
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	elb "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/xray"
+)
+
+// LambdaAPI is the subset of the Lambda client the catalogers use.
+type LambdaAPI interface {
+	lambda.ListFunctionsAPIClient
+	lambda.ListEventSourceMappingsAPIClient
+	lambda.ListProvisionedConcurrencyConfigsAPIClient
+	lambda.ListFunctionEventInvokeConfigsAPIClient
+	GetFunction(ctx context.Context, in *lambda.GetFunctionInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionOutput, error)
+	GetPolicy(ctx context.Context, in *lambda.GetPolicyInput, optFns ...func(*lambda.Options)) (*lambda.GetPolicyOutput, error)
+	GetFunctionUrlConfig(ctx context.Context, in *lambda.GetFunctionUrlConfigInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionUrlConfigOutput, error)
+	GetLayerVersionByArn(ctx context.Context, in *lambda.GetLayerVersionByArnInput, optFns ...func(*lambda.Options)) (*lambda.GetLayerVersionByArnOutput, error)
+	GetAccountSettings(ctx context.Context, in *lambda.GetAccountSettingsInput, optFns ...func(*lambda.Options)) (*lambda.GetAccountSettingsOutput, error)
+}
+
+// APIGatewayAPI is the subset of the API Gateway client the REST API
+// cataloger uses.
+type APIGatewayAPI interface {
+	apigateway.GetRestApisAPIClient
+	apigateway.GetResourcesAPIClient
+	GetVpcLink(ctx context.Context, in *apigateway.GetVpcLinkInput, optFns ...func(*apigateway.Options)) (*apigateway.GetVpcLinkOutput, error)
+	apigateway.GetDomainNamesAPIClient
+	apigateway.GetBasePathMappingsAPIClient
+}
+
+// APIGatewayV2API is the subset of the API Gateway V2 client the HTTP and
+// WebSocket API cataloger uses.
+type APIGatewayV2API interface {
+	GetApis(ctx context.Context, in *apigatewayv2.GetApisInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetApisOutput, error)
+	GetIntegrations(ctx context.Context, in *apigatewayv2.GetIntegrationsInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetIntegrationsOutput, error)
+	GetRoutes(ctx context.Context, in *apigatewayv2.GetRoutesInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetRoutesOutput, error)
+	GetDomainNames(ctx context.Context, in *apigatewayv2.GetDomainNamesInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetDomainNamesOutput, error)
+	GetApiMappings(ctx context.Context, in *apigatewayv2.GetApiMappingsInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetApiMappingsOutput, error)
+}
+
+// SFNAPI is the subset of the Step Functions client the state machine
+// cataloger uses.
+type SFNAPI interface {
+	sfn.ListStateMachinesAPIClient
+	DescribeStateMachine(ctx context.Context, in *sfn.DescribeStateMachineInput, optFns ...func(*sfn.Options)) (*sfn.DescribeStateMachineOutput, error)
+}
+
+// EventBridgeAPI is the subset of the EventBridge client used to discover
+// event buses and their rules.
+type EventBridgeAPI interface {
+	ListEventBuses(ctx context.Context, in *eventbridge.ListEventBusesInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListEventBusesOutput, error)
+	ListRules(ctx context.Context, in *eventbridge.ListRulesInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListRulesOutput, error)
+	ListTargetsByRule(ctx context.Context, in *eventbridge.ListTargetsByRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListTargetsByRuleOutput, error)
+}
+
+// IAMAPI is the subset of the IAM client used to read execution role
+// policies and the alias of the account.
+type IAMAPI interface {
+	iam.ListRolePoliciesAPIClient
+	iam.ListAttachedRolePoliciesAPIClient
+	GetRolePolicy(ctx context.Context, in *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error)
+	GetPolicy(ctx context.Context, in *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error)
+	GetPolicyVersion(ctx context.Context, in *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error)
+	ListAccountAliases(ctx context.Context, in *iam.ListAccountAliasesInput, optFns ...func(*iam.Options)) (*iam.ListAccountAliasesOutput, error)
+}
+
+// SQSAPI is the subset of the SQS client used to read queue policies.
+type SQSAPI interface {
+	GetQueueAttributes(ctx context.Context, in *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+}
+
+// SNSAPI is the subset of the SNS client used to read topic policies and
+// subscriptions.
+type SNSAPI interface {
+	GetTopicAttributes(ctx context.Context, in *sns.GetTopicAttributesInput, optFns ...func(*sns.Options)) (*sns.GetTopicAttributesOutput, error)
+	sns.ListSubscriptionsByTopicAPIClient
+}
+
+// S3API is the subset of the S3 client used to read bucket policies.
+type S3API interface {
+	GetBucketPolicy(ctx context.Context, in *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error)
+}
+
+// XRayAPI is the subset of the X-Ray client used to read service graphs.
+type XRayAPI interface {
+	xray.GetServiceGraphAPIClient
+}
+
+// CloudTrailAPI is the subset of the CloudTrail client used to read logged
+// API calls, from event history or a CloudTrail Lake event data store.
+type CloudTrailAPI interface {
+	cloudtrail.LookupEventsAPIClient
+	StartQuery(ctx context.Context, in *cloudtrail.StartQueryInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.StartQueryOutput, error)
+	cloudtrail.GetQueryResultsAPIClient
+}
+
+// CloudWatchAPI is the subset of the CloudWatch client used to read usage
+// metrics.
+type CloudWatchAPI interface {
+	cloudwatch.GetMetricDataAPIClient
+}
+
+// CostExplorerAPI is the subset of the Cost Explorer client used to read
+// costs by resource and by tag.
+type CostExplorerAPI interface {
+	GetCostAndUsage(ctx context.Context, in *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error)
+	GetCostAndUsageWithResources(ctx context.Context, in *costexplorer.GetCostAndUsageWithResourcesInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageWithResourcesOutput, error)
+}
+
+// ApplicationAutoScalingAPI is the subset of the Application Auto Scaling
+// client used to read how functions' provisioned concurrency is scaled.
+type ApplicationAutoScalingAPI interface {
+	applicationautoscaling.DescribeScalableTargetsAPIClient
+	applicationautoscaling.DescribeScalingPoliciesAPIClient
+}
+
+// ECRAPI is the subset of the ECR client used to read the images of Image
+// functions.
+type ECRAPI interface {
+	ecr.DescribeImagesAPIClient
+	BatchGetImage(ctx context.Context, in *ecr.BatchGetImageInput, optFns ...func(*ecr.Options)) (*ecr.BatchGetImageOutput, error)
+	GetDownloadUrlForLayer(ctx context.Context, in *ecr.GetDownloadUrlForLayerInput, optFns ...func(*ecr.Options)) (*ecr.GetDownloadUrlForLayerOutput, error)
+}
+
+// OrganizationsAPI is the subset of the Organizations client used to list
+// the accounts of an organization, their organizational units and the
+// services delegated to them.
+type OrganizationsAPI interface {
+	organizations.ListAccountsAPIClient
+	organizations.ListParentsAPIClient
+	organizations.ListDelegatedAdministratorsAPIClient
+	organizations.ListDelegatedServicesForAccountAPIClient
+	DescribeOrganizationalUnit(ctx context.Context, in *organizations.DescribeOrganizationalUnitInput, optFns ...func(*organizations.Options)) (*organizations.DescribeOrganizationalUnitOutput, error)
+}
+
+// CloudFormationAPI is the subset of the CloudFormation client used to read
+// the templates and resources of stacks, and the stack sets deploying them.
+type CloudFormationAPI interface {
+	cloudformation.DescribeStacksAPIClient
+	cloudformation.ListStackResourcesAPIClient
+	cloudformation.ListStackSetsAPIClient
+	cloudformation.ListStackInstancesAPIClient
+	GetTemplate(ctx context.Context, in *cloudformation.GetTemplateInput, optFns ...func(*cloudformation.Options)) (*cloudformation.GetTemplateOutput, error)
+}
+
+// EC2API is the subset of the EC2 client used to read security groups,
+// subnets and Lambda's network interfaces.
+type EC2API interface {
+	ec2.DescribeSecurityGroupsAPIClient
+	ec2.DescribeSubnetsAPIClient
+	ec2.DescribeNetworkInterfacesAPIClient
+}
+
+// ELBAPI is the subset of the Elastic Load Balancing client used to resolve
+// load balancers' DNS names and find target groups without targets.
+type ELBAPI interface {
+	elb.DescribeLoadBalancersAPIClient
+	elb.DescribeTargetGroupsAPIClient
+	DescribeTargetHealth(ctx context.Context, in *elb.DescribeTargetHealthInput, optFns ...func(*elb.Options)) (*elb.DescribeTargetHealthOutput, error)
+}
+
+// Route53API is the subset of the Route 53 client used to read DNS records.
+type Route53API interface {
+	route53.ListHostedZonesAPIClient
+	route53.ListResourceRecordSetsAPIClient
+}
+
+// CloudFrontAPI is the subset of the CloudFront client used to read
+// distributions.
+type CloudFrontAPI interface {
+	cloudfront.ListDistributionsAPIClient
+}
+
+// STSAPI is the subset of the STS client used to assume roles.
+type STSAPI interface {
+	AssumeRoleWithWebIdentity(ctx context.Context, in *sts.AssumeRoleWithWebIdentityInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error)
+	AssumeRole(ctx context.Context, in *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
+}
+
+// ClientFactory creates the AWS clients a Provider uses. The default builds
+// SDK clients; package awsfake provides in-memory fakes for tests.
+type ClientFactory interface {
+	// STS returns a client for assuming roles in region.
+	STS(ctx context.Context, region string) (STSAPI, error)
+	// AssumedSTS returns an STS client using the assumed-role cfg, for
+	// assuming roles in other accounts with it.
+	AssumedSTS(cfg aws.Config) STSAPI
+	// Organizations returns an Organizations client using the assumed-role
+	// cfg.
+	Organizations(cfg aws.Config) OrganizationsAPI
+	// Lambda returns a Lambda client using the assumed-role cfg.
+	Lambda(cfg aws.Config) LambdaAPI
+	// APIGateway and APIGatewayV2 return API Gateway clients using the
+	// assumed-role cfg.
+	APIGateway(cfg aws.Config) APIGatewayAPI
+	APIGatewayV2(cfg aws.Config) APIGatewayV2API
+	// SFN returns a Step Functions client using the assumed-role cfg.
+	SFN(cfg aws.Config) SFNAPI
+	// EventBridge returns an EventBridge client using the assumed-role cfg.
+	EventBridge(cfg aws.Config) EventBridgeAPI
+	// IAM returns an IAM client using the assumed-role cfg.
+	IAM(cfg aws.Config) IAMAPI
+	// SQS, SNS and S3 return clients using the assumed-role cfg.
+	SQS(cfg aws.Config) SQSAPI
+	SNS(cfg aws.Config) SNSAPI
+	S3(cfg aws.Config) S3API
+	// XRay returns an X-Ray client using the assumed-role cfg.
+	XRay(cfg aws.Config) XRayAPI
+	// CloudTrail returns a CloudTrail client using the assumed-role cfg.
+	CloudTrail(cfg aws.Config) CloudTrailAPI
+	// CloudWatch returns a CloudWatch client using the assumed-role cfg.
+	CloudWatch(cfg aws.Config) CloudWatchAPI
+	// CostExplorer returns a Cost Explorer client using the assumed-role
+	// cfg.
+	CostExplorer(cfg aws.Config) CostExplorerAPI
+	// ApplicationAutoScaling returns an Application Auto Scaling client
+	// using the assumed-role cfg.
+	ApplicationAutoScaling(cfg aws.Config) ApplicationAutoScalingAPI
+	// ECR returns an ECR client using the assumed-role cfg.
+	ECR(cfg aws.Config) ECRAPI
+	// CloudFormation returns a CloudFormation client using the assumed-role
+	// cfg.
+	CloudFormation(cfg aws.Config) CloudFormationAPI
+	// EC2 returns an EC2 client using the assumed-role cfg.
+	EC2(cfg aws.Config) EC2API
+	// ELB, Route53 and CloudFront return clients using the assumed-role
+	// cfg.
+	ELB(cfg aws.Config) ELBAPI
+	Route53(cfg aws.Config) Route53API
+	CloudFront(cfg aws.Config) CloudFrontAPI
+}
+
+// sdkClients is the ClientFactory backed by the AWS SDK.
+type sdkClients struct{}
+
+func (sdkClients) STS(ctx context.Context, region string) (STSAPI, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region), config.WithRetryer(NewRetryer))
+	if err != nil {
+		return nil, err
+	}
+	cfg.APIOptions = append(cfg.APIOptions, apiOptions()...)
+	return CreateSTSClient(cfg), nil
+}
+
+func (sdkClients) AssumedSTS(cfg aws.Config) STSAPI {
+	return CreateSTSClient(cfg)
+}
+
+func (sdkClients) Organizations(cfg aws.Config) OrganizationsAPI {
+	return organizations.NewFromConfig(cfg)
+}
+
+func (sdkClients) Lambda(cfg aws.Config) LambdaAPI {
+	return lambda.NewFromConfig(cfg)
+}
+
+func (sdkClients) APIGateway(cfg aws.Config) APIGatewayAPI {
+	return apigateway.NewFromConfig(cfg)
+}
+
+func (sdkClients) APIGatewayV2(cfg aws.Config) APIGatewayV2API {
+	return apigatewayv2.NewFromConfig(cfg)
+}
+
+func (sdkClients) SFN(cfg aws.Config) SFNAPI {
+	return sfn.NewFromConfig(cfg)
+}
+
+func (sdkClients) EventBridge(cfg aws.Config) EventBridgeAPI {
+	return eventbridge.NewFromConfig(cfg)
+}
+
+func (sdkClients) IAM(cfg aws.Config) IAMAPI {
+	return iam.NewFromConfig(cfg)
+}
+
+func (sdkClients) SQS(cfg aws.Config) SQSAPI {
+	return sqs.NewFromConfig(cfg)
+}
+
+func (sdkClients) SNS(cfg aws.Config) SNSAPI {
+	return sns.NewFromConfig(cfg)
+}
+
+func (sdkClients) S3(cfg aws.Config) S3API {
+	return s3.NewFromConfig(cfg)
+}
+
+func (sdkClients) XRay(cfg aws.Config) XRayAPI {
+	return xray.NewFromConfig(cfg)
+}
+
+func (sdkClients) CloudTrail(cfg aws.Config) CloudTrailAPI {
+	return cloudtrail.NewFromConfig(cfg)
+}
+
+func (sdkClients) CloudWatch(cfg aws.Config) CloudWatchAPI {
+	return cloudwatch.NewFromConfig(cfg)
+}
+
+func (sdkClients) CostExplorer(cfg aws.Config) CostExplorerAPI {
+	return costexplorer.NewFromConfig(cfg)
+}
+
+func (sdkClients) ApplicationAutoScaling(cfg aws.Config) ApplicationAutoScalingAPI {
+	return applicationautoscaling.NewFromConfig(cfg)
+}
+
+func (sdkClients) ECR(cfg aws.Config) ECRAPI {
+	return ecr.NewFromConfig(cfg)
+}
+
+func (sdkClients) CloudFormation(cfg aws.Config) CloudFormationAPI {
+	return cloudformation.NewFromConfig(cfg)
+}
+
+func (sdkClients) EC2(cfg aws.Config) EC2API {
+	return ec2.NewFromConfig(cfg)
+}
+
+func (sdkClients) ELB(cfg aws.Config) ELBAPI {
+	return elb.NewFromConfig(cfg)
+}
+
+func (sdkClients) Route53(cfg aws.Config) Route53API {
+	return route53.NewFromConfig(cfg)
+}
+
+func (sdkClients) CloudFront(cfg aws.Config) CloudFrontAPI {
+	return cloudfront.NewFromConfig(cfg)
+}
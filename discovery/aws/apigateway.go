@@ -0,0 +1,315 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	apigwtypes "github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	apigwv2types "github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// APIGatewayCataloger discovers API Gateway REST APIs and the backends of
+// their integrations.
+type APIGatewayCataloger struct {
+	client  APIGatewayAPI
+	region  string
+	account string
+}
+
+// NewAPIGatewayCataloger returns a cataloger listing the REST APIs of
+// account in region with client.
+func NewAPIGatewayCataloger(client APIGatewayAPI, region, account string) *APIGatewayCataloger {
+	return &APIGatewayCataloger{client: client, region: region, account: account}
+}
+
+func (c *APIGatewayCataloger) Name() string {
+	return "apigateway"
+}
+
+func (c *APIGatewayCataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	listAPIs := func(ctx context.Context, send func(apigwtypes.RestApi) bool) error {
+		p := apigateway.NewGetRestApisPaginator(c.client, &apigateway.GetRestApisInput{})
+		for api, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedRestAPIs) {
+			if err != nil {
+				return fmt.Errorf("listing REST APIs: %w", err)
+			}
+			if !send(api) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	// VPC links are shared by the APIs of a region, so each is read once.
+	var links memo[[]string]
+	describeAPI := func(ctx context.Context, api apigwtypes.RestApi) discovery.Result {
+		var result discovery.Result
+		s := &result.Service
+		id := aws.ToString(api.Id)
+		apiService(s, c.region, c.account, id, aws.ToString(api.Name), discovery.ResourceTypeAPIGateway)
+		s.Tags = api.Tags
+		details := &discovery.APIGatewayDetails{
+			ID:          id,
+			Protocol:    "REST",
+			Description: aws.ToString(api.Description),
+		}
+		if !api.DisableExecuteApiEndpoint {
+			details.Endpoint = "https://" + id + ".execute-api." + c.region + ".amazonaws.com"
+		}
+		if e := api.EndpointConfiguration; e != nil {
+			for _, t := range e.Types {
+				details.EndpointTypes = append(details.EndpointTypes, string(t))
+			}
+		}
+		s.Details.APIGateway = details
+		if api.CreatedDate != nil {
+			created := api.CreatedDate.UTC()
+			s.LastModified = &created
+		}
+
+		var integrations integrationTargets
+		p := apigateway.NewGetResourcesPaginator(c.client, &apigateway.GetResourcesInput{
+			RestApiId: aws.String(id),
+			Embed:     []string{"methods"},
+		})
+		for resource, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedAPIResources) {
+			if err != nil {
+				return discovery.SkipResource(s.Name, fmt.Errorf("getting resources: %w", err))
+			}
+			for method, m := range resource.ResourceMethods {
+				i := m.MethodIntegration
+				if i == nil {
+					continue
+				}
+				route := method + " " + aws.ToString(resource.Path)
+				if i.ConnectionType == apigwtypes.ConnectionTypeVpcLink {
+					targets, err := links.get(ctx, aws.ToString(i.ConnectionId), func() ([]string, error) {
+						return vpcLinkTargets(ctx, c.client, aws.ToString(i.ConnectionId))
+					})
+					if err != nil {
+						return discovery.SkipResource(s.Name, err)
+					}
+					for _, t := range targets {
+						integrations.add(t, route)
+					}
+					continue
+				}
+				integrations.add(aws.ToString(i.Uri), route)
+			}
+		}
+		s.Relationships = integrations.relationships()
+		return result
+	}
+
+	return fanOut(ctx, Workers, OrderedResults, listAPIs, describeAPI, emit)
+}
+
+// vpcLinkTargets returns the load balancers of a REST API VPC link. Links
+// named by a stage variable have none that can be resolved.
+func vpcLinkTargets(ctx context.Context, client APIGatewayAPI, id string) ([]string, error) {
+	if id == "" || strings.Contains(id, "${") {
+		return nil, nil
+	}
+	callCtx, cancel := requestContext(ctx)
+	defer cancel()
+	out, err := client.GetVpcLink(callCtx, &apigateway.GetVpcLinkInput{VpcLinkId: aws.String(id)})
+	if err != nil {
+		return nil, fmt.Errorf("getting VPC link %s: %w", id, err)
+	}
+	return out.TargetArns, nil
+}
+
+func listedRestAPIs(page *apigateway.GetRestApisOutput) []apigwtypes.RestApi {
+	return page.Items
+}
+
+func listedAPIResources(page *apigateway.GetResourcesOutput) []apigwtypes.Resource {
+	return page.Items
+}
+
+// APIGatewayV2Cataloger discovers API Gateway HTTP and WebSocket APIs and
+// the backends of their integrations.
+type APIGatewayV2Cataloger struct {
+	client  APIGatewayV2API
+	region  string
+	account string
+}
+
+// NewAPIGatewayV2Cataloger returns a cataloger listing the HTTP and
+// WebSocket APIs of account in region with client.
+func NewAPIGatewayV2Cataloger(client APIGatewayV2API, region, account string) *APIGatewayV2Cataloger {
+	return &APIGatewayV2Cataloger{client: client, region: region, account: account}
+}
+
+func (c *APIGatewayV2Cataloger) Name() string {
+	return "apigatewayv2"
+}
+
+func (c *APIGatewayV2Cataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	listAPIs := func(ctx context.Context, send func(apigwv2types.Api) bool) error {
+		page := func(ctx context.Context, token *string) (*apigatewayv2.GetApisOutput, error) {
+			return c.client.GetApis(ctx, &apigatewayv2.GetApisInput{NextToken: token})
+		}
+		for api, err := range tokenPages(ctx, page, listedV2APIs, nextV2APIs) {
+			if err != nil {
+				return fmt.Errorf("listing APIs: %w", err)
+			}
+			if !send(api) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	describeAPI := func(ctx context.Context, api apigwv2types.Api) discovery.Result {
+		var result discovery.Result
+		s := &result.Service
+		id := aws.ToString(api.ApiId)
+		apiService(s, c.region, c.account, id, aws.ToString(api.Name), discovery.ResourceTypeHTTPAPI)
+		s.Tags = api.Tags
+		details := &discovery.APIGatewayDetails{
+			ID:          id,
+			Protocol:    string(api.ProtocolType),
+			Description: aws.ToString(api.Description),
+		}
+		if !aws.ToBool(api.DisableExecuteApiEndpoint) {
+			details.Endpoint = aws.ToString(api.ApiEndpoint)
+		}
+		s.Details.APIGateway = details
+		if api.CreatedDate != nil {
+			created := api.CreatedDate.UTC()
+			s.LastModified = &created
+		}
+
+		// Routes name the integration they send requests to as
+		// "integrations/<id>".
+		routes := map[string][]string{}
+		routePage := func(ctx context.Context, token *string) (*apigatewayv2.GetRoutesOutput, error) {
+			return c.client.GetRoutes(ctx, &apigatewayv2.GetRoutesInput{ApiId: aws.String(id), NextToken: token})
+		}
+		for r, err := range tokenPages(ctx, routePage, listedV2Routes, nextV2Routes) {
+			if err != nil {
+				return discovery.SkipResource(s.Name, fmt.Errorf("getting routes: %w", err))
+			}
+			if integration, ok := strings.CutPrefix(aws.ToString(r.Target), "integrations/"); ok {
+				routes[integration] = append(routes[integration], aws.ToString(r.RouteKey))
+			}
+		}
+
+		var integrations integrationTargets
+		integrationPage := func(ctx context.Context, token *string) (*apigatewayv2.GetIntegrationsOutput, error) {
+			return c.client.GetIntegrations(ctx, &apigatewayv2.GetIntegrationsInput{ApiId: aws.String(id), NextToken: token})
+		}
+		for i, err := range tokenPages(ctx, integrationPage, listedV2Integrations, nextV2Integrations) {
+			if err != nil {
+				return discovery.SkipResource(s.Name, fmt.Errorf("getting integrations: %w", err))
+			}
+			for _, route := range routes[aws.ToString(i.IntegrationId)] {
+				integrations.add(aws.ToString(i.IntegrationUri), route)
+			}
+		}
+		s.Relationships = integrations.relationships()
+		return result
+	}
+
+	return fanOut(ctx, Workers, OrderedResults, listAPIs, describeAPI, emit)
+}
+
+func listedV2APIs(page *apigatewayv2.GetApisOutput) []apigwv2types.Api { return page.Items }
+func nextV2APIs(page *apigatewayv2.GetApisOutput) *string              { return page.NextToken }
+
+func listedV2Routes(page *apigatewayv2.GetRoutesOutput) []apigwv2types.Route { return page.Items }
+func nextV2Routes(page *apigatewayv2.GetRoutesOutput) *string                { return page.NextToken }
+
+func listedV2Integrations(page *apigatewayv2.GetIntegrationsOutput) []apigwv2types.Integration {
+	return page.Items
+}
+func nextV2Integrations(page *apigatewayv2.GetIntegrationsOutput) *string { return page.NextToken }
+
+// apiService fills the fields APIs of both kinds share. The ARN is the one
+// IAM and resource policies name the API by, e.g.
+// arn:aws:execute-api:us-east-1:123456789012:abc123, since API Gateway's
+// own ARNs have no account.
+func apiService(s *discovery.Service, region, account, id, name string, typ discovery.ResourceType) {
+	s.Provider = "aws"
+	s.Region = region
+	s.ResourceType = typ
+	s.Name = name
+	s.DiscoveredAt = time.Now().UTC()
+	s.AccountID = account
+	s.ARN = apiARN(region, account, id)
+}
+
+// apiARN returns the execute-api ARN of the API id.
+func apiARN(region, account, id string) string {
+	return "arn:aws:execute-api:" + region + ":" + account + ":" + id
+}
+
+// integrationTargets collects the backends of an API's integrations and the
+// routes sending requests to each.
+type integrationTargets struct {
+	routes map[string][]string
+	types  map[string]discovery.ResourceType
+}
+
+// add records that route sends requests to uri, the URI of an integration:
+// a function (directly or as a Lambda invocation URI), a load balancer or
+// listener, or an HTTP URL. Others, such as AWS service actions, and URIs
+// built from stage variables are left out.
+func (t *integrationTargets) add(uri, route string) {
+	target, typ, ok := integrationTarget(uri)
+	if !ok {
+		return
+	}
+	if t.routes == nil {
+		t.routes, t.types = map[string][]string{}, map[string]discovery.ResourceType{}
+	}
+	t.routes[target] = append(t.routes[target], route)
+	t.types[target] = typ
+}
+
+// relationships returns an integration relationship per backend, sorted by
+// target, with its routes in Via.
+func (t *integrationTargets) relationships() []discovery.Relationship {
+	rels := make([]discovery.Relationship, 0, len(t.routes))
+	for target, routes := range t.routes {
+		sort.Strings(routes)
+		rels = append(rels, discovery.Relationship{
+			Relation:   discovery.RelationIntegration,
+			Target:     target,
+			TargetType: t.types[target],
+			Via:        strings.Join(routes, ", "),
+		})
+	}
+	sort.Slice(rels, func(i, j int) bool { return rels[i].Target < rels[j].Target })
+	return rels
+}
+
+func integrationTarget(uri string) (string, discovery.ResourceType, bool) {
+	// arn:aws:apigateway:us-east-1:lambda:path/2015-03-31/functions/arn:aws:lambda:...:function:orders/invocations
+	if _, fn, ok := strings.Cut(uri, ":lambda:path/2015-03-31/functions/"); ok {
+		uri = strings.TrimSuffix(fn, "/invocations")
+	}
+	if strings.HasPrefix(uri, "arn:") {
+		target, typ, ok := resourceOf(uri)
+		if !ok || strings.Contains(target, "${") || (typ != discovery.ResourceTypeLambdaFunction && typ != discovery.ResourceTypeLoadBalancer) {
+			return "", "", false
+		}
+		return target, typ, true
+	}
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Contains(u.Host, "${") {
+		return "", "", false
+	}
+	// Paths and query strings vary by route; the backend is the host.
+	return u.Scheme + "://" + u.Host, "", true
+}
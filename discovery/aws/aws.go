@@ -0,0 +1,172 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	stscreds "github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// RequestTimeout bounds every attempt of an AWS API call. A zero value
+// leaves calls limited only by the context passed in by the caller.
+var RequestTimeout = 30 * time.Second
+
+// requestContext derives the context used for a single AWS API call, which
+// lasts long enough for all of its attempts; see callTimeout.
+func requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := callTimeout()
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func SetupBaseConfig(ctx context.Context) (aws.Config, error) {
+
+	// Load default config, typically from instance metadata service.
+	// This will be used to load a permanent IAM role
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRetryer(NewRetryer))
+
+	if err != nil {
+
+		fmt.Fprintf(os.Stderr, "Unable to load AWS SDK config file, %v\n", err)
+		return aws.Config{}, err
+
+	}
+	// Instrument service clients only; credential providers built while
+	// loading keep the plain options so their calls are not misattributed.
+	cfg.APIOptions = append(cfg.APIOptions, apiOptions()...)
+
+	return cfg, nil
+}
+
+// LoadConfig loads the default credential chain for clients that are not
+// part of discovery itself, such as sinks, so their calls are not counted as
+// discovery API calls. An empty region uses the configured default.
+func LoadConfig(ctx context.Context, region string) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRetryer(NewRetryer)}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("loading AWS config: %w", err)
+	}
+	return cfg, nil
+}
+
+func CreateIAMClient(cfg aws.Config) *iam.Client {
+
+	// Create IAM Client
+
+	client := iam.NewFromConfig(cfg)
+	return client
+}
+
+func CreateSTSClient(cfg aws.Config) *sts.Client {
+	client := sts.NewFromConfig(cfg)
+	return client
+}
+
+func AssumeWebIdentityRole(ctx context.Context, region, idToken, roleArn string, sessionName string) (aws.Config, error) {
+	stsClient, err := sdkClients{}.STS(ctx, region)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	return assumeWebIdentityRole(ctx, stsClient, region, idToken, roleArn, sessionName)
+}
+
+func assumeWebIdentityRole(ctx context.Context, stsClient STSAPI, region, idToken, roleArn, sessionName string) (aws.Config, error) {
+	reqCtx, cancel := requestContext(ctx)
+	defer cancel()
+	result, err := stsClient.AssumeRoleWithWebIdentity(reqCtx, &sts.AssumeRoleWithWebIdentityInput{
+
+		RoleArn:          aws.String(roleArn),
+		RoleSessionName:  aws.String(sessionName),
+		WebIdentityToken: aws.String(idToken),
+		DurationSeconds:  aws.Int32(3600),
+	})
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	creds := aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+
+		*result.Credentials.AccessKeyId,
+		*result.Credentials.SecretAccessKey,
+		*result.Credentials.SessionToken,
+	))
+
+	return aws.Config{
+		Region:      region,
+		Credentials: creds,
+		Retryer:     NewRetryer,
+		APIOptions:  apiOptions(),
+	}, nil
+
+}
+
+// assumeRole assumes roleArn with the credentials stsClient was created
+// with, as when reaching a member account of an organization from the role
+// discovery logged in with. An empty externalID is not sent.
+func assumeRole(ctx context.Context, stsClient STSAPI, region, roleArn, sessionName, externalID string) (aws.Config, error) {
+	in := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(roleArn),
+		RoleSessionName: aws.String(sessionName),
+		DurationSeconds: aws.Int32(3600),
+	}
+	if externalID != "" {
+		in.ExternalId = aws.String(externalID)
+	}
+	reqCtx, cancel := requestContext(ctx)
+	defer cancel()
+	result, err := stsClient.AssumeRole(reqCtx, in)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	creds := aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+		*result.Credentials.AccessKeyId,
+		*result.Credentials.SecretAccessKey,
+		*result.Credentials.SessionToken,
+	))
+	return aws.Config{
+		Region:      region,
+		Credentials: creds,
+		Retryer:     NewRetryer,
+		APIOptions:  apiOptions(),
+	}, nil
+}
+
+func CreateIAMConfig(roleCredentials *stscreds.AssumeRoleProvider, baseCfg aws.Config, region string) aws.Config {
+
+	// New AWS config with assumed role
+
+	assumedCfg := aws.Config{
+		Region:      region,
+		Credentials: aws.NewCredentialsCache(roleCredentials),
+		Retryer:     NewRetryer,
+		APIOptions:  apiOptions(),
+	}
+
+	return assumedCfg
+
+}
+
+// AccountFromARN returns the account ID field of arn, or "" if arn is not an
+// ARN.
+func AccountFromARN(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
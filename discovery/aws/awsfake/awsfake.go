@@ -0,0 +1,2072 @@
+// Package awsfake provides in-memory implementations of the AWS client
+// interfaces used by package awscmd, so catalogers and providers can be
+// exercised without an AWS account:
+//
+//	fake := awsfake.NewLambda()
+//	fake.AddFunction(lambdatypes.FunctionConfiguration{
+//		FunctionName: aws.String("orders"),
+//		Runtime:      lambdatypes.RuntimeGo1x,
+//	})
+//	provider := &awscmd.Provider{
+//		RoleARN: "arn:aws:iam::123456789012:role/discovery",
+//		IDToken: "token",
+//		Clients: &awsfake.Clients{LambdaClient: fake},
+//	}
+package awsfake
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	apigwtypes "github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	apigwv2types "github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	aastypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfntypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cttypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	cetypes "github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	elb "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbtypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	sfntypes "github.com/aws/aws-sdk-go-v2/service/sfn/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/aws/aws-sdk-go-v2/service/xray"
+	xraytypes "github.com/aws/aws-sdk-go-v2/service/xray/types"
+	"github.com/aws/smithy-go"
+
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+)
+
+// Clients is an awscmd.ClientFactory returning the fakes it holds. A nil
+// STSClient accepts every role assumption; a nil LambdaClient has no
+// functions, nil API Gateway clients no APIs, a nil SFNClient no state
+// machines, a nil EventBridgeClient no event buses, a nil IAMClient no role
+// policies, a nil PolicyClient no queue, topic or bucket policies or
+// subscriptions, a nil XRayClient no traces, a nil CloudTrailClient no
+// logged calls, a nil CloudWatchClient no metric data, a nil
+// CostExplorerClient no costs, a nil CloudFormationClient no stacks, a nil
+// ApplicationAutoScalingClient no scalable targets, a nil ECRClient no
+// images, a nil EC2Client no security groups, subnets or network
+// interfaces and nil ELBClient, Route53Client and CloudFrontClient no load
+// balancers, records or distributions, and a nil OrganizationsClient no
+// organization.
+type Clients struct {
+	STSClient                    *STS
+	LambdaClient                 *Lambda
+	APIGatewayClient             *APIGateway
+	APIGatewayV2Client           *APIGatewayV2
+	SFNClient                    *SFN
+	EventBridgeClient            *EventBridge
+	IAMClient                    *IAM
+	PolicyClient                 *Policies
+	XRayClient                   *XRay
+	CloudTrailClient             *CloudTrail
+	CloudWatchClient             *CloudWatch
+	CostExplorerClient           *CostExplorer
+	CloudFormationClient         *CloudFormation
+	ApplicationAutoScalingClient *ApplicationAutoScaling
+	ECRClient                    *ECR
+	EC2Client                    *EC2
+	ELBClient                    *ELB
+	Route53Client                *Route53
+	CloudFrontClient             *CloudFront
+	OrganizationsClient          *Organizations
+}
+
+func (c *Clients) STS(ctx context.Context, region string) (awscmd.STSAPI, error) {
+	if c.STSClient == nil {
+		return &STS{}, nil
+	}
+	return c.STSClient, nil
+}
+
+func (c *Clients) AssumedSTS(cfg aws.Config) awscmd.STSAPI {
+	if c.STSClient == nil {
+		return &STS{}
+	}
+	return c.STSClient
+}
+
+func (c *Clients) Organizations(cfg aws.Config) awscmd.OrganizationsAPI {
+	if c.OrganizationsClient == nil {
+		return &Organizations{Err: APIError("AWSOrganizationsNotInUseException", "Your account is not a member of an organization.")}
+	}
+	return c.OrganizationsClient
+}
+
+func (c *Clients) Lambda(cfg aws.Config) awscmd.LambdaAPI {
+	if c.LambdaClient == nil {
+		return NewLambda()
+	}
+	return c.LambdaClient
+}
+
+func (c *Clients) APIGateway(cfg aws.Config) awscmd.APIGatewayAPI {
+	if c.APIGatewayClient == nil {
+		return NewAPIGateway()
+	}
+	return c.APIGatewayClient
+}
+
+func (c *Clients) APIGatewayV2(cfg aws.Config) awscmd.APIGatewayV2API {
+	if c.APIGatewayV2Client == nil {
+		return NewAPIGatewayV2()
+	}
+	return c.APIGatewayV2Client
+}
+
+func (c *Clients) SFN(cfg aws.Config) awscmd.SFNAPI {
+	if c.SFNClient == nil {
+		return NewSFN()
+	}
+	return c.SFNClient
+}
+
+func (c *Clients) EventBridge(cfg aws.Config) awscmd.EventBridgeAPI {
+	if c.EventBridgeClient == nil {
+		return NewEventBridge()
+	}
+	return c.EventBridgeClient
+}
+
+func (c *Clients) IAM(cfg aws.Config) awscmd.IAMAPI {
+	if c.IAMClient == nil {
+		return NewIAM()
+	}
+	return c.IAMClient
+}
+
+func (c *Clients) SQS(cfg aws.Config) awscmd.SQSAPI {
+	return c.policies()
+}
+
+func (c *Clients) SNS(cfg aws.Config) awscmd.SNSAPI {
+	return c.policies()
+}
+
+func (c *Clients) S3(cfg aws.Config) awscmd.S3API {
+	return c.policies()
+}
+
+func (c *Clients) XRay(cfg aws.Config) awscmd.XRayAPI {
+	if c.XRayClient == nil {
+		return &XRay{}
+	}
+	return c.XRayClient
+}
+
+func (c *Clients) CloudTrail(cfg aws.Config) awscmd.CloudTrailAPI {
+	if c.CloudTrailClient == nil {
+		return &CloudTrail{}
+	}
+	return c.CloudTrailClient
+}
+
+func (c *Clients) CloudWatch(cfg aws.Config) awscmd.CloudWatchAPI {
+	if c.CloudWatchClient == nil {
+		return NewCloudWatch()
+	}
+	return c.CloudWatchClient
+}
+
+func (c *Clients) CostExplorer(cfg aws.Config) awscmd.CostExplorerAPI {
+	if c.CostExplorerClient == nil {
+		return &CostExplorer{}
+	}
+	return c.CostExplorerClient
+}
+
+func (c *Clients) ApplicationAutoScaling(cfg aws.Config) awscmd.ApplicationAutoScalingAPI {
+	if c.ApplicationAutoScalingClient == nil {
+		return &ApplicationAutoScaling{}
+	}
+	return c.ApplicationAutoScalingClient
+}
+
+func (c *Clients) CloudFormation(cfg aws.Config) awscmd.CloudFormationAPI {
+	if c.CloudFormationClient == nil {
+		return &CloudFormation{}
+	}
+	return c.CloudFormationClient
+}
+
+func (c *Clients) ECR(cfg aws.Config) awscmd.ECRAPI {
+	if c.ECRClient == nil {
+		return &ECR{}
+	}
+	return c.ECRClient
+}
+
+func (c *Clients) EC2(cfg aws.Config) awscmd.EC2API {
+	if c.EC2Client == nil {
+		return &EC2{}
+	}
+	return c.EC2Client
+}
+
+func (c *Clients) ELB(cfg aws.Config) awscmd.ELBAPI {
+	if c.ELBClient == nil {
+		return &ELB{}
+	}
+	return c.ELBClient
+}
+
+func (c *Clients) Route53(cfg aws.Config) awscmd.Route53API {
+	if c.Route53Client == nil {
+		return &Route53{}
+	}
+	return c.Route53Client
+}
+
+func (c *Clients) CloudFront(cfg aws.Config) awscmd.CloudFrontAPI {
+	if c.CloudFrontClient == nil {
+		return &CloudFront{}
+	}
+	return c.CloudFrontClient
+}
+
+func (c *Clients) policies() *Policies {
+	if c.PolicyClient == nil {
+		return NewPolicies()
+	}
+	return c.PolicyClient
+}
+
+// STS fakes role assumption. It returns static credentials, or Err if set.
+type STS struct {
+	Err error
+
+	mu        sync.Mutex
+	calls     []sts.AssumeRoleWithWebIdentityInput
+	roleCalls []sts.AssumeRoleInput
+}
+
+func (s *STS) AssumeRoleWithWebIdentity(ctx context.Context, in *sts.AssumeRoleWithWebIdentityInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	s.mu.Lock()
+	s.calls = append(s.calls, *in)
+	s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return &sts.AssumeRoleWithWebIdentityOutput{
+		Credentials: &ststypes.Credentials{
+			AccessKeyId:     aws.String("AKIDFAKE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("session"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+// Calls returns the inputs of every AssumeRoleWithWebIdentity call so far.
+func (s *STS) Calls() []sts.AssumeRoleWithWebIdentityInput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sts.AssumeRoleWithWebIdentityInput(nil), s.calls...)
+}
+
+func (s *STS) AssumeRole(ctx context.Context, in *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	s.mu.Lock()
+	s.roleCalls = append(s.roleCalls, *in)
+	s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return &sts.AssumeRoleOutput{
+		Credentials: &ststypes.Credentials{
+			AccessKeyId:     aws.String("AKIDFAKE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("session"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+// RoleCalls returns the inputs of every AssumeRole call so far.
+func (s *STS) RoleCalls() []sts.AssumeRoleInput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sts.AssumeRoleInput(nil), s.roleCalls...)
+}
+
+// Organizations fakes the accounts of an organization. ListAccounts returns
+// Accounts, PageSize at a time, or Err if set.
+type Organizations struct {
+	Accounts []orgtypes.Account
+	// Parents are the IDs of the organizational units holding accounts, by
+	// account ID; accounts without one are at the root. Units are the
+	// names of organizational units, by ID.
+	Parents map[string]string
+	Units   map[string]string
+	// Delegated are the services delegated to accounts, by account ID;
+	// the accounts must be among Accounts.
+	Delegated map[string][]orgtypes.DelegatedService
+	// PageSize is the number of accounts per ListAccounts page; values
+	// below 1 return them all at once.
+	PageSize int
+	Err      error
+}
+
+func (o *Organizations) ListAccounts(ctx context.Context, in *organizations.ListAccountsInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if o.Err != nil {
+		return nil, o.Err
+	}
+	start := 0
+	if in.NextToken != nil {
+		n, err := strconv.Atoi(*in.NextToken)
+		if err != nil {
+			return nil, APIError("InvalidInputException", "invalid token")
+		}
+		start = n
+	}
+	end := len(o.Accounts)
+	if o.PageSize > 0 {
+		end = min(start+o.PageSize, end)
+	}
+	out := &organizations.ListAccountsOutput{Accounts: append([]orgtypes.Account(nil), o.Accounts[start:end]...)}
+	if end < len(o.Accounts) {
+		out.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+func (o *Organizations) ListParents(ctx context.Context, in *organizations.ListParentsInput, optFns ...func(*organizations.Options)) (*organizations.ListParentsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if o.Err != nil {
+		return nil, o.Err
+	}
+	if id, ok := o.Parents[aws.ToString(in.ChildId)]; ok {
+		return &organizations.ListParentsOutput{Parents: []orgtypes.Parent{{Id: aws.String(id), Type: orgtypes.ParentTypeOrganizationalUnit}}}, nil
+	}
+	return &organizations.ListParentsOutput{Parents: []orgtypes.Parent{{Id: aws.String("r-root"), Type: orgtypes.ParentTypeRoot}}}, nil
+}
+
+func (o *Organizations) DescribeOrganizationalUnit(ctx context.Context, in *organizations.DescribeOrganizationalUnitInput, optFns ...func(*organizations.Options)) (*organizations.DescribeOrganizationalUnitOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if o.Err != nil {
+		return nil, o.Err
+	}
+	id := aws.ToString(in.OrganizationalUnitId)
+	name, ok := o.Units[id]
+	if !ok {
+		return nil, APIError("OrganizationalUnitNotFoundException", "organizational unit "+id+" not found")
+	}
+	return &organizations.DescribeOrganizationalUnitOutput{OrganizationalUnit: &orgtypes.OrganizationalUnit{Id: aws.String(id), Name: aws.String(name)}}, nil
+}
+
+func (o *Organizations) ListDelegatedAdministrators(ctx context.Context, in *organizations.ListDelegatedAdministratorsInput, optFns ...func(*organizations.Options)) (*organizations.ListDelegatedAdministratorsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if o.Err != nil {
+		return nil, o.Err
+	}
+	out := &organizations.ListDelegatedAdministratorsOutput{}
+	for _, a := range o.Accounts {
+		if _, ok := o.Delegated[aws.ToString(a.Id)]; !ok {
+			continue
+		}
+		out.DelegatedAdministrators = append(out.DelegatedAdministrators, orgtypes.DelegatedAdministrator{
+			Id:     a.Id,
+			Arn:    a.Arn,
+			Name:   a.Name,
+			Email:  a.Email,
+			Status: a.Status,
+		})
+	}
+	return out, nil
+}
+
+func (o *Organizations) ListDelegatedServicesForAccount(ctx context.Context, in *organizations.ListDelegatedServicesForAccountInput, optFns ...func(*organizations.Options)) (*organizations.ListDelegatedServicesForAccountOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if o.Err != nil {
+		return nil, o.Err
+	}
+	id := aws.ToString(in.AccountId)
+	services, ok := o.Delegated[id]
+	if !ok {
+		return nil, APIError("AccountNotRegisteredException", "account "+id+" is not a delegated administrator")
+	}
+	return &organizations.ListDelegatedServicesForAccountOutput{DelegatedServices: services}, nil
+}
+
+// Lambda is an in-memory Lambda service. Create it with NewLambda; it is safe
+// for concurrent use.
+type Lambda struct {
+	// PageSize is the number of functions per ListFunctions page, and of
+	// mappings per ListEventSourceMappings page; values below 1 mean the
+	// service defaults of 50 and 100.
+	PageSize int
+	// ListErr, if set, is returned by ListFunctions.
+	ListErr error
+	// GetErr, if set, is returned by every GetFunction call, e.g.
+	// AccessDenied() for a role that may only list functions.
+	GetErr error
+	// MappingsErr, if set, is returned by ListEventSourceMappings.
+	MappingsErr error
+
+	mu          sync.Mutex
+	functions   map[string]*lambda.GetFunctionOutput
+	mappings    []lambdatypes.EventSourceMappingConfiguration
+	policies    map[string]string
+	urls        map[string]*lambda.GetFunctionUrlConfigOutput
+	provisioned map[string][]lambdatypes.ProvisionedConcurrencyConfigListItem
+	invoke      map[string][]lambdatypes.FunctionEventInvokeConfig
+	layers      map[string]*lambdatypes.LayerVersionContentOutput
+	limit       *lambdatypes.AccountLimit
+	errs        map[string]error
+	calls       map[string]int
+}
+
+// NewLambda returns an empty fake.
+func NewLambda() *Lambda {
+	return &Lambda{
+		functions:   map[string]*lambda.GetFunctionOutput{},
+		policies:    map[string]string{},
+		urls:        map[string]*lambda.GetFunctionUrlConfigOutput{},
+		provisioned: map[string][]lambdatypes.ProvisionedConcurrencyConfigListItem{},
+		invoke:      map[string][]lambdatypes.FunctionEventInvokeConfig{},
+		layers:      map[string]*lambdatypes.LayerVersionContentOutput{},
+		errs:        map[string]error{},
+		calls:       map[string]int{},
+	}
+}
+
+// AddFunction adds a function. Its ARN is filled in if missing.
+func (l *Lambda) AddFunction(cfg lambdatypes.FunctionConfiguration) {
+	l.AddFunctionOutput(&lambda.GetFunctionOutput{Configuration: &cfg})
+}
+
+// AddFunctionOutput adds a function with the full GetFunction response,
+// including code location and concurrency.
+func (l *Lambda) AddFunctionOutput(out *lambda.GetFunctionOutput) {
+	if out.Configuration == nil || out.Configuration.FunctionName == nil {
+		panic("awsfake: function has no name")
+	}
+	name := aws.ToString(out.Configuration.FunctionName)
+	if out.Configuration.FunctionArn == nil {
+		out.Configuration.FunctionArn = aws.String("arn:aws:lambda:us-east-1:123456789012:function:" + name)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.functions[name] = out
+}
+
+// AddEventSourceMapping adds an event source mapping. Its UUID is filled in
+// if missing.
+func (l *Lambda) AddEventSourceMapping(m lambdatypes.EventSourceMappingConfiguration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if m.UUID == nil {
+		m.UUID = aws.String(fmt.Sprintf("00000000-0000-0000-0000-%012d", len(l.mappings)+1))
+	}
+	l.mappings = append(l.mappings, m)
+}
+
+// SetPolicy sets the resource policy of the function name, as AddPermission
+// statements make it.
+func (l *Lambda) SetPolicy(name, document string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policies[name] = document
+}
+
+// SetFunctionURL gives the function name a function URL with authType,
+// e.g. lambdatypes.FunctionUrlAuthTypeNone.
+func (l *Lambda) SetFunctionURL(name, url string, authType lambdatypes.FunctionUrlAuthType) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.urls[name] = &lambda.GetFunctionUrlConfigOutput{FunctionUrl: aws.String(url), AuthType: authType}
+}
+
+// SetProvisionedConcurrency configures requested provisioned concurrency on
+// the alias or version qualifier of the function name, all of it allocated.
+func (l *Lambda) SetProvisionedConcurrency(name, qualifier string, requested int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.provisioned[name] = append(l.provisioned[name], lambdatypes.ProvisionedConcurrencyConfigListItem{
+		FunctionArn:                              aws.String("arn:aws:lambda:us-east-1:123456789012:function:" + name + ":" + qualifier),
+		RequestedProvisionedConcurrentExecutions: aws.Int32(requested),
+		AllocatedProvisionedConcurrentExecutions: aws.Int32(requested),
+		AvailableProvisionedConcurrentExecutions: aws.Int32(requested),
+		Status:                                   lambdatypes.ProvisionedConcurrencyStatusEnumReady,
+	})
+}
+
+// SetDestinations sends the records of asynchronous invocations of the
+// alias or version qualifier of the function name to onSuccess and
+// onFailure, either of which may be empty.
+func (l *Lambda) SetDestinations(name, qualifier, onSuccess, onFailure string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	config := lambdatypes.FunctionEventInvokeConfig{
+		FunctionArn:       aws.String("arn:aws:lambda:us-east-1:123456789012:function:" + name + ":" + qualifier),
+		DestinationConfig: &lambdatypes.DestinationConfig{},
+	}
+	if onSuccess != "" {
+		config.DestinationConfig.OnSuccess = &lambdatypes.OnSuccess{Destination: aws.String(onSuccess)}
+	}
+	if onFailure != "" {
+		config.DestinationConfig.OnFailure = &lambdatypes.OnFailure{Destination: aws.String(onFailure)}
+	}
+	l.invoke[name] = append(l.invoke[name], config)
+}
+
+// AddLayerVersion adds the layer version arn, whose archive is downloaded
+// from location and has the base64-encoded SHA-256 sha256.
+func (l *Lambda) AddLayerVersion(arn, location, sha256 string, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.layers[arn] = &lambdatypes.LayerVersionContentOutput{Location: aws.String(location), CodeSha256: aws.String(sha256), CodeSize: size}
+}
+
+// SetAccountConcurrency sets the concurrency limit of the account and how
+// much of it is unreserved; both are 1000 unless set.
+func (l *Lambda) SetAccountConcurrency(limit, unreserved int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = &lambdatypes.AccountLimit{ConcurrentExecutions: limit, UnreservedConcurrentExecutions: aws.Int32(unreserved)}
+}
+
+// FailFunction makes GetFunction return err for name, e.g. AccessDenied().
+func (l *Lambda) FailFunction(name string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errs[name] = err
+}
+
+// Calls returns how many times operation (e.g. "GetFunction") was called.
+func (l *Lambda) Calls(operation string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.calls[operation]
+}
+
+func (l *Lambda) ListFunctions(ctx context.Context, in *lambda.ListFunctionsInput, optFns ...func(*lambda.Options)) (*lambda.ListFunctionsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls["ListFunctions"]++
+	if l.ListErr != nil {
+		return nil, l.ListErr
+	}
+
+	names := make([]string, 0, len(l.functions))
+	for name := range l.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	start := 0
+	if in.Marker != nil {
+		n, err := strconv.Atoi(*in.Marker)
+		if err != nil {
+			return nil, APIError("InvalidParameterValueException", "invalid marker")
+		}
+		start = n
+	}
+	size := l.PageSize
+	if size < 1 {
+		size = 50
+	}
+	end := min(start+size, len(names))
+
+	out := &lambda.ListFunctionsOutput{}
+	for _, name := range names[start:end] {
+		out.Functions = append(out.Functions, *l.functions[name].Configuration)
+	}
+	if end < len(names) {
+		out.NextMarker = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+func (l *Lambda) GetFunction(ctx context.Context, in *lambda.GetFunctionInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls["GetFunction"]++
+	if l.GetErr != nil {
+		return nil, l.GetErr
+	}
+	name := aws.ToString(in.FunctionName)
+	if strings.HasPrefix(name, "arn:") {
+		// An ARN names the function of its account.
+		for n, out := range l.functions {
+			if aws.ToString(out.Configuration.FunctionArn) == name {
+				name = n
+				break
+			}
+		}
+	}
+	if err := l.errs[name]; err != nil {
+		return nil, err
+	}
+	out, ok := l.functions[name]
+	if !ok {
+		return nil, APIError("ResourceNotFoundException", fmt.Sprintf("Function not found: %s", name))
+	}
+	return out, nil
+}
+
+// GetPolicy returns the policy of a function given by name or ARN. Errors set
+// with FailFunction apply to it too.
+func (l *Lambda) GetPolicy(ctx context.Context, in *lambda.GetPolicyInput, optFns ...func(*lambda.Options)) (*lambda.GetPolicyOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls["GetPolicy"]++
+	name := aws.ToString(in.FunctionName)
+	name = name[strings.LastIndex(name, ":")+1:]
+	if err := l.errs[name]; err != nil {
+		return nil, err
+	}
+	doc, ok := l.policies[name]
+	if !ok {
+		return nil, APIError("ResourceNotFoundException", "The resource you requested does not exist.")
+	}
+	return &lambda.GetPolicyOutput{Policy: aws.String(doc), RevisionId: aws.String("1")}, nil
+}
+
+func (l *Lambda) GetFunctionUrlConfig(ctx context.Context, in *lambda.GetFunctionUrlConfigInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionUrlConfigOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls["GetFunctionUrlConfig"]++
+	name := aws.ToString(in.FunctionName)
+	name = name[strings.LastIndex(name, ":")+1:]
+	if err := l.errs[name]; err != nil {
+		return nil, err
+	}
+	out, ok := l.urls[name]
+	if !ok {
+		return nil, APIError("ResourceNotFoundException", "The resource you requested does not exist.")
+	}
+	return out, nil
+}
+
+func (l *Lambda) ListProvisionedConcurrencyConfigs(ctx context.Context, in *lambda.ListProvisionedConcurrencyConfigsInput, optFns ...func(*lambda.Options)) (*lambda.ListProvisionedConcurrencyConfigsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls["ListProvisionedConcurrencyConfigs"]++
+	name := aws.ToString(in.FunctionName)
+	name = name[strings.LastIndex(name, ":")+1:]
+	if err := l.errs[name]; err != nil {
+		return nil, err
+	}
+	return &lambda.ListProvisionedConcurrencyConfigsOutput{ProvisionedConcurrencyConfigs: l.provisioned[name]}, nil
+}
+
+func (l *Lambda) GetLayerVersionByArn(ctx context.Context, in *lambda.GetLayerVersionByArnInput, optFns ...func(*lambda.Options)) (*lambda.GetLayerVersionByArnOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls["GetLayerVersionByArn"]++
+	arn := aws.ToString(in.Arn)
+	content, ok := l.layers[arn]
+	if !ok {
+		return nil, APIError("ResourceNotFoundException", "The resource you requested does not exist.")
+	}
+	return &lambda.GetLayerVersionByArnOutput{LayerVersionArn: aws.String(arn), Content: content}, nil
+}
+
+func (l *Lambda) GetAccountSettings(ctx context.Context, in *lambda.GetAccountSettingsInput, optFns ...func(*lambda.Options)) (*lambda.GetAccountSettingsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls["GetAccountSettings"]++
+	limit := l.limit
+	if limit == nil {
+		limit = &lambdatypes.AccountLimit{ConcurrentExecutions: 1000, UnreservedConcurrentExecutions: aws.Int32(1000)}
+	}
+	return &lambda.GetAccountSettingsOutput{AccountLimit: limit}, nil
+}
+
+func (l *Lambda) ListFunctionEventInvokeConfigs(ctx context.Context, in *lambda.ListFunctionEventInvokeConfigsInput, optFns ...func(*lambda.Options)) (*lambda.ListFunctionEventInvokeConfigsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls["ListFunctionEventInvokeConfigs"]++
+	name := aws.ToString(in.FunctionName)
+	name = name[strings.LastIndex(name, ":")+1:]
+	if err := l.errs[name]; err != nil {
+		return nil, err
+	}
+	return &lambda.ListFunctionEventInvokeConfigsOutput{FunctionEventInvokeConfigs: l.invoke[name]}, nil
+}
+
+func (l *Lambda) ListEventSourceMappings(ctx context.Context, in *lambda.ListEventSourceMappingsInput, optFns ...func(*lambda.Options)) (*lambda.ListEventSourceMappingsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls["ListEventSourceMappings"]++
+	if l.MappingsErr != nil {
+		return nil, l.MappingsErr
+	}
+
+	start := 0
+	if in.Marker != nil {
+		n, err := strconv.Atoi(*in.Marker)
+		if err != nil {
+			return nil, APIError("InvalidParameterValueException", "invalid marker")
+		}
+		start = n
+	}
+	size := l.PageSize
+	if size < 1 {
+		size = 100
+	}
+	end := min(start+size, len(l.mappings))
+
+	out := &lambda.ListEventSourceMappingsOutput{
+		EventSourceMappings: append([]lambdatypes.EventSourceMappingConfiguration(nil), l.mappings[start:end]...),
+	}
+	if end < len(l.mappings) {
+		out.NextMarker = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+// APIGateway is an in-memory API Gateway service with REST APIs. Create it
+// with NewAPIGateway; it is safe for concurrent use.
+type APIGateway struct {
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+
+	mu        sync.Mutex
+	apis      []apigwtypes.RestApi
+	resources map[string][]apigwtypes.Resource
+	links     map[string][]string
+	domains   []apigwtypes.DomainName
+	mappings  map[string][]apigwtypes.BasePathMapping
+}
+
+// NewAPIGateway returns a fake without APIs.
+func NewAPIGateway() *APIGateway {
+	return &APIGateway{resources: map[string][]apigwtypes.Resource{}, links: map[string][]string{}, mappings: map[string][]apigwtypes.BasePathMapping{}}
+}
+
+// AddRestAPI adds api with resources, whose methods carry their
+// integrations as GetResources embeds them.
+func (g *APIGateway) AddRestAPI(api apigwtypes.RestApi, resources ...apigwtypes.Resource) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.apis = append(g.apis, api)
+	g.resources[aws.ToString(api.Id)] = resources
+}
+
+// AddVpcLink adds the VPC link id to the load balancers targets.
+func (g *APIGateway) AddVpcLink(id string, targets ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.links[id] = targets
+}
+
+// AddDomainName adds the custom domain name d and its base path mappings.
+func (g *APIGateway) AddDomainName(d apigwtypes.DomainName, mappings ...apigwtypes.BasePathMapping) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.domains = append(g.domains, d)
+	g.mappings[aws.ToString(d.DomainName)] = mappings
+}
+
+func (g *APIGateway) GetDomainNames(ctx context.Context, in *apigateway.GetDomainNamesInput, optFns ...func(*apigateway.Options)) (*apigateway.GetDomainNamesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	return &apigateway.GetDomainNamesOutput{Items: append([]apigwtypes.DomainName(nil), g.domains...)}, nil
+}
+
+func (g *APIGateway) GetBasePathMappings(ctx context.Context, in *apigateway.GetBasePathMappingsInput, optFns ...func(*apigateway.Options)) (*apigateway.GetBasePathMappingsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	return &apigateway.GetBasePathMappingsOutput{Items: append([]apigwtypes.BasePathMapping(nil), g.mappings[aws.ToString(in.DomainName)]...)}, nil
+}
+
+func (g *APIGateway) GetRestApis(ctx context.Context, in *apigateway.GetRestApisInput, optFns ...func(*apigateway.Options)) (*apigateway.GetRestApisOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	return &apigateway.GetRestApisOutput{Items: append([]apigwtypes.RestApi(nil), g.apis...)}, nil
+}
+
+func (g *APIGateway) GetResources(ctx context.Context, in *apigateway.GetResourcesInput, optFns ...func(*apigateway.Options)) (*apigateway.GetResourcesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	resources, ok := g.resources[aws.ToString(in.RestApiId)]
+	if !ok {
+		return nil, APIError("NotFoundException", "Invalid API identifier specified")
+	}
+	return &apigateway.GetResourcesOutput{Items: append([]apigwtypes.Resource(nil), resources...)}, nil
+}
+
+func (g *APIGateway) GetVpcLink(ctx context.Context, in *apigateway.GetVpcLinkInput, optFns ...func(*apigateway.Options)) (*apigateway.GetVpcLinkOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	targets, ok := g.links[aws.ToString(in.VpcLinkId)]
+	if !ok {
+		return nil, APIError("NotFoundException", "Invalid VPC link identifier specified")
+	}
+	return &apigateway.GetVpcLinkOutput{Id: in.VpcLinkId, TargetArns: targets}, nil
+}
+
+// APIGatewayV2 is an in-memory API Gateway service with HTTP and WebSocket
+// APIs. Create it with NewAPIGatewayV2; it is safe for concurrent use.
+type APIGatewayV2 struct {
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+
+	mu           sync.Mutex
+	apis         []apigwv2types.Api
+	routes       map[string][]apigwv2types.Route
+	integrations map[string][]apigwv2types.Integration
+	domains      []apigwv2types.DomainName
+	mappings     map[string][]apigwv2types.ApiMapping
+}
+
+// NewAPIGatewayV2 returns a fake without APIs.
+func NewAPIGatewayV2() *APIGatewayV2 {
+	return &APIGatewayV2{
+		routes:       map[string][]apigwv2types.Route{},
+		integrations: map[string][]apigwv2types.Integration{},
+		mappings:     map[string][]apigwv2types.ApiMapping{},
+	}
+}
+
+// AddAPI adds api with its routes and integrations.
+func (g *APIGatewayV2) AddAPI(api apigwv2types.Api, routes []apigwv2types.Route, integrations []apigwv2types.Integration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.apis = append(g.apis, api)
+	g.routes[aws.ToString(api.ApiId)] = routes
+	g.integrations[aws.ToString(api.ApiId)] = integrations
+}
+
+// AddDomainName adds the custom domain name d and its API mappings.
+func (g *APIGatewayV2) AddDomainName(d apigwv2types.DomainName, mappings ...apigwv2types.ApiMapping) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.domains = append(g.domains, d)
+	g.mappings[aws.ToString(d.DomainName)] = mappings
+}
+
+func (g *APIGatewayV2) GetDomainNames(ctx context.Context, in *apigatewayv2.GetDomainNamesInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetDomainNamesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	return &apigatewayv2.GetDomainNamesOutput{Items: append([]apigwv2types.DomainName(nil), g.domains...)}, nil
+}
+
+func (g *APIGatewayV2) GetApiMappings(ctx context.Context, in *apigatewayv2.GetApiMappingsInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetApiMappingsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	return &apigatewayv2.GetApiMappingsOutput{Items: append([]apigwv2types.ApiMapping(nil), g.mappings[aws.ToString(in.DomainName)]...)}, nil
+}
+
+func (g *APIGatewayV2) GetApis(ctx context.Context, in *apigatewayv2.GetApisInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetApisOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	return &apigatewayv2.GetApisOutput{Items: append([]apigwv2types.Api(nil), g.apis...)}, nil
+}
+
+func (g *APIGatewayV2) GetRoutes(ctx context.Context, in *apigatewayv2.GetRoutesInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetRoutesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	return &apigatewayv2.GetRoutesOutput{Items: append([]apigwv2types.Route(nil), g.routes[aws.ToString(in.ApiId)]...)}, nil
+}
+
+func (g *APIGatewayV2) GetIntegrations(ctx context.Context, in *apigatewayv2.GetIntegrationsInput, optFns ...func(*apigatewayv2.Options)) (*apigatewayv2.GetIntegrationsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	return &apigatewayv2.GetIntegrationsOutput{Items: append([]apigwv2types.Integration(nil), g.integrations[aws.ToString(in.ApiId)]...)}, nil
+}
+
+// SFN is an in-memory Step Functions service. Create it with NewSFN; it is
+// safe for concurrent use.
+type SFN struct {
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+
+	mu       sync.Mutex
+	machines []*sfn.DescribeStateMachineOutput
+}
+
+// NewSFN returns a fake without state machines.
+func NewSFN() *SFN {
+	return &SFN{}
+}
+
+// AddStateMachine adds the state machine sm describes, e.g. with its
+// StateMachineArn, Name and Definition.
+func (f *SFN) AddStateMachine(sm *sfn.DescribeStateMachineOutput) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.machines = append(f.machines, sm)
+}
+
+func (f *SFN) ListStateMachines(ctx context.Context, in *sfn.ListStateMachinesInput, optFns ...func(*sfn.Options)) (*sfn.ListStateMachinesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	out := &sfn.ListStateMachinesOutput{}
+	for _, sm := range f.machines {
+		out.StateMachines = append(out.StateMachines, sfntypes.StateMachineListItem{
+			StateMachineArn: sm.StateMachineArn,
+			Name:            sm.Name,
+			Type:            sm.Type,
+			CreationDate:    sm.CreationDate,
+		})
+	}
+	return out, nil
+}
+
+func (f *SFN) DescribeStateMachine(ctx context.Context, in *sfn.DescribeStateMachineInput, optFns ...func(*sfn.Options)) (*sfn.DescribeStateMachineOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	for _, sm := range f.machines {
+		if aws.ToString(sm.StateMachineArn) == aws.ToString(in.StateMachineArn) {
+			return sm, nil
+		}
+	}
+	return nil, APIError("StateMachineDoesNotExist", "State Machine Does Not Exist")
+}
+
+// EventBridge is an in-memory EventBridge service. Create it with
+// NewEventBridge; it is safe for concurrent use.
+type EventBridge struct {
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+
+	mu      sync.Mutex
+	buses   []ebtypes.EventBus
+	rules   map[string][]ebtypes.Rule
+	targets map[string][]ebtypes.Target
+}
+
+// NewEventBridge returns a fake without event buses.
+func NewEventBridge() *EventBridge {
+	return &EventBridge{rules: map[string][]ebtypes.Rule{}, targets: map[string][]ebtypes.Target{}}
+}
+
+// AddBus adds the event bus bus, e.g. with its Name, Arn and Policy.
+func (f *EventBridge) AddBus(bus ebtypes.EventBus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buses = append(f.buses, bus)
+}
+
+// AddRule adds rule to the bus it names, or the default bus, with targets.
+func (f *EventBridge) AddRule(rule ebtypes.Rule, targets ...ebtypes.Target) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bus := aws.ToString(rule.EventBusName)
+	if bus == "" {
+		bus = "default"
+	}
+	f.rules[bus] = append(f.rules[bus], rule)
+	f.targets[bus+"/"+aws.ToString(rule.Name)] = targets
+}
+
+func (f *EventBridge) ListEventBuses(ctx context.Context, in *eventbridge.ListEventBusesInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListEventBusesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return &eventbridge.ListEventBusesOutput{EventBuses: append([]ebtypes.EventBus(nil), f.buses...)}, nil
+}
+
+func (f *EventBridge) ListRules(ctx context.Context, in *eventbridge.ListRulesInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListRulesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return &eventbridge.ListRulesOutput{Rules: append([]ebtypes.Rule(nil), f.rules[aws.ToString(in.EventBusName)]...)}, nil
+}
+
+func (f *EventBridge) ListTargetsByRule(ctx context.Context, in *eventbridge.ListTargetsByRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListTargetsByRuleOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	targets, ok := f.targets[aws.ToString(in.EventBusName)+"/"+aws.ToString(in.Rule)]
+	if !ok {
+		return nil, APIError("ResourceNotFoundException", "Rule does not exist")
+	}
+	return &eventbridge.ListTargetsByRuleOutput{Targets: append([]ebtypes.Target(nil), targets...)}, nil
+}
+
+// IAM is an in-memory store of role policies. Create it with NewIAM; it is
+// safe for concurrent use.
+type IAM struct {
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+	// AccountAliases are the account's aliases; IAM allows at most one.
+	AccountAliases []string
+
+	mu       sync.Mutex
+	inline   map[string]map[string]string
+	attached map[string][]string
+	managed  map[string]string
+	calls    map[string]int
+}
+
+// NewIAM returns a fake without roles.
+func NewIAM() *IAM {
+	return &IAM{
+		inline:   map[string]map[string]string{},
+		attached: map[string][]string{},
+		managed:  map[string]string{},
+		calls:    map[string]int{},
+	}
+}
+
+// PutRolePolicy adds the inline policy name to role, given its name.
+func (i *IAM) PutRolePolicy(role, name, document string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.inline[role] == nil {
+		i.inline[role] = map[string]string{}
+	}
+	i.inline[role][name] = document
+}
+
+// AttachRolePolicy attaches the managed policy arn to role, given its name,
+// creating the policy with document unless document is empty.
+func (i *IAM) AttachRolePolicy(role, arn, document string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.attached[role] = append(i.attached[role], arn)
+	if document != "" {
+		i.managed[arn] = document
+	}
+}
+
+// Calls returns how many times operation (e.g. "GetRolePolicy") was called.
+func (i *IAM) Calls(operation string) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.calls[operation]
+}
+
+// call counts operation and returns the error it should fail with.
+func (i *IAM) call(ctx context.Context, operation string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	i.calls[operation]++
+	return i.Err
+}
+
+func (i *IAM) ListAccountAliases(ctx context.Context, in *iam.ListAccountAliasesInput, optFns ...func(*iam.Options)) (*iam.ListAccountAliasesOutput, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := i.call(ctx, "ListAccountAliases"); err != nil {
+		return nil, err
+	}
+	return &iam.ListAccountAliasesOutput{AccountAliases: append([]string{}, i.AccountAliases...)}, nil
+}
+
+func (i *IAM) ListRolePolicies(ctx context.Context, in *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := i.call(ctx, "ListRolePolicies"); err != nil {
+		return nil, err
+	}
+	out := &iam.ListRolePoliciesOutput{}
+	for name := range i.inline[aws.ToString(in.RoleName)] {
+		out.PolicyNames = append(out.PolicyNames, name)
+	}
+	sort.Strings(out.PolicyNames)
+	return out, nil
+}
+
+func (i *IAM) GetRolePolicy(ctx context.Context, in *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := i.call(ctx, "GetRolePolicy"); err != nil {
+		return nil, err
+	}
+	doc, ok := i.inline[aws.ToString(in.RoleName)][aws.ToString(in.PolicyName)]
+	if !ok {
+		return nil, APIError("NoSuchEntity", "The role policy cannot be found.")
+	}
+	return &iam.GetRolePolicyOutput{RoleName: in.RoleName, PolicyName: in.PolicyName, PolicyDocument: aws.String(url.PathEscape(doc))}, nil
+}
+
+func (i *IAM) ListAttachedRolePolicies(ctx context.Context, in *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := i.call(ctx, "ListAttachedRolePolicies"); err != nil {
+		return nil, err
+	}
+	out := &iam.ListAttachedRolePoliciesOutput{}
+	for _, arn := range i.attached[aws.ToString(in.RoleName)] {
+		out.AttachedPolicies = append(out.AttachedPolicies, iamtypes.AttachedPolicy{
+			PolicyArn:  aws.String(arn),
+			PolicyName: aws.String(arn[strings.LastIndex(arn, "/")+1:]),
+		})
+	}
+	return out, nil
+}
+
+func (i *IAM) GetPolicy(ctx context.Context, in *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := i.call(ctx, "GetPolicy"); err != nil {
+		return nil, err
+	}
+	if _, ok := i.managed[aws.ToString(in.PolicyArn)]; !ok {
+		return nil, APIError("NoSuchEntity", "Policy does not exist.")
+	}
+	return &iam.GetPolicyOutput{Policy: &iamtypes.Policy{Arn: in.PolicyArn, DefaultVersionId: aws.String("v1")}}, nil
+}
+
+func (i *IAM) GetPolicyVersion(ctx context.Context, in *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := i.call(ctx, "GetPolicyVersion"); err != nil {
+		return nil, err
+	}
+	doc, ok := i.managed[aws.ToString(in.PolicyArn)]
+	if !ok || aws.ToString(in.VersionId) != "v1" {
+		return nil, APIError("NoSuchEntity", "Policy version does not exist.")
+	}
+	return &iam.GetPolicyVersionOutput{PolicyVersion: &iamtypes.PolicyVersion{
+		VersionId:        in.VersionId,
+		IsDefaultVersion: true,
+		Document:         aws.String(url.PathEscape(doc)),
+	}}, nil
+}
+
+// Policies is an in-memory store of the resource policies of SQS queues,
+// SNS topics and S3 buckets, by ARN, and of topics' subscriptions. Create it
+// with NewPolicies; it is safe for concurrent use.
+type Policies struct {
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+
+	mu            sync.Mutex
+	policies      map[string]string
+	subscriptions map[string][]snstypes.Subscription
+	calls         map[string]int
+}
+
+// NewPolicies returns a fake without policies.
+func NewPolicies() *Policies {
+	return &Policies{policies: map[string]string{}, subscriptions: map[string][]snstypes.Subscription{}, calls: map[string]int{}}
+}
+
+// Subscribe adds a confirmed subscription of endpoint to the topic arn.
+func (p *Policies) Subscribe(arn, protocol, endpoint string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscriptions[arn] = append(p.subscriptions[arn], snstypes.Subscription{
+		TopicArn:        aws.String(arn),
+		Protocol:        aws.String(protocol),
+		Endpoint:        aws.String(endpoint),
+		SubscriptionArn: aws.String(arn + ":" + strconv.Itoa(len(p.subscriptions[arn])+1)),
+	})
+}
+
+// SetPolicy sets the policy of the queue, topic or bucket arn, e.g.
+// arn:aws:s3:::uploads.
+func (p *Policies) SetPolicy(arn, document string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policies[arn] = document
+}
+
+// Calls returns how many times operation (e.g. "GetBucketPolicy") was
+// called.
+func (p *Policies) Calls(operation string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[operation]
+}
+
+// call counts operation and returns the policy of arn, or the error the
+// call should fail with.
+func (p *Policies) call(ctx context.Context, operation, arn string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls[operation]++
+	return p.policies[arn], p.Err
+}
+
+func (p *Policies) GetQueueAttributes(ctx context.Context, in *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	// https://sqs.us-east-1.amazonaws.com/123456789012/orders
+	u, err := url.Parse(aws.ToString(in.QueueUrl))
+	if err != nil {
+		return nil, APIError("AWS.SimpleQueueService.NonExistentQueue", "The specified queue does not exist.")
+	}
+	region := strings.Split(u.Host, ".")[1]
+	account, name, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	doc, err := p.call(ctx, "GetQueueAttributes", "arn:aws:sqs:"+region+":"+account+":"+name)
+	if err != nil {
+		return nil, err
+	}
+	out := &sqs.GetQueueAttributesOutput{Attributes: map[string]string{}}
+	if doc != "" {
+		out.Attributes["Policy"] = doc
+	}
+	return out, nil
+}
+
+func (p *Policies) GetTopicAttributes(ctx context.Context, in *sns.GetTopicAttributesInput, optFns ...func(*sns.Options)) (*sns.GetTopicAttributesOutput, error) {
+	doc, err := p.call(ctx, "GetTopicAttributes", aws.ToString(in.TopicArn))
+	if err != nil {
+		return nil, err
+	}
+	out := &sns.GetTopicAttributesOutput{Attributes: map[string]string{"TopicArn": aws.ToString(in.TopicArn)}}
+	if doc != "" {
+		out.Attributes["Policy"] = doc
+	}
+	return out, nil
+}
+
+func (p *Policies) ListSubscriptionsByTopic(ctx context.Context, in *sns.ListSubscriptionsByTopicInput, optFns ...func(*sns.Options)) (*sns.ListSubscriptionsByTopicOutput, error) {
+	if _, err := p.call(ctx, "ListSubscriptionsByTopic", aws.ToString(in.TopicArn)); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return &sns.ListSubscriptionsByTopicOutput{Subscriptions: append([]snstypes.Subscription(nil), p.subscriptions[aws.ToString(in.TopicArn)]...)}, nil
+}
+
+func (p *Policies) GetBucketPolicy(ctx context.Context, in *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+	doc, err := p.call(ctx, "GetBucketPolicy", "arn:aws:s3:::"+aws.ToString(in.Bucket))
+	if err != nil {
+		return nil, err
+	}
+	if doc == "" {
+		return nil, APIError("NoSuchBucketPolicy", "The bucket policy does not exist")
+	}
+	return &s3.GetBucketPolicyOutput{Policy: aws.String(doc)}, nil
+}
+
+// XRay fakes X-Ray service graphs. It returns Services for every time range,
+// PageSize at a time, or Err if set.
+type XRay struct {
+	Services []xraytypes.Service
+	// PageSize is the number of services per GetServiceGraph page; values
+	// below 1 return them all at once.
+	PageSize int
+	Err      error
+
+	mu    sync.Mutex
+	calls []xray.GetServiceGraphInput
+}
+
+func (x *XRay) GetServiceGraph(ctx context.Context, in *xray.GetServiceGraphInput, optFns ...func(*xray.Options)) (*xray.GetServiceGraphOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.calls = append(x.calls, *in)
+	if x.Err != nil {
+		return nil, x.Err
+	}
+	start := 0
+	if in.NextToken != nil {
+		n, err := strconv.Atoi(*in.NextToken)
+		if err != nil {
+			return nil, APIError("InvalidRequestException", "invalid token")
+		}
+		start = n
+	}
+	end := len(x.Services)
+	if x.PageSize > 0 {
+		end = min(start+x.PageSize, end)
+	}
+	out := &xray.GetServiceGraphOutput{
+		StartTime: in.StartTime,
+		EndTime:   in.EndTime,
+		Services:  append([]xraytypes.Service(nil), x.Services[start:end]...),
+	}
+	if end < len(x.Services) {
+		out.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+// Calls returns the inputs of every GetServiceGraph call so far.
+func (x *XRay) Calls() []xray.GetServiceGraphInput {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return append([]xray.GetServiceGraphInput(nil), x.calls...)
+}
+
+// CloudTrail fakes CloudTrail event history and CloudTrail Lake. Events are
+// looked up by event name, read-only flag and time; every Lake query
+// finishes at once with Rows, or fails with QueryFailure when it is set. It
+// is safe for concurrent use.
+type CloudTrail struct {
+	Events       []cttypes.Event
+	Rows         [][]map[string]string
+	QueryFailure string
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+
+	mu         sync.Mutex
+	statements []string
+}
+
+func (c *CloudTrail) LookupEvents(ctx context.Context, in *cloudtrail.LookupEventsInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.LookupEventsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	out := &cloudtrail.LookupEventsOutput{}
+	for _, e := range c.Events {
+		match := true
+		for _, a := range in.LookupAttributes {
+			if a.AttributeKey == cttypes.LookupAttributeKeyEventName && aws.ToString(a.AttributeValue) != aws.ToString(e.EventName) {
+				match = false
+			}
+			if a.AttributeKey == cttypes.LookupAttributeKeyReadOnly && aws.ToString(a.AttributeValue) != aws.ToString(e.ReadOnly) {
+				match = false
+			}
+		}
+		if t := aws.ToTime(e.EventTime); (in.StartTime != nil && t.Before(*in.StartTime)) || (in.EndTime != nil && t.After(*in.EndTime)) {
+			match = false
+		}
+		if match {
+			out.Events = append(out.Events, e)
+		}
+	}
+	return out, nil
+}
+
+func (c *CloudTrail) StartQuery(ctx context.Context, in *cloudtrail.StartQueryInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.StartQueryOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements, aws.ToString(in.QueryStatement))
+	return &cloudtrail.StartQueryOutput{QueryId: aws.String(strconv.Itoa(len(c.statements)))}, nil
+}
+
+func (c *CloudTrail) GetQueryResults(ctx context.Context, in *cloudtrail.GetQueryResultsInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.GetQueryResultsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	if c.QueryFailure != "" {
+		return &cloudtrail.GetQueryResultsOutput{QueryStatus: cttypes.QueryStatusFailed, ErrorMessage: aws.String(c.QueryFailure)}, nil
+	}
+	return &cloudtrail.GetQueryResultsOutput{QueryStatus: cttypes.QueryStatusFinished, QueryResultRows: c.Rows}, nil
+}
+
+// Statements returns the statements of every Lake query started so far.
+func (c *CloudTrail) Statements() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.statements...)
+}
+
+// APIError returns an error carrying an AWS error code, as the SDK does.
+func APIError(code, message string) error {
+	return &smithy.GenericAPIError{Code: code, Message: message}
+}
+
+// AccessDenied returns the error AWS returns when the role lacks permission.
+func AccessDenied() error {
+	return APIError("AccessDeniedException", "User is not authorized to perform this action")
+}
+
+// Throttled returns a throttling error.
+func Throttled() error {
+	return APIError("TooManyRequestsException", "Rate exceeded")
+}
+
+// EC2 is an in-memory store of security groups, subnets and network
+// interfaces. It is safe for concurrent use.
+type EC2 struct {
+	// Groups are the security groups in the region.
+	Groups []ec2types.SecurityGroup
+	// Subnets and NetworkInterfaces are the subnets and network interfaces
+	// in the region.
+	Subnets           []ec2types.Subnet
+	NetworkInterfaces []ec2types.NetworkInterface
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+
+	mu    sync.Mutex
+	calls int
+}
+
+// DescribeSecurityGroups returns the groups matching the ip-permission.group-id
+// filter, the only one discovery uses, or all of them.
+func (e *EC2) DescribeSecurityGroups(ctx context.Context, in *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls++
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	referenced := map[string]bool{}
+	for _, f := range in.Filters {
+		if aws.ToString(f.Name) == "ip-permission.group-id" {
+			for _, v := range f.Values {
+				referenced[v] = true
+			}
+		}
+	}
+	out := &ec2.DescribeSecurityGroupsOutput{}
+	for _, g := range e.Groups {
+		if len(referenced) == 0 || referencesAny(g, referenced) {
+			out.SecurityGroups = append(out.SecurityGroups, g)
+		}
+	}
+	return out, nil
+}
+
+// DescribeSubnets returns the subnets matching the subnet-id filter, or all
+// of them.
+func (e *EC2) DescribeSubnets(ctx context.Context, in *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := &ec2.DescribeSubnetsOutput{}
+	for _, s := range e.Subnets {
+		if filterMatches(in.Filters, map[string]string{"subnet-id": aws.ToString(s.SubnetId)}) {
+			out.Subnets = append(out.Subnets, s)
+		}
+	}
+	return out, nil
+}
+
+// DescribeNetworkInterfaces returns the network interfaces matching the
+// interface-type and subnet-id filters, or all of them.
+func (e *EC2) DescribeNetworkInterfaces(ctx context.Context, in *ec2.DescribeNetworkInterfacesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := &ec2.DescribeNetworkInterfacesOutput{}
+	for _, ni := range e.NetworkInterfaces {
+		fields := map[string]string{"interface-type": string(ni.InterfaceType), "subnet-id": aws.ToString(ni.SubnetId)}
+		if filterMatches(in.Filters, fields) {
+			out.NetworkInterfaces = append(out.NetworkInterfaces, ni)
+		}
+	}
+	return out, nil
+}
+
+// filterMatches reports whether fields, by filter name, have one of the
+// values of every filter naming them.
+func filterMatches(filters []ec2types.Filter, fields map[string]string) bool {
+	for _, f := range filters {
+		v, ok := fields[aws.ToString(f.Name)]
+		if ok && !slices.Contains(f.Values, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Calls returns the number of DescribeSecurityGroups calls made.
+func (e *EC2) Calls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+func referencesAny(g ec2types.SecurityGroup, ids map[string]bool) bool {
+	for _, p := range g.IpPermissions {
+		for _, pair := range p.UserIdGroupPairs {
+			if ids[aws.ToString(pair.GroupId)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ELB is an in-memory store of load balancers and target groups. It is
+// safe for concurrent use.
+type ELB struct {
+	LoadBalancers []elbtypes.LoadBalancer
+	TargetGroups  []elbtypes.TargetGroup
+	// Targets are the targets registered in each target group, by ARN.
+	Targets map[string][]elbtypes.TargetHealthDescription
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+}
+
+func (e *ELB) DescribeLoadBalancers(ctx context.Context, in *elb.DescribeLoadBalancersInput, optFns ...func(*elb.Options)) (*elb.DescribeLoadBalancersOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	return &elb.DescribeLoadBalancersOutput{LoadBalancers: e.LoadBalancers}, nil
+}
+
+func (e *ELB) DescribeTargetGroups(ctx context.Context, in *elb.DescribeTargetGroupsInput, optFns ...func(*elb.Options)) (*elb.DescribeTargetGroupsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	return &elb.DescribeTargetGroupsOutput{TargetGroups: e.TargetGroups}, nil
+}
+
+func (e *ELB) DescribeTargetHealth(ctx context.Context, in *elb.DescribeTargetHealthInput, optFns ...func(*elb.Options)) (*elb.DescribeTargetHealthOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	return &elb.DescribeTargetHealthOutput{TargetHealthDescriptions: e.Targets[aws.ToString(in.TargetGroupArn)]}, nil
+}
+
+// CloudWatch is an in-memory store of metric data. Create it with
+// NewCloudWatch; it is safe for concurrent use.
+type CloudWatch struct {
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+
+	mu     sync.Mutex
+	values map[string][]float64
+}
+
+// NewCloudWatch returns a fake without metric data.
+func NewCloudWatch() *CloudWatch {
+	return &CloudWatch{values: map[string][]float64{}}
+}
+
+// AddValues records data points of the metric namespace/name with the
+// dimension dimension=value, e.g.
+// AddValues("AWS/Lambda", "Invocations", "FunctionName", "orders", 12).
+// GetMetricData returns them for every time range.
+func (c *CloudWatch) AddValues(namespace, name, dimension, value string, values ...float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := metricKey(namespace, name, dimension, value)
+	c.values[key] = append(c.values[key], values...)
+}
+
+func metricKey(namespace, name, dimension, value string) string {
+	return namespace + "/" + name + "/" + dimension + "=" + value
+}
+
+func (c *CloudWatch) GetMetricData(ctx context.Context, in *cloudwatch.GetMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := &cloudwatch.GetMetricDataOutput{}
+	for _, q := range in.MetricDataQueries {
+		r := cwtypes.MetricDataResult{Id: q.Id, StatusCode: cwtypes.StatusCodeComplete}
+		if s := q.MetricStat; s != nil && s.Metric != nil && len(s.Metric.Dimensions) == 1 {
+			d := s.Metric.Dimensions[0]
+			r.Values = append([]float64(nil), c.values[metricKey(aws.ToString(s.Metric.Namespace), aws.ToString(s.Metric.MetricName), aws.ToString(d.Name), aws.ToString(d.Value))]...)
+		}
+		out.MetricDataResults = append(out.MetricDataResults, r)
+	}
+	return out, nil
+}
+
+// CostExplorer is an in-memory store of costs, in USD, for every time
+// range. It is safe for concurrent use.
+type CostExplorer struct {
+	// Resources are the costs of resources, by resource ID.
+	Resources map[string]float64
+	// Tags are the costs of tagged resources, by tag key and value.
+	Tags map[string]map[string]float64
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+}
+
+func (c *CostExplorer) GetCostAndUsage(ctx context.Context, in *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	var groups []cetypes.Group
+	for _, g := range in.GroupBy {
+		if g.Type != cetypes.GroupDefinitionTypeTag {
+			continue
+		}
+		key := aws.ToString(g.Key)
+		for value, amount := range c.Tags[key] {
+			groups = append(groups, costGroup(key+"$"+value, amount, in.Metrics))
+		}
+	}
+	return &costexplorer.GetCostAndUsageOutput{ResultsByTime: []cetypes.ResultByTime{{TimePeriod: in.TimePeriod, Groups: groups}}}, nil
+}
+
+func (c *CostExplorer) GetCostAndUsageWithResources(ctx context.Context, in *costexplorer.GetCostAndUsageWithResourcesInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageWithResourcesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	var groups []cetypes.Group
+	for id, amount := range c.Resources {
+		groups = append(groups, costGroup(id, amount, in.Metrics))
+	}
+	return &costexplorer.GetCostAndUsageWithResourcesOutput{ResultsByTime: []cetypes.ResultByTime{{TimePeriod: in.TimePeriod, Groups: groups}}}, nil
+}
+
+func costGroup(key string, amount float64, metrics []string) cetypes.Group {
+	g := cetypes.Group{Keys: []string{key}, Metrics: map[string]cetypes.MetricValue{}}
+	for _, m := range metrics {
+		g.Metrics[m] = cetypes.MetricValue{Amount: aws.String(strconv.FormatFloat(amount, 'f', -1, 64)), Unit: aws.String("USD")}
+	}
+	return g
+}
+
+// ApplicationAutoScaling is an in-memory store of scalable targets and
+// scaling policies. It is safe for concurrent use.
+type ApplicationAutoScaling struct {
+	Targets  []aastypes.ScalableTarget
+	Policies []aastypes.ScalingPolicy
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+}
+
+func (a *ApplicationAutoScaling) DescribeScalableTargets(ctx context.Context, in *applicationautoscaling.DescribeScalableTargetsInput, optFns ...func(*applicationautoscaling.Options)) (*applicationautoscaling.DescribeScalableTargetsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if a.Err != nil {
+		return nil, a.Err
+	}
+	out := &applicationautoscaling.DescribeScalableTargetsOutput{}
+	for _, t := range a.Targets {
+		if t.ServiceNamespace == in.ServiceNamespace && (in.ScalableDimension == "" || t.ScalableDimension == in.ScalableDimension) {
+			out.ScalableTargets = append(out.ScalableTargets, t)
+		}
+	}
+	return out, nil
+}
+
+func (a *ApplicationAutoScaling) DescribeScalingPolicies(ctx context.Context, in *applicationautoscaling.DescribeScalingPoliciesInput, optFns ...func(*applicationautoscaling.Options)) (*applicationautoscaling.DescribeScalingPoliciesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if a.Err != nil {
+		return nil, a.Err
+	}
+	out := &applicationautoscaling.DescribeScalingPoliciesOutput{}
+	for _, p := range a.Policies {
+		if p.ServiceNamespace == in.ServiceNamespace && (in.ScalableDimension == "" || p.ScalableDimension == in.ScalableDimension) {
+			out.ScalingPolicies = append(out.ScalingPolicies, p)
+		}
+	}
+	return out, nil
+}
+
+// ECR is an in-memory store of images. It is safe for concurrent use.
+type ECR struct {
+	Images []ecrtypes.ImageDetail
+	// Manifests are the manifests of images, by image digest.
+	Manifests map[string]string
+	// ConfigURLs are the URLs image configurations are downloaded from, by
+	// configuration digest.
+	ConfigURLs map[string]string
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+}
+
+// image returns the image of repository in registry id identifies.
+func (e *ECR) image(registry, repository *string, id ecrtypes.ImageIdentifier) (ecrtypes.ImageDetail, bool) {
+	for _, img := range e.Images {
+		if aws.ToString(img.RegistryId) != aws.ToString(registry) || aws.ToString(img.RepositoryName) != aws.ToString(repository) {
+			continue
+		}
+		if id.ImageDigest != nil && aws.ToString(img.ImageDigest) == aws.ToString(id.ImageDigest) ||
+			id.ImageTag != nil && slices.Contains(img.ImageTags, aws.ToString(id.ImageTag)) {
+			return img, true
+		}
+	}
+	return ecrtypes.ImageDetail{}, false
+}
+
+func (e *ECR) DescribeImages(ctx context.Context, in *ecr.DescribeImagesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeImagesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	out := &ecr.DescribeImagesOutput{}
+	for _, id := range in.ImageIds {
+		img, ok := e.image(in.RegistryId, in.RepositoryName, id)
+		if !ok {
+			return nil, APIError("ImageNotFoundException", "The image requested does not exist in the specified repository.")
+		}
+		out.ImageDetails = append(out.ImageDetails, img)
+	}
+	return out, nil
+}
+
+func (e *ECR) BatchGetImage(ctx context.Context, in *ecr.BatchGetImageInput, optFns ...func(*ecr.Options)) (*ecr.BatchGetImageOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	out := &ecr.BatchGetImageOutput{}
+	for _, id := range in.ImageIds {
+		img, ok := e.image(in.RegistryId, in.RepositoryName, id)
+		manifest, found := e.Manifests[aws.ToString(img.ImageDigest)]
+		if !ok || !found {
+			out.Failures = append(out.Failures, ecrtypes.ImageFailure{ImageId: &id, FailureCode: ecrtypes.ImageFailureCodeImageNotFound})
+			continue
+		}
+		out.Images = append(out.Images, ecrtypes.Image{ImageId: &id, ImageManifest: aws.String(manifest), RegistryId: in.RegistryId, RepositoryName: in.RepositoryName})
+	}
+	return out, nil
+}
+
+func (e *ECR) GetDownloadUrlForLayer(ctx context.Context, in *ecr.GetDownloadUrlForLayerInput, optFns ...func(*ecr.Options)) (*ecr.GetDownloadUrlForLayerOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	url, ok := e.ConfigURLs[aws.ToString(in.LayerDigest)]
+	if !ok {
+		return nil, APIError("LayersNotFoundException", "The specified layers could not be found.")
+	}
+	return &ecr.GetDownloadUrlForLayerOutput{DownloadUrl: aws.String(url), LayerDigest: in.LayerDigest}, nil
+}
+
+// CloudFormation is an in-memory store of stacks, their processed templates
+// and resources, and the stack sets the account administers. It is safe for
+// concurrent use.
+type CloudFormation struct {
+	Stacks []cfntypes.Stack
+	// Templates are the template bodies of stacks, by stack ID.
+	Templates map[string]string
+	// Resources are the resources of stacks, by stack ID.
+	Resources map[string][]cfntypes.StackResourceSummary
+	// StackSets are listed for callers acting as SELF, and
+	// DelegatedStackSets for those acting as DELEGATED_ADMIN.
+	StackSets          []cfntypes.StackSetSummary
+	DelegatedStackSets []cfntypes.StackSetSummary
+	// Instances are the stack instances of stack sets, by stack set name.
+	Instances map[string][]cfntypes.StackInstanceSummary
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+}
+
+// stack returns the stack named or with the ID name.
+func (c *CloudFormation) stack(name string) (cfntypes.Stack, error) {
+	for _, s := range c.Stacks {
+		if aws.ToString(s.StackName) == name || aws.ToString(s.StackId) == name {
+			return s, nil
+		}
+	}
+	return cfntypes.Stack{}, APIError("ValidationError", "Stack with id "+name+" does not exist")
+}
+
+func (c *CloudFormation) DescribeStacks(ctx context.Context, in *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	if in.StackName == nil {
+		return &cloudformation.DescribeStacksOutput{Stacks: c.Stacks}, nil
+	}
+	s, err := c.stack(aws.ToString(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+	return &cloudformation.DescribeStacksOutput{Stacks: []cfntypes.Stack{s}}, nil
+}
+
+func (c *CloudFormation) GetTemplate(ctx context.Context, in *cloudformation.GetTemplateInput, optFns ...func(*cloudformation.Options)) (*cloudformation.GetTemplateOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	s, err := c.stack(aws.ToString(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+	return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(c.Templates[aws.ToString(s.StackId)])}, nil
+}
+
+func (c *CloudFormation) ListStackResources(ctx context.Context, in *cloudformation.ListStackResourcesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackResourcesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	s, err := c.stack(aws.ToString(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+	return &cloudformation.ListStackResourcesOutput{StackResourceSummaries: c.Resources[aws.ToString(s.StackId)]}, nil
+}
+
+func (c *CloudFormation) ListStackSets(ctx context.Context, in *cloudformation.ListStackSetsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackSetsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	if in.CallAs == cfntypes.CallAsDelegatedAdmin {
+		if c.DelegatedStackSets == nil {
+			return nil, APIError("ValidationError", "Account used is not a delegated administrator")
+		}
+		return &cloudformation.ListStackSetsOutput{Summaries: c.DelegatedStackSets}, nil
+	}
+	return &cloudformation.ListStackSetsOutput{Summaries: c.StackSets}, nil
+}
+
+func (c *CloudFormation) ListStackInstances(ctx context.Context, in *cloudformation.ListStackInstancesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackInstancesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	name := aws.ToString(in.StackSetName)
+	instances, ok := c.Instances[name]
+	if !ok {
+		return nil, APIError("StackSetNotFoundException", "StackSet "+name+" not found")
+	}
+	return &cloudformation.ListStackInstancesOutput{Summaries: instances}, nil
+}
+
+// Route53 is an in-memory store of hosted zones and their records. It is
+// safe for concurrent use.
+type Route53 struct {
+	Zones []route53types.HostedZone
+	// Records are the record sets of each zone, by zone ID.
+	Records map[string][]route53types.ResourceRecordSet
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+}
+
+func (r *Route53) ListHostedZones(ctx context.Context, in *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return &route53.ListHostedZonesOutput{HostedZones: r.Zones}, nil
+}
+
+func (r *Route53) ListResourceRecordSets(ctx context.Context, in *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return &route53.ListResourceRecordSetsOutput{ResourceRecordSets: r.Records[aws.ToString(in.HostedZoneId)]}, nil
+}
+
+// CloudFront is an in-memory store of distributions. It is safe for
+// concurrent use.
+type CloudFront struct {
+	Distributions []cftypes.DistributionSummary
+	// Err, if set, is returned by every call, e.g. AccessDenied().
+	Err error
+}
+
+func (c *CloudFront) ListDistributions(ctx context.Context, in *cloudfront.ListDistributionsInput, optFns ...func(*cloudfront.Options)) (*cloudfront.ListDistributionsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	return &cloudfront.ListDistributionsOutput{DistributionList: &cftypes.DistributionList{
+		Items:       c.Distributions,
+		IsTruncated: aws.Bool(false),
+	}}, nil
+}
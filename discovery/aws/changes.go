@@ -0,0 +1,145 @@
+package awscmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cttypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+)
+
+// IAMEventRegion is the region CloudTrail event history logs changes to
+// global resources, such as IAM roles, in.
+const IAMEventRegion = "us-east-1"
+
+// Change is a successful write API call CloudTrail logged to a resource,
+// such as a function's configuration being updated.
+type Change struct {
+	// Resource is the ARN of the resource changed.
+	Resource string    `json:"resource"`
+	Time     time.Time `json:"time"`
+	// Source and Event are the eventSource and eventName CloudTrail logs,
+	// e.g. lambda.amazonaws.com and UpdateFunctionConfiguration20150331v2.
+	Source string `json:"source"`
+	Event  string `json:"event"`
+	// Actor is the ARN of the identity that made the call.
+	Actor   string `json:"actor,omitempty"`
+	EventID string `json:"eventId"`
+}
+
+// changeParams are the request parameters naming the resource a write call
+// changes, for calls whose logged resources do not.
+var changeParams = []string{
+	"functionName", "stateMachineArn", "queueUrl", "topicArn", "tableName",
+	"roleName", "bucketName", "eventBusName", "restApiId", "apiId", "name",
+}
+
+// Changes returns the changes CloudTrail event history has for region
+// between start and end to the resources with ARNs resources, newest first.
+// Event history only has management events, which include every
+// configuration change. Changes to IAM resources are logged in
+// IAMEventRegion.
+func (p *Provider) Changes(ctx context.Context, region string, start, end time.Time, resources []string) ([]Change, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return lookupChanges(ctx, clients.cloudtrail, start, end, resources)
+}
+
+func lookupChanges(ctx context.Context, client CloudTrailAPI, start, end time.Time, resources []string) ([]Change, error) {
+	// Resources are named in events by ARN or, often, by name alone; a
+	// name stands for a resource only when no other of its service has it.
+	byARN := map[string]bool{}
+	byName := map[[2]string][]string{}
+	for _, arn := range resources {
+		byARN[arn] = true
+		k := [2]string{serviceOf(arn), shortName(arn)}
+		byName[k] = append(byName[k], arn)
+	}
+	resolve := func(source, ref string) (string, bool) {
+		if byARN[ref] {
+			return ref, true
+		}
+		service := strings.TrimSuffix(source, ".amazonaws.com")
+		if strings.HasPrefix(ref, "arn:") {
+			service = serviceOf(ref)
+		}
+		// A name, a qualified function ARN or a queue URL.
+		if arns := byName[[2]string{service, shortName(ref)}]; len(arns) == 1 {
+			return arns[0], true
+		}
+		return "", false
+	}
+
+	p := cloudtrail.NewLookupEventsPaginator(client, &cloudtrail.LookupEventsInput{
+		LookupAttributes: []cttypes.LookupAttribute{{AttributeKey: cttypes.LookupAttributeKeyReadOnly, AttributeValue: aws.String("false")}},
+		StartTime:        aws.Time(start),
+		EndTime:          aws.Time(end),
+	})
+	var changes []Change
+	for e, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedEvents) {
+		if err != nil {
+			return nil, fmt.Errorf("looking up write events: %w", err)
+		}
+		var r trailRecord
+		if err := json.Unmarshal([]byte(aws.ToString(e.CloudTrailEvent)), &r); err != nil {
+			return nil, fmt.Errorf("parsing event %s: %w", aws.ToString(e.EventId), err)
+		}
+		if r.ErrorCode != "" {
+			continue
+		}
+		var refs []string
+		for _, res := range e.Resources {
+			refs = append(refs, aws.ToString(res.ResourceName))
+		}
+		for _, k := range changeParams {
+			if s, ok := r.RequestParameters[k].(string); ok {
+				refs = append(refs, s)
+			}
+		}
+		changed := map[string]bool{}
+		for _, ref := range refs {
+			arn, ok := resolve(r.EventSource, ref)
+			if !ok || changed[arn] {
+				continue
+			}
+			changed[arn] = true
+			changes = append(changes, Change{
+				Resource: arn,
+				Time:     aws.ToTime(e.EventTime),
+				Source:   r.EventSource,
+				Event:    aws.ToString(e.EventName),
+				Actor:    r.UserIdentity.ARN,
+				EventID:  aws.ToString(e.EventId),
+			})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Time.After(changes[j].Time) })
+	return changes, nil
+}
+
+// serviceOf returns the service of an ARN, e.g. lambda.
+func serviceOf(arn string) string {
+	if parts := strings.SplitN(arn, ":", 4); len(parts) == 4 {
+		return parts[2]
+	}
+	return ""
+}
+
+// shortName returns the name at the end of an ARN, URL or path, e.g.
+// orders for arn:aws:lambda:us-east-1:123456789012:function:orders:live,
+// https://sqs.us-east-1.amazonaws.com/123456789012/orders or
+// arn:aws:iam::123456789012:role/service/orders.
+func shortName(ref string) string {
+	if parts := strings.SplitN(ref, ":", 8); len(parts) == 8 && parts[0] == "arn" && parts[2] == "lambda" {
+		// A function ARN with a version or alias.
+		return parts[6]
+	}
+	return ref[strings.LastIndexAny(ref, ":/")+1:]
+}
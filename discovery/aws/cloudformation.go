@@ -0,0 +1,77 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfntypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+
+	"github.com/jamesneb/causal/discovery/cfn"
+)
+
+// Stack returns the CloudFormation stack name, a name or ARN, in region,
+// with its processed template, parameter values and the physical IDs of its
+// resources.
+func (p *Provider) Stack(ctx context.Context, region, name string) (*cfn.Stack, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	client := clients.cloudformation
+
+	reqCtx, cancel := requestContext(ctx)
+	out, err := client.DescribeStacks(reqCtx, &cloudformation.DescribeStacksInput{StackName: aws.String(name)})
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("describing stack %s: %w", name, err)
+	}
+	if len(out.Stacks) == 0 {
+		return nil, fmt.Errorf("no stack %s in %s", name, region)
+	}
+	desc := out.Stacks[0]
+	stack := &cfn.Stack{
+		ID:         aws.ToString(desc.StackId),
+		Name:       aws.ToString(desc.StackName),
+		Region:     region,
+		AccountID:  AccountFromARN(aws.ToString(desc.StackId)),
+		Parameters: map[string]string{},
+		Resources:  map[string]string{},
+	}
+	for _, param := range desc.Parameters {
+		// Parameters read from Systems Manager have the name of the
+		// parameter as their value and what it held as the resolved one.
+		value := aws.ToString(param.ParameterValue)
+		if param.ResolvedValue != nil {
+			value = aws.ToString(param.ResolvedValue)
+		}
+		stack.Parameters[aws.ToString(param.ParameterKey)] = value
+	}
+
+	// The processed template has any transforms, such as SAM's, expanded
+	// into the resources they create.
+	reqCtx, cancel = requestContext(ctx)
+	tmpl, err := client.GetTemplate(reqCtx, &cloudformation.GetTemplateInput{
+		StackName:     desc.StackId,
+		TemplateStage: cfntypes.TemplateStageProcessed,
+	})
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("getting the template of stack %s: %w", name, err)
+	}
+	stack.Template = aws.ToString(tmpl.TemplateBody)
+
+	pages := cloudformation.NewListStackResourcesPaginator(client, &cloudformation.ListStackResourcesInput{StackName: desc.StackId})
+	for r, err := range paginate(ctx, pages.HasMorePages, pages.NextPage, listedStackResources) {
+		if err != nil {
+			return nil, fmt.Errorf("listing the resources of stack %s: %w", name, err)
+		}
+		stack.Resources[aws.ToString(r.LogicalResourceId)] = aws.ToString(r.PhysicalResourceId)
+	}
+	return stack, nil
+}
+
+func listedStackResources(page *cloudformation.ListStackResourcesOutput) []cfntypes.StackResourceSummary {
+	return page.StackResourceSummaries
+}
@@ -0,0 +1,375 @@
+package awscmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cttypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// queryPollInterval is how long to wait between checks on a running
+// CloudTrail Lake query.
+var queryPollInterval = 2 * time.Second
+
+// auditedCall is an API call that invokes another resource, as CloudTrail
+// logs it.
+type auditedCall struct {
+	// source and name are the eventSource and eventName CloudTrail logs,
+	// e.g. lambda.amazonaws.com and Invoke.
+	source, name string
+	// param is the request parameter naming the resource called.
+	param string
+	// management is set for management events, the only ones event
+	// history has; the others are data events, logged only by trails
+	// configured to.
+	management bool
+}
+
+var auditedCalls = []auditedCall{
+	{"lambda.amazonaws.com", "Invoke", "functionName", false},
+	{"sqs.amazonaws.com", "SendMessage", "queueUrl", false},
+	{"sqs.amazonaws.com", "SendMessageBatch", "queueUrl", false},
+	{"sns.amazonaws.com", "Publish", "topicArn", false},
+	{"sns.amazonaws.com", "PublishBatch", "topicArn", false},
+	{"states.amazonaws.com", "StartExecution", "stateMachineArn", true},
+	{"states.amazonaws.com", "StartSyncExecution", "stateMachineArn", false},
+	{"dynamodb.amazonaws.com", "GetItem", "tableName", false},
+	{"dynamodb.amazonaws.com", "PutItem", "tableName", false},
+	{"dynamodb.amazonaws.com", "UpdateItem", "tableName", false},
+	{"dynamodb.amazonaws.com", "DeleteItem", "tableName", false},
+	{"dynamodb.amazonaws.com", "Query", "tableName", false},
+	{"dynamodb.amazonaws.com", "Scan", "tableName", false},
+}
+
+// loggedCalls are calls CloudTrail logged between the same caller and
+// resource.
+type loggedCalls struct {
+	source, name    string
+	region, account string
+	// caller is the ARN of the identity making the calls, e.g.
+	// arn:aws:sts::123456789012:assumed-role/orders-role/orders.
+	caller string
+	params map[string]string
+	count  int64
+}
+
+// AuditedRelationships returns the calls between resources that CloudTrail
+// event history has for region between start and end, as audited
+// relationships from caller to callee with the number of calls. Event
+// history only has management events, which of the calls inferred from
+// means only starting state machine executions; LakeRelationships reads the
+// others too.
+func (p *Provider) AuditedRelationships(ctx context.Context, region string, start, end time.Time, services []discovery.Service) ([]discovery.Relationship, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	var calls []loggedCalls
+	for _, c := range auditedCalls {
+		if !c.management {
+			continue
+		}
+		logged, err := lookupCalls(ctx, clients.cloudtrail, c, start, end)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, logged...)
+	}
+	return auditedRelationships(calls, services), nil
+}
+
+// LakeRelationships is AuditedRelationships reading the calls, data events
+// included, from the CloudTrail Lake event data store with ID or ARN store
+// in region.
+func (p *Provider) LakeRelationships(ctx context.Context, region, store string, start, end time.Time, services []discovery.Service) ([]discovery.Relationship, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	calls, err := queryCalls(ctx, clients.cloudtrail, store, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return auditedRelationships(calls, services), nil
+}
+
+// trailRecord is a CloudTrail event record, as far as inference reads one.
+type trailRecord struct {
+	EventSource        string `json:"eventSource"`
+	EventName          string `json:"eventName"`
+	AWSRegion          string `json:"awsRegion"`
+	RecipientAccountID string `json:"recipientAccountId"`
+	ErrorCode          string `json:"errorCode"`
+	UserIdentity       struct {
+		ARN string `json:"arn"`
+	} `json:"userIdentity"`
+	RequestParameters map[string]any `json:"requestParameters"`
+}
+
+// lookupCalls returns the successful calls of c in event history between
+// start and end.
+func lookupCalls(ctx context.Context, client CloudTrailAPI, c auditedCall, start, end time.Time) ([]loggedCalls, error) {
+	p := cloudtrail.NewLookupEventsPaginator(client, &cloudtrail.LookupEventsInput{
+		LookupAttributes: []cttypes.LookupAttribute{{AttributeKey: cttypes.LookupAttributeKeyEventName, AttributeValue: aws.String(c.name)}},
+		StartTime:        aws.Time(start),
+		EndTime:          aws.Time(end),
+	})
+	var calls []loggedCalls
+	for e, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedEvents) {
+		if err != nil {
+			return nil, fmt.Errorf("looking up %s events: %w", c.name, err)
+		}
+		var r trailRecord
+		if err := json.Unmarshal([]byte(aws.ToString(e.CloudTrailEvent)), &r); err != nil {
+			return nil, fmt.Errorf("parsing event %s: %w", aws.ToString(e.EventId), err)
+		}
+		if r.EventSource != c.source || r.ErrorCode != "" {
+			continue
+		}
+		params := map[string]string{}
+		for k, v := range r.RequestParameters {
+			if s, ok := v.(string); ok {
+				params[k] = s
+			}
+		}
+		calls = append(calls, loggedCalls{
+			source:  r.EventSource,
+			name:    r.EventName,
+			region:  r.AWSRegion,
+			account: r.RecipientAccountID,
+			caller:  r.UserIdentity.ARN,
+			params:  params,
+			count:   1,
+		})
+	}
+	return calls, nil
+}
+
+func listedEvents(page *cloudtrail.LookupEventsOutput) []cttypes.Event {
+	return page.Events
+}
+
+// eventDataStoreID matches the IDs of event data stores, the last part of
+// their ARNs.
+var eventDataStoreID = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// queryCalls returns the successful audited calls logged in the event data
+// store between start and end, counted by caller and resource.
+func queryCalls(ctx context.Context, client CloudTrailAPI, store string, start, end time.Time) ([]loggedCalls, error) {
+	id := store[strings.LastIndex(store, "/")+1:]
+	if !eventDataStoreID.MatchString(id) {
+		return nil, fmt.Errorf("invalid event data store %q", store)
+	}
+	params := map[string]bool{}
+	var names []string
+	for _, c := range auditedCalls {
+		params[c.param] = true
+		names = append(names, "'"+c.name+"'")
+	}
+	columns := []string{"eventSource", "eventName", "awsRegion", "recipientAccountId", "userIdentity.arn"}
+	selected := []string{"eventSource", "eventName", "awsRegion", "recipientAccountId", "userIdentity.arn AS caller"}
+	for _, p := range sortedKeys(params) {
+		param := "element_at(requestParameters, '" + p + "')"
+		columns = append(columns, param)
+		selected = append(selected, param+" AS "+p)
+	}
+	const layout = "2006-01-02 15:04:05"
+	statement := "SELECT " + strings.Join(selected, ", ") + ", COUNT(*) AS calls FROM " + id +
+		" WHERE eventTime >= '" + start.UTC().Format(layout) + "' AND eventTime < '" + end.UTC().Format(layout) + "'" +
+		" AND errorCode IS NULL AND eventName IN (" + strings.Join(names, ", ") + ")" +
+		" GROUP BY " + strings.Join(columns, ", ")
+
+	callCtx, cancel := requestContext(ctx)
+	started, err := client.StartQuery(callCtx, &cloudtrail.StartQueryInput{QueryStatement: aws.String(statement)})
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("starting CloudTrail Lake query: %w", err)
+	}
+
+	var calls []loggedCalls
+	var token *string
+	for {
+		callCtx, cancel := requestContext(ctx)
+		out, err := client.GetQueryResults(callCtx, &cloudtrail.GetQueryResultsInput{QueryId: started.QueryId, NextToken: token})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("getting CloudTrail Lake query results: %w", err)
+		}
+		switch out.QueryStatus {
+		case cttypes.QueryStatusQueued, cttypes.QueryStatusRunning:
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(queryPollInterval):
+			}
+			continue
+		case cttypes.QueryStatusFinished:
+		default:
+			return nil, fmt.Errorf("CloudTrail Lake query %s: %s", strings.ToLower(string(out.QueryStatus)), aws.ToString(out.ErrorMessage))
+		}
+		for _, row := range out.QueryResultRows {
+			// Each column of a row is a map of its name to its value.
+			values := map[string]string{}
+			for _, column := range row {
+				for k, v := range column {
+					values[k] = v
+				}
+			}
+			count, _ := strconv.ParseInt(values["calls"], 10, 64)
+			calls = append(calls, loggedCalls{
+				source:  values["eventSource"],
+				name:    values["eventName"],
+				region:  values["awsRegion"],
+				account: values["recipientAccountId"],
+				caller:  values["caller"],
+				params:  values,
+				count:   count,
+			})
+		}
+		if out.NextToken == nil {
+			return calls, nil
+		}
+		token = out.NextToken
+	}
+}
+
+// auditedRelationships turns calls into audited relationships between
+// services and the resources they called, adding up calls between the same
+// two. Callers are roles, which stand for the service they are the role of
+// when it is the only one with the role or is named by the session, as
+// Lambda names its sessions after the function. Other callers, such as IAM
+// users and AWS services, are left out.
+func auditedRelationships(calls []loggedCalls, services []discovery.Service) []discovery.Relationship {
+	byRole := map[string][]discovery.Service{}
+	for _, s := range services {
+		if role := roleOf(s); role != "" {
+			name := role[strings.LastIndex(role, "/")+1:]
+			byRole[AccountFromARN(role)+"/"+name] = append(byRole[AccountFromARN(role)+"/"+name], s)
+		}
+	}
+	param := map[[2]string]string{}
+	for _, c := range auditedCalls {
+		param[[2]string{c.source, c.name}] = c.param
+	}
+
+	type pair struct{ from, to string }
+	byPair := map[pair]*discovery.Relationship{}
+	actions := map[pair]map[string]bool{}
+	for _, c := range calls {
+		p, ok := param[[2]string{c.source, c.name}]
+		if !ok {
+			continue
+		}
+		target, targetType, ok := auditedTarget(c.source, c.params[p], c.region, c.account)
+		if !ok {
+			continue
+		}
+		from, fromType, ok := auditedCaller(c.caller, byRole)
+		if !ok || from == target {
+			continue
+		}
+		k := pair{from, target}
+		r, ok := byPair[k]
+		if !ok {
+			r = &discovery.Relationship{
+				From:       from,
+				FromType:   fromType,
+				Relation:   discovery.RelationAudited,
+				Target:     target,
+				TargetType: targetType,
+			}
+			byPair[k] = r
+			actions[k] = map[string]bool{}
+		}
+		r.Calls += c.count
+		actions[k][strings.TrimSuffix(c.source, ".amazonaws.com")+":"+c.name] = true
+	}
+
+	rels := make([]discovery.Relationship, 0, len(byPair))
+	for k, r := range byPair {
+		r.Actions = sortedKeys(actions[k])
+		rels = append(rels, *r)
+	}
+	sort.Slice(rels, func(i, j int) bool {
+		if rels[i].From != rels[j].From {
+			return rels[i].From < rels[j].From
+		}
+		return rels[i].Target < rels[j].Target
+	})
+	return rels
+}
+
+// roleOf returns the role s runs as, if it has one.
+func roleOf(s discovery.Service) string {
+	if l := s.Details.Lambda; l != nil {
+		return l.Role
+	}
+	if sm := s.Details.StateMachine; sm != nil {
+		return sm.Role
+	}
+	return ""
+}
+
+// auditedCaller returns the resource an identity logged by CloudTrail
+// stands for.
+func auditedCaller(identity string, byRole map[string][]discovery.Service) (string, discovery.ResourceType, bool) {
+	// arn:aws:sts::123456789012:assumed-role/orders-role/orders
+	parts := strings.SplitN(identity, ":", 6)
+	if len(parts) < 6 || parts[2] != "sts" {
+		return "", "", false
+	}
+	path, ok := strings.CutPrefix(parts[5], "assumed-role/")
+	if !ok {
+		return "", "", false
+	}
+	role, session, _ := strings.Cut(path, "/")
+	candidates := byRole[parts[4]+"/"+role]
+	for _, s := range candidates {
+		if s.Name == session {
+			return s.Key(), s.ResourceType, true
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0].Key(), candidates[0].ResourceType, true
+	}
+	// The role of several services, or of none discovered. Its path is not
+	// logged, so it is taken from a service with it when there is one.
+	if len(candidates) > 0 {
+		return roleOf(candidates[0]), discovery.ResourceTypeIAMRole, true
+	}
+	return "arn:" + parts[1] + ":iam::" + parts[4] + ":role/" + role, discovery.ResourceTypeIAMRole, true
+}
+
+// auditedTarget returns the resource a call named by value, the request
+// parameter naming it, in account and region.
+func auditedTarget(source, value, region, account string) (string, discovery.ResourceType, bool) {
+	if value == "" {
+		return "", "", false
+	}
+	arn := value
+	if !strings.HasPrefix(value, "arn:") {
+		switch source {
+		case "lambda.amazonaws.com":
+			// A function name or partial ARN, 123456789012:function:orders.
+			if i := strings.Index(value, "function:"); i >= 0 {
+				value = value[i+len("function:"):]
+			}
+			arn = "arn:aws:lambda:" + region + ":" + account + ":function:" + value
+		case "sqs.amazonaws.com":
+			arn = queueARN(value, "aws")
+		case "dynamodb.amazonaws.com":
+			arn = "arn:aws:dynamodb:" + region + ":" + account + ":table/" + value
+		}
+	}
+	return resourceOf(arn)
+}
@@ -0,0 +1,167 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	cetypes "github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+// CostExplorerRegion is the region Cost Explorer is served from.
+const CostExplorerRegion = "us-east-1"
+
+// resourceCostDays is how many days of resource-level costs Cost Explorer
+// keeps; they are scaled to a month.
+const resourceCostDays = 14
+
+// tagCostDays is how many days tag costs are summed over for a month.
+const tagCostDays = 30
+
+// costMetric is the cost read, as billed before discounts and credits.
+const costMetric = "UnblendedCost"
+
+// costServices are the Cost Explorer names of the services whose resources
+// are discovered; resource-level costs must be filtered by service.
+var costServices = []string{"AWS Lambda", "AWS Step Functions", "Amazon API Gateway", "CloudWatch Events"}
+
+// Costs are estimated monthly costs.
+type Costs struct {
+	// Amounts are the costs by resource ARN or by tag value.
+	Amounts map[string]float64
+	// Currency is the unit of the amounts, e.g. USD.
+	Currency string
+}
+
+// ResourceCosts returns the monthly costs of resources of the account, by
+// ARN, estimated from the last 14 days before now. Cost Explorer only has
+// them once resource-level data is enabled in its settings; the costs of a
+// function's versions and aliases are the function's, and those of an API's
+// stages the API's.
+func (p *Provider) ResourceCosts(ctx context.Context, now time.Time) (Costs, error) {
+	clients, err := p.clients(ctx, CostExplorerRegion)
+	if err != nil {
+		return Costs{}, err
+	}
+	end := now.UTC().Truncate(24 * time.Hour)
+	in := &costexplorer.GetCostAndUsageWithResourcesInput{
+		TimePeriod:  costPeriod(end.AddDate(0, 0, -resourceCostDays), end),
+		Granularity: cetypes.GranularityDaily,
+		Metrics:     []string{costMetric},
+		Filter:      &cetypes.Expression{Dimensions: &cetypes.DimensionValues{Key: cetypes.DimensionService, Values: costServices}},
+		GroupBy:     []cetypes.GroupDefinition{{Type: cetypes.GroupDefinitionTypeDimension, Key: aws.String(string(cetypes.DimensionResourceId))}},
+	}
+	page := func(ctx context.Context, token *string) (*costexplorer.GetCostAndUsageWithResourcesOutput, error) {
+		in.NextPageToken = token
+		return clients.costexplorer.GetCostAndUsageWithResources(ctx, in)
+	}
+	costs := Costs{Amounts: map[string]float64{}}
+	for r, err := range tokenPages(ctx, page, listedResourceCosts, nextResourceCosts) {
+		if err != nil {
+			return Costs{}, fmt.Errorf("getting costs by resource: %w", err)
+		}
+		if err := costs.add(r, costResource); err != nil {
+			return Costs{}, err
+		}
+	}
+	costs.scale(float64(30) / resourceCostDays)
+	return costs, nil
+}
+
+// TagCosts returns the monthly costs of the account by the value of the cost
+// allocation tag key, summed over the last 30 days before now. Resources
+// without the tag are left out.
+func (p *Provider) TagCosts(ctx context.Context, key string, now time.Time) (Costs, error) {
+	clients, err := p.clients(ctx, CostExplorerRegion)
+	if err != nil {
+		return Costs{}, err
+	}
+	end := now.UTC().Truncate(24 * time.Hour)
+	in := &costexplorer.GetCostAndUsageInput{
+		TimePeriod:  costPeriod(end.AddDate(0, 0, -tagCostDays), end),
+		Granularity: cetypes.GranularityDaily,
+		Metrics:     []string{costMetric},
+		GroupBy:     []cetypes.GroupDefinition{{Type: cetypes.GroupDefinitionTypeTag, Key: aws.String(key)}},
+	}
+	page := func(ctx context.Context, token *string) (*costexplorer.GetCostAndUsageOutput, error) {
+		in.NextPageToken = token
+		return clients.costexplorer.GetCostAndUsage(ctx, in)
+	}
+	costs := Costs{Amounts: map[string]float64{}}
+	for r, err := range tokenPages(ctx, page, listedTagCosts, nextTagCosts) {
+		if err != nil {
+			return Costs{}, fmt.Errorf("getting costs by tag %s: %w", key, err)
+		}
+		// Groups are keyed "<key>$<value>", with an empty value for
+		// resources without the tag.
+		if err := costs.add(r, func(k string) string { return k[strings.IndexByte(k, '$')+1:] }); err != nil {
+			return Costs{}, err
+		}
+	}
+	return costs, nil
+}
+
+// add adds the cost of each group of r under the name its key maps to,
+// unless that is empty.
+func (c *Costs) add(r cetypes.ResultByTime, name func(key string) string) error {
+	for _, g := range r.Groups {
+		if len(g.Keys) == 0 {
+			continue
+		}
+		k := name(g.Keys[0])
+		m, ok := g.Metrics[costMetric]
+		if k == "" || !ok {
+			continue
+		}
+		amount, err := strconv.ParseFloat(aws.ToString(m.Amount), 64)
+		if err != nil {
+			return fmt.Errorf("parsing cost of %s: %w", g.Keys[0], err)
+		}
+		c.Amounts[k] += amount
+		if c.Currency == "" {
+			c.Currency = aws.ToString(m.Unit)
+		}
+	}
+	return nil
+}
+
+func (c *Costs) scale(f float64) {
+	for k := range c.Amounts {
+		c.Amounts[k] *= f
+	}
+}
+
+func costPeriod(start, end time.Time) *cetypes.DateInterval {
+	// End is exclusive.
+	return &cetypes.DateInterval{Start: aws.String(start.Format(time.DateOnly)), End: aws.String(end.Format(time.DateOnly))}
+}
+
+// costResource returns the ARN of the discovered resource whose cost id
+// is: id without a function version or alias or an API stage.
+func costResource(id string) string {
+	if parts := strings.SplitN(id, ":", 8); len(parts) == 8 && parts[0] == "arn" && parts[2] == "lambda" {
+		return strings.Join(parts[:7], ":")
+	}
+	if api, _, ok := strings.Cut(id, "/stages/"); ok && serviceOf(id) == "apigateway" {
+		return api
+	}
+	return id
+}
+
+func listedResourceCosts(page *costexplorer.GetCostAndUsageWithResourcesOutput) []cetypes.ResultByTime {
+	return page.ResultsByTime
+}
+
+func nextResourceCosts(page *costexplorer.GetCostAndUsageWithResourcesOutput) *string {
+	return page.NextPageToken
+}
+
+func listedTagCosts(page *costexplorer.GetCostAndUsageOutput) []cetypes.ResultByTime {
+	return page.ResultsByTime
+}
+
+func nextTagCosts(page *costexplorer.GetCostAndUsageOutput) *string { return page.NextPageToken }
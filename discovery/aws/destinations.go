@@ -0,0 +1,71 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// eventInvokeConfigs returns how the versions and aliases of the function
+// name handle asynchronous invocations, sorted by qualifier.
+func eventInvokeConfigs(ctx context.Context, client LambdaAPI, name string) ([]discovery.EventInvokeConfig, error) {
+	var configs []discovery.EventInvokeConfig
+	p := lambda.NewListFunctionEventInvokeConfigsPaginator(client, &lambda.ListFunctionEventInvokeConfigsInput{FunctionName: aws.String(name)})
+	for c, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedEventInvokeConfigs) {
+		if err != nil {
+			return nil, fmt.Errorf("listing event invoke configs of %s: %w", name, err)
+		}
+		arn := aws.ToString(c.FunctionArn)
+		config := discovery.EventInvokeConfig{
+			Qualifier:            arn[strings.LastIndex(arn, ":")+1:],
+			MaximumRetryAttempts: c.MaximumRetryAttempts,
+			MaximumEventAge:      c.MaximumEventAgeInSeconds,
+		}
+		if d := c.DestinationConfig; d != nil {
+			if d.OnSuccess != nil {
+				config.OnSuccess = aws.ToString(d.OnSuccess.Destination)
+			}
+			if d.OnFailure != nil {
+				config.OnFailure = aws.ToString(d.OnFailure.Destination)
+			}
+		}
+		configs = append(configs, config)
+	}
+	slices.SortFunc(configs, func(a, b discovery.EventInvokeConfig) int { return strings.Compare(a.Qualifier, b.Qualifier) })
+	return configs, nil
+}
+
+func listedEventInvokeConfigs(page *lambda.ListFunctionEventInvokeConfigsOutput) []lambdatypes.FunctionEventInvokeConfig {
+	return page.FunctionEventInvokeConfigs
+}
+
+// failureRoutingRelationships returns the relationships of a function with
+// details l to its dead-letter target and to the destinations of its
+// versions and aliases, one per destination and condition.
+func failureRoutingRelationships(l *discovery.LambdaDetails) []discovery.Relationship {
+	var rels []discovery.Relationship
+	if arn, typ, ok := resourceOf(l.DeadLetterTarget); ok {
+		rels = append(rels, discovery.Relationship{Relation: discovery.RelationDeadLetter, Target: arn, TargetType: typ})
+	}
+	seen := map[string]bool{}
+	add := func(destination, condition string) {
+		arn, typ, ok := resourceOf(destination)
+		if !ok || seen[condition+" "+arn] {
+			return
+		}
+		seen[condition+" "+arn] = true
+		rels = append(rels, discovery.Relationship{Relation: discovery.RelationDestination, Target: arn, TargetType: typ, Via: condition})
+	}
+	for _, c := range l.EventInvokeConfigs {
+		add(c.OnSuccess, "onSuccess")
+		add(c.OnFailure, "onFailure")
+	}
+	return rels
+}
@@ -0,0 +1,318 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	apigwtypes "github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	apigwv2types "github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	elb "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbtypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// endpoint is a resource a host name serves.
+type endpoint struct {
+	arn string
+	typ discovery.ResourceType
+}
+
+// endpoints maps host names, e.g. abc123.execute-api.us-east-1.amazonaws.com,
+// to the resources they serve. A custom domain can serve several APIs.
+type endpoints map[string][]endpoint
+
+func (e endpoints) add(host, arn string, typ discovery.ResourceType) {
+	host = normalizeHost(host)
+	if host == "" || arn == "" {
+		return
+	}
+	for _, ep := range e[host] {
+		if ep.arn == arn {
+			return
+		}
+	}
+	e[host] = append(e[host], endpoint{arn, typ})
+}
+
+// DNSRelationships returns how the public DNS names of the account lead to
+// services: a dns relationship from each name in a public Route 53 hosted
+// zone, or alias of a CloudFront distribution, to the endpoint it resolves
+// to, and an origin relationship from each distribution to the endpoints it
+// serves from. Endpoints are the default endpoints of the APIs and the URLs
+// of the functions among services, and the custom domain names of APIs and
+// the load balancers in regions. Names and distributions that lead to none
+// are left out. Route 53 and CloudFront are global and read in the first
+// region.
+func (p *Provider) DNSRelationships(ctx context.Context, regions []string, services []discovery.Service) ([]discovery.Relationship, error) {
+	if len(regions) == 0 {
+		return nil, nil
+	}
+	known := endpoints{}
+	for _, s := range services {
+		if a := s.Details.APIGateway; a != nil && a.Endpoint != "" {
+			known.add(a.Endpoint, s.Key(), s.ResourceType)
+		}
+		if l := s.Details.Lambda; l != nil && l.URL != nil {
+			known.add(l.URL.URL, s.Key(), s.ResourceType)
+		}
+	}
+	for _, region := range regions {
+		clients, err := p.clients(ctx, region)
+		if err != nil {
+			return nil, err
+		}
+		if err := addRegionEndpoints(ctx, clients, region, p.AccountID(), known); err != nil {
+			return nil, fmt.Errorf("%s: %w", region, err)
+		}
+	}
+
+	clients, err := p.clients(ctx, regions[0])
+	if err != nil {
+		return nil, err
+	}
+	var rels []discovery.Relationship
+	distributions, err := distributionRelationships(ctx, clients.cloudfront, known)
+	if err != nil {
+		return nil, err
+	}
+	records, err := recordRelationships(ctx, clients.route53, known)
+	if err != nil {
+		return nil, err
+	}
+	rels = append(rels, records...)
+	// A distribution's aliases usually have a record aliasing it too, which
+	// says more.
+	recorded := map[[2]string]bool{}
+	for _, r := range records {
+		recorded[[2]string{r.From, r.Target}] = true
+	}
+	for _, r := range distributions {
+		if !recorded[[2]string{r.From, r.Target}] {
+			rels = append(rels, r)
+		}
+	}
+
+	sort.Slice(rels, func(i, j int) bool {
+		if rels[i].From != rels[j].From {
+			return rels[i].From < rels[j].From
+		}
+		return rels[i].Target < rels[j].Target
+	})
+	return rels, nil
+}
+
+// addRegionEndpoints adds the load balancers and API custom domain names of
+// region to known.
+func addRegionEndpoints(ctx context.Context, clients *regionClients, region, account string, known endpoints) error {
+	lbs := elb.NewDescribeLoadBalancersPaginator(clients.elb, &elb.DescribeLoadBalancersInput{})
+	for lb, err := range paginate(ctx, lbs.HasMorePages, lbs.NextPage, listedLoadBalancers) {
+		if err != nil {
+			return fmt.Errorf("describing load balancers: %w", err)
+		}
+		known.add(aws.ToString(lb.DNSName), aws.ToString(lb.LoadBalancerArn), discovery.ResourceTypeLoadBalancer)
+	}
+
+	// A REST API custom domain is served by a regional host or, for edge
+	// optimized ones, a CloudFront distribution AWS manages.
+	domains := apigateway.NewGetDomainNamesPaginator(clients.apigateway, &apigateway.GetDomainNamesInput{})
+	for d, err := range paginate(ctx, domains.HasMorePages, domains.NextPage, listedDomainNames) {
+		if err != nil {
+			return fmt.Errorf("getting API domain names: %w", err)
+		}
+		mappings := apigateway.NewGetBasePathMappingsPaginator(clients.apigateway, &apigateway.GetBasePathMappingsInput{DomainName: d.DomainName})
+		for m, err := range paginate(ctx, mappings.HasMorePages, mappings.NextPage, listedBasePathMappings) {
+			if err != nil {
+				return fmt.Errorf("getting base path mappings of %s: %w", aws.ToString(d.DomainName), err)
+			}
+			arn := apiARN(region, account, aws.ToString(m.RestApiId))
+			for _, host := range []*string{d.DomainName, d.RegionalDomainName, d.DistributionDomainName} {
+				known.add(aws.ToString(host), arn, discovery.ResourceTypeAPIGateway)
+			}
+		}
+	}
+
+	domainPage := func(ctx context.Context, token *string) (*apigatewayv2.GetDomainNamesOutput, error) {
+		return clients.apigatewayv2.GetDomainNames(ctx, &apigatewayv2.GetDomainNamesInput{NextToken: token})
+	}
+	for d, err := range tokenPages(ctx, domainPage, listedV2DomainNames, nextV2DomainNames) {
+		if err != nil {
+			return fmt.Errorf("getting API domain names: %w", err)
+		}
+		mappingPage := func(ctx context.Context, token *string) (*apigatewayv2.GetApiMappingsOutput, error) {
+			return clients.apigatewayv2.GetApiMappings(ctx, &apigatewayv2.GetApiMappingsInput{DomainName: d.DomainName, NextToken: token})
+		}
+		for m, err := range tokenPages(ctx, mappingPage, listedV2APIMappings, nextV2APIMappings) {
+			if err != nil {
+				return fmt.Errorf("getting API mappings of %s: %w", aws.ToString(d.DomainName), err)
+			}
+			arn := apiARN(region, account, aws.ToString(m.ApiId))
+			known.add(aws.ToString(d.DomainName), arn, discovery.ResourceTypeHTTPAPI)
+			for _, c := range d.DomainNameConfigurations {
+				known.add(aws.ToString(c.ApiGatewayDomainName), arn, discovery.ResourceTypeHTTPAPI)
+			}
+		}
+	}
+	return nil
+}
+
+// distributionRelationships returns the origin relationships of the
+// distributions with origins among known, and dns relationships from their
+// aliases. Their own domain names are added to known, so records aliasing
+// them resolve.
+func distributionRelationships(ctx context.Context, client CloudFrontAPI, known endpoints) ([]discovery.Relationship, error) {
+	var rels []discovery.Relationship
+	p := cloudfront.NewListDistributionsPaginator(client, &cloudfront.ListDistributionsInput{})
+	for d, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedDistributions) {
+		if err != nil {
+			return nil, fmt.Errorf("listing CloudFront distributions: %w", err)
+		}
+		arn := aws.ToString(d.ARN)
+		served := false
+		if d.Origins != nil {
+			seen := map[string]bool{}
+			for _, o := range d.Origins.Items {
+				for _, ep := range known[normalizeHost(aws.ToString(o.DomainName))] {
+					if seen[ep.arn] {
+						continue
+					}
+					seen[ep.arn] = true
+					served = true
+					rels = append(rels, discovery.Relationship{
+						From:       arn,
+						FromType:   discovery.ResourceTypeDistribution,
+						Relation:   discovery.RelationOrigin,
+						Target:     ep.arn,
+						TargetType: ep.typ,
+						Via:        aws.ToString(o.Id),
+					})
+				}
+			}
+		}
+		if !served {
+			continue
+		}
+		known.add(aws.ToString(d.DomainName), arn, discovery.ResourceTypeDistribution)
+		if d.Aliases != nil {
+			for _, alias := range d.Aliases.Items {
+				rels = append(rels, dnsRelationship(alias, endpoint{arn, discovery.ResourceTypeDistribution}, "alias"))
+			}
+		}
+	}
+	return rels, nil
+}
+
+// recordRelationships returns a dns relationship for every A, AAAA or CNAME
+// record in a public hosted zone that resolves to one of known. Private
+// zones only resolve within VPCs.
+func recordRelationships(ctx context.Context, client Route53API, known endpoints) ([]discovery.Relationship, error) {
+	byKey := map[[2]string]discovery.Relationship{}
+	zones := route53.NewListHostedZonesPaginator(client, &route53.ListHostedZonesInput{})
+	for zone, err := range paginate(ctx, zones.HasMorePages, zones.NextPage, listedHostedZones) {
+		if err != nil {
+			return nil, fmt.Errorf("listing hosted zones: %w", err)
+		}
+		if zone.Config != nil && zone.Config.PrivateZone {
+			continue
+		}
+		records := route53.NewListResourceRecordSetsPaginator(client, &route53.ListResourceRecordSetsInput{HostedZoneId: zone.Id})
+		for r, err := range paginate(ctx, records.HasMorePages, records.NextPage, listedRecordSets) {
+			if err != nil {
+				return nil, fmt.Errorf("listing records of %s: %w", aws.ToString(zone.Name), err)
+			}
+			var values []string
+			via := string(r.Type)
+			switch {
+			case r.AliasTarget != nil:
+				values, via = []string{aws.ToString(r.AliasTarget.DNSName)}, via+" alias"
+			case r.Type == route53types.RRTypeCname:
+				for _, v := range r.ResourceRecords {
+					values = append(values, aws.ToString(v.Value))
+				}
+			}
+			for _, v := range values {
+				for _, ep := range known[normalizeHost(v)] {
+					rel := dnsRelationship(aws.ToString(r.Name), ep, via)
+					// Weighted and latency records repeat a name.
+					byKey[[2]string{rel.From, rel.Target}] = rel
+				}
+			}
+		}
+	}
+	rels := make([]discovery.Relationship, 0, len(byKey))
+	for _, r := range byKey {
+		rels = append(rels, r)
+	}
+	return rels, nil
+}
+
+func dnsRelationship(name string, ep endpoint, via string) discovery.Relationship {
+	return discovery.Relationship{
+		From:       normalizeHost(name),
+		FromType:   discovery.ResourceTypeDNSName,
+		Relation:   discovery.RelationDNS,
+		Target:     ep.arn,
+		TargetType: ep.typ,
+		Via:        via,
+	}
+}
+
+// normalizeHost returns the host name of a URL or DNS name in lower case,
+// without the trailing dot of fully qualified names or the dualstack. prefix
+// of load balancer aliases. Route 53 escapes * in names as \052.
+func normalizeHost(name string) string {
+	if strings.Contains(name, "://") {
+		if u, err := url.Parse(name); err == nil {
+			name = u.Host
+		}
+	}
+	name = strings.ReplaceAll(strings.ToLower(strings.TrimSuffix(name, ".")), `\052`, "*")
+	return strings.TrimPrefix(name, "dualstack.")
+}
+
+func listedLoadBalancers(page *elb.DescribeLoadBalancersOutput) []elbtypes.LoadBalancer {
+	return page.LoadBalancers
+}
+
+func listedDomainNames(page *apigateway.GetDomainNamesOutput) []apigwtypes.DomainName {
+	return page.Items
+}
+
+func listedBasePathMappings(page *apigateway.GetBasePathMappingsOutput) []apigwtypes.BasePathMapping {
+	return page.Items
+}
+
+func listedV2DomainNames(page *apigatewayv2.GetDomainNamesOutput) []apigwv2types.DomainName {
+	return page.Items
+}
+func nextV2DomainNames(page *apigatewayv2.GetDomainNamesOutput) *string { return page.NextToken }
+
+func listedV2APIMappings(page *apigatewayv2.GetApiMappingsOutput) []apigwv2types.ApiMapping {
+	return page.Items
+}
+func nextV2APIMappings(page *apigatewayv2.GetApiMappingsOutput) *string { return page.NextToken }
+
+func listedDistributions(page *cloudfront.ListDistributionsOutput) []cftypes.DistributionSummary {
+	if page.DistributionList == nil {
+		return nil
+	}
+	return page.DistributionList.Items
+}
+
+func listedHostedZones(page *route53.ListHostedZonesOutput) []route53types.HostedZone {
+	return page.HostedZones
+}
+
+func listedRecordSets(page *route53.ListResourceRecordSetsOutput) []route53types.ResourceRecordSet {
+	return page.ResourceRecordSets
+}
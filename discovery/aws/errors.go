@@ -0,0 +1,29 @@
+package awscmd
+
+import (
+	"errors"
+
+	"github.com/aws/smithy-go"
+)
+
+// accessDeniedCodes are the error codes AWS services use for missing IAM
+// permissions.
+var accessDeniedCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AccessDeniedException": true,
+	"UnauthorizedOperation": true,
+	"AuthorizationError":    true,
+}
+
+// isAccessDenied reports whether err means the role may not call the API.
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && accessDeniedCodes[apiErr.ErrorCode()]
+}
+
+// isNotFound reports whether err means the requested resource, or the part
+// of it asked for, does not exist.
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && (apiErr.ErrorCode() == "ResourceNotFoundException" || apiErr.ErrorCode() == "NotFoundException")
+}
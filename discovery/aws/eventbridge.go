@@ -0,0 +1,146 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// EventBusCataloger discovers EventBridge event buses, the resources their
+// rules send events to and, from their policies, the accounts and
+// resources allowed to put events on them.
+type EventBusCataloger struct {
+	client  EventBridgeAPI
+	region  string
+	account string
+	// skipPolicy leaves out what bus policies allow.
+	skipPolicy bool
+}
+
+// NewEventBusCataloger returns a cataloger listing the event buses of
+// account in region with client.
+func NewEventBusCataloger(client EventBridgeAPI, region, account string) *EventBusCataloger {
+	return &EventBusCataloger{client: client, region: region, account: account}
+}
+
+func (c *EventBusCataloger) Name() string {
+	return "eventbridge"
+}
+
+func (c *EventBusCataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	listBuses := func(ctx context.Context, send func(ebtypes.EventBus) bool) error {
+		page := func(ctx context.Context, token *string) (*eventbridge.ListEventBusesOutput, error) {
+			return c.client.ListEventBuses(ctx, &eventbridge.ListEventBusesInput{NextToken: token})
+		}
+		for bus, err := range tokenPages(ctx, page, listedEventBuses, nextEventBuses) {
+			if err != nil {
+				return fmt.Errorf("listing event buses: %w", err)
+			}
+			if !send(bus) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	describeBus := func(ctx context.Context, bus ebtypes.EventBus) discovery.Result {
+		var result discovery.Result
+		s := &result.Service
+		s.Provider = "aws"
+		s.Region = c.region
+		s.AccountID = c.account
+		s.ResourceType = discovery.ResourceTypeEventBus
+		s.ARN = aws.ToString(bus.Arn)
+		s.Name = aws.ToString(bus.Name)
+		s.DiscoveredAt = time.Now().UTC()
+
+		targets, err := c.ruleTargets(ctx, s.Name)
+		if err != nil {
+			return discovery.SkipResource(s.Name, err)
+		}
+		s.Relationships = targets
+		if policy := aws.ToString(bus.Policy); policy != "" && !c.skipPolicy {
+			doc, err := parsePolicy(policy)
+			if err != nil {
+				return discovery.SkipResource(s.Name, fmt.Errorf("policy: %w", err))
+			}
+			s.Relationships = append(s.Relationships, inferInbound(s.ARN, discovery.ResourceTypeEventBus, c.account, doc)...)
+		}
+		return result
+	}
+
+	return fanOut(ctx, Workers, OrderedResults, listBuses, describeBus, emit)
+}
+
+// ruleTargets returns an eventTarget relationship for every resource the
+// rules on bus send events to, sorted by target, with the rules in Via.
+// State is ENABLED when one of the rules is. Targets discovery has no type
+// for, such as API destinations, are left out.
+func (c *EventBusCataloger) ruleTargets(ctx context.Context, bus string) ([]discovery.Relationship, error) {
+	rules := map[string][]string{}
+	types := map[string]discovery.ResourceType{}
+	enabled := map[string]bool{}
+	rulePage := func(ctx context.Context, token *string) (*eventbridge.ListRulesOutput, error) {
+		return c.client.ListRules(ctx, &eventbridge.ListRulesInput{EventBusName: aws.String(bus), NextToken: token})
+	}
+	for rule, err := range tokenPages(ctx, rulePage, listedRules, nextRules) {
+		if err != nil {
+			return nil, fmt.Errorf("listing rules: %w", err)
+		}
+		name := aws.ToString(rule.Name)
+		targetPage := func(ctx context.Context, token *string) (*eventbridge.ListTargetsByRuleOutput, error) {
+			return c.client.ListTargetsByRule(ctx, &eventbridge.ListTargetsByRuleInput{Rule: rule.Name, EventBusName: aws.String(bus), NextToken: token})
+		}
+		for t, err := range tokenPages(ctx, targetPage, listedTargets, nextTargets) {
+			if err != nil {
+				return nil, fmt.Errorf("listing targets of rule %s: %w", name, err)
+			}
+			arn, typ, ok := resourceOf(aws.ToString(t.Arn))
+			if !ok {
+				continue
+			}
+			rules[arn] = append(rules[arn], name)
+			types[arn] = typ
+			if rule.State != ebtypes.RuleStateDisabled {
+				enabled[arn] = true
+			}
+		}
+	}
+
+	rels := make([]discovery.Relationship, 0, len(rules))
+	for arn, names := range rules {
+		sort.Strings(names)
+		state := string(ebtypes.RuleStateDisabled)
+		if enabled[arn] {
+			state = string(ebtypes.RuleStateEnabled)
+		}
+		rels = append(rels, discovery.Relationship{
+			Relation:   discovery.RelationEventTarget,
+			Target:     arn,
+			TargetType: types[arn],
+			Via:        strings.Join(names, ", "),
+			State:      state,
+		})
+	}
+	sort.Slice(rels, func(i, j int) bool { return rels[i].Target < rels[j].Target })
+	return rels, nil
+}
+
+func listedEventBuses(page *eventbridge.ListEventBusesOutput) []ebtypes.EventBus {
+	return page.EventBuses
+}
+func nextEventBuses(page *eventbridge.ListEventBusesOutput) *string { return page.NextToken }
+
+func listedRules(page *eventbridge.ListRulesOutput) []ebtypes.Rule { return page.Rules }
+func nextRules(page *eventbridge.ListRulesOutput) *string          { return page.NextToken }
+
+func listedTargets(page *eventbridge.ListTargetsByRuleOutput) []ebtypes.Target { return page.Targets }
+func nextTargets(page *eventbridge.ListTargetsByRuleOutput) *string            { return page.NextToken }
@@ -0,0 +1,48 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// eventSources lists the event source mappings of a region and returns the
+// relationships they give each function, by unqualified function ARN.
+// Mappings without an event source ARN, such as those reading self-managed
+// Kafka, are left out.
+func eventSources(ctx context.Context, client LambdaAPI) (map[string][]discovery.Relationship, error) {
+	sources := map[string][]discovery.Relationship{}
+	p := lambda.NewListEventSourceMappingsPaginator(client, &lambda.ListEventSourceMappingsInput{})
+	for m, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedEventSourceMappings) {
+		if err != nil {
+			return nil, fmt.Errorf("listing event source mappings: %w", err)
+		}
+		source := aws.ToString(m.EventSourceArn)
+		if source == "" || m.FunctionArn == nil {
+			continue
+		}
+		// Event sources of unknown types are kept, untyped.
+		target, typ, ok := resourceOf(source)
+		if !ok {
+			target = source
+		}
+		fn := unqualifiedFunctionARN(aws.ToString(m.FunctionArn))
+		sources[fn] = append(sources[fn], discovery.Relationship{
+			Relation:   discovery.RelationEventSource,
+			Target:     target,
+			TargetType: typ,
+			Via:        aws.ToString(m.UUID),
+			State:      aws.ToString(m.State),
+		})
+	}
+	return sources, nil
+}
+
+func listedEventSourceMappings(page *lambda.ListEventSourceMappingsOutput) []lambdatypes.EventSourceMappingConfiguration {
+	return page.EventSourceMappings
+}
@@ -0,0 +1,172 @@
+package awscmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// maxImageConfigSize bounds the image configurations downloaded for their
+// labels; they are usually a few kilobytes.
+const maxImageConfigSize = 1 << 20
+
+// imageManifestTypes are the manifest media types an image's configuration,
+// and so its labels, is read from. Indexes of images for several platforms
+// are not, as Lambda does not run them.
+var imageManifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// imageRef splits the ECR image URI uri, e.g.
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com/orders@sha256:..., into its
+// registry, repository and digest or tag.
+func imageRef(uri string) (registry, repository string, id ecrtypes.ImageIdentifier, ok bool) {
+	host, path, found := strings.Cut(uri, "/")
+	if !found || !strings.Contains(host, ".dkr.ecr.") {
+		return "", "", id, false
+	}
+	registry, _, _ = strings.Cut(host, ".")
+	if repo, digest, found := strings.Cut(path, "@"); found {
+		return registry, repo, ecrtypes.ImageIdentifier{ImageDigest: aws.String(digest)}, true
+	}
+	if i := strings.LastIndex(path, ":"); i > 0 {
+		return registry, path[:i], ecrtypes.ImageIdentifier{ImageTag: aws.String(path[i+1:])}, true
+	}
+	return registry, path, ecrtypes.ImageIdentifier{ImageTag: aws.String("latest")}, true
+}
+
+// containerImage returns what ECR has about the image uri: when it was
+// pushed, its tags, size and latest scan, and the labels of its
+// configuration. It returns nil for images outside ECR.
+func containerImage(ctx context.Context, client ECRAPI, uri string) (*discovery.ContainerImage, error) {
+	registry, repository, id, ok := imageRef(uri)
+	if !ok {
+		return nil, nil
+	}
+	reqCtx, cancel := requestContext(ctx)
+	out, err := client.DescribeImages(reqCtx, &ecr.DescribeImagesInput{
+		RegistryId:     aws.String(registry),
+		RepositoryName: aws.String(repository),
+		ImageIds:       []ecrtypes.ImageIdentifier{id},
+	})
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("describing image %s: %w", uri, err)
+	}
+	if len(out.ImageDetails) == 0 {
+		return nil, fmt.Errorf("no image %s", uri)
+	}
+	d := out.ImageDetails[0]
+	image := &discovery.ContainerImage{
+		RegistryID: registry,
+		Repository: repository,
+		Digest:     aws.ToString(d.ImageDigest),
+		Tags:       d.ImageTags,
+		PushedAt:   aws.ToTime(d.ImagePushedAt).UTC(),
+		Size:       aws.ToInt64(d.ImageSizeInBytes),
+	}
+	if d.ImageScanStatus != nil || d.ImageScanFindingsSummary != nil {
+		image.Scan = &discovery.ImageScan{}
+		if s := d.ImageScanStatus; s != nil {
+			image.Scan.Status = string(s.Status)
+		}
+		if f := d.ImageScanFindingsSummary; f != nil {
+			if t := f.ImageScanCompletedAt; t != nil {
+				completed := t.UTC()
+				image.Scan.CompletedAt = &completed
+			}
+			if len(f.FindingSeverityCounts) > 0 {
+				image.Scan.Findings = f.FindingSeverityCounts
+			}
+		}
+	}
+	if image.Labels, err = imageLabels(ctx, client, registry, repository, image.Digest); err != nil {
+		return nil, fmt.Errorf("reading the labels of image %s: %w", uri, err)
+	}
+	return image, nil
+}
+
+// imageLabels returns the labels of the configuration of the image digest,
+// downloaded from the repository's storage.
+func imageLabels(ctx context.Context, client ECRAPI, registry, repository, digest string) (map[string]string, error) {
+	reqCtx, cancel := requestContext(ctx)
+	out, err := client.BatchGetImage(reqCtx, &ecr.BatchGetImageInput{
+		RegistryId:         aws.String(registry),
+		RepositoryName:     aws.String(repository),
+		ImageIds:           []ecrtypes.ImageIdentifier{{ImageDigest: aws.String(digest)}},
+		AcceptedMediaTypes: imageManifestTypes,
+	})
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("getting manifest: %w", err)
+	}
+	if len(out.Images) == 0 {
+		return nil, nil
+	}
+	var manifest struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal([]byte(aws.ToString(out.Images[0].ImageManifest)), &manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	configDigest, ok := strings.CutPrefix(manifest.Config.Digest, "sha256:")
+	if !ok {
+		return nil, nil
+	}
+
+	reqCtx, cancel = requestContext(ctx)
+	defer cancel()
+	layer, err := client.GetDownloadUrlForLayer(reqCtx, &ecr.GetDownloadUrlForLayerInput{
+		RegistryId:     aws.String(registry),
+		RepositoryName: aws.String(repository),
+		LayerDigest:    aws.String(manifest.Config.Digest),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting configuration URL: %w", err)
+	}
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, aws.ToString(layer.DownloadUrl), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading configuration: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading configuration: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImageConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("downloading configuration: %w", err)
+	}
+	if len(body) > maxImageConfigSize {
+		return nil, fmt.Errorf("configuration is larger than %d bytes", maxImageConfigSize)
+	}
+	if sum := sha256.Sum256(body); hex.EncodeToString(sum[:]) != configDigest {
+		return nil, fmt.Errorf("configuration does not match digest %s", manifest.Config.Digest)
+	}
+	var config struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+	return config.Config.Labels, nil
+}
@@ -0,0 +1,59 @@
+package awscmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// APICall describes one attempt of an AWS API call. Retried calls produce one
+// APICall per attempt.
+type APICall struct {
+	Service   string // e.g. "Lambda"
+	Operation string // e.g. "GetFunction"
+	Duration  time.Duration
+	Err       error
+	Throttled bool
+}
+
+// APIObserver, when set, is told about every AWS API attempt. It is called
+// concurrently and must not block.
+var APIObserver func(APICall)
+
+// apiOptions returns the middleware added to every AWS client config.
+func apiOptions() []func(*middleware.Stack) error {
+	return []func(*middleware.Stack) error{
+		func(stack *middleware.Stack) error {
+			// After the retry middleware, so each attempt is observed.
+			return stack.Finalize.Add(observeMiddleware, middleware.After)
+		},
+		func(stack *middleware.Stack) error {
+			// Inside the observer, which sees attempts time out.
+			return stack.Finalize.Add(attemptTimeoutMiddleware, middleware.After)
+		},
+	}
+}
+
+var throttles = retry.IsErrorThrottles(retry.DefaultThrottles)
+
+var observeMiddleware = middleware.FinalizeMiddlewareFunc("DiscoveryObserve",
+	func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		observe := APIObserver
+		if observe == nil {
+			return next.HandleFinalize(ctx, in)
+		}
+		start := time.Now()
+		out, md, err := next.HandleFinalize(ctx, in)
+		observe(APICall{
+			Service:   awsmiddleware.GetServiceID(ctx),
+			Operation: awsmiddleware.GetOperationName(ctx),
+			Duration:  time.Since(start),
+			Err:       err,
+			Throttled: err != nil && throttles.IsErrorThrottle(err) == aws.TrueTernary,
+		})
+		return out, md, err
+	})
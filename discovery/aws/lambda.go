@@ -0,0 +1,553 @@
+package awscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/code"
+)
+
+// LambdaCataloger discovers Lambda functions.
+type LambdaCataloger struct {
+	client LambdaAPI
+	region string
+	// iam and roles, when set, read execution role policies to infer the
+	// resources functions depend on.
+	iam   IAMAPI
+	roles *rolePolicies
+	// policies, when set, reads the resource policies of functions and of
+	// the queues, topics and buckets they relate to with policyClients, to
+	// infer what depends on them.
+	policies      *resourcePolicies
+	policyClients policyClients
+	// autoscaling, when set, is used to read how provisioned concurrency is
+	// scaled.
+	autoscaling ApplicationAutoScalingAPI
+	// ecr, when set, is used to read the images of Image functions.
+	ecr ECRAPI
+	// dependencies, when set, downloads each function's package to read
+	// the dependencies its manifests declare.
+	dependencies bool
+	// usage, when set, reads how much each function was used over that
+	// long from its CloudWatch metrics with cloudwatch.
+	usage      time.Duration
+	cloudwatch CloudWatchAPI
+}
+
+// NewLambdaCataloger returns a cataloger listing functions in region with
+// client.
+func NewLambdaCataloger(client LambdaAPI, region string) *LambdaCataloger {
+	return &LambdaCataloger{client: client, region: region}
+}
+
+func (c *LambdaCataloger) Name() string {
+	return "lambda"
+}
+
+func (c *LambdaCataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	return catalogLambdas(ctx, c, emit)
+}
+
+// CatalogLambdas calls emit for every Lambda function visible to cfg. Function
+// details are fetched by Workers concurrent requests while listing continues.
+// Functions whose details cannot be fetched are reported as skipped.
+func CatalogLambdas(ctx context.Context, cfg aws.Config, emit func(discovery.Result) error) error {
+	return catalogLambdas(ctx, NewLambdaCataloger(lambda.NewFromConfig(cfg), cfg.Region), emit)
+}
+
+func catalogLambdas(ctx context.Context, c *LambdaCataloger, emit func(discovery.Result) error) error {
+	lambdaClient, region := c.client, c.region
+	listFunctions := func(ctx context.Context, send func(lambdatypes.FunctionConfiguration) bool) error {
+		p := lambda.NewListFunctionsPaginator(lambdaClient, &lambda.ListFunctionsInput{})
+		for fn, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedFunctions) {
+			if err != nil {
+				return fmt.Errorf("listing functions: %w", err)
+			}
+			if !send(fn) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	// Event source mappings are listed for the whole region up front and
+	// matched to functions as they are described. Functions are still
+	// reported when they cannot be listed, without their event sources.
+	sources, sourcesErr := eventSources(ctx, lambdaClient)
+	if sourcesErr != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// So are the auto scaling targets and policies of provisioned
+	// concurrency.
+	var scaling map[string]map[string]*discovery.ConcurrencyScaling
+	var scalingErr error
+	if c.autoscaling != nil {
+		if scaling, scalingErr = concurrencyScaling(ctx, c.autoscaling); scalingErr != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	// relate adds the relationships of s. Permissions and resource policies
+	// are best effort: the first failure to read each kind is reported once
+	// for the region.
+	var policyErrs policyErrors
+	relate := func(ctx context.Context, s *discovery.Service) {
+		s.Relationships = slices.Clone(sources[s.ARN])
+		if role := s.Details.Lambda.Role; c.roles != nil && role != "" {
+			rels, err := c.roles.relationships(ctx, c.iam, role)
+			policyErrs.add(err)
+			for _, r := range rels {
+				if r.Target != s.ARN {
+					s.Relationships = append(s.Relationships, r)
+				}
+			}
+		}
+		if c.policies == nil {
+			return
+		}
+		// Inbound relationships: what the function's own policy lets
+		// invoke it, and what may use the resources it relates to.
+		inbound, perms, err := c.policies.functionRelationships(ctx, lambdaClient, s.ARN)
+		policyErrs.add(err)
+		s.Details.Lambda.InvokePermissions = perms
+		for _, r := range s.Relationships {
+			if r.From != "" {
+				continue
+			}
+			rels, err := c.policies.relationships(ctx, c.policyClients, r.Target, r.TargetType)
+			policyErrs.add(err)
+			inbound = append(inbound, rels...)
+		}
+		for _, r := range inbound {
+			if r.From != s.ARN {
+				s.Relationships = append(s.Relationships, r)
+			}
+		}
+	}
+
+	// Function URLs are best effort too: the first failure to read one is
+	// reported once for the region, and once access is denied no more are
+	// read.
+	var urlErr atomic.Pointer[error]
+	var urlDenied atomic.Bool
+	addURL := func(ctx context.Context, s *discovery.Service) {
+		if urlDenied.Load() {
+			return
+		}
+		callCtx, cancel := requestContext(ctx)
+		out, err := lambdaClient.GetFunctionUrlConfig(callCtx, &lambda.GetFunctionUrlConfigInput{FunctionName: aws.String(s.ARN)})
+		cancel()
+		switch {
+		case err == nil:
+			s.Details.Lambda.URL = &discovery.FunctionURL{URL: aws.ToString(out.FunctionUrl), AuthType: string(out.AuthType)}
+		case isNotFound(err):
+		default:
+			if isAccessDenied(err) {
+				urlDenied.Store(true)
+			}
+			err = fmt.Errorf("getting function URL of %s: %w", s.Name, err)
+			urlErr.CompareAndSwap(nil, &err)
+		}
+	}
+
+	// Provisioned concurrency is read like function URLs.
+	var provisionedErr atomic.Pointer[error]
+	var provisionedDenied atomic.Bool
+	addProvisioned := func(ctx context.Context, s *discovery.Service) {
+		if provisionedDenied.Load() {
+			return
+		}
+		configs, err := provisionedConcurrency(ctx, lambdaClient, s.Name, scaling[s.Name])
+		if err != nil {
+			if isAccessDenied(err) {
+				provisionedDenied.Store(true)
+			}
+			provisionedErr.CompareAndSwap(nil, &err)
+			return
+		}
+		s.Details.Lambda.ProvisionedConcurrency = configs
+	}
+
+	// Event invoke configs are read like function URLs too. The dead-letter
+	// target comes with the function's configuration, so it is related
+	// even when they cannot be read.
+	var invokeErr atomic.Pointer[error]
+	var invokeDenied atomic.Bool
+	addDestinations := func(ctx context.Context, s *discovery.Service) {
+		l := s.Details.Lambda
+		if !invokeDenied.Load() {
+			configs, err := eventInvokeConfigs(ctx, lambdaClient, s.Name)
+			if err == nil {
+				l.EventInvokeConfigs = configs
+			} else {
+				if isAccessDenied(err) {
+					invokeDenied.Store(true)
+				}
+				invokeErr.CompareAndSwap(nil, &err)
+			}
+		}
+		s.Relationships = append(s.Relationships, failureRoutingRelationships(l)...)
+	}
+
+	// Images are read like function URLs too, each once for the region:
+	// functions are often deployed from the same image.
+	var imageErr atomic.Pointer[error]
+	var imageDenied atomic.Bool
+	var images memo[*discovery.ContainerImage]
+	addImage := func(ctx context.Context, s *discovery.Service) {
+		l := s.Details.Lambda
+		uri := l.Code.ResolvedImageURI
+		if uri == "" {
+			uri = l.Code.ImageURI
+		}
+		if c.ecr == nil || uri == "" || imageDenied.Load() {
+			return
+		}
+		image, err := images.get(ctx, uri, func() (*discovery.ContainerImage, error) {
+			return containerImage(ctx, c.ecr, uri)
+		})
+		if err != nil {
+			if isAccessDenied(err) {
+				imageDenied.Store(true)
+			}
+			imageErr.CompareAndSwap(nil, &err)
+			return
+		}
+		l.Code.Image = image
+	}
+
+	// Dependencies are best effort as well: the first package that cannot
+	// be read is reported once for the region. The layers functions use are
+	// read with them, each version once for the region.
+	var depsErr atomic.Pointer[error]
+	var layers memo[*discovery.LayerContents]
+	addDependencies := func(ctx context.Context, s *discovery.Service) {
+		l := s.Details.Lambda
+		if !c.dependencies {
+			return
+		}
+		for i := range l.Layers {
+			layer := &l.Layers[i]
+			contents, err := layers.get(ctx, layer.ARN, func() (*discovery.LayerContents, error) {
+				return layerContents(ctx, lambdaClient, layer.ARN)
+			})
+			if err != nil {
+				depsErr.CompareAndSwap(nil, &err)
+				continue
+			}
+			layer.Contents = contents
+		}
+		if l.Code.Location == "" {
+			return
+		}
+		deps, err := code.Dependencies(ctx, nil, code.Package{Function: s.ARN, Name: s.Name, Region: region, URL: l.Code.Location, SHA256: l.Code.SHA256, Size: l.Code.Size}, 0)
+		if err != nil {
+			// The dependencies of the manifests that parse are still
+			// recorded.
+			err = fmt.Errorf("reading the package of %s: %w", s.Name, err)
+			depsErr.CompareAndSwap(nil, &err)
+			if !errors.Is(err, code.ErrUnparsable) {
+				return
+			}
+		}
+		l.Dependencies = deps
+	}
+
+	// When the role may list functions but not call GetFunction, report
+	// what the listing has (no code location, tags or concurrency) and
+	// stop calling it; the omission is reported once for the region.
+	var denied atomic.Pointer[error]
+	describeFunction := func(ctx context.Context, fn lambdatypes.FunctionConfiguration) discovery.Result {
+		var result discovery.Result
+		if denied.Load() != nil {
+			lambdaService(&result.Service, region, &lambda.GetFunctionOutput{Configuration: &fn})
+			relate(ctx, &result.Service)
+			addURL(ctx, &result.Service)
+			addProvisioned(ctx, &result.Service)
+			addDestinations(ctx, &result.Service)
+			return result
+		}
+
+		name := aws.ToString(fn.FunctionName)
+		fnCtx, cancel := requestContext(ctx)
+		output, err := lambdaClient.GetFunction(fnCtx, &lambda.GetFunctionInput{
+			FunctionName: aws.String(name),
+		})
+		cancel()
+		if isAccessDenied(err) {
+			deniedErr := fmt.Errorf("getting function: %w", err)
+			denied.CompareAndSwap(nil, &deniedErr)
+			output, err = &lambda.GetFunctionOutput{Configuration: &fn}, nil
+		}
+		if err != nil {
+			return discovery.SkipResource(name, fmt.Errorf("getting function: %w", err))
+		}
+
+		lambdaService(&result.Service, region, output)
+		relate(ctx, &result.Service)
+		addURL(ctx, &result.Service)
+		addProvisioned(ctx, &result.Service)
+		addDestinations(ctx, &result.Service)
+		addImage(ctx, &result.Service)
+		addDependencies(ctx, &result.Service)
+		return result
+	}
+
+	// When usage is recorded, functions are held back until usageBatch of
+	// them are described, as their metrics are read in batches. Once reading
+	// them fails, the rest are reported without usage; the omission is
+	// reported once for the region.
+	var described []discovery.Result
+	var usageErr error
+	flushUsage := func() error {
+		if usageErr == nil {
+			if err := addUsage(ctx, c.cloudwatch, described, c.usage); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				usageErr = err
+			}
+		}
+		for _, r := range described {
+			if err := emit(r); err != nil {
+				return err
+			}
+		}
+		described = described[:0]
+		return nil
+	}
+	emitFunction := emit
+	if c.usage > 0 && c.cloudwatch != nil {
+		emitFunction = func(r discovery.Result) error {
+			described = append(described, r)
+			if len(described) < usageBatch {
+				return nil
+			}
+			return flushUsage()
+		}
+	}
+	if err := fanOut(ctx, Workers, OrderedResults, listFunctions, describeFunction, emitFunction); err != nil {
+		return err
+	}
+	if len(described) > 0 {
+		if err := flushUsage(); err != nil {
+			return err
+		}
+	}
+	if usageErr != nil {
+		if err := emit(discovery.SkipDetail("cloudwatch:GetMetricData", usageErr)); err != nil {
+			return err
+		}
+	}
+	if err := denied.Load(); err != nil {
+		if err := emit(discovery.SkipDetail("lambda:GetFunction", *err)); err != nil {
+			return err
+		}
+	}
+	if sourcesErr != nil {
+		if err := emit(discovery.SkipDetail("lambda:ListEventSourceMappings", sourcesErr)); err != nil {
+			return err
+		}
+	}
+	if err := urlErr.Load(); err != nil {
+		if err := emit(discovery.SkipDetail("lambda:GetFunctionUrlConfig", *err)); err != nil {
+			return err
+		}
+	}
+	if err := provisionedErr.Load(); err != nil {
+		if err := emit(discovery.SkipDetail("lambda:ListProvisionedConcurrencyConfigs", *err)); err != nil {
+			return err
+		}
+	}
+	if err := invokeErr.Load(); err != nil {
+		if err := emit(discovery.SkipDetail("lambda:ListFunctionEventInvokeConfigs", *err)); err != nil {
+			return err
+		}
+	}
+	if err := imageErr.Load(); err != nil {
+		if err := emit(discovery.SkipDetail("ecr:DescribeImages", *err)); err != nil {
+			return err
+		}
+	}
+	if scalingErr != nil {
+		if err := emit(discovery.SkipDetail("application-autoscaling:DescribeScalableTargets", scalingErr)); err != nil {
+			return err
+		}
+	}
+	if err := depsErr.Load(); err != nil {
+		if err := emit(discovery.SkipDetail("dependency manifests", *err)); err != nil {
+			return err
+		}
+	}
+	return policyErrs.emit(emit)
+}
+
+// layerContents downloads the layer version arn and returns what it holds.
+func layerContents(ctx context.Context, client LambdaAPI, arn string) (*discovery.LayerContents, error) {
+	reqCtx, cancel := requestContext(ctx)
+	out, err := client.GetLayerVersionByArn(reqCtx, &lambda.GetLayerVersionByArnInput{Arn: aws.String(arn)})
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("getting layer %s: %w", arn, err)
+	}
+	if out.Content == nil || aws.ToString(out.Content.Location) == "" {
+		return nil, fmt.Errorf("layer %s has no archive to download", arn)
+	}
+	p := code.Package{
+		Function: arn,
+		Name:     shortName(arn),
+		Region:   regionOf(arn),
+		URL:      aws.ToString(out.Content.Location),
+		SHA256:   aws.ToString(out.Content.CodeSha256),
+		Size:     out.Content.CodeSize,
+	}
+	contents, err := code.Layer(ctx, nil, p, 0)
+	if err != nil {
+		return nil, fmt.Errorf("reading layer %s: %w", arn, err)
+	}
+	return contents, nil
+}
+
+// usageBatch is the most functions whose usage is read at once, bounding
+// how many described functions are held back.
+const usageBatch = 500
+
+// addUsage sets the usage of the functions among results over the window
+// ending now, as they have just been described.
+func addUsage(ctx context.Context, client CloudWatchAPI, results []discovery.Result, window time.Duration) error {
+	var functions []*discovery.Service
+	var names []string
+	for i := range results {
+		if s := &results[i].Service; s.Details.Lambda != nil {
+			functions = append(functions, s)
+			names = append(names, s.Name)
+		}
+	}
+	if len(functions) == 0 {
+		return nil
+	}
+	end := time.Now().UTC()
+	usage, err := functionUsage(ctx, client, names, end.Add(-window), end)
+	if err != nil {
+		return err
+	}
+	for i, s := range functions {
+		s.Details.Lambda.Usage = &usage[i]
+	}
+	return nil
+}
+
+func listedFunctions(page *lambda.ListFunctionsOutput) []lambdatypes.FunctionConfiguration {
+	return page.Functions
+}
+
+// FunctionCode returns the deployment package of the function arn, with a
+// Location freshly presigned for downloading it; GetFunction signs it for 10
+// minutes. p must be the provider of the function's account, since the
+// function is looked up by its full ARN.
+func (p *Provider) FunctionCode(ctx context.Context, arn string) (discovery.LambdaCode, error) {
+	region := regionOf(arn)
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return discovery.LambdaCode{}, err
+	}
+	reqCtx, cancel := requestContext(ctx)
+	defer cancel()
+	out, err := clients.lambda.GetFunction(reqCtx, &lambda.GetFunctionInput{FunctionName: aws.String(arn)})
+	if err != nil {
+		return discovery.LambdaCode{}, fmt.Errorf("getting function %s: %w", arn, err)
+	}
+	var s discovery.Service
+	lambdaService(&s, region, out)
+	return s.Details.Lambda.Code, nil
+}
+
+// lambdaTimeLayout is the format of Lambda's LastModified timestamps,
+// e.g. 2019-11-14T20:17:07.106+0000.
+const lambdaTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// lambdaService fills s from a GetFunction response.
+func lambdaService(s *discovery.Service, region string, out *lambda.GetFunctionOutput) {
+	s.Provider = "aws"
+	s.Region = region
+	s.ResourceType = discovery.ResourceTypeLambdaFunction
+	s.DiscoveredAt = time.Now().UTC()
+
+	details := &discovery.LambdaDetails{}
+	s.Details.Lambda = details
+
+	if c := out.Configuration; c != nil {
+		s.Name = aws.ToString(c.FunctionName)
+		s.ARN = aws.ToString(c.FunctionArn)
+		s.AccountID = AccountFromARN(s.ARN)
+		if t, err := time.Parse(lambdaTimeLayout, aws.ToString(c.LastModified)); err == nil {
+			t = t.UTC()
+			s.LastModified = &t
+		}
+
+		details.Runtime = string(c.Runtime)
+		details.Handler = aws.ToString(c.Handler)
+		details.Role = aws.ToString(c.Role)
+		details.Description = aws.ToString(c.Description)
+		details.MemorySize = aws.ToInt32(c.MemorySize)
+		details.Timeout = aws.ToInt32(c.Timeout)
+		details.PackageType = string(c.PackageType)
+		// Functions run on a single architecture, x86_64 unless set.
+		details.Architecture = string(lambdatypes.ArchitectureX8664)
+		if len(c.Architectures) > 0 {
+			details.Architecture = string(c.Architectures[0])
+		}
+		if s := c.SnapStart; s != nil {
+			details.SnapStart = &discovery.SnapStart{ApplyOn: string(s.ApplyOn), OptimizationStatus: string(s.OptimizationStatus)}
+		}
+		if d := c.DeadLetterConfig; d != nil {
+			details.DeadLetterTarget = aws.ToString(d.TargetArn)
+		}
+		if e := c.Environment; e != nil {
+			for k := range e.Variables {
+				details.EnvironmentKeys = append(details.EnvironmentKeys, k)
+			}
+			slices.Sort(details.EnvironmentKeys)
+		}
+		details.Code.SHA256 = aws.ToString(c.CodeSha256)
+		details.Code.Size = c.CodeSize
+		for _, l := range c.Layers {
+			details.Layers = append(details.Layers, discovery.LambdaLayer{ARN: aws.ToString(l.Arn), CodeSize: l.CodeSize})
+		}
+		if v := c.VpcConfig; v != nil && aws.ToString(v.VpcId) != "" {
+			details.VPC = &discovery.VPCConfig{
+				VPCID:            aws.ToString(v.VpcId),
+				SubnetIDs:        v.SubnetIds,
+				SecurityGroupIDs: v.SecurityGroupIds,
+			}
+		}
+	}
+
+	if c := out.Code; c != nil {
+		details.Code.RepositoryType = aws.ToString(c.RepositoryType)
+		details.Code.Location = aws.ToString(c.Location)
+		details.Code.ImageURI = aws.ToString(c.ImageUri)
+		details.Code.ResolvedImageURI = aws.ToString(c.ResolvedImageUri)
+	}
+
+	if c := out.Concurrency; c != nil && c.ReservedConcurrentExecutions != nil {
+		reserved := *c.ReservedConcurrentExecutions
+		details.ReservedConcurrency = &reserved
+	}
+
+	if len(out.Tags) > 0 {
+		s.Tags = make(map[string]string, len(out.Tags))
+		for k, v := range out.Tags {
+			s.Tags[k] = v
+		}
+	}
+}
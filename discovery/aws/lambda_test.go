@@ -0,0 +1,358 @@
+package awscmd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/aws/awsfake"
+)
+
+// newLambda returns a fake with n functions fn-000, fn-001, ….
+func newLambda(n int) *awsfake.Lambda {
+	fake := awsfake.NewLambda()
+	for i := 0; i < n; i++ {
+		fake.AddFunction(lambdatypes.FunctionConfiguration{FunctionName: aws.String(fmt.Sprintf("fn-%03d", i)), Runtime: lambdatypes.RuntimePython312})
+	}
+	return fake
+}
+
+// catalog runs the Lambda cataloger of fake and splits what it emitted into
+// services and scan errors.
+func catalog(ctx context.Context, fake *awsfake.Lambda, emit func(discovery.Result)) ([]discovery.Service, []*discovery.ScanError, error) {
+	var services []discovery.Service
+	var skipped []*discovery.ScanError
+	err := awscmd.NewLambdaCataloger(fake, "us-east-1").Catalog(ctx, func(r discovery.Result) error {
+		if emit != nil {
+			emit(r)
+		}
+		var scanErr *discovery.ScanError
+		switch {
+		case errors.As(r.Err, &scanErr):
+			skipped = append(skipped, scanErr)
+		case r.Err != nil:
+			return r.Err
+		default:
+			services = append(services, r.Service)
+		}
+		return nil
+	})
+	return services, skipped, err
+}
+
+func TestLambdaPaging(t *testing.T) {
+	tests := []struct {
+		functions, pageSize, pages int
+	}{
+		{functions: 0, pageSize: 50, pages: 1},
+		{functions: 1, pageSize: 50, pages: 1},
+		{functions: 50, pageSize: 50, pages: 1},
+		{functions: 51, pageSize: 50, pages: 2},
+		{functions: 7, pageSize: 2, pages: 4},
+		{functions: 100, pageSize: 1, pages: 100},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d by %d", tt.functions, tt.pageSize), func(t *testing.T) {
+			fake := newLambda(tt.functions)
+			fake.PageSize = tt.pageSize
+
+			services, skipped, err := catalog(context.Background(), fake, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(skipped) > 0 {
+				t.Errorf("skipped %v", skipped)
+			}
+			if len(services) != tt.functions {
+				t.Errorf("got %d functions, want %d", len(services), tt.functions)
+			}
+			seen := map[string]bool{}
+			for _, s := range services {
+				if seen[s.Name] {
+					t.Errorf("%s reported twice", s.Name)
+				}
+				seen[s.Name] = true
+				if s.ResourceType != discovery.ResourceTypeLambdaFunction {
+					t.Errorf("%s has type %s", s.Name, s.ResourceType)
+				}
+			}
+			if got := fake.Calls("ListFunctions"); got != tt.pages {
+				t.Errorf("ListFunctions called %d times, want %d", got, tt.pages)
+			}
+		})
+	}
+}
+
+func TestLambdaGetFunctionErrors(t *testing.T) {
+	defer func(workers int) { awscmd.Workers = workers }(awscmd.Workers)
+
+	tests := []struct {
+		name    string
+		workers int
+		setup   func(*awsfake.Lambda)
+		// skippedResources are the functions reported as skipped;
+		// deniedDetail is whether GetFunction is reported as denied.
+		skippedResources []string
+		deniedDetail     bool
+		// maxGetCalls bounds the GetFunction calls of the 20 functions.
+		maxGetCalls int
+	}{
+		{
+			name:        "allowed",
+			workers:     8,
+			setup:       func(*awsfake.Lambda) {},
+			maxGetCalls: 20,
+		},
+		{
+			name:         "denied",
+			workers:      1,
+			setup:        func(l *awsfake.Lambda) { l.GetErr = awsfake.AccessDenied() },
+			deniedDetail: true,
+			maxGetCalls:  1,
+		},
+		{
+			name:         "denied concurrently",
+			workers:      8,
+			setup:        func(l *awsfake.Lambda) { l.GetErr = awsfake.AccessDenied() },
+			deniedDetail: true,
+			maxGetCalls:  20,
+		},
+		{
+			name:         "denied for one function",
+			workers:      1,
+			setup:        func(l *awsfake.Lambda) { l.FailFunction("fn-000", awsfake.AccessDenied()) },
+			deniedDetail: true,
+			maxGetCalls:  1,
+		},
+		{
+			name:    "failing for one function",
+			workers: 8,
+			setup: func(l *awsfake.Lambda) {
+				l.FailFunction("fn-003", awsfake.APIError("ServiceException", "internal error"))
+			},
+			skippedResources: []string{"fn-003"},
+			maxGetCalls:      20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			awscmd.Workers = tt.workers
+			fake := newLambda(20)
+			tt.setup(fake)
+
+			services, skipped, err := catalog(context.Background(), fake, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := 20 - len(tt.skippedResources); len(services) != want {
+				t.Errorf("got %d functions, want %d", len(services), want)
+			}
+			var resources []string
+			denied := 0
+			for _, e := range skipped {
+				switch {
+				case e.Resource != "":
+					resources = append(resources, e.Resource)
+				case e.Detail == "lambda:GetFunction":
+					denied++
+				case e.Detail != "":
+					// FailFunction fails the function's other details too.
+				default:
+					t.Errorf("unexpected %v", e)
+				}
+			}
+			if fmt.Sprint(resources) != fmt.Sprint(tt.skippedResources) {
+				t.Errorf("skipped %v, want %v", resources, tt.skippedResources)
+			}
+			want := 0
+			if tt.deniedDetail {
+				want = 1
+			}
+			if denied != want {
+				t.Errorf("GetFunction denial reported %d times, want %d", denied, want)
+			}
+			if got := fake.Calls("GetFunction"); got > tt.maxGetCalls {
+				t.Errorf("GetFunction called %d times, want at most %d", got, tt.maxGetCalls)
+			}
+		})
+	}
+}
+
+func TestLambdaCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		// after is the number of functions emitted before cancelling, or
+		// -1 to cancel before cataloging.
+		after   int
+		ordered bool
+	}{
+		{name: "before", after: -1},
+		{name: "after first", after: 1},
+		{name: "after first ordered", after: 1, ordered: true},
+		{name: "midway", after: 100},
+	}
+	defer func(ordered bool) { awscmd.OrderedResults = ordered }(awscmd.OrderedResults)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			awscmd.OrderedResults = tt.ordered
+			fake := newLambda(500)
+			fake.PageSize = 10
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.after < 0 {
+				cancel()
+			}
+
+			emitted := 0
+			services, _, err := catalog(ctx, fake, func(discovery.Result) {
+				emitted++
+				if emitted == tt.after {
+					cancel()
+				}
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("got %v, want %v", err, context.Canceled)
+			}
+			if len(services) >= 500 {
+				t.Errorf("all %d functions reported after cancelling", len(services))
+			}
+			// Listing stops with the cataloger: at most the functions in
+			// flight are listed past the cancelled one.
+			if pages := fake.Calls("ListFunctions"); pages*10 > max(tt.after, 0)+awscmd.Workers*4+20 {
+				t.Errorf("ListFunctions called %d times after cancelling", pages)
+			}
+		})
+	}
+}
+
+func TestLambdaUsage(t *testing.T) {
+	tests := []struct {
+		name      string
+		functions int
+		err       error
+	}{
+		{name: "one batch", functions: 20},
+		{name: "several batches", functions: 1200},
+		{name: "denied", functions: 1200, err: awsfake.AccessDenied()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newLambda(tt.functions)
+			cloudwatch := awsfake.NewCloudWatch()
+			cloudwatch.Err = tt.err
+			for i := 0; i < tt.functions; i++ {
+				cloudwatch.AddValues("AWS/Lambda", "Invocations", "FunctionName", fmt.Sprintf("fn-%03d", i), float64(i), 1)
+			}
+			p := &awscmd.Provider{
+				RoleARN:              testRoleARN,
+				IDToken:              "token",
+				Clients:              &awsfake.Clients{LambdaClient: fake, CloudWatchClient: cloudwatch},
+				SkipRolePolicies:     true,
+				SkipResourcePolicies: true,
+				UsageWindow:          7 * 24 * time.Hour,
+			}
+			catalogers, err := p.Catalogers(context.Background(), "us-east-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			described := -1
+			var services []discovery.Service
+			var skipped []string
+			err = catalogers[0].Catalog(context.Background(), func(r discovery.Result) error {
+				if described < 0 {
+					described = fake.Calls("GetFunction")
+				}
+				var scanErr *discovery.ScanError
+				if errors.As(r.Err, &scanErr) {
+					skipped = append(skipped, scanErr.Detail)
+				} else if r.Err == nil {
+					services = append(services, r.Service)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(services) != tt.functions {
+				t.Errorf("got %d functions, want %d", len(services), tt.functions)
+			}
+			// Functions are emitted once their batch's usage is read, not
+			// once the region's last function is described.
+			if described >= tt.functions && tt.functions > 500 {
+				t.Errorf("first function emitted after describing all %d", described)
+			}
+			for _, s := range services {
+				u := s.Details.Lambda.Usage
+				var i int64
+				fmt.Sscanf(s.Name, "fn-%d", &i)
+				switch {
+				case tt.err != nil && u != nil:
+					t.Errorf("%s has usage although CloudWatch fails", s.Name)
+				case tt.err == nil && (u == nil || u.Invocations != i+1):
+					t.Errorf("%s has usage %+v, want %d invocations", s.Name, u, i+1)
+				}
+			}
+			want := 0
+			if tt.err != nil {
+				want = 1
+			}
+			if got := len(skipped); got != want || got == 1 && skipped[0] != "cloudwatch:GetMetricData" {
+				t.Errorf("skipped %v, want %d cloudwatch:GetMetricData", skipped, want)
+			}
+		})
+	}
+}
+
+func TestFunctionCode(t *testing.T) {
+	const memberARN = "arn:aws:lambda:eu-west-1:111111111111:function:orders"
+	tests := []struct {
+		name string
+		// arn is the ARN of the fake's function named orders.
+		arn string
+		err bool
+	}{
+		{name: "in the member account", arn: memberARN},
+		// A function of the same name in the hub's account is not the
+		// member's.
+		{name: "named alike in the hub account", arn: "arn:aws:lambda:eu-west-1:123456789012:function:orders", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := awsfake.NewLambda()
+			fake.AddFunctionOutput(&lambda.GetFunctionOutput{
+				Configuration: &lambdatypes.FunctionConfiguration{FunctionName: aws.String("orders"), FunctionArn: aws.String(tt.arn)},
+				Code:          &lambdatypes.FunctionCodeLocation{Location: aws.String("https://code.example.com/orders.zip")},
+			})
+			stsClient := &awsfake.STS{}
+			hub := &awscmd.Provider{RoleARN: testRoleARN, IDToken: "token", Clients: &awsfake.Clients{STSClient: stsClient, LambdaClient: fake}}
+			member := hub.Member(awscmd.Account{ID: "111111111111"}, hub.MemberRoleARN("111111111111", "discovery"), "")
+
+			code, err := member.FunctionCode(context.Background(), memberARN)
+			if tt.err {
+				if err == nil {
+					t.Errorf("got %+v, want an error", code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code.Location != "https://code.example.com/orders.zip" {
+				t.Errorf("got location %q", code.Location)
+			}
+			calls := stsClient.RoleCalls()
+			if len(calls) != 1 || *calls[0].RoleArn != "arn:aws:iam::111111111111:role/discovery" {
+				t.Errorf("assumed %+v, want the member role", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package awscmd
+
+import (
+	"context"
+	"sync"
+)
+
+// memo calls a function once per key and shares its result with concurrent
+// and later callers, e.g. to read each IAM role once per run. Results of
+// calls whose context ended are forgotten, so a later run tries again. It
+// is safe for concurrent use.
+type memo[T any] struct {
+	mu      sync.Mutex
+	entries map[string]*memoEntry[T]
+}
+
+type memoEntry[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// get returns the result of fn for key, calling it unless another call
+// already has.
+func (m *memo[T]) get(ctx context.Context, key string, fn func() (T, error)) (T, error) {
+	m.mu.Lock()
+	if m.entries == nil {
+		m.entries = map[string]*memoEntry[T]{}
+	}
+	e, ok := m.entries[key]
+	if !ok {
+		e = &memoEntry[T]{done: make(chan struct{})}
+		m.entries[key] = e
+	}
+	m.mu.Unlock()
+
+	if ok {
+		select {
+		case <-e.done:
+			return e.value, e.err
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+
+	e.value, e.err = fn()
+	if ctx.Err() != nil {
+		m.mu.Lock()
+		delete(m.entries, key)
+		m.mu.Unlock()
+	}
+	close(e.done)
+	return e.value, e.err
+}
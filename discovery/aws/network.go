@@ -0,0 +1,260 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// maxFilterValues is the most values EC2 accepts in one filter.
+const maxFilterValues = 200
+
+// NetworkRelationships returns a network relationship for every way the
+// services in region can reach each other, or other security groups, at the
+// network layer: from each service to every service in the same VPC whose
+// security groups admit traffic from one of its own, or to the security
+// group itself when no service given has it. Via lists the ports admitted.
+// Only services connected to a VPC take part.
+func (p *Provider) NetworkRelationships(ctx context.Context, region string, services []discovery.Service) ([]discovery.Relationship, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return networkRelationships(ctx, clients.ec2, region, services)
+}
+
+// networkMember is a service's place in a VPC.
+type networkMember struct {
+	arn string
+	typ discovery.ResourceType
+	vpc string
+}
+
+func networkRelationships(ctx context.Context, client EC2API, region string, services []discovery.Service) ([]discovery.Relationship, error) {
+	var members []networkMember
+	byGroup := map[string][]int{}
+	for _, s := range services {
+		v := vpcOf(s)
+		if s.Region != region || v == nil || len(v.SecurityGroupIDs) == 0 {
+			continue
+		}
+		for _, g := range v.SecurityGroupIDs {
+			byGroup[g] = append(byGroup[g], len(members))
+		}
+		members = append(members, networkMember{arn: s.Key(), typ: s.ResourceType, vpc: v.VPCID})
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	// Only groups with rules naming a member's group can admit a member.
+	ids := make([]string, 0, len(byGroup))
+	for g := range byGroup {
+		ids = append(ids, g)
+	}
+	sort.Strings(ids)
+	var groups []ec2types.SecurityGroup
+	for start := 0; start < len(ids); start += maxFilterValues {
+		chunk := ids[start:min(start+maxFilterValues, len(ids))]
+		p := ec2.NewDescribeSecurityGroupsPaginator(client, &ec2.DescribeSecurityGroupsInput{
+			Filters: []ec2types.Filter{{Name: aws.String("ip-permission.group-id"), Values: chunk}},
+		})
+		for g, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedSecurityGroups) {
+			if err != nil {
+				return nil, fmt.Errorf("describing security groups: %w", err)
+			}
+			groups = append(groups, g)
+		}
+	}
+
+	type pair struct{ from, to string }
+	ports := map[pair]map[string]bool{}
+	rels := map[pair]discovery.Relationship{}
+	seen := map[string]bool{}
+	for _, g := range groups {
+		id := aws.ToString(g.GroupId)
+		// The same group can match several filter chunks.
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		vpc := aws.ToString(g.VpcId)
+		for _, perm := range g.IpPermissions {
+			for _, source := range perm.UserIdGroupPairs {
+				peered := aws.ToString(source.VpcPeeringConnectionId) != ""
+				for _, i := range byGroup[aws.ToString(source.GroupId)] {
+					from := members[i]
+					if from.vpc != vpc && !peered {
+						continue
+					}
+					var targets []discovery.Relationship
+					for _, j := range byGroup[id] {
+						if to := members[j]; to.arn != from.arn {
+							targets = append(targets, discovery.Relationship{Target: to.arn, TargetType: to.typ})
+						}
+					}
+					if _, ok := byGroup[id]; !ok {
+						arn := "arn:aws:ec2:" + region + ":" + aws.ToString(g.OwnerId) + ":security-group/" + id
+						targets = append(targets, discovery.Relationship{Target: arn, TargetType: discovery.ResourceTypeSecurityGroup})
+					}
+					for _, t := range targets {
+						k := pair{from.arn, t.Target}
+						if _, ok := rels[k]; !ok {
+							t.From, t.FromType, t.Relation = from.arn, from.typ, discovery.RelationNetwork
+							rels[k] = t
+							ports[k] = map[string]bool{}
+						}
+						ports[k][portRange(perm)] = true
+					}
+				}
+			}
+		}
+	}
+
+	out := make([]discovery.Relationship, 0, len(rels))
+	for k, r := range rels {
+		r.Via = strings.Join(sortedKeys(ports[k]), ", ")
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].From != out[j].From {
+			return out[i].From < out[j].From
+		}
+		return out[i].Target < out[j].Target
+	})
+	return out, nil
+}
+
+func listedSecurityGroups(page *ec2.DescribeSecurityGroupsOutput) []ec2types.SecurityGroup {
+	return page.SecurityGroups
+}
+
+// vpcOf returns where in a VPC s is, if it is connected to one.
+func vpcOf(s discovery.Service) *discovery.VPCConfig {
+	if l := s.Details.Lambda; l != nil {
+		return l.VPC
+	}
+	return nil
+}
+
+// portRange describes the traffic perm admits, e.g. "tcp/5432",
+// "udp/1024-2048" or "all".
+func portRange(perm ec2types.IpPermission) string {
+	protocol := strings.ToLower(aws.ToString(perm.IpProtocol))
+	switch protocol {
+	case "6":
+		protocol = "tcp"
+	case "17":
+		protocol = "udp"
+	case "-1":
+		return "all"
+	}
+	if protocol != "tcp" && protocol != "udp" {
+		return protocol
+	}
+	from, to := aws.ToInt32(perm.FromPort), aws.ToInt32(perm.ToPort)
+	if from == to {
+		return protocol + "/" + strconv.Itoa(int(from))
+	}
+	return protocol + "/" + strconv.Itoa(int(from)) + "-" + strconv.Itoa(int(to))
+}
+
+// Subnet is a VPC subnet with the network interfaces Lambda created in it.
+type Subnet struct {
+	ID               string `json:"id"`
+	VPCID            string `json:"vpcId"`
+	AvailabilityZone string `json:"availabilityZone"`
+	CIDR             string `json:"cidr"`
+	// AvailableIPs is the number of free IPv4 addresses.
+	AvailableIPs int32 `json:"availableIps"`
+	// Interfaces are Lambda's Hyperplane network interfaces in the subnet,
+	// one for every set of security groups functions use it with.
+	Interfaces []NetworkInterface `json:"interfaces"`
+}
+
+// NetworkInterface is a network interface Lambda created.
+type NetworkInterface struct {
+	ID string `json:"id"`
+	// SecurityGroupIDs are sorted.
+	SecurityGroupIDs []string `json:"securityGroupIds"`
+	Status           string   `json:"status"`
+}
+
+// Subnets returns the subnets ids in region, sorted by ID, with Lambda's
+// network interfaces in each.
+func (p *Provider) Subnets(ctx context.Context, region string, ids []string) ([]Subnet, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return subnets(ctx, clients.ec2, ids)
+}
+
+func subnets(ctx context.Context, client EC2API, ids []string) ([]Subnet, error) {
+	byID := map[string]*Subnet{}
+	for start := 0; start < len(ids); start += maxFilterValues {
+		chunk := ids[start:min(start+maxFilterValues, len(ids))]
+		p := ec2.NewDescribeSubnetsPaginator(client, &ec2.DescribeSubnetsInput{
+			Filters: []ec2types.Filter{{Name: aws.String("subnet-id"), Values: chunk}},
+		})
+		for s, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedSubnets) {
+			if err != nil {
+				return nil, fmt.Errorf("describing subnets: %w", err)
+			}
+			byID[aws.ToString(s.SubnetId)] = &Subnet{
+				ID:               aws.ToString(s.SubnetId),
+				VPCID:            aws.ToString(s.VpcId),
+				AvailabilityZone: aws.ToString(s.AvailabilityZone),
+				CIDR:             aws.ToString(s.CidrBlock),
+				AvailableIPs:     aws.ToInt32(s.AvailableIpAddressCount),
+				Interfaces:       []NetworkInterface{},
+			}
+		}
+
+		q := ec2.NewDescribeNetworkInterfacesPaginator(client, &ec2.DescribeNetworkInterfacesInput{
+			Filters: []ec2types.Filter{
+				{Name: aws.String("interface-type"), Values: []string{string(ec2types.NetworkInterfaceTypeLambda)}},
+				{Name: aws.String("subnet-id"), Values: chunk},
+			},
+		})
+		for ni, err := range paginate(ctx, q.HasMorePages, q.NextPage, listedNetworkInterfaces) {
+			if err != nil {
+				return nil, fmt.Errorf("describing network interfaces: %w", err)
+			}
+			subnet, ok := byID[aws.ToString(ni.SubnetId)]
+			if !ok {
+				continue
+			}
+			iface := NetworkInterface{ID: aws.ToString(ni.NetworkInterfaceId), Status: string(ni.Status), SecurityGroupIDs: []string{}}
+			for _, g := range ni.Groups {
+				iface.SecurityGroupIDs = append(iface.SecurityGroupIDs, aws.ToString(g.GroupId))
+			}
+			sort.Strings(iface.SecurityGroupIDs)
+			subnet.Interfaces = append(subnet.Interfaces, iface)
+		}
+	}
+
+	out := make([]Subnet, 0, len(byID))
+	for _, s := range byID {
+		sort.Slice(s.Interfaces, func(i, j int) bool { return s.Interfaces[i].ID < s.Interfaces[j].ID })
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func listedSubnets(page *ec2.DescribeSubnetsOutput) []ec2types.Subnet {
+	return page.Subnets
+}
+
+func listedNetworkInterfaces(page *ec2.DescribeNetworkInterfacesOutput) []ec2types.NetworkInterface {
+	return page.NetworkInterfaces
+}
@@ -0,0 +1,220 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// DefaultOrganizationRole is the role assumed in the member accounts of an
+// organization unless another is configured.
+const DefaultOrganizationRole = "OrganizationDiscoveryRole"
+
+// organizationsRegion is where Organizations is called; it is a global
+// service served from us-east-1.
+const organizationsRegion = "us-east-1"
+
+// Account is a member account of an organization.
+type Account struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+	// OrganizationalUnit is the name of the organizational unit directly
+	// holding the account, set by OrganizationalUnits; accounts at the
+	// root of the organization have none.
+	OrganizationalUnit string `json:"organizationalUnit,omitempty"`
+}
+
+// OrganizationAccounts returns the active accounts of the organization
+// RoleARN belongs to, sorted by ID. RoleARN must be in the management
+// account or one delegated to administer the organization.
+func (p *Provider) OrganizationAccounts(ctx context.Context) ([]Account, error) {
+	clients, err := p.clients(ctx, organizationsRegion)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []Account
+	pages := organizations.NewListAccountsPaginator(clients.organizations, &organizations.ListAccountsInput{})
+	for a, err := range paginate(ctx, pages.HasMorePages, pages.NextPage, listedAccounts) {
+		if err != nil {
+			return nil, fmt.Errorf("listing organization accounts: %w", err)
+		}
+		if a.Status != orgtypes.AccountStatusActive {
+			continue
+		}
+		accounts = append(accounts, Account{ID: aws.ToString(a.Id), Name: aws.ToString(a.Name), Email: aws.ToString(a.Email)})
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts, nil
+}
+
+func listedAccounts(page *organizations.ListAccountsOutput) []orgtypes.Account {
+	return page.Accounts
+}
+
+// OrganizationalUnits sets the organizational unit of each of accounts,
+// describing each unit once. It stops at the first error, leaving the rest
+// unset.
+func (p *Provider) OrganizationalUnits(ctx context.Context, accounts []Account) error {
+	clients, err := p.clients(ctx, organizationsRegion)
+	if err != nil {
+		return err
+	}
+	names := map[string]string{}
+	for i, a := range accounts {
+		var parents []orgtypes.Parent
+		pages := organizations.NewListParentsPaginator(clients.organizations, &organizations.ListParentsInput{ChildId: aws.String(a.ID)})
+		for parent, err := range paginate(ctx, pages.HasMorePages, pages.NextPage, listedParents) {
+			if err != nil {
+				return fmt.Errorf("listing parents of account %s: %w", a.ID, err)
+			}
+			parents = append(parents, parent)
+		}
+		if len(parents) == 0 || parents[0].Type != orgtypes.ParentTypeOrganizationalUnit {
+			continue
+		}
+		id := aws.ToString(parents[0].Id)
+		name, ok := names[id]
+		if !ok {
+			reqCtx, cancel := requestContext(ctx)
+			out, err := clients.organizations.DescribeOrganizationalUnit(reqCtx, &organizations.DescribeOrganizationalUnitInput{OrganizationalUnitId: aws.String(id)})
+			cancel()
+			if err != nil {
+				return fmt.Errorf("describing organizational unit %s: %w", id, err)
+			}
+			if out.OrganizationalUnit != nil {
+				name = aws.ToString(out.OrganizationalUnit.Name)
+			}
+			names[id] = name
+		}
+		accounts[i].OrganizationalUnit = name
+	}
+	return nil
+}
+
+func listedParents(page *organizations.ListParentsOutput) []orgtypes.Parent {
+	return page.Parents
+}
+
+// MemberRoleARN returns the ARN of roleName in account, in the partition of
+// RoleARN. roleName may include a path, e.g.
+// "discovery/OrganizationDiscoveryRole".
+func (p *Provider) MemberRoleARN(account, roleName string) string {
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", p.partition(), account, strings.Trim(roleName, "/"))
+}
+
+// partition returns the partition of RoleARN, "aws" when it has none.
+func (p *Provider) partition() string {
+	return Partition(p.RoleARN)
+}
+
+// Member returns a provider scanning account by assuming roleARN there with
+// p's credentials, presenting externalID unless it is empty. It has p's
+// settings and the account's name and organizational unit.
+func (p *Provider) Member(account Account, roleARN, externalID string) *Provider {
+	return &Provider{
+		RoleARN:              roleARN,
+		SessionName:          p.SessionName,
+		Source:               p,
+		ExternalID:           externalID,
+		AccountName:          account.Name,
+		OrganizationalUnit:   account.OrganizationalUnit,
+		Clients:              p.Clients,
+		SkipRolePolicies:     p.SkipRolePolicies,
+		SkipResourcePolicies: p.SkipResourcePolicies,
+		CodeDependencies:     p.CodeDependencies,
+		UsageWindow:          p.UsageWindow,
+	}
+}
+
+// DelegatedAdministratorCataloger discovers the accounts of an organization
+// that organization-wide services, such as GuardDuty or Config, are
+// delegated to, with the services delegated to each.
+type DelegatedAdministratorCataloger struct {
+	client    OrganizationsAPI
+	region    string
+	partition string
+}
+
+// NewDelegatedAdministratorCataloger returns a cataloger listing the
+// delegated administrators of the organization with client. Organizations
+// is not regional; the accounts are reported in region, the one scanned to
+// find them.
+func NewDelegatedAdministratorCataloger(client OrganizationsAPI, region, partition string) *DelegatedAdministratorCataloger {
+	return &DelegatedAdministratorCataloger{client: client, region: region, partition: partition}
+}
+
+func (c *DelegatedAdministratorCataloger) Name() string {
+	return "organizations"
+}
+
+func (c *DelegatedAdministratorCataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	var admins []orgtypes.DelegatedAdministrator
+	pages := organizations.NewListDelegatedAdministratorsPaginator(c.client, &organizations.ListDelegatedAdministratorsInput{})
+	for a, err := range paginate(ctx, pages.HasMorePages, pages.NextPage, listedDelegatedAdministrators) {
+		if err != nil {
+			return fmt.Errorf("listing delegated administrators: %w", err)
+		}
+		admins = append(admins, a)
+	}
+	for _, a := range admins {
+		id := aws.ToString(a.Id)
+		var result discovery.Result
+		s := &result.Service
+		s.Provider = "aws"
+		s.Region = c.region
+		s.AccountID = id
+		s.AccountAlias = aws.ToString(a.Name)
+		s.ResourceType = discovery.ResourceTypeAccount
+		s.ARN = fmt.Sprintf("arn:%s:iam::%s:root", c.partition, id)
+		s.Name = id
+		if s.AccountAlias != "" {
+			s.Name = s.AccountAlias
+		}
+		s.DiscoveredAt = time.Now().UTC()
+		if a.DelegationEnabledDate != nil {
+			enabled := a.DelegationEnabledDate.UTC()
+			s.LastModified = &enabled
+		}
+		account := &discovery.AccountDetails{Email: aws.ToString(a.Email), DelegatedServices: []discovery.DelegatedService{}}
+		pages := organizations.NewListDelegatedServicesForAccountPaginator(c.client, &organizations.ListDelegatedServicesForAccountInput{AccountId: a.Id})
+		for d, err := range paginate(ctx, pages.HasMorePages, pages.NextPage, listedDelegatedServices) {
+			if err != nil {
+				result = discovery.SkipResource(s.Name, fmt.Errorf("listing the services delegated to account %s: %w", id, err))
+				break
+			}
+			service := discovery.DelegatedService{ServicePrincipal: aws.ToString(d.ServicePrincipal)}
+			if d.DelegationEnabledDate != nil {
+				enabled := d.DelegationEnabledDate.UTC()
+				service.DelegatedAt = &enabled
+			}
+			account.DelegatedServices = append(account.DelegatedServices, service)
+		}
+		if result.Err == nil {
+			sort.Slice(account.DelegatedServices, func(i, j int) bool {
+				return account.DelegatedServices[i].ServicePrincipal < account.DelegatedServices[j].ServicePrincipal
+			})
+			s.Details.Account = account
+		}
+		if err := emit(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listedDelegatedAdministrators(page *organizations.ListDelegatedAdministratorsOutput) []orgtypes.DelegatedAdministrator {
+	return page.DelegatedAdministrators
+}
+
+func listedDelegatedServices(page *organizations.ListDelegatedServicesForAccountOutput) []orgtypes.DelegatedService {
+	return page.DelegatedServices
+}
@@ -0,0 +1,73 @@
+package awscmd
+
+import (
+	"context"
+	"iter"
+)
+
+// paginate iterates over the items on every page of an SDK paginator, given
+// its HasMorePages and NextPage methods and a function picking the items out
+// of a page:
+//
+//	p := lambda.NewListFunctionsPaginator(client, &lambda.ListFunctionsInput{})
+//	for fn, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedFunctions) {
+//
+// Each page request is bounded by RequestTimeout. A failed page ends the
+// iteration with its error.
+func paginate[Page, Item, Options any](
+	ctx context.Context,
+	hasMorePages func() bool,
+	nextPage func(context.Context, ...func(*Options)) (Page, error),
+	items func(Page) []Item,
+) iter.Seq2[Item, error] {
+	return func(yield func(Item, error) bool) {
+		for hasMorePages() {
+			pageCtx, cancel := requestContext(ctx)
+			page, err := nextPage(pageCtx)
+			cancel()
+			if err != nil {
+				var zero Item
+				yield(zero, err)
+				return
+			}
+			for _, item := range items(page) {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// tokenPages iterates over the items on every page of an API that takes and
+// returns a NextToken but has no SDK paginator, given a function requesting
+// the page after token and functions picking the items and the next token
+// out of a page. Each request is bounded by RequestTimeout.
+func tokenPages[Page, Item any](
+	ctx context.Context,
+	page func(ctx context.Context, token *string) (Page, error),
+	items func(Page) []Item,
+	next func(Page) *string,
+) iter.Seq2[Item, error] {
+	return func(yield func(Item, error) bool) {
+		var token *string
+		for {
+			pageCtx, cancel := requestContext(ctx)
+			p, err := page(pageCtx, token)
+			cancel()
+			if err != nil {
+				var zero Item
+				yield(zero, err)
+				return
+			}
+			for _, item := range items(p) {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if token = next(p); token == nil || *token == "" {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package awscmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// policyDocument is an IAM policy document, as far as discovery reads one.
+type policyDocument struct {
+	Statement statements `json:"Statement"`
+}
+
+type policyStatement struct {
+	Sid          string          `json:"Sid"`
+	Effect       string          `json:"Effect"`
+	Principal    principal       `json:"Principal"`
+	NotPrincipal json.RawMessage `json:"NotPrincipal"`
+	Action       stringList      `json:"Action"`
+	NotAction    stringList      `json:"NotAction"`
+	Resource     stringList      `json:"Resource"`
+	NotResource  stringList      `json:"NotResource"`
+	Condition    json.RawMessage `json:"Condition"`
+}
+
+// principal is the Principal of a resource policy statement: "*" or a map
+// from principal type ("AWS", "Service", ...) to its values.
+type principal map[string]stringList
+
+func (p *principal) UnmarshalJSON(data []byte) error {
+	var everyone string
+	if err := json.Unmarshal(data, &everyone); err == nil {
+		*p = principal{"AWS": {everyone}}
+		return nil
+	}
+	return json.Unmarshal(data, (*map[string]stringList)(p))
+}
+
+// statements accepts a single statement object as well as a list of them.
+type statements []policyStatement
+
+func (s *statements) UnmarshalJSON(data []byte) error {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		var one policyStatement
+		if err := json.Unmarshal(data, &one); err != nil {
+			return err
+		}
+		*s = statements{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]policyStatement)(s))
+}
+
+// stringList accepts a single string as well as a list of them, as policy
+// elements such as Action and Resource do.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*l = stringList{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// parsePolicy decodes a policy document. IAM returns them URL-encoded,
+// other services as JSON.
+func parsePolicy(document string) (policyDocument, error) {
+	var doc policyDocument
+	if !strings.HasPrefix(strings.TrimSpace(document), "{") {
+		if decoded, err := url.PathUnescape(document); err == nil {
+			document = decoded
+		}
+	}
+	if err := json.Unmarshal([]byte(document), &doc); err != nil {
+		return doc, fmt.Errorf("parsing policy document: %w", err)
+	}
+	return doc, nil
+}
+
+// allows reports whether st grants actions on resources, rather than
+// denying them or granting everything except some.
+func (st policyStatement) allows() bool {
+	return strings.EqualFold(st.Effect, "Allow") && len(st.NotAction) == 0 && len(st.NotResource) == 0 && len(st.NotPrincipal) == 0
+}
+
+// conditional reports whether st only applies under a condition.
+func (st policyStatement) conditional() bool {
+	c := strings.TrimSpace(string(st.Condition))
+	return c != "" && c != "null" && c != "{}"
+}
+
+// conditions returns the values st's conditions give each key, by lower
+// case key (e.g. "aws:sourcearn"), whatever the operator.
+func (st policyStatement) conditions() map[string][]string {
+	var byOperator map[string]map[string]stringList
+	if !st.conditional() || json.Unmarshal(st.Condition, &byOperator) != nil {
+		return nil
+	}
+	keys := map[string][]string{}
+	for _, byKey := range byOperator {
+		for k, values := range byKey {
+			k = strings.ToLower(k)
+			keys[k] = append(keys[k], values...)
+		}
+	}
+	return keys
+}
+
+// hasWildcard reports whether s is a pattern rather than a name.
+func hasWildcard(s string) bool {
+	return strings.ContainsAny(s, "*?")
+}
@@ -0,0 +1,335 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Regions lists the AWS commercial regions discovery knows how to scan.
+var Regions = []string{
+	"us-east-1", "us-east-2", "us-west-1", "us-west-2",
+	"af-south-1",
+	"ap-east-1", "ap-south-1", "ap-south-2",
+	"ap-southeast-1", "ap-southeast-2", "ap-southeast-3", "ap-southeast-4", "ap-southeast-5", "ap-southeast-7",
+	"ap-northeast-1", "ap-northeast-2", "ap-northeast-3",
+	"ca-central-1", "ca-west-1",
+	"eu-central-1", "eu-central-2",
+	"eu-west-1", "eu-west-2", "eu-west-3",
+	"eu-south-1", "eu-south-2", "eu-north-1",
+	"il-central-1",
+	"me-south-1", "me-central-1",
+	"mx-central-1",
+	"sa-east-1",
+}
+
+// PartitionRegions lists the regions of the partitions other than the
+// commercial one, by partition.
+var PartitionRegions = map[string][]string{
+	"aws-cn":     {"cn-north-1", "cn-northwest-1"},
+	"aws-us-gov": {"us-gov-east-1", "us-gov-west-1"},
+}
+
+// KnownRegions returns the regions discovery knows of in partition, e.g.
+// aws-us-gov; those of any other than aws-cn and aws-us-gov are Regions.
+func KnownRegions(partition string) []string {
+	if regions, ok := PartitionRegions[partition]; ok {
+		return regions
+	}
+	return Regions
+}
+
+// OptInRegions are regions an account must explicitly enable. They are left
+// out of ALL and have to be requested by name.
+var OptInRegions = map[string]bool{
+	"af-south-1": true, "ap-east-1": true, "ap-south-2": true,
+	"ap-southeast-3": true, "ap-southeast-4": true, "ap-southeast-5": true, "ap-southeast-7": true,
+	"ca-west-1": true, "eu-central-2": true, "eu-south-1": true, "eu-south-2": true,
+	"il-central-1": true, "me-south-1": true, "me-central-1": true, "mx-central-1": true,
+}
+
+// DefaultRegions returns the regions ALL expands to in partition: every
+// known region that is enabled by default.
+func DefaultRegions(partition string) []string {
+	known := KnownRegions(partition)
+	regions := make([]string, 0, len(known))
+	for _, r := range known {
+		if !OptInRegions[r] {
+			regions = append(regions, r)
+		}
+	}
+	return regions
+}
+
+// Provider scans AWS by exchanging a web identity token for credentials of
+// RoleARN in each region, by assuming RoleARN with the credentials of
+// Source, or by using the ambient credentials directly when
+// AmbientCredentials is set. Credentials and clients are cached per region,
+// so repeated scans reuse them.
+type Provider struct {
+	RoleARN     string
+	SessionName string
+	// Source, when set, is the provider whose credentials assume RoleARN,
+	// as for the member accounts of an organization; see Member. IDToken
+	// and TokenFunc are then unused.
+	Source *Provider
+	// ExternalID is presented when assuming RoleARN with Source's
+	// credentials, for roles whose trust policy requires one.
+	ExternalID string
+	// AccountName is recorded as the alias of the account on every service
+	// discovered when the account has no IAM alias, e.g. its name in its
+	// organization.
+	AccountName string
+	// OrganizationalUnit, when set, is recorded on every service
+	// discovered.
+	OrganizationalUnit string
+	// DelegatedAdministratorsRegion, when set, has the scan of that region
+	// also discover the delegated administrators of RoleARN's
+	// organization; see DelegatedAdministratorCataloger.
+	DelegatedAdministratorsRegion string
+	// IDToken is the web identity token. When it is empty, TokenFunc is
+	// called the first time credentials are needed, so runs that never
+	// reach AWS (e.g. fully cached ones) do not have to log in.
+	IDToken   string
+	TokenFunc func(ctx context.Context) (string, error)
+	// AmbientCredentials uses the credentials of the default AWS chain,
+	// e.g. those of a Lambda function's execution role, instead of a web
+	// identity token. RoleARN must then be the role they belong to; it is
+	// not assumed, only used for the account and partition.
+	AmbientCredentials bool
+	// Clients builds the AWS clients; nil uses the AWS SDK.
+	Clients ClientFactory
+	// SkipRolePolicies stops discovery from reading the policies of
+	// execution roles, from which it infers what functions depend on.
+	SkipRolePolicies bool
+	// SkipResourcePolicies stops discovery from reading the resource
+	// policies of functions and event buses and of the queues, topics and
+	// buckets functions use, from which it infers what depends on them.
+	SkipResourcePolicies bool
+	// CodeDependencies downloads the package of every function to record
+	// the dependencies its manifests declare.
+	CodeDependencies bool
+	// UsageWindow, when set, records how much every function was used
+	// over that long before it was discovered, from CloudWatch.
+	UsageWindow time.Duration
+
+	mu       sync.Mutex
+	regions  map[string]*regionClients
+	roles    *rolePolicies
+	policies *resourcePolicies
+	// aliases holds the account's IAM alias, read once; aliasSkipped is
+	// set once failing to read it has been reported.
+	aliases      memo[string]
+	aliasSkipped atomic.Bool
+
+	tokenMu  sync.Mutex
+	tokenErr error
+}
+
+// regionClients holds the configuration and service clients for one region.
+type regionClients struct {
+	cfg            aws.Config
+	lambda         LambdaAPI
+	apigateway     APIGatewayAPI
+	apigatewayv2   APIGatewayV2API
+	sfn            SFNAPI
+	eventbridge    EventBridgeAPI
+	ec2            EC2API
+	elb            ELBAPI
+	route53        Route53API
+	cloudfront     CloudFrontAPI
+	iam            IAMAPI
+	sqs            SQSAPI
+	sns            SNSAPI
+	s3             S3API
+	xray           XRayAPI
+	cloudtrail     CloudTrailAPI
+	cloudwatch     CloudWatchAPI
+	costexplorer   CostExplorerAPI
+	cloudformation CloudFormationAPI
+	autoscaling    ApplicationAutoScalingAPI
+	ecr            ECRAPI
+	organizations  OrganizationsAPI
+}
+
+func (p *Provider) Name() string {
+	return "aws"
+}
+
+// ScanOptions describes the options that change what the provider
+// discovers, so cached results of other options are not replayed.
+func (p *Provider) ScanOptions() string {
+	return fmt.Sprintf("skip_role_policies=%t skip_resource_policies=%t code_dependencies=%t usage_window=%s account_name=%q organizational_unit=%q delegated_administrators_region=%q",
+		p.SkipRolePolicies, p.SkipResourcePolicies, p.CodeDependencies, p.UsageWindow, p.AccountName, p.OrganizationalUnit, p.DelegatedAdministratorsRegion)
+}
+
+// AccountID returns the account that owns RoleARN.
+func (p *Provider) AccountID() string {
+	return AccountFromARN(p.RoleARN)
+}
+
+// token returns the web identity token, calling TokenFunc at most once so a
+// failed login is not retried for every region.
+func (p *Provider) token(ctx context.Context) (string, error) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+	if p.IDToken != "" || p.TokenFunc == nil || p.tokenErr != nil {
+		return p.IDToken, p.tokenErr
+	}
+	p.IDToken, p.tokenErr = p.TokenFunc(ctx)
+	return p.IDToken, p.tokenErr
+}
+
+func (p *Provider) Catalogers(ctx context.Context, region string) ([]discovery.Cataloger, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+
+	lambda := &LambdaCataloger{client: clients.lambda, autoscaling: clients.autoscaling, ecr: clients.ecr, region: region, dependencies: p.CodeDependencies, usage: p.UsageWindow, cloudwatch: clients.cloudwatch}
+	if !p.SkipRolePolicies {
+		p.mu.Lock()
+		if p.roles == nil {
+			p.roles = &rolePolicies{}
+		}
+		lambda.iam, lambda.roles = clients.iam, p.roles
+		p.mu.Unlock()
+	}
+	if !p.SkipResourcePolicies {
+		p.mu.Lock()
+		if p.policies == nil {
+			p.policies = &resourcePolicies{}
+		}
+		lambda.policies = p.policies
+		lambda.policyClients = policyClients{region: region, account: p.AccountID(), sqs: clients.sqs, sns: clients.sns, s3: clients.s3}
+		p.mu.Unlock()
+	}
+	buses := NewEventBusCataloger(clients.eventbridge, region, p.AccountID())
+	buses.skipPolicy = p.SkipResourcePolicies
+	catalogers := []discovery.Cataloger{
+		lambda,
+		NewAPIGatewayCataloger(clients.apigateway, region, p.AccountID()),
+		NewAPIGatewayV2Cataloger(clients.apigatewayv2, region, p.AccountID()),
+		NewStateMachineCataloger(clients.sfn, region, p.AccountID()),
+		buses,
+	}
+	alias, err := p.accountAlias(ctx, clients.iam)
+	if err != nil && p.aliasSkipped.CompareAndSwap(false, true) {
+		catalogers[0] = &accountCataloger{Cataloger: catalogers[0], skipped: err}
+	}
+	if alias != "" || p.OrganizationalUnit != "" {
+		for i, c := range catalogers {
+			catalogers[i] = &accountCataloger{Cataloger: c, alias: alias, unit: p.OrganizationalUnit}
+		}
+	}
+	// Delegated administrators are other accounts, so they are not labeled
+	// with this one.
+	if region == p.DelegatedAdministratorsRegion {
+		catalogers = append(catalogers, NewDelegatedAdministratorCataloger(clients.organizations, region, p.partition()))
+	}
+	return catalogers, nil
+}
+
+// clients returns the cached clients for region, assuming the role there on
+// first use. Only successful assumptions are cached.
+func (p *Provider) clients(ctx context.Context, region string) (*regionClients, error) {
+	p.mu.Lock()
+	c, ok := p.regions[region]
+	p.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	factory := p.Clients
+	if factory == nil {
+		factory = sdkClients{}
+	}
+	cfg, err := p.assume(ctx, factory, region)
+	if err != nil {
+		return nil, err
+	}
+	if opt := rateLimitOption(p.AccountID()); opt != nil {
+		cfg.APIOptions = append(cfg.APIOptions, opt)
+	}
+	c = &regionClients{
+		cfg:            cfg,
+		lambda:         factory.Lambda(cfg),
+		apigateway:     factory.APIGateway(cfg),
+		apigatewayv2:   factory.APIGatewayV2(cfg),
+		sfn:            factory.SFN(cfg),
+		eventbridge:    factory.EventBridge(cfg),
+		ec2:            factory.EC2(cfg),
+		elb:            factory.ELB(cfg),
+		route53:        factory.Route53(cfg),
+		cloudfront:     factory.CloudFront(cfg),
+		iam:            factory.IAM(cfg),
+		sqs:            factory.SQS(cfg),
+		sns:            factory.SNS(cfg),
+		s3:             factory.S3(cfg),
+		xray:           factory.XRay(cfg),
+		cloudtrail:     factory.CloudTrail(cfg),
+		cloudwatch:     factory.CloudWatch(cfg),
+		costexplorer:   factory.CostExplorer(cfg),
+		cloudformation: factory.CloudFormation(cfg),
+		autoscaling:    factory.ApplicationAutoScaling(cfg),
+		ecr:            factory.ECR(cfg),
+		organizations:  factory.Organizations(cfg),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.regions == nil {
+		p.regions = map[string]*regionClients{}
+	}
+	// Another scan of the same region may have won the race; keep one.
+	if existing, ok := p.regions[region]; ok {
+		return existing, nil
+	}
+	p.regions[region] = c
+	return c, nil
+}
+
+// assume returns the configuration of RoleARN in region, assumed with the
+// credentials of Source or else the web identity token, or the ambient
+// configuration when the provider uses that.
+func (p *Provider) assume(ctx context.Context, factory ClientFactory, region string) (aws.Config, error) {
+	if p.AmbientCredentials {
+		cfg, err := LoadConfig(ctx, region)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		cfg.APIOptions = append(cfg.APIOptions, apiOptions()...)
+		return cfg, nil
+	}
+	if p.Source != nil {
+		source, err := p.Source.clients(ctx, region)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		cfg, err := assumeRole(ctx, factory.AssumedSTS(source.cfg), region, p.RoleARN, p.SessionName, p.ExternalID)
+		if err != nil {
+			// Only this account is lost; Source's own failures are not.
+			return aws.Config{}, &discovery.AccountError{Account: p.AccountID(), Err: fmt.Errorf("assuming role %s: %w", p.RoleARN, err)}
+		}
+		return cfg, nil
+	}
+	token, err := p.token(ctx)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("obtaining web identity token: %w", err)
+	}
+	stsClient, err := factory.STS(ctx, region)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("creating STS client: %w", err)
+	}
+	cfg, err := assumeWebIdentityRole(ctx, stsClient, region, token, p.RoleARN, p.SessionName)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("problem assuming web identity role: %w", err)
+	}
+	return cfg, nil
+}
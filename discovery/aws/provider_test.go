@@ -0,0 +1,89 @@
+package awscmd_test
+
+import (
+	"context"
+	"testing"
+
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/aws/awsfake"
+)
+
+const testRoleARN = "arn:aws:iam::123456789012:role/discovery"
+
+func TestProviderCachesClientsPerRegion(t *testing.T) {
+	tests := []struct {
+		name    string
+		regions []string
+		// failing are the regions, by index, scanned while STS fails.
+		failing map[int]bool
+		assumed int
+	}{
+		{name: "one region", regions: []string{"us-east-1"}, assumed: 1},
+		{name: "same region", regions: []string{"us-east-1", "us-east-1", "us-east-1"}, assumed: 1},
+		{name: "two regions", regions: []string{"us-east-1", "eu-west-1", "us-east-1", "eu-west-1"}, assumed: 2},
+		{name: "failure not cached", regions: []string{"us-east-1", "us-east-1", "us-east-1"}, failing: map[int]bool{0: true}, assumed: 2},
+		{name: "failures not cached", regions: []string{"us-east-1", "us-east-1", "eu-west-1", "us-east-1"}, failing: map[int]bool{0: true, 1: true}, assumed: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stsClient := &awsfake.STS{}
+			p := &awscmd.Provider{
+				RoleARN: testRoleARN,
+				IDToken: "token",
+				Clients: &awsfake.Clients{STSClient: stsClient},
+			}
+			for i, region := range tt.regions {
+				stsClient.Err = nil
+				if tt.failing[i] {
+					stsClient.Err = awsfake.AccessDenied()
+				}
+				catalogers, err := p.Catalogers(context.Background(), region)
+				if tt.failing[i] {
+					if err == nil {
+						t.Errorf("scan %d of %s: no error while STS fails", i, region)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("scan %d of %s: %v", i, region, err)
+				}
+				if len(catalogers) == 0 {
+					t.Errorf("scan %d of %s: no catalogers", i, region)
+				}
+			}
+			if got := len(stsClient.Calls()); got != tt.assumed {
+				t.Errorf("role assumed %d times, want %d", got, tt.assumed)
+			}
+			for _, in := range stsClient.Calls() {
+				if got := *in.RoleArn; got != testRoleARN {
+					t.Errorf("assumed %s, want %s", got, testRoleARN)
+				}
+			}
+		})
+	}
+}
+
+func TestProviderCachesSourceClients(t *testing.T) {
+	stsClient := &awsfake.STS{}
+	clients := &awsfake.Clients{STSClient: stsClient}
+	source := &awscmd.Provider{RoleARN: testRoleARN, IDToken: "token", Clients: clients}
+	members := []*awscmd.Provider{
+		{RoleARN: "arn:aws:iam::111111111111:role/discovery", Source: source, Clients: clients},
+		{RoleARN: "arn:aws:iam::222222222222:role/discovery", Source: source, Clients: clients},
+	}
+	for _, region := range []string{"us-east-1", "eu-west-1", "us-east-1"} {
+		for _, m := range members {
+			if _, err := m.Catalogers(context.Background(), region); err != nil {
+				t.Fatalf("%s in %s: %v", m.RoleARN, region, err)
+			}
+		}
+	}
+	// The source assumes its role once per region, and every member its
+	// own once per region.
+	if got := len(stsClient.Calls()); got != 2 {
+		t.Errorf("source role assumed %d times, want 2", got)
+	}
+	if got := len(stsClient.RoleCalls()); got != 4 {
+		t.Errorf("member roles assumed %d times, want 4", got)
+	}
+}
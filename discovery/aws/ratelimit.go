@@ -0,0 +1,111 @@
+package awscmd
+
+import (
+	"context"
+	"sync"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"golang.org/x/time/rate"
+)
+
+// RateLimit caps the AWS API requests per second made against one account
+// by every cataloger and region together. Zero means unlimited.
+var RateLimit float64
+
+// RateBurst is how many requests may be made at once before RateLimit
+// applies. Values below 1 allow a burst of one second's worth.
+var RateBurst int
+
+// AccountRateLimits replaces RateLimit for individual accounts, by account
+// ID, e.g. to scan member accounts running throttling-sensitive workloads
+// more gently.
+var AccountRateLimits map[string]float64
+
+// ServiceRateLimits additionally caps individual services, keyed by SDK
+// service ID (e.g. "Lambda", "EC2"), within the account-wide RateLimit.
+var ServiceRateLimits map[string]float64
+
+// accountLimiter holds the token buckets shared by all clients of one
+// account.
+type accountLimiter struct {
+	all *rate.Limiter
+
+	mu       sync.Mutex
+	services map[string]*rate.Limiter
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*accountLimiter{}
+)
+
+// limiterFor returns the shared limiter for account, or nil when no limits
+// are configured.
+func limiterFor(account string) *accountLimiter {
+	if RateLimit <= 0 && len(ServiceRateLimits) == 0 && len(AccountRateLimits) == 0 {
+		return nil
+	}
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[account]
+	if !ok {
+		limit := RateLimit
+		if accountLimit, ok := AccountRateLimits[account]; ok {
+			limit = accountLimit
+		}
+		l = &accountLimiter{all: newLimiter(limit), services: map[string]*rate.Limiter{}}
+		limiters[account] = l
+	}
+	return l
+}
+
+func newLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	burst := RateBurst
+	if burst < 1 {
+		burst = max(1, int(perSecond))
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), burst)
+}
+
+// wait blocks until service may make a request.
+func (l *accountLimiter) wait(ctx context.Context, service string) error {
+	if limit, ok := ServiceRateLimits[service]; ok {
+		l.mu.Lock()
+		sl, ok := l.services[service]
+		if !ok {
+			sl = newLimiter(limit)
+			l.services[service] = sl
+		}
+		l.mu.Unlock()
+		if err := sl.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return l.all.Wait(ctx)
+}
+
+// rateLimitOption returns the middleware that makes every attempt of a
+// client's API calls wait for account's limiter. It returns nil when no
+// limits are configured.
+func rateLimitOption(account string) func(*middleware.Stack) error {
+	l := limiterFor(account)
+	if l == nil {
+		return nil
+	}
+	mw := middleware.FinalizeMiddlewareFunc("DiscoveryRateLimit",
+		func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			if err := l.wait(ctx, awsmiddleware.GetServiceID(ctx)); err != nil {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+			}
+			return next.HandleFinalize(ctx, in)
+		})
+	return func(stack *middleware.Stack) error {
+		// Right after the retry middleware, so retries are limited too and
+		// time spent waiting is not counted as API latency.
+		return stack.Finalize.Insert(mw, "Retry", middleware.After)
+	}
+}
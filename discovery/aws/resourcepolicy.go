@@ -0,0 +1,382 @@
+package awscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// sourceConditionKeys are the condition keys naming the resource a
+// statement grants access to, rather than restricting the access.
+var sourceConditionKeys = map[string]bool{
+	"aws:sourcearn":     true,
+	"aws:sourceaccount": true,
+	"aws:sourceowner":   true,
+}
+
+// noPolicyCodes are the error codes services return for resources without
+// a policy.
+var noPolicyCodes = map[string]bool{
+	"ResourceNotFoundException": true,
+	"NoSuchBucketPolicy":        true,
+}
+
+// resourcePolicies infers what depends on the queues, topics and buckets
+// functions use from the policies on those resources. Each policy is read
+// once per region it is asked for in; once a service denies access no more
+// of its policies are read. It is safe for concurrent use.
+type resourcePolicies struct {
+	inbound memo[[]discovery.Relationship]
+	lambda  deniedOnce
+	sqs     deniedOnce
+	sns     deniedOnce
+	s3      deniedOnce
+}
+
+// policyClients are the clients resource policies are read with in region,
+// with the account discovered.
+type policyClients struct {
+	region  string
+	account string
+	sqs     SQSAPI
+	sns     SNSAPI
+	s3      S3API
+}
+
+// relationships returns the resourcePolicy relationships of the policy on
+// target. Queues and topics are only read in their own region; buckets in
+// another region are skipped without error.
+func (r *resourcePolicies) relationships(ctx context.Context, c policyClients, target string, typ discovery.ResourceType) ([]discovery.Relationship, error) {
+	var denied *deniedOnce
+	var read func(ctx context.Context) (string, error)
+	switch typ {
+	case discovery.ResourceTypeSQSQueue:
+		if regionOf(target) != c.region {
+			return nil, nil
+		}
+		denied, read = &r.sqs, func(ctx context.Context) (string, error) { return queuePolicy(ctx, c.sqs, target) }
+	case discovery.ResourceTypeSNSTopic:
+		if regionOf(target) != c.region {
+			return nil, nil
+		}
+		denied, read = &r.sns, func(ctx context.Context) (string, error) { return topicPolicy(ctx, c.sns, target) }
+	case discovery.ResourceTypeS3Bucket:
+		denied, read = &r.s3, func(ctx context.Context) (string, error) { return bucketPolicy(ctx, c.s3, target) }
+	default:
+		return nil, nil
+	}
+	if err := denied.get(); err != nil {
+		return nil, err
+	}
+	return r.inbound.get(ctx, c.region+" "+target, func() ([]discovery.Relationship, error) {
+		policy, err := read(ctx)
+		denied.check(err)
+		if err != nil || policy == "" {
+			return nil, err
+		}
+		doc, err := parsePolicy(policy)
+		if err != nil {
+			return nil, &policyError{policyOperation(typ), fmt.Errorf("policy of %s: %w", target, err)}
+		}
+		return inferInbound(target, typ, c.account, doc), nil
+	})
+}
+
+// functionRelationships returns the resourcePolicy relationships of the
+// policy of the function arn, which AddPermission adds statements to.
+func (r *resourcePolicies) functionRelationships(ctx context.Context, client LambdaAPI, arn string) ([]discovery.Relationship, []discovery.InvokePermission, error) {
+	if err := r.lambda.get(); err != nil {
+		return nil, nil, err
+	}
+	callCtx, cancel := requestContext(ctx)
+	out, err := client.GetPolicy(callCtx, &lambda.GetPolicyInput{FunctionName: aws.String(arn)})
+	cancel()
+	if hasNoPolicy(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		err = &policyError{"lambda:GetPolicy", fmt.Errorf("getting policy of %s: %w", arn, err)}
+		r.lambda.check(err)
+		return nil, nil, err
+	}
+	doc, err := parsePolicy(aws.ToString(out.Policy))
+	if err != nil {
+		return nil, nil, &policyError{"lambda:GetPolicy", fmt.Errorf("policy of %s: %w", arn, err)}
+	}
+	return inferInbound(arn, discovery.ResourceTypeLambdaFunction, AccountFromARN(arn), doc), invokePermissions(doc), nil
+}
+
+// invocationActions are the actions invoking a function, directly or by its
+// function URL, in lower case.
+var invocationActions = []string{"lambda:invokefunction", "lambda:invokefunctionurl"}
+
+// invokePermissions returns the statements of the function policy doc
+// allowing principals to invoke the function, in order.
+func invokePermissions(doc policyDocument) []discovery.InvokePermission {
+	var perms []discovery.InvokePermission
+	for _, st := range doc.Statement {
+		if !st.allows() {
+			continue
+		}
+		var actions []string
+		for _, a := range st.Action {
+			for _, invoke := range invocationActions {
+				if ok, _ := path.Match(strings.ToLower(a), invoke); ok {
+					actions = append(actions, a)
+					break
+				}
+			}
+		}
+		if len(actions) == 0 {
+			continue
+		}
+		conditions := st.conditions()
+		perm := discovery.InvokePermission{
+			Sid:            st.Sid,
+			Actions:        actions,
+			SourceARNs:     conditions["aws:sourcearn"],
+			SourceAccounts: append(conditions["aws:sourceaccount"], conditions["aws:sourceowner"]...),
+			OrgIDs:         conditions["aws:principalorgid"],
+		}
+		if t := conditions["lambda:functionurlauthtype"]; len(t) > 0 {
+			perm.FunctionURLAuthType = t[0]
+		}
+		wildcard := false
+		for _, typ := range slices.Sorted(maps.Keys(st.Principal)) {
+			for _, p := range st.Principal[typ] {
+				perm.Principals = append(perm.Principals, p)
+				wildcard = wildcard || hasWildcard(p)
+			}
+		}
+		// Condition values come from several operators, in no order.
+		slices.Sort(perm.SourceARNs)
+		slices.Sort(perm.SourceAccounts)
+		slices.Sort(perm.OrgIDs)
+		perm.Public = wildcard && len(perm.SourceARNs) == 0 && len(perm.SourceAccounts) == 0 && len(perm.OrgIDs) == 0
+		perms = append(perms, perm)
+	}
+	return perms
+}
+
+func queuePolicy(ctx context.Context, client SQSAPI, arn string) (string, error) {
+	callCtx, cancel := requestContext(ctx)
+	defer cancel()
+	out, err := client.GetQueueAttributes(callCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL(arn)),
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNamePolicy},
+	})
+	if err != nil {
+		return "", &policyError{"sqs:GetQueueAttributes", fmt.Errorf("getting policy of %s: %w", arn, err)}
+	}
+	return out.Attributes[string(sqstypes.QueueAttributeNamePolicy)], nil
+}
+
+func topicPolicy(ctx context.Context, client SNSAPI, arn string) (string, error) {
+	callCtx, cancel := requestContext(ctx)
+	defer cancel()
+	out, err := client.GetTopicAttributes(callCtx, &sns.GetTopicAttributesInput{TopicArn: aws.String(arn)})
+	if err != nil {
+		return "", &policyError{"sns:GetTopicAttributes", fmt.Errorf("getting policy of %s: %w", arn, err)}
+	}
+	return out.Attributes["Policy"], nil
+}
+
+func bucketPolicy(ctx context.Context, client S3API, arn string) (string, error) {
+	callCtx, cancel := requestContext(ctx)
+	defer cancel()
+	bucket := arn[strings.LastIndex(arn, ":")+1:]
+	out, err := client.GetBucketPolicy(callCtx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+	if hasNoPolicy(err) || isWrongRegion(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", &policyError{"s3:GetBucketPolicy", fmt.Errorf("getting policy of %s: %w", arn, err)}
+	}
+	return aws.ToString(out.Policy), nil
+}
+
+func policyOperation(typ discovery.ResourceType) string {
+	switch typ {
+	case discovery.ResourceTypeSQSQueue:
+		return "sqs:GetQueueAttributes"
+	case discovery.ResourceTypeSNSTopic:
+		return "sns:GetTopicAttributes"
+	default:
+		return "s3:GetBucketPolicy"
+	}
+}
+
+func hasNoPolicy(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && noPolicyCodes[apiErr.ErrorCode()]
+}
+
+// isWrongRegion reports whether S3 refused a request for a bucket in another
+// region than the client's.
+func isWrongRegion(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "PermanentRedirect", "AuthorizationHeaderMalformed", "MovedPermanently", "301":
+		return true
+	}
+	return false
+}
+
+// queueURL returns the URL of the queue arn, e.g.
+// https://sqs.us-east-1.amazonaws.com/123456789012/orders.
+func queueURL(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return arn
+	}
+	domain := "amazonaws.com"
+	if parts[1] == "aws-cn" {
+		domain = "amazonaws.com.cn"
+	}
+	return "https://sqs." + parts[3] + "." + domain + "/" + parts[4] + "/" + parts[5]
+}
+
+// accountOf returns the account a principal grants access to as a whole,
+// given as its ID (123456789012) or root ARN (arn:aws:iam::123456789012:root).
+func accountOf(principal string) string {
+	id := principal
+	if parts := strings.SplitN(principal, ":", 6); len(parts) == 6 && parts[0] == "arn" {
+		if parts[2] != "iam" || parts[5] != "root" {
+			return ""
+		}
+		id = parts[4]
+	}
+	if len(id) != 12 || strings.Trim(id, "0123456789") != "" {
+		return ""
+	}
+	return id
+}
+
+// accountARN returns the ARN standing for account as a whole in the graph,
+// that of its root principal.
+func accountARN(account string) string {
+	return "arn:aws:iam::" + account + ":root"
+}
+
+// regionOf returns the region of arn, empty for global resources.
+func regionOf(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return ""
+	}
+	return parts[3]
+}
+
+// inferInbound returns a resourcePolicy relationship to resource, in
+// account, for every resource, role and other account doc allows access to
+// it, sorted by the dependent. Sources are the resources named by
+// aws:SourceArn conditions, such as the bucket whose notifications invoke a
+// function, or else role principals and accounts other than account, as
+// principals or aws:SourceAccount conditions. Statements open to everyone,
+// the resource's own account or services in general say nothing about which
+// resources use the resource.
+func inferInbound(resource string, typ discovery.ResourceType, account string, doc policyDocument) []discovery.Relationship {
+	type found struct {
+		rel     discovery.Relationship
+		actions map[string]bool
+		via     map[string]bool
+	}
+	byFrom := map[string]*found{}
+	for _, st := range doc.Statement {
+		if !st.allows() {
+			continue
+		}
+		conditions := st.conditions()
+		sources := conditions["aws:sourcearn"]
+		if len(sources) == 0 {
+			for _, p := range st.Principal["AWS"] {
+				switch {
+				case strings.HasPrefix(p, "arn:") && strings.Contains(p, ":role/"):
+					sources = append(sources, p)
+				case accountOf(p) != "":
+					sources = append(sources, accountARN(accountOf(p)))
+				}
+			}
+			for _, id := range append(conditions["aws:sourceaccount"], conditions["aws:sourceowner"]...) {
+				if accountOf(id) != "" {
+					sources = append(sources, accountARN(id))
+				}
+			}
+		}
+		confidence := discovery.ConfidenceHigh
+		for k := range conditions {
+			if !sourceConditionKeys[k] {
+				confidence = discovery.ConfidenceLow
+			}
+		}
+
+		for _, source := range sources {
+			from, fromType, ok := resourceOf(source)
+			if !ok {
+				from, fromType = source, ""
+				switch {
+				case strings.Contains(source, ":role/"):
+					fromType = discovery.ResourceTypeIAMRole
+				case strings.HasSuffix(source, ":root"):
+					fromType = discovery.ResourceTypeAccount
+				}
+			}
+			// Patterns within a resource, such as the routes of an API,
+			// still name the resource.
+			if hasWildcard(from) || from == resource || (fromType == discovery.ResourceTypeAccount && AccountFromARN(from) == account) {
+				continue
+			}
+			f, ok := byFrom[from]
+			if !ok {
+				f = &found{
+					rel: discovery.Relationship{
+						From:       from,
+						FromType:   fromType,
+						Relation:   discovery.RelationResourcePolicy,
+						Target:     resource,
+						TargetType: typ,
+					},
+					actions: map[string]bool{},
+					via:     map[string]bool{},
+				}
+				byFrom[from] = f
+			}
+			if confidenceRank[confidence] > confidenceRank[f.rel.Confidence] {
+				f.rel.Confidence = confidence
+			}
+			for _, a := range st.Action {
+				f.actions[a] = true
+			}
+			if st.Sid != "" {
+				f.via[st.Sid] = true
+			}
+		}
+	}
+
+	rels := make([]discovery.Relationship, 0, len(byFrom))
+	for _, f := range byFrom {
+		f.rel.Actions = sortedKeys(f.actions)
+		f.rel.Via = strings.Join(sortedKeys(f.via), ", ")
+		rels = append(rels, f.rel)
+	}
+	sort.Slice(rels, func(i, j int) bool { return rels[i].From < rels[j].From })
+	return rels
+}
@@ -0,0 +1,113 @@
+package awscmd
+
+import (
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// resourceOf returns the resource an ARN refers to and its type, for the
+// types the dependency graph knows. ARNs of parts of a resource stand for
+// the resource: a DynamoDB stream or index for its table, e.g.
+// arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/2024-01-01T00:00:00.000,
+// an S3 object for its bucket, a route for its API, a listener for its load
+// balancer, a task definition revision for its family and a function or
+// state machine version or alias for the function or state machine.
+func resourceOf(arn string) (string, discovery.ResourceType, bool) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return "", "", false
+	}
+	resource := parts[5]
+	switch parts[2] {
+	case "sqs":
+		return arn, discovery.ResourceTypeSQSQueue, true
+	case "sns":
+		return arn, discovery.ResourceTypeSNSTopic, true
+	case "kinesis":
+		if strings.HasPrefix(resource, "stream/") {
+			stream := strings.Join(strings.SplitN(arn, "/", 3)[:2], "/")
+			return stream, discovery.ResourceTypeKinesisStream, true
+		}
+	case "dynamodb":
+		if strings.HasPrefix(resource, "table/") {
+			table := strings.Join(strings.SplitN(arn, "/", 3)[:2], "/")
+			return table, discovery.ResourceTypeDynamoDBTable, true
+		}
+	case "s3":
+		if resource != "" && !strings.Contains(resource, ":") {
+			bucket, _, _ := strings.Cut(arn, "/")
+			return bucket, discovery.ResourceTypeS3Bucket, true
+		}
+	case "lambda":
+		if strings.HasPrefix(resource, "function:") {
+			return unqualifiedFunctionARN(arn), discovery.ResourceTypeLambdaFunction, true
+		}
+	case "secretsmanager":
+		if strings.HasPrefix(resource, "secret:") {
+			return arn, discovery.ResourceTypeSecret, true
+		}
+	case "ssm":
+		if strings.HasPrefix(resource, "parameter/") {
+			return arn, discovery.ResourceTypeSSMParameter, true
+		}
+	case "kms":
+		if strings.HasPrefix(resource, "key/") {
+			return arn, discovery.ResourceTypeKMSKey, true
+		}
+	case "events":
+		if strings.HasPrefix(resource, "event-bus/") {
+			return arn, discovery.ResourceTypeEventBus, true
+		}
+		if strings.HasPrefix(resource, "rule/") {
+			return arn, discovery.ResourceTypeEventRule, true
+		}
+	case "execute-api":
+		// arn:aws:execute-api:us-east-1:123456789012:api-id/stage/METHOD/path
+		api, _, _ := strings.Cut(arn, "/")
+		return api, discovery.ResourceTypeAPIGateway, true
+	case "elasticloadbalancing":
+		// A listener, arn:aws:elasticloadbalancing:us-east-1:123456789012:listener/app/web/50dc6c495c0c9188/f2f7dc8efc522ab2,
+		// stands for its load balancer.
+		kind, path, _ := strings.Cut(resource, "/")
+		if kind == "loadbalancer" || kind == "listener" {
+			parts := strings.Split(path, "/")
+			if len(parts) >= 3 {
+				return strings.Join(append(strings.SplitN(arn, ":", 6)[:5], "loadbalancer/"+strings.Join(parts[:3], "/")), ":"), discovery.ResourceTypeLoadBalancer, true
+			}
+		}
+	case "states":
+		if strings.HasPrefix(resource, "stateMachine:") {
+			// Versions and aliases stand for the state machine.
+			parts := strings.Split(arn, ":")
+			return strings.Join(parts[:min(len(parts), 7)], ":"), discovery.ResourceTypeStateMachine, true
+		}
+		if strings.HasPrefix(resource, "activity:") {
+			return arn, discovery.ResourceTypeActivity, true
+		}
+	case "ecs":
+		// Task definitions stand for their family, whatever the revision:
+		// arn:aws:ecs:us-east-1:123456789012:task-definition/worker:12.
+		if family, ok := strings.CutPrefix(resource, "task-definition/"); ok {
+			family, _, _ = strings.Cut(family, ":")
+			return strings.Join(parts[:5], ":") + ":task-definition/" + family, discovery.ResourceTypeECSTaskDef, true
+		}
+	case "kafka":
+		return arn, discovery.ResourceTypeMSKCluster, true
+	case "mq":
+		return arn, discovery.ResourceTypeMQBroker, true
+	case "rds":
+		return arn, discovery.ResourceTypeDocDBCluster, true
+	}
+	return "", "", false
+}
+
+// unqualifiedFunctionARN drops the version or alias from a function ARN such
+// as arn:aws:lambda:us-east-1:123456789012:function:orders:live.
+func unqualifiedFunctionARN(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) > 7 {
+		return strings.Join(parts[:7], ":")
+	}
+	return arn
+}
@@ -0,0 +1,77 @@
+package awscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// MaxAttempts is the number of attempts, including the first, made for each
+// AWS API call before its error is reported.
+var MaxAttempts = 10
+
+// MaxBackoff caps the jittered exponential delay between attempts.
+var MaxBackoff = 20 * time.Second
+
+// NewRetryer returns the retryer every AWS client is configured with. Adaptive
+// mode rate-limits requests on the client side once the service starts
+// returning throttling errors (ThrottlingException, TooManyRequestsException
+// and the rest of retry.DefaultThrottleErrorCodes), so large-account scans slow
+// down instead of dropping resources.
+func NewRetryer() aws.Retryer {
+	r := aws.Retryer(retry.NewAdaptiveMode())
+	r = retry.AddWithMaxAttempts(r, MaxAttempts)
+	return retry.AddWithMaxBackoffDelay(r, MaxBackoff)
+}
+
+// callTimeout is the time a whole AWS API call may take: every attempt, each
+// bounded by RequestTimeout, and the longest backoff before each retry, so a
+// throttled call gets all of its attempts. It is 0 when RequestTimeout is.
+func callTimeout() time.Duration {
+	if RequestTimeout <= 0 {
+		return 0
+	}
+	attempts := time.Duration(max(MaxAttempts, 1))
+	return attempts*RequestTimeout + (attempts-1)*MaxBackoff
+}
+
+// attemptTimeoutMiddleware bounds each attempt of a call by RequestTimeout.
+// It runs after the retry middleware, so an attempt timing out is retried
+// like a network error instead of ending the call as cancelled.
+var attemptTimeoutMiddleware = middleware.FinalizeMiddlewareFunc("DiscoveryAttemptTimeout",
+	func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		timeout := RequestTimeout
+		if timeout <= 0 {
+			return next.HandleFinalize(ctx, in)
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		out, md, err := next.HandleFinalize(attemptCtx, in)
+		if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+			err = &attemptTimeoutError{timeout: timeout}
+		}
+		return out, md, err
+	})
+
+// attemptTimeoutError is an attempt that took longer than RequestTimeout.
+// It does not wrap the context error, which the retryer would take for the
+// call being cancelled.
+type attemptTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *attemptTimeoutError) Error() string {
+	return fmt.Sprintf("request timed out after %s", e.timeout)
+}
+
+// RetryableError implements the retry package's interface for errors that
+// say whether they are retryable.
+func (e *attemptTimeoutError) RetryableError() bool { return true }
+
+// Timeout reports the error as a timeout, like net.Error.
+func (e *attemptTimeoutError) Timeout() bool { return true }
@@ -0,0 +1,66 @@
+package awscmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+func TestAttemptTimeout(t *testing.T) {
+	defer func(timeout, backoff time.Duration, attempts int) {
+		RequestTimeout, MaxBackoff, MaxAttempts = timeout, backoff, attempts
+	}(RequestTimeout, MaxBackoff, MaxAttempts)
+	RequestTimeout = 100 * time.Millisecond
+	MaxBackoff = 10 * time.Millisecond
+	MaxAttempts = 4
+
+	tests := []struct {
+		name string
+		// hangs is the number of attempts the server does not answer.
+		hangs    int32
+		attempts int32
+		fails    bool
+	}{
+		{name: "answered", hangs: 0, attempts: 1},
+		{name: "answered after timeouts", hangs: 3, attempts: 4},
+		{name: "every attempt timed out", hangs: 10, attempts: 4, fails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) <= tt.hangs {
+					<-r.Context().Done()
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"Functions":[]}`))
+			}))
+			defer srv.Close()
+			client := lambda.NewFromConfig(aws.Config{
+				Region:       "us-east-1",
+				Credentials:  credentials.NewStaticCredentialsProvider("id", "secret", ""),
+				Retryer:      NewRetryer,
+				APIOptions:   apiOptions(),
+				BaseEndpoint: aws.String(srv.URL),
+			})
+
+			ctx, cancel := requestContext(context.Background())
+			defer cancel()
+			_, err := client.ListFunctions(ctx, &lambda.ListFunctionsInput{})
+			if tt.fails != (err != nil) {
+				t.Errorf("got error %v, want failure %v", err, tt.fails)
+			}
+			if got := attempts.Load(); got != tt.attempts {
+				t.Errorf("made %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
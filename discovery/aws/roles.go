@@ -0,0 +1,324 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// permissionServices are the services whose resources a function's
+// permissions are taken to make it depend on. Others, such as CloudWatch
+// Logs or X-Ray, are used by nearly every function without being part of
+// its architecture.
+var permissionServices = map[string]bool{
+	"dynamodb":       true,
+	"sqs":            true,
+	"sns":            true,
+	"s3":             true,
+	"lambda":         true,
+	"kinesis":        true,
+	"secretsmanager": true,
+	"ssm":            true,
+	"kms":            true,
+	"events":         true,
+	"states":         true,
+	"execute-api":    true,
+}
+
+// confidenceRank orders confidence levels, so the strongest evidence for a
+// relationship wins.
+var confidenceRank = map[string]int{
+	discovery.ConfidenceLow:    1,
+	discovery.ConfidenceMedium: 2,
+	discovery.ConfidenceHigh:   3,
+}
+
+// policyError is a failure to read an execution role's policies. Operation
+// is the IAM API that failed, e.g. "iam:GetRolePolicy".
+type policyError struct {
+	Operation string
+	Err       error
+}
+
+func (e *policyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *policyError) Unwrap() error {
+	return e.Err
+}
+
+// deniedOnce remembers the first policyError caused by missing permission,
+// after which a policy reader stops calling the service.
+type deniedOnce struct {
+	mu  sync.Mutex
+	err *policyError
+}
+
+func (d *deniedOnce) get() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil {
+		return nil
+	}
+	return d.err
+}
+
+// check records err if it is the first denial.
+func (d *deniedOnce) check(err error) {
+	pe, ok := err.(*policyError)
+	if !ok || !isAccessDenied(pe.Err) {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil {
+		d.err = pe
+	}
+}
+
+// policyErrors keeps the first policyError of each operation, so each
+// omitted detail is reported once.
+type policyErrors struct {
+	mu   sync.Mutex
+	byOp map[string]*policyError
+}
+
+func (p *policyErrors) add(err error) {
+	pe, ok := err.(*policyError)
+	if !ok {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.byOp == nil {
+		p.byOp = map[string]*policyError{}
+	}
+	if _, ok := p.byOp[pe.Operation]; !ok {
+		p.byOp[pe.Operation] = pe
+	}
+}
+
+// emit reports the errors as omitted details, by operation.
+func (p *policyErrors) emit(emit func(discovery.Result) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ops := make([]string, 0, len(p.byOp))
+	for op := range p.byOp {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		if err := emit(discovery.SkipDetail(op, p.byOp[op].Err)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rolePolicies infers the dependencies of functions from the policies of
+// their execution roles. Each role, and each customer managed policy, is
+// read once and shared by every function and region using it. Once IAM
+// denies access no more calls are made. It is safe for concurrent use.
+type rolePolicies struct {
+	roles   memo[[]discovery.Relationship]
+	managed memo[policyDocument]
+	denied  deniedOnce
+}
+
+// relationships returns the relationships the policies of role grant,
+// reading them with client unless another call already has.
+func (r *rolePolicies) relationships(ctx context.Context, client IAMAPI, role string) ([]discovery.Relationship, error) {
+	if err := r.denied.get(); err != nil {
+		return nil, err
+	}
+	return r.roles.get(ctx, role, func() ([]discovery.Relationship, error) {
+		policies, err := r.read(ctx, client, role)
+		r.denied.check(err)
+		return inferPermissions(policies), err
+	})
+}
+
+// namedPolicy is a policy document and the name it is attached under.
+type namedPolicy struct {
+	name string
+	doc  policyDocument
+}
+
+// read returns the inline and customer managed policies of role. AWS
+// managed policies are skipped: they grant access to resources in general,
+// never to particular ones.
+func (r *rolePolicies) read(ctx context.Context, client IAMAPI, role string) ([]namedPolicy, error) {
+	name := role[strings.LastIndex(role, "/")+1:]
+	var policies []namedPolicy
+
+	inline := iam.NewListRolePoliciesPaginator(client, &iam.ListRolePoliciesInput{RoleName: aws.String(name)})
+	for policy, err := range paginate(ctx, inline.HasMorePages, inline.NextPage, listedRolePolicies) {
+		if err != nil {
+			return nil, &policyError{"iam:ListRolePolicies", fmt.Errorf("listing policies of %s: %w", role, err)}
+		}
+		callCtx, cancel := requestContext(ctx)
+		out, err := client.GetRolePolicy(callCtx, &iam.GetRolePolicyInput{RoleName: aws.String(name), PolicyName: aws.String(policy)})
+		cancel()
+		if err != nil {
+			return nil, &policyError{"iam:GetRolePolicy", fmt.Errorf("getting policy %s of %s: %w", policy, role, err)}
+		}
+		doc, err := parsePolicy(aws.ToString(out.PolicyDocument))
+		if err != nil {
+			return nil, &policyError{"iam:GetRolePolicy", fmt.Errorf("policy %s of %s: %w", policy, role, err)}
+		}
+		policies = append(policies, namedPolicy{policy, doc})
+	}
+
+	attached := iam.NewListAttachedRolePoliciesPaginator(client, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(name)})
+	for policy, err := range paginate(ctx, attached.HasMorePages, attached.NextPage, listedAttachedPolicies) {
+		if err != nil {
+			return nil, &policyError{"iam:ListAttachedRolePolicies", fmt.Errorf("listing attached policies of %s: %w", role, err)}
+		}
+		arn := aws.ToString(policy.PolicyArn)
+		if AccountFromARN(arn) == "aws" {
+			continue
+		}
+		doc, err := r.managedPolicy(ctx, client, arn)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, namedPolicy{aws.ToString(policy.PolicyName), doc})
+	}
+	return policies, nil
+}
+
+// managedPolicy returns the default version of the managed policy arn.
+func (r *rolePolicies) managedPolicy(ctx context.Context, client IAMAPI, arn string) (policyDocument, error) {
+	return r.managed.get(ctx, arn, func() (policyDocument, error) {
+		var doc policyDocument
+		callCtx, cancel := requestContext(ctx)
+		policy, err := client.GetPolicy(callCtx, &iam.GetPolicyInput{PolicyArn: aws.String(arn)})
+		cancel()
+		if err != nil {
+			return doc, &policyError{"iam:GetPolicy", fmt.Errorf("getting policy %s: %w", arn, err)}
+		}
+		var version *string
+		if policy.Policy != nil {
+			version = policy.Policy.DefaultVersionId
+		}
+		callCtx, cancel = requestContext(ctx)
+		out, err := client.GetPolicyVersion(callCtx, &iam.GetPolicyVersionInput{PolicyArn: aws.String(arn), VersionId: version})
+		cancel()
+		if err != nil {
+			return doc, &policyError{"iam:GetPolicyVersion", fmt.Errorf("getting policy %s: %w", arn, err)}
+		}
+		if out.PolicyVersion == nil {
+			return doc, nil
+		}
+		if doc, err = parsePolicy(aws.ToString(out.PolicyVersion.Document)); err != nil {
+			return doc, &policyError{"iam:GetPolicyVersion", fmt.Errorf("policy %s: %w", arn, err)}
+		}
+		return doc, nil
+	})
+}
+
+func listedRolePolicies(page *iam.ListRolePoliciesOutput) []string {
+	return page.PolicyNames
+}
+
+func listedAttachedPolicies(page *iam.ListAttachedRolePoliciesOutput) []iamtypes.AttachedPolicy {
+	return page.AttachedPolicies
+}
+
+// inferPermissions returns a permission relationship for every resource
+// that policies allow actions of its own service on, sorted by target.
+// Only resources named in full count: patterns such as
+// arn:aws:sqs:*:123456789012:* say nothing about which resources are used.
+// ARNs of parts of a resource, such as the objects of a bucket, count for
+// the resource.
+func inferPermissions(policies []namedPolicy) []discovery.Relationship {
+	type found struct {
+		rel     discovery.Relationship
+		actions map[string]bool
+		via     map[string]bool
+	}
+	byTarget := map[string]*found{}
+	for _, p := range policies {
+		for _, st := range p.doc.Statement {
+			if !st.allows() {
+				continue
+			}
+			for _, resource := range st.Resource {
+				target, typ, ok := resourceOf(resource)
+				if !ok || hasWildcard(target) || strings.Contains(target, "${") {
+					continue
+				}
+				service := strings.SplitN(resource, ":", 4)[2]
+				if !permissionServices[service] {
+					continue
+				}
+				var actions []string
+				explicit := false
+				for _, a := range st.Action {
+					prefix, name, _ := strings.Cut(a, ":")
+					if a != "*" && !strings.EqualFold(prefix, service) {
+						continue
+					}
+					actions = append(actions, a)
+					if a != "*" && !hasWildcard(name) {
+						explicit = true
+					}
+				}
+				if len(actions) == 0 {
+					continue
+				}
+				confidence := discovery.ConfidenceMedium
+				if explicit {
+					confidence = discovery.ConfidenceHigh
+				}
+				if st.conditional() {
+					confidence = discovery.ConfidenceLow
+				}
+
+				f, ok := byTarget[target]
+				if !ok {
+					f = &found{
+						rel:     discovery.Relationship{Relation: discovery.RelationPermission, Target: target, TargetType: typ},
+						actions: map[string]bool{},
+						via:     map[string]bool{},
+					}
+					byTarget[target] = f
+				}
+				if confidenceRank[confidence] > confidenceRank[f.rel.Confidence] {
+					f.rel.Confidence = confidence
+				}
+				for _, a := range actions {
+					f.actions[a] = true
+				}
+				f.via[p.name] = true
+			}
+		}
+	}
+
+	rels := make([]discovery.Relationship, 0, len(byTarget))
+	for _, f := range byTarget {
+		f.rel.Actions = sortedKeys(f.actions)
+		f.rel.Via = strings.Join(sortedKeys(f.via), ", ")
+		rels = append(rels, f.rel)
+	}
+	sort.Slice(rels, func(i, j int) bool { return rels[i].Target < rels[j].Target })
+	return rels
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,141 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	aastypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// concurrencyScaling returns how Application Auto Scaling scales the
+// provisioned concurrency of functions in the region, by function name and
+// qualifier. Targets and policies are listed for the whole region at once.
+func concurrencyScaling(ctx context.Context, client ApplicationAutoScalingAPI) (map[string]map[string]*discovery.ConcurrencyScaling, error) {
+	byResource := map[string]*discovery.ConcurrencyScaling{}
+	targets := applicationautoscaling.NewDescribeScalableTargetsPaginator(client, &applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace:  aastypes.ServiceNamespaceLambda,
+		ScalableDimension: aastypes.ScalableDimensionLambdaFunctionProvisionedConcurrency,
+	})
+	for t, err := range paginate(ctx, targets.HasMorePages, targets.NextPage, listedScalableTargets) {
+		if err != nil {
+			return nil, fmt.Errorf("describing scalable targets: %w", err)
+		}
+		byResource[aws.ToString(t.ResourceId)] = &discovery.ConcurrencyScaling{
+			MinCapacity: aws.ToInt32(t.MinCapacity),
+			MaxCapacity: aws.ToInt32(t.MaxCapacity),
+		}
+	}
+	if len(byResource) == 0 {
+		return nil, nil
+	}
+
+	policies := applicationautoscaling.NewDescribeScalingPoliciesPaginator(client, &applicationautoscaling.DescribeScalingPoliciesInput{
+		ServiceNamespace:  aastypes.ServiceNamespaceLambda,
+		ScalableDimension: aastypes.ScalableDimensionLambdaFunctionProvisionedConcurrency,
+	})
+	for p, err := range paginate(ctx, policies.HasMorePages, policies.NextPage, listedScalingPolicies) {
+		if err != nil {
+			return nil, fmt.Errorf("describing scaling policies: %w", err)
+		}
+		scaling, ok := byResource[aws.ToString(p.ResourceId)]
+		if !ok {
+			continue
+		}
+		policy := discovery.ScalingPolicy{Name: aws.ToString(p.PolicyName), Type: string(p.PolicyType)}
+		if c := p.TargetTrackingScalingPolicyConfiguration; c != nil {
+			policy.TargetValue = aws.ToFloat64(c.TargetValue)
+			switch {
+			case c.PredefinedMetricSpecification != nil:
+				policy.Metric = string(c.PredefinedMetricSpecification.PredefinedMetricType)
+			case c.CustomizedMetricSpecification != nil:
+				policy.Metric = aws.ToString(c.CustomizedMetricSpecification.MetricName)
+			}
+		}
+		scaling.Policies = append(scaling.Policies, policy)
+	}
+
+	// Resource IDs are function:<name>:<qualifier>.
+	scaling := map[string]map[string]*discovery.ConcurrencyScaling{}
+	for id, s := range byResource {
+		parts := strings.Split(id, ":")
+		if len(parts) != 3 || parts[0] != "function" {
+			continue
+		}
+		if scaling[parts[1]] == nil {
+			scaling[parts[1]] = map[string]*discovery.ConcurrencyScaling{}
+		}
+		scaling[parts[1]][parts[2]] = s
+	}
+	return scaling, nil
+}
+
+func listedScalableTargets(page *applicationautoscaling.DescribeScalableTargetsOutput) []aastypes.ScalableTarget {
+	return page.ScalableTargets
+}
+
+func listedScalingPolicies(page *applicationautoscaling.DescribeScalingPoliciesOutput) []aastypes.ScalingPolicy {
+	return page.ScalingPolicies
+}
+
+// provisionedConcurrency returns the provisioned concurrency of the versions
+// and aliases of the function name, with the scaling of each qualifier from
+// scaling, sorted by qualifier. Qualifiers that are scaled but have no
+// provisioned concurrency configured are included.
+func provisionedConcurrency(ctx context.Context, client LambdaAPI, name string, scaling map[string]*discovery.ConcurrencyScaling) ([]discovery.ProvisionedConcurrency, error) {
+	var configs []discovery.ProvisionedConcurrency
+	seen := map[string]bool{}
+	p := lambda.NewListProvisionedConcurrencyConfigsPaginator(client, &lambda.ListProvisionedConcurrencyConfigsInput{FunctionName: aws.String(name)})
+	for c, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedProvisionedConcurrency) {
+		if err != nil {
+			return nil, fmt.Errorf("listing provisioned concurrency of %s: %w", name, err)
+		}
+		arn := aws.ToString(c.FunctionArn)
+		qualifier := arn[strings.LastIndex(arn, ":")+1:]
+		seen[qualifier] = true
+		configs = append(configs, discovery.ProvisionedConcurrency{
+			Qualifier: qualifier,
+			Requested: aws.ToInt32(c.RequestedProvisionedConcurrentExecutions),
+			Allocated: aws.ToInt32(c.AllocatedProvisionedConcurrentExecutions),
+			Status:    string(c.Status),
+			Scaling:   scaling[qualifier],
+		})
+	}
+	for qualifier, s := range scaling {
+		if !seen[qualifier] {
+			configs = append(configs, discovery.ProvisionedConcurrency{Qualifier: qualifier, Scaling: s})
+		}
+	}
+	slices.SortFunc(configs, func(a, b discovery.ProvisionedConcurrency) int { return strings.Compare(a.Qualifier, b.Qualifier) })
+	return configs, nil
+}
+
+func listedProvisionedConcurrency(page *lambda.ListProvisionedConcurrencyConfigsOutput) []lambdatypes.ProvisionedConcurrencyConfigListItem {
+	return page.ProvisionedConcurrencyConfigs
+}
+
+// AccountConcurrency returns the concurrency limit of the account in region,
+// shared by all its functions, and how much of it no function reserves.
+func (p *Provider) AccountConcurrency(ctx context.Context, region string) (limit, unreserved int32, err error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return 0, 0, err
+	}
+	reqCtx, cancel := requestContext(ctx)
+	out, err := clients.lambda.GetAccountSettings(reqCtx, &lambda.GetAccountSettingsInput{})
+	cancel()
+	if err != nil {
+		return 0, 0, fmt.Errorf("getting account settings in %s: %w", region, err)
+	}
+	if out.AccountLimit == nil {
+		return 0, 0, fmt.Errorf("no account limit in %s", region)
+	}
+	return out.AccountLimit.ConcurrentExecutions, aws.ToInt32(out.AccountLimit.UnreservedConcurrentExecutions), nil
+}
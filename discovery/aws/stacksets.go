@@ -0,0 +1,79 @@
+package awscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfntypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// StackSetInstances returns the stack sets administered from region by the
+// account of RoleARN, by the ID of each of their stack instances, in any
+// account and region. With delegated, the stack sets the account
+// administers as a delegated administrator of its organization are
+// included; accounts that are not one have none.
+func (p *Provider) StackSetInstances(ctx context.Context, region string, delegated bool) (map[string]discovery.StackSet, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	callers := []cfntypes.CallAs{cfntypes.CallAsSelf}
+	if delegated {
+		callers = append(callers, cfntypes.CallAsDelegatedAdmin)
+	}
+	instances := map[string]discovery.StackSet{}
+	for _, callAs := range callers {
+		var sets []cfntypes.StackSetSummary
+		pages := cloudformation.NewListStackSetsPaginator(clients.cloudformation, &cloudformation.ListStackSetsInput{
+			CallAs: callAs,
+			Status: cfntypes.StackSetStatusActive,
+		})
+		for set, err := range paginate(ctx, pages.HasMorePages, pages.NextPage, listedStackSets) {
+			if err != nil {
+				if callAs == cfntypes.CallAsDelegatedAdmin && notDelegatedAdmin(err) {
+					break
+				}
+				return nil, fmt.Errorf("listing stack sets in %s: %w", region, err)
+			}
+			sets = append(sets, set)
+		}
+		for _, set := range sets {
+			name := aws.ToString(set.StackSetName)
+			stackSet := discovery.StackSet{Name: name, AdministrationAccount: p.AccountID(), PermissionModel: string(set.PermissionModel)}
+			pages := cloudformation.NewListStackInstancesPaginator(clients.cloudformation, &cloudformation.ListStackInstancesInput{
+				StackSetName: set.StackSetName,
+				CallAs:       callAs,
+			})
+			for instance, err := range paginate(ctx, pages.HasMorePages, pages.NextPage, listedStackInstances) {
+				if err != nil {
+					return nil, fmt.Errorf("listing the instances of stack set %s in %s: %w", name, region, err)
+				}
+				if id := aws.ToString(instance.StackId); id != "" {
+					instances[id] = stackSet
+				}
+			}
+		}
+	}
+	return instances, nil
+}
+
+// notDelegatedAdmin reports whether err means the account listing stack sets
+// as a delegated administrator is not one.
+func notDelegatedAdmin(err error) bool {
+	var apiErr smithy.APIError
+	return isAccessDenied(err) || errors.As(err, &apiErr) && apiErr.ErrorCode() == "ValidationError"
+}
+
+func listedStackSets(page *cloudformation.ListStackSetsOutput) []cfntypes.StackSetSummary {
+	return page.Summaries
+}
+
+func listedStackInstances(page *cloudformation.ListStackInstancesOutput) []cfntypes.StackInstanceSummary {
+	return page.Summaries
+}
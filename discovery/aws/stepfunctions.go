@@ -0,0 +1,261 @@
+package awscmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	sfntypes "github.com/aws/aws-sdk-go-v2/service/sfn/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// StateMachineCataloger discovers Step Functions state machines and the
+// resources their Task states invoke.
+type StateMachineCataloger struct {
+	client  SFNAPI
+	region  string
+	account string
+}
+
+// NewStateMachineCataloger returns a cataloger listing the state machines
+// of account in region with client.
+func NewStateMachineCataloger(client SFNAPI, region, account string) *StateMachineCataloger {
+	return &StateMachineCataloger{client: client, region: region, account: account}
+}
+
+func (c *StateMachineCataloger) Name() string {
+	return "stepfunctions"
+}
+
+func (c *StateMachineCataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	listStateMachines := func(ctx context.Context, send func(sfntypes.StateMachineListItem) bool) error {
+		p := sfn.NewListStateMachinesPaginator(c.client, &sfn.ListStateMachinesInput{})
+		for sm, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedStateMachines) {
+			if err != nil {
+				return fmt.Errorf("listing state machines: %w", err)
+			}
+			if !send(sm) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	describeStateMachine := func(ctx context.Context, sm sfntypes.StateMachineListItem) discovery.Result {
+		var result discovery.Result
+		s := &result.Service
+		s.Provider = "aws"
+		s.Region = c.region
+		s.AccountID = c.account
+		s.ResourceType = discovery.ResourceTypeStateMachine
+		s.ARN = aws.ToString(sm.StateMachineArn)
+		s.Name = aws.ToString(sm.Name)
+		s.DiscoveredAt = time.Now().UTC()
+		if sm.CreationDate != nil {
+			created := sm.CreationDate.UTC()
+			s.LastModified = &created
+		}
+
+		callCtx, cancel := requestContext(ctx)
+		defer cancel()
+		out, err := c.client.DescribeStateMachine(callCtx, &sfn.DescribeStateMachineInput{StateMachineArn: sm.StateMachineArn})
+		if err != nil {
+			return discovery.SkipResource(s.Name, fmt.Errorf("describing state machine: %w", err))
+		}
+		s.Details.StateMachine = &discovery.StateMachineDetails{
+			Type:        string(out.Type),
+			Status:      string(out.Status),
+			Role:        aws.ToString(out.RoleArn),
+			Description: aws.ToString(out.Description),
+		}
+		rels, err := orchestrated(aws.ToString(out.Definition), s.ARN)
+		if err != nil {
+			return discovery.SkipResource(s.Name, err)
+		}
+		s.Relationships = rels
+		return result
+	}
+
+	return fanOut(ctx, Workers, OrderedResults, listStateMachines, describeStateMachine, emit)
+}
+
+func listedStateMachines(page *sfn.ListStateMachinesOutput) []sfntypes.StateMachineListItem {
+	return page.StateMachines
+}
+
+// aslDefinition is an Amazon States Language definition, as far as
+// discovery reads one: a state machine, or a branch or item processor
+// within one.
+type aslDefinition struct {
+	States map[string]aslState `json:"States"`
+}
+
+type aslState struct {
+	Type     string `json:"Type"`
+	Resource string `json:"Resource"`
+	// Parameters, or Arguments with JSONata, are the input of a Task.
+	Parameters map[string]any  `json:"Parameters"`
+	Arguments  map[string]any  `json:"Arguments"`
+	Branches   []aslDefinition `json:"Branches"`
+	Iterator   *aslDefinition  `json:"Iterator"`
+	// ItemProcessor replaces Iterator in newer definitions.
+	ItemProcessor *aslDefinition `json:"ItemProcessor"`
+}
+
+// orchestrated returns an orchestration relationship for every resource the
+// Task states of definition invoke, sorted by target, with the states
+// invoking each in Via. sm is the ARN of the state machine, whose account
+// and region resources named without an ARN are in.
+func orchestrated(definition, sm string) ([]discovery.Relationship, error) {
+	var def aslDefinition
+	if err := json.Unmarshal([]byte(definition), &def); err != nil {
+		return nil, fmt.Errorf("parsing definition: %w", err)
+	}
+	states := map[string]map[string]bool{}
+	types := map[string]discovery.ResourceType{}
+	var walk func(def aslDefinition)
+	walk = func(def aslDefinition) {
+		for name, st := range def.States {
+			for _, b := range st.Branches {
+				walk(b)
+			}
+			if st.Iterator != nil {
+				walk(*st.Iterator)
+			}
+			if st.ItemProcessor != nil {
+				walk(*st.ItemProcessor)
+			}
+			if st.Type != "Task" {
+				continue
+			}
+			input := st.Parameters
+			if input == nil {
+				input = st.Arguments
+			}
+			for _, target := range taskTargets(st.Resource, input, sm) {
+				arn, typ, ok := resourceOf(target)
+				if !ok || arn == sm {
+					continue
+				}
+				if states[arn] == nil {
+					states[arn] = map[string]bool{}
+				}
+				states[arn][name] = true
+				types[arn] = typ
+			}
+		}
+	}
+	walk(def)
+
+	rels := make([]discovery.Relationship, 0, len(states))
+	for arn, names := range states {
+		rels = append(rels, discovery.Relationship{
+			Relation:   discovery.RelationOrchestration,
+			Target:     arn,
+			TargetType: types[arn],
+			Via:        strings.Join(sortedKeys(names), ", "),
+		})
+	}
+	sort.Slice(rels, func(i, j int) bool { return rels[i].Target < rels[j].Target })
+	return rels, nil
+}
+
+// taskTargets returns the ARNs of the resources a Task state invokes:
+// resource itself for functions and activities, or for service
+// integrations such as arn:aws:states:::sqs:sendMessage (also as .sync,
+// .waitForTaskToken or an aws-sdk integration) the resource its input
+// names. Inputs taken from the state's input at run time (keys ending in
+// ".$", JSONata expressions) say nothing about which resource is used.
+func taskTargets(resource string, input map[string]any, sm string) []string {
+	_, service, ok := strings.Cut(resource, ":states:::")
+	if !ok {
+		return []string{resource}
+	}
+	service = strings.TrimPrefix(service, "aws-sdk:")
+	service, _, _ = strings.Cut(service, ":")
+
+	param := func(names ...string) string {
+		for _, name := range names {
+			if v, ok := input[name].(string); ok && !strings.HasPrefix(v, "{%") {
+				return v
+			}
+		}
+		return ""
+	}
+	parts := strings.SplitN(sm, ":", 6)
+	if len(parts) < 6 {
+		return nil
+	}
+	// qualify turns a name into the ARN of a resource in the state
+	// machine's account and region.
+	qualify := func(name, service, resource string) string {
+		if name == "" || strings.HasPrefix(name, "arn:") {
+			return name
+		}
+		return strings.Join([]string{"arn", parts[1], service, parts[3], parts[4], resource + name}, ":")
+	}
+
+	var targets []string
+	switch service {
+	case "lambda":
+		// A function name, partial ARN (123456789012:function:orders) or
+		// ARN, any of them qualified by a version or alias.
+		name := param("FunctionName")
+		if name != "" && !strings.HasPrefix(name, "arn:") {
+			if i := strings.Index(name, "function:"); i >= 0 {
+				name = name[i+len("function:"):]
+			}
+			name = qualify(name, "lambda", "function:")
+		}
+		targets = append(targets, name)
+	case "sns":
+		targets = append(targets, param("TopicArn"))
+	case "sqs":
+		targets = append(targets, queueARN(param("QueueUrl"), parts[1]))
+	case "dynamodb":
+		targets = append(targets, qualify(param("TableName"), "dynamodb", "table/"))
+	case "states":
+		targets = append(targets, param("StateMachineArn"))
+	case "ecs":
+		targets = append(targets, qualify(param("TaskDefinition"), "ecs", "task-definition/"))
+	case "events":
+		entries, _ := input["Entries"].([]any)
+		for _, e := range entries {
+			entry, _ := e.(map[string]any)
+			bus, _ := entry["EventBusName"].(string)
+			if _, dynamic := entry["EventBusName.$"]; dynamic {
+				continue
+			}
+			if bus == "" {
+				bus = "default"
+			}
+			targets = append(targets, qualify(bus, "events", "event-bus/"))
+		}
+	}
+	var named []string
+	for _, t := range targets {
+		if t != "" && !strings.Contains(t, "$") {
+			named = append(named, t)
+		}
+	}
+	return named
+}
+
+// queueARN returns the ARN of the queue with url, e.g.
+// https://sqs.us-east-1.amazonaws.com/123456789012/orders, the reverse of
+// queueURL.
+func queueARN(url, partition string) string {
+	host, path, ok := strings.Cut(strings.TrimPrefix(url, "https://"), "/")
+	account, name, ok2 := strings.Cut(path, "/")
+	labels := strings.Split(host, ".")
+	if !ok || !ok2 || len(labels) < 3 || labels[0] != "sqs" {
+		return ""
+	}
+	return "arn:" + partition + ":sqs:" + labels[1] + ":" + account + ":" + name
+}
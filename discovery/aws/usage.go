@@ -0,0 +1,241 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	elb "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbtypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// metricQueries is the most queries GetMetricData accepts per request.
+const metricQueries = 500
+
+// metricPeriod is the period metrics are summed over; a day keeps the
+// number of data points small for windows of weeks.
+const metricPeriod = 24 * time.Hour
+
+// Metric is a CloudWatch metric with one dimension, e.g. the Invocations of
+// a function: {"AWS/Lambda", "Invocations", "FunctionName", "orders"}.
+type Metric struct {
+	Namespace string
+	Name      string
+	Dimension string
+	Value     string
+}
+
+// InvocationsMetric returns the invocations of the function named name.
+func InvocationsMetric(name string) Metric {
+	return lambdaMetric("Invocations", name)
+}
+
+// ExecutionsMetric returns the executions started of the state machine arn.
+func ExecutionsMetric(arn string) Metric {
+	return Metric{Namespace: "AWS/States", Name: "ExecutionsStarted", Dimension: "StateMachineArn", Value: arn}
+}
+
+// MetricSums returns the sum of each metric between start and end in
+// region, in the order of metrics. Metrics without data points, which AWS
+// services do not publish while a resource is unused, sum to 0.
+func (p *Provider) MetricSums(ctx context.Context, region string, metrics []Metric, start, end time.Time) ([]float64, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return metricSums(ctx, clients.cloudwatch, metrics, start, end)
+}
+
+func metricSums(ctx context.Context, client CloudWatchAPI, metrics []Metric, start, end time.Time) ([]float64, error) {
+	values, err := metricValues(ctx, client, metrics, "Sum", metricPeriod, start, end)
+	if err != nil {
+		return nil, err
+	}
+	sums := make([]float64, len(metrics))
+	for i, vs := range values {
+		for _, v := range vs {
+			sums[i] += v
+		}
+	}
+	return sums, nil
+}
+
+// metricValues returns the data points of the statistic stat of each metric
+// over period between start and end, in the order of metrics, querying up to
+// metricQueries metrics per request.
+func metricValues(ctx context.Context, client CloudWatchAPI, metrics []Metric, stat string, period time.Duration, start, end time.Time) ([][]float64, error) {
+	values := make([][]float64, len(metrics))
+	for first := 0; first < len(metrics); first += metricQueries {
+		batch := metrics[first:min(first+metricQueries, len(metrics))]
+		queries := make([]cwtypes.MetricDataQuery, len(batch))
+		for i, m := range batch {
+			queries[i] = cwtypes.MetricDataQuery{
+				// Query IDs must start with a lowercase letter.
+				Id: aws.String("m" + strconv.Itoa(first+i)),
+				MetricStat: &cwtypes.MetricStat{
+					Metric: &cwtypes.Metric{
+						Namespace:  aws.String(m.Namespace),
+						MetricName: aws.String(m.Name),
+						Dimensions: []cwtypes.Dimension{{Name: aws.String(m.Dimension), Value: aws.String(m.Value)}},
+					},
+					Period: aws.Int32(int32(period / time.Second)),
+					Stat:   aws.String(stat),
+				},
+				ReturnData: aws.Bool(true),
+			}
+		}
+		pager := cloudwatch.NewGetMetricDataPaginator(client, &cloudwatch.GetMetricDataInput{
+			MetricDataQueries: queries,
+			StartTime:         aws.Time(start),
+			EndTime:           aws.Time(end),
+		})
+		// The values of one query may span pages.
+		for r, err := range paginate(ctx, pager.HasMorePages, pager.NextPage, metricDataResults) {
+			if err != nil {
+				return nil, fmt.Errorf("getting metric data: %w", err)
+			}
+			i, err := strconv.Atoi(strings.TrimPrefix(aws.ToString(r.Id), "m"))
+			if err != nil || i < 0 || i >= len(values) {
+				continue
+			}
+			values[i] = append(values[i], r.Values...)
+		}
+	}
+	return values, nil
+}
+
+// lambdaMetric returns the metric name of the function named function.
+func lambdaMetric(name, function string) Metric {
+	return Metric{Namespace: "AWS/Lambda", Name: name, Dimension: "FunctionName", Value: function}
+}
+
+// functionUsage returns the usage of the functions names between start and
+// end, in the order of names: the sums of their Invocations, Errors and
+// Throttles, and the 95th percentile of their Duration over the whole
+// window.
+func functionUsage(ctx context.Context, client CloudWatchAPI, names []string, start, end time.Time) ([]discovery.LambdaUsage, error) {
+	counts := []string{"Invocations", "Errors", "Throttles"}
+	metrics := make([]Metric, 0, len(names)*len(counts))
+	durations := make([]Metric, len(names))
+	for i, name := range names {
+		for _, c := range counts {
+			metrics = append(metrics, lambdaMetric(c, name))
+		}
+		durations[i] = lambdaMetric("Duration", name)
+	}
+	sums, err := metricSums(ctx, client, metrics, start, end)
+	if err != nil {
+		return nil, err
+	}
+	// Percentiles cannot be added up, so Duration is queried with a single
+	// period spanning the window, in whole minutes as periods must be. The
+	// window may still straddle two periods; the higher is taken.
+	window := end.Sub(start).Round(time.Minute)
+	window = max(window, time.Minute)
+	p95, err := metricValues(ctx, client, durations, "p95", window, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]discovery.LambdaUsage, len(names))
+	for i := range names {
+		u := &usage[i]
+		u.Since = start
+		u.Invocations = int64(sums[i*len(counts)])
+		u.Errors = int64(sums[i*len(counts)+1])
+		u.Throttles = int64(sums[i*len(counts)+2])
+		if u.Invocations > 0 {
+			u.ErrorRate = float64(u.Errors) / float64(u.Invocations)
+		}
+		for _, v := range p95[i] {
+			u.DurationP95 = max(u.DurationP95, v)
+		}
+	}
+	return usage, nil
+}
+
+func metricDataResults(out *cloudwatch.GetMetricDataOutput) []cwtypes.MetricDataResult {
+	return out.MetricDataResults
+}
+
+// TopicSubscriptions returns the number of confirmed subscriptions to the
+// SNS topic arn, in its region.
+func (p *Provider) TopicSubscriptions(ctx context.Context, arn string) (int, error) {
+	clients, err := p.clients(ctx, regionOf(arn))
+	if err != nil {
+		return 0, err
+	}
+	return topicSubscriptions(ctx, clients.sns, arn)
+}
+
+func topicSubscriptions(ctx context.Context, client SNSAPI, arn string) (int, error) {
+	n := 0
+	pager := sns.NewListSubscriptionsByTopicPaginator(client, &sns.ListSubscriptionsByTopicInput{TopicArn: aws.String(arn)})
+	for s, err := range paginate(ctx, pager.HasMorePages, pager.NextPage, listedSubscriptions) {
+		if err != nil {
+			return 0, fmt.Errorf("listing subscriptions to %s: %w", arn, err)
+		}
+		// Unconfirmed subscriptions have no ARN yet and receive nothing.
+		if strings.HasPrefix(aws.ToString(s.SubscriptionArn), "arn:") {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func listedSubscriptions(out *sns.ListSubscriptionsByTopicOutput) []snstypes.Subscription {
+	return out.Subscriptions
+}
+
+// TargetGroup is an Elastic Load Balancing target group.
+type TargetGroup struct {
+	ARN  string
+	Name string
+	// LoadBalancers are the ARNs of the load balancers routing to it.
+	LoadBalancers []string
+	// Targets is the number of targets registered.
+	Targets int
+}
+
+// TargetGroups returns the target groups in region with the number of
+// targets registered in each.
+func (p *Provider) TargetGroups(ctx context.Context, region string) ([]TargetGroup, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return targetGroups(ctx, clients.elb)
+}
+
+func targetGroups(ctx context.Context, client ELBAPI) ([]TargetGroup, error) {
+	var groups []TargetGroup
+	pager := elb.NewDescribeTargetGroupsPaginator(client, &elb.DescribeTargetGroupsInput{})
+	for tg, err := range paginate(ctx, pager.HasMorePages, pager.NextPage, listedTargetGroups) {
+		if err != nil {
+			return nil, fmt.Errorf("describing target groups: %w", err)
+		}
+		group := TargetGroup{ARN: aws.ToString(tg.TargetGroupArn), Name: aws.ToString(tg.TargetGroupName), LoadBalancers: tg.LoadBalancerArns}
+		reqCtx, cancel := requestContext(ctx)
+		health, err := client.DescribeTargetHealth(reqCtx, &elb.DescribeTargetHealthInput{TargetGroupArn: tg.TargetGroupArn})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("describing targets of %s: %w", group.Name, err)
+		}
+		group.Targets = len(health.TargetHealthDescriptions)
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func listedTargetGroups(out *elb.DescribeTargetGroupsOutput) []elbtypes.TargetGroup {
+	return out.TargetGroups
+}
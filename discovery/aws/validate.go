@@ -0,0 +1,106 @@
+package awscmd
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// roleARNPattern matches IAM role ARNs in any partition, including roles
+// with a path such as arn:aws:iam::123456789012:role/service/discovery.
+var roleARNPattern = regexp.MustCompile(`^arn:aws(-cn|-us-gov)?:iam::\d{12}:role/[\w+=,.@/-]{1,512}$`)
+
+// ValidateRoleARN checks that arn looks like an IAM role ARN.
+func ValidateRoleARN(arn string) error {
+	if roleARNPattern.MatchString(arn) {
+		return nil
+	}
+	parts := strings.SplitN(arn, ":", 6)
+	switch {
+	case len(parts) < 6 || parts[0] != "arn":
+		return fmt.Errorf("invalid role ARN %q: expected arn:aws:iam::<account-id>:role/<name>", arn)
+	case parts[2] != "iam":
+		return fmt.Errorf("invalid role ARN %q: service is %q, expected iam", arn, parts[2])
+	case parts[3] != "":
+		return fmt.Errorf("invalid role ARN %q: IAM ARNs have no region; expected arn:aws:iam::<account-id>:role/<name>", arn)
+	case len(parts[4]) != 12 || strings.Trim(parts[4], "0123456789") != "":
+		return fmt.Errorf("invalid role ARN %q: account ID %q must be 12 digits", arn, parts[4])
+	case !strings.HasPrefix(parts[5], "role/"):
+		return fmt.Errorf("invalid role ARN %q: %q is not a role; expected role/<name>", arn, parts[5])
+	}
+	return fmt.Errorf("invalid role ARN %q: expected arn:aws:iam::<account-id>:role/<name>", arn)
+}
+
+// Partition returns the partition of arn, e.g. aws-cn, or aws if it has
+// none.
+func Partition(arn string) string {
+	if parts := strings.SplitN(arn, ":", 3); len(parts) == 3 && parts[1] != "" {
+		return parts[1]
+	}
+	return "aws"
+}
+
+// ValidateRegion returns region in canonical form or an error suggesting the
+// closest known region of partition. Regions in extra are accepted although
+// discovery does not know them, e.g. ones launched after it was built.
+func ValidateRegion(region, partition string, extra []string) (string, error) {
+	r := strings.ToLower(strings.TrimSpace(region))
+	known := KnownRegions(partition)
+	if slices.Contains(known, r) || slices.ContainsFunc(extra, func(e string) bool { return strings.EqualFold(strings.TrimSpace(e), r) }) {
+		return r, nil
+	}
+	if p := regionPartition(r); p != "" {
+		return "", fmt.Errorf("region %q is in partition %s, but the role is in %s", region, p, partition)
+	}
+	if s := closestRegion(r, known); s != "" {
+		return "", fmt.Errorf("unknown region %q, did you mean %s?", region, s)
+	}
+	return "", fmt.Errorf("unknown region %q (known regions: %s; add newer ones to aws.extra_regions)", region, strings.Join(known, ", "))
+}
+
+// regionPartition returns the partition of the known region r, or "".
+func regionPartition(r string) string {
+	if slices.Contains(Regions, r) {
+		return "aws"
+	}
+	for p, regions := range PartitionRegions {
+		if slices.Contains(regions, r) {
+			return p
+		}
+	}
+	return ""
+}
+
+// closestRegion returns the region of regions nearest to r by edit
+// distance, or "" if none is close enough to be a plausible typo.
+func closestRegion(r string, regions []string) string {
+	best, bestDist := "", 4
+	for _, known := range regions {
+		if d := editDistance(r, known); d < bestDist {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,57 @@
+package awscmd_test
+
+import (
+	"strings"
+	"testing"
+
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+)
+
+func TestValidateRegion(t *testing.T) {
+	tests := []struct {
+		region, partition string
+		extra             []string
+		want              string
+		// err is part of the error expected, if any.
+		err string
+	}{
+		{region: "us-east-1", partition: "aws", want: "us-east-1"},
+		{region: " EU-West-1 ", partition: "aws", want: "eu-west-1"},
+		{region: "us-east1", partition: "aws", err: "did you mean us-east-1?"},
+		{region: "cn-north-1", partition: "aws-cn", want: "cn-north-1"},
+		{region: "us-gov-west-1", partition: "aws-us-gov", want: "us-gov-west-1"},
+		{region: "cn-north-1", partition: "aws", err: "in partition aws-cn"},
+		{region: "us-east-1", partition: "aws-us-gov", err: "in partition aws"},
+		{region: "cn-nrth-1", partition: "aws-cn", err: "did you mean cn-north-1?"},
+		{region: "zz-nowhere-9", partition: "aws", err: "aws.extra_regions"},
+		{region: "zz-nowhere-9", partition: "aws", extra: []string{"ZZ-Nowhere-9"}, want: "zz-nowhere-9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.partition+" "+tt.region, func(t *testing.T) {
+			got, err := awscmd.ValidateRegion(tt.region, tt.partition, tt.extra)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got %q, %v; want an error with %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartition(t *testing.T) {
+	tests := map[string]string{
+		"arn:aws:iam::123456789012:role/discovery":        "aws",
+		"arn:aws-cn:iam::123456789012:role/discovery":     "aws-cn",
+		"arn:aws-us-gov:iam::123456789012:role/discovery": "aws-us-gov",
+		"": "aws",
+	}
+	for arn, want := range tests {
+		if got := awscmd.Partition(arn); got != want {
+			t.Errorf("Partition(%q) = %q, want %q", arn, got, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package awscmd
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Workers is the number of concurrent detail requests a cataloger makes.
+var Workers = 8
+
+// OrderedResults makes catalogers emit resources in listing order rather than
+// as soon as their details arrive. Ordering holds back results behind the
+// slowest outstanding request.
+var OrderedResults = false
+
+// windowPerWorker bounds how many items may be in flight (listed but not yet
+// emitted) per worker, so neither a slow consumer nor a stalled request in
+// ordered mode lets results pile up in memory.
+const windowPerWorker = 4
+
+// fanOut calls process for every item produce sends, on up to workers
+// goroutines, and passes the results to emit from the calling goroutine, so
+// emit never runs concurrently. At most workers*windowPerWorker items are in
+// flight; send blocks beyond that. An error from produce or emit stops the
+// run and is returned.
+func fanOut[T any](
+	ctx context.Context,
+	workers int,
+	ordered bool,
+	produce func(ctx context.Context, send func(T) bool) error,
+	process func(ctx context.Context, item T) discovery.Result,
+	emit func(discovery.Result) error,
+) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type job struct {
+		seq  int
+		item T
+	}
+	type done struct {
+		seq int
+		res discovery.Result
+	}
+	jobs := make(chan job)
+	results := make(chan done, workers)
+	window := make(chan struct{}, workers*windowPerWorker)
+
+	produced := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		seq := 0
+		produced <- produce(ctx, func(item T) bool {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return false
+			}
+			select {
+			case jobs <- job{seq: seq, item: item}:
+				seq++
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				r := process(ctx, j.item)
+				select {
+				case results <- done{seq: j.seq, res: r}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := map[int]discovery.Result{}
+	next := 0
+	for d := range results {
+		if !ordered {
+			if err := emit(d.res); err != nil {
+				return err
+			}
+			<-window
+			continue
+		}
+		pending[d.seq] = d.res
+		for r, ok := pending[next]; ok; r, ok = pending[next] {
+			delete(pending, next)
+			next++
+			if err := emit(r); err != nil {
+				return err
+			}
+			<-window
+		}
+	}
+
+	// Workers only stop before jobs is closed once ctx is done, and then
+	// produce returns promptly too.
+	if err := <-produced; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,103 @@
+package awscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+func TestFanOutCancel(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		ordered bool
+		// cancelAt is the item whose processing cancels the run.
+		cancelAt int
+	}{
+		{name: "one worker", workers: 1, cancelAt: 0},
+		{name: "unordered", workers: 8, cancelAt: 10},
+		{name: "ordered", workers: 8, ordered: true, cancelAt: 10},
+		// The item ahead of the others blocks until the run is cancelled,
+		// so ordered results are held behind it.
+		{name: "ordered behind cancelled", workers: 8, ordered: true, cancelAt: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var produced, emitted atomic.Int64
+			produce := func(ctx context.Context, send func(int) bool) error {
+				// An endless listing, which only cancelling stops.
+				for i := 0; ; i++ {
+					if !send(i) {
+						return nil
+					}
+					produced.Add(1)
+				}
+			}
+			process := func(ctx context.Context, i int) discovery.Result {
+				if i == tt.cancelAt {
+					cancel()
+					<-ctx.Done()
+				}
+				return discovery.Result{Service: discovery.Service{Name: fmt.Sprint(i)}}
+			}
+			emit := func(discovery.Result) error {
+				emitted.Add(1)
+				return nil
+			}
+
+			errc := make(chan error, 1)
+			go func() { errc <- fanOut(ctx, tt.workers, tt.ordered, produce, process, emit) }()
+			select {
+			case err := <-errc:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("got %v, want %v", err, context.Canceled)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("fanOut did not return after cancelling")
+			}
+			if limit := int64(tt.cancelAt + tt.workers*windowPerWorker + 1); produced.Load() > limit {
+				t.Errorf("produced %d items, want at most %d", produced.Load(), limit)
+			}
+			if emitted.Load() > produced.Load() {
+				t.Errorf("emitted %d of %d items", emitted.Load(), produced.Load())
+			}
+		})
+	}
+}
+
+func TestFanOutEmitError(t *testing.T) {
+	stop := errors.New("stop")
+	for _, ordered := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ordered %v", ordered), func(t *testing.T) {
+			emitted := 0
+			err := fanOut(context.Background(), 4, ordered,
+				func(ctx context.Context, send func(int) bool) error {
+					for i := 0; i < 1000 && send(i); i++ {
+					}
+					return nil
+				},
+				func(ctx context.Context, i int) discovery.Result { return discovery.Result{} },
+				func(discovery.Result) error {
+					emitted++
+					if emitted == 3 {
+						return stop
+					}
+					return nil
+				})
+			if !errors.Is(err, stop) {
+				t.Errorf("got %v, want %v", err, stop)
+			}
+			if emitted != 3 {
+				t.Errorf("emitted %d results after failing", emitted)
+			}
+		})
+	}
+}
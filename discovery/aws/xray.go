@@ -0,0 +1,135 @@
+package awscmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/xray"
+	xraytypes "github.com/aws/aws-sdk-go-v2/service/xray/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// serviceGraphWindow is the longest time range X-Ray returns a service graph
+// for; longer windows are read in parts.
+const serviceGraphWindow = 6 * time.Hour
+
+// ObservedRelationships returns the calls between resources that X-Ray
+// traced in region between start and end, as observed relationships from
+// caller to callee with the number of calls. Only resources X-Ray names
+// that discovery can give an ARN are included: Lambda functions, DynamoDB
+// tables, SQS queues, SNS topics, S3 buckets and state machines.
+func (p *Provider) ObservedRelationships(ctx context.Context, region string, start, end time.Time) ([]discovery.Relationship, error) {
+	clients, err := p.clients(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return observedRelationships(ctx, clients.xray, region, p.AccountID(), start, end)
+}
+
+func observedRelationships(ctx context.Context, client XRayAPI, region, account string, start, end time.Time) ([]discovery.Relationship, error) {
+	type pair struct{ from, to string }
+	byPair := map[pair]*discovery.Relationship{}
+	for from := start; from.Before(end); from = from.Add(serviceGraphWindow) {
+		to := from.Add(serviceGraphWindow)
+		if to.After(end) {
+			to = end
+		}
+		// Edges refer to services by an ID only valid within one graph,
+		// which may span pages.
+		var services []xraytypes.Service
+		p := xray.NewGetServiceGraphPaginator(client, &xray.GetServiceGraphInput{StartTime: aws.Time(from), EndTime: aws.Time(to)})
+		for s, err := range paginate(ctx, p.HasMorePages, p.NextPage, listedXRayServices) {
+			if err != nil {
+				return nil, fmt.Errorf("getting service graph: %w", err)
+			}
+			services = append(services, s)
+		}
+		byRef := map[int32]xraytypes.Service{}
+		for _, s := range services {
+			if s.ReferenceId != nil {
+				byRef[*s.ReferenceId] = s
+			}
+		}
+
+		for _, s := range services {
+			caller, callerType, ok := tracedResource(s, region, account)
+			if !ok {
+				continue
+			}
+			for _, e := range s.Edges {
+				if e.ReferenceId == nil {
+					continue
+				}
+				callee, calleeType, ok := tracedResource(byRef[*e.ReferenceId], region, account)
+				if !ok || callee == caller {
+					continue
+				}
+				r, ok := byPair[pair{caller, callee}]
+				if !ok {
+					r = &discovery.Relationship{
+						From:       caller,
+						FromType:   callerType,
+						Relation:   discovery.RelationObserved,
+						Target:     callee,
+						TargetType: calleeType,
+					}
+					byPair[pair{caller, callee}] = r
+				}
+				if stats := e.SummaryStatistics; stats != nil {
+					r.Calls += aws.ToInt64(stats.TotalCount)
+				}
+			}
+		}
+	}
+
+	rels := make([]discovery.Relationship, 0, len(byPair))
+	for _, r := range byPair {
+		rels = append(rels, *r)
+	}
+	sort.Slice(rels, func(i, j int) bool {
+		if rels[i].From != rels[j].From {
+			return rels[i].From < rels[j].From
+		}
+		return rels[i].Target < rels[j].Target
+	})
+	return rels, nil
+}
+
+func listedXRayServices(page *xray.GetServiceGraphOutput) []xraytypes.Service {
+	return page.Services
+}
+
+// tracedResource returns the ARN and type of a service in an X-Ray service
+// graph. X-Ray names resources rather than giving their ARNs; those in
+// another account than the discovered one say which.
+func tracedResource(s xraytypes.Service, region, account string) (string, discovery.ResourceType, bool) {
+	name := aws.ToString(s.Name)
+	if name == "" {
+		return "", "", false
+	}
+	if id := aws.ToString(s.AccountId); id != "" {
+		account = id
+	}
+	prefix := "arn:aws:"
+	switch typ := discovery.ResourceType(aws.ToString(s.Type)); typ {
+	// Calls to a function go to its AWS::Lambda node, which calls the
+	// function itself.
+	case discovery.ResourceTypeLambdaFunction, "AWS::Lambda":
+		return prefix + "lambda:" + region + ":" + account + ":function:" + name, discovery.ResourceTypeLambdaFunction, true
+	case discovery.ResourceTypeDynamoDBTable:
+		return prefix + "dynamodb:" + region + ":" + account + ":table/" + name, typ, true
+	case discovery.ResourceTypeSQSQueue:
+		return prefix + "sqs:" + region + ":" + account + ":" + name, typ, true
+	case discovery.ResourceTypeSNSTopic:
+		return prefix + "sns:" + region + ":" + account + ":" + name, typ, true
+	case discovery.ResourceTypeS3Bucket:
+		return prefix + "s3:::" + name, typ, true
+	case discovery.ResourceTypeStateMachine:
+		return prefix + "states:" + region + ":" + account + ":stateMachine:" + name, typ, true
+	}
+	return "", "", false
+}
@@ -0,0 +1,256 @@
+// Package backstage turns discovered services into Backstage catalog
+// entities (catalog-info.yaml), so an inventory can seed a developer portal.
+// Compute services become Components and everything else, including the
+// resources they depend on, becomes Resources.
+package backstage
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+// Annotations set on every entity.
+const (
+	AnnotationARN          = "discovery/arn"
+	AnnotationResourceType = "discovery/resource-type"
+	AnnotationAccountID    = "discovery/account-id"
+	AnnotationRegion       = "discovery/region"
+)
+
+// componentTypes maps the resource types that become Components to their
+// spec.type.
+var componentTypes = map[discovery.ResourceType]string{
+	discovery.ResourceTypeLambdaFunction: "service",
+}
+
+// resourceTypes names the spec.type of known Resources; others are derived
+// from the resource type, e.g. "s3-bucket" for AWS::S3::Bucket.
+var resourceTypes = map[discovery.ResourceType]string{
+	discovery.ResourceTypeIAMRole:       "iam-role",
+	discovery.ResourceTypeECRRepository: "container-repository",
+}
+
+// Options control how entities are filled in.
+type Options struct {
+	// OwnerTags are the tag keys tried, in order, for spec.owner, e.g.
+	// "owner" and "team".
+	OwnerTags []string
+	// DefaultOwner is used when no owner tag is set. Backstage requires an
+	// owner.
+	DefaultOwner string
+	// Lifecycle is the spec.lifecycle of Components without a "lifecycle"
+	// tag.
+	Lifecycle string
+	// Namespace is the metadata.namespace of every entity; empty means
+	// Backstage's "default".
+	Namespace string
+}
+
+// Entity is a Backstage catalog entity.
+type Entity struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   Metadata `yaml:"metadata"`
+	Spec       Spec     `yaml:"spec"`
+}
+
+type Metadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Title       string            `yaml:"title,omitempty"`
+	Description string            `yaml:"description,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type Spec struct {
+	Type      string   `yaml:"type"`
+	Lifecycle string   `yaml:"lifecycle,omitempty"`
+	Owner     string   `yaml:"owner"`
+	System    string   `yaml:"system,omitempty"`
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+}
+
+// Ref returns the entity reference other entities use to point at e, e.g.
+// "resource:default/app-role".
+func (e *Entity) Ref() string {
+	ns := e.Metadata.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+	return strings.ToLower(e.Kind) + ":" + ns + "/" + e.Metadata.Name
+}
+
+// Entities returns an entity for every node of g, in the same order, with
+// spec.dependsOn following its edges. services supplies the tags of
+// discovered nodes, keyed by discovery.Service.Key.
+func Entities(g *graph.Graph, services map[string]discovery.Service, opts Options) []Entity {
+	names := entityNames(g.Nodes)
+	entities := make([]Entity, len(g.Nodes))
+	index := make(map[string]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		index[n.ID] = i
+		svc := services[n.ID]
+		e := Entity{
+			APIVersion: "backstage.io/v1alpha1",
+			Kind:       "Resource",
+			Metadata: Metadata{
+				Name:      names[i],
+				Namespace: opts.Namespace,
+				Annotations: map[string]string{
+					AnnotationResourceType: string(n.ResourceType),
+				},
+			},
+			Spec: Spec{
+				Type:   resourceType(n.ResourceType),
+				Owner:  owner(svc.Tags, opts),
+				System: svc.Tags["system"],
+			},
+		}
+		if names[i] != n.Name {
+			e.Metadata.Title = n.Name
+		}
+		if strings.HasPrefix(n.ID, "arn:") {
+			e.Metadata.Annotations[AnnotationARN] = n.ID
+		}
+		if n.AccountID != "" {
+			e.Metadata.Annotations[AnnotationAccountID] = n.AccountID
+		}
+		if n.Region != "" {
+			e.Metadata.Annotations[AnnotationRegion] = n.Region
+		}
+		if t, ok := componentTypes[n.ResourceType]; ok {
+			e.Kind = "Component"
+			e.Spec.Type = t
+			e.Spec.Lifecycle = svc.Tags["lifecycle"]
+			if e.Spec.Lifecycle == "" {
+				e.Spec.Lifecycle = opts.Lifecycle
+			}
+		}
+		if l := svc.Details.Lambda; l != nil {
+			e.Metadata.Description = l.Description
+		}
+		entities[i] = e
+	}
+	for _, edge := range g.Edges {
+		from := &entities[index[edge.From]]
+		from.Spec.DependsOn = append(from.Spec.DependsOn, entities[index[edge.To]].Ref())
+	}
+	return entities
+}
+
+// Write writes entities to w as a multi-document catalog-info.yaml.
+func Write(w io.Writer, entities []Entity) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	for i := range entities {
+		if err := enc.Encode(&entities[i]); err != nil {
+			return fmt.Errorf("encoding entity %s: %w", entities[i].Metadata.Name, err)
+		}
+	}
+	return enc.Close()
+}
+
+func owner(tags map[string]string, opts Options) string {
+	for _, k := range opts.OwnerTags {
+		if v := tags[k]; v != "" {
+			return v
+		}
+	}
+	return opts.DefaultOwner
+}
+
+func resourceType(t discovery.ResourceType) string {
+	if s, ok := resourceTypes[t]; ok {
+		return s
+	}
+	// AWS::S3::Bucket -> s3-bucket, dropping the provider prefix.
+	parts := strings.Split(string(t), "::")
+	if len(parts) > 1 {
+		parts = parts[1:]
+	}
+	return sanitize(strings.ToLower(strings.Join(parts, "-")))
+}
+
+// entityNames gives every node a valid entity name, unique among nodes of the
+// same kind: its own name where that is unique, qualified with its region
+// and then its account where it is not.
+func entityNames(nodes []graph.Node) []string {
+	qualify := []func(graph.Node) string{
+		func(n graph.Node) string { return n.Name },
+		func(n graph.Node) string { return joinNonEmpty(n.Name, n.Region) },
+		func(n graph.Node) string { return joinNonEmpty(n.Name, n.Region, n.AccountID) },
+	}
+	kind := func(n graph.Node) string {
+		if _, ok := componentTypes[n.ResourceType]; ok {
+			return "Component"
+		}
+		return "Resource"
+	}
+	names := make([]string, len(nodes))
+	level := make([]int, len(nodes))
+	for {
+		seen := map[string][]int{}
+		for i, n := range nodes {
+			names[i] = sanitize(qualify[level[i]](n))
+			k := kind(n) + "/" + names[i]
+			seen[k] = append(seen[k], i)
+		}
+		changed := false
+		for _, idx := range seen {
+			if len(idx) < 2 {
+				continue
+			}
+			for _, i := range idx {
+				if level[i] < len(qualify)-1 {
+					level[i]++
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	// Names still shared, e.g. by twins in another provider, are numbered.
+	count := map[string]int{}
+	for i, n := range nodes {
+		k := kind(n) + "/" + names[i]
+		if count[k]++; count[k] > 1 {
+			names[i] = sanitize(fmt.Sprintf("%s-%d", names[i], count[k]))
+		}
+	}
+	return names
+}
+
+func joinNonEmpty(parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, "-")
+}
+
+var invalidName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sanitize makes s a valid Backstage entity name: at most 63 characters
+// from [A-Za-z0-9._-], starting and ending with a letter or digit.
+func sanitize(s string) string {
+	s = invalidName.ReplaceAllString(s, "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	s = strings.Trim(s, "._-")
+	if s == "" {
+		return "unnamed"
+	}
+	return s
+}
@@ -0,0 +1,305 @@
+// Package cache keeps recent discovery results on disk so repeated runs
+// within a few minutes replay them instead of repeating every API call.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// DefaultTTL is how long cached results are used when no TTL is configured.
+const DefaultTTL = 5 * time.Minute
+
+// DefaultMaxServices is the most services recorded for one resource type in
+// one region when Store.MaxServices is zero.
+const DefaultMaxServices = 50000
+
+// AccountScoped is implemented by providers that know which account they
+// scan, so cached results are never shared between accounts.
+type AccountScoped = discovery.AccountScoped
+
+// Configured is implemented by providers whose results depend on their
+// options, e.g. whether usage metrics are read, so results recorded with
+// other options are not replayed.
+type Configured interface {
+	// ScanOptions describes every option that changes what is discovered.
+	ScanOptions() string
+}
+
+// Store is a directory of cached results, one file per provider, account and
+// region, holding an entry per resource type (cataloger).
+type Store struct {
+	Dir string
+	TTL time.Duration
+	// TTLs overrides TTL per cataloger, e.g. {"lambda": time.Hour}, so
+	// slow-changing resource types are refreshed less often.
+	TTLs map[string]time.Duration
+	// Since, when set, also treats entries recorded at or after it as
+	// fresh regardless of age. Resuming an interrupted run sets it to the
+	// run's start so work already done is not repeated.
+	Since time.Time
+	// MaxServices caps how many services of one resource type in one region
+	// are held for caching. Larger scans are still streamed but not cached,
+	// bounding memory use.
+	MaxServices int
+
+	mu sync.Mutex
+}
+
+// DefaultDir returns the per-user cache directory,
+// e.g. ~/.cache/discovery on Linux.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "discovery"), nil
+}
+
+// regionFile is the on-disk form of one region's cache.
+type regionFile struct {
+	Catalogers map[string]entry `json:"catalogers"`
+}
+
+type entry struct {
+	Fetched time.Time `json:"fetched"`
+	// Options is the hash of the provider's scan options when the entry was
+	// recorded; entries of other options are misses.
+	Options  string              `json:"options,omitempty"`
+	Services []discovery.Service `json:"services"`
+}
+
+// optionsHash returns the hash of p's scan options, or "" if it has none.
+func optionsHash(p discovery.Provider) string {
+	c, ok := p.(Configured)
+	if !ok {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(c.ScanOptions()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *Store) path(provider, account, region string) string {
+	if account == "" {
+		account = "default"
+	}
+	return filepath.Join(s.Dir, provider, account, region+".json")
+}
+
+func (s *Store) load(path string) (regionFile, error) {
+	f := regionFile{Catalogers: map[string]entry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		// A corrupt cache is just a cache miss.
+		return regionFile{Catalogers: map[string]entry{}}, nil
+	}
+	if f.Catalogers == nil {
+		f.Catalogers = map[string]entry{}
+	}
+	return f, nil
+}
+
+// fresh returns the cached entries for path that are younger than the TTL
+// and were recorded with options, and whether every recorded entry is
+// fresh.
+func (s *Store) fresh(path, options string) (map[string]entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := s.load(path)
+	if err != nil {
+		return nil, false
+	}
+	fresh := map[string]entry{}
+	for name, e := range f.Catalogers {
+		if e.Options == options && s.isFresh(name, e) {
+			fresh[name] = e
+		}
+	}
+	return fresh, len(fresh) > 0 && len(fresh) == len(f.Catalogers)
+}
+
+func (s *Store) isFresh(cataloger string, e entry) bool {
+	if !s.Since.IsZero() && !e.Fetched.Before(s.Since) {
+		return true
+	}
+	ttl := s.TTL
+	if t, ok := s.TTLs[cataloger]; ok {
+		ttl = t
+	}
+	return time.Since(e.Fetched) < ttl
+}
+
+func (s *Store) save(path, cataloger string, e entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := s.load(path)
+	if err != nil {
+		return err
+	}
+	f.Catalogers[cataloger] = e
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// Write then rename so concurrent readers never see a partial file.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Clear removes every cached result.
+func (s *Store) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.RemoveAll(s.Dir)
+}
+
+// Wrap returns a provider that serves p's catalogers from s while their
+// cached results are fresh and records new results otherwise. When every
+// resource type of a region is fresh, p is not contacted at all.
+func Wrap(p discovery.Provider, s *Store) discovery.Provider {
+	return &cachedProvider{inner: p, store: s, options: optionsHash(p)}
+}
+
+type cachedProvider struct {
+	inner   discovery.Provider
+	store   *Store
+	options string
+}
+
+func (c *cachedProvider) Name() string {
+	return c.inner.Name()
+}
+
+// AccountID returns the account of the wrapped provider, if it is
+// AccountScoped, so errors are still attributed to it.
+func (c *cachedProvider) AccountID() string {
+	if scoped, ok := c.inner.(AccountScoped); ok {
+		return scoped.AccountID()
+	}
+	return ""
+}
+
+func (c *cachedProvider) Catalogers(ctx context.Context, region string) ([]discovery.Cataloger, error) {
+	path := c.store.path(c.inner.Name(), c.AccountID(), region)
+	fresh, complete := c.store.fresh(path, c.options)
+
+	// The region file lists the catalogers seen last time; if all of them
+	// are fresh there is nothing to ask the provider for.
+	if complete {
+		names := make([]string, 0, len(fresh))
+		for name := range fresh {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		catalogers := make([]discovery.Cataloger, len(names))
+		for i, name := range names {
+			catalogers[i] = &replayCataloger{name: name, services: fresh[name].Services}
+		}
+		return catalogers, nil
+	}
+
+	inner, err := c.inner.Catalogers(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	catalogers := make([]discovery.Cataloger, len(inner))
+	for i, cat := range inner {
+		if e, ok := fresh[cat.Name()]; ok {
+			catalogers[i] = &replayCataloger{name: cat.Name(), services: e.Services}
+			continue
+		}
+		catalogers[i] = &recordingCataloger{inner: cat, store: c.store, path: path, options: c.options}
+	}
+	return catalogers, nil
+}
+
+// replayCataloger emits previously recorded services.
+type replayCataloger struct {
+	name     string
+	services []discovery.Service
+}
+
+func (r *replayCataloger) Name() string {
+	return r.name
+}
+
+func (r *replayCataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	for _, s := range r.services {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := emit(discovery.Result{Service: s}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordingCataloger passes results through and caches them if the scan
+// completed without any errors and within the store's size limit.
+type recordingCataloger struct {
+	inner   discovery.Cataloger
+	store   *Store
+	path    string
+	options string
+}
+
+func (r *recordingCataloger) Name() string {
+	return r.inner.Name()
+}
+
+func (r *recordingCataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	limit := r.store.MaxServices
+	if limit <= 0 {
+		limit = DefaultMaxServices
+	}
+	var services []discovery.Service
+	clean := true
+	err := r.inner.Catalog(ctx, func(res discovery.Result) error {
+		switch {
+		case res.Err != nil:
+			clean = false
+		case len(services) >= limit:
+			// Too big to cache; stop holding on to results.
+			clean, services = false, nil
+		case clean:
+			services = append(services, res.Service)
+		}
+		return emit(res)
+	})
+	if err != nil || !clean || ctx.Err() != nil {
+		return err
+	}
+	if err := r.store.save(r.path, r.Name(), entry{Fetched: time.Now().UTC(), Options: r.options, Services: services}); err != nil {
+		// Failing to cache must not fail discovery.
+		fmt.Fprintf(os.Stderr, "Warning: caching %s results: %v\n", r.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// fakeProvider scans "lambda" and "sqs", each finding services services,
+// the first failing to describe one when fails is set.
+type fakeProvider struct {
+	options   string
+	services  int
+	fails     bool
+	contacted int
+}
+
+func (p *fakeProvider) Name() string        { return "fake" }
+func (p *fakeProvider) ScanOptions() string { return p.options }
+
+func (p *fakeProvider) Catalogers(ctx context.Context, region string) ([]discovery.Cataloger, error) {
+	p.contacted++
+	return []discovery.Cataloger{
+		&fakeCataloger{name: "lambda", services: p.services, fails: p.fails},
+		&fakeCataloger{name: "sqs", services: p.services},
+	}, nil
+}
+
+type fakeCataloger struct {
+	name     string
+	services int
+	fails    bool
+}
+
+func (c *fakeCataloger) Name() string { return c.name }
+
+func (c *fakeCataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	for i := 0; i < c.services; i++ {
+		res := discovery.Result{Service: discovery.Service{Name: fmt.Sprintf("%s-%d", c.name, i)}}
+		if c.fails && i == 0 {
+			res = discovery.Result{Err: errors.New("access denied")}
+		}
+		if err := emit(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayed returns how each cataloger of p is served from s in a region,
+// e.g. "lambda:replay sqs:scan", followed by "-" when the provider is not
+// contacted at all.
+func replayed(t *testing.T, p *fakeProvider, s *Store) string {
+	t.Helper()
+	catalogers, err := Wrap(p, s).Catalogers(context.Background(), "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range catalogers {
+		how := "scan"
+		if _, ok := c.(*replayCataloger); ok {
+			how = "replay"
+		}
+		got = append(got, c.Name()+":"+how)
+	}
+	if p.contacted == 0 {
+		got = append(got, "-")
+	}
+	return strings.Join(got, " ")
+}
+
+func TestFresh(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		ttls map[string]time.Duration
+		// since, when set, is how long before now Store.Since is.
+		since time.Duration
+		// age is how long ago each cataloger's entry was recorded.
+		age map[string]time.Duration
+		// recorded are the options the entries were recorded with.
+		recorded string
+		options  string
+		want     string
+	}{
+		{
+			name: "all fresh",
+			ttl:  5 * time.Minute,
+			age:  map[string]time.Duration{"lambda": time.Minute, "sqs": 4 * time.Minute},
+			want: "lambda:replay sqs:replay -",
+		},
+		{
+			name: "one expired",
+			ttl:  5 * time.Minute,
+			age:  map[string]time.Duration{"lambda": time.Minute, "sqs": 6 * time.Minute},
+			want: "lambda:replay sqs:scan",
+		},
+		// Only the region file records which catalogers exist, so one
+		// never recorded is not known to be missing.
+		{
+			name: "one missing",
+			ttl:  5 * time.Minute,
+			age:  map[string]time.Duration{"lambda": time.Minute},
+			want: "lambda:replay -",
+		},
+		{
+			name: "longer TTL for a cataloger",
+			ttl:  5 * time.Minute,
+			ttls: map[string]time.Duration{"lambda": time.Hour},
+			age:  map[string]time.Duration{"lambda": 30 * time.Minute, "sqs": 30 * time.Minute},
+			want: "lambda:replay sqs:scan",
+		},
+		{
+			name: "shorter TTL for a cataloger",
+			ttl:  5 * time.Minute,
+			ttls: map[string]time.Duration{"sqs": time.Minute},
+			age:  map[string]time.Duration{"lambda": 2 * time.Minute, "sqs": 2 * time.Minute},
+			want: "lambda:replay sqs:scan",
+		},
+		{
+			name:  "recorded since",
+			ttl:   5 * time.Minute,
+			since: time.Hour,
+			age:   map[string]time.Duration{"lambda": 30 * time.Minute, "sqs": 30 * time.Minute},
+			want:  "lambda:replay sqs:replay -",
+		},
+		{
+			name:  "recorded before since",
+			ttl:   5 * time.Minute,
+			since: time.Hour,
+			age:   map[string]time.Duration{"lambda": 2 * time.Hour, "sqs": time.Minute},
+			want:  "lambda:scan sqs:replay",
+		},
+		{
+			name:     "other options",
+			ttl:      5 * time.Minute,
+			age:      map[string]time.Duration{"lambda": time.Minute, "sqs": time.Minute},
+			recorded: "usage=false",
+			options:  "usage=true",
+			want:     "lambda:scan sqs:scan",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Store{Dir: t.TempDir(), TTL: tt.ttl, TTLs: tt.ttls}
+			if tt.since > 0 {
+				s.Since = time.Now().Add(-tt.since)
+			}
+			path := s.path("fake", "", "us-east-1")
+			for name, age := range tt.age {
+				e := entry{Fetched: time.Now().Add(-age), Options: optionsHash(&fakeProvider{options: tt.recorded})}
+				if err := s.save(path, name, e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := replayed(t, &fakeProvider{options: tt.options}, s); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		name        string
+		services    int
+		maxServices int
+		fails       bool
+		want        string
+	}{
+		{name: "recorded", services: 3, want: "lambda:replay sqs:replay -"},
+		{name: "at the limit", services: 3, maxServices: 3, want: "lambda:replay sqs:replay -"},
+		{name: "over the limit", services: 4, maxServices: 3, want: "lambda:scan sqs:scan"},
+		{name: "failed to describe one", services: 3, fails: true, want: "sqs:replay -"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Store{Dir: t.TempDir(), TTL: time.Hour, MaxServices: tt.maxServices}
+			p := &fakeProvider{services: tt.services, fails: tt.fails}
+			catalogers, err := Wrap(p, s).Catalogers(context.Background(), "us-east-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range catalogers {
+				emitted := 0
+				err := c.Catalog(context.Background(), func(discovery.Result) error {
+					emitted++
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Results are streamed whether or not they are cached.
+				if emitted != tt.services {
+					t.Errorf("%s emitted %d results, want %d", c.Name(), emitted, tt.services)
+				}
+			}
+			if got := replayed(t, &fakeProvider{}, s); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
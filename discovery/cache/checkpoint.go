@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint records an interrupted run so it can be resumed. Progress itself
+// lives in the cache: every resource type that finished scanning was saved
+// with its fetch time, so a resumed run replays entries fetched since Started
+// and scans only what is left.
+type Checkpoint struct {
+	Started time.Time `json:"started"`
+	RoleARN string    `json:"roleArn,omitempty"`
+	Regions []string  `json:"regions"`
+}
+
+func (s *Store) checkpointPath() string {
+	return filepath.Join(s.Dir, "checkpoint.json")
+}
+
+// LoadCheckpoint returns the saved checkpoint, or nil if there is none.
+func (s *Store) LoadCheckpoint() (*Checkpoint, error) {
+	data, err := os.ReadFile(s.checkpointPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading checkpoint: %w", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint: %w", err)
+	}
+	return &cp, nil
+}
+
+// SaveCheckpoint replaces the saved checkpoint with cp.
+func (s *Store) SaveCheckpoint(cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+	if err := os.WriteFile(s.checkpointPath(), data, 0o600); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// ClearCheckpoint removes the saved checkpoint, if any.
+func (s *Store) ClearCheckpoint() error {
+	err := os.Remove(s.checkpointPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,260 @@
+// Package cfn compares the Lambda functions CloudFormation stacks declare
+// with what a snapshot discovered, reporting the configuration that drifted
+// from the stack's template: memory, timeout, environment variable names,
+// layers, runtime and handler.
+package cfn
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Stack is a deployed CloudFormation stack.
+type Stack struct {
+	// ID is the stack's ARN.
+	ID        string
+	Name      string
+	Region    string
+	AccountID string
+	// Template is the stack's template, JSON or YAML, with any transforms
+	// processed.
+	Template string
+	// Parameters are the values of the stack's parameters, by name.
+	Parameters map[string]string
+	// Resources are the physical IDs of the stack's resources, by logical
+	// ID.
+	Resources map[string]string
+}
+
+func (s *Stack) partition() string {
+	if parts := strings.SplitN(s.ID, ":", 3); len(parts) == 3 {
+		return parts[1]
+	}
+	return "aws"
+}
+
+// Function is a Lambda function a stack declares.
+type Function struct {
+	Stack     string `json:"stack"`
+	LogicalID string `json:"logicalId"`
+	// Name is the function's physical ID.
+	Name      string `json:"name"`
+	Region    string `json:"region"`
+	AccountID string `json:"accountId"`
+	// Declared are the values the template declares, by property name;
+	// properties whose values depend on conditions or on other resources'
+	// attributes are left out.
+	Declared map[string]string `json:"declared"`
+}
+
+// properties are the function properties compared, with Lambda's value
+// for those a template may leave out; Runtime and Handler have none, since
+// image functions do not set them. Environment is formatted unresolved: only
+// the names of its variables are compared, whatever their values.
+var properties = []struct {
+	name     string
+	fallback *string
+	format   func(any) (string, bool)
+	raw      bool
+}{
+	{"MemorySize", ptr("128"), scalar, false},
+	{"Timeout", ptr("3"), scalar, false},
+	{"Runtime", nil, scalar, false},
+	{"Handler", nil, scalar, false},
+	{"Layers", ptr(""), list, false},
+	{"Environment", ptr(""), environmentKeys, true},
+}
+
+func ptr(s string) *string { return &s }
+
+// Functions returns the Lambda functions s declares, with the values of the
+// properties compared.
+func Functions(s *Stack) ([]Function, error) {
+	tmpl, err := decodeTemplate(s.Template)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the template of stack %s: %w", s.Name, err)
+	}
+	resources, _ := tmpl["Resources"].(map[string]any)
+	r := resolver{stack: s}
+	var functions []Function
+	for id, v := range resources {
+		res, _ := v.(map[string]any)
+		if res["Type"] != "AWS::Lambda::Function" || s.Resources[id] == "" {
+			continue
+		}
+		props, _ := res["Properties"].(map[string]any)
+		f := Function{Stack: s.Name, LogicalID: id, Name: s.Resources[id], Region: s.Region, AccountID: s.AccountID, Declared: map[string]string{}}
+		for _, p := range properties {
+			v, declared := props[p.name]
+			if declared && !p.raw {
+				var ok bool
+				if v, ok = r.value(v); !ok {
+					continue
+				}
+				_, none := v.(noValue)
+				declared = !none
+			}
+			if !declared {
+				if p.fallback != nil {
+					f.Declared[p.name] = *p.fallback
+				}
+				continue
+			}
+			if value, ok := p.format(v); ok {
+				f.Declared[p.name] = value
+			}
+		}
+		functions = append(functions, f)
+	}
+	sort.Slice(functions, func(i, j int) bool { return functions[i].LogicalID < functions[j].LogicalID })
+	return functions, nil
+}
+
+// intrinsic reports whether m is an intrinsic function, such as
+// {"Fn::If": ...}.
+func intrinsic(m map[string]any) bool {
+	if len(m) != 1 {
+		return false
+	}
+	for k := range m {
+		return k == "Ref" || k == "Condition" || strings.HasPrefix(k, "Fn::")
+	}
+	return false
+}
+
+func scalar(v any) (string, bool) {
+	switch v.(type) {
+	case string, int, float64, bool:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// list formats a list of strings, or a comma-delimited list parameter, as
+// "a,b".
+func list(v any) (string, bool) {
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return "", false
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		if parts[i], ok = item.(string); !ok {
+			return "", false
+		}
+	}
+	return strings.Join(parts, ","), true
+}
+
+// environmentKeys formats the names of an Environment property's variables,
+// sorted, as "A,B". The property or its variables may not be an intrinsic
+// function.
+func environmentKeys(v any) (string, bool) {
+	env, ok := v.(map[string]any)
+	if !ok || intrinsic(env) {
+		return "", false
+	}
+	vars, _ := env["Variables"].(map[string]any)
+	if intrinsic(vars) {
+		return "", false
+	}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ","), true
+}
+
+// Drift is the difference between the functions stacks declare and a
+// snapshot.
+type Drift struct {
+	// Missing lists declared functions that were not discovered.
+	Missing []Function `json:"missing"`
+	// Changed lists declared functions whose discovered configuration
+	// differs from their template.
+	Changed []Change `json:"changed"`
+	// Incomplete is set when the snapshot is not complete, so Missing may
+	// list functions that were simply not scanned.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// Change is a function whose configuration drifted from its template.
+type Change struct {
+	Function Function        `json:"function"`
+	ARN      string          `json:"arn"`
+	Drifted  []PropertyDrift `json:"drifted"`
+}
+
+// PropertyDrift is one property whose declared and discovered values
+// differ.
+type PropertyDrift struct {
+	// Name is the property's name in the template, e.g. MemorySize.
+	// Environment compares the names of the variables only.
+	Name       string `json:"name"`
+	Declared   string `json:"declared"`
+	Discovered string `json:"discovered"`
+}
+
+// Empty reports whether the snapshot matches the templates.
+func (d *Drift) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Changed) == 0
+}
+
+// Compare matches the declared functions with services by account, region
+// and name. A function in a region outside regions, those the snapshot
+// covered, is not reported missing.
+func Compare(services []discovery.Service, functions []Function, regions []string) *Drift {
+	byName := map[string]discovery.Service{}
+	for _, s := range services {
+		if s.ResourceType == discovery.ResourceTypeLambdaFunction && s.Details.Lambda != nil {
+			byName[s.AccountID+"/"+s.Region+"/"+s.Name] = s
+		}
+	}
+	d := &Drift{Missing: []Function{}, Changed: []Change{}}
+	for _, f := range functions {
+		s, ok := byName[f.AccountID+"/"+f.Region+"/"+f.Name]
+		if !ok {
+			for _, r := range regions {
+				if r == f.Region {
+					d.Missing = append(d.Missing, f)
+					break
+				}
+			}
+			continue
+		}
+		if drifted := propertyDrift(f, s.Details.Lambda); len(drifted) > 0 {
+			d.Changed = append(d.Changed, Change{Function: f, ARN: s.ARN, Drifted: drifted})
+		}
+	}
+	return d
+}
+
+func propertyDrift(f Function, l *discovery.LambdaDetails) []PropertyDrift {
+	layers := make([]string, len(l.Layers))
+	for i, layer := range l.Layers {
+		layers[i] = layer.ARN
+	}
+	discovered := map[string]string{
+		"MemorySize":  fmt.Sprint(l.MemorySize),
+		"Timeout":     fmt.Sprint(l.Timeout),
+		"Runtime":     l.Runtime,
+		"Handler":     l.Handler,
+		"Layers":      strings.Join(layers, ","),
+		"Environment": strings.Join(l.EnvironmentKeys, ","),
+	}
+	var drifted []PropertyDrift
+	for _, p := range properties {
+		declared, ok := f.Declared[p.name]
+		if ok && declared != discovered[p.name] {
+			drifted = append(drifted, PropertyDrift{Name: p.name, Declared: declared, Discovered: discovered[p.name]})
+		}
+	}
+	return drifted
+}
@@ -0,0 +1,260 @@
+package cfn
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeTemplate parses a JSON or YAML template. The short forms of
+// intrinsic functions, such as !Ref and !Sub, are expanded to their long
+// forms, {"Ref": ...} and {"Fn::Sub": ...}.
+func decodeTemplate(body string) (map[string]any, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(body), &doc); err != nil {
+		return nil, err
+	}
+	v, err := nodeValue(&doc)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("template is not a mapping")
+	}
+	return m, nil
+}
+
+func nodeValue(n *yaml.Node) (any, error) {
+	if strings.HasPrefix(n.Tag, "!") && !strings.HasPrefix(n.Tag, "!!") {
+		name := n.Tag[1:]
+		inner := *n
+		inner.Tag = ""
+		v, err := nodeValue(&inner)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "Ref", "Condition":
+			return map[string]any{name: v}, nil
+		case "GetAtt":
+			// The short form names the attribute as "Resource.Attribute".
+			if s, ok := v.(string); ok {
+				resource, attribute, _ := strings.Cut(s, ".")
+				v = []any{resource, attribute}
+			}
+		}
+		return map[string]any{"Fn::" + name: v}, nil
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return nodeValue(n.Content[0])
+	case yaml.AliasNode:
+		return nodeValue(n.Alias)
+	case yaml.MappingNode:
+		m := make(map[string]any, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v, err := nodeValue(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[n.Content[i].Value] = v
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		list := make([]any, 0, len(n.Content))
+		for _, c := range n.Content {
+			v, err := nodeValue(c)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	var v any
+	if err := n.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// noValue is what a Ref to AWS::NoValue resolves to: the property is
+// treated as not declared.
+type noValue struct{}
+
+// resolver evaluates the intrinsic functions whose values are known once a
+// stack is deployed: Ref to parameters, pseudo parameters and resources,
+// Fn::Sub and Fn::Join. Other functions, such as Fn::If and Fn::GetAtt, are
+// not resolved and their properties are not compared.
+type resolver struct {
+	stack *Stack
+}
+
+func (r resolver) ref(name string) (any, bool) {
+	switch name {
+	case "AWS::Region":
+		return r.stack.Region, true
+	case "AWS::AccountId":
+		return r.stack.AccountID, true
+	case "AWS::StackName":
+		return r.stack.Name, true
+	case "AWS::StackId":
+		return r.stack.ID, true
+	case "AWS::Partition":
+		return r.stack.partition(), true
+	case "AWS::URLSuffix":
+		if strings.HasPrefix(r.stack.Region, "cn-") {
+			return "amazonaws.com.cn", true
+		}
+		return "amazonaws.com", true
+	case "AWS::NoValue":
+		return noValue{}, true
+	}
+	if v, ok := r.stack.Parameters[name]; ok {
+		return v, true
+	}
+	if v, ok := r.stack.Resources[name]; ok {
+		return v, true
+	}
+	return nil, false
+}
+
+// value returns v with its intrinsic functions evaluated, and whether they
+// all could be.
+func (r resolver) value(v any) (any, bool) {
+	switch v := v.(type) {
+	case []any:
+		list := make([]any, 0, len(v))
+		for _, item := range v {
+			item, ok := r.value(item)
+			if !ok {
+				return nil, false
+			}
+			if _, skip := item.(noValue); !skip {
+				list = append(list, item)
+			}
+		}
+		return list, true
+	case map[string]any:
+		if len(v) == 1 {
+			for fn, arg := range v {
+				switch fn {
+				case "Ref":
+					name, ok := arg.(string)
+					if !ok {
+						return nil, false
+					}
+					return r.ref(name)
+				case "Fn::Sub":
+					return r.sub(arg)
+				case "Fn::Join":
+					return r.join(arg)
+				}
+				if strings.HasPrefix(fn, "Fn::") || fn == "Condition" {
+					return nil, false
+				}
+			}
+		}
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			item, ok := r.value(item)
+			if !ok {
+				return nil, false
+			}
+			if _, skip := item.(noValue); !skip {
+				m[k] = item
+			}
+		}
+		return m, true
+	}
+	return v, true
+}
+
+// sub evaluates Fn::Sub: a string, or a string and a map of variables.
+func (r resolver) sub(arg any) (any, bool) {
+	body, vars := "", map[string]any{}
+	switch arg := arg.(type) {
+	case string:
+		body = arg
+	case []any:
+		if len(arg) != 2 {
+			return nil, false
+		}
+		s, ok := arg[0].(string)
+		m, isMap := arg[1].(map[string]any)
+		if !ok || !isMap {
+			return nil, false
+		}
+		body = s
+		for k, v := range m {
+			if vars[k], ok = r.value(v); !ok {
+				return nil, false
+			}
+		}
+	default:
+		return nil, false
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(body, "${")
+		if i < 0 {
+			b.WriteString(body)
+			return b.String(), true
+		}
+		b.WriteString(body[:i])
+		body = body[i+2:]
+		j := strings.Index(body, "}")
+		if j < 0 {
+			return nil, false
+		}
+		name := body[:j]
+		body = body[j+1:]
+		if literal, ok := strings.CutPrefix(name, "!"); ok {
+			b.WriteString("${" + literal + "}")
+			continue
+		}
+		v, ok := vars[name]
+		if !ok {
+			if v, ok = r.ref(name); !ok {
+				return nil, false
+			}
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		b.WriteString(s)
+	}
+}
+
+// join evaluates Fn::Join: a delimiter and a list of strings.
+func (r resolver) join(arg any) (any, bool) {
+	args, ok := arg.([]any)
+	if !ok || len(args) != 2 {
+		return nil, false
+	}
+	delim, ok := args[0].(string)
+	if !ok {
+		return nil, false
+	}
+	v, ok := r.value(args[1])
+	if !ok {
+		return nil, false
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, false
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		if parts[i], ok = item.(string); !ok {
+			return nil, false
+		}
+	}
+	return strings.Join(parts, delim), true
+}
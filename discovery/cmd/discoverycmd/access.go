@@ -0,0 +1,171 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+var accessFailOnPublic bool
+
+// Risks access reports.
+const (
+	// riskAuthNone marks a function URL anyone can call without signing
+	// requests.
+	riskAuthNone = "auth-none"
+	// riskPublicPolicy marks a resource policy statement letting any
+	// principal invoke the function, unrestricted by source conditions.
+	riskPublicPolicy = "public-policy"
+	// riskWildcardPrincipal marks a statement whose principal is a
+	// wildcard restricted only by its source or organization conditions.
+	riskWildcardPrincipal = "wildcard-principal"
+)
+
+var accessCmd = &cobra.Command{
+	Use:     "access [snapshot]",
+	GroupID: groupDiscovery,
+	Short:   "Audit the function URLs and resource policies that let functions be invoked",
+	Long: `Report the Lambda functions in a snapshot (default "latest") that have a
+function URL or a resource policy allowing lambda:InvokeFunction or
+lambda:InvokeFunctionUrl, with the URL's auth type and the principals each
+statement allows, and any conditions restricting them to source ARNs,
+accounts or organizations.
+
+Functions are flagged auth-none when their URL's AuthType is NONE,
+public-policy when a statement lets any principal ("*") invoke them with no
+source condition, and wildcard-principal when a wildcard principal is only
+restricted by conditions. Flagged functions are listed first.
+--fail-on-public exits with status 1 when any function is auth-none or
+public-policy, for CI. -o json or yaml prints the report as a document.
+
+Resource policies are only recorded by runs that read them
+(aws.skip_resource_policies unset).`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		services, err := snapshotServices(id)
+		if err != nil {
+			return err
+		}
+		report := accessReport(services)
+		public := 0
+		for _, f := range report {
+			if slices.Contains(f.Risks, riskAuthNone) || slices.Contains(f.Risks, riskPublicPolicy) {
+				public++
+			}
+		}
+
+		switch strings.ToLower(OutputFormat) {
+		case "", "table":
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tREGION\tURL AUTH\tPRINCIPALS\tRISKS")
+			for _, f := range report {
+				auth, principals := "-", "-"
+				if f.AuthType != "" {
+					auth = f.AuthType
+				}
+				if len(f.Principals) > 0 {
+					principals = strings.Join(f.Principals, ",")
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f.Name, f.Region, auth, principals, strings.ToUpper(riskList(f.Risks)))
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		case "json", "yaml", "yml":
+			if err := writeDocument(cmd, report); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown access format %q (supported: table, json, yaml)", OutputFormat)
+		}
+		if public > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d functions can be invoked by anyone\n", public)
+			if accessFailOnPublic {
+				return &ExitError{Code: ExitFailure, Err: fmt.Errorf("%d functions can be invoked by anyone", public)}
+			}
+		}
+		return nil
+	},
+}
+
+// accessFunction is a function that can be invoked by its URL or resource
+// policy.
+type accessFunction struct {
+	Name   string `json:"name"`
+	ARN    string `json:"arn"`
+	Region string `json:"region"`
+	URL    string `json:"url,omitempty"`
+	// AuthType is the auth type of the function URL: "NONE" or "AWS_IAM".
+	AuthType string `json:"authType,omitempty"`
+	// Principals are those the function's policy statements allow, sorted.
+	Principals  []string                     `json:"principals"`
+	Permissions []discovery.InvokePermission `json:"permissions"`
+	Risks       []string                     `json:"risks"`
+}
+
+// accessReport returns the functions among services with a URL or invoke
+// permissions, those with risks first, then by region and name.
+func accessReport(services []discovery.Service) []accessFunction {
+	report := []accessFunction{}
+	for _, s := range services {
+		l := s.Details.Lambda
+		if l == nil || l.URL == nil && len(l.InvokePermissions) == 0 {
+			continue
+		}
+		f := accessFunction{Name: s.Name, ARN: s.ARN, Region: s.Region, Principals: []string{}, Permissions: l.InvokePermissions, Risks: []string{}}
+		if f.Permissions == nil {
+			f.Permissions = []discovery.InvokePermission{}
+		}
+		if u := l.URL; u != nil {
+			f.URL, f.AuthType = u.URL, u.AuthType
+			if u.AuthType == "NONE" {
+				f.Risks = append(f.Risks, riskAuthNone)
+			}
+		}
+		public, wildcard := false, false
+		for _, p := range l.InvokePermissions {
+			for _, principal := range p.Principals {
+				if !slices.Contains(f.Principals, principal) {
+					f.Principals = append(f.Principals, principal)
+				}
+				wildcard = wildcard || strings.ContainsAny(principal, "*?")
+			}
+			public = public || p.Public
+		}
+		sort.Strings(f.Principals)
+		switch {
+		case public:
+			f.Risks = append(f.Risks, riskPublicPolicy)
+		case wildcard:
+			f.Risks = append(f.Risks, riskWildcardPrincipal)
+		}
+		report = append(report, f)
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		if (len(a.Risks) > 0) != (len(b.Risks) > 0) {
+			return len(a.Risks) > 0
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Name < b.Name
+	})
+	return report
+}
+
+func init() {
+	accessCmd.Flags().BoolVar(&accessFailOnPublic, "fail-on-public", false, "exit with status 1 when any function can be invoked by anyone")
+}
@@ -0,0 +1,504 @@
+package discoverycmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/graph"
+	"github.com/jamesneb/causal/discovery/sink"
+	"github.com/jamesneb/causal/discovery/snapshot"
+)
+
+// Pages of services hold defaultPageSize services unless the limit
+// parameter asks for another number, up to maxPageSize.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// catalogAPI serves the newest snapshot over HTTP under /api/v1, as JSON
+// and GraphQL, and over gRPC; see catalogServer. The snapshot is loaded into
+// memory when serving starts and after every run, so requests never wait for
+// the database a run holds. It is safe for concurrent use.
+type catalogAPI struct {
+	mu      sync.RWMutex
+	catalog *catalog
+	// baseline is the last complete snapshot, which new ones are compared
+	// with for the subscribers.
+	baseline    *catalog
+	subscribers map[chan []catalogChange]bool
+}
+
+// catalogChange is a service a new snapshot added, changed or removed
+// compared with the baseline.
+type catalogChange struct {
+	Snapshot string
+	Baseline string
+	Kind     sink.ChangeKind
+	Service  discovery.Service
+	// Fields are the JSON fields of a changed service that differ.
+	Fields []string
+}
+
+// subscriberBuffer is how many snapshots' changes a subscriber may fall
+// behind by before it is dropped.
+const subscriberBuffer = 4
+
+// catalog is a snapshot loaded for the API; it does not change once loaded.
+type catalog struct {
+	snap     snapshot.Snapshot
+	services []discovery.Service
+	byKey    map[string]int
+	graph    *graph.Graph
+	// from and to index the graph's edges by the node they leave and the
+	// one they reach.
+	from, to map[string][]graph.Edge
+}
+
+// refresh loads the newest snapshot and sends how it differs from the
+// baseline to the subscribers. Failing to load it is reported and the
+// snapshot served so far is kept.
+func (a *catalogAPI) refresh() {
+	if NoSnapshot || Cfg.Snapshots.Disabled {
+		return
+	}
+	store, err := openSnapshots()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not serving the latest snapshot: %v\n", err)
+		return
+	}
+	defer store.Close()
+	snap, err := store.Get("latest")
+	if errors.Is(err, snapshot.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not serving the latest snapshot: %v\n", err)
+		return
+	}
+	a.mu.RLock()
+	served, baseline := a.catalog, a.baseline
+	a.mu.RUnlock()
+	if served != nil && served.snap.ID == snap.ID {
+		return
+	}
+	c, err := loadCatalog(store, snap)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not serving snapshot %s: %v\n", snap.ID, err)
+		return
+	}
+	if served == nil && !snap.Complete() {
+		// Serving starts after a partial run; compare the next with the
+		// last complete one.
+		baseline = lastComplete(store)
+	}
+
+	var changes []catalogChange
+	if baseline != nil {
+		changes = c.changesFrom(baseline)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.catalog = c
+	if snap.Complete() {
+		a.baseline = c
+	} else if a.baseline == nil {
+		a.baseline = baseline
+	}
+	if changes == nil {
+		return
+	}
+	for ch := range a.subscribers {
+		select {
+		case ch <- changes:
+		default:
+			// A subscriber too slow to keep up is dropped rather than
+			// holding back the next refresh.
+			delete(a.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// loadCatalog loads the services of snap from store.
+func loadCatalog(store *snapshot.Store, snap snapshot.Snapshot) (*catalog, error) {
+	c := &catalog{snap: snap, byKey: map[string]int{}, graph: graph.New()}
+	keys := ownerTags()
+	err := store.Services(snap.ID, func(s discovery.Service) error {
+		s.SetOwner(keys)
+		c.byKey[s.Key()] = len(c.services)
+		c.services = append(c.services, s)
+		c.graph.Add(s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.from, c.to = map[string][]graph.Edge{}, map[string][]graph.Edge{}
+	for _, e := range c.graph.Edges {
+		c.from[e.From] = append(c.from[e.From], e)
+		c.to[e.To] = append(c.to[e.To], e)
+	}
+	return c, nil
+}
+
+// lastComplete loads the newest complete snapshot in store, or returns nil
+// when there is none or it cannot be read.
+func lastComplete(store *snapshot.Store) *catalog {
+	snaps, err := store.List()
+	if err != nil {
+		return nil
+	}
+	for _, snap := range snaps {
+		if snap.Complete() {
+			c, err := loadCatalog(store, snap)
+			if err != nil {
+				return nil
+			}
+			return c
+		}
+	}
+	return nil
+}
+
+// changesFrom returns how c differs from baseline, in key order. Removals
+// are only included when c is complete.
+func (c *catalog) changesFrom(baseline *catalog) []catalogChange {
+	tracker := sink.NewChanges(baseline.snap.ID, baseline.services)
+	changes := []catalogChange{}
+	for _, s := range c.services {
+		if kind, fields := tracker.Observe(s); kind != "" {
+			changes = append(changes, catalogChange{Snapshot: c.snap.ID, Baseline: baseline.snap.ID, Kind: kind, Service: s, Fields: fields})
+		}
+	}
+	if c.snap.Complete() {
+		for _, s := range tracker.Removed() {
+			changes = append(changes, catalogChange{Snapshot: c.snap.ID, Baseline: baseline.snap.ID, Kind: sink.ChangeRemoved, Service: s})
+		}
+	}
+	return changes
+}
+
+// subscribe returns a channel receiving the changes of every snapshot
+// loaded from now on, and a function ending the subscription. The channel
+// is closed when the subscriber falls too far behind.
+func (a *catalogAPI) subscribe() (<-chan []catalogChange, func()) {
+	ch := make(chan []catalogChange, subscriberBuffer)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.subscribers == nil {
+		a.subscribers = map[chan []catalogChange]bool{}
+	}
+	a.subscribers[ch] = true
+	return ch, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.subscribers[ch] {
+			delete(a.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// register adds the API's routes to mux.
+func (a *catalogAPI) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/snapshot", a.serveSnapshot)
+	mux.HandleFunc("GET /api/v1/services", a.serveServices)
+	mux.HandleFunc("GET /api/v1/services/{key...}", a.serveService)
+	mux.HandleFunc("GET /api/v1/graph", a.serveGraph)
+	mux.Handle("POST /api/v1/graphql", a.graphQL())
+}
+
+// current returns the catalog served, answering the request itself when
+// there is none yet.
+func (a *catalogAPI) current(w http.ResponseWriter) (*catalog, bool) {
+	a.mu.RLock()
+	c := a.catalog
+	a.mu.RUnlock()
+	if c == nil {
+		apiError(w, http.StatusServiceUnavailable, "no snapshot recorded yet")
+		return nil, false
+	}
+	return c, true
+}
+
+// notModified tags the response with the ID of snapshot, as snapshots never
+// change once recorded, and answers the request itself when the client's
+// copy, named by If-None-Match, is of that snapshot.
+func notModified(w http.ResponseWriter, r *http.Request, snapshot string) bool {
+	etag := strconv.Quote(snapshot)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// serveSnapshot writes the record of the snapshot served, with its run
+// report.
+func (a *catalogAPI) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.current(w)
+	if !ok || notModified(w, r, c.snap.ID) {
+		return
+	}
+	writeJSON(w, c.snap)
+}
+
+// servicePage is a page of the services matching a request.
+type servicePage struct {
+	Snapshot string `json:"snapshot"`
+	// Total is the number of matching services, of which the page holds
+	// those from Offset on.
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	// Next is the URL of the following page, when there is one.
+	Next     string              `json:"next,omitempty"`
+	Services []discovery.Service `json:"services"`
+}
+
+// serveServices writes a page of the services matching the q, type, region
+// and account parameters, in key order.
+func (a *catalogAPI) serveServices(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	offset, limit, err := pageParams(params)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c, ok := a.current(w)
+	if !ok || notModified(w, r, c.snap.ID) {
+		return
+	}
+	page := servicePage{Snapshot: c.snap.ID, Offset: offset, Limit: limit}
+	page.Services, page.Total = c.page(newServiceFilter(params), offset, limit)
+	if offset+limit < page.Total {
+		next := url.Values{}
+		for k, v := range params {
+			next[k] = v
+		}
+		next.Set("offset", strconv.Itoa(offset+limit))
+		next.Set("limit", strconv.Itoa(limit))
+		page.Next = r.URL.Path + "?" + next.Encode()
+	}
+	writeJSON(w, page)
+}
+
+// page returns at most limit of the services matching filter from offset
+// on, and how many match.
+func (c *catalog) page(filter serviceFilter, offset, limit int) ([]discovery.Service, int) {
+	services, total := []discovery.Service{}, 0
+	for _, s := range c.services {
+		if !filter.match(s) {
+			continue
+		}
+		if total >= offset && len(services) < limit {
+			services = append(services, s)
+		}
+		total++
+	}
+	return services, total
+}
+
+// pageParams parses the offset and limit parameters.
+func pageParams(params url.Values) (offset, limit int, err error) {
+	limit = defaultPageSize
+	if v := params.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset %q is not a non-negative integer", v)
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, fmt.Errorf("limit %q is not between 1 and %d", v, maxPageSize)
+		}
+	}
+	return offset, limit, nil
+}
+
+// serviceFilter selects services by words found in their names, ARNs or
+// tags, and by type, region and account. Each filter parameter may be
+// repeated or hold several comma-separated values, any of which matches.
+type serviceFilter struct {
+	words    []string
+	types    []string
+	regions  []string
+	accounts []string
+}
+
+func newServiceFilter(params url.Values) serviceFilter {
+	values := func(name string) []string {
+		var vs []string
+		for _, v := range params[name] {
+			for _, part := range strings.Split(v, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					vs = append(vs, part)
+				}
+			}
+		}
+		return vs
+	}
+	return filterOf(params.Get("q"), values("type"), values("region"), values("account"))
+}
+
+// filterOf returns the filter of the search query and the types, regions
+// and accounts given.
+func filterOf(query string, types, regions, accounts []string) serviceFilter {
+	return serviceFilter{words: strings.Fields(strings.ToLower(query)), types: types, regions: regions, accounts: accounts}
+}
+
+// match reports whether s has every word of the search, case-insensitively,
+// and one of the types, regions and accounts asked for. Accounts match by
+// ID or alias.
+func (f serviceFilter) match(s discovery.Service) bool {
+	if !matchAny(f.types, string(s.ResourceType)) || !matchAny(f.regions, s.Region) || !matchAny(f.accounts, s.AccountID, s.AccountAlias) {
+		return false
+	}
+	if len(f.words) == 0 {
+		return true
+	}
+	text := []string{strings.ToLower(s.Name), strings.ToLower(s.ARN)}
+	for k, v := range s.Tags {
+		text = append(text, strings.ToLower(k), strings.ToLower(v))
+	}
+	for _, w := range f.words {
+		found := false
+		for _, t := range text {
+			if strings.Contains(t, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether want is empty or holds one of have.
+func matchAny(want []string, have ...string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for _, w := range want {
+		for _, h := range have {
+			if h != "" && strings.EqualFold(w, h) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveService writes the service whose key, usually its ARN, ends the
+// path.
+func (a *catalogAPI) serveService(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.current(w)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	i, found := c.byKey[key]
+	if !found {
+		apiError(w, http.StatusNotFound, fmt.Sprintf("no service %s in the snapshot", key))
+		return
+	}
+	if notModified(w, r, c.snap.ID) {
+		return
+	}
+	writeJSON(w, c.services[i])
+}
+
+// serveGraph writes the dependency graph of the snapshot, as graph -o json
+// does. With node, a node ID or name, it is only the graph of that node and
+// those reachable from it in direction (default downstream) by at most
+// depth edges (default any number).
+func (a *catalogAPI) serveGraph(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	direction := graph.Downstream
+	if v := params.Get("direction"); v != "" {
+		var err error
+		if direction, err = graph.ParseDirection(v); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	depth := 0
+	if v := params.Get("depth"); v != "" {
+		var err error
+		if depth, err = strconv.Atoi(v); err != nil || depth < 0 {
+			apiError(w, http.StatusBadRequest, fmt.Sprintf("depth %q is not a non-negative integer", v))
+			return
+		}
+	}
+	c, ok := a.current(w)
+	if !ok {
+		return
+	}
+	ref := params.Get("node")
+	if ref == "" {
+		if !notModified(w, r, c.snap.ID) {
+			writeJSON(w, c.graph)
+		}
+		return
+	}
+	g, err := c.subgraph(ref, direction, depth)
+	switch {
+	case errors.Is(err, errNoNode):
+		apiError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		apiError(w, http.StatusBadRequest, err.Error())
+	case !notModified(w, r, c.snap.ID):
+		writeJSON(w, g)
+	}
+}
+
+// errNoNode is returned by subgraph for references to no node.
+var errNoNode = errors.New("no such node in the graph")
+
+// subgraph returns the graph of the node ref, an ID or a name, and the
+// nodes reachable from it in direction by at most depth edges, or any
+// number when depth is below 1.
+func (c *catalog) subgraph(ref string, direction graph.Direction, depth int) (*graph.Graph, error) {
+	nodes := c.graph.Lookup(ref)
+	switch len(nodes) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", errNoNode, ref)
+	case 1:
+	default:
+		return nil, fmt.Errorf("%d nodes are named %s; give the ID of one", len(nodes), ref)
+	}
+	ids := []string{nodes[0].ID}
+	for _, reached := range c.graph.Reachable(nodes[0].ID, direction, depth) {
+		ids = append(ids, reached.Node.ID)
+	}
+	return c.graph.Subgraph(ids), nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiError writes an error response with message as its JSON error field.
+func apiError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{message})
+}
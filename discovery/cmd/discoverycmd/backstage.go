@@ -0,0 +1,56 @@
+package discoverycmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/backstage"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+var backstageOpts backstage.Options
+
+var backstageCmd = &cobra.Command{
+	Use:     "backstage [snapshot]",
+	GroupID: groupExport,
+	Short:   "Write Backstage catalog entities for a snapshot",
+	Long: `Write a catalog-info.yaml with a Backstage entity for every service in a
+snapshot (default "latest") and every resource they depend on. Lambda
+functions become Components; roles, repositories and other resources become
+Resources. spec.owner comes from the first --owner-tag set on the service,
+spec.dependsOn from the dependency graph.
+
+  discovery backstage > catalog-info.yaml`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		g := graph.New()
+		services := map[string]discovery.Service{}
+		err = store.Services(id, func(s discovery.Service) error {
+			g.Add(s)
+			services[s.Key()] = s
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return backstage.Write(cmd.OutOrStdout(), backstage.Entities(g, services, backstageOpts))
+	},
+}
+
+func init() {
+	backstageCmd.Flags().StringSliceVar(&backstageOpts.OwnerTags, "owner-tag", []string{"owner", "team"}, "tags tried in order for spec.owner")
+	backstageCmd.Flags().StringVar(&backstageOpts.DefaultOwner, "default-owner", "unknown", "spec.owner of entities without an owner tag")
+	backstageCmd.Flags().StringVar(&backstageOpts.Lifecycle, "lifecycle", "production", `spec.lifecycle of components without a "lifecycle" tag`)
+	backstageCmd.Flags().StringVar(&backstageOpts.Namespace, "namespace", "", "metadata.namespace of every entity (default Backstage's default namespace)")
+}
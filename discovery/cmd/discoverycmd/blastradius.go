@@ -0,0 +1,148 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/graph"
+	"github.com/jamesneb/causal/discovery/output"
+)
+
+var (
+	blastSnapshot string
+	blastDepth    int
+)
+
+var graphBlastRadiusCmd = &cobra.Command{
+	Use:   "blast-radius <service>",
+	Short: "Show the services affected if a service fails",
+	Long: `Show the services that would be affected if a service failed: every
+discovered service depending on it, directly or through other resources, in
+the dependency graph of a snapshot (--snapshot, default "latest"). The
+service is named by its ARN or, when that is unambiguous, its name. --depth
+limits how many edges away to look; 0 follows them all.
+
+The affected services are counted per owner (see --owner-tags), or per
+--group-by account, region, type, provider or tag:<key>, and listed with
+their distance and the edge they were first reached by. Resources discovery
+only found referenced, such as IAM roles, carry the failure on but are not
+counted. -o json or yaml prints them as a document, and -o dot, mermaid or
+svg draws the service and what depends on it, e.g.
+  discovery graph blast-radius orders-table -o dot | dot -Tsvg > impact.svg`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		groupBy := GroupBy
+		if groupBy == "" {
+			groupBy = "owner"
+		}
+		if err := graph.CheckGroupKey(groupBy); err != nil {
+			return err
+		}
+		g, err := snapshotGraph(blastSnapshot)
+		if err != nil {
+			return err
+		}
+		start, err := lookupNode(g, args[0])
+		if err != nil {
+			return err
+		}
+		reached := g.Reachable(start.ID, graph.Upstream, blastDepth)
+		doc := blastRadius(start, reached, groupBy)
+
+		switch f := strings.ToLower(OutputFormat); f {
+		case "", "table":
+			w := cmd.OutOrStdout()
+			fmt.Fprintf(w, "%d services affected if %s fails\n\n", len(doc.Affected), start.Name)
+			if len(doc.Affected) == 0 {
+				return nil
+			}
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "GROUP\tSERVICES")
+			for _, c := range doc.Groups {
+				fmt.Fprintf(tw, "%s\t%d\n", c.Group, c.Services)
+			}
+			fmt.Fprintln(tw, "")
+			fmt.Fprintln(tw, "DEPTH\tGROUP\tNAME\tTYPE\tID")
+			for _, a := range doc.Affected {
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", a.Depth, a.Group, a.Node.Name, a.Node.ResourceType, a.Node.ID)
+			}
+			return tw.Flush()
+		case "json", "yaml", "yml":
+			return writeDocument(cmd, doc)
+		case "dot", "mermaid", "svg":
+			ids := []string{start.ID}
+			for _, r := range reached {
+				ids = append(ids, r.Node.ID)
+			}
+			sub := g.Subgraph(ids)
+			switch f {
+			case "dot":
+				return sub.WriteDOT(cmd.OutOrStdout())
+			case "mermaid":
+				return sub.WriteMermaid(cmd.OutOrStdout())
+			}
+			return sub.WriteSVG(cmd.OutOrStdout())
+		default:
+			return fmt.Errorf("unknown blast-radius format %q (supported: table, json, yaml, dot, mermaid, svg)", OutputFormat)
+		}
+	},
+}
+
+// blastDocument is the JSON and YAML output of graph blast-radius.
+type blastDocument struct {
+	Service  graph.Node     `json:"service"`
+	Groups   []groupCount   `json:"groups"`
+	Affected []affectedNode `json:"affected"`
+}
+
+// groupCount is the number of affected services of one group.
+type groupCount struct {
+	Group    string `json:"group"`
+	Services int    `json:"services"`
+}
+
+// affectedNode is a service that fails with the one queried.
+type affectedNode struct {
+	graph.Reached
+	Group string `json:"group"`
+}
+
+// blastRadius returns the discovered services of reached, grouped by
+// groupBy, largest group first.
+func blastRadius(start graph.Node, reached []graph.Reached, groupBy string) blastDocument {
+	doc := blastDocument{Service: start, Groups: []groupCount{}, Affected: []affectedNode{}}
+	counts := map[string]int{}
+	for _, r := range reached {
+		if r.Node.External {
+			continue
+		}
+		group := r.Node.Group(groupBy)
+		if group == "" {
+			group = output.Ungrouped
+		}
+		counts[group]++
+		doc.Affected = append(doc.Affected, affectedNode{Reached: r, Group: group})
+	}
+	for group, n := range counts {
+		doc.Groups = append(doc.Groups, groupCount{Group: group, Services: n})
+	}
+	sort.Slice(doc.Groups, func(i, j int) bool {
+		a, b := doc.Groups[i], doc.Groups[j]
+		if a.Services != b.Services {
+			return a.Services > b.Services
+		}
+		return a.Group < b.Group
+	})
+	return doc
+}
+
+func init() {
+	graphBlastRadiusCmd.Flags().StringVar(&blastSnapshot, "snapshot", "latest", "snapshot whose graph to query")
+	graphBlastRadiusCmd.Flags().IntVar(&blastDepth, "depth", 0, "most edges away to look (0 for no limit)")
+	graphCmd.AddCommand(graphBlastRadiusCmd)
+}
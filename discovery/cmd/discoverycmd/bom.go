@@ -0,0 +1,47 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/cyclonedx"
+)
+
+var bomCmd = &cobra.Command{
+	Use:     "bom [snapshot]",
+	Aliases: []string{"sbom"},
+	GroupID: groupExport,
+	Short:   "Write a CycloneDX inventory of a snapshot",
+	Long: `Write a CycloneDX ` + cyclonedx.SpecVersion + ` JSON document listing every service in a snapshot
+(default "latest") as a component, with the deployment packages, container
+images and Lambda layers it runs as components it depends on.
+
+  discovery bom > inventory.cdx.json`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if f := strings.ToLower(OutputFormat); f != "" && f != "cyclonedx" && f != "json" {
+			return fmt.Errorf("unknown bom format %q (supported: cyclonedx)", OutputFormat)
+		}
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		snap, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		services, err := store.LoadServices(snap.ID)
+		if err != nil {
+			return err
+		}
+		return cyclonedx.Write(cmd.OutOrStdout(), cyclonedx.New(services, snap.ID, snap.Finished))
+	},
+}
@@ -0,0 +1,189 @@
+package discoverycmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+var (
+	changesSnapshot string
+	changesStart    string
+	changesEnd      string
+	changesLookback time.Duration
+	changesDepth    int
+)
+
+var graphChangesCmd = &cobra.Command{
+	Use:   "changes <service>",
+	Short: "List the changes that may have caused an incident",
+	Long: `List the configuration changes CloudTrail logged to a service and the
+resources it depends on, as the dependency graph of a snapshot (--snapshot,
+default "latest") shows them, around an incident affecting the service:
+from --lookback before the incident's --start until its --end (default
+now). The service is named by its ARN or, when that is unambiguous, its
+name. --depth limits how many edges away to look; 0 follows them all.
+
+Changes are ranked by a score of how recent they were and how close to the
+service: 1 for a change to the service itself during the incident, falling
+to 0 for changes --lookback before it, divided by one more than the number
+of edges between the resource changed and the service. Changes are read
+from CloudTrail event history with the configured role, which needs
+cloudtrail:LookupEvents; changes to IAM roles and other global resources
+are read in us-east-1. -o json or yaml prints the ranking as a document.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if changesStart == "" {
+			return errors.New("--start is required: when the incident began, RFC 3339")
+		}
+		start, err := time.Parse(time.RFC3339, changesStart)
+		if err != nil {
+			return fmt.Errorf("--start: %w", err)
+		}
+		end := time.Now()
+		if changesEnd != "" {
+			if end, err = time.Parse(time.RFC3339, changesEnd); err != nil {
+				return fmt.Errorf("--end: %w", err)
+			}
+		}
+		if end.Before(start) {
+			return errors.New("--end is before --start")
+		}
+		if changesLookback < 0 {
+			return errors.New("--lookback must not be negative")
+		}
+		from := start.Add(-changesLookback)
+		if time.Since(from) > eventHistoryRetention {
+			return fmt.Errorf("--start minus --lookback is longer ago than the %d days event history keeps events", int(eventHistoryRetention.Hours()/24))
+		}
+
+		g, err := snapshotGraph(changesSnapshot)
+		if err != nil {
+			return err
+		}
+		service, err := lookupNode(g, args[0])
+		if err != nil {
+			return err
+		}
+		depths := map[string]int{service.ID: 0}
+		for _, r := range g.Reachable(service.ID, graph.Downstream, changesDepth) {
+			depths[r.Node.ID] = r.Depth
+		}
+		ids := make([]string, 0, len(depths))
+		for id := range depths {
+			ids = append(ids, id)
+		}
+		sub := g.Subgraph(ids)
+
+		ctx, cancel, provider, _, err := graphProvider(cmd.Context(), sub)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		byRegion := map[string][]string{}
+		for _, n := range sub.Nodes {
+			if n.Provider != "aws" || !strings.HasPrefix(n.ID, "arn:") {
+				continue
+			}
+			region := n.Region
+			if region == "" {
+				region = awscmd.IAMEventRegion
+			}
+			byRegion[region] = append(byRegion[region], n.ID)
+		}
+		regions := make([]string, 0, len(byRegion))
+		for region := range byRegion {
+			regions = append(regions, region)
+		}
+		sort.Strings(regions)
+		var changes []awscmd.Change
+		var errs []error
+		for _, region := range regions {
+			c, err := provider.Changes(ctx, region, from, end, byRegion[region])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", region, err))
+				continue
+			}
+			changes = append(changes, c...)
+		}
+		if err := errors.Join(errs...); err != nil {
+			return fmt.Errorf("reading CloudTrail event history: %w", err)
+		}
+		ranked := rankChanges(sub, changes, depths, start, changesLookback)
+		fmt.Fprintf(os.Stderr, "Found %d changes to %d resources\n", len(ranked), len(depths))
+
+		switch strings.ToLower(OutputFormat) {
+		case "", "table":
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "SCORE\tTIME\tDEPTH\tNAME\tTYPE\tEVENT\tACTOR")
+			for _, c := range ranked {
+				fmt.Fprintf(tw, "%.2f\t%s\t%d\t%s\t%s\t%s\t%s\n", c.Score, c.Time.UTC().Format(time.RFC3339), c.Depth, c.Node.Name, c.Node.ResourceType, c.Event, c.Actor)
+			}
+			return tw.Flush()
+		case "json", "yaml", "yml":
+			return writeDocument(cmd, changesDocument{Service: service, Start: start, End: end, Changes: ranked})
+		default:
+			return fmt.Errorf("unknown changes format %q (supported: table, json, yaml)", OutputFormat)
+		}
+	},
+}
+
+// changesDocument is the JSON and YAML output of graph changes.
+type changesDocument struct {
+	Service graph.Node     `json:"service"`
+	Start   time.Time      `json:"start"`
+	End     time.Time      `json:"end"`
+	Changes []rankedChange `json:"changes"`
+}
+
+// rankedChange is a change with the resource changed and its score.
+type rankedChange struct {
+	awscmd.Change
+	Node graph.Node `json:"node"`
+	// Depth is the number of edges from the service to the resource.
+	Depth int     `json:"depth"`
+	Score float64 `json:"score"`
+}
+
+// rankChanges scores changes to the nodes of g at depths for an incident
+// beginning at start, highest first: the recency of a change, 1 from start
+// on and falling to 0 lookback before it, divided by one more than its
+// depth. Equal scores are newest first.
+func rankChanges(g *graph.Graph, changes []awscmd.Change, depths map[string]int, start time.Time, lookback time.Duration) []rankedChange {
+	ranked := make([]rankedChange, 0, len(changes))
+	for _, c := range changes {
+		n, _ := g.Node(c.Resource)
+		depth := depths[c.Resource]
+		recency := 1.0
+		if age := start.Sub(c.Time); age > 0 && lookback > 0 {
+			recency = max(0, 1-float64(age)/float64(lookback))
+		}
+		ranked = append(ranked, rankedChange{Change: c, Node: n, Depth: depth, Score: recency / float64(1+depth)})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Time.After(ranked[j].Time)
+	})
+	return ranked
+}
+
+func init() {
+	graphChangesCmd.Flags().StringVar(&changesSnapshot, "snapshot", "latest", "snapshot whose graph to follow")
+	graphChangesCmd.Flags().StringVar(&changesStart, "start", "", "when the incident began, RFC 3339 (required)")
+	graphChangesCmd.Flags().StringVar(&changesEnd, "end", "", "when the incident ended, RFC 3339 (default now)")
+	graphChangesCmd.Flags().DurationVar(&changesLookback, "lookback", 24*time.Hour, "how long before --start to look for changes")
+	graphChangesCmd.Flags().IntVar(&changesDepth, "depth", 0, "most edges away from the service to look (0 for all)")
+	graphCmd.AddCommand(graphChangesCmd)
+}
@@ -0,0 +1,134 @@
+package discoverycmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/cfn"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+var (
+	cfnStacks      []string
+	cfnStackRegion string
+)
+
+var cloudformationCmd = &cobra.Command{
+	Use:          "cloudformation",
+	Aliases:      []string{"cfn"},
+	GroupID:      groupExport,
+	Short:        "Compare discovered functions with their CloudFormation stacks",
+	SilenceUsage: true,
+}
+
+var cloudformationDriftCmd = &cobra.Command{
+	Use:   "drift [snapshot]",
+	Short: "Compare the Lambda functions stacks declare with a snapshot",
+	Long: `Compare the Lambda functions declared by CloudFormation stacks (--stack,
+repeatable, a name or ARN) with a snapshot (default "latest") and report:
+
+  - declared functions that were not discovered in the snapshot's regions
+  ~ functions whose MemorySize, Timeout, Runtime, Handler, Layers or
+    environment variable names differ from the template
+
+Each stack's processed template, with transforms such as SAM expanded, is
+read with the configured role, in the region of its ARN or --stack-region.
+Properties set with Ref to parameters and resources, Fn::Sub and Fn::Join
+are resolved; those depending on conditions or on other resources'
+attributes are not compared. Only the names of environment variables are
+compared, since their values are not recorded.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(cfnStacks) == 0 {
+			return errors.New("pass --stack")
+		}
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		snap, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		services, err := store.LoadServices(snap.ID)
+		if err != nil {
+			return err
+		}
+
+		g := graph.New()
+		for _, s := range services {
+			if s.ResourceType == discovery.ResourceTypeLambdaFunction {
+				g.Add(s)
+			}
+		}
+		ctx, cancel, provider, regions, err := graphProvider(cmd.Context(), g)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		var functions []cfn.Function
+		for _, name := range cfnStacks {
+			region := cfnStackRegion
+			if parts := strings.SplitN(name, ":", 6); len(parts) == 6 && parts[0] == "arn" {
+				region = parts[3]
+			}
+			if region == "" {
+				if len(regions) != 1 {
+					return fmt.Errorf("stack %s: pass --stack-region or the stack's ARN", name)
+				}
+				region = regions[0]
+			}
+			stack, err := provider.Stack(ctx, region, name)
+			if err != nil {
+				return err
+			}
+			fs, err := cfn.Functions(stack)
+			if err != nil {
+				return err
+			}
+			functions = append(functions, fs...)
+		}
+		d := cfn.Compare(services, functions, snap.Regions)
+		d.Incomplete = !snap.Complete()
+
+		if isDocumentFormat(OutputFormat) {
+			return writeDocument(cmd, d)
+		}
+		if d.Incomplete {
+			fmt.Fprintln(os.Stderr, "Warning: comparing against an incomplete snapshot; missing functions may only reflect what was scanned")
+		}
+		w := cmd.OutOrStdout()
+		fmt.Fprintf(w, "Comparing %d declared functions with snapshot %s\n", len(functions), snap.ID)
+		if d.Empty() {
+			fmt.Fprintln(w, "No drift")
+			return nil
+		}
+		for _, f := range d.Missing {
+			fmt.Fprintf(w, "- %s/%s (%s)\n", f.Stack, f.LogicalID, f.Name)
+		}
+		for _, c := range d.Changed {
+			fmt.Fprintf(w, "~ %s/%s (%s)\n", c.Function.Stack, c.Function.LogicalID, c.Function.Name)
+			for _, p := range c.Drifted {
+				fmt.Fprintf(w, "    %s: %q -> %q\n", p.Name, p.Declared, p.Discovered)
+			}
+		}
+		fmt.Fprintf(w, "%d missing, %d drifted\n", len(d.Missing), len(d.Changed))
+		return nil
+	},
+}
+
+func init() {
+	cloudformationCmd.AddCommand(cloudformationDriftCmd)
+	cloudformationDriftCmd.Flags().StringArrayVar(&cfnStacks, "stack", nil, "name or ARN of a stack to compare (repeatable)")
+	cloudformationDriftCmd.Flags().StringVar(&cfnStackRegion, "stack-region", "", "region of stacks given by name (default the snapshot's, when it has one)")
+}
@@ -0,0 +1,294 @@
+package discoverycmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/code"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+var (
+	codeSnapshot   string
+	codeDest       string
+	codeDestRegion string
+	codeMaxSize    int64
+	codeParallel   int
+	codeAttempts   int
+)
+
+var codeCmd = &cobra.Command{
+	Use:          "code",
+	GroupID:      groupDiscovery,
+	Short:        "Download the deployment packages of discovered functions",
+	SilenceUsage: true,
+}
+
+var codePullCmd = &cobra.Command{
+	Use:   "pull [function...]",
+	Short: "Download function ZIP packages to a directory or S3 prefix",
+	Long: `Download the ZIP deployment packages of the Lambda functions in a snapshot
+(--snapshot, default "latest"), or of the functions named by ARN or name, to
+--dest: a local directory or an s3://bucket/prefix URL. Packages are stored
+as <account>/<region>/<name>.zip.
+
+Each package's URL is signed by GetFunction just before it is downloaded,
+since the URLs recorded in snapshots expire within minutes. It is signed in
+the function's account: with the configured role in the role's account, and
+in others with the role aws.accounts configures for the account or the
+organization role, as discovery assumes them. Downloads are retried
+--attempts times, checked against the function's SHA-256 checksum and
+skipped above --max-size MiB. Functions deployed as container images have no
+package and are skipped. Uploads to S3 use the AWS credentials of the
+environment, in --dest-region.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if codeDest == "" {
+			return errors.New("--dest is required: a directory or s3://bucket/prefix")
+		}
+		services, err := snapshotServices(codeSnapshot)
+		if err != nil {
+			return err
+		}
+		packages, images, err := codePackages(services, args)
+		if err != nil {
+			return err
+		}
+		if images > 0 {
+			fmt.Fprintf(os.Stderr, "Skipping %d functions deployed as container images\n", images)
+		}
+		g := graph.New()
+		for _, s := range services {
+			if s.ResourceType == discovery.ResourceTypeLambdaFunction {
+				g.Add(s)
+			}
+		}
+		ctx, cancel, provider, _, err := graphProvider(cmd.Context(), g)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		provider.TokenFunc = onceToken(provider.TokenFunc)
+		providerOf := accountProvider(provider)
+		dest, err := codeDestination(ctx, codeDest)
+		if err != nil {
+			return err
+		}
+
+		results, err := code.Pull(ctx, packages, dest, code.Options{
+			MaxSize:     codeMaxSize << 20,
+			Parallelism: codeParallel,
+			Attempts:    codeAttempts,
+			Locate: func(ctx context.Context, p code.Package) (code.Package, error) {
+				c, err := providerOf(awscmd.AccountFromARN(p.Function)).FunctionCode(ctx, p.Function)
+				if err != nil {
+					return p, err
+				}
+				p.URL, p.SHA256, p.Size = c.Location, c.SHA256, c.Size
+				return p, nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", r.Err)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Pulled %d of %d packages to %s\n", len(results)-failed, len(results), codeDest)
+
+		switch strings.ToLower(OutputFormat) {
+		case "", "table":
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tREGION\tSIZE\tKEY")
+			for _, r := range results {
+				key := r.Key
+				if r.Err != nil {
+					key = "-"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", r.Package.Name, r.Package.Region, r.Package.Size, key)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		case "json", "yaml", "yml":
+			if err := writeDocument(cmd, results); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown code pull format %q (supported: table, json, yaml)", OutputFormat)
+		}
+		if failed > 0 {
+			return &ExitError{Code: ExitPartial, Err: fmt.Errorf("%d of %d packages could not be pulled", failed, len(results))}
+		}
+		return nil
+	},
+}
+
+var codeUsesCmd = &cobra.Command{
+	Use:   "uses <library>",
+	Short: "List the functions whose packages or layers use a library",
+	Long: `List the functions in a snapshot (--snapshot, default "latest") whose
+dependency manifests declare a library, e.g. "requests", "lodash",
+"github.com/aws/aws-lambda-go" or "com.amazonaws:aws-lambda-java-core", with
+the version each declares, and those using a layer the library is installed
+in, with the layer version and the version installed. Names are compared
+ignoring case, and, as pip does, "-", "_" and "." alike.
+
+Dependencies and layer contents are only recorded by runs with "list
+--code-dependencies" or code_dependencies set under aws in the config file.
+-o json or yaml prints the matches as a document.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		services, err := snapshotServices(codeSnapshot)
+		if err != nil {
+			return err
+		}
+		var uses []codeUse
+		read := 0
+		for _, s := range services {
+			l := s.Details.Lambda
+			if l == nil {
+				continue
+			}
+			if l.Dependencies != nil {
+				read++
+			}
+			for _, d := range l.Dependencies {
+				if libraryName(d.Name) == libraryName(args[0]) {
+					uses = append(uses, codeUse{Function: s.ARN, Name: s.Name, Region: s.Region, Dependency: d})
+				}
+			}
+			for _, layer := range l.Layers {
+				if layer.Contents == nil {
+					continue
+				}
+				read++
+				for _, d := range layer.Contents.Libraries {
+					if libraryName(d.Name) == libraryName(args[0]) {
+						uses = append(uses, codeUse{Function: s.ARN, Name: s.Name, Region: s.Region, Layer: layer.ARN, Dependency: d})
+					}
+				}
+			}
+		}
+		if read == 0 {
+			fmt.Fprintln(os.Stderr, "Warning: the snapshot has no dependencies; record them with \"list --code-dependencies\"")
+		}
+		if uses == nil {
+			uses = []codeUse{}
+		}
+
+		switch strings.ToLower(OutputFormat) {
+		case "", "table":
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tREGION\tLIBRARY\tVERSION\tLAYER\tMANIFEST")
+			for _, u := range uses {
+				version, layer := u.Version, "-"
+				if version == "" {
+					version = "-"
+				}
+				if u.Layer != "" {
+					// The layer's name and version, from its ARN.
+					layer = u.Layer[strings.LastIndex(u.Layer, ":layer:")+len(":layer:"):]
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", u.Name, u.Region, u.Dependency.Name, version, layer, u.Manifest)
+			}
+			return tw.Flush()
+		case "json", "yaml", "yml":
+			return writeDocument(cmd, uses)
+		default:
+			return fmt.Errorf("unknown code uses format %q (supported: table, json, yaml)", OutputFormat)
+		}
+	},
+}
+
+// codeUse is a function declaring a library, or using a layer with it
+// installed, in the output of code uses.
+type codeUse struct {
+	Function string `json:"function"`
+	Name     string `json:"name"`
+	Region   string `json:"region"`
+	// Layer is the ARN of the layer version the library is installed in,
+	// when it is not declared by the function's own package.
+	Layer string `json:"layer,omitempty"`
+	discovery.Dependency
+}
+
+// libraryName returns name as compared by code uses: lower case, with "_"
+// and "." as "-".
+func libraryName(name string) string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(name))
+}
+
+// codePackages returns the packages of the functions among services named
+// by refs, by ARN or name, or of all of them when there are no refs, and the
+// number of those deployed as container images, which have none.
+func codePackages(services []discovery.Service, refs []string) ([]code.Package, int, error) {
+	wanted := map[string]bool{}
+	for _, ref := range refs {
+		wanted[ref] = true
+	}
+	found := map[string]bool{}
+	var packages []code.Package
+	images := 0
+	for _, s := range services {
+		if s.ResourceType != discovery.ResourceTypeLambdaFunction {
+			continue
+		}
+		if len(refs) > 0 && !wanted[s.ARN] && !wanted[s.Name] {
+			continue
+		}
+		found[s.ARN], found[s.Name] = true, true
+		if l := s.Details.Lambda; l != nil && l.PackageType == "Image" {
+			images++
+			continue
+		}
+		packages = append(packages, code.Package{Function: s.ARN, Name: s.Name, Region: s.Region})
+	}
+	for _, ref := range refs {
+		if !found[ref] {
+			return nil, 0, fmt.Errorf("no function %q in the snapshot", ref)
+		}
+	}
+	return packages, images, nil
+}
+
+// codeDestination returns the destination dest names: an S3 prefix for an
+// s3:// URL, otherwise a directory.
+func codeDestination(ctx context.Context, dest string) (code.Destination, error) {
+	if !strings.HasPrefix(dest, "s3://") {
+		return code.Dir(dest), nil
+	}
+	bucket, prefix, ok := code.ParseS3(dest)
+	if !ok {
+		return nil, fmt.Errorf("--dest %q names no bucket", dest)
+	}
+	cfg, err := awscmd.LoadConfig(ctx, codeDestRegion)
+	if err != nil {
+		return nil, err
+	}
+	return code.S3{Client: s3.NewFromConfig(cfg), Bucket: bucket, Prefix: prefix}, nil
+}
+
+func init() {
+	codeCmd.AddCommand(codePullCmd, codeUsesCmd)
+	codePullCmd.Flags().StringVar(&codeSnapshot, "snapshot", "latest", "snapshot whose functions to pull")
+	codeUsesCmd.Flags().StringVar(&codeSnapshot, "snapshot", "latest", "snapshot whose functions to search")
+	codePullCmd.Flags().StringVar(&codeDest, "dest", "", "directory or s3://bucket/prefix to store packages in (required)")
+	codePullCmd.Flags().StringVar(&codeDestRegion, "dest-region", "", "region of the --dest bucket (default from the AWS config)")
+	codePullCmd.Flags().Int64Var(&codeMaxSize, "max-size", code.DefaultMaxSize>>20, "largest package to download, in MiB")
+	codePullCmd.Flags().IntVar(&codeParallel, "parallel", code.DefaultParallelism, "packages downloaded at once")
+	codePullCmd.Flags().IntVar(&codeAttempts, "attempts", code.DefaultAttempts, "times each download is tried")
+}
@@ -0,0 +1,210 @@
+package discoverycmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+var (
+	concurrencyMinHeadroom float64
+	concurrencyFailOnLow   bool
+)
+
+var concurrencyCmd = &cobra.Command{
+	Use:     "concurrency [snapshot]",
+	GroupID: groupDiscovery,
+	Short:   "Compare the concurrency functions reserve with the account limit",
+	Long: `Sum the reserved and provisioned concurrency of the Lambda functions in a
+snapshot (default "latest") for each region, and compare it with the
+account's concurrency limit there, read with the configured role
+(lambda:GetAccountSettings).
+
+A function commits its reserved concurrency, or its provisioned concurrency
+when that is larger or nothing is reserved; the headroom is what is left of
+the limit for every other function. Regions are flagged low when the
+headroom is below --min-headroom percent of the limit (default 20). Lambda
+always keeps 100 unreserved, so reservations fail well before the headroom
+runs out. --fail-on-low exits with status 1 when any region is low, for CI.
+-o json or yaml prints the report as a document.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		services, err := snapshotServices(id)
+		if err != nil {
+			return err
+		}
+		g := graph.New()
+		var functions []discovery.Service
+		for _, s := range services {
+			if s.Details.Lambda != nil {
+				functions = append(functions, s)
+				g.Add(s)
+			}
+		}
+		if len(functions) == 0 {
+			fmt.Fprintln(os.Stderr, "No functions in the snapshot")
+			return nil
+		}
+		ctx, cancel, provider, regions, err := graphProvider(cmd.Context(), g)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		report, err := concurrencyReport(ctx, provider, regions, functions, concurrencyMinHeadroom)
+		if err != nil {
+			return err
+		}
+
+		low := 0
+		for _, r := range report.Regions {
+			if r.Low {
+				low++
+			}
+		}
+		switch strings.ToLower(OutputFormat) {
+		case "", "table":
+			w := cmd.OutOrStdout()
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "REGION\tLIMIT\tRESERVED\tPROVISIONED\tCOMMITTED\tHEADROOM\tSTATUS")
+			for _, r := range report.Regions {
+				status := "ok"
+				if r.Low {
+					status = "low"
+				}
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d (%.0f%%)\t%s\n", r.Region, r.Limit, r.Reserved, r.Provisioned, r.Committed, r.Headroom, r.HeadroomPercent, status)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			if len(report.Functions) > 0 {
+				fmt.Fprintln(w)
+				fmt.Fprintln(tw, "NAME\tREGION\tRESERVED\tPROVISIONED\tCOMMITTED")
+				for _, f := range report.Functions {
+					reserved := "-"
+					if f.Reserved != nil {
+						reserved = fmt.Sprint(*f.Reserved)
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", f.Name, f.Region, reserved, f.Provisioned, f.Committed)
+				}
+				if err := tw.Flush(); err != nil {
+					return err
+				}
+			}
+		case "json", "yaml", "yml":
+			if err := writeDocument(cmd, report); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown concurrency format %q (supported: table, json, yaml)", OutputFormat)
+		}
+		if low > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d regions have less than %.0f%% of their concurrency limit unreserved\n", low, concurrencyMinHeadroom)
+			if concurrencyFailOnLow {
+				return &ExitError{Code: ExitFailure, Err: fmt.Errorf("%d regions are low on concurrency headroom", low)}
+			}
+		}
+		return nil
+	},
+}
+
+// accountConcurrency is what concurrency reports.
+type accountConcurrency struct {
+	Regions []regionConcurrency `json:"regions"`
+	// Functions are those reserving or provisioning concurrency, largest
+	// commitment first.
+	Functions []functionConcurrency `json:"functions"`
+}
+
+// regionConcurrency is the concurrency committed in a region.
+type regionConcurrency struct {
+	Region string `json:"region"`
+	// Limit is the account's concurrency limit in the region, and
+	// Unreserved what Lambda reports no function reserves.
+	Limit      int32 `json:"limit"`
+	Unreserved int32 `json:"unreserved"`
+	// Reserved and Provisioned are the sums of the functions' reserved and
+	// provisioned concurrency, and Committed the sum of each function's
+	// larger of the two.
+	Reserved    int32 `json:"reserved"`
+	Provisioned int32 `json:"provisioned"`
+	Committed   int32 `json:"committed"`
+	// Headroom is Limit less Committed, and HeadroomPercent that as a
+	// percentage of Limit.
+	Headroom        int32   `json:"headroom"`
+	HeadroomPercent float64 `json:"headroomPercent"`
+	Low             bool    `json:"low"`
+}
+
+// functionConcurrency is the concurrency a function commits.
+type functionConcurrency struct {
+	Name        string `json:"name"`
+	ARN         string `json:"arn"`
+	Region      string `json:"region"`
+	Reserved    *int32 `json:"reserved,omitempty"`
+	Provisioned int32  `json:"provisioned"`
+	Committed   int32  `json:"committed"`
+}
+
+// concurrencyReport compares the concurrency functions commit in each of
+// regions with the account's limit there, flagging regions whose headroom is
+// below minHeadroom percent of it. Functions of other accounts than the
+// provider's are left out, since the limit is per account.
+func concurrencyReport(ctx context.Context, provider *awscmd.Provider, regions []string, functions []discovery.Service, minHeadroom float64) (*accountConcurrency, error) {
+	report := &accountConcurrency{Regions: []regionConcurrency{}, Functions: []functionConcurrency{}}
+	account := provider.AccountID()
+	for _, region := range regions {
+		limit, unreserved, err := provider.AccountConcurrency(ctx, region)
+		if err != nil {
+			return nil, err
+		}
+		r := regionConcurrency{Region: region, Limit: limit, Unreserved: unreserved}
+		for _, s := range functions {
+			if s.Region != region || account != "" && s.AccountID != account {
+				continue
+			}
+			l := s.Details.Lambda
+			f := functionConcurrency{Name: s.Name, ARN: s.ARN, Region: s.Region, Reserved: l.ReservedConcurrency}
+			for _, p := range l.ProvisionedConcurrency {
+				f.Provisioned += p.Requested
+			}
+			f.Committed = f.Provisioned
+			if f.Reserved != nil {
+				r.Reserved += *f.Reserved
+				f.Committed = max(f.Committed, *f.Reserved)
+			}
+			if f.Committed == 0 && f.Reserved == nil {
+				continue
+			}
+			r.Provisioned += f.Provisioned
+			r.Committed += f.Committed
+			report.Functions = append(report.Functions, f)
+		}
+		r.Headroom = r.Limit - r.Committed
+		if r.Limit > 0 {
+			r.HeadroomPercent = float64(r.Headroom) / float64(r.Limit) * 100
+		}
+		r.Low = r.HeadroomPercent < minHeadroom
+		report.Regions = append(report.Regions, r)
+	}
+	sort.SliceStable(report.Functions, func(i, j int) bool { return report.Functions[i].Committed > report.Functions[j].Committed })
+	return report, nil
+}
+
+func init() {
+	concurrencyCmd.Flags().Float64Var(&concurrencyMinHeadroom, "min-headroom", 20, "flag regions with less than this percentage of their concurrency limit unreserved")
+	concurrencyCmd.Flags().BoolVar(&concurrencyFailOnLow, "fail-on-low", false, "exit with status 1 when any region is low on headroom")
+}
@@ -0,0 +1,84 @@
+package discoverycmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+)
+
+var (
+	// Costs attaches the monthly cost of each resource from Cost Explorer.
+	Costs bool
+	// CostTag attaches to resources without a cost of their own the monthly
+	// cost of the resources sharing their value of this tag.
+	CostTag string
+)
+
+// withCosts sets the estimated monthly cost of every service discovered, as
+// far as provider can read it from Cost Explorer, before passing it on to h.
+// Costs are read once, with the first service; if that fails the services
+// are passed on without costs and a warning is printed.
+func withCosts(h discovery.ResultHandler, provider *awscmd.Provider) discovery.ResultHandler {
+	var once sync.Once
+	var resources, tagged awscmd.Costs
+	load := func(ctx context.Context) {
+		now := time.Now()
+		var errs []error
+		if Costs {
+			var err error
+			if resources, err = provider.ResourceCosts(ctx, now); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if CostTag != "" {
+			var err error
+			if tagged, err = provider.TagCosts(ctx, CostTag, now); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: reading costs from Cost Explorer: %v\n", err)
+		}
+	}
+	return discovery.ResultHandlerFunc(func(ctx context.Context, r discovery.Result) error {
+		if r.Err == nil {
+			once.Do(func() { load(ctx) })
+			s := &r.Service
+			if amount, ok := resources.Amounts[s.Key()]; ok {
+				s.Cost = &discovery.Cost{Monthly: amount, Currency: resources.Currency, Source: "resource"}
+			} else if amount, ok := tagged.Amounts[s.Tags[CostTag]]; ok {
+				s.Cost = &discovery.Cost{Monthly: amount, Currency: tagged.Currency, Source: discovery.TagColumnPrefix + CostTag}
+			}
+		}
+		return h.HandleResult(ctx, r)
+	})
+}
+
+// onceToken returns a token func calling token at most once, so providers
+// sharing it log in only once.
+func onceToken(token func(context.Context) (string, error)) func(context.Context) (string, error) {
+	var mu sync.Mutex
+	var called bool
+	var t string
+	var err error
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !called {
+			t, err = token(ctx)
+			called = true
+		}
+		return t, err
+	}
+}
+
+func init() {
+	listCmd.Flags().BoolVar(&Costs, "cost", false, "attach each resource's estimated monthly cost from Cost Explorer (needs resource-level data enabled)")
+	listCmd.Flags().StringVar(&CostTag, "cost-tag", "", "attach the monthly cost of resources sharing this cost allocation tag's value to those without their own")
+}
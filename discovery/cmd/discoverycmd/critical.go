@@ -0,0 +1,66 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+var (
+	criticalSnapshot string
+	criticalTop      int
+)
+
+var graphCriticalCmd = &cobra.Command{
+	Use:   "critical",
+	Short: "Rank the single points of failure of the dependency graph",
+	Long: `Rank the resources whose failure would do the most damage, from the
+dependency graph of a snapshot (--snapshot, default "latest"): articulation
+points, whose removal splits the graph, and resources that more than one
+other depends on directly.
+
+They are ranked by how many resources their removal would cut off from the
+rest, then by how many discovered services depend on them, directly or not,
+and then by their direct dependents (fan-in). --top limits the report to the
+first resources; 0 lists them all. -o json or yaml prints the ranking as a
+document.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		g, err := snapshotGraph(criticalSnapshot)
+		if err != nil {
+			return err
+		}
+		critical := g.Critical()
+		if criticalTop > 0 && len(critical) > criticalTop {
+			critical = critical[:criticalTop]
+		}
+		if critical == nil {
+			critical = []graph.Critical{}
+		}
+
+		switch strings.ToLower(OutputFormat) {
+		case "", "table":
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "RANK\tPARTITIONED\tDEPENDENTS\tFAN-IN\tNAME\tTYPE\tID")
+			for i, c := range critical {
+				fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%s\t%s\t%s\n", i+1, c.Partitioned, c.Dependents, c.FanIn, c.Node.Name, c.Node.ResourceType, c.Node.ID)
+			}
+			return tw.Flush()
+		case "json", "yaml", "yml":
+			return writeDocument(cmd, critical)
+		default:
+			return fmt.Errorf("unknown critical format %q (supported: table, json, yaml)", OutputFormat)
+		}
+	},
+}
+
+func init() {
+	graphCriticalCmd.Flags().StringVar(&criticalSnapshot, "snapshot", "latest", "snapshot whose graph to analyze")
+	graphCriticalCmd.Flags().IntVar(&criticalTop, "top", 20, "most resources to list (0 for all)")
+	graphCmd.AddCommand(graphCriticalCmd)
+}
@@ -0,0 +1,120 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+var cyclesSnapshot string
+
+var graphCyclesCmd = &cobra.Command{
+	Use:   "cycles",
+	Short: "Find circular dependencies in the dependency graph",
+	Long: `Find the circular dependencies in the dependency graph of a snapshot
+(--snapshot, default "latest"): sets of resources that each depend on the
+others, directly or not, so that none can be deployed or restored first.
+
+Each cycle is listed with a shortest path around it and every dependency
+between its resources, with the evidence it was found in: the resources'
+configuration, or policies for dependencies inferred from permissions and
+resource policies. -o json or yaml prints the cycles as a document, and
+-o dot, mermaid or svg draws the resources in them.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		g, err := snapshotGraph(cyclesSnapshot)
+		if err != nil {
+			return err
+		}
+		cycles := g.Cycles()
+		if cycles == nil {
+			cycles = []graph.Cycle{}
+		}
+
+		switch f := strings.ToLower(OutputFormat); f {
+		case "", "table":
+			w := cmd.OutOrStdout()
+			if len(cycles) == 0 {
+				fmt.Fprintln(w, "No dependency cycles")
+				return nil
+			}
+			for i, c := range cycles {
+				if i > 0 {
+					fmt.Fprintln(w)
+				}
+				names := make([]string, len(c.Path))
+				for j, id := range c.Path {
+					n, _ := g.Node(id)
+					names[j] = n.Name
+				}
+				fmt.Fprintf(w, "Cycle %d (%d resources): %s\n", i+1, len(c.Nodes), strings.Join(names, " -> "))
+				tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "  FROM\tTO\tDEPENDENCY\tEVIDENCE")
+				for _, e := range c.Edges {
+					from, _ := g.Node(e.From)
+					to, _ := g.Node(e.To)
+					fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", from.Name, to.Name, e.Label(), e.Evidence())
+				}
+				if err := tw.Flush(); err != nil {
+					return err
+				}
+			}
+			return nil
+		case "json", "yaml", "yml":
+			return writeDocument(cmd, cyclesDocument(cycles))
+		case "dot", "mermaid", "svg":
+			var ids []string
+			for _, c := range cycles {
+				for _, n := range c.Nodes {
+					ids = append(ids, n.ID)
+				}
+			}
+			sub := g.Subgraph(ids)
+			switch f {
+			case "dot":
+				return sub.WriteDOT(cmd.OutOrStdout())
+			case "mermaid":
+				return sub.WriteMermaid(cmd.OutOrStdout())
+			}
+			return sub.WriteSVG(cmd.OutOrStdout())
+		default:
+			return fmt.Errorf("unknown cycles format %q (supported: table, json, yaml, dot, mermaid, svg)", OutputFormat)
+		}
+	},
+}
+
+// cycleEdge is a dependency of a cycle in the JSON and YAML output of graph
+// cycles.
+type cycleEdge struct {
+	graph.Edge
+	Evidence string `json:"evidence"`
+}
+
+// cycleDocument is a cycle in the JSON and YAML output of graph cycles.
+type cycleDocument struct {
+	Nodes []graph.Node `json:"nodes"`
+	Path  []string     `json:"path"`
+	Edges []cycleEdge  `json:"edges"`
+}
+
+// cyclesDocument returns cycles with the evidence of each edge.
+func cyclesDocument(cycles []graph.Cycle) []cycleDocument {
+	docs := make([]cycleDocument, len(cycles))
+	for i, c := range cycles {
+		docs[i] = cycleDocument{Nodes: c.Nodes, Path: c.Path, Edges: make([]cycleEdge, len(c.Edges))}
+		for j, e := range c.Edges {
+			docs[i].Edges[j] = cycleEdge{Edge: e, Evidence: e.Evidence()}
+		}
+	}
+	return docs
+}
+
+func init() {
+	graphCyclesCmd.Flags().StringVar(&cyclesSnapshot, "snapshot", "latest", "snapshot whose graph to analyze")
+	graphCmd.AddCommand(graphCyclesCmd)
+}
@@ -0,0 +1,61 @@
+package discoverycmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemonSchedule string
+	daemonRunNow   bool
+)
+
+var daemonCmd = &cobra.Command{
+	Use:     "daemon [region] [roleArn]",
+	GroupID: groupDiscovery,
+	Short:   "Run discovery on a cron schedule as a long-lived service",
+	Long: `Run discovery whenever the cron expression --schedule says, e.g.
+"0 */6 * * *" for every six hours, until interrupted. Like serve, each run is
+recorded as a snapshot, written to the configured sinks, whose change events
+say what was added, changed or removed since the last complete run, and
+reported to hooks. Prometheus metrics are served on /metrics, a liveness
+probe on /healthz, the time of the next run and the report of the last on
+/status, and the newest snapshot under /api/v1, over gRPC with --grpc-listen
+and in the web interface on /ui/, as for serve.
+
+Schedules have the five standard fields (minute, hour, day of month, month,
+day of week) or are one of @hourly, @daily, @weekly, @monthly or
+@every <duration>, and are in local time unless prefixed with CRON_TZ=<zone>.
+The first run waits for the schedule unless --run-now is set. A run still
+going when the next is due delays it rather than overlapping.
+
+The web identity token is read from --token-file before every run (default
+$AWS_WEB_IDENTITY_TOKEN_FILE). Without one the Auth0 device flow is used on
+the first run, and its token is reused and renewed with its refresh token on
+the later ones.`,
+	Args:         cobra.RangeArgs(0, 2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if daemonSchedule == "" {
+			return errors.New("--schedule is required, e.g. --schedule \"0 */6 * * *\"")
+		}
+		schedule, err := cron.ParseStandard(daemonSchedule)
+		if err != nil {
+			return fmt.Errorf("parsing --schedule: %w", err)
+		}
+		return runScheduled(cmd, args, schedule.Next, daemonRunNow, fmt.Sprintf("discovering on schedule %q", daemonSchedule))
+	},
+}
+
+func init() {
+	daemonCmd.Flags().StringVar(&daemonSchedule, "schedule", "", "cron expression saying when to run, e.g. \"0 */6 * * *\"")
+	daemonCmd.Flags().BoolVar(&daemonRunNow, "run-now", false, "run once at start, before the schedule's first run")
+	daemonCmd.Flags().StringVar(&serveListen, "listen", ":9090", "address to serve metrics, status, the catalog API and the web interface on")
+	daemonCmd.Flags().StringVar(&serveTokenFile, "token-file", os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), "file holding the web identity token")
+	daemonCmd.Flags().StringVar(&ManifestPath, "manifest", "", "write the manifest of each run to this file")
+	daemonCmd.Flags().StringVar(&serveGRPCListen, "grpc-listen", "", "address to serve the catalog over gRPC on, e.g. :9091 (default none)")
+}
@@ -0,0 +1,90 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/datadog"
+)
+
+var (
+	datadogOpts   datadog.Options
+	datadogSite   string
+	datadogDryRun bool
+	datadogPrune  bool
+)
+
+var datadogCmd = &cobra.Command{
+	Use:     "datadog [snapshot]",
+	GroupID: groupExport,
+	Short:   "Sync a snapshot into the Datadog Service Catalog",
+	Long: `Write a Datadog service definition (schema ` + datadog.SchemaVersion + `) for every Lambda function in a
+snapshot (default "latest") through the Service Definition API. The team
+comes from the first --team-tag set on the function; the definition links
+the function's AWS console and CloudWatch Logs pages.
+
+The API and application keys are read from DD_API_KEY and DD_APP_KEY, the
+site from --site or DD_SITE. With --prune, definitions written by an earlier
+sync (tagged ` + datadog.ManagedTag + `) whose functions are gone are deleted; this
+needs a complete snapshot.
+
+  discovery datadog --dry-run -o yaml
+  DD_API_KEY=... DD_APP_KEY=... discovery datadog --prune`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		client := &datadog.Client{
+			Site:   datadogSite,
+			APIKey: os.Getenv("DD_API_KEY"),
+			AppKey: os.Getenv("DD_APP_KEY"),
+		}
+		if !datadogDryRun {
+			if err := client.Validate(); err != nil {
+				return err
+			}
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		snap, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		services, err := store.LoadServices(snap.ID)
+		if err != nil {
+			return err
+		}
+		defs := datadog.Definitions(services, datadogOpts)
+		if datadogDryRun {
+			return writeDocument(cmd, defs)
+		}
+
+		prune := datadogPrune
+		if prune && !snap.Complete() {
+			fmt.Fprintf(os.Stderr, "Warning: not pruning: snapshot %s is %s\n", snap.ID, snapshotStatus(snap))
+			prune = false
+		}
+		written, deleted, err := client.Sync(cmd.Context(), defs, prune)
+		fmt.Fprintf(os.Stderr, "Wrote %d of %d service definitions to Datadog\n", written, len(defs))
+		for _, name := range deleted {
+			fmt.Fprintf(os.Stderr, "Deleted %s\n", name)
+		}
+		return err
+	},
+}
+
+func init() {
+	datadogCmd.Flags().StringSliceVar(&datadogOpts.TeamTags, "team-tag", []string{"team", "owner"}, "tags tried in order for the team")
+	datadogCmd.Flags().StringVar(&datadogOpts.DefaultTeam, "default-team", "", "team of functions without a team tag")
+	datadogCmd.Flags().StringVar(&datadogSite, "site", os.Getenv("DD_SITE"), "Datadog site, e.g. datadoghq.eu (default "+datadog.DefaultSite+")")
+	datadogCmd.Flags().BoolVar(&datadogDryRun, "dry-run", false, "print the definitions instead of writing them")
+	datadogCmd.Flags().BoolVar(&datadogPrune, "prune", false, "delete definitions of functions no longer discovered")
+}
@@ -0,0 +1,108 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+var (
+	depsSnapshot  string
+	depsDirection string
+	depsDepth     int
+)
+
+var graphDepsCmd = &cobra.Command{
+	Use:   "deps <service>",
+	Short: "Show what a service depends on, or what depends on it",
+	Long: `Show the resources a service depends on (--direction downstream, the
+default) or the resources depending on it (--direction upstream), as far as
+the dependency graph of a snapshot (--snapshot, default "latest") shows,
+without running discovery again. The service is named by its ARN or, when
+that is unambiguous, its name. --depth limits how many edges away to look;
+0 follows them all.
+
+Each resource is listed once, with its distance and the edge it was first
+reached by. -o json or yaml prints them as a document, and -o dot, mermaid
+or svg draws the service and what was reached, e.g.
+  discovery graph deps orders --direction upstream -o dot | dot -Tsvg > callers.svg`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		direction, err := graph.ParseDirection(depsDirection)
+		if err != nil {
+			return err
+		}
+		g, err := snapshotGraph(depsSnapshot)
+		if err != nil {
+			return err
+		}
+		start, err := lookupNode(g, args[0])
+		if err != nil {
+			return err
+		}
+		reached := g.Reachable(start.ID, direction, depsDepth)
+
+		switch f := strings.ToLower(OutputFormat); f {
+		case "", "table":
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "DEPTH\tRELATION\tNAME\tTYPE\tID")
+			for _, r := range reached {
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", r.Depth, r.Via.Label(), r.Node.Name, r.Node.ResourceType, r.Node.ID)
+			}
+			return tw.Flush()
+		case "json", "yaml", "yml":
+			return writeDocument(cmd, depsDocument{Service: start, Direction: strings.ToLower(depsDirection), Reached: reached})
+		case "dot", "mermaid", "svg":
+			ids := []string{start.ID}
+			for _, r := range reached {
+				ids = append(ids, r.Node.ID)
+			}
+			sub := g.Subgraph(ids)
+			switch f {
+			case "dot":
+				return sub.WriteDOT(cmd.OutOrStdout())
+			case "mermaid":
+				return sub.WriteMermaid(cmd.OutOrStdout())
+			}
+			return sub.WriteSVG(cmd.OutOrStdout())
+		default:
+			return fmt.Errorf("unknown deps format %q (supported: table, json, yaml, dot, mermaid, svg)", OutputFormat)
+		}
+	},
+}
+
+// depsDocument is the JSON and YAML output of graph deps.
+type depsDocument struct {
+	Service   graph.Node      `json:"service"`
+	Direction string          `json:"direction"`
+	Reached   []graph.Reached `json:"reached"`
+}
+
+// lookupNode returns the node of g that ref names, by ID or unambiguous
+// name.
+func lookupNode(g *graph.Graph, ref string) (graph.Node, error) {
+	nodes := g.Lookup(ref)
+	switch len(nodes) {
+	case 0:
+		return graph.Node{}, fmt.Errorf("no resource %q in the graph", ref)
+	case 1:
+		return nodes[0], nil
+	}
+	ids := make([]string, len(nodes))
+	for i, n := range nodes {
+		ids[i] = "  " + n.ID
+	}
+	return graph.Node{}, fmt.Errorf("%q names %d resources; give one by ARN:\n%s", ref, len(nodes), strings.Join(ids, "\n"))
+}
+
+func init() {
+	graphDepsCmd.Flags().StringVar(&depsSnapshot, "snapshot", "latest", "snapshot whose graph to query")
+	graphDepsCmd.Flags().StringVar(&depsDirection, "direction", "downstream", "downstream for what the service depends on, upstream for what depends on it")
+	graphDepsCmd.Flags().IntVar(&depsDepth, "depth", 0, "most edges away to look (0 for no limit)")
+	graphCmd.AddCommand(graphDepsCmd)
+}
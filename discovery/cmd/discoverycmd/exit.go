@@ -0,0 +1,37 @@
+package discoverycmd
+
+import "errors"
+
+// Process exit codes returned by the CLI.
+const (
+	ExitOK          = 0
+	ExitFailure     = 1
+	ExitPartial     = 2 // the run finished but some resources were not scanned
+	ExitInterrupted = 130
+)
+
+// ExitError carries the process exit code a command wants main to use.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode maps an error returned by a command to a process exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitFailure
+}
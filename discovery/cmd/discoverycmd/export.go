@@ -0,0 +1,135 @@
+package discoverycmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/snapshot"
+	"github.com/jamesneb/causal/discovery/sqldb"
+)
+
+var exportTo string
+
+var exportCmd = &cobra.Command{
+	Use:     "export [snapshot]",
+	GroupID: groupExport,
+	Short:   "Copy a snapshot into a SQL database",
+	Long: `Copy the services of a snapshot (default "latest") into a SQL database laid
+out like the postgres sink: runs, services, tags and relationships tables.
+
+  --to sqlite://inventory.db     writes a new single-file SQLite database
+  --to postgres://host/inventory upserts into an existing PostgreSQL database
+
+  discovery export --to sqlite://inventory.db
+  sqlite3 inventory.db 'SELECT resource_type, COUNT(*) FROM services GROUP BY 1'`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		snap, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		switch {
+		case strings.HasPrefix(exportTo, "sqlite://"):
+			path := strings.TrimPrefix(exportTo, "sqlite://")
+			if path == "" {
+				return errors.New("--to sqlite:// needs a file, e.g. sqlite://inventory.db")
+			}
+			err = exportSQLite(ctx, store, snap, path)
+		case strings.HasPrefix(exportTo, "postgres://"), strings.HasPrefix(exportTo, "postgresql://"):
+			var db *sqldb.DB
+			if db, err = sqldb.OpenPostgres(ctx, os.ExpandEnv(exportTo)); err != nil {
+				return err
+			}
+			err = exportSQL(ctx, db, store, snap)
+			if cerr := db.Close(); err == nil {
+				err = cerr
+			}
+		case exportTo == "":
+			return errors.New("pass --to, e.g. --to sqlite://inventory.db")
+		default:
+			return fmt.Errorf("unsupported export destination %q (supported: sqlite://, postgres://)", exportTo)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d services from snapshot %s\n", snap.Services, snap.ID)
+		return nil
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportTo, "to", "", "destination database URL: sqlite://<file> or postgres://...")
+}
+
+// exportSQLite writes snap to a new SQLite database at path. It is built
+// beside the destination and renamed, so a failed export never leaves a
+// partial database behind.
+func exportSQLite(ctx context.Context, store *snapshot.Store, snap snapshot.Snapshot, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".export-*.db")
+	if err != nil {
+		return fmt.Errorf("creating export file: %w", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	db, err := sqldb.OpenSQLite(ctx, f.Name())
+	if err != nil {
+		return err
+	}
+	err = exportSQL(ctx, db, store, snap)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("writing export file: %w", err)
+	}
+	return nil
+}
+
+// exportBatch is how many services are written per transaction.
+const exportBatch = 500
+
+// exportSQL writes snap to db as a run.
+func exportSQL(ctx context.Context, db *sqldb.DB, store *snapshot.Store, snap snapshot.Snapshot) error {
+	if err := db.StartRun(ctx, snap.ID, snap.Started); err != nil {
+		return err
+	}
+	batch := make([]discovery.Service, 0, exportBatch)
+	err := store.Services(snap.ID, func(s discovery.Service) error {
+		batch = append(batch, s)
+		if len(batch) < exportBatch {
+			return nil
+		}
+		err := db.WriteServices(ctx, snap.ID, batch)
+		batch = batch[:0]
+		return err
+	})
+	if err == nil {
+		err = db.WriteServices(ctx, snap.ID, batch)
+	}
+	if err != nil {
+		return err
+	}
+	return db.FinishRun(ctx, snap.ID, snap.Finished, snap.Status, snap.Services)
+}
@@ -0,0 +1,91 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/grafana"
+)
+
+var (
+	grafanaOpts grafana.Options
+	grafanaDir  string
+)
+
+var grafanaCmd = &cobra.Command{
+	Use:     "grafana [snapshot]",
+	GroupID: groupExport,
+	Short:   "Generate Grafana dashboards for a snapshot's functions",
+	Long: `Generate a baseline Grafana dashboard for every Lambda function in a snapshot
+(default "latest"): CloudWatch panels for invocations, errors, duration
+(average, p95 and maximum), throttles and concurrent executions, queried in
+the function's region.
+
+With --dir every dashboard is written to <dir>/<uid>.json, ready for file
+provisioning; otherwise the dashboards are printed as a JSON array. UIDs are
+derived from the function ARN, so regenerated dashboards replace the old
+ones.
+
+  discovery grafana --dir /etc/grafana/dashboards/lambda --datasource cloudwatch-prod`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		snap, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		services, err := store.LoadServices(snap.ID)
+		if err != nil {
+			return err
+		}
+		dashboards := grafana.Dashboards(services, grafanaOpts)
+		if grafanaDir == "" {
+			if dashboards == nil {
+				dashboards = []grafana.Dashboard{}
+			}
+			return writeDocument(cmd, dashboards)
+		}
+
+		if err := os.MkdirAll(grafanaDir, 0o755); err != nil {
+			return fmt.Errorf("creating dashboard directory: %w", err)
+		}
+		for _, d := range dashboards {
+			if err := writeDashboard(filepath.Join(grafanaDir, d.UID+".json"), d); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d dashboards to %s\n", len(dashboards), grafanaDir)
+		return nil
+	},
+}
+
+func init() {
+	grafanaCmd.Flags().StringVar(&grafanaDir, "dir", "", "write one dashboard file per function to this directory")
+	grafanaCmd.Flags().StringVar(&grafanaOpts.Datasource, "datasource", "", "UID of the CloudWatch data source (default Grafana's default data source)")
+	grafanaCmd.Flags().StringToStringVar(&grafanaOpts.AccountDatasources, "account-datasource", nil, "CloudWatch data source UID per account, e.g. 123456789012=cloudwatch-prod")
+	grafanaCmd.Flags().StringSliceVar(&grafanaOpts.TeamTags, "team-tag", []string{"team", "owner"}, "tags tried in order for a team:<value> dashboard tag")
+}
+
+func writeDashboard(path string, d grafana.Dashboard) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("writing dashboard: %w", err)
+	}
+	if err := grafana.Write(f, d); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,361 @@
+package discoverycmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+// xrayRetention is how long X-Ray keeps traces.
+const xrayRetention = 30 * 24 * time.Hour
+
+// eventHistoryRetention is how long CloudTrail event history keeps events.
+const eventHistoryRetention = 90 * 24 * time.Hour
+
+// observedWindow, when set, merges the calls X-Ray traced over that long,
+// ending at observedUntil, into the graph.
+var (
+	observedWindow time.Duration
+	observedUntil  string
+)
+
+// networkEdges adds the network reachability between services' security
+// groups to the graph.
+var networkEdges bool
+
+// auditedWindow, when set, adds the calls CloudTrail logged over that long
+// to the graph, read from the event data store auditedStore if set and
+// event history otherwise.
+var (
+	auditedWindow time.Duration
+	auditedStore  string
+)
+
+// dnsEdges adds the public DNS names leading to services to the graph.
+var dnsEdges bool
+
+var graphCmd = &cobra.Command{
+	Use:     "graph [snapshot]",
+	GroupID: groupGraph,
+	Short:   "Print the dependency graph of a snapshot",
+	Long: `Print the dependency graph of the services recorded in a snapshot (default
+"latest"): each service and the resources it depends on, such as a Lambda
+function's execution role and image repository.
+
+Formats (-o): dot (default) for Graphviz, e.g.
+  discovery graph -o dot | dot -Tsvg > architecture.svg
+mermaid for a flowchart to paste into Markdown, svg for an image drawn
+without Graphviz, json for the nodes and edges, or cypher for openCypher
+statements merging them into Neo4j or another graph database, e.g.
+  discovery graph -o cypher | cypher-shell -u neo4j
+
+Nodes are drawn grouped by account and region; --group-by owner groups them
+by owner (see --owner-tags) instead, and account, region, type, provider or
+tag:<key> by those.
+
+--observed merges in the calls X-Ray traced over a window, e.g. the last
+24h, as "observed" edges with their call counts, drawn bold so dependencies
+in use stand out from those only configured or permitted. It reads the
+service graph of every region the snapshot has services in with the
+configured role, which needs xray:GetServiceGraph.
+
+--cloudtrail adds the calls CloudTrail logged over a window ending now as
+bold "audited" edges with their call counts: functions, roles and state
+machines invoking functions, sending to queues, publishing to topics,
+starting executions and using tables. Most of these are data events, which
+only trails logging data events record; --cloudtrail-lake names the
+CloudTrail Lake event data store (ID or ARN) they are recorded in, queried
+with cloudtrail:StartQuery and cloudtrail:GetQueryResults. Without it event
+history is read in every region with cloudtrail:LookupEvents, which has
+only management events such as states:StartExecution.
+
+--network adds dotted "network" edges from each service connected to a VPC
+to the services and security groups whose rules admit traffic from its
+security groups, labelled with the ports, e.g. "network (tcp/5432)". It reads
+security groups with the configured role, which needs
+ec2:DescribeSecurityGroups.
+
+--dns adds "dns" edges from the names in public Route 53 hosted zones and
+the aliases of CloudFront distributions to the load balancers, APIs and
+function URLs they resolve to, and "origin" edges from distributions to
+those they serve. It reads load balancers, API custom domain names, hosted
+zones and distributions with the configured role, which needs
+elasticloadbalancing:DescribeLoadBalancers, apigateway:GET,
+route53:ListHostedZones, route53:ListResourceRecordSets and
+cloudfront:ListDistributions.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		services, err := snapshotServices(id)
+		if err != nil {
+			return err
+		}
+		g, err := newGraph()
+		if err != nil {
+			return err
+		}
+		for _, s := range services {
+			g.Add(s)
+		}
+		if observedWindow > 0 || auditedWindow > 0 || networkEdges || dnsEdges {
+			// All read the same regions with one provider, which logs in
+			// once.
+			ctx, cancel, provider, regions, err := graphProvider(cmd.Context(), g)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			if observedWindow > 0 {
+				if err := addObserved(ctx, g, provider, regions); err != nil {
+					return err
+				}
+			}
+			if auditedWindow > 0 {
+				if err := addAudited(ctx, g, provider, regions, services); err != nil {
+					return err
+				}
+			}
+			if networkEdges {
+				if err := addNetwork(ctx, g, provider, regions, services); err != nil {
+					return err
+				}
+			}
+			if dnsEdges {
+				if err := addDNS(ctx, g, provider, regions, services); err != nil {
+					return err
+				}
+			}
+		}
+
+		switch strings.ToLower(OutputFormat) {
+		case "", "dot":
+			return g.WriteDOT(cmd.OutOrStdout())
+		case "mermaid":
+			return g.WriteMermaid(cmd.OutOrStdout())
+		case "svg":
+			return g.WriteSVG(cmd.OutOrStdout())
+		case "json":
+			return writeDocument(cmd, g)
+		case "cypher":
+			return g.WriteCypher(cmd.OutOrStdout())
+		default:
+			return fmt.Errorf("unknown graph format %q (supported: dot, mermaid, svg, json, cypher)", OutputFormat)
+		}
+	},
+}
+
+// snapshotGraph loads the dependency graph of snapshot id.
+func snapshotGraph(id string) (*graph.Graph, error) {
+	store, err := openSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	g, err := newGraph()
+	if err != nil {
+		return nil, err
+	}
+	keys := ownerTags()
+	err = store.Services(id, func(s discovery.Service) error {
+		s.SetOwner(keys)
+		g.Add(s)
+		return nil
+	})
+	return g, err
+}
+
+// newGraph returns an empty graph, drawn grouped by --group-by when set.
+func newGraph() (*graph.Graph, error) {
+	g := graph.New()
+	if GroupBy != "" {
+		if err := graph.CheckGroupKey(GroupBy); err != nil {
+			return nil, err
+		}
+		g.GroupBy = GroupBy
+	}
+	return g, nil
+}
+
+// snapshotServices loads the services of snapshot id.
+func snapshotServices(id string) ([]discovery.Service, error) {
+	store, err := openSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	var services []discovery.Service
+	keys := ownerTags()
+	err = store.Services(id, func(s discovery.Service) error {
+		s.SetOwner(keys)
+		services = append(services, s)
+		return nil
+	})
+	return services, err
+}
+
+// addObserved merges the calls X-Ray traced in regions over observedWindow
+// into g.
+func addObserved(ctx context.Context, g *graph.Graph, provider *awscmd.Provider, regions []string) error {
+	end := time.Now()
+	if observedUntil != "" {
+		t, err := time.Parse(time.RFC3339, observedUntil)
+		if err != nil {
+			return fmt.Errorf("--observed-until: %w", err)
+		}
+		end = t
+	}
+	if observedWindow > xrayRetention {
+		return fmt.Errorf("--observed %s is longer than the %d days X-Ray keeps traces", observedWindow, int(xrayRetention.Hours()/24))
+	}
+
+	var errs []error
+	for _, region := range regions {
+		rels, err := provider.ObservedRelationships(ctx, region, end.Add(-observedWindow), end)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", region, err))
+			continue
+		}
+		for _, r := range rels {
+			g.AddRelationship(r)
+		}
+		fmt.Fprintf(os.Stderr, "Merged %d observed dependencies in %s\n", len(rels), region)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("reading X-Ray service graphs: %w", err)
+	}
+	return nil
+}
+
+// addAudited adds the calls CloudTrail logged over auditedWindow, in
+// regions or the event data store auditedStore, to g.
+func addAudited(ctx context.Context, g *graph.Graph, provider *awscmd.Provider, regions []string, services []discovery.Service) error {
+	end := time.Now()
+	start := end.Add(-auditedWindow)
+	if auditedStore != "" {
+		// A store is queried in its own region; one named by ID in the
+		// first.
+		region := regions[0]
+		if parts := strings.SplitN(auditedStore, ":", 6); len(parts) == 6 {
+			region = parts[3]
+		}
+		rels, err := provider.LakeRelationships(ctx, region, auditedStore, start, end, services)
+		if err != nil {
+			return fmt.Errorf("querying CloudTrail Lake: %w", err)
+		}
+		for _, r := range rels {
+			g.AddRelationship(r)
+		}
+		fmt.Fprintf(os.Stderr, "Added %d audited dependencies from %s\n", len(rels), auditedStore)
+		return nil
+	}
+	if auditedWindow > eventHistoryRetention {
+		return fmt.Errorf("--cloudtrail %s is longer than the %d days event history keeps events", auditedWindow, int(eventHistoryRetention.Hours()/24))
+	}
+
+	var errs []error
+	for _, region := range regions {
+		rels, err := provider.AuditedRelationships(ctx, region, start, end, services)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", region, err))
+			continue
+		}
+		for _, r := range rels {
+			g.AddRelationship(r)
+		}
+		fmt.Fprintf(os.Stderr, "Added %d audited dependencies in %s\n", len(rels), region)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("reading CloudTrail event history: %w", err)
+	}
+	return nil
+}
+
+// addNetwork adds the network reachability between the security groups of
+// services in regions to g.
+func addNetwork(ctx context.Context, g *graph.Graph, provider *awscmd.Provider, regions []string, services []discovery.Service) error {
+	var errs []error
+	for _, region := range regions {
+		rels, err := provider.NetworkRelationships(ctx, region, services)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", region, err))
+			continue
+		}
+		for _, r := range rels {
+			g.AddRelationship(r)
+		}
+		fmt.Fprintf(os.Stderr, "Added %d network paths in %s\n", len(rels), region)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("reading security groups: %w", err)
+	}
+	return nil
+}
+
+// addDNS adds the public DNS names leading to services in regions to g.
+func addDNS(ctx context.Context, g *graph.Graph, provider *awscmd.Provider, regions []string, services []discovery.Service) error {
+	rels, err := provider.DNSRelationships(ctx, regions, services)
+	if err != nil {
+		return fmt.Errorf("reading DNS names: %w", err)
+	}
+	for _, r := range rels {
+		g.AddRelationship(r)
+	}
+	fmt.Fprintf(os.Stderr, "Added %d DNS names and origins\n", len(rels))
+	return nil
+}
+
+// graphProvider returns a provider for the configured role and the regions
+// of g's services it can read, with the run timeout applied to ctx.
+func graphProvider(ctx context.Context, g *graph.Graph) (context.Context, context.CancelFunc, *awscmd.Provider, []string, error) {
+	seen := map[string]bool{}
+	var requested []string
+	for _, n := range g.Nodes {
+		if n.Provider == "aws" && !n.External && n.Region != "" && !seen[n.Region] {
+			seen[n.Region] = true
+			requested = append(requested, n.Region)
+		}
+	}
+	sort.Strings(requested)
+	if len(requested) == 0 {
+		requested = Cfg.AWS.Regions
+	}
+	regions, err := resolveTarget(requested, Cfg.AWS.RoleARN)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	cancel := context.CancelFunc(func() {})
+	if Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, Timeout)
+	}
+	applyRunSettings()
+	if Cfg.AWS.SessionName != "" {
+		SessionName = Cfg.AWS.SessionName
+	}
+	provider := &awscmd.Provider{RoleARN: Cfg.AWS.RoleARN, SessionName: SessionName, TokenFunc: authenticate}
+	return ctx, cancel, provider, regions, nil
+}
+
+func init() {
+	graphCmd.Flags().DurationVar(&observedWindow, "observed", 0, "merge in the calls X-Ray traced over this window (e.g. 24h) as observed edges")
+	graphCmd.Flags().StringVar(&observedUntil, "observed-until", "", "end of the --observed window, RFC 3339 (default now)")
+	graphCmd.Flags().DurationVar(&auditedWindow, "cloudtrail", 0, "add the calls CloudTrail logged over this window (e.g. 24h) as audited edges")
+	graphCmd.Flags().StringVar(&auditedStore, "cloudtrail-lake", "", "CloudTrail Lake event data store to read --cloudtrail calls from (default event history)")
+	graphCmd.Flags().BoolVar(&networkEdges, "network", false, "add network reachability between security groups as network edges")
+	graphCmd.Flags().BoolVar(&dnsEdges, "dns", false, "add the Route 53 and CloudFront names resolving to services as dns edges")
+}
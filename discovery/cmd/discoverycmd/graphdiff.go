@@ -0,0 +1,99 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/graph"
+	"github.com/jamesneb/causal/discovery/snapshot"
+)
+
+var graphDiffCmd = &cobra.Command{
+	Use:   "diff <from> [to]",
+	Short: "Show dependencies added or removed between two snapshots",
+	Long: `Compare the dependency graphs of two snapshots, the second defaulting to
+"latest", to review architectural drift, e.g. after a release: the edges
+added (+) and removed (-), matched by the two resources and their relation,
+and the services whose number of direct dependencies changed (~). Calls
+observed at run time are not recorded in snapshots, so only configured and
+inferred dependencies are compared. -o json or yaml prints the difference as
+a document.`,
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to := "latest"
+		if len(args) > 1 {
+			to = args[1]
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		before, a, err := storedGraph(store, args[0])
+		if err != nil {
+			return err
+		}
+		after, b, err := storedGraph(store, to)
+		if err != nil {
+			return err
+		}
+		d := graph.Compare(before, after)
+		doc := graphDiffDocument{From: a.ID, To: b.ID, Diff: d, Incomplete: !a.Complete() || !b.Complete()}
+		if isDocumentFormat(OutputFormat) {
+			return writeDocument(cmd, doc)
+		}
+		if doc.Incomplete {
+			fmt.Fprintln(os.Stderr, "Warning: comparing against an incomplete snapshot; added and removed dependencies may only reflect what was scanned")
+		}
+		w := cmd.OutOrStdout()
+		fmt.Fprintf(w, "Comparing %s to %s\n", doc.From, doc.To)
+		if d.Empty() {
+			fmt.Fprintln(w, "No changes")
+			return nil
+		}
+		for _, e := range d.Added {
+			fmt.Fprintf(w, "+ %s -> %s: %s\n", d.Node(e.From).Name, d.Node(e.To).Name, e.Label())
+		}
+		for _, e := range d.Removed {
+			fmt.Fprintf(w, "- %s -> %s: %s\n", d.Node(e.From).Name, d.Node(e.To).Name, e.Label())
+		}
+		for _, c := range d.Changed {
+			fmt.Fprintf(w, "~ %s: %d -> %d dependencies\n", c.Node.Name, c.Before, c.After)
+		}
+		fmt.Fprintf(w, "%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+		return nil
+	},
+}
+
+// graphDiffDocument is the JSON and YAML output of graph diff.
+type graphDiffDocument struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	*graph.Diff
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// storedGraph loads the dependency graph of snapshot id from store.
+func storedGraph(store *snapshot.Store, id string) (*graph.Graph, snapshot.Snapshot, error) {
+	snap, err := store.Get(id)
+	if err != nil {
+		return nil, snap, err
+	}
+	g := graph.New()
+	keys := ownerTags()
+	err = store.Services(snap.ID, func(s discovery.Service) error {
+		s.SetOwner(keys)
+		g.Add(s)
+		return nil
+	})
+	return g, snap, err
+}
+
+func init() {
+	graphCmd.AddCommand(graphDiffCmd)
+}
@@ -0,0 +1,344 @@
+package discoverycmd
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+// catalogSchema is the GraphQL schema of the catalog.
+//
+//go:embed catalog.graphql
+var catalogSchema string
+
+// Limits of GraphQL queries. Each level of dependencies can multiply the
+// nodes a query visits, so besides nesting, the dependencies a query
+// resolves in total are bounded, and so is the time it may take.
+const (
+	graphQLMaxDepth        = 6
+	graphQLMaxQueryLength  = 16 << 10
+	graphQLMaxDependencies = 10000
+	graphQLTimeout         = 10 * time.Second
+)
+
+// graphQL returns the handler of /api/v1/graphql, which takes queries as
+// JSON {"query", "operationName", "variables"} documents.
+func (a *catalogAPI) graphQL() http.Handler {
+	h := &relay.Handler{Schema: graphqlgo.MustParseSchema(catalogSchema, &gqlQuery{},
+		graphqlgo.MaxDepth(graphQLMaxDepth),
+		graphqlgo.MaxQueryLength(graphQLMaxQueryLength))}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := a.current(w)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), graphQLTimeout)
+		defer cancel()
+		// Every field of a query is resolved from the snapshot served when
+		// it arrived, even if a run records another meanwhile.
+		ctx = context.WithValue(ctx, catalogKey{}, c)
+		ctx = context.WithValue(ctx, resolvedKey{}, new(atomic.Int64))
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type catalogKey struct{}
+
+// resolvedKey holds the number of dependencies a query has resolved.
+type resolvedKey struct{}
+
+func catalogOf(ctx context.Context) *catalog {
+	return ctx.Value(catalogKey{}).(*catalog)
+}
+
+// gqlQuery resolves the Query type of catalog.graphql.
+type gqlQuery struct{}
+
+func (gqlQuery) Snapshot(ctx context.Context) *gqlSnapshot {
+	return &gqlSnapshot{catalogOf(ctx)}
+}
+
+func (gqlQuery) Services(ctx context.Context, args struct {
+	Query                    *string
+	Types, Regions, Accounts *[]string
+	First, Offset            int32
+}) (*gqlServiceConnection, error) {
+	if args.First < 1 || args.First > maxPageSize {
+		return nil, fmt.Errorf("first %d is not between 1 and %d", args.First, maxPageSize)
+	}
+	if args.Offset < 0 {
+		return nil, fmt.Errorf("offset %d is negative", args.Offset)
+	}
+	c := catalogOf(ctx)
+	services, total := c.page(filterOf(deref(args.Query), derefList(args.Types), derefList(args.Regions), derefList(args.Accounts)), int(args.Offset), int(args.First))
+	return &gqlServiceConnection{c: c, services: services, total: total, more: int(args.Offset)+int(args.First) < total}, nil
+}
+
+func (gqlQuery) Service(ctx context.Context, args struct{ Key string }) *gqlService {
+	return catalogOf(ctx).service(args.Key)
+}
+
+func (gqlQuery) Node(ctx context.Context, args struct{ ID string }) *gqlNode {
+	c := catalogOf(ctx)
+	n, ok := c.graph.Node(args.ID)
+	if !ok {
+		return nil
+	}
+	return &gqlNode{c, n}
+}
+
+func (gqlQuery) Owners(ctx context.Context) []*gqlOwner {
+	c := catalogOf(ctx)
+	seen := map[string]bool{}
+	owners := []*gqlOwner{}
+	for _, s := range c.services {
+		if s.Owner != "" && !seen[s.Owner] {
+			seen[s.Owner] = true
+			owners = append(owners, c.owner(s.Owner))
+		}
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].name < owners[j].name })
+	return owners
+}
+
+func (gqlQuery) Owner(ctx context.Context, args struct{ Name string }) *gqlOwner {
+	c := catalogOf(ctx)
+	for _, s := range c.services {
+		if s.Owner == args.Name {
+			return c.owner(args.Name)
+		}
+	}
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefList(s *[]string) []string {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+// optional returns s, or nil for the null of an empty value.
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// service returns the resolver of the service with key, or nil.
+func (c *catalog) service(key string) *gqlService {
+	i, ok := c.byKey[key]
+	if !ok {
+		return nil
+	}
+	return &gqlService{c, c.services[i]}
+}
+
+// owner returns the resolver of the owner name, or nil for no owner.
+func (c *catalog) owner(name string) *gqlOwner {
+	if name == "" {
+		return nil
+	}
+	return &gqlOwner{c, name}
+}
+
+// dependencies returns the resolvers of the edges of the node id in
+// direction, of relation unless it is nil. It fails once the query has
+// resolved more than graphQLMaxDependencies, or run out of time.
+func (c *catalog) dependencies(ctx context.Context, id string, direction graph.Direction, relation *string) ([]*gqlDependency, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("query took longer than %s", graphQLTimeout)
+	}
+	edges := c.from[id]
+	if direction == graph.Upstream {
+		edges = c.to[id]
+	}
+	deps := []*gqlDependency{}
+	for _, e := range edges {
+		if relation == nil || e.Relation == *relation {
+			deps = append(deps, &gqlDependency{c: c, e: e, direction: direction})
+		}
+	}
+	if n := ctx.Value(resolvedKey{}).(*atomic.Int64).Add(int64(len(deps))); n > graphQLMaxDependencies {
+		return nil, fmt.Errorf("query resolves more than %d dependencies", graphQLMaxDependencies)
+	}
+	return deps, nil
+}
+
+type gqlSnapshot struct{ c *catalog }
+
+func (s gqlSnapshot) ID() string                { return s.c.snap.ID }
+func (s gqlSnapshot) StartedAt() graphqlgo.Time { return graphqlgo.Time{Time: s.c.snap.Started} }
+func (s gqlSnapshot) Status() string            { return s.c.snap.Status }
+func (s gqlSnapshot) ServiceCount() int32       { return int32(len(s.c.services)) }
+func (s gqlSnapshot) FinishedAt() *graphqlgo.Time {
+	if s.c.snap.Finished.IsZero() {
+		return nil
+	}
+	return &graphqlgo.Time{Time: s.c.snap.Finished}
+}
+
+type gqlServiceConnection struct {
+	c        *catalog
+	services []discovery.Service
+	total    int
+	more     bool
+}
+
+func (p gqlServiceConnection) TotalCount() int32 { return int32(p.total) }
+func (p gqlServiceConnection) HasNextPage() bool { return p.more }
+func (p gqlServiceConnection) Nodes() []*gqlService {
+	nodes := make([]*gqlService, len(p.services))
+	for i, s := range p.services {
+		nodes[i] = &gqlService{p.c, s}
+	}
+	return nodes
+}
+
+type gqlService struct {
+	c *catalog
+	s discovery.Service
+}
+
+func (s gqlService) Key() string                  { return s.s.Key() }
+func (s gqlService) Provider() string             { return s.s.Provider }
+func (s gqlService) AccountID() *string           { return optional(s.s.AccountID) }
+func (s gqlService) AccountAlias() *string        { return optional(s.s.AccountAlias) }
+func (s gqlService) OrganizationalUnit() *string  { return optional(s.s.OrganizationalUnit) }
+func (s gqlService) Region() *string              { return optional(s.s.Region) }
+func (s gqlService) ARN() *string                 { return optional(s.s.ARN) }
+func (s gqlService) ResourceType() string         { return string(s.s.ResourceType) }
+func (s gqlService) Name() string                 { return s.s.Name }
+func (s gqlService) Owner() *gqlOwner             { return s.c.owner(s.s.Owner) }
+func (s gqlService) DiscoveredAt() graphqlgo.Time { return graphqlgo.Time{Time: s.s.DiscoveredAt} }
+
+func (s gqlService) Tags() []*gqlTag {
+	tags := []*gqlTag{}
+	for k, v := range s.s.Tags {
+		tags = append(tags, &gqlTag{k, v})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].key < tags[j].key })
+	return tags
+}
+
+func (s gqlService) Tag(args struct{ Key string }) *string {
+	v, ok := s.s.Tags[args.Key]
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func (s gqlService) LastModified() *graphqlgo.Time {
+	if s.s.LastModified == nil {
+		return nil
+	}
+	return &graphqlgo.Time{Time: *s.s.LastModified}
+}
+
+func (s gqlService) JSON() (string, error) {
+	record, err := json.Marshal(s.s)
+	return string(record), err
+}
+
+func (s gqlService) Dependencies(ctx context.Context, args struct{ Relation *string }) ([]*gqlDependency, error) {
+	return s.c.dependencies(ctx, s.s.Key(), graph.Downstream, args.Relation)
+}
+
+func (s gqlService) Dependents(ctx context.Context, args struct{ Relation *string }) ([]*gqlDependency, error) {
+	return s.c.dependencies(ctx, s.s.Key(), graph.Upstream, args.Relation)
+}
+
+type gqlTag struct{ key, value string }
+
+func (t gqlTag) Key() string   { return t.key }
+func (t gqlTag) Value() string { return t.value }
+
+// gqlDependency is an edge seen from its From end when direction is
+// downstream, and from its To end when upstream.
+type gqlDependency struct {
+	c         *catalog
+	e         graph.Edge
+	direction graph.Direction
+}
+
+func (d gqlDependency) Relation() string    { return d.e.Relation }
+func (d gqlDependency) Confidence() *string { return optional(d.e.Confidence) }
+func (d gqlDependency) Ports() *string      { return optional(d.e.Ports) }
+func (d gqlDependency) CrossAccount() bool  { return d.e.CrossAccount }
+
+func (d gqlDependency) Calls() *float64 {
+	if d.e.Calls == 0 {
+		return nil
+	}
+	calls := float64(d.e.Calls)
+	return &calls
+}
+
+func (d gqlDependency) Node() *gqlNode {
+	id := d.e.To
+	if d.direction == graph.Upstream {
+		id = d.e.From
+	}
+	n, _ := d.c.graph.Node(id)
+	return &gqlNode{d.c, n}
+}
+
+type gqlNode struct {
+	c *catalog
+	n graph.Node
+}
+
+func (n gqlNode) ID() string           { return n.n.ID }
+func (n gqlNode) Name() string         { return n.n.Name }
+func (n gqlNode) ResourceType() string { return string(n.n.ResourceType) }
+func (n gqlNode) Provider() *string    { return optional(n.n.Provider) }
+func (n gqlNode) AccountID() *string   { return optional(n.n.AccountID) }
+func (n gqlNode) Region() *string      { return optional(n.n.Region) }
+func (n gqlNode) Owner() *gqlOwner     { return n.c.owner(n.n.Owner) }
+func (n gqlNode) External() bool       { return n.n.External }
+func (n gqlNode) Service() *gqlService { return n.c.service(n.n.ID) }
+
+func (n gqlNode) Dependencies(ctx context.Context, args struct{ Relation *string }) ([]*gqlDependency, error) {
+	return n.c.dependencies(ctx, n.n.ID, graph.Downstream, args.Relation)
+}
+
+func (n gqlNode) Dependents(ctx context.Context, args struct{ Relation *string }) ([]*gqlDependency, error) {
+	return n.c.dependencies(ctx, n.n.ID, graph.Upstream, args.Relation)
+}
+
+type gqlOwner struct {
+	c    *catalog
+	name string
+}
+
+func (o gqlOwner) Name() string { return o.name }
+
+func (o gqlOwner) Services() []*gqlService {
+	services := []*gqlService{}
+	for _, s := range o.c.services {
+		if s.Owner == o.name {
+			services = append(services, &gqlService{o.c, s})
+		}
+	}
+	return services
+}
@@ -0,0 +1,236 @@
+package discoverycmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/catalogpb"
+	"github.com/jamesneb/causal/discovery/graph"
+	"github.com/jamesneb/causal/discovery/sink"
+)
+
+// startGRPC serves the catalog of api over gRPC on addr until the returned
+// function is called. Errors serving are sent to errs.
+func startGRPC(addr string, api *catalogAPI, errs chan<- error) (func(), error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening for gRPC: %w", err)
+	}
+	srv := grpc.NewServer()
+	catalogpb.RegisterCatalogServer(srv, &catalogServer{api: api})
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			errs <- fmt.Errorf("serving gRPC: %w", err)
+		}
+	}()
+	// Change streams only end when their clients go, so they are not
+	// waited for.
+	return srv.Stop, nil
+}
+
+// catalogServer implements the Catalog service of catalog.proto over the
+// snapshot api serves.
+type catalogServer struct {
+	catalogpb.UnimplementedCatalogServer
+	api *catalogAPI
+}
+
+// current returns the catalog served, or UNAVAILABLE until there is one.
+func (s *catalogServer) current() (*catalog, error) {
+	s.api.mu.RLock()
+	defer s.api.mu.RUnlock()
+	if s.api.catalog == nil {
+		return nil, status.Error(codes.Unavailable, "no snapshot recorded yet")
+	}
+	return s.api.catalog, nil
+}
+
+func (s *catalogServer) ListServices(ctx context.Context, req *catalogpb.ListServicesRequest) (*catalogpb.ListServicesResponse, error) {
+	limit := int(req.GetPageSize())
+	switch {
+	case limit == 0:
+		limit = defaultPageSize
+	case limit < 0 || limit > maxPageSize:
+		return nil, status.Errorf(codes.InvalidArgument, "page_size %d is not between 1 and %d", limit, maxPageSize)
+	}
+	c, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	offset := 0
+	if token := req.GetPageToken(); token != "" {
+		if offset, err = parsePageToken(token, c.snap.ID); err != nil {
+			return nil, err
+		}
+	}
+	services, total := c.page(filterOf(req.GetQuery(), req.GetTypes(), req.GetRegions(), req.GetAccounts()), offset, limit)
+	resp := &catalogpb.ListServicesResponse{Snapshot: c.snap.ID, TotalSize: int32(total)}
+	for _, svc := range services {
+		resp.Services = append(resp.Services, servicePB(svc))
+	}
+	if offset+limit < total {
+		resp.NextPageToken = pageToken(c.snap.ID, offset+limit)
+	}
+	return resp, nil
+}
+
+// pageToken returns the token of the page of snapshot starting at offset.
+func pageToken(snapshot string, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(snapshot + "/" + strconv.Itoa(offset)))
+}
+
+// parsePageToken returns the offset a token of snapshot names.
+func parsePageToken(token, snapshot string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	id, offset, found := strings.Cut(string(data), "/")
+	n, convErr := strconv.Atoi(offset)
+	if err != nil || !found || convErr != nil || n < 0 {
+		return 0, status.Error(codes.InvalidArgument, "invalid page_token")
+	}
+	if id != snapshot {
+		return 0, status.Errorf(codes.FailedPrecondition, "page_token is for snapshot %s, not the one served now (%s); list again", id, snapshot)
+	}
+	return n, nil
+}
+
+func (s *catalogServer) GetService(ctx context.Context, req *catalogpb.GetServiceRequest) (*catalogpb.Service, error) {
+	c, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	i, ok := c.byKey[req.GetKey()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no service %s in the snapshot", req.GetKey())
+	}
+	return servicePB(c.services[i]), nil
+}
+
+func (s *catalogServer) StreamChanges(req *catalogpb.StreamChangesRequest, stream grpc.ServerStreamingServer[catalogpb.ChangeEvent]) error {
+	filter := filterOf(req.GetQuery(), req.GetTypes(), req.GetRegions(), req.GetAccounts())
+	changes, unsubscribe := s.api.subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case batch, ok := <-changes:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "fell behind the changes of new snapshots")
+			}
+			for _, change := range batch {
+				if !filter.match(change.Service) {
+					continue
+				}
+				if err := stream.Send(changePB(change)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (s *catalogServer) GetGraph(ctx context.Context, req *catalogpb.GetGraphRequest) (*catalogpb.Graph, error) {
+	if req.GetDepth() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "depth %d is negative", req.GetDepth())
+	}
+	c, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	g := c.graph
+	if req.GetNode() != "" {
+		direction := graph.Downstream
+		if req.GetDirection() == catalogpb.GetGraphRequest_UPSTREAM {
+			direction = graph.Upstream
+		}
+		g, err = c.subgraph(req.GetNode(), direction, int(req.GetDepth()))
+		switch {
+		case errors.Is(err, errNoNode):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case err != nil:
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	return graphPB(c.snap.ID, g), nil
+}
+
+// servicePB converts s to its message, with its whole JSON record.
+func servicePB(s discovery.Service) *catalogpb.Service {
+	record, _ := json.Marshal(s)
+	pb := &catalogpb.Service{
+		Key:                s.Key(),
+		Provider:           s.Provider,
+		AccountId:          s.AccountID,
+		AccountAlias:       s.AccountAlias,
+		OrganizationalUnit: s.OrganizationalUnit,
+		Region:             s.Region,
+		Arn:                s.ARN,
+		ResourceType:       string(s.ResourceType),
+		Name:               s.Name,
+		Owner:              s.Owner,
+		Tags:               s.Tags,
+		DiscoveredAt:       timestamppb.New(s.DiscoveredAt),
+		Json:               string(record),
+	}
+	if s.LastModified != nil {
+		pb.LastModified = timestamppb.New(*s.LastModified)
+	}
+	return pb
+}
+
+var changeKinds = map[sink.ChangeKind]catalogpb.ChangeEvent_Kind{
+	sink.ChangeAdded:   catalogpb.ChangeEvent_ADDED,
+	sink.ChangeChanged: catalogpb.ChangeEvent_CHANGED,
+	sink.ChangeRemoved: catalogpb.ChangeEvent_REMOVED,
+}
+
+func changePB(c catalogChange) *catalogpb.ChangeEvent {
+	return &catalogpb.ChangeEvent{
+		Snapshot:      c.Snapshot,
+		Baseline:      c.Baseline,
+		Kind:          changeKinds[c.Kind],
+		Service:       servicePB(c.Service),
+		ChangedFields: c.Fields,
+	}
+}
+
+func graphPB(snapshot string, g *graph.Graph) *catalogpb.Graph {
+	pb := &catalogpb.Graph{Snapshot: snapshot}
+	for _, n := range g.Nodes {
+		pb.Nodes = append(pb.Nodes, &catalogpb.Node{
+			Id:           n.ID,
+			Name:         n.Name,
+			ResourceType: string(n.ResourceType),
+			Provider:     n.Provider,
+			AccountId:    n.AccountID,
+			Region:       n.Region,
+			Tags:         n.Tags,
+			Owner:        n.Owner,
+			External:     n.External,
+		})
+	}
+	for _, e := range g.Edges {
+		pb.Edges = append(pb.Edges, &catalogpb.Edge{
+			From:         e.From,
+			To:           e.To,
+			Relation:     e.Relation,
+			Confidence:   e.Confidence,
+			Calls:        e.Calls,
+			Ports:        e.Ports,
+			CrossAccount: e.CrossAccount,
+		})
+	}
+	return pb
+}
@@ -0,0 +1,46 @@
+package discoverycmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/config"
+	"github.com/jamesneb/causal/discovery/hooks"
+)
+
+// newHooks returns the hooks configured in the config file, rejecting
+// malformed ones before the run starts.
+func newHooks() (*hooks.Runner, error) {
+	r := &hooks.Runner{Hooks: map[hooks.Event][]hooks.Hook{}}
+	for event, configured := range map[hooks.Event][]config.Hook{
+		hooks.BeforeRun:    Cfg.Hooks.BeforeRun,
+		hooks.ProviderDone: Cfg.Hooks.ProviderDone,
+		hooks.AfterRun:     Cfg.Hooks.AfterRun,
+	} {
+		for i, c := range configured {
+			h := hooks.Hook{Command: c.Command, URL: c.URL, Headers: c.Headers, Timeout: c.Timeout}
+			if err := h.Validate(); err != nil {
+				return nil, fmt.Errorf("hooks.%s[%d]: %w", event, i, err)
+			}
+			r.Hooks[event] = append(r.Hooks[event], h)
+		}
+	}
+	return r, nil
+}
+
+// runHooks runs the hooks for event with the manifest built by manifest.
+// Only BeforeRun failures are returned, to abort the run; the others are
+// warnings.
+func runHooks(ctx context.Context, r *hooks.Runner, event hooks.Event, provider string, manifest func() *discovery.Manifest) error {
+	if !r.Has(event) {
+		return nil
+	}
+	err := r.Run(ctx, hooks.Payload{Event: event, Provider: provider, Manifest: manifest()})
+	if err != nil && event != hooks.BeforeRun {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,225 @@
+package discoverycmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/config"
+	"github.com/jamesneb/causal/discovery/identity"
+	"github.com/jamesneb/causal/discovery/output"
+)
+
+var initForce bool
+var initSkipValidation bool
+
+var initCmd = &cobra.Command{
+	Use:     "init",
+	GroupID: groupAuth,
+	Short:   "Create the discovery config file",
+	Long: `Interactively generate the discovery config file: provider, Auth0 identity
+settings, the role ARN to assume, default regions and output preferences.
+
+Existing values are offered as defaults, so init can also be used to edit the
+file. Unless --skip-validation is given, the Auth0 tenant is contacted and,
+after logging in, the role is assumed with the token, to make sure the
+identity settings and the role's trust policy work before anything is
+written.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	// init must work even when the existing file does not parse, so it does
+	// not run the root hook that loads the config.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := resolveConfigPath()
+		if err != nil {
+			return err
+		}
+
+		p := &prompter{in: bufio.NewReader(cmd.InOrStdin()), out: cmd.OutOrStdout()}
+
+		cfg := config.Default()
+		if _, err := os.Stat(path); err == nil {
+			if !initForce {
+				ok, err := p.confirm(fmt.Sprintf("%s already exists. Update it?", path))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return nil
+				}
+			}
+			if existing, err := config.Load(path); err == nil {
+				cfg = existing
+			} else {
+				fmt.Fprintf(p.out, "Ignoring unreadable existing config: %v\n", err)
+			}
+		}
+
+		if err := p.fill(cfg); err != nil {
+			return err
+		}
+
+		if !initSkipValidation {
+			fmt.Fprintf(p.out, "Checking Auth0 tenant %s... ", cfg.Identity.Domain)
+			auth0Config, err := identity.NewAuth0Config(cmd.Context(), cfg.Identity.Domain, cfg.Identity.ClientID, cfg.Identity.Audience)
+			if err != nil {
+				fmt.Fprintln(p.out, "failed")
+				return fmt.Errorf("validating identity settings (use --skip-validation to write anyway): %w", err)
+			}
+			fmt.Fprintln(p.out, "ok")
+			if err := checkRole(cmd.Context(), p.out, auth0Config, cfg); err != nil {
+				return fmt.Errorf("validating role (use --skip-validation to write anyway): %w", err)
+			}
+		}
+
+		if err := config.Save(path, cfg); err != nil {
+			return err
+		}
+		fmt.Fprintf(p.out, "Wrote %s\n", path)
+		return nil
+	},
+}
+
+func init() {
+	initCmd.Flags().BoolVar(&initForce, "force", false, "update an existing config file without asking")
+	initCmd.Flags().BoolVar(&initSkipValidation, "skip-validation", false, "write the config without checking the Auth0 tenant and the role")
+}
+
+// checkRole logs in with auth0Config and assumes the role of cfg with the
+// token, so a role whose trust policy does not accept the tenant is caught
+// before the first scan.
+func checkRole(ctx context.Context, out io.Writer, auth0Config *identity.Auth0Config, cfg *config.Config) error {
+	regions, err := resolveRegions(cfg.AWS.Regions, cfg.AWS.RoleARN, cfg.AWS.ExtraRegions)
+	if err != nil {
+		return err
+	}
+	if len(regions) == 0 {
+		return errors.New("no default region to assume the role in")
+	}
+	if err := auth0Config.Login(ctx); err != nil {
+		return fmt.Errorf("authenticating with Auth0: %w", err)
+	}
+	if auth0Config.Token == nil {
+		return errors.New("authentication failed: no token received")
+	}
+	fmt.Fprintf(out, "Checking role %s... ", cfg.AWS.RoleARN)
+	if _, err := awscmd.AssumeWebIdentityRole(ctx, regions[0], auth0Config.Token.AccessToken, cfg.AWS.RoleARN, cfg.AWS.SessionName); err != nil {
+		fmt.Fprintln(out, "failed")
+		return fmt.Errorf("assuming role %s: %w", cfg.AWS.RoleARN, err)
+	}
+	fmt.Fprintln(out, "ok")
+	return nil
+}
+
+func GetInitCmd() *cobra.Command {
+
+	return initCmd
+
+}
+
+// prompter asks questions on out and reads answers line by line from in.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (p *prompter) fill(cfg *config.Config) error {
+	var err error
+	ask := func(dst *string, question string, required bool, check func(string) error) {
+		if err != nil {
+			return
+		}
+		*dst, err = p.ask(question, *dst, required, check)
+	}
+
+	ask(&cfg.Provider, "Cloud provider", true, func(s string) error {
+		if s != "aws" {
+			return fmt.Errorf("unsupported provider %q: only aws is available", s)
+		}
+		return nil
+	})
+	ask(&cfg.Identity.Domain, "Auth0 domain (e.g. example.us.auth0.com)", true, config.ValidateDomain)
+	ask(&cfg.Identity.ClientID, "Auth0 client ID", true, nil)
+	ask(&cfg.Identity.Audience, "Auth0 audience (optional)", false, nil)
+	ask(&cfg.AWS.RoleARN, "IAM role ARN to assume", true, awscmd.ValidateRoleARN)
+	ask(&cfg.AWS.SessionName, "Role session name", true, nil)
+
+	regions := strings.Join(cfg.AWS.Regions, ",")
+	ask(&regions, "Default regions (comma separated, or ALL)", true, func(s string) error {
+		_, err := resolveRegions(splitList(s), cfg.AWS.RoleARN, cfg.AWS.ExtraRegions)
+		return err
+	})
+	ask(&cfg.Output.Format, "Default output format ("+strings.Join(output.Formats, ", ")+")", false, func(s string) error {
+		_, err := output.New(s, io.Discard, output.Options{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	cfg.AWS.Regions = splitList(regions)
+	return nil
+}
+
+// splitList splits a comma separated answer, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ask prints question with def as the default answer and returns the answer,
+// re-asking while a required answer is empty or check rejects it.
+func (p *prompter) ask(question, def string, required bool, check func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+
+		line, err := p.in.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			if errors.Is(err, io.EOF) {
+				return "", errors.New("input ended before configuration was complete")
+			}
+			return "", err
+		}
+
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		if answer == "" && required {
+			fmt.Fprintln(p.out, "A value is required.")
+			continue
+		}
+		if check != nil && answer != "" {
+			if err := check(answer); err != nil {
+				fmt.Fprintln(p.out, err)
+				continue
+			}
+		}
+		return answer, nil
+	}
+}
+
+func (p *prompter) confirm(question string) (bool, error) {
+	answer, err := p.ask(question+" (y/N)", "", false, nil)
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
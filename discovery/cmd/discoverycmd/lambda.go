@@ -0,0 +1,128 @@
+package discoverycmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/config"
+	"github.com/jamesneb/causal/discovery/metrics"
+)
+
+// lambdaFlushTime is kept back from the deadline of an invocation so a run
+// cut short by it still has time to write to the sinks and commit its
+// snapshot. Functions with short timeouts keep back a quarter of the time
+// left instead, so they still scan for most of it.
+const lambdaFlushTime = 30 * time.Second
+
+// lambdaDeadline returns when the run of an invocation due at deadline
+// stops.
+func lambdaDeadline(deadline time.Time) time.Time {
+	return deadline.Add(-min(lambdaFlushTime, time.Until(deadline)/4))
+}
+
+var lambdaCmd = &cobra.Command{
+	Use:     "lambda",
+	GroupID: groupDiscovery,
+	Short:   "Run discovery as the handler of an AWS Lambda function",
+	Long: `Serve the invocations of an AWS Lambda function, running discovery once for
+each, typically from an EventBridge schedule. It is what the bootstrap built
+from cmd/lambda runs; see "Running in AWS Lambda" in the README.
+
+Discovery uses the function's execution role, whose ARN must be configured
+as aws.role_arn or $DISCOVERY_ROLE_ARN, instead of a web identity token. Like
+serve, each run is written to the configured sinks and reported to hooks.
+These environment variables override the configuration file:
+
+  DISCOVERY_ROLE_ARN        the execution role
+  DISCOVERY_REGIONS         comma-separated regions to scan, or ALL
+  DISCOVERY_S3_BUCKET       bucket of the S3 sink, with DISCOVERY_S3_PREFIX
+  DISCOVERY_DYNAMODB_TABLE  table of the DynamoDB sink
+
+An invocation returns the run report, and fails when the run is incomplete.
+Runs stop 30s before the function's timeout, or a quarter of it for
+timeouts under 2m, to leave time to write what was found.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if os.Getenv("AWS_LAMBDA_RUNTIME_API") == "" {
+			return errors.New("not running in AWS Lambda ($AWS_LAMBDA_RUNTIME_API is not set); use list, serve or daemon instead")
+		}
+		lambdaEnvironment()
+		regions, err := resolveTarget(Cfg.AWS.Regions, Cfg.AWS.RoleARN)
+		if err != nil {
+			return err
+		}
+		hookRunner, err := newHooks()
+		if err != nil {
+			return err
+		}
+		if err := checkSinks(); err != nil {
+			return err
+		}
+		applyRunSettings()
+
+		m := metrics.New()
+		var calls atomic.Pointer[discovery.APIStats]
+		awscmd.APIObserver = func(c awscmd.APICall) {
+			if s := calls.Load(); s != nil {
+				s.Record(c.Service, c.Operation, c.Err, c.Throttled)
+			}
+		}
+		handler := func(ctx context.Context, event events.EventBridgeEvent) (*discovery.RunReport, error) {
+			if deadline, ok := ctx.Deadline(); ok {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, lambdaDeadline(deadline))
+				defer cancel()
+			}
+			if event.DetailType != "" {
+				fmt.Fprintf(os.Stderr, "Invoked by %s from %s\n", event.DetailType, event.Source)
+			}
+			stats := discovery.NewAPIStats()
+			calls.Store(stats)
+			report := serveRun(ctx, m, hookRunner, stats, nil, Cfg.AWS.RoleARN, regions)
+			if report.Incomplete {
+				return report, fmt.Errorf("discovery run incomplete: %s", report.StopReason)
+			}
+			return report, nil
+		}
+		lambda.StartWithOptions(handler, lambda.WithContext(cmd.Context()))
+		return nil
+	},
+}
+
+// lambdaEnvironment applies the environment variables a Lambda function is
+// configured with over the configuration file.
+func lambdaEnvironment() {
+	if v := os.Getenv("DISCOVERY_ROLE_ARN"); v != "" {
+		Cfg.AWS.RoleARN = v
+	}
+	if v := os.Getenv("DISCOVERY_REGIONS"); v != "" {
+		Cfg.AWS.Regions = strings.Split(strings.ReplaceAll(v, " ", ""), ",")
+	}
+	if v := os.Getenv("DISCOVERY_S3_BUCKET"); v != "" {
+		if Cfg.Sinks.S3 == nil {
+			Cfg.Sinks.S3 = &config.S3Sink{}
+		}
+		Cfg.Sinks.S3.Bucket = v
+		if p := os.Getenv("DISCOVERY_S3_PREFIX"); p != "" {
+			Cfg.Sinks.S3.Prefix = p
+		}
+	}
+	if v := os.Getenv("DISCOVERY_DYNAMODB_TABLE"); v != "" {
+		if Cfg.Sinks.DynamoDB == nil {
+			Cfg.Sinks.DynamoDB = &config.DynamoDBSink{}
+		}
+		Cfg.Sinks.DynamoDB.Table = v
+	}
+}
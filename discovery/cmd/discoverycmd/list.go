@@ -0,0 +1,548 @@
+package discoverycmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/cache"
+	"github.com/jamesneb/causal/discovery/hooks"
+	"github.com/jamesneb/causal/discovery/identity"
+	"github.com/jamesneb/causal/discovery/output"
+	"github.com/jamesneb/causal/discovery/plugin"
+)
+
+var RoleArn string
+var SessionName string = "discovery-cli-session"
+
+// When we add additional providers we will add an additional flag
+var listCmd = &cobra.Command{
+	Use:     "list [region] [roleArn]",
+	Aliases: []string{"ls"},
+	GroupID: groupDiscovery,
+	Short:   "Discover and list services",
+	Long: `Discover and list services running on various platforms.
+
+The region and role ARN default to the regions and role_arn in the config
+file written by "discovery init". --org scans every active account of the
+role's organization, assuming --org-role (default OrganizationDiscoveryRole)
+in each member account.
+
+A run that is interrupted or times out leaves a checkpoint; "list --resume"
+repeats it with the same regions and role, scanning only the resource types
+that had not finished.`,
+	Args: cobra.RangeArgs(0, 2),
+	// Runtime failures are reported by the command itself; usage is only
+	// useful for argument errors.
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		requested := Cfg.AWS.Regions
+		if len(args) > 0 {
+			requested = []string{args[0]}
+		}
+		RoleArn = Cfg.AWS.RoleARN
+		if len(args) > 1 {
+			RoleArn = args[1]
+		}
+		store, err := cacheStore()
+		if err != nil {
+			return err
+		}
+		var checkpoint *cache.Checkpoint
+		if Resume {
+			if len(args) > 0 {
+				return errors.New("--resume repeats the interrupted run; it takes no arguments")
+			}
+			if store == nil {
+				return errors.New("--resume needs the result cache, which is disabled")
+			}
+			if checkpoint, err = store.LoadCheckpoint(); err != nil {
+				return err
+			}
+			if checkpoint == nil {
+				return errors.New("no interrupted run to resume")
+			}
+			requested, RoleArn = checkpoint.Regions, checkpoint.RoleARN
+			store.Since = checkpoint.Started
+		}
+		regions, err := resolveTarget(requested, RoleArn)
+		if err != nil {
+			return err
+		}
+		hookRunner, err := newHooks()
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		if Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, Timeout)
+			defer cancel()
+		}
+		applyRunSettings()
+		// Without the cache every run logs in, so catch bad identity
+		// settings before scanning.
+		if store == nil {
+			if err := Cfg.Identity.Validate(); err != nil {
+				return err
+			}
+		}
+
+		out, err := newOutputWriter(cmd)
+		if err != nil {
+			return err
+		}
+
+		// Log in only when a region actually needs AWS credentials, so
+		// fully cached runs skip the device flow.
+		token := onceToken(authenticate)
+		providers, err := newProviders(ctx, RoleArn, regions, token, store)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Discovering services in %s with role %s\n", strings.Join(regions, ", "), RoleArn)
+		report := discovery.NewRunReport()
+		calls := discovery.NewAPIStats()
+		awscmd.APIObserver = func(c awscmd.APICall) {
+			calls.Record(c.Service, c.Operation, c.Err, c.Throttled)
+		}
+		opts := discovery.Options{
+			Providers:          providers,
+			Regions:            regions,
+			Parallelism:        ParallelRegions,
+			AccountParallelism: parallelAccounts(),
+			RetryAccounts:      RetryAccounts || Cfg.AWS.RetryAccounts,
+		}
+		manifest := func() *discovery.Manifest {
+			return discovery.NewManifest(report, runIdentity(RoleArn), opts, calls)
+		}
+		opts.ProviderDone = func(p discovery.Provider) {
+			runHooks(ctx, hookRunner, hooks.ProviderDone, p.Name(), manifest)
+		}
+		if err := runHooks(ctx, hookRunner, hooks.BeforeRun, "", manifest); err != nil {
+			return fmt.Errorf("not starting discovery: %w", err)
+		}
+
+		handlers := []discovery.ResultHandler{
+			report,
+			discovery.ServiceHandler(func(ctx context.Context, s discovery.Service) error {
+				if err := out.Write(s); err != nil {
+					return fmt.Errorf("writing output: %w", err)
+				}
+				return nil
+			}),
+		}
+		sinks, err := newSinks(ctx)
+		if err != nil {
+			return err
+		}
+		if sinks != nil {
+			handlers = append(handlers, sinks)
+		}
+		recorder, closeSnapshots := startSnapshot(regions)
+		defer closeSnapshots()
+		if recorder != nil {
+			handlers = append(handlers, recorder)
+		}
+		handler := withOwners(discovery.MultiHandler(handlers...))
+		if Costs || CostTag != "" {
+			handler = withCosts(handler, &awscmd.Provider{RoleARN: RoleArn, SessionName: SessionName, TokenFunc: token})
+		}
+		handler = withStackSets(handler, &awscmd.Provider{RoleARN: RoleArn, SessionName: SessionName, TokenFunc: token}, regions, StackSets, Organization || Cfg.AWS.Organization != nil)
+		runErr := discovery.Run(ctx, opts, handler)
+		report.Finish(runErr)
+		finishSinks(ctx, sinks, report)
+		commitSnapshot(recorder, report)
+		final := manifest()
+		writeManifest(final)
+		// Interrupted runs still report to their hooks.
+		runHooks(context.WithoutCancel(ctx), hookRunner, hooks.AfterRun, "", func() *discovery.Manifest { return final })
+
+		// Flush buffered formats even when the run was cut short so partial
+		// results are not lost.
+		if s, ok := out.(output.Summarizer); ok {
+			s.Summary(report)
+		}
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+		report.Print(os.Stderr)
+		if store != nil {
+			updateCheckpoint(store, checkpoint, report, RoleArn, regions)
+		}
+
+		// The command context is only cancelled by SIGINT/SIGTERM; a run
+		// deadline surfaces on the derived ctx as DeadlineExceeded instead.
+		if errors.Is(cmd.Context().Err(), context.Canceled) {
+			return &ExitError{Code: ExitInterrupted, Err: errors.New("discovery interrupted")}
+		}
+		if runErr != nil && ctx.Err() == nil {
+			return runErr
+		}
+		if report.Partial() {
+			return &ExitError{Code: ExitPartial, Err: errors.New("discovery finished with errors; results are partial")}
+		}
+		return nil
+	},
+}
+
+// resolveTarget checks that regions and a role were given and resolves the
+// region names.
+func resolveTarget(requested []string, roleARN string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, errors.New("no region given and none configured; pass one or run \"discovery init\"")
+	}
+	if roleARN == "" {
+		return nil, errors.New("no role ARN given and none configured; pass one or run \"discovery init\"")
+	}
+	if err := awscmd.ValidateRoleARN(roleARN); err != nil {
+		return nil, err
+	}
+	return resolveRegions(requested, roleARN, Cfg.AWS.ExtraRegions)
+}
+
+// applyRunSettings copies the global flags into the AWS provider's settings.
+func applyRunSettings() {
+	awscmd.RequestTimeout = RequestTimeout
+	awscmd.MaxAttempts = MaxAttempts
+	awscmd.Workers = Workers
+	awscmd.OrderedResults = Ordered
+	awscmd.RateLimit = Cfg.AWS.RateLimit
+	if RateLimit > 0 {
+		awscmd.RateLimit = RateLimit
+	}
+	awscmd.RateBurst = Cfg.AWS.RateBurst
+	awscmd.ServiceRateLimits = Cfg.AWS.ServiceRateLimits
+	awscmd.AccountRateLimits = Cfg.AWS.AccountRateLimits
+}
+
+// parallelAccounts returns how many accounts are scanned at once, from the
+// flag or else the config; 0 does not limit them.
+func parallelAccounts() int {
+	if ParallelAccounts > 0 {
+		return ParallelAccounts
+	}
+	return Cfg.AWS.ParallelAccounts
+}
+
+// newProviders returns the AWS provider for roleARN followed by the installed
+// plugins, each wrapped in store unless it is nil. token is called for the
+// web identity token the first time AWS credentials are needed; when it is
+// nil, the ambient credentials of roleARN are used instead. In an
+// organization, its delegated administrators are discovered in the first of
+// regions.
+func newProviders(ctx context.Context, roleARN string, regions []string, token func(context.Context) (string, error), store *cache.Store) ([]discovery.Provider, error) {
+	if Cfg.AWS.SessionName != "" {
+		SessionName = Cfg.AWS.SessionName
+	}
+	usage := Cfg.AWS.UsageWindow
+	if UsageWindow > 0 {
+		usage = UsageWindow
+	}
+	hub := &awscmd.Provider{
+		RoleARN:              roleARN,
+		SessionName:          SessionName,
+		TokenFunc:            token,
+		AmbientCredentials:   token == nil,
+		SkipRolePolicies:     Cfg.AWS.SkipRolePolicies,
+		SkipResourcePolicies: Cfg.AWS.SkipResourcePolicies,
+		CodeDependencies:     Cfg.AWS.CodeDependencies || CodeDependencies,
+		UsageWindow:          usage,
+	}
+	if (Organization || Cfg.AWS.Organization != nil) && len(regions) > 0 {
+		hub.DelegatedAdministratorsRegion = regions[0]
+	}
+	providers := []discovery.Provider{hub}
+	if Organization || Cfg.AWS.Organization != nil || len(Cfg.AWS.Accounts) > 0 {
+		var err error
+		if providers, err = accountProviders(ctx, hub); err != nil {
+			return nil, err
+		}
+	} else if len(AccountFilter) > 0 {
+		return nil, errors.New("--account selects among the accounts of --org or aws.accounts; neither is set")
+	}
+	if !Cfg.Plugins.Disabled {
+		dir, err := pluginDir()
+		if err != nil {
+			return nil, err
+		}
+		plugins, err := plugin.LoadAll(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range plugins {
+			providers = append(providers, p)
+		}
+	}
+	if store != nil {
+		for i, p := range providers {
+			providers[i] = cache.Wrap(p, store)
+		}
+	}
+	return providers, nil
+}
+
+// accountProviders returns hub for its own account and a provider assuming
+// a role with hub's credentials in each other account to scan: every active
+// account of hub's organization in organization mode, else those in
+// aws.accounts, less those --account leaves out. Roles configured in
+// aws.accounts replace the organization role.
+func accountProviders(ctx context.Context, hub *awscmd.Provider) ([]discovery.Provider, error) {
+	roles := Cfg.AWS.Accounts
+	for _, id := range slices.Sorted(maps.Keys(roles)) {
+		r := roles[id]
+		if err := awscmd.ValidateRoleARN(r.RoleARN); err != nil {
+			return nil, fmt.Errorf("aws.accounts.%s: %w", id, err)
+		}
+		if account := awscmd.AccountFromARN(r.RoleARN); account != id {
+			return nil, fmt.Errorf("aws.accounts.%s: role %s is in account %s", id, r.RoleARN, account)
+		}
+	}
+
+	var accounts []awscmd.Account
+	role := organizationRole()
+	if Organization || Cfg.AWS.Organization != nil {
+		var err error
+		if accounts, err = hub.OrganizationAccounts(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		accounts = append(accounts, awscmd.Account{ID: hub.AccountID()})
+		for _, id := range slices.Sorted(maps.Keys(roles)) {
+			if id != hub.AccountID() {
+				accounts = append(accounts, awscmd.Account{ID: id})
+			}
+		}
+	}
+	if len(AccountFilter) > 0 {
+		accounts = slices.DeleteFunc(accounts, func(a awscmd.Account) bool {
+			return !slices.Contains(AccountFilter, a.ID) && (a.Name == "" || !slices.Contains(AccountFilter, a.Name))
+		})
+		if len(accounts) == 0 {
+			return nil, fmt.Errorf("no account matches --account %s", strings.Join(AccountFilter, ","))
+		}
+	}
+	if Organization || Cfg.AWS.Organization != nil {
+		// Units only label results, so a role that may not read them
+		// still scans.
+		if err := hub.OrganizationalUnits(ctx, accounts); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; services are not labeled with their organizational units\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "Discovering %d accounts of the organization with role %s\n", len(accounts), role)
+	}
+
+	var providers []discovery.Provider
+	for _, a := range accounts {
+		if a.ID == hub.AccountID() {
+			hub.AccountName, hub.OrganizationalUnit = a.Name, a.OrganizationalUnit
+			providers = append(providers, hub)
+			continue
+		}
+		providers = append(providers, memberProvider(hub, a, role))
+	}
+	return providers, nil
+}
+
+// organizationRole returns the role assumed in the organization's member
+// accounts: --org-role, else the configured one, else the default.
+func organizationRole() string {
+	if OrganizationRole != "" {
+		return OrganizationRole
+	}
+	if o := Cfg.AWS.Organization; o != nil && o.RoleName != "" {
+		return o.RoleName
+	}
+	return awscmd.DefaultOrganizationRole
+}
+
+// memberProvider returns the provider of hub for account a, assuming the
+// role aws.accounts configures for it or else role, by name.
+func memberProvider(hub *awscmd.Provider, a awscmd.Account, role string) *awscmd.Provider {
+	roleARN, externalID := hub.MemberRoleARN(a.ID, role), ""
+	if r, ok := Cfg.AWS.Accounts[a.ID]; ok {
+		roleARN, externalID = r.RoleARN, r.ExternalID
+	}
+	return hub.Member(a, roleARN, externalID)
+}
+
+// accountProvider returns a func giving the provider for an account ID, as
+// discovery would scan it: hub for hub's own account, and members of hub for
+// the others. It is safe for concurrent use, and returns one provider per
+// account, so each assumes its role once per region.
+func accountProvider(hub *awscmd.Provider) func(account string) *awscmd.Provider {
+	var mu sync.Mutex
+	members := map[string]*awscmd.Provider{}
+	role := organizationRole()
+	return func(account string) *awscmd.Provider {
+		if account == "" || account == hub.AccountID() {
+			return hub
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		p, ok := members[account]
+		if !ok {
+			p = memberProvider(hub, awscmd.Account{ID: account}, role)
+			members[account] = p
+		}
+		return p
+	}
+}
+
+// AccountFilter limits a multi-account run to these accounts, by ID or name
+// in the organization.
+var AccountFilter []string
+
+// Organization scans every account of the role's organization.
+var Organization bool
+
+// OrganizationRole is the role assumed in the organization's member
+// accounts.
+var OrganizationRole string
+
+// Resume repeats the last interrupted run.
+var Resume bool
+
+// ManifestPath is where the run manifest is written; empty skips it.
+var ManifestPath string
+
+// CodeDependencies records the dependencies declared in every function's
+// package.
+var CodeDependencies bool
+
+// UsageWindow is how far back function usage is read from CloudWatch; 0
+// does not read it.
+var UsageWindow time.Duration
+
+func init() {
+	listCmd.Flags().BoolVar(&NoSnapshot, "no-snapshot", false, "do not record this run in the snapshot database")
+	listCmd.Flags().BoolVar(&Resume, "resume", false, "resume the last interrupted run, skipping resource types it already finished")
+	listCmd.Flags().BoolVar(&CodeDependencies, "code-dependencies", false, "download every function's package to record the dependencies its requirements.txt, package.json, go.mod or pom.xml declare")
+	listCmd.Flags().DurationVar(&UsageWindow, "usage", 0, "record every function's invocations, error rate, throttles and p95 duration over this window (e.g. 168h) from CloudWatch")
+	listCmd.Flags().BoolVar(&Organization, "org", false, "scan every active account of the role's organization, assuming --org-role in each")
+	listCmd.Flags().StringVar(&OrganizationRole, "org-role", "", "role assumed in the organization's member accounts with --org (default from config, else "+awscmd.DefaultOrganizationRole+")")
+	listCmd.Flags().StringSliceVar(&AccountFilter, "account", nil, "with --org or aws.accounts, only scan these accounts, by ID or organization account name, comma separated")
+	listCmd.Flags().StringVar(&ManifestPath, "manifest", "", "write a JSON run manifest (identity, regions, counts, API calls, errors) to this file")
+}
+
+// runIdentity describes the principal a run uses, for its manifest.
+func runIdentity(roleARN string) discovery.ManifestIdentity {
+	return discovery.ManifestIdentity{
+		Provider:  "aws",
+		Principal: roleARN,
+		AccountID: awscmd.AccountFromARN(roleARN),
+		Session:   SessionName,
+	}
+}
+
+// writeManifest writes m to ManifestPath, if set. Failing to write it is
+// reported but does not fail the run.
+func writeManifest(m *discovery.Manifest) {
+	if ManifestPath == "" {
+		return
+	}
+	if err := m.WriteFile(ManifestPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// updateCheckpoint saves a checkpoint after an incomplete run and removes it
+// once a resumed run completes. A resumed run keeps the original start time
+// so everything finished since then still counts.
+func updateCheckpoint(store *cache.Store, resumed *cache.Checkpoint, report *discovery.RunReport, roleARN string, regions []string) {
+	if !report.Incomplete {
+		if resumed != nil {
+			if err := store.ClearCheckpoint(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: removing checkpoint: %v\n", err)
+			}
+		}
+		return
+	}
+	cp := cache.Checkpoint{Started: report.Started, RoleARN: roleARN, Regions: regions}
+	if resumed != nil {
+		cp.Started = resumed.Started
+	}
+	if err := store.SaveCheckpoint(cp); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Run \"discovery list --resume\" to continue where this run stopped.")
+}
+
+func GetListCmd() *cobra.Command {
+
+	return listCmd
+
+}
+
+// authenticate runs the Auth0 device flow and returns the token used for
+// AWS role assumption.
+func authenticate(ctx context.Context) (string, error) {
+	auth0Config, err := login(ctx)
+	if err != nil {
+		return "", err
+	}
+	return auth0Config.Token.AccessToken, nil
+}
+
+// login runs the Auth0 device flow of the configured identity and returns
+// its config, holding the token.
+func login(ctx context.Context) (*identity.Auth0Config, error) {
+	if err := Cfg.Identity.Validate(); err != nil {
+		return nil, err
+	}
+	auth0Config, err := identity.NewAuth0Config(ctx, Cfg.Identity.Domain, Cfg.Identity.ClientID, Cfg.Identity.Audience)
+	if err != nil {
+		return nil, fmt.Errorf("creating Auth0 config: %w", err)
+	}
+
+	if err := auth0Config.Login(ctx); err != nil {
+		return nil, fmt.Errorf("authenticating with Auth0: %w", err)
+	}
+
+	if auth0Config.Token == nil {
+		return nil, errors.New("authentication failed: no token received")
+	}
+
+	return auth0Config, nil
+}
+
+// resolveRegions expands ALL to the default regions of roleARN's partition
+// and normalizes region names, rejecting regions the AWS provider does not
+// support unless they are in extra. Every region is returned once.
+func resolveRegions(requested []string, roleARN string, extra []string) ([]string, error) {
+	partition := awscmd.Partition(roleARN)
+	var regions []string
+	seen := map[string]bool{}
+	add := func(r string) {
+		if !seen[r] {
+			seen[r] = true
+			regions = append(regions, r)
+		}
+	}
+	for _, r := range requested {
+		if strings.EqualFold(r, "ALL") {
+			for _, r := range awscmd.DefaultRegions(partition) {
+				add(r)
+			}
+			continue
+		}
+		r, err := awscmd.ValidateRegion(r, partition, extra)
+		if err != nil {
+			return nil, err
+		}
+		add(r)
+	}
+	return regions, nil
+}
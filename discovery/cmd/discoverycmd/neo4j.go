@@ -0,0 +1,82 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/neo4j"
+)
+
+var (
+	neo4jOpts   neo4j.Options
+	neo4jDryRun bool
+)
+
+var neo4jCmd = &cobra.Command{
+	Use:     "neo4j [snapshot]",
+	GroupID: groupExport,
+	Short:   "Load the dependency graph of a snapshot into Neo4j",
+	Long: `Merge the dependency graph of a snapshot (default "latest") into Neo4j over
+Bolt, to explore it with Neo4j Browser, Bloom or Cypher queries. Every
+resource is a :Resource node keyed by its id (the ARN), also labelled with
+its type, e.g. :LambdaFunction, with its name, account, region and tags
+("tag:team") as properties. Each dependency is a relationship of its
+relation in upper snake case, e.g. EXECUTION_ROLE, with its confidence,
+calls and ports as properties.
+
+Loading again updates resources in place; --replace deletes the resources
+loaded before, so those since removed go too. The URI, username and
+database come from --uri, --username and --database or NEO4J_URI,
+NEO4J_USERNAME and NEO4J_DATABASE, the password from NEO4J_PASSWORD.
+--dry-run prints the Cypher statements instead, as graph -o cypher does:
+
+  NEO4J_PASSWORD=... discovery neo4j --uri neo4j://localhost:7687
+  discovery neo4j --dry-run | cypher-shell -u neo4j`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		if !neo4jDryRun {
+			if err := neo4jOpts.Validate(); err != nil {
+				return err
+			}
+		}
+		g, err := snapshotGraph(id)
+		if err != nil {
+			return err
+		}
+		if neo4jDryRun {
+			return g.WriteCypher(cmd.OutOrStdout())
+		}
+
+		neo4jOpts.Password = os.Getenv("NEO4J_PASSWORD")
+		start := time.Now()
+		if err := neo4j.Load(cmd.Context(), g, neo4jOpts); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Loaded %d resources and %d dependencies into %s in %s\n", len(g.Nodes), len(g.Edges), neo4jOpts.URI, time.Since(start).Round(time.Millisecond))
+		return nil
+	},
+}
+
+// envOr returns the environment variable key, or def when it is unset.
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+func init() {
+	neo4jCmd.Flags().StringVar(&neo4jOpts.URI, "uri", os.Getenv("NEO4J_URI"), "Bolt URI of the server, e.g. neo4j://localhost:7687")
+	neo4jCmd.Flags().StringVar(&neo4jOpts.Username, "username", envOr("NEO4J_USERNAME", "neo4j"), "user to log in as")
+	neo4jCmd.Flags().StringVar(&neo4jOpts.Database, "database", os.Getenv("NEO4J_DATABASE"), "database to write to (default the server's)")
+	neo4jCmd.Flags().BoolVar(&neo4jOpts.Replace, "replace", false, "delete the resources loaded before")
+	neo4jCmd.Flags().BoolVar(&neo4jDryRun, "dry-run", false, "print the Cypher statements instead of running them")
+}
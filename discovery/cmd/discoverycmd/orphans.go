@@ -0,0 +1,197 @@
+package discoverycmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+// metricRetention is how long CloudWatch keeps the daily data points the
+// idle window is read at.
+const metricRetention = 455 * 24 * time.Hour
+
+var (
+	orphansSnapshot string
+	orphansIdle     time.Duration
+)
+
+var graphOrphansCmd = &cobra.Command{
+	Use:   "orphans",
+	Short: "List resources that look unused, as candidates for cleanup",
+	Long: `List the resources of a snapshot's dependency graph (--snapshot, default
+"latest") that look unused, by cross-referencing the graph with usage read
+from AWS with the configured role:
+
+  - functions and state machines nothing depends on or invokes, neither an
+    API, bucket, bus, state machine nor event source, and that CloudWatch
+    recorded no invocations or executions of over --idle;
+  - SNS topics without confirmed subscriptions;
+  - target groups without registered targets or not used by any load
+    balancer.
+
+Callers the graph cannot see, such as clients outside AWS calling a
+function directly, are only ruled out by --idle, so check candidates before
+deleting them. The role needs cloudwatch:GetMetricData,
+sns:ListSubscriptionsByTopic, elasticloadbalancing:DescribeTargetGroups and
+elasticloadbalancing:DescribeTargetHealth. -o json or yaml prints the
+candidates as a document.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if orphansIdle <= 0 {
+			return errors.New("--idle must be positive")
+		}
+		if orphansIdle > metricRetention {
+			return fmt.Errorf("--idle %s is longer than the %d days CloudWatch keeps daily metrics", orphansIdle, int(metricRetention.Hours()/24))
+		}
+		g, err := snapshotGraph(orphansSnapshot)
+		if err != nil {
+			return err
+		}
+		ctx, cancel, provider, regions, err := graphProvider(cmd.Context(), g)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		orphans, err := findOrphans(ctx, g, provider, regions, orphansIdle)
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(OutputFormat) {
+		case "", "table":
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tTYPE\tREASON\tID")
+			for _, o := range orphans {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.Node.Name, o.Node.ResourceType, o.Reason, o.Node.ID)
+			}
+			return tw.Flush()
+		case "json", "yaml", "yml":
+			return writeDocument(cmd, orphans)
+		default:
+			return fmt.Errorf("unknown orphans format %q (supported: table, json, yaml)", OutputFormat)
+		}
+	},
+}
+
+// orphan is a resource graph orphans suggests cleaning up.
+type orphan struct {
+	Node   graph.Node `json:"node"`
+	Reason string     `json:"reason"`
+}
+
+// findOrphans returns the resources of g in regions that look unused,
+// judging invocations and executions over idle.
+func findOrphans(ctx context.Context, g *graph.Graph, provider *awscmd.Provider, regions []string, idle time.Duration) ([]orphan, error) {
+	inRegion := map[string]bool{}
+	for _, r := range regions {
+		inRegion[r] = true
+	}
+	account := provider.AccountID()
+	end := time.Now()
+	start := end.Add(-idle)
+
+	orphans := []orphan{}
+	// Unreferenced functions and state machines, by region, with the metric
+	// showing their use.
+	byRegion := map[string][]graph.Node{}
+	for _, n := range g.Unreferenced() {
+		if n.Provider == "aws" && inRegion[n.Region] && (n.ResourceType == discovery.ResourceTypeLambdaFunction || n.ResourceType == discovery.ResourceTypeStateMachine) {
+			byRegion[n.Region] = append(byRegion[n.Region], n)
+		}
+	}
+	var errs []error
+	for _, region := range regions {
+		nodes := byRegion[region]
+		if len(nodes) == 0 {
+			continue
+		}
+		metrics := make([]awscmd.Metric, len(nodes))
+		for i, n := range nodes {
+			if n.ResourceType == discovery.ResourceTypeStateMachine {
+				metrics[i] = awscmd.ExecutionsMetric(n.ID)
+			} else {
+				metrics[i] = awscmd.InvocationsMetric(n.Name)
+			}
+		}
+		sums, err := provider.MetricSums(ctx, region, metrics, start, end)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: reading metrics: %w", region, err))
+			continue
+		}
+		for i, n := range nodes {
+			if sums[i] == 0 {
+				used := "invocations"
+				if n.ResourceType == discovery.ResourceTypeStateMachine {
+					used = "executions"
+				}
+				orphans = append(orphans, orphan{Node: n, Reason: fmt.Sprintf("no dependents, no %s in %s", used, formatWindow(idle))})
+			}
+		}
+	}
+
+	for _, n := range g.Nodes {
+		if n.ResourceType != discovery.ResourceTypeSNSTopic || !inRegion[n.Region] || awscmd.AccountFromARN(n.ID) != account {
+			continue
+		}
+		subscriptions, err := provider.TopicSubscriptions(ctx, n.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.Region, err))
+			continue
+		}
+		if subscriptions == 0 {
+			orphans = append(orphans, orphan{Node: n, Reason: "no subscriptions"})
+		}
+	}
+
+	for _, region := range regions {
+		groups, err := provider.TargetGroups(ctx, region)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", region, err))
+			continue
+		}
+		for _, tg := range groups {
+			var reason string
+			switch {
+			case tg.Targets == 0:
+				reason = "no registered targets"
+			case len(tg.LoadBalancers) == 0:
+				reason = "no load balancer"
+			default:
+				continue
+			}
+			n := graph.Node{ID: tg.ARN, Name: tg.Name, ResourceType: discovery.ResourceTypeTargetGroup, Provider: "aws", AccountID: awscmd.AccountFromARN(tg.ARN), Region: region}
+			orphans = append(orphans, orphan{Node: n, Reason: reason})
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Found %d unused resources in %d regions\n", len(orphans), len(regions))
+	return orphans, nil
+}
+
+// formatWindow formats d in days when it is a whole number of them, e.g.
+// "14d".
+func formatWindow(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+func init() {
+	graphOrphansCmd.Flags().StringVar(&orphansSnapshot, "snapshot", "latest", "snapshot whose graph to analyze")
+	graphOrphansCmd.Flags().DurationVar(&orphansIdle, "idle", 14*24*time.Hour, "how long functions and state machines must have gone unused")
+	graphCmd.AddCommand(graphOrphansCmd)
+}
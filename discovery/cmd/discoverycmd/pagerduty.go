@@ -0,0 +1,90 @@
+package discoverycmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/graph"
+	"github.com/jamesneb/causal/discovery/pagerduty"
+)
+
+var pagerdutyDryRun bool
+
+var pagerdutyCmd = &cobra.Command{
+	Use:     "pagerduty [snapshot]",
+	GroupID: groupExport,
+	Short:   "Sync a snapshot into the PagerDuty service directory",
+	Long: `Create or update a PagerDuty technical service for every Lambda function in a
+snapshot (default "latest") and record the dependencies between them from
+the dependency graph.
+
+A function's owner is its first pagerduty.owner_tags tag (default team,
+then owner); pagerduty.escalation_policies in the config file maps owners
+to escalation policy IDs, with pagerduty.default_escalation_policy for the
+rest. Functions without a policy are skipped.
+
+The REST API key is read from PAGERDUTY_TOKEN. Services of the same name
+that discovery did not create are left as they are.
+
+  discovery pagerduty --dry-run
+  PAGERDUTY_TOKEN=... discovery pagerduty`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		client := &pagerduty.Client{Token: os.Getenv("PAGERDUTY_TOKEN")}
+		if client.Token == "" && !pagerdutyDryRun {
+			return errors.New("set PAGERDUTY_TOKEN to a REST API key")
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		snap, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		services, err := store.LoadServices(snap.ID)
+		if err != nil {
+			return err
+		}
+		g := graph.New()
+		for _, s := range services {
+			g.Add(s)
+		}
+		c := Cfg.PagerDuty
+		opts := pagerduty.Options{
+			OwnerTags:               c.OwnerTags,
+			EscalationPolicies:      c.EscalationPolicies,
+			DefaultEscalationPolicy: c.DefaultEscalationPolicy,
+		}
+		if len(opts.OwnerTags) == 0 {
+			opts.OwnerTags = []string{"team", "owner"}
+		}
+		plan := pagerduty.NewPlan(services, g, opts)
+		if pagerdutyDryRun {
+			return writeDocument(cmd, plan)
+		}
+		for _, s := range plan.Skipped {
+			fmt.Fprintf(os.Stderr, "Skipped %s: %s\n", s.Key, s.Reason)
+		}
+		res, err := client.Sync(cmd.Context(), plan)
+		for _, name := range res.Unmanaged {
+			fmt.Fprintf(os.Stderr, "Warning: not updating %s: it was not created by discovery\n", name)
+		}
+		fmt.Fprintf(os.Stderr, "Created %d, updated %d and left %d PagerDuty services unchanged; added %d dependencies\n",
+			len(res.Created), len(res.Updated), res.Unchanged, res.Dependencies)
+		return err
+	},
+}
+
+func init() {
+	pagerdutyCmd.Flags().BoolVar(&pagerdutyDryRun, "dry-run", false, "print the services and dependencies instead of writing them")
+}
@@ -0,0 +1,104 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/plugin"
+)
+
+var pluginsCmd = &cobra.Command{
+	Use:     "plugins",
+	Aliases: []string{"plugin"},
+	GroupID: groupAuth,
+	Short:   "Manage external cataloger plugins",
+	Long: `Plugins are executables named discovery-plugin-<name> in the plugin
+directory (default $XDG_DATA_HOME/discovery/plugins). Every installed plugin
+is scanned by "discovery list" alongside the built-in providers.`,
+	SilenceUsage: true,
+}
+
+var pluginsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List installed plugins and their catalogers",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := pluginDir()
+		if err != nil {
+			return err
+		}
+		paths, err := plugin.Find(dir)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tCATALOGERS\tREGIONS\tPATH")
+		for _, path := range paths {
+			p, err := plugin.Load(cmd.Context(), path)
+			if err != nil {
+				fmt.Fprintf(tw, "?\t-\t-\t%s (%v)\n", path, err)
+				continue
+			}
+			regions := "all"
+			if len(p.Manifest.Regions) > 0 {
+				regions = strings.Join(p.Manifest.Regions, ",")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Name(), strings.Join(p.Manifest.Catalogers, ","), regions, path)
+		}
+		return tw.Flush()
+	},
+}
+
+// pluginSHA256 is the checksum an installed plugin must have.
+var pluginSHA256 string
+
+var pluginsInstallCmd = &cobra.Command{
+	Use:   "install <path|url>",
+	Short: "Install a plugin executable from a file or https URL",
+	Long: `Install a plugin executable from a file or an https URL. A download is
+only run, to check that it answers describe, once its SHA-256 matches
+--sha256, which URLs require; for files it is optional.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := pluginDir()
+		if err != nil {
+			return err
+		}
+		p, err := plugin.Install(cmd.Context(), dir, args[0], pluginSHA256)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Installed %s (%s) to %s\n", p.Name(), strings.Join(p.Manifest.Catalogers, ", "), p.Path)
+		return nil
+	},
+}
+
+var pluginsRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm", "uninstall"},
+	Short:   "Remove an installed plugin",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := pluginDir()
+		if err != nil {
+			return err
+		}
+		return plugin.Remove(cmd.Context(), dir, args[0])
+	},
+}
+
+func init() {
+	pluginsInstallCmd.Flags().StringVar(&pluginSHA256, "sha256", "", "hex SHA-256 checksum the plugin executable must have (required for URLs)")
+	pluginsCmd.AddCommand(pluginsListCmd, pluginsInstallCmd, pluginsRemoveCmd)
+}
+
+func pluginDir() (string, error) {
+	if Cfg.Plugins.Dir != "" {
+		return Cfg.Plugins.Dir, nil
+	}
+	return plugin.DefaultDir()
+}
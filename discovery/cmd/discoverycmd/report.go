@@ -0,0 +1,64 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/htmlreport"
+)
+
+var reportTitle string
+
+var reportCmd = &cobra.Command{
+	Use:     "report [snapshot]",
+	GroupID: groupExport,
+	Short:   "Write a shareable HTML report of a snapshot",
+	Long: `Write a single-file HTML report of a snapshot (default "latest") to stdout:
+summary figures, the problems the run hit, a searchable table per resource
+type and the dependency graph. --group-by owner, or another column, adds a
+table of the services of each type per owner. The page needs no network
+access, so it can be mailed or attached to a ticket:
+
+  discovery report --output html > inventory.html`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if f := strings.ToLower(OutputFormat); f != "" && f != "html" {
+			return fmt.Errorf("unknown report format %q (supported: html)", OutputFormat)
+		}
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		snap, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		services, err := store.LoadServices(snap.ID)
+		if err != nil {
+			return err
+		}
+		keys := ownerTags()
+		for i := range services {
+			services[i].SetOwner(keys)
+		}
+		return htmlreport.Write(cmd.OutOrStdout(), htmlreport.Report{
+			Title:    reportTitle,
+			Snapshot: snap,
+			Services: services,
+			GroupBy:  GroupBy,
+		})
+	},
+}
+
+func init() {
+	reportCmd.Flags().StringVar(&reportTitle, "title", "", "page title (default names the snapshot)")
+}
@@ -0,0 +1,246 @@
+package discoverycmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/cache"
+	"github.com/jamesneb/causal/discovery/config"
+	"github.com/jamesneb/causal/discovery/output"
+)
+
+// Timeout bounds the whole run; zero means no limit.
+var Timeout time.Duration
+
+// RequestTimeout bounds each attempt of a cloud API call.
+var RequestTimeout time.Duration
+
+// MaxAttempts is the number of attempts made for each cloud API call.
+var MaxAttempts int
+
+// RateLimit caps cloud API requests per second per account.
+var RateLimit float64
+
+// ParallelRegions is the number of regions scanned concurrently.
+var ParallelRegions int
+
+// ParallelAccounts caps the number of accounts scanned concurrently.
+var ParallelAccounts int
+
+// RetryAccounts tries accounts that could not be accessed again at the end
+// of a run.
+var RetryAccounts bool
+
+// Workers is the number of concurrent detail requests per cataloger.
+var Workers int
+
+// Ordered keeps results in listing order.
+var Ordered bool
+
+// NoCache bypasses the result cache.
+var NoCache bool
+
+// CacheTTL overrides how long cached results are used.
+var CacheTTL time.Duration
+
+// OutputFormat selects the result renderer; empty means the configured default.
+var OutputFormat string
+
+// Query is a JMESPath expression applied to the JSON results.
+var Query string
+
+// FormatTemplate is a Go template rendered once per result.
+var FormatTemplate string
+
+// Columns selects the table or CSV columns.
+var Columns []string
+
+// Tags are the tag keys exported as their own CSV columns.
+var Tags []string
+
+// GroupBy is the column results are counted by instead of listed.
+var GroupBy string
+
+// SortBy is the column results, or with GroupBy groups, are sorted by.
+var SortBy string
+
+// OwnerTags are the tag keys tried, in order, for a service's owner.
+var OwnerTags []string
+
+// ConfigPath is the config file location; empty means config.DefaultPath.
+var ConfigPath string
+
+// Cfg is the loaded configuration, populated before any command runs.
+var Cfg = config.Default()
+
+var RootCmd = &cobra.Command{
+	Use:   "Discovery",
+	Short: "Service discovery CLI",
+	Long:  "Finds services inside cloud platforms",
+	// main reports returned errors and picks the exit code.
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Only the default file may be missing; one passed with --config
+		// must exist.
+		var err error
+		if ConfigPath != "" {
+			Cfg, err = config.Load(ConfigPath)
+		} else {
+			Cfg, err = config.LoadDefault()
+		}
+		return err
+	},
+}
+
+// Command groups shown in help output. A group is only listed once at least
+// one command belongs to it.
+const (
+	groupDiscovery = "discovery"
+	groupAuth      = "auth"
+	groupExport    = "export"
+	groupGraph     = "graph"
+)
+
+var commandGroups = []*cobra.Group{
+	{ID: groupDiscovery, Title: "Discovery Commands:"},
+	{ID: groupAuth, Title: "Authentication and Configuration Commands:"},
+	{ID: groupExport, Title: "Export Commands:"},
+	{ID: groupGraph, Title: "Graph Commands:"},
+}
+
+func init() {
+	RootCmd.AddCommand(listCmd, serveCmd, daemonCmd, lambdaCmd, snapshotCmd, graphCmd, reportCmd, backstageCmd, bomCmd, datadogCmd, pagerdutyCmd, grafanaCmd, neo4jCmd, terraformCmd, cloudformationCmd, exportCmd, codeCmd, runtimesCmd, concurrencyCmd, accessCmd, initCmd, pluginsCmd, schemaCmd)
+	for _, g := range commandGroups {
+		for _, c := range RootCmd.Commands() {
+			if c.GroupID == g.ID {
+				RootCmd.AddGroup(g)
+				break
+			}
+		}
+	}
+
+	RootCmd.PersistentFlags().DurationVar(&Timeout, "timeout", 0, "maximum duration of the whole run (e.g. 10m); 0 disables the limit")
+	RootCmd.PersistentFlags().DurationVar(&RequestTimeout, "request-timeout", 30*time.Second, "maximum duration of each attempt of a cloud API request; 0 disables the limit")
+	RootCmd.PersistentFlags().IntVar(&MaxAttempts, "max-attempts", 10, "attempts per cloud API request, including the first; throttled requests back off with jitter")
+	RootCmd.PersistentFlags().Float64Var(&RateLimit, "rate-limit", 0, "maximum cloud API requests per second per account, shared by all regions and resource types (default from config, else unlimited)")
+	RootCmd.PersistentFlags().IntVar(&ParallelRegions, "parallel-regions", 4, "regions scanned concurrently")
+	RootCmd.PersistentFlags().BoolVar(&RetryAccounts, "retry-accounts", false, "try the accounts whose role could not be assumed once more at the end of the run")
+	RootCmd.PersistentFlags().IntVar(&ParallelAccounts, "parallel-accounts", 0, "accounts of a multi-account run scanned concurrently (default from config, else as many as --parallel-regions allows)")
+	RootCmd.PersistentFlags().IntVar(&Workers, "workers", 8, "concurrent detail requests per cataloger")
+	RootCmd.PersistentFlags().BoolVar(&Ordered, "ordered", false, "emit resources in listing order instead of as soon as they are described")
+	RootCmd.PersistentFlags().BoolVar(&NoCache, "no-cache", false, "ignore cached results and do not record new ones")
+	RootCmd.PersistentFlags().DurationVar(&CacheTTL, "cache-ttl", 0, "how long cached results are reused (default from config, else 5m)")
+	RootCmd.PersistentFlags().StringVarP(&OutputFormat, "output", "o", "", "output format: "+strings.Join(output.Formats, ", ")+" (default from config, else table)")
+	RootCmd.PersistentFlags().StringVar(&Query, "query", "", "JMESPath expression applied to the JSON results, e.g. 'services[].name' (implies --output json)")
+	RootCmd.PersistentFlags().StringVar(&FormatTemplate, "format", "", "Go template rendered once per result, e.g. '{{.Name}} {{.Details.Lambda.Runtime}}'")
+	RootCmd.PersistentFlags().StringSliceVar(&Columns, "columns", nil, "table or CSV columns, comma separated (default "+strings.Join(output.DefaultColumns, ",")+"); available: "+strings.Join(discovery.ServiceColumns, ",")+", tag:<key>")
+	RootCmd.PersistentFlags().StringSliceVar(&Tags, "tags", nil, "tag keys exported as their own CSV columns, comma separated; when set, other tags are left out")
+	RootCmd.PersistentFlags().StringVar(&GroupBy, "group-by", "", "count results per value of a column, e.g. owner, instead of listing them")
+	RootCmd.PersistentFlags().StringVar(&SortBy, "sort-by", "", "sort results by a column, numbers such as cost largest first; with --group-by, only cost")
+	RootCmd.PersistentFlags().StringSliceVar(&OwnerTags, "owner-tags", nil, "tag keys tried in order for a service's owner (default from config, else "+strings.Join(discovery.DefaultOwnerTags, ",")+")")
+	RootCmd.PersistentFlags().StringVar(&ConfigPath, "config", "", "config file (default is $XDG_CONFIG_HOME/discovery/config.yaml)")
+}
+
+// newOutputWriter builds the result writer selected by flags and config.
+func newOutputWriter(cmd *cobra.Command) (output.Writer, error) {
+	format := OutputFormat
+	if format == "" {
+		format = Cfg.Output.Format
+	}
+
+	columns := Columns
+	if len(columns) == 0 {
+		columns = Cfg.Output.Columns
+	}
+	if len(Columns) > 0 && format != "" && format != "table" && format != "csv" {
+		return nil, fmt.Errorf("--columns only applies to table and CSV output, not %q", format)
+	}
+	for _, c := range columns {
+		if !slices.Contains(discovery.ServiceColumns, c) && !strings.HasPrefix(c, discovery.TagColumnPrefix) {
+			return nil, fmt.Errorf("unknown column %q (available: %s, tag:<key>)", c, strings.Join(discovery.ServiceColumns, ", "))
+		}
+	}
+	tags := Tags
+	if len(tags) == 0 {
+		tags = Cfg.Output.Tags
+	}
+	if len(Tags) > 0 && format != "csv" {
+		return nil, errors.New("--tags only applies to CSV output; use --columns tag:<key> for tables")
+	}
+	if GroupBy != "" && !slices.Contains(discovery.ServiceColumns, GroupBy) && !strings.HasPrefix(GroupBy, discovery.TagColumnPrefix) {
+		return nil, fmt.Errorf("unknown --group-by column %q (available: %s, tag:<key>)", GroupBy, strings.Join(discovery.ServiceColumns, ", "))
+	}
+	if SortBy != "" && !slices.Contains(discovery.ServiceColumns, SortBy) && !strings.HasPrefix(SortBy, discovery.TagColumnPrefix) {
+		return nil, fmt.Errorf("unknown --sort-by column %q (available: %s, tag:<key>)", SortBy, strings.Join(discovery.ServiceColumns, ", "))
+	}
+
+	return output.New(format, cmd.OutOrStdout(), output.Options{
+		Query:    Query,
+		Template: FormatTemplate,
+		Columns:  columns,
+		Tags:     tags,
+		GroupBy:  GroupBy,
+		SortBy:   SortBy,
+	})
+}
+
+// ownerTags returns the tag keys tried for a service's owner, from flags
+// and config.
+func ownerTags() []string {
+	if len(OwnerTags) > 0 {
+		return OwnerTags
+	}
+	if len(Cfg.Output.OwnerTags) > 0 {
+		return Cfg.Output.OwnerTags
+	}
+	return discovery.DefaultOwnerTags
+}
+
+// withOwners sets the owner of every service discovered before passing it
+// on to h, so outputs, sinks and snapshots all record it.
+func withOwners(h discovery.ResultHandler) discovery.ResultHandler {
+	keys := ownerTags()
+	return discovery.ResultHandlerFunc(func(ctx context.Context, r discovery.Result) error {
+		if r.Err == nil {
+			r.Service.SetOwner(keys)
+		}
+		return h.HandleResult(ctx, r)
+	})
+}
+
+// cacheStore returns the configured result cache, or nil if caching is
+// disabled.
+func cacheStore() (*cache.Store, error) {
+	if NoCache || Cfg.Cache.Disabled {
+		return nil, nil
+	}
+	store := &cache.Store{Dir: Cfg.Cache.Dir, TTL: Cfg.Cache.TTL, TTLs: Cfg.Cache.TTLs}
+	if CacheTTL > 0 {
+		store.TTL = CacheTTL
+	}
+	if store.TTL <= 0 {
+		store.TTL = cache.DefaultTTL
+	}
+	if store.Dir == "" {
+		dir, err := cache.DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+		store.Dir = dir
+	}
+	return store, nil
+}
+
+func resolveConfigPath() (string, error) {
+	if ConfigPath != "" {
+		return ConfigPath, nil
+	}
+	return config.DefaultPath()
+}
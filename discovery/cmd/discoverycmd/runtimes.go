@@ -0,0 +1,103 @@
+package discoverycmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/runtimes"
+)
+
+var (
+	runtimesWithin           time.Duration
+	runtimesFile             string
+	runtimesAll              bool
+	runtimesFailOnDeprecated bool
+)
+
+var runtimesCmd = &cobra.Command{
+	Use:     "runtimes [snapshot]",
+	GroupID: groupDiscovery,
+	Short:   "Report functions on deprecated or soon deprecated runtimes",
+	Long: `Report the Lambda functions in a snapshot (default "latest") whose runtime is
+deprecated, or is deprecated within --within (default 180 days), from a
+built-in table of the deprecation dates AWS publishes. --runtimes-file adds
+to or corrects the table from a YAML file of the same form:
+
+  python3.9: {deprecated: 2025-12-15}
+  nodejs18.x: {deprecated: 2025-09-01}
+
+--all lists every function, including those on supported runtimes and on
+runtimes the table does not know. --fail-on-deprecated exits with status 1
+when any function is on a deprecated runtime, for CI. -o json or yaml prints
+the report as a document.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		table := runtimes.Default()
+		if runtimesFile != "" {
+			if err := table.Load(runtimesFile); err != nil {
+				return err
+			}
+		}
+		services, err := snapshotServices(id)
+		if err != nil {
+			return err
+		}
+		var findings []runtimes.Finding
+		deprecated := 0
+		for _, f := range table.Check(services, time.Now(), runtimesWithin) {
+			if f.Status == runtimes.Deprecated {
+				deprecated++
+			}
+			if runtimesAll || f.Status == runtimes.Deprecated || f.Status == runtimes.Deprecating {
+				findings = append(findings, f)
+			}
+		}
+		if findings == nil {
+			findings = []runtimes.Finding{}
+		}
+
+		switch strings.ToLower(OutputFormat) {
+		case "", "table":
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tREGION\tRUNTIME\tSTATUS\tDEPRECATED\tDAYS")
+			for _, f := range findings {
+				date, days := "-", "-"
+				if f.Deprecated != nil {
+					date, days = f.Deprecated.Format(time.DateOnly), fmt.Sprint(f.Days)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Service.Name, f.Service.Region, f.Runtime, f.Status, date, days)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		case "json", "yaml", "yml":
+			if err := writeDocument(cmd, findings); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown runtimes format %q (supported: table, json, yaml)", OutputFormat)
+		}
+		fmt.Fprintf(os.Stderr, "%d functions on deprecated runtimes\n", deprecated)
+		if runtimesFailOnDeprecated && deprecated > 0 {
+			return &ExitError{Code: ExitFailure, Err: fmt.Errorf("%d functions are on deprecated runtimes", deprecated)}
+		}
+		return nil
+	},
+}
+
+func init() {
+	runtimesCmd.Flags().DurationVar(&runtimesWithin, "within", 180*24*time.Hour, "also report runtimes deprecated within this long")
+	runtimesCmd.Flags().StringVar(&runtimesFile, "runtimes-file", "", "YAML file of runtime deprecation dates adding to or overriding the built-in table")
+	runtimesCmd.Flags().BoolVar(&runtimesAll, "all", false, "list every function, not only those on deprecated or soon deprecated runtimes")
+	runtimesCmd.Flags().BoolVar(&runtimesFailOnDeprecated, "fail-on-deprecated", false, "exit with status 1 when any function is on a deprecated runtime")
+}
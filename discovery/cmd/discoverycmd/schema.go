@@ -0,0 +1,21 @@
+package discoverycmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/output"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:     "schema",
+	GroupID: groupExport,
+	Short:   "Print the JSON Schema of the JSON output",
+	Long: `Print the JSON Schema that "list -o json" documents follow. Each document
+records the schema version it was written with in "schemaVersion"; fields are
+only added within a major version.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := cmd.OutOrStdout().Write(output.Schema)
+		return err
+	},
+}
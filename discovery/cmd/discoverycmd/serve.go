@@ -0,0 +1,326 @@
+package discoverycmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/hooks"
+	"github.com/jamesneb/causal/discovery/identity"
+	"github.com/jamesneb/causal/discovery/metrics"
+	"github.com/jamesneb/causal/discovery/webui"
+)
+
+var (
+	serveListen     string
+	serveInterval   time.Duration
+	serveTokenFile  string
+	serveGRPCListen string
+)
+
+var serveCmd = &cobra.Command{
+	Use:     "serve [region] [roleArn]",
+	GroupID: groupDiscovery,
+	Short:   "Run discovery on a schedule and expose Prometheus metrics",
+	Long: `Run discovery every --interval and serve Prometheus metrics on /metrics and a
+liveness probe on /healthz, and the time of the next run and the report of
+the last on /status. Each run is recorded as a snapshot, and the newest
+snapshot is served as JSON under /api/v1: /api/v1/services, searched with
+q and filtered by type, region and account, /api/v1/services/<key>,
+/api/v1/graph and /api/v1/snapshot, and to GraphQL queries, such as of
+services' dependencies and their owners in one request, on POST
+/api/v1/graphql. --grpc-listen also serves it over gRPC,
+as the Catalog service of proto/discovery/v1/catalog.proto, which streams
+the changes of every new snapshot too. A web interface to browse it, with a
+searchable service table, a page per service and an interactive dependency
+graph, is served on /ui/, which / redirects to.
+
+The web identity token is read from --token-file before every run (default
+$AWS_WEB_IDENTITY_TOKEN_FILE). Without one the Auth0 device flow is used on
+the first run, and its token is reused and renewed with its refresh token on
+the later ones.`,
+	Args:         cobra.RangeArgs(0, 2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if serveInterval <= 0 {
+			return errors.New("--interval must be positive")
+		}
+		next := func(last time.Time) time.Time { return last.Add(serveInterval) }
+		return runScheduled(cmd, args, next, true, fmt.Sprintf("discovering every %s", serveInterval))
+	},
+}
+
+// runScheduled runs discovery of the regions and role in args, or else the
+// config, whenever next says, first at once if runFirst is set, and serves
+// metrics, a liveness probe, the status of the last run and the catalog API
+// over the newest snapshot until the command is interrupted. next returns
+// the time of the run following one started at the time given; runs that are
+// due while another is going start as soon as it finishes. describe says
+// when runs happen, for the log.
+func runScheduled(cmd *cobra.Command, args []string, next func(time.Time) time.Time, runFirst bool, describe string) error {
+	requested := Cfg.AWS.Regions
+	if len(args) > 0 {
+		requested = []string{args[0]}
+	}
+	roleARN := Cfg.AWS.RoleARN
+	if len(args) > 1 {
+		roleARN = args[1]
+	}
+	regions, err := resolveTarget(requested, roleARN)
+	if err != nil {
+		return err
+	}
+	if serveTokenFile == "" {
+		if err := Cfg.Identity.Validate(); err != nil {
+			return err
+		}
+	}
+	hookRunner, err := newHooks()
+	if err != nil {
+		return err
+	}
+	if err := checkSinks(); err != nil {
+		return err
+	}
+	applyRunSettings()
+
+	m := metrics.New()
+	var calls atomic.Pointer[discovery.APIStats]
+	awscmd.APIObserver = func(c awscmd.APICall) {
+		m.APICall(c.Service, c.Operation, c.Duration, c.Err, c.Throttled)
+		if s := calls.Load(); s != nil {
+			s.Record(c.Service, c.Operation, c.Err, c.Throttled)
+		}
+	}
+	status := &scheduleStatus{}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.Handle("/status", status)
+	api := &catalogAPI{}
+	api.refresh()
+	api.register(mux)
+	mux.Handle("GET /ui/", http.StripPrefix("/ui", webui.Handler()))
+	mux.Handle("GET /{$}", http.RedirectHandler("/ui/", http.StatusFound))
+	grpcErr := make(chan error, 1)
+	if serveGRPCListen != "" {
+		stop, err := startGRPC(serveGRPCListen, api, grpcErr)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		fmt.Fprintf(os.Stderr, "Serving the catalog over gRPC on %s\n", serveGRPCListen)
+	}
+	srv := &http.Server{Addr: serveListen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	fmt.Fprintf(os.Stderr, "Serving metrics on %s/metrics, %s\n", serveListen, describe)
+
+	ctx := cmd.Context()
+	due := time.Now()
+	if !runFirst {
+		due = next(due)
+	}
+	for {
+		status.scheduled(due)
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-timer.C:
+		case err := <-serveErr:
+			timer.Stop()
+			return fmt.Errorf("serving metrics: %w", err)
+		case err := <-grpcErr:
+			timer.Stop()
+			return err
+		case <-ctx.Done():
+			timer.Stop()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return srv.Shutdown(shutdownCtx)
+		}
+		started := time.Now()
+		due = next(started)
+		status.started(started)
+		stats := discovery.NewAPIStats()
+		calls.Store(stats)
+		status.finished(serveRun(ctx, m, hookRunner, stats, serveToken, roleARN, regions))
+		api.refresh()
+	}
+}
+
+// scheduleStatus is what /status reports about the runs of a schedule. It
+// is safe for concurrent use.
+type scheduleStatus struct {
+	mu      sync.Mutex
+	running *time.Time
+	next    time.Time
+	last    *discovery.RunReport
+}
+
+func (s *scheduleStatus) scheduled(next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next = next
+}
+
+func (s *scheduleStatus) started(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = &t
+}
+
+func (s *scheduleStatus) finished(report *discovery.RunReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running, s.last = nil, report
+}
+
+// ServeHTTP writes the time of the next run, when the current one started
+// if one is going, and the report of the last one to finish.
+func (s *scheduleStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc := struct {
+		Running *time.Time           `json:"runningSince,omitempty"`
+		Next    time.Time            `json:"nextRun"`
+		Status  string               `json:"lastStatus,omitempty"`
+		Last    *discovery.RunReport `json:"lastRun,omitempty"`
+	}{Running: s.running, Next: s.next.UTC(), Last: s.last}
+	if s.last != nil {
+		doc.Status = s.last.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", ":9090", "address to serve metrics, status, the catalog API and the web interface on")
+	serveCmd.Flags().DurationVar(&serveInterval, "interval", time.Hour, "time between discovery runs")
+	serveCmd.Flags().StringVar(&ManifestPath, "manifest", "", "write the manifest of each run to this file")
+	serveCmd.Flags().StringVar(&serveTokenFile, "token-file", os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), "file holding the web identity token")
+	serveCmd.Flags().StringVar(&serveGRPCListen, "grpc-listen", "", "address to serve the catalog over gRPC on, e.g. :9091 (default none)")
+}
+
+// serveRun performs one scheduled discovery run, with the credentials of
+// token as for newProviders, and returns its report. Failures are reported
+// on stderr and in the metrics; the schedule carries on.
+func serveRun(ctx context.Context, m *metrics.Metrics, hookRunner *hooks.Runner, calls *discovery.APIStats, token func(context.Context) (string, error), roleARN string, regions []string) *discovery.RunReport {
+	if Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, Timeout)
+		defer cancel()
+	}
+	report := discovery.NewRunReport()
+	defer func() {
+		m.RunFinished(report)
+		report.Print(os.Stderr)
+	}()
+
+	store, err := cacheStore()
+	if err != nil {
+		report.Finish(err)
+		return report
+	}
+	providers, err := newProviders(ctx, roleARN, regions, token, store)
+	if err != nil {
+		report.Finish(err)
+		return report
+	}
+	fmt.Fprintf(os.Stderr, "Discovering services in %s with role %s\n", strings.Join(regions, ", "), roleARN)
+	opts := discovery.Options{
+		Providers:          providers,
+		Regions:            regions,
+		Parallelism:        ParallelRegions,
+		AccountParallelism: parallelAccounts(),
+		RetryAccounts:      RetryAccounts || Cfg.AWS.RetryAccounts,
+	}
+	manifest := func() *discovery.Manifest {
+		return discovery.NewManifest(report, runIdentity(roleARN), opts, calls)
+	}
+	opts.ProviderDone = func(p discovery.Provider) {
+		runHooks(ctx, hookRunner, hooks.ProviderDone, p.Name(), manifest)
+	}
+	if err := runHooks(ctx, hookRunner, hooks.BeforeRun, "", manifest); err != nil {
+		report.Finish(fmt.Errorf("not starting discovery: %w", err))
+		return report
+	}
+	handlers := []discovery.ResultHandler{report, m}
+	sinks, err := newSinks(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not writing to sinks: %v\n", err)
+	}
+	if sinks != nil {
+		handlers = append(handlers, sinks)
+	}
+	recorder, closeSnapshots := startSnapshot(regions)
+	defer closeSnapshots()
+	if recorder != nil {
+		handlers = append(handlers, recorder)
+	}
+	report.Finish(discovery.Run(ctx, opts, withStackSets(withOwners(discovery.MultiHandler(handlers...)), nil, nil, false, false)))
+	finishSinks(ctx, sinks, report)
+	commitSnapshot(recorder, report)
+	final := manifest()
+	writeManifest(final)
+	runHooks(context.WithoutCancel(ctx), hookRunner, hooks.AfterRun, "", func() *discovery.Manifest { return final })
+	return report
+}
+
+// tokenMargin is how long a token of the Auth0 login must still be valid
+// for a run to use it rather than renew it, so it outlasts the run's role
+// assumptions.
+const tokenMargin = 15 * time.Minute
+
+// serveLogin is the Auth0 login of runs without a token file, kept between
+// runs so only the first of them waits for the user.
+var serveLogin struct {
+	mu     sync.Mutex
+	config *identity.Auth0Config
+}
+
+// serveToken reads the web identity token file or, when none is configured,
+// returns the token of the Auth0 login. The token is reused until it is
+// about to expire and then renewed with its refresh token; only the first
+// run, and runs whose login cannot be renewed, log in interactively.
+func serveToken(ctx context.Context) (string, error) {
+	if serveTokenFile == "" {
+		serveLogin.mu.Lock()
+		defer serveLogin.mu.Unlock()
+		if c := serveLogin.config; c != nil {
+			if c.Token.Expiry.IsZero() || time.Until(c.Token.Expiry) > tokenMargin {
+				return c.Token.AccessToken, nil
+			}
+			err := c.Refresh(ctx)
+			if err == nil {
+				return c.Token.AccessToken, nil
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %v; logging in again\n", err)
+		}
+		c, err := login(ctx)
+		if err != nil {
+			return "", err
+		}
+		serveLogin.config = c
+		return c.Token.AccessToken, nil
+	}
+	data, err := os.ReadFile(serveTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading token file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
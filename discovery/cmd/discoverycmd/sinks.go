@@ -0,0 +1,218 @@
+package discoverycmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/notify"
+	"github.com/jamesneb/causal/discovery/sink"
+)
+
+// checkSinks validates the configured sinks and notifications without
+// connecting to them.
+func checkSinks() error {
+	if Cfg.Sinks.DynamoDB != nil {
+		if err := dynamoDBOptions().Validate(); err != nil {
+			return err
+		}
+	}
+	if Cfg.Sinks.S3 != nil {
+		if err := s3Options().Validate(); err != nil {
+			return err
+		}
+	}
+	if c := Cfg.Sinks.Postgres; c != nil && c.URL == "" {
+		return errors.New("postgres sink needs a url")
+	}
+	if Cfg.Sinks.Webhook != nil {
+		if err := webhookOptions().Validate(); err != nil {
+			return err
+		}
+	}
+	if Cfg.Sinks.Kafka != nil {
+		if err := kafkaOptions().Validate(); err != nil {
+			return err
+		}
+	}
+	return notifyOptions().Validate()
+}
+
+// newSinks connects to the configured sinks and sets up notifications,
+// which receive a run the same way. It returns nil when there are none.
+func newSinks(ctx context.Context) (*sink.Set, error) {
+	if err := checkSinks(); err != nil {
+		return nil, err
+	}
+	var sinks []sink.Sink
+	if c := Cfg.Sinks.DynamoDB; c != nil {
+		cfg, err := awscmd.LoadConfig(ctx, c.Region)
+		if err != nil {
+			return nil, err
+		}
+		d, err := sink.NewDynamoDB(dynamodb.NewFromConfig(cfg), dynamoDBOptions())
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, d)
+	}
+	if c := Cfg.Sinks.S3; c != nil {
+		cfg, err := awscmd.LoadConfig(ctx, c.Region)
+		if err != nil {
+			return nil, err
+		}
+		s, err := sink.NewS3(s3.NewFromConfig(cfg), s3Options())
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if c := Cfg.Sinks.Postgres; c != nil {
+		p, err := sink.NewPostgres(ctx, os.ExpandEnv(c.URL))
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, p)
+	}
+	if Cfg.Sinks.Webhook != nil {
+		w, err := sink.NewWebhook(webhookOptions())
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, w)
+	}
+	if c := Cfg.Sinks.Kafka; c != nil {
+		w, err := sink.NewKafkaWriter(kafkaOptions())
+		if err != nil {
+			return nil, err
+		}
+		var changes *sink.Changes
+		if c.ChangeEvents {
+			changes = changeBaseline("kafka sink")
+		}
+		sinks = append(sinks, sink.NewKafka(w, changes))
+	}
+	if c := Cfg.Sinks.EventBridge; c != nil {
+		if changes := changeBaseline("eventbridge sink"); changes != nil {
+			cfg, err := awscmd.LoadConfig(ctx, c.Region)
+			if err != nil {
+				return nil, err
+			}
+			opts := sink.EventBridgeOptions{Bus: c.Bus, Source: c.Source}
+			sinks = append(sinks, sink.NewEventBridge(eventbridge.NewFromConfig(cfg), opts, changes))
+		}
+	}
+	if opts := notifyOptions(); len(opts.Webhooks) > 0 {
+		opts.Changes = changeBaseline("notifications")
+		n, err := notify.New(opts)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, n)
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return sink.NewSet(os.Stderr, sinks...), nil
+}
+
+func dynamoDBOptions() sink.DynamoDBOptions {
+	c := Cfg.Sinks.DynamoDB
+	return sink.DynamoDBOptions{
+		Table:        c.Table,
+		PartitionKey: sink.Key{Attribute: c.PartitionKey.Attribute, Column: c.PartitionKey.Column},
+		SortKey:      sink.Key{Attribute: c.SortKey.Attribute, Column: c.SortKey.Column},
+		TTLAttribute: c.TTLAttribute,
+		TTL:          c.TTL,
+	}
+}
+
+func s3Options() sink.S3Options {
+	c := Cfg.Sinks.S3
+	return sink.S3Options{Bucket: c.Bucket, Prefix: c.Prefix, Format: c.Format}
+}
+
+func webhookOptions() sink.WebhookOptions {
+	c := Cfg.Sinks.Webhook
+	return sink.WebhookOptions{
+		URL:     c.URL,
+		Secret:  os.ExpandEnv(c.Secret),
+		Mode:    c.Mode,
+		Headers: c.Headers,
+		Timeout: c.Timeout,
+		Retries: c.Retries,
+	}
+}
+
+func kafkaOptions() sink.KafkaOptions {
+	c := Cfg.Sinks.Kafka
+	opts := sink.KafkaOptions{Brokers: c.Brokers, Topic: c.Topic, ClientID: c.ClientID}
+	if t := c.TLS; t != nil {
+		opts.TLS = &sink.KafkaTLS{CAFile: t.CAFile, CertFile: t.CertFile, KeyFile: t.KeyFile, InsecureSkipVerify: t.InsecureSkipVerify}
+	}
+	if s := c.SASL; s != nil {
+		opts.SASL = &sink.KafkaSASL{Mechanism: s.Mechanism, Username: s.Username, Password: os.ExpandEnv(s.Password)}
+	}
+	return opts
+}
+
+func notifyOptions() notify.Options {
+	c := Cfg.Notifications
+	opts := notify.Options{MaxNotable: c.MaxNotable}
+	if c.Slack != nil {
+		opts.Webhooks = append(opts.Webhooks, notify.Webhook{Kind: notify.Slack, URL: os.ExpandEnv(c.Slack.WebhookURL)})
+	}
+	if c.Teams != nil {
+		opts.Webhooks = append(opts.Webhooks, notify.Webhook{Kind: notify.Teams, URL: os.ExpandEnv(c.Teams.WebhookURL)})
+	}
+	return opts
+}
+
+// changeBaseline loads the services of the newest complete snapshot for
+// what to compare a run with. Without one, user (e.g. "kafka sink") reports
+// no changes, rather than every service as added.
+func changeBaseline(user string) *sink.Changes {
+	id, services, err := latestComplete()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s: not reporting changes: %v\n", user, err)
+		return nil
+	}
+	return sink.NewChanges(id, services)
+}
+
+func latestComplete() (string, []discovery.Service, error) {
+	if NoSnapshot || Cfg.Snapshots.Disabled {
+		return "", nil, errors.New("snapshots are disabled")
+	}
+	store, err := openSnapshots()
+	if err != nil {
+		return "", nil, err
+	}
+	defer store.Close()
+	snaps, err := store.List()
+	if err != nil {
+		return "", nil, err
+	}
+	for _, s := range snaps {
+		if s.Complete() {
+			services, err := store.LoadServices(s.ID)
+			return s.ID, services, err
+		}
+	}
+	return "", nil, errors.New("no complete snapshot to compare with")
+}
+
+// finishSinks finishes s, if any, after the run described by report. It runs
+// even when the run was interrupted, so what was discovered is kept.
+func finishSinks(ctx context.Context, s *sink.Set, report *discovery.RunReport) {
+	if s != nil {
+		s.Finish(context.WithoutCancel(ctx), report)
+	}
+}
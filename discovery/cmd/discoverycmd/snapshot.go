@@ -0,0 +1,384 @@
+package discoverycmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/output"
+	"github.com/jamesneb/causal/discovery/snapshot"
+)
+
+// NoSnapshot skips recording the run in the snapshot database.
+var NoSnapshot bool
+
+var (
+	pruneKeep      int
+	pruneOlderThan time.Duration
+	diffCode       bool
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:     "snapshot",
+	Aliases: []string{"snapshots"},
+	GroupID: groupDiscovery,
+	Short:   "List, inspect, prune and compare recorded discovery runs",
+	Long: `Every "discovery list" run is recorded as a timestamped snapshot in a local
+database. Snapshot IDs are shown by "snapshot list"; "latest" names the newest.`,
+	SilenceUsage: true,
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List recorded snapshots, newest first",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		snaps, err := store.List()
+		if err != nil {
+			return err
+		}
+		if isDocumentFormat(OutputFormat) {
+			return writeDocument(cmd, snaps)
+		}
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tFINISHED\tSERVICES\tREGIONS\tSTATUS")
+		for _, s := range snaps {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", s.ID, s.Finished.Local().Format(time.DateTime), s.Services, strings.Join(s.Regions, ","), snapshotStatus(s))
+		}
+		return tw.Flush()
+	},
+}
+
+var snapshotShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Print the services recorded in a snapshot",
+	Long: `Print the services recorded in a snapshot using the same output flags as
+"discovery list" (--output, --columns, --query, --format).`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		snap, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+		out, err := newOutputWriter(cmd)
+		if err != nil {
+			return err
+		}
+		keys := ownerTags()
+		err = store.Services(snap.ID, func(s discovery.Service) error {
+			s.SetOwner(keys)
+			return out.Write(s)
+		})
+		if err != nil {
+			return err
+		}
+		if s, ok := out.(output.Summarizer); ok && snap.Report != nil {
+			s.Summary(snap.Report)
+		}
+		return out.Close()
+	},
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:   "diff <from> [to]",
+	Short: "Show services added, removed or changed between two snapshots",
+	Long: `Show services added, removed or changed between two snapshots. The second
+snapshot defaults to "latest". Services are matched by ARN.
+
+Functions whose code was deployed again in between are shown with their
+package checksum (CodeSha256) and size, or image digest, before and after.
+--code shows only those functions.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to := "latest"
+		if len(args) > 1 {
+			to = args[1]
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		d, err := store.Compare(args[0], to)
+		if err != nil {
+			return err
+		}
+		if diffCode {
+			var changed []snapshot.Change
+			for _, c := range d.Changed {
+				if c.Code != nil {
+					changed = append(changed, c)
+				}
+			}
+			d.Added, d.Removed, d.Changed = nil, nil, changed
+		}
+		if isDocumentFormat(OutputFormat) {
+			return writeDocument(cmd, d)
+		}
+		if d.Incomplete {
+			fmt.Fprintln(os.Stderr, "Warning: comparing against an incomplete snapshot; added and removed services may only reflect what was scanned")
+		}
+		w := cmd.OutOrStdout()
+		fmt.Fprintf(w, "Comparing %s to %s\n", d.From, d.To)
+		if d.Empty() {
+			fmt.Fprintln(w, "No changes")
+			return nil
+		}
+		for _, s := range d.Added {
+			fmt.Fprintf(w, "+ %s\n", snapshot.Key(s))
+		}
+		for _, s := range d.Removed {
+			fmt.Fprintf(w, "- %s\n", snapshot.Key(s))
+		}
+		for _, c := range d.Changed {
+			fmt.Fprintf(w, "~ %s (%s)\n", snapshot.Key(c.After), strings.Join(c.Fields, ", "))
+			if c.Code != nil {
+				fmt.Fprintf(w, "    code %s -> %s", codeVersion(c.Code.Before), codeVersion(c.Code.After))
+				if t := c.Code.After.LastModified; t != nil {
+					fmt.Fprintf(w, ", deployed %s", t.UTC().Format(time.RFC3339))
+				}
+				fmt.Fprintln(w)
+			}
+		}
+		fmt.Fprintf(w, "%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+		return nil
+	},
+}
+
+// codeVersion describes c for snapshot diff: the image digest, or the
+// package checksum and size.
+func codeVersion(c snapshot.Code) string {
+	if c.Image != "" {
+		if _, digest, ok := strings.Cut(c.Image, "@"); ok {
+			return digest
+		}
+		return c.Image
+	}
+	return fmt.Sprintf("%s (%d bytes)", c.SHA256, c.Size)
+}
+
+var snapshotPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old snapshots",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pruneKeep <= 0 && pruneOlderThan <= 0 {
+			return fmt.Errorf("pass --keep or --older-than")
+		}
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		deleted, err := store.Prune(pruneKeep, pruneOlderThan)
+		for _, id := range deleted {
+			fmt.Fprintf(cmd.OutOrStdout(), "Deleted %s\n", id)
+		}
+		return err
+	},
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:     "delete <id>...",
+	Aliases: []string{"rm"},
+	Short:   "Delete snapshots by ID",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		for _, id := range args {
+			if err := store.Delete(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var exportFormat string
+
+var snapshotExportCmd = &cobra.Command{
+	Use:   "export <id> <file>",
+	Short: "Write a snapshot's services to a Parquet file or Excel workbook",
+	Long: `Write the services recorded in a snapshot to a file.
+
+The parquet format writes one row per service, for querying with Athena,
+DuckDB and similar tools. Columns follow the JSON output, e.g.
+details.lambda.runtime.
+
+The xlsx format writes an Excel workbook: an overview sheet with the
+snapshot's details and service counts by resource type and by account and
+region, then a sheet per resource type with a column per tag key.
+
+The format defaults to xlsx for a file ending in .xlsx and to parquet
+otherwise. A file of "-" writes to stdout.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := exportFormat
+		if format == "" {
+			format = "parquet"
+			if strings.EqualFold(filepath.Ext(args[1]), ".xlsx") {
+				format = "xlsx"
+			}
+		}
+		var export func(*snapshot.Store, string, io.Writer) (int, error)
+		switch format {
+		case "parquet":
+			export = (*snapshot.Store).ExportParquet
+		case "xlsx":
+			export = (*snapshot.Store).ExportXLSX
+		default:
+			return fmt.Errorf("unknown export format %q (want parquet or xlsx)", format)
+		}
+
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		snap, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+		if args[1] == "-" {
+			_, err := export(store, snap.ID, cmd.OutOrStdout())
+			return err
+		}
+
+		// Write beside the destination and rename, so a failed export
+		// never leaves a truncated file behind.
+		path := args[1]
+		f, err := os.CreateTemp(filepath.Dir(path), ".export-*."+format)
+		if err != nil {
+			return fmt.Errorf("creating export file: %w", err)
+		}
+		defer os.Remove(f.Name())
+		n, err := export(store, snap.ID, f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(f.Name(), path); err != nil {
+			return fmt.Errorf("writing export file: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d services from snapshot %s to %s\n", n, snap.ID, path)
+		return nil
+	},
+}
+
+func init() {
+	snapshotCmd.AddCommand(snapshotListCmd, snapshotShowCmd, snapshotDiffCmd, snapshotExportCmd, snapshotPruneCmd, snapshotDeleteCmd)
+	snapshotExportCmd.Flags().StringVar(&exportFormat, "format", "", "file format: parquet or xlsx (default from the file extension)")
+	snapshotDiffCmd.Flags().BoolVar(&diffCode, "code", false, "only show functions whose code changed")
+	snapshotPruneCmd.Flags().IntVar(&pruneKeep, "keep", 0, "number of newest snapshots to keep")
+	snapshotPruneCmd.Flags().DurationVar(&pruneOlderThan, "older-than", 0, "delete snapshots older than this, e.g. 720h")
+}
+
+// openSnapshots opens the configured snapshot database.
+func openSnapshots() (*snapshot.Store, error) {
+	path := Cfg.Snapshots.Path
+	if path == "" {
+		var err error
+		if path, err = snapshot.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+	return snapshot.Open(path)
+}
+
+// startSnapshot opens the snapshot database and starts recording a run over
+// regions. Snapshots are best effort: when recording is disabled or the
+// database cannot be opened (e.g. another run holds it) the recorder is nil
+// and discovery carries on. The returned function closes the database.
+func startSnapshot(regions []string) (*snapshot.Recorder, func()) {
+	if NoSnapshot || Cfg.Snapshots.Disabled {
+		return nil, func() {}
+	}
+	store, err := openSnapshots()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not recording snapshot: %v\n", err)
+		return nil, func() {}
+	}
+	r, err := store.Record(regions)
+	if err != nil {
+		store.Close()
+		fmt.Fprintf(os.Stderr, "Warning: not recording snapshot: %v\n", err)
+		return nil, func() {}
+	}
+	return r, func() { store.Close() }
+}
+
+// commitSnapshot stores the run recorded by r, if any. Runs that were
+// cancelled or failed are stored too, marked with their status.
+func commitSnapshot(r *snapshot.Recorder, report *discovery.RunReport) {
+	if r == nil {
+		return
+	}
+	snap, err := r.Commit(report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not recording snapshot: %v\n", err)
+		return
+	}
+	if snap.Complete() {
+		fmt.Fprintf(os.Stderr, "Recorded snapshot %s\n", snap.ID)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Recorded %s snapshot %s (%d services)\n", snap.Status, snap.ID, snap.Services)
+}
+
+func snapshotStatus(s snapshot.Snapshot) string {
+	if s.Status == "" {
+		return "-"
+	}
+	return s.Status
+}
+
+// isDocumentFormat reports whether format asks for a structured document
+// rather than a table.
+func isDocumentFormat(format string) bool {
+	switch strings.ToLower(format) {
+	case "json", "yaml", "yml":
+		return true
+	}
+	return false
+}
+
+// writeDocument writes v as JSON or, with -o yaml, as YAML.
+func writeDocument(cmd *cobra.Command, v any) error {
+	if f := strings.ToLower(OutputFormat); f == "yaml" || f == "yml" {
+		return output.WriteYAML(cmd.OutOrStdout(), v)
+	}
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
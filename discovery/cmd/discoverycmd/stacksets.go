@@ -0,0 +1,61 @@
+package discoverycmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+)
+
+// StackSets looks up the administration account and permission model of
+// the stack sets that deployed resources, among those the role administers.
+var StackSets bool
+
+// withStackSets sets the stack set of every service discovered that one
+// deployed, from its tags, before passing it on to h. With lookup, the
+// stack sets provider administers in regions are listed once, with the
+// first such service, to fill in their administration account and
+// permission model; delegated includes those it administers for its
+// organization. If listing fails, stack sets are left with their names and
+// a warning is printed.
+func withStackSets(h discovery.ResultHandler, provider *awscmd.Provider, regions []string, lookup, delegated bool) discovery.ResultHandler {
+	var once sync.Once
+	instances := map[string]discovery.StackSet{}
+	load := func(ctx context.Context) {
+		var errs []error
+		for _, region := range regions {
+			found, err := provider.StackSetInstances(ctx, region, delegated)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for id, set := range found {
+				instances[id] = set
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: reading stack sets: %v\n", err)
+		}
+	}
+	return discovery.ResultHandlerFunc(func(ctx context.Context, r discovery.Result) error {
+		if r.Err == nil {
+			s := &r.Service
+			s.SetStackSet()
+			if s.StackSet != nil && lookup {
+				once.Do(func() { load(ctx) })
+				if set, ok := instances[s.Tags[discovery.StackIDTag]]; ok {
+					s.StackSet = &set
+				}
+			}
+		}
+		return h.HandleResult(ctx, r)
+	})
+}
+
+func init() {
+	listCmd.Flags().BoolVar(&StackSets, "stack-sets", false, "look up the administration account of the stack sets that deployed resources, among those the role administers")
+}
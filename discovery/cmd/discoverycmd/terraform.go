@@ -0,0 +1,162 @@
+package discoverycmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery/terraform"
+)
+
+var terraformImportOpts terraform.ImportOptions
+
+var terraformCmd = &cobra.Command{
+	Use:          "terraform",
+	Aliases:      []string{"tf"},
+	GroupID:      groupExport,
+	Short:        "Bring discovered resources under Terraform management and find drift",
+	SilenceUsage: true,
+}
+
+var terraformImportsCmd = &cobra.Command{
+	Use:   "imports [snapshot]",
+	Short: "Write Terraform import blocks for the resources in a snapshot",
+	Long: `Write a Terraform import block for every resource in a snapshot (default
+"latest") that Terraform can import, then let Terraform write their
+configuration:
+
+  discovery terraform imports > imports.tf
+  terraform plan -generate-config-out=generated.tf
+
+-o commands writes "terraform import" commands instead, for Terraform
+versions before 1.5.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := strings.ToLower(OutputFormat)
+		if format != "" && format != "hcl" && format != "commands" {
+			return fmt.Errorf("unknown import format %q (supported: hcl, commands)", OutputFormat)
+		}
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		g, err := snapshotGraph(id)
+		if err != nil {
+			return err
+		}
+
+		imports, unsupported := terraform.Imports(g, terraformImportOpts)
+		for t, n := range unsupported {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %d %s resources, which have no Terraform resource type\n", n, t)
+		}
+		if format == "commands" {
+			return terraform.WriteCommands(cmd.OutOrStdout(), imports)
+		}
+		return terraform.WriteHCL(cmd.OutOrStdout(), imports)
+	},
+}
+
+var (
+	driftStates []string
+	driftPulls  []string
+)
+
+var terraformDriftCmd = &cobra.Command{
+	Use:   "drift [snapshot]",
+	Short: "Compare Terraform state with a snapshot",
+	Long: `Compare Terraform state with a snapshot (default "latest") and report:
+
+  + discovered resources that no state manages
+  - managed resources that were not discovered in the snapshot's regions
+  ~ Lambda functions whose attributes differ from state
+
+--state reads a state file, "-" for standard input, or an http(s) URL.
+--pull runs "terraform state pull" in a configuration directory, so any
+remote backend works. Both can be repeated to compare several states.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(driftStates) == 0 && len(driftPulls) == 0 {
+			return errors.New("pass --state or --pull")
+		}
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		var resources []terraform.Resource
+		for _, src := range driftStates {
+			rs, err := terraform.LoadState(cmd.Context(), src)
+			if err != nil {
+				return err
+			}
+			resources = append(resources, rs...)
+		}
+		for _, dir := range driftPulls {
+			rs, err := terraform.PullState(cmd.Context(), dir)
+			if err != nil {
+				return err
+			}
+			resources = append(resources, rs...)
+		}
+
+		store, err := openSnapshots()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		snap, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		services, err := store.LoadServices(snap.ID)
+		if err != nil {
+			return err
+		}
+		scope := terraform.Scope{Regions: snap.Regions}
+		for _, s := range services {
+			if s.AccountID != "" && !slices.Contains(scope.Accounts, s.AccountID) {
+				scope.Accounts = append(scope.Accounts, s.AccountID)
+			}
+		}
+		d := terraform.Compare(services, resources, scope)
+		d.Incomplete = !snap.Complete()
+
+		if isDocumentFormat(OutputFormat) {
+			return writeDocument(cmd, d)
+		}
+		if d.Incomplete {
+			fmt.Fprintln(os.Stderr, "Warning: comparing against an incomplete snapshot; missing resources may only reflect what was scanned")
+		}
+		w := cmd.OutOrStdout()
+		fmt.Fprintf(w, "Comparing %d managed resources with snapshot %s\n", len(resources), snap.ID)
+		if d.Empty() {
+			fmt.Fprintln(w, "No drift")
+			return nil
+		}
+		for _, s := range d.Unmanaged {
+			fmt.Fprintf(w, "+ %s\n", s.Key())
+		}
+		for _, r := range d.Missing {
+			fmt.Fprintf(w, "- %s (%s)\n", r.Address, r.ARN)
+		}
+		for _, c := range d.Changed {
+			fmt.Fprintf(w, "~ %s\n", c.Resource.Address)
+			for _, a := range c.Attributes {
+				fmt.Fprintf(w, "    %s: %q -> %q\n", a.Name, a.State, a.Discovered)
+			}
+		}
+		fmt.Fprintf(w, "%d unmanaged, %d missing, %d drifted\n", len(d.Unmanaged), len(d.Missing), len(d.Changed))
+		return nil
+	},
+}
+
+func init() {
+	terraformCmd.AddCommand(terraformImportsCmd, terraformDriftCmd)
+	terraformImportsCmd.Flags().BoolVar(&terraformImportOpts.Dependencies, "dependencies", false, "also import resources the services depend on, such as execution roles")
+	terraformImportsCmd.Flags().BoolVar(&terraformImportOpts.RegionProviders, "region-providers", false, "import with a provider alias per region, e.g. aws.eu_west_1")
+	terraformDriftCmd.Flags().StringArrayVar(&driftStates, "state", nil, "Terraform state file, \"-\" or http(s) URL to compare (repeatable)")
+	terraformDriftCmd.Flags().StringArrayVar(&driftPulls, "pull", nil, "Terraform configuration directory whose state to pull (repeatable)")
+}
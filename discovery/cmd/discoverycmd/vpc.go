@@ -0,0 +1,259 @@
+package discoverycmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jamesneb/causal/discovery"
+	awscmd "github.com/jamesneb/causal/discovery/aws"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+var (
+	vpcSnapshot   string
+	vpcMinFreeIPs int32
+)
+
+// Risks graph vpc reports.
+const (
+	// riskSingleAZ marks a function whose subnets are all in one
+	// Availability Zone, so it goes down with it.
+	riskSingleAZ = "single-az"
+	// riskLowFreeIPs marks a subnet, and the functions using it, with fewer
+	// free addresses than --min-free-ips, which Lambda needs to create
+	// network interfaces for new combinations of security groups.
+	riskLowFreeIPs = "low-free-ips"
+	// riskNoInterface marks a function lacking a network interface in one
+	// of its subnets for its security groups, as when Lambda could not
+	// create one or reclaimed it from an idle function.
+	riskNoInterface = "no-interface"
+)
+
+var graphVPCCmd = &cobra.Command{
+	Use:   "vpc",
+	Short: "Report the network interfaces and reach of functions connected to a VPC",
+	Long: `Report the Lambda functions of a snapshot (--snapshot, default "latest")
+that are connected to a VPC, with what the configured role reads from EC2
+about the subnets they use:
+
+  - the Availability Zones of their subnets and the free addresses left in
+    each subnet;
+  - the network interfaces Lambda created for them, one per subnet for
+    each set of security groups, shared by the functions using that set;
+  - the services and security groups they can reach, as graph --network
+    finds them.
+
+Functions are flagged single-az when all their subnets are in one zone,
+low-free-ips when one of their subnets has fewer than --min-free-ips free
+addresses, and no-interface when Lambda has no interface for them in one of
+their subnets. The role needs ec2:DescribeSubnets,
+ec2:DescribeNetworkInterfaces and ec2:DescribeSecurityGroups. -o json or
+yaml prints the report as a document.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		services, err := snapshotServices(vpcSnapshot)
+		if err != nil {
+			return err
+		}
+		g := graph.New()
+		var attached []discovery.Service
+		for _, s := range services {
+			if l := s.Details.Lambda; l != nil && l.VPC != nil {
+				attached = append(attached, s)
+				g.Add(s)
+			}
+		}
+		if len(attached) == 0 {
+			fmt.Fprintln(os.Stderr, "No functions connected to a VPC")
+			return nil
+		}
+		ctx, cancel, provider, regions, err := graphProvider(cmd.Context(), g)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		report, err := vpcReport(ctx, provider, regions, attached, vpcMinFreeIPs)
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(OutputFormat) {
+		case "", "table":
+			w := cmd.OutOrStdout()
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tREGION\tVPC\tZONES\tINTERFACES\tREACHES\tRISKS")
+			for _, f := range report.Functions {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n", f.Name, f.Region, f.VPCID, strings.Join(f.AvailabilityZones, ","), len(f.Interfaces), len(f.Reaches), riskList(f.Risks))
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+			fmt.Fprintln(tw, "SUBNET\tVPC\tZONE\tFREE IPS\tINTERFACES\tFUNCTIONS\tRISKS")
+			for _, s := range report.Subnets {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n", s.ID, s.VPCID, s.AvailabilityZone, s.AvailableIPs, len(s.Interfaces), s.Functions, riskList(s.Risks))
+			}
+			return tw.Flush()
+		case "json", "yaml", "yml":
+			return writeDocument(cmd, report)
+		default:
+			return fmt.Errorf("unknown vpc format %q (supported: table, json, yaml)", OutputFormat)
+		}
+	},
+}
+
+// vpcNetwork is what graph vpc reports.
+type vpcNetwork struct {
+	Functions []vpcFunction `json:"functions"`
+	Subnets   []vpcSubnet   `json:"subnets"`
+}
+
+// vpcFunction is a function connected to a VPC.
+type vpcFunction struct {
+	Name              string   `json:"name"`
+	ARN               string   `json:"arn"`
+	Region            string   `json:"region"`
+	VPCID             string   `json:"vpcId"`
+	Subnets           []string `json:"subnets"`
+	SecurityGroupIDs  []string `json:"securityGroupIds"`
+	AvailabilityZones []string `json:"availabilityZones"`
+	// Interfaces are the IDs of the network interfaces in its subnets with
+	// exactly its security groups.
+	Interfaces []string `json:"interfaces"`
+	// Reaches are the network relationships from it to the services and
+	// security groups it can reach, as graph --network finds them.
+	Reaches []discovery.Relationship `json:"reaches"`
+	Risks   []string                 `json:"risks"`
+}
+
+// vpcSubnet is a subnet functions use.
+type vpcSubnet struct {
+	awscmd.Subnet
+	// Functions is the number of functions using the subnet.
+	Functions int      `json:"functions"`
+	Risks     []string `json:"risks"`
+}
+
+// vpcReport reads the subnets and network reach of the functions in
+// regions.
+func vpcReport(ctx context.Context, provider *awscmd.Provider, regions []string, functions []discovery.Service, minFreeIPs int32) (*vpcNetwork, error) {
+	report := &vpcNetwork{Functions: []vpcFunction{}, Subnets: []vpcSubnet{}}
+	for _, region := range regions {
+		var inRegion []discovery.Service
+		ids := map[string]bool{}
+		for _, s := range functions {
+			if s.Region == region {
+				inRegion = append(inRegion, s)
+				for _, id := range s.Details.Lambda.VPC.SubnetIDs {
+					ids[id] = true
+				}
+			}
+		}
+		if len(inRegion) == 0 {
+			continue
+		}
+		subnetIDs := make([]string, 0, len(ids))
+		for id := range ids {
+			subnetIDs = append(subnetIDs, id)
+		}
+		sort.Strings(subnetIDs)
+		subnets, err := provider.Subnets(ctx, region, subnetIDs)
+		if err != nil {
+			return nil, err
+		}
+		rels, err := provider.NetworkRelationships(ctx, region, inRegion)
+		if err != nil {
+			return nil, err
+		}
+		reaches := map[string][]discovery.Relationship{}
+		for _, r := range rels {
+			reaches[r.From] = append(reaches[r.From], r)
+		}
+
+		byID := map[string]*vpcSubnet{}
+		for _, s := range subnets {
+			sub := &vpcSubnet{Subnet: s, Risks: []string{}}
+			if s.AvailableIPs < minFreeIPs {
+				sub.Risks = append(sub.Risks, riskLowFreeIPs)
+			}
+			byID[s.ID] = sub
+		}
+		for _, s := range inRegion {
+			v := s.Details.Lambda.VPC
+			groups := slices.Sorted(slices.Values(v.SecurityGroupIDs))
+			f := vpcFunction{
+				Name:              s.Name,
+				ARN:               s.ARN,
+				Region:            s.Region,
+				VPCID:             v.VPCID,
+				Subnets:           v.SubnetIDs,
+				SecurityGroupIDs:  groups,
+				Interfaces:        []string{},
+				AvailabilityZones: []string{},
+				Reaches:           reaches[s.Key()],
+				Risks:             []string{},
+			}
+			if f.Reaches == nil {
+				f.Reaches = []discovery.Relationship{}
+			}
+			zones := map[string]bool{}
+			lowIPs, missing := false, false
+			for _, id := range v.SubnetIDs {
+				sub, ok := byID[id]
+				if !ok {
+					continue
+				}
+				sub.Functions++
+				zones[sub.AvailabilityZone] = true
+				lowIPs = lowIPs || sub.AvailableIPs < minFreeIPs
+				found := false
+				for _, ni := range sub.Interfaces {
+					if slices.Equal(ni.SecurityGroupIDs, groups) {
+						f.Interfaces = append(f.Interfaces, ni.ID)
+						found = true
+					}
+				}
+				missing = missing || !found
+			}
+			for z := range zones {
+				f.AvailabilityZones = append(f.AvailabilityZones, z)
+			}
+			sort.Strings(f.AvailabilityZones)
+			if len(zones) == 1 {
+				f.Risks = append(f.Risks, riskSingleAZ)
+			}
+			if lowIPs {
+				f.Risks = append(f.Risks, riskLowFreeIPs)
+			}
+			if missing {
+				f.Risks = append(f.Risks, riskNoInterface)
+			}
+			report.Functions = append(report.Functions, f)
+		}
+		for _, s := range subnets {
+			report.Subnets = append(report.Subnets, *byID[s.ID])
+		}
+	}
+	return report, nil
+}
+
+func riskList(risks []string) string {
+	if len(risks) == 0 {
+		return "-"
+	}
+	return strings.Join(risks, ",")
+}
+
+func init() {
+	graphVPCCmd.Flags().StringVar(&vpcSnapshot, "snapshot", "latest", "snapshot whose functions to report")
+	graphVPCCmd.Flags().Int32Var(&vpcMinFreeIPs, "min-free-ips", 16, "flag subnets with fewer free IPv4 addresses than this")
+	graphCmd.AddCommand(graphVPCCmd)
+}
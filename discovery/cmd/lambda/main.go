@@ -0,0 +1,49 @@
+// Command lambda is the bootstrap of an AWS Lambda function running
+// discovery on each invocation; see "discovery lambda". Build it for the
+// provided.al2023 runtime with
+//
+//	GOOS=linux GOARCH=arm64 go build -tags lambda.norpc -o bootstrap ./cmd/lambda
+//
+// or "make lambda", which also zips it.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jamesneb/causal/discovery/cmd/discoverycmd"
+)
+
+func main() {
+	// Lambda sets no home directory and only /tmp is writable, so keep the
+	// cache, snapshots and plugins there. They last as long as the execution
+	// environment, so a warm function compares each run with the one before;
+	// the sinks are what persist.
+	for _, v := range []string{"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME"} {
+		if os.Getenv(v) == "" {
+			os.Setenv(v, os.TempDir())
+		}
+	}
+
+	// The configuration file is deployed next to the bootstrap unless
+	// $DISCOVERY_CONFIG names one, which must exist. The bundled one is
+	// optional: without it the defaults and environment are used.
+	args := []string{"lambda"}
+	path := os.Getenv("DISCOVERY_CONFIG")
+	if path == "" {
+		bundled := filepath.Join(os.Getenv("LAMBDA_TASK_ROOT"), "config.yaml")
+		if _, err := os.Stat(bundled); err == nil {
+			path = bundled
+		}
+	}
+	if path != "" {
+		args = append(args, "--config", path)
+	}
+	discoverycmd.RootCmd.SetArgs(args)
+	if err := discoverycmd.RootCmd.ExecuteContext(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(discoverycmd.ExitCode(err))
+	}
+}
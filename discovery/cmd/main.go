@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jamesneb/causal/discovery/cmd/discoverycmd"
+)
+
+func main() {
+	// Results go to stdout; keep the banner and diagnostics on stderr so the
+	// output can be piped.
+	fmt.Fprintln(os.Stderr, "Discovery CLI - Service Discovery Tool")
+
+	// Cancel the discovery context on the first SIGINT/SIGTERM so commands can
+	// flush what they have; a second signal falls through to the default
+	// handler and terminates immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// Execute the root command
+	if err := discoverycmd.RootCmd.ExecuteContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(discoverycmd.ExitCode(err))
+	}
+}
@@ -0,0 +1,237 @@
+// Package code downloads the deployment packages of Lambda functions: the
+// ZIP archives GetFunction returns a presigned URL for. Packages are checked
+// against their size limit and SHA-256 checksum and stored in a local
+// directory or under an S3 prefix, or read for the dependencies their
+// manifests declare.
+package code
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSize is the largest package downloaded unless Options say
+// otherwise, a little over the 250 MB Lambda allows unzipped.
+const DefaultMaxSize = 256 << 20
+
+// DefaultParallelism is how many packages are downloaded at once unless
+// Options say otherwise.
+const DefaultParallelism = 4
+
+// DefaultAttempts is how many times a download is tried unless Options say
+// otherwise.
+const DefaultAttempts = 3
+
+// ErrTooLarge is returned for packages larger than the size limit.
+var ErrTooLarge = errors.New("package is larger than the size limit")
+
+// ErrUnparsable is returned, along with the dependencies of the other
+// manifests, when manifests of a package cannot be parsed.
+var ErrUnparsable = errors.New("manifest cannot be parsed")
+
+// Package is the deployment package of a function, or the archive of a
+// layer version.
+type Package struct {
+	// Function is the function's ARN, or the layer version's.
+	Function string `json:"function"`
+	Name     string `json:"name"`
+	Region   string `json:"region"`
+	// URL is the presigned URL the package is downloaded from.
+	URL string `json:"-"`
+	// SHA256 is the base64-encoded SHA-256 of the package, as Lambda
+	// reports it.
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// Key returns where p is stored in a destination:
+// <account>/<region>/<name>.zip.
+func (p Package) Key() string {
+	account := ""
+	if parts := strings.SplitN(p.Function, ":", 6); len(parts) == 6 {
+		account = parts[4]
+	}
+	return account + "/" + p.Region + "/" + p.Name + ".zip"
+}
+
+// Options configure Pull.
+type Options struct {
+	// MaxSize is the largest package downloaded, in bytes; 0 means
+	// DefaultMaxSize.
+	MaxSize int64
+	// Parallelism is how many packages are downloaded at once; 0 means
+	// DefaultParallelism.
+	Parallelism int
+	// Attempts is how many times a download is tried when it fails,
+	// including the first; 0 means DefaultAttempts.
+	Attempts int
+	// Locate, if set, is called before each download to fill in the URL,
+	// checksum and size of the package. Presigned URLs expire minutes after
+	// they are signed, so they are best signed just before use.
+	Locate func(ctx context.Context, p Package) (Package, error)
+	// Client makes the downloads; nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// Result is the outcome of pulling one package.
+type Result struct {
+	Package Package `json:"package"`
+	// Key is where the package was stored.
+	Key string `json:"key,omitempty"`
+	Err error  `json:"-"`
+	// Error is Err as text, for JSON and YAML output.
+	Error string `json:"error,omitempty"`
+}
+
+// Pull downloads packages to dest, Parallelism at a time, and returns the
+// results in the order of packages. A package that cannot be downloaded or
+// stored is reported in its result; Pull only fails when ctx is done.
+func Pull(ctx context.Context, packages []Package, dest Destination, opts Options) ([]Result, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = DefaultParallelism
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = DefaultAttempts
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	results := make([]Result, len(packages))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(opts.Parallelism, len(packages)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = pull(ctx, packages[i], dest, opts)
+			}
+		}()
+	}
+	for i := range packages {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(next)
+	wg.Wait()
+	return results, ctx.Err()
+}
+
+func pull(ctx context.Context, p Package, dest Destination, opts Options) Result {
+	r := Result{Package: p}
+	fail := func(err error) Result {
+		r.Err = fmt.Errorf("%s: %w", p.Name, err)
+		r.Error = r.Err.Error()
+		return r
+	}
+	if opts.Locate != nil {
+		var err error
+		if p, err = opts.Locate(ctx, p); err != nil {
+			return fail(err)
+		}
+		r.Package = p
+	}
+	if p.URL == "" {
+		return fail(errors.New("no package to download; container image functions have none"))
+	}
+	if p.Size > opts.MaxSize {
+		return fail(fmt.Errorf("%w: %d bytes", ErrTooLarge, p.Size))
+	}
+
+	f, err := os.CreateTemp("", "discovery-code-*.zip")
+	if err != nil {
+		return fail(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	var size int64
+	for attempt := 1; ; attempt++ {
+		size, err = download(ctx, opts.Client, p, f, opts.MaxSize)
+		var permanent *permanentError
+		if err == nil || attempt == opts.Attempts || errors.As(err, &permanent) || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	r.Key = p.Key()
+	if err := dest.Put(ctx, r.Key, f, size); err != nil {
+		r.Key = ""
+		return fail(err)
+	}
+	return r
+}
+
+// permanentError is a download failure that trying again does not fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// download writes the package p to f, which it truncates first, and returns
+// its size once its checksum matches.
+func download(ctx context.Context, client *http.Client, p Package, f *os.File, maxSize int64) (int64, error) {
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return 0, &permanentError{err}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return 0, &permanentError{errors.New("download refused; the presigned URL may have expired")}
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return 0, fmt.Errorf("downloading: %s", resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return 0, &permanentError{fmt.Errorf("downloading: %s", resp.Status)}
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return 0, fmt.Errorf("downloading: %w", err)
+	}
+	if n > maxSize {
+		return 0, &permanentError{ErrTooLarge}
+	}
+	if sum := base64.StdEncoding.EncodeToString(hash.Sum(nil)); p.SHA256 != "" && sum != p.SHA256 {
+		return 0, fmt.Errorf("checksum %s does not match the function's %s", sum, p.SHA256)
+	}
+	return n, nil
+}
@@ -0,0 +1,85 @@
+package code
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Destination stores downloaded packages.
+type Destination interface {
+	// Put stores the size bytes read from r under key, a slash-separated
+	// path such as 123456789012/us-east-1/orders.zip.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+}
+
+// Dir stores packages in a local directory, replacing each file whole so
+// an interrupted pull never leaves a partial package behind.
+type Dir string
+
+func (d Dir) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	path := filepath.Join(string(d), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".pull-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// S3API is the subset of the S3 client S3 uses.
+type S3API interface {
+	PutObject(ctx context.Context, in *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3 stores packages as objects under a prefix of a bucket.
+type S3 struct {
+	Client S3API
+	Bucket string
+	// Prefix is prepended to every key, e.g. "code/".
+	Prefix string
+}
+
+// ParseS3 returns the bucket and prefix of an s3://bucket/prefix URL, and
+// whether dest is one. The prefix ends in a slash unless it is empty.
+func ParseS3(dest string) (bucket, prefix string, ok bool) {
+	rest, ok := strings.CutPrefix(dest, "s3://")
+	if !ok {
+		return "", "", false
+	}
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return bucket, prefix, bucket != ""
+}
+
+func (s S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.Bucket),
+		Key:           aws.String(s.Prefix + key),
+		Body:          r,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String("application/zip"),
+	})
+	if err != nil {
+		return fmt.Errorf("uploading s3://%s/%s%s: %w", s.Bucket, s.Prefix, key, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package code
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Layer downloads the archive of the layer version p and returns what it
+// holds; see Contents.
+func Layer(ctx context.Context, client *http.Client, p Package, maxSize int64) (*discovery.LayerContents, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	var contents *discovery.LayerContents
+	err := fetch(ctx, client, p, maxSize, func(f *os.File, size int64) error {
+		var err error
+		contents, err = Contents(f, size)
+		return err
+	})
+	return contents, err
+}
+
+// Contents returns what the layer archive r of size bytes holds: its files,
+// their size by top-level directory, and the libraries installed in it,
+// Python distributions under site-packages and Node.js packages directly
+// under node_modules, sorted by path.
+func Contents(r io.ReaderAt, size int64) (*discovery.LayerContents, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("reading layer: %w", err)
+	}
+	c := &discovery.LayerContents{}
+	dirs := map[string]int64{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		c.Files++
+		c.Size += int64(f.UncompressedSize64)
+		top, _, _ := strings.Cut(f.Name, "/")
+		dirs[top] += int64(f.UncompressedSize64)
+
+		if lib, ok := distribution(f.Name); ok {
+			c.Libraries = append(c.Libraries, lib)
+			continue
+		}
+		if !nodePackage(f.Name) || f.UncompressedSize64 > maxManifestSize {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		var pkg struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}
+		err = json.NewDecoder(io.LimitReader(rc, maxManifestSize)).Decode(&pkg)
+		rc.Close()
+		// Packages without a name in their package.json are not
+		// installed libraries, e.g. a test fixture.
+		if err == nil && pkg.Name != "" {
+			c.Libraries = append(c.Libraries, discovery.Dependency{Ecosystem: "npm", Name: pkg.Name, Version: pkg.Version, Manifest: f.Name})
+		}
+	}
+	for dir, n := range dirs {
+		c.Directories = append(c.Directories, discovery.LayerDirectory{Path: dir, Size: n})
+	}
+	sort.Slice(c.Directories, func(i, j int) bool { return c.Directories[i].Path < c.Directories[j].Path })
+	sort.Slice(c.Libraries, func(i, j int) bool { return c.Libraries[i].Manifest < c.Libraries[j].Manifest })
+	return c, nil
+}
+
+// distribution returns the Python distribution whose metadata is the file
+// name, a .dist-info directory's METADATA in site-packages, e.g.
+// python/lib/python3.12/site-packages/requests-2.31.0.dist-info/METADATA.
+func distribution(name string) (discovery.Dependency, bool) {
+	dir, file := path.Split(name)
+	dir = strings.TrimSuffix(dir, "/")
+	if file != "METADATA" || path.Base(path.Dir(dir)) != "site-packages" {
+		return discovery.Dependency{}, false
+	}
+	info, ok := strings.CutSuffix(path.Base(dir), ".dist-info")
+	if !ok {
+		return discovery.Dependency{}, false
+	}
+	// Names in the directory have their "-" escaped as "_", so the first
+	// "-" ends the name.
+	lib, version, ok := strings.Cut(info, "-")
+	if !ok {
+		return discovery.Dependency{}, false
+	}
+	return discovery.Dependency{Ecosystem: "pypi", Name: lib, Version: version, Manifest: dir}, true
+}
+
+// nodePackage reports whether name is the package.json of a package
+// directly under a node_modules directory, scoped or not, rather than of
+// one of its own dependencies or files.
+func nodePackage(name string) bool {
+	parts := strings.Split(name, "/")
+	n := len(parts)
+	if n < 3 || parts[n-1] != "package.json" {
+		return false
+	}
+	pkg := n - 2
+	if n >= 4 && strings.HasPrefix(parts[n-3], "@") {
+		pkg = n - 3
+	}
+	if pkg == 0 || parts[pkg-1] != "node_modules" {
+		return false
+	}
+	for _, p := range parts[:pkg-1] {
+		if p == "node_modules" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,226 @@
+package code
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// maxManifestSize is the largest manifest read; larger files are not
+// hand-written manifests.
+const maxManifestSize = 1 << 20
+
+// manifestParsers parse the manifests known, by file name.
+var manifestParsers = map[string]func(data []byte) ([]discovery.Dependency, error){
+	"requirements.txt": parseRequirements,
+	"package.json":     parsePackageJSON,
+	"go.mod":           parseGoMod,
+	"pom.xml":          parsePOM,
+}
+
+// Dependencies downloads the package p and returns the dependencies its
+// manifests declare; see Manifests.
+func Dependencies(ctx context.Context, client *http.Client, p Package, maxSize int64) ([]discovery.Dependency, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	var deps []discovery.Dependency
+	err := fetch(ctx, client, p, maxSize, func(f *os.File, size int64) error {
+		var err error
+		deps, err = Manifests(f, size)
+		return err
+	})
+	return deps, err
+}
+
+// fetch downloads the package p to a temporary file and calls read with it.
+func fetch(ctx context.Context, client *http.Client, p Package, maxSize int64, read func(f *os.File, size int64) error) error {
+	if p.Size > maxSize {
+		return fmt.Errorf("%w: %d bytes", ErrTooLarge, p.Size)
+	}
+	f, err := os.CreateTemp("", "discovery-code-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size, err := download(ctx, client, p, f, maxSize)
+	if err != nil {
+		return err
+	}
+	return read(f, size)
+}
+
+// Manifests returns the dependencies declared by the requirements.txt,
+// package.json, go.mod and pom.xml files in the ZIP archive r of size
+// bytes, sorted by manifest and name. Manifests of the libraries bundled in
+// the package, under node_modules or a Python site-packages directory, are
+// left out. Manifests that cannot be parsed are skipped, and reported in an
+// error wrapping ErrUnparsable returned with the others' dependencies.
+func Manifests(r io.ReaderAt, size int64) ([]discovery.Dependency, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("reading package: %w", err)
+	}
+	var deps []discovery.Dependency
+	var unparsable []error
+	for _, f := range zr.File {
+		parse, ok := manifestParsers[path.Base(f.Name)]
+		if !ok || bundled(f.Name) || f.UncompressedSize64 > maxManifestSize {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, maxManifestSize))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		found, err := parse(data)
+		if err != nil {
+			unparsable = append(unparsable, fmt.Errorf("%s: %w", f.Name, err))
+			continue
+		}
+		for i := range found {
+			found[i].Manifest = f.Name
+		}
+		deps = append(deps, found...)
+	}
+	sort.SliceStable(deps, func(i, j int) bool {
+		if deps[i].Manifest != deps[j].Manifest {
+			return deps[i].Manifest < deps[j].Manifest
+		}
+		return deps[i].Name < deps[j].Name
+	})
+	if len(unparsable) > 0 {
+		return deps, fmt.Errorf("%w: %w", ErrUnparsable, errors.Join(unparsable...))
+	}
+	return deps, nil
+}
+
+// bundled reports whether name is inside a library bundled in the package.
+func bundled(name string) bool {
+	for _, dir := range strings.Split(path.Dir(name), "/") {
+		if dir == "node_modules" || dir == "site-packages" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRequirements parses a pip requirements file: one requirement per
+// line, such as "requests==2.31.0" or "boto3>=1.28; python_version>'3.8'".
+// Options, such as -r and -e, and URLs are skipped.
+func parseRequirements(data []byte) ([]discovery.Dependency, error) {
+	var deps []discovery.Dependency
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		line, _, _ = strings.Cut(line, ";")
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			continue
+		}
+		name, version := line, ""
+		if i := strings.IndexAny(line, "=<>!~ "); i >= 0 {
+			name, version = line[:i], strings.ReplaceAll(line[i:], " ", "")
+		}
+		// Extras, as in "requests[socks]", are not part of the name.
+		name, _, _ = strings.Cut(name, "[")
+		deps = append(deps, discovery.Dependency{Ecosystem: "pypi", Name: name, Version: version})
+	}
+	return deps, sc.Err()
+}
+
+// parsePackageJSON returns the dependencies of a package.json, leaving out
+// devDependencies, which are not deployed.
+func parsePackageJSON(data []byte) ([]discovery.Dependency, error) {
+	var pkg struct {
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+	var deps []discovery.Dependency
+	for name, version := range pkg.Dependencies {
+		deps = append(deps, discovery.Dependency{Ecosystem: "npm", Name: name, Version: version})
+	}
+	return deps, nil
+}
+
+// parseGoMod returns the modules a go.mod requires, in require directives
+// and blocks.
+func parseGoMod(data []byte) ([]discovery.Dependency, error) {
+	var deps []discovery.Dependency
+	block := false
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "//")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case block && fields[0] == ")":
+			block = false
+			continue
+		case !block && fields[0] == "require":
+			if len(fields) > 1 && fields[1] == "(" {
+				block = true
+				continue
+			}
+			fields = fields[1:]
+		case !block:
+			continue
+		}
+		if len(fields) >= 2 {
+			deps = append(deps, discovery.Dependency{Ecosystem: "go", Name: fields[0], Version: fields[1]})
+		}
+	}
+	return deps, sc.Err()
+}
+
+// parsePOM returns the dependencies of a Maven pom.xml, named
+// groupId:artifactId, leaving out test dependencies. Dependency management
+// sections only constrain versions and are skipped.
+func parsePOM(data []byte) ([]discovery.Dependency, error) {
+	var pom struct {
+		Dependencies []struct {
+			GroupID    string `xml:"groupId"`
+			ArtifactID string `xml:"artifactId"`
+			Version    string `xml:"version"`
+			Scope      string `xml:"scope"`
+		} `xml:"dependencies>dependency"`
+	}
+	if err := xml.Unmarshal(data, &pom); err != nil {
+		return nil, err
+	}
+	var deps []discovery.Dependency
+	for _, d := range pom.Dependencies {
+		if d.Scope == "test" || d.ArtifactID == "" {
+			continue
+		}
+		deps = append(deps, discovery.Dependency{Ecosystem: "maven", Name: d.GroupID + ":" + d.ArtifactID, Version: d.Version})
+	}
+	return deps, nil
+}
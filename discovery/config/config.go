@@ -0,0 +1,334 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the on-disk configuration written by `discovery init` and read by
+// every command. Command-line arguments and flags take precedence over it.
+type Config struct {
+	Provider      string        `yaml:"provider"`
+	Identity      Identity      `yaml:"identity"`
+	AWS           AWS           `yaml:"aws"`
+	Output        Output        `yaml:"output"`
+	Cache         Cache         `yaml:"cache,omitempty"`
+	Snapshots     Snapshots     `yaml:"snapshots,omitempty"`
+	Plugins       Plugins       `yaml:"plugins,omitempty"`
+	Hooks         Hooks         `yaml:"hooks,omitempty"`
+	Sinks         Sinks         `yaml:"sinks,omitempty"`
+	Notifications Notifications `yaml:"notifications,omitempty"`
+	PagerDuty     PagerDuty     `yaml:"pagerduty,omitempty"`
+}
+
+// Identity holds the Auth0 application used for the device login flow.
+type Identity struct {
+	Domain   string `yaml:"domain"`
+	ClientID string `yaml:"client_id"`
+	Audience string `yaml:"audience,omitempty"`
+}
+
+type AWS struct {
+	RoleARN     string   `yaml:"role_arn"`
+	SessionName string   `yaml:"session_name,omitempty"`
+	Regions     []string `yaml:"regions"`
+	// ExtraRegions are accepted as regions although discovery does not
+	// know them, e.g. ones launched after it was built.
+	ExtraRegions []string `yaml:"extra_regions,omitempty"`
+	// RateLimit caps API requests per second across the account;
+	// ServiceRateLimits caps individual services (e.g. Lambda) within it.
+	RateLimit         float64            `yaml:"rate_limit,omitempty"`
+	RateBurst         int                `yaml:"rate_burst,omitempty"`
+	ServiceRateLimits map[string]float64 `yaml:"service_rate_limits,omitempty"`
+	// AccountRateLimits replaces RateLimit for individual accounts, by
+	// account ID.
+	AccountRateLimits map[string]float64 `yaml:"account_rate_limits,omitempty"`
+	// ParallelAccounts caps how many accounts of a multi-account run are
+	// scanned at once; 0 leaves only the regions scanned at once capped.
+	ParallelAccounts int `yaml:"parallel_accounts,omitempty"`
+	// RetryAccounts has discovery try the accounts it could not access
+	// once more at the end of a run.
+	RetryAccounts bool `yaml:"retry_accounts,omitempty"`
+	// SkipRolePolicies stops discovery from reading execution role
+	// policies to infer the resources functions depend on.
+	SkipRolePolicies bool `yaml:"skip_role_policies,omitempty"`
+	// SkipResourcePolicies stops discovery from reading the resource
+	// policies of functions, event buses, queues, topics and buckets to
+	// infer what depends on them.
+	SkipResourcePolicies bool `yaml:"skip_resource_policies,omitempty"`
+	// CodeDependencies has discovery download every function's package
+	// to record the dependencies its manifests declare.
+	CodeDependencies bool `yaml:"code_dependencies,omitempty"`
+	// UsageWindow, when set, has discovery record how much every function
+	// was used over that long, from CloudWatch metrics.
+	UsageWindow time.Duration `yaml:"usage_window,omitempty"`
+	// Organization, when set, has discovery scan every active account of
+	// the organization role_arn belongs to.
+	Organization *Organization `yaml:"organization,omitempty"`
+	// Accounts are roles assumed with role_arn's credentials, by account
+	// ID. Without organization the accounts are scanned along with
+	// role_arn's own; with it they replace the organization role in the
+	// member accounts they name.
+	Accounts map[string]AccountRole `yaml:"accounts,omitempty"`
+}
+
+// AccountRole is the role discovery assumes in an account.
+type AccountRole struct {
+	RoleARN string `yaml:"role_arn"`
+	// ExternalID is presented to roles whose trust policy requires one.
+	ExternalID string `yaml:"external_id,omitempty"`
+}
+
+// Organization is how discovery reaches the member accounts of an AWS
+// organization. role_arn must be in the management account or one delegated
+// to administer the organization, and allowed to assume RoleName in the
+// others.
+type Organization struct {
+	// RoleName is the role assumed in every member account; empty means
+	// OrganizationDiscoveryRole.
+	RoleName string `yaml:"role_name,omitempty"`
+}
+
+type Output struct {
+	Format  string   `yaml:"format,omitempty"`
+	Columns []string `yaml:"columns,omitempty"`
+	// Tags are the tag keys exported as their own CSV columns.
+	Tags []string `yaml:"tags,omitempty"`
+	// OwnerTags are the tag keys tried, in order, for a service's owner;
+	// empty means discovery.DefaultOwnerTags.
+	OwnerTags []string `yaml:"owner_tags,omitempty"`
+}
+
+// Cache controls the on-disk result cache. A zero TTL uses the default;
+// TTLs overrides it per resource type, keyed by cataloger name.
+type Cache struct {
+	Dir      string                   `yaml:"dir,omitempty"`
+	TTL      time.Duration            `yaml:"ttl,omitempty"`
+	TTLs     map[string]time.Duration `yaml:"ttls,omitempty"`
+	Disabled bool                     `yaml:"disabled,omitempty"`
+}
+
+// Snapshots controls where discovery runs are recorded. An empty path uses
+// the default database location.
+type Snapshots struct {
+	Path     string `yaml:"path,omitempty"`
+	Disabled bool   `yaml:"disabled,omitempty"`
+}
+
+// Plugins controls external catalogers. An empty dir uses the default plugin
+// directory.
+type Plugins struct {
+	Dir      string `yaml:"dir,omitempty"`
+	Disabled bool   `yaml:"disabled,omitempty"`
+}
+
+// Hooks are shell commands or webhooks run before a run, after each provider
+// finishes and after the run, each receiving the run manifest as JSON.
+type Hooks struct {
+	BeforeRun    []Hook `yaml:"before_run,omitempty"`
+	ProviderDone []Hook `yaml:"provider_done,omitempty"`
+	AfterRun     []Hook `yaml:"after_run,omitempty"`
+}
+
+// Hook is one command or webhook; set either command or url.
+type Hook struct {
+	Command string            `yaml:"command,omitempty"`
+	URL     string            `yaml:"url,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Timeout time.Duration     `yaml:"timeout,omitempty"`
+}
+
+// Notifications post a summary of every run to chat webhooks. Webhook URLs
+// may refer to environment variables.
+type Notifications struct {
+	Slack *ChatWebhook `yaml:"slack,omitempty"`
+	Teams *ChatWebhook `yaml:"teams,omitempty"`
+	// MaxNotable bounds the notable changes listed per message.
+	MaxNotable int `yaml:"max_notable,omitempty"`
+}
+
+// ChatWebhook is an incoming webhook of a chat service.
+type ChatWebhook struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+// PagerDuty maps service owners to escalation policies for "discovery
+// pagerduty". OwnerTags defaults to team, then owner.
+type PagerDuty struct {
+	OwnerTags               []string          `yaml:"owner_tags,omitempty"`
+	EscalationPolicies      map[string]string `yaml:"escalation_policies,omitempty"`
+	DefaultEscalationPolicy string            `yaml:"default_escalation_policy,omitempty"`
+}
+
+// Sinks are external stores every run's services are written to. A nil
+// sink is disabled.
+type Sinks struct {
+	DynamoDB *DynamoDBSink `yaml:"dynamodb,omitempty"`
+	S3       *S3Sink       `yaml:"s3,omitempty"`
+	Postgres *PostgresSink `yaml:"postgres,omitempty"`
+	Webhook  *WebhookSink  `yaml:"webhook,omitempty"`
+	Kafka    *KafkaSink    `yaml:"kafka,omitempty"`
+	// EventBridge is meant for "discovery serve", where every run is
+	// compared with the one before.
+	EventBridge *EventBridgeSink `yaml:"eventbridge,omitempty"`
+}
+
+// DynamoDBSink upserts services into a DynamoDB table. Credentials come from
+// the default AWS credential chain, not the discovery role.
+type DynamoDBSink struct {
+	Table  string `yaml:"table"`
+	Region string `yaml:"region,omitempty"`
+	// PartitionKey defaults to attribute "id" holding the service key.
+	PartitionKey SinkKey `yaml:"partition_key,omitempty"`
+	SortKey      SinkKey `yaml:"sort_key,omitempty"`
+	// TTLAttribute is set to the time TTL after each write, so services no
+	// longer discovered expire.
+	TTLAttribute string        `yaml:"ttl_attribute,omitempty"`
+	TTL          time.Duration `yaml:"ttl,omitempty"`
+}
+
+// S3Sink writes each run to a bucket under date, account and region
+// partitions, as gzipped JSON Lines or Parquet.
+type S3Sink struct {
+	Bucket string `yaml:"bucket"`
+	Prefix string `yaml:"prefix,omitempty"`
+	Region string `yaml:"region,omitempty"`
+	Format string `yaml:"format,omitempty"`
+}
+
+// PostgresSink upserts services into a PostgreSQL database, migrating its
+// schema first. URL may refer to environment variables, e.g.
+// postgres://discovery:${PGPASSWORD}@db/inventory.
+type PostgresSink struct {
+	URL string `yaml:"url"`
+}
+
+// WebhookSink posts each run, or each service as it is discovered in
+// "stream" mode, to a URL. Secret and header values may refer to environment
+// variables.
+type WebhookSink struct {
+	URL     string            `yaml:"url"`
+	Secret  string            `yaml:"secret,omitempty"`
+	Mode    string            `yaml:"mode,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Timeout time.Duration     `yaml:"timeout,omitempty"`
+	Retries *int              `yaml:"retries,omitempty"`
+}
+
+// KafkaSink publishes services to a Kafka topic. The SASL password may refer
+// to environment variables.
+type KafkaSink struct {
+	Brokers  []string   `yaml:"brokers"`
+	Topic    string     `yaml:"topic"`
+	ClientID string     `yaml:"client_id,omitempty"`
+	TLS      *KafkaTLS  `yaml:"tls,omitempty"`
+	SASL     *KafkaSASL `yaml:"sasl,omitempty"`
+	// ChangeEvents also publishes how services changed since the last
+	// complete snapshot.
+	ChangeEvents bool `yaml:"change_events,omitempty"`
+}
+
+// KafkaTLS enables TLS to the brokers; an empty block trusts the system
+// roots.
+type KafkaTLS struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// KafkaSASL is "plain", "scram-sha-256" or "scram-sha-512" authentication.
+type KafkaSASL struct {
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+}
+
+// EventBridgeSink puts an event on a bus for every service added, changed or
+// removed since the last complete snapshot. Credentials come from the
+// default AWS credential chain, not the discovery role.
+type EventBridgeSink struct {
+	Bus    string `yaml:"bus,omitempty"`
+	Region string `yaml:"region,omitempty"`
+	Source string `yaml:"source,omitempty"`
+}
+
+// SinkKey is a key attribute and the service column filling it: "key" for
+// the service key, or a column name such as "account".
+type SinkKey struct {
+	Attribute string `yaml:"attribute"`
+	Column    string `yaml:"column,omitempty"`
+}
+
+// Default returns the configuration used when no file exists.
+func Default() *Config {
+	return &Config{
+		Provider: "aws",
+		AWS: AWS{
+			SessionName: "discovery-cli-session",
+			Regions:     []string{"us-east-1"},
+		},
+	}
+}
+
+// DefaultPath returns the per-user config file location,
+// e.g. ~/.config/discovery/config.yaml on Linux.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locating user config directory: %w", err)
+	}
+	return filepath.Join(dir, "discovery", "config.yaml"), nil
+}
+
+// Load reads the config file at path.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// LoadDefault reads the config file at DefaultPath. A missing file is not
+// an error, as before init has run; the defaults are returned instead.
+func LoadDefault() (*Config, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Default(), nil
+	}
+	return cfg, err
+}
+
+// Save writes cfg to path, creating parent directories as needed.
+func Save(path string, cfg *Config) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+	data := buf.Bytes()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("writing config %s: %w", path, err)
+	}
+	return nil
+}
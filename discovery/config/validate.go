@@ -0,0 +1,30 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validate checks the Auth0 settings needed for login.
+func (i Identity) Validate() error {
+	if i.Domain == "" || i.ClientID == "" {
+		return errors.New("identity domain and client_id are not configured; run \"discovery init\"")
+	}
+	return ValidateDomain(i.Domain)
+}
+
+// ValidateDomain checks that domain is a bare host name such as
+// example.us.auth0.com.
+func ValidateDomain(domain string) error {
+	switch {
+	case strings.Contains(domain, "://"):
+		host := domain[strings.Index(domain, "://")+3:]
+		return fmt.Errorf("invalid Auth0 domain %q: give the host name only, e.g. %s", domain, strings.TrimSuffix(host, "/"))
+	case strings.ContainsAny(domain, "/ "):
+		return fmt.Errorf("invalid Auth0 domain %q: expected a host name such as example.us.auth0.com", domain)
+	case !strings.Contains(domain, "."):
+		return fmt.Errorf("invalid Auth0 domain %q: expected a host name such as example.us.auth0.com", domain)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// Package cyclonedx writes discovered services as a CycloneDX bill of
+// materials: every service is a component, with the artifacts it runs -
+// deployment packages, container images and Lambda layers - as components it
+// depends on, so supply-chain tooling can see what is deployed where.
+package cyclonedx
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// SpecVersion is the CycloneDX version written.
+const SpecVersion = "1.5"
+
+// BOM is a CycloneDX document.
+type BOM struct {
+	BOMFormat    string       `json:"bomFormat"`
+	SpecVersion  string       `json:"specVersion"`
+	SerialNumber string       `json:"serialNumber"`
+	Version      int          `json:"version"`
+	Metadata     Metadata     `json:"metadata"`
+	Components   []Component  `json:"components"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// Metadata describes how the BOM was made.
+type Metadata struct {
+	Timestamp  time.Time  `json:"timestamp"`
+	Tools      Tools      `json:"tools"`
+	Properties []Property `json:"properties,omitempty"`
+}
+
+// Tools lists the tools that made the BOM.
+type Tools struct {
+	Components []Component `json:"components"`
+}
+
+// Component is a service or an artifact it runs.
+type Component struct {
+	Type        string     `json:"type"`
+	BOMRef      string     `json:"bom-ref,omitempty"`
+	Name        string     `json:"name"`
+	Version     string     `json:"version,omitempty"`
+	Description string     `json:"description,omitempty"`
+	PURL        string     `json:"purl,omitempty"`
+	Hashes      []Hash     `json:"hashes,omitempty"`
+	Properties  []Property `json:"properties,omitempty"`
+}
+
+// Hash is a digest of a component.
+type Hash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+// Property is a name-value pair. Names discovery sets start with
+// "discovery:".
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Dependency lists the components Ref depends on.
+type Dependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// New returns the BOM of services, recorded by the snapshot with id at
+// timestamp.
+func New(services []discovery.Service, id string, timestamp time.Time) *BOM {
+	b := &BOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  SpecVersion,
+		SerialNumber: serialNumber(),
+		Version:      1,
+		Metadata: Metadata{
+			Timestamp: timestamp.UTC(),
+			Tools: Tools{Components: []Component{{
+				Type: "application",
+				Name: "discovery",
+			}}},
+			Properties: []Property{{Name: "discovery:snapshot", Value: id}},
+		},
+		Components:   []Component{},
+		Dependencies: []Dependency{},
+	}
+	artifacts := map[string]bool{}
+	for _, s := range services {
+		c := Component{
+			Type:       "application",
+			BOMRef:     s.Key(),
+			Name:       s.Name,
+			Properties: serviceProperties(s),
+		}
+		var deps []Component
+		if l := s.Details.Lambda; l != nil {
+			c.Description = l.Description
+			if l.Code.SHA256 != "" && l.Code.ImageURI == "" {
+				deps = append(deps, packageComponent(s, l.Code))
+			}
+			if image, ok := imageComponent(l.Code); ok {
+				deps = append(deps, image)
+			}
+			for _, layer := range l.Layers {
+				deps = append(deps, layerComponent(layer))
+			}
+		}
+		b.Components = append(b.Components, c)
+		dep := Dependency{Ref: c.BOMRef, DependsOn: []string{}}
+		for _, d := range deps {
+			dep.DependsOn = append(dep.DependsOn, d.BOMRef)
+			if !artifacts[d.BOMRef] {
+				artifacts[d.BOMRef] = true
+				b.Components = append(b.Components, d)
+				b.Dependencies = append(b.Dependencies, Dependency{Ref: d.BOMRef, DependsOn: []string{}})
+			}
+		}
+		b.Dependencies = append(b.Dependencies, dep)
+	}
+	sort.SliceStable(b.Dependencies, func(i, j int) bool { return b.Dependencies[i].Ref < b.Dependencies[j].Ref })
+	return b
+}
+
+// Write writes b as indented JSON.
+func Write(w io.Writer, b *BOM) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+func serviceProperties(s discovery.Service) []Property {
+	props := []Property{{Name: "discovery:resourceType", Value: string(s.ResourceType)}}
+	add := func(name, value string) {
+		if value != "" {
+			props = append(props, Property{Name: "discovery:" + name, Value: value})
+		}
+	}
+	add("arn", s.ARN)
+	add("provider", s.Provider)
+	add("accountId", s.AccountID)
+	add("region", s.Region)
+	if l := s.Details.Lambda; l != nil {
+		add("runtime", l.Runtime)
+		add("packageType", l.PackageType)
+		add("architecture", l.Architecture)
+	}
+	keys := make([]string, 0, len(s.Tags))
+	for k := range s.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		add("tag:"+k, s.Tags[k])
+	}
+	return props
+}
+
+// packageComponent is a function's zip deployment package, identified by
+// its hash since the download location expires.
+func packageComponent(s discovery.Service, code discovery.LambdaCode) Component {
+	c := Component{
+		Type:   "file",
+		BOMRef: "lambda-package:" + code.SHA256,
+		Name:   s.Name + ".zip",
+	}
+	if sum, err := base64.StdEncoding.DecodeString(code.SHA256); err == nil {
+		c.Hashes = []Hash{{Alg: "SHA-256", Content: hex.EncodeToString(sum)}}
+	}
+	if code.Size > 0 {
+		c.Properties = []Property{{Name: "discovery:size", Value: fmt.Sprint(code.Size)}}
+	}
+	return c
+}
+
+// imageComponent is a function's container image, with an OCI package URL
+// when the deployed digest is known, e.g.
+// pkg:oci/app@sha256%3Aabc?repository_url=123456789012.dkr.ecr.us-east-1.amazonaws.com/team/app.
+func imageComponent(code discovery.LambdaCode) (Component, bool) {
+	uri := code.ImageURI
+	if uri == "" {
+		return Component{}, false
+	}
+	repo, version := uri, ""
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo, version = repo[:i], repo[i+1:]
+	} else if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo, version = repo[:i], repo[i+1:]
+	}
+	digest := ""
+	if i := strings.Index(code.ResolvedImageURI, "@"); i >= 0 {
+		digest = code.ResolvedImageURI[i+1:]
+	} else if strings.HasPrefix(version, "sha256:") {
+		digest = version
+	}
+	c := Component{
+		Type:    "container",
+		BOMRef:  uri,
+		Name:    repo,
+		Version: version,
+	}
+	if digest != "" {
+		c.BOMRef = repo + "@" + digest
+		name := strings.ToLower(repo[strings.LastIndex(repo, "/")+1:])
+		c.PURL = "pkg:oci/" + name + "@" + strings.ReplaceAll(digest, ":", "%3A") + "?repository_url=" + url.QueryEscape(repo)
+		if alg, sum, ok := strings.Cut(digest, ":"); ok && alg == "sha256" {
+			c.Hashes = []Hash{{Alg: "SHA-256", Content: sum}}
+		}
+	}
+	return c, true
+}
+
+// layerComponent is a Lambda layer version, e.g.
+// arn:aws:lambda:us-east-1:123456789012:layer:shared:3.
+func layerComponent(l discovery.LambdaLayer) Component {
+	c := Component{Type: "library", BOMRef: l.ARN, Name: l.ARN}
+	parts := strings.Split(l.ARN, ":")
+	if len(parts) == 8 && parts[5] == "layer" {
+		c.Name, c.Version = parts[6], parts[7]
+	}
+	c.Properties = []Property{{Name: "discovery:arn", Value: l.ARN}}
+	if l.CodeSize > 0 {
+		c.Properties = append(c.Properties, Property{Name: "discovery:size", Value: fmt.Sprint(l.CodeSize)})
+	}
+	return c
+}
+
+// serialNumber returns a random (version 4) UUID URN.
+func serialNumber() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
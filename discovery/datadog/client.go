@@ -0,0 +1,196 @@
+package datadog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DefaultSite is the Datadog site used when none is configured.
+const DefaultSite = "datadoghq.com"
+
+// maxRetries bounds the retries of rate-limited requests.
+const maxRetries = 5
+
+// Client calls the Service Definition API.
+type Client struct {
+	// Site is the Datadog site, e.g. "datadoghq.eu"; it defaults to
+	// DefaultSite.
+	Site string
+	// Endpoint, if set, replaces https://api.<site>, e.g. for a proxy.
+	Endpoint string
+	APIKey   string
+	AppKey   string
+	HTTP     *http.Client
+}
+
+// Validate reports whether the client has both keys.
+func (c *Client) Validate() error {
+	if c.APIKey == "" || c.AppKey == "" {
+		return errors.New("datadog needs an API key and an application key (DD_API_KEY, DD_APP_KEY)")
+	}
+	return nil
+}
+
+// Upsert creates or replaces the definition of d.Service.
+func (c *Client) Upsert(ctx context.Context, d Definition) error {
+	body, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v2/services/definitions", body, nil); err != nil {
+		return fmt.Errorf("writing %s: %w", d.Service, err)
+	}
+	return nil
+}
+
+// Delete removes the definition of service.
+func (c *Client) Delete(ctx context.Context, service string) error {
+	if err := c.do(ctx, http.MethodDelete, "/api/v2/services/definitions/"+url.PathEscape(service), nil, nil); err != nil {
+		return fmt.Errorf("deleting %s: %w", service, err)
+	}
+	return nil
+}
+
+// Managed returns the names of the services whose definitions carry
+// ManagedTag.
+func (c *Client) Managed(ctx context.Context) ([]string, error) {
+	const pageSize = 100
+	var names []string
+	for page := 0; ; page++ {
+		var out struct {
+			Data []struct {
+				Attributes struct {
+					Schema struct {
+						Service string   `json:"dd-service"`
+						Tags    []string `json:"tags"`
+					} `json:"schema"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
+		path := fmt.Sprintf("/api/v2/services/definitions?page[size]=%d&page[number]=%d", pageSize, page)
+		if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+			return nil, fmt.Errorf("listing service definitions: %w", err)
+		}
+		for _, d := range out.Data {
+			if slices.Contains(d.Attributes.Schema.Tags, ManagedTag) {
+				names = append(names, d.Attributes.Schema.Service)
+			}
+		}
+		if len(out.Data) < pageSize {
+			return names, nil
+		}
+	}
+}
+
+// do sends a request, waiting out rate limits, and decodes the response
+// into out if it is set.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out any) error {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		site := c.Site
+		if site == "" {
+			site = DefaultSite
+		}
+		endpoint = "https://api." + site
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("DD-API-KEY", c.APIKey)
+		req.Header.Set("DD-APPLICATION-KEY", c.AppKey)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			// X-RateLimit-Reset is the number of seconds until the limit resets.
+			wait := time.Second << attempt
+			if s, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Reset")); err == nil && s > 0 {
+				wait = time.Duration(s) * time.Second
+			}
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if resp.StatusCode/100 != 2 {
+			return apiError(resp.Status, data)
+		}
+		if out == nil || len(data) == 0 {
+			return nil
+		}
+		return json.Unmarshal(data, out)
+	}
+}
+
+// apiError returns the messages of a Datadog error response.
+func apiError(status string, body []byte) error {
+	var e struct {
+		Errors []any `json:"errors"`
+	}
+	if json.Unmarshal(body, &e) == nil && len(e.Errors) > 0 {
+		return fmt.Errorf("datadog responded %s: %v", status, e.Errors)
+	}
+	return fmt.Errorf("datadog responded %s", status)
+}
+
+// Sync writes defs and, with prune, deletes the managed definitions of
+// services no longer among them. A definition that fails to write does not
+// stop the rest; the errors are joined.
+func (c *Client) Sync(ctx context.Context, defs []Definition, prune bool) (written int, deleted []string, err error) {
+	var errs []error
+	keep := make(map[string]bool, len(defs))
+	for _, d := range defs {
+		keep[d.Service] = true
+		if err := c.Upsert(ctx, d); err != nil {
+			if ctx.Err() != nil {
+				return written, nil, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		written++
+	}
+	if prune {
+		managed, err := c.Managed(ctx)
+		if err != nil {
+			return written, nil, errors.Join(append(errs, err)...)
+		}
+		for _, name := range managed {
+			if keep[name] {
+				continue
+			}
+			if err := c.Delete(ctx, name); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			deleted = append(deleted, name)
+		}
+	}
+	return written, deleted, errors.Join(errs...)
+}
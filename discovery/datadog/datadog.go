@@ -0,0 +1,152 @@
+// Package datadog turns discovered services into Datadog Service Catalog
+// definitions (schema v2.2) and keeps the catalog in sync through the
+// Service Definition API.
+package datadog
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// SchemaVersion is the service definition schema written.
+const SchemaVersion = "v2.2"
+
+// ManagedTag marks the definitions written by discovery, so pruning leaves
+// hand-written ones alone.
+const ManagedTag = "managed-by:discovery"
+
+// Options control how definitions are filled in.
+type Options struct {
+	// TeamTags are the tag keys tried, in order, for the team, e.g. "team"
+	// and "owner".
+	TeamTags []string
+	// DefaultTeam is the team of services without a team tag; empty leaves
+	// it unset.
+	DefaultTeam string
+}
+
+// Definition is a Datadog service definition.
+type Definition struct {
+	SchemaVersion string   `json:"schema-version"`
+	Service       string   `json:"dd-service"`
+	Team          string   `json:"team,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Application   string   `json:"application,omitempty"`
+	Tier          string   `json:"tier,omitempty"`
+	Lifecycle     string   `json:"lifecycle,omitempty"`
+	Type          string   `json:"type,omitempty"`
+	Languages     []string `json:"languages,omitempty"`
+	Links         []Link   `json:"links,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// Link is a link shown on a service's catalog page.
+type Link struct {
+	Name string `json:"name"`
+	// Type is one of Datadog's link types, e.g. "dashboard" or "other".
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// Definitions returns a definition for every Lambda function in services,
+// sorted by service name. Names are the function names, qualified with the
+// region and then the account where they would collide.
+func Definitions(services []discovery.Service, opts Options) []Definition {
+	var functions []discovery.Service
+	for _, s := range services {
+		if s.ResourceType == discovery.ResourceTypeLambdaFunction {
+			functions = append(functions, s)
+		}
+	}
+	names := discovery.UniqueNames(functions, serviceName)
+	defs := make([]Definition, len(functions))
+	for i, s := range functions {
+		d := Definition{
+			SchemaVersion: SchemaVersion,
+			Service:       names[i],
+			Team:          team(s.Tags, opts),
+			Application:   s.Tags["application"],
+			Tier:          s.Tags["tier"],
+			Lifecycle:     s.Tags["lifecycle"],
+			Type:          "function",
+			Links:         consoleLinks(s),
+			Tags: []string{
+				ManagedTag,
+				"functionname:" + strings.ToLower(s.Name),
+				"aws_account:" + s.AccountID,
+				"region:" + s.Region,
+			},
+		}
+		if l := s.Details.Lambda; l != nil {
+			d.Description = l.Description
+			if lang := language(l.Runtime); lang != "" {
+				d.Languages = []string{lang}
+			}
+		}
+		if env := s.Tags["env"]; env != "" {
+			d.Tags = append(d.Tags, "env:"+env)
+		}
+		defs[i] = d
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Service < defs[j].Service })
+	return defs
+}
+
+func team(tags map[string]string, opts Options) string {
+	for _, k := range opts.TeamTags {
+		if v := tags[k]; v != "" {
+			return v
+		}
+	}
+	return opts.DefaultTeam
+}
+
+// runtimeLanguages maps Lambda runtime prefixes to Datadog languages.
+var runtimeLanguages = []struct{ prefix, language string }{
+	{"python", "python"},
+	{"nodejs", "js"},
+	{"java", "java"},
+	{"dotnet", "dotnet"},
+	{"go", "go"},
+	{"ruby", "ruby"},
+}
+
+func language(runtime string) string {
+	for _, r := range runtimeLanguages {
+		if strings.HasPrefix(runtime, r.prefix) {
+			return r.language
+		}
+	}
+	return ""
+}
+
+// consoleLinks links a function's AWS console and CloudWatch Logs pages.
+func consoleLinks(s discovery.Service) []Link {
+	if s.Region == "" || s.Name == "" {
+		return nil
+	}
+	console := "https://" + s.Region + ".console.aws.amazon.com"
+	query := "?region=" + s.Region
+	// The logs console escapes the log group name twice, with "$" for "%".
+	group := strings.ReplaceAll(url.QueryEscape("/aws/lambda/"+s.Name), "%", "$25")
+	return []Link{
+		{Name: "AWS Console", Type: "other", URL: console + "/lambda/home" + query + "#/functions/" + url.PathEscape(s.Name)},
+		{Name: "CloudWatch Logs", Type: "dashboard", URL: console + "/cloudwatch/home" + query + "#logsV2:log-groups/log-group/" + group},
+	}
+}
+
+var invalidName = regexp.MustCompile(`[^a-z0-9._:/-]+`)
+
+// serviceName makes s a valid dd-service: lower case, starting with a
+// letter, from [a-z0-9._:/-].
+func serviceName(s string) string {
+	s = strings.Trim(invalidName.ReplaceAllString(strings.ToLower(s), "-"), "._:/-")
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		s = "fn-" + s
+	}
+	return strings.TrimRight(s, "-")
+}
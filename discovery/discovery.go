@@ -0,0 +1,385 @@
+// Package discovery finds the services running in cloud accounts.
+//
+// A Provider connects to a platform such as AWS and hands out Catalogers, one
+// per resource type, which report what they find. Discover drives them over
+// the requested regions. Results can be consumed as an iterator, on a channel
+// (Stream) or by a ResultHandler (Run):
+//
+//	provider := &awscmd.Provider{RoleARN: roleARN, IDToken: token}
+//	for svc, err := range discovery.Discover(ctx, discovery.Options{
+//		Providers: []discovery.Provider{provider},
+//		Regions:   []string{"us-east-1"},
+//	}) {
+//		if err != nil {
+//			log.Print(err)
+//			continue
+//		}
+//		fmt.Println(svc.Name)
+//	}
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Provider is a cloud platform that can be scanned. Catalogers is called
+// concurrently for different regions.
+type Provider interface {
+	// Name identifies the provider, e.g. "aws".
+	Name() string
+	// Catalogers authenticates against region and returns the catalogers
+	// that scan it.
+	Catalogers(ctx context.Context, region string) ([]Cataloger, error)
+}
+
+// AccountScoped is implemented by providers that scan a single account, so
+// their errors and cached results are attributed to it.
+type AccountScoped interface {
+	AccountID() string
+}
+
+// Cataloger discovers one kind of resource within a single region.
+type Cataloger interface {
+	// Name identifies the resource type, e.g. "lambda".
+	Name() string
+	// Catalog calls emit for every resource found, and with a SkipResource
+	// result for each resource it could not describe. It stops and returns
+	// the error if emit fails. A returned error fails the whole cataloger.
+	Catalog(ctx context.Context, emit func(Result) error) error
+}
+
+// Options control a discovery run.
+type Options struct {
+	Providers []Provider
+	Regions   []string
+
+	// Parallelism is the number of regions scanned concurrently; values
+	// below 1 scan one region at a time.
+	Parallelism int
+	// AccountParallelism, when positive, caps the number of accounts
+	// scanned concurrently, so each of them sees no more than Parallelism
+	// regions' worth of requests at a time alongside the others. Providers
+	// that are not AccountScoped are not counted; those of one account
+	// should be consecutive in Providers.
+	AccountParallelism int
+	// RetryAccounts, when set, scans the regions of accounts that could
+	// not be accessed (see AccountError) once more after every other
+	// region has been scanned. Their errors are yielded only if the retry
+	// fails too.
+	RetryAccounts bool
+
+	// Buffer is the capacity of the channel returned by Stream.
+	Buffer int
+
+	// ProviderDone, if set, is called once every region of a provider has
+	// been scanned, after the provider's last result has been yielded. It is
+	// called on the goroutine consuming the results, and not for providers
+	// left unfinished when the run is cancelled.
+	ProviderDone func(Provider)
+}
+
+// ScanError reports a failure to scan part of the requested scope. Discovery
+// moves on to the next region or cataloger after one.
+type ScanError struct {
+	Provider string
+	// Account is the account of providers that are AccountScoped.
+	Account   string
+	Region    string
+	Cataloger string // empty when the region could not be scanned at all
+	Resource  string // set when only this resource was skipped
+	// Detail is set when resources were reported without an optional
+	// detail, e.g. "lambda:GetFunction", that could not be fetched.
+	Detail string
+	Err    error
+}
+
+func (e *ScanError) Error() string {
+	scope := e.Provider
+	if e.Account != "" {
+		scope += " " + e.Account
+	}
+	scope += " " + e.Region
+	if e.Cataloger != "" {
+		scope += " " + e.Cataloger
+	}
+	if e.Resource != "" {
+		scope += " " + e.Resource
+	}
+	if e.Detail != "" {
+		scope += " " + e.Detail
+	}
+	return fmt.Sprintf("%s: %v", scope, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// AccountError reports that the account of an AccountScoped provider could
+// not be accessed at all, e.g. because its role could not be assumed.
+// Providers return it from Catalogers; the run carries on with the other
+// accounts and reports the account as unreachable.
+type AccountError struct {
+	Account string
+	Err     error
+}
+
+func (e *AccountError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AccountError) Unwrap() error {
+	return e.Err
+}
+
+// SkipResource returns the result a cataloger emits when it cannot describe
+// one resource but can carry on with the rest.
+func SkipResource(resource string, err error) Result {
+	return Result{Err: &ScanError{Resource: resource, Err: err}}
+}
+
+// SkipDetail returns the result a Cataloger emits, once, when it omits an
+// optional detail from every resource it reports, typically because the role
+// lacks permission for that API. The resources themselves are still emitted.
+func SkipDetail(detail string, err error) Result {
+	return Result{Err: &ScanError{Detail: detail, Err: err}}
+}
+
+// errStopped unwinds a cataloger when the consumer stops iterating.
+var errStopped = errors.New("discovery: iteration stopped")
+
+// Discover scans every region of every provider in opts and yields each
+// service found. Up to opts.Parallelism regions, of up to
+// opts.AccountParallelism accounts, are scanned at once, so results from
+// different regions interleave. Failures scoped to a region or
+// cataloger are yielded as *ScanError values and the scan continues; once ctx
+// is done its error is yielded and iteration ends.
+func Discover(ctx context.Context, opts Options) iter.Seq2[Service, error] {
+	return func(yield func(Service, error) bool) {
+		scanCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		parallelism := opts.Parallelism
+		if parallelism < 1 {
+			parallelism = 1
+		}
+
+		// Each region scan ends with a done event so the consumer can tell
+		// when a provider has nothing more to yield.
+		type event struct {
+			res  Result
+			done int // index of the provider whose region finished, or -1
+		}
+		results := make(chan event)
+		post := func(e event) bool {
+			select {
+			case results <- e:
+				return true
+			case <-scanCtx.Done():
+				return false
+			}
+		}
+		send := func(r Result) bool {
+			return post(event{res: r, done: -1})
+		}
+		remaining := make([]int, len(opts.Providers))
+		for i := range remaining {
+			remaining[i] = len(opts.Regions)
+		}
+
+		go func() {
+			defer close(results)
+			var wg sync.WaitGroup
+			sem := make(chan struct{}, parallelism)
+			accounts := newAccountSlots(opts.AccountParallelism)
+			var retryMu sync.Mutex
+			retries := map[int][]string{}
+			// scan starts scanning regions of provider i, setting aside
+			// those whose account cannot be accessed when retry is set. It
+			// reports false if ctx is done before all are started.
+			scan := func(i int, regions []string, retry bool) bool {
+				p := opts.Providers[i]
+				account := accountOf(p)
+				if !accounts.acquire(scanCtx, account, len(regions)) {
+					return false
+				}
+				for n, region := range regions {
+					select {
+					case sem <- struct{}{}:
+					case <-scanCtx.Done():
+						// The regions left will not release the account.
+						accounts.release(account, len(regions)-n)
+						return false
+					}
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						defer func() { <-sem }()
+						defer accounts.release(account, 1)
+						if scanRegion(scanCtx, p, region, send, retry) {
+							retryMu.Lock()
+							retries[i] = append(retries[i], region)
+							retryMu.Unlock()
+							return
+						}
+						post(event{done: i})
+					}()
+				}
+				return true
+			}
+			for i := range opts.Providers {
+				if !scan(i, opts.Regions, opts.RetryAccounts) {
+					break
+				}
+			}
+			wg.Wait()
+			// Accounts that could not be accessed get one more try, once
+			// the others are done.
+			for _, i := range slices.Sorted(maps.Keys(retries)) {
+				if !scan(i, retries[i], false) {
+					break
+				}
+			}
+			wg.Wait()
+		}()
+
+		for e := range results {
+			if e.done >= 0 {
+				remaining[e.done]--
+				if remaining[e.done] == 0 && opts.ProviderDone != nil && scanCtx.Err() == nil {
+					opts.ProviderDone(opts.Providers[e.done])
+				}
+				continue
+			}
+			if !yield(e.res.Service, e.res.Err) {
+				cancel()
+				// Let in-flight scans observe the cancellation and exit
+				// before returning.
+				for range results {
+				}
+				return
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			yield(Service{}, err)
+		}
+	}
+}
+
+// accountSlots caps how many accounts are scanned at once. An account holds
+// a slot while any of its regions is still to be scanned.
+type accountSlots struct {
+	sem chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]int
+}
+
+// newAccountSlots returns slots for n accounts, or nil, which never waits,
+// when n is below 1.
+func newAccountSlots(n int) *accountSlots {
+	if n < 1 {
+		return nil
+	}
+	return &accountSlots{sem: make(chan struct{}, n), pending: map[string]int{}}
+}
+
+// acquire adds regions scans to account, first waiting for a slot if it
+// holds none. It reports false if ctx is done first. Providers without an
+// account are not limited.
+func (s *accountSlots) acquire(ctx context.Context, account string, regions int) bool {
+	if s == nil || account == "" || regions == 0 {
+		return true
+	}
+	s.mu.Lock()
+	held := s.pending[account] > 0
+	if held {
+		s.pending[account] += regions
+	}
+	s.mu.Unlock()
+	if held {
+		return true
+	}
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	s.mu.Lock()
+	s.pending[account] += regions
+	s.mu.Unlock()
+	return true
+}
+
+// release records that regions scans of account are done, freeing its slot
+// after the last.
+func (s *accountSlots) release(account string, regions int) {
+	if s == nil || account == "" || regions == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[account] -= regions
+	if s.pending[account] == 0 {
+		delete(s.pending, account)
+		<-s.sem
+	}
+}
+
+// accountOf returns the account p scans, if it is AccountScoped.
+func accountOf(p Provider) string {
+	if scoped, ok := p.(AccountScoped); ok {
+		return scoped.AccountID()
+	}
+	return ""
+}
+
+// scanRegion runs every cataloger p has for region, passing results to send
+// until send reports that the consumer has gone away. With retry, it reports
+// true instead of sending the error when p's account cannot be accessed.
+func scanRegion(ctx context.Context, p Provider, region string, send func(Result) bool, retry bool) bool {
+	account := accountOf(p)
+	catalogers, err := p.Catalogers(ctx, region)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		var accountErr *AccountError
+		if retry && errors.As(err, &accountErr) {
+			return true
+		}
+		send(Result{Err: &ScanError{Provider: p.Name(), Account: account, Region: region, Err: err}})
+		return false
+	}
+
+	for _, c := range catalogers {
+		err := c.Catalog(ctx, func(r Result) error {
+			var scanErr *ScanError
+			if errors.As(r.Err, &scanErr) {
+				scanErr.Provider = p.Name()
+				scanErr.Account = account
+				scanErr.Region = region
+				scanErr.Cataloger = c.Name()
+			}
+			if !send(r) {
+				return errStopped
+			}
+			return nil
+		})
+		if errors.Is(err, errStopped) || ctx.Err() != nil {
+			return false
+		}
+		if err != nil {
+			if !send(Result{Err: &ScanError{Provider: p.Name(), Account: account, Region: region, Cataloger: c.Name(), Err: err}}) {
+				return false
+			}
+		}
+	}
+	return false
+}
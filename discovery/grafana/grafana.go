@@ -0,0 +1,262 @@
+// Package grafana generates a baseline Grafana dashboard for every
+// discovered Lambda function, with CloudWatch panels for its invocations,
+// errors, throttles, duration and concurrency.
+package grafana
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// SchemaVersion is the Grafana dashboard schema written.
+const SchemaVersion = 39
+
+// Tag is set on every generated dashboard.
+const Tag = "discovery"
+
+// Options control how dashboards are generated.
+type Options struct {
+	// Datasource is the UID of the CloudWatch data source; empty uses
+	// Grafana's default data source.
+	Datasource string
+	// AccountDatasources maps account IDs to the UID of the CloudWatch data
+	// source of that account, for inventories spanning accounts.
+	AccountDatasources map[string]string
+	// TeamTags are the tag keys tried, in order, for a team tag on the
+	// dashboard, e.g. "team" and "owner".
+	TeamTags []string
+}
+
+// Dashboard is a Grafana dashboard, as imported or provisioned.
+type Dashboard struct {
+	UID           string      `json:"uid"`
+	Title         string      `json:"title"`
+	Description   string      `json:"description,omitempty"`
+	Tags          []string    `json:"tags"`
+	Timezone      string      `json:"timezone"`
+	SchemaVersion int         `json:"schemaVersion"`
+	Editable      bool        `json:"editable"`
+	Refresh       string      `json:"refresh"`
+	Time          timeRange   `json:"time"`
+	Links         []link      `json:"links,omitempty"`
+	Panels        []panel     `json:"panels"`
+	Templating    templating  `json:"templating"`
+	Annotations   annotations `json:"annotations"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// link is a link in the dashboard header.
+type link struct {
+	Title       string `json:"title"`
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	TargetBlank bool   `json:"targetBlank"`
+}
+
+type templating struct {
+	List []any `json:"list"`
+}
+
+type annotations struct {
+	List []any `json:"list"`
+}
+
+// panel is a time series panel.
+type panel struct {
+	ID          int          `json:"id"`
+	Type        string       `json:"type"`
+	Title       string       `json:"title"`
+	GridPos     gridPos      `json:"gridPos"`
+	Datasource  *datasource  `json:"datasource,omitempty"`
+	Targets     []target     `json:"targets"`
+	FieldConfig fieldConfig  `json:"fieldConfig"`
+	Options     panelOptions `json:"options"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid,omitempty"`
+}
+
+// target is a CloudWatch metric query.
+type target struct {
+	RefID           string            `json:"refId"`
+	Datasource      *datasource       `json:"datasource,omitempty"`
+	QueryMode       string            `json:"queryMode"`
+	MetricQueryType int               `json:"metricQueryType"`
+	MetricEditMode  int               `json:"metricEditorMode"`
+	Region          string            `json:"region"`
+	Namespace       string            `json:"namespace"`
+	MetricName      string            `json:"metricName"`
+	Dimensions      map[string]string `json:"dimensions"`
+	Statistic       string            `json:"statistic"`
+	MatchExact      bool              `json:"matchExact"`
+	Label           string            `json:"label,omitempty"`
+}
+
+type fieldConfig struct {
+	Defaults  fieldDefaults `json:"defaults"`
+	Overrides []any         `json:"overrides"`
+}
+
+type fieldDefaults struct {
+	Unit string `json:"unit"`
+}
+
+type panelOptions struct {
+	Legend  legend  `json:"legend"`
+	Tooltip tooltip `json:"tooltip"`
+}
+
+type legend struct {
+	DisplayMode string `json:"displayMode"`
+	Placement   string `json:"placement"`
+	ShowLegend  bool   `json:"showLegend"`
+}
+
+type tooltip struct {
+	Mode string `json:"mode"`
+}
+
+// metric is a panel's CloudWatch metric and the statistics it shows.
+type metric struct {
+	title      string
+	name       string
+	statistics []string
+	unit       string
+}
+
+// lambdaMetrics are the panels of a function dashboard, two per row.
+var lambdaMetrics = []metric{
+	{"Invocations", "Invocations", []string{"Sum"}, "short"},
+	{"Errors", "Errors", []string{"Sum"}, "short"},
+	{"Duration", "Duration", []string{"Average", "p95", "Maximum"}, "ms"},
+	{"Throttles", "Throttles", []string{"Sum"}, "short"},
+	{"Concurrent executions", "ConcurrentExecutions", []string{"Maximum"}, "short"},
+}
+
+// Dashboards returns a dashboard for every Lambda function in services.
+func Dashboards(services []discovery.Service, opts Options) []Dashboard {
+	var dashboards []Dashboard
+	for _, s := range services {
+		if s.ResourceType != discovery.ResourceTypeLambdaFunction || s.Name == "" || s.Region == "" {
+			continue
+		}
+		dashboards = append(dashboards, LambdaDashboard(s, opts))
+	}
+	return dashboards
+}
+
+// LambdaDashboard returns the dashboard of function s. Its UID is derived
+// from the function's key, so regenerating the dashboard replaces it.
+func LambdaDashboard(s discovery.Service, opts Options) Dashboard {
+	ds := &datasource{Type: "cloudwatch", UID: opts.Datasource}
+	if uid := opts.AccountDatasources[s.AccountID]; uid != "" {
+		ds.UID = uid
+	}
+	if ds.UID == "" {
+		ds = nil
+	}
+
+	d := Dashboard{
+		UID:           UID(s),
+		Title:         fmt.Sprintf("Lambda: %s (%s)", s.Name, s.Region),
+		Tags:          []string{Tag, "lambda", s.Region},
+		Timezone:      "browser",
+		SchemaVersion: SchemaVersion,
+		Editable:      true,
+		Refresh:       "5m",
+		Time:          timeRange{From: "now-24h", To: "now"},
+		Templating:    templating{List: []any{}},
+		Annotations:   annotations{List: []any{}},
+		Links: []link{{
+			Title:       "AWS Console",
+			Type:        "link",
+			URL:         "https://" + s.Region + ".console.aws.amazon.com/lambda/home?region=" + s.Region + "#/functions/" + url.PathEscape(s.Name),
+			TargetBlank: true,
+		}},
+	}
+	if s.AccountID != "" {
+		d.Tags = append(d.Tags, s.AccountID)
+	}
+	for _, k := range opts.TeamTags {
+		if v := s.Tags[k]; v != "" {
+			d.Tags = append(d.Tags, "team:"+v)
+			break
+		}
+	}
+	if l := s.Details.Lambda; l != nil {
+		d.Description = l.Description
+	}
+
+	for i, m := range lambdaMetrics {
+		p := panel{
+			ID:          i + 1,
+			Type:        "timeseries",
+			Title:       m.title,
+			GridPos:     gridPos{H: 8, W: 12, X: (i % 2) * 12, Y: (i / 2) * 8},
+			Datasource:  ds,
+			Targets:     []target{},
+			FieldConfig: fieldConfig{Defaults: fieldDefaults{Unit: m.unit}, Overrides: []any{}},
+			Options: panelOptions{
+				Legend:  legend{DisplayMode: "list", Placement: "bottom", ShowLegend: len(m.statistics) > 1},
+				Tooltip: tooltip{Mode: "multi"},
+			},
+		}
+		for j, stat := range m.statistics {
+			p.Targets = append(p.Targets, target{
+				RefID:      string(rune('A' + j)),
+				Datasource: ds,
+				QueryMode:  "Metrics",
+				Region:     s.Region,
+				Namespace:  "AWS/Lambda",
+				MetricName: m.name,
+				Dimensions: map[string]string{"FunctionName": s.Name},
+				Statistic:  stat,
+				MatchExact: true,
+				Label:      stat,
+			})
+		}
+		d.Panels = append(d.Panels, p)
+	}
+	return d
+}
+
+var invalidUID = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// UID returns the dashboard UID of s: a readable prefix of its name and a
+// hash of its key, within Grafana's 40 characters.
+func UID(s discovery.Service) string {
+	sum := sha256.Sum256([]byte(s.Key()))
+	name := strings.Trim(invalidUID.ReplaceAllString(s.Name, "-"), "-")
+	if len(name) > 27 {
+		name = name[:27]
+	}
+	return name + "-" + hex.EncodeToString(sum[:6])
+}
+
+// Write writes d to w as indented JSON.
+func Write(w io.Writer, d any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
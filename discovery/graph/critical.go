@@ -0,0 +1,134 @@
+package graph
+
+import "sort"
+
+// Critical is a node whose failure would cut off much of the graph or many
+// of its dependents.
+type Critical struct {
+	Node Node `json:"node"`
+	// Articulation is set when removing the node would split the part of
+	// the graph it is in, its edges taken in either direction.
+	Articulation bool `json:"articulation"`
+	// Partitioned is the number of nodes removing this one would cut off
+	// from the largest part left of those it was connected to.
+	Partitioned int `json:"partitioned"`
+	// Dependents is the number of discovered resources depending on the
+	// node, directly or not.
+	Dependents int `json:"dependents"`
+	// FanIn is the number of resources depending on the node directly.
+	FanIn int `json:"fanIn"`
+}
+
+// Critical returns the articulation points of g and the nodes with more
+// than one direct dependent, ranked by the nodes their failure would cut
+// off, then their dependents and then their fan-in.
+func (g *Graph) Critical() []Critical {
+	partitioned := g.partitions()
+	fanIn := map[string]map[string]bool{}
+	for _, e := range g.Edges {
+		if e.From == e.To {
+			continue
+		}
+		if fanIn[e.To] == nil {
+			fanIn[e.To] = map[string]bool{}
+		}
+		fanIn[e.To][e.From] = true
+	}
+
+	var critical []Critical
+	for _, n := range g.Nodes {
+		cut, articulation := partitioned[n.ID]
+		if !articulation && len(fanIn[n.ID]) < 2 {
+			continue
+		}
+		c := Critical{Node: n, Articulation: articulation, Partitioned: cut, FanIn: len(fanIn[n.ID])}
+		for _, r := range g.Reachable(n.ID, Upstream, 0) {
+			if !r.Node.External {
+				c.Dependents++
+			}
+		}
+		critical = append(critical, c)
+	}
+	sort.SliceStable(critical, func(i, j int) bool {
+		a, b := critical[i], critical[j]
+		switch {
+		case a.Partitioned != b.Partitioned:
+			return a.Partitioned > b.Partitioned
+		case a.Dependents != b.Dependents:
+			return a.Dependents > b.Dependents
+		}
+		return a.FanIn > b.FanIn
+	})
+	return critical
+}
+
+// partitions returns the articulation points of g, taken as undirected,
+// with the number of nodes removing each would cut off from the largest
+// part left of its component, found by Tarjan's depth-first search.
+func (g *Graph) partitions() map[string]int {
+	adjacent := make([][]int, len(g.Nodes))
+	for _, e := range g.Edges {
+		from, to := g.nodes[e.From], g.nodes[e.To]
+		if from != to {
+			adjacent[from] = append(adjacent[from], to)
+			adjacent[to] = append(adjacent[to], from)
+		}
+	}
+
+	discovered := make([]int, len(g.Nodes))
+	low := make([]int, len(g.Nodes))
+	size := make([]int, len(g.Nodes))
+	// pieces holds, per node, the sizes of the subtrees removing it would
+	// separate from its parent.
+	pieces := make([][]int, len(g.Nodes))
+	clock := 0
+	var visit func(v, parent int)
+	visit = func(v, parent int) {
+		clock++
+		discovered[v], low[v], size[v] = clock, clock, 1
+		for _, w := range adjacent[v] {
+			switch {
+			case discovered[w] == 0:
+				visit(w, v)
+				size[v] += size[w]
+				low[v] = min(low[v], low[w])
+				if low[w] >= discovered[v] {
+					pieces[v] = append(pieces[v], size[w])
+				}
+			case w != parent:
+				low[v] = min(low[v], discovered[w])
+			}
+		}
+	}
+
+	cut := map[string]int{}
+	for root := range g.Nodes {
+		if discovered[root] != 0 {
+			continue
+		}
+		visit(root, -1)
+		component := size[root]
+		for v := range g.Nodes {
+			if discovered[v] < discovered[root] || discovered[v] >= discovered[root]+component {
+				continue
+			}
+			parts := pieces[v]
+			rest := component - 1
+			for _, p := range parts {
+				rest -= p
+			}
+			if rest > 0 {
+				parts = append(parts, rest)
+			}
+			if len(parts) < 2 {
+				continue
+			}
+			largest := 0
+			for _, p := range parts {
+				largest = max(largest, p)
+			}
+			cut[g.Nodes[v].ID] = component - 1 - largest
+		}
+	}
+	return cut
+}
@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCritical(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges string
+		// want are the critical nodes in order, as their ID, whether they
+		// are articulation points, the nodes they partition, their
+		// dependents and their fan-in.
+		want []string
+	}{
+		{name: "empty"},
+		{name: "pair", edges: "a>b"},
+		{name: "chain", edges: "a>b b>c", want: []string{"b true 1 1 1"}},
+		// The depth-first search starts at c, an articulation point since
+		// it has more than one child.
+		{name: "root", edges: "c>x c>y c>z", want: []string{"c true 2 0 0"}},
+		// The root of a cycle splits nothing.
+		{name: "root in a cycle", edges: "a>b b>c c>a"},
+		{name: "fan-in", edges: "a>c b>c a>b", want: []string{"c false 0 2 2"}},
+		{
+			name:  "partitions",
+			edges: "r>a a>b b>c c>d",
+			// Removing b leaves r and a apart from c and d.
+			want: []string{"b true 2 2 1", "c true 1 3 1", "a true 1 1 1"},
+		},
+		{
+			name:  "root splitting unevenly",
+			edges: "r>a a>b r>c",
+			// Both cut off one node; a has a dependent.
+			want: []string{"a true 1 1 1", "r true 1 0 0"},
+		},
+		{
+			name:  "components",
+			edges: "a>b b>c x>y y>z",
+			want:  []string{"b true 1 1 1", "y true 1 1 1"},
+		},
+		{
+			name:  "self and duplicate edges",
+			edges: "a>a a>b b>c a>b",
+			want:  []string{"b true 1 1 1"},
+		},
+		{
+			name:  "either direction",
+			edges: "a>b c>b",
+			want:  []string{"b true 1 2 2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range build(tt.edges).Critical() {
+				got = append(got, fmt.Sprintf("%s %v %d %d %d", c.Node.ID, c.Articulation, c.Partitioned, c.Dependents, c.FanIn))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
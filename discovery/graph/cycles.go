@@ -0,0 +1,139 @@
+package graph
+
+import "sort"
+
+// Cycle is a set of resources that depend on each other, directly or not:
+// each can reach every other by following dependencies, so none of them can
+// be deployed first without the others in place.
+type Cycle struct {
+	// Nodes are the resources in the cycle, in the order they were added.
+	Nodes []Node `json:"nodes"`
+	// Path is a shortest cycle through the first node, as the IDs along it
+	// from that node back to itself.
+	Path []string `json:"path"`
+	// Edges are the dependencies between the resources of the cycle, in
+	// the order they were added.
+	Edges []Edge `json:"edges"`
+}
+
+// Cycles returns the dependency cycles of g, the strongly connected
+// components of more than one node found by Tarjan's algorithm. Network
+// reachability only makes a dependency possible, and is usually mutual, so
+// it is not followed; nor is a resource depending on itself. Cycles are
+// sorted by size, largest first, then in the order of their first node.
+func (g *Graph) Cycles() []Cycle {
+	followed := func(e Edge) bool {
+		return e.From != e.To && !e.Network()
+	}
+	next := make([][]int, len(g.Nodes))
+	for _, e := range g.Edges {
+		if followed(e) {
+			next[g.nodes[e.From]] = append(next[g.nodes[e.From]], g.nodes[e.To])
+		}
+	}
+
+	index := make([]int, len(g.Nodes))
+	low := make([]int, len(g.Nodes))
+	onStack := make([]bool, len(g.Nodes))
+	component := make([]int, len(g.Nodes))
+	var stack []int
+	var components [][]int
+	clock := 0
+	var visit func(v int)
+	visit = func(v int) {
+		clock++
+		index[v], low[v] = clock, clock
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range next[v] {
+			switch {
+			case index[w] == 0:
+				visit(w)
+				low[v] = min(low[v], low[w])
+			case onStack[w]:
+				low[v] = min(low[v], index[w])
+			}
+		}
+		if low[v] != index[v] {
+			return
+		}
+		var members []int
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component[w] = len(components) + 1
+			members = append(members, w)
+			if w == v {
+				break
+			}
+		}
+		components = append(components, members)
+	}
+	for v := range g.Nodes {
+		if index[v] == 0 {
+			visit(v)
+		}
+	}
+
+	var cycles []Cycle
+	for i, members := range components {
+		if len(members) < 2 {
+			continue
+		}
+		sort.Ints(members)
+		c := Cycle{}
+		for _, v := range members {
+			c.Nodes = append(c.Nodes, g.Nodes[v])
+		}
+		for _, e := range g.Edges {
+			if followed(e) && component[g.nodes[e.From]] == i+1 && component[g.nodes[e.To]] == i+1 {
+				c.Edges = append(c.Edges, e)
+			}
+		}
+		c.Path = g.shortestCycle(members[0], next, component)
+		cycles = append(cycles, c)
+	}
+	sort.SliceStable(cycles, func(i, j int) bool {
+		if len(cycles[i].Nodes) != len(cycles[j].Nodes) {
+			return len(cycles[i].Nodes) > len(cycles[j].Nodes)
+		}
+		return g.nodes[cycles[i].Nodes[0].ID] < g.nodes[cycles[j].Nodes[0].ID]
+	})
+	return cycles
+}
+
+// shortestCycle returns the IDs along a shortest path from start back to
+// itself, breadth first through next within start's component.
+func (g *Graph) shortestCycle(start int, next [][]int, component []int) []string {
+	parent := map[int]int{}
+	frontier := []int{start}
+	for len(frontier) > 0 {
+		var following []int
+		for _, v := range frontier {
+			for _, w := range next[v] {
+				if component[w] != component[start] {
+					continue
+				}
+				if w == start {
+					path := []string{g.Nodes[start].ID}
+					for u := v; u != start; u = parent[u] {
+						path = append(path, g.Nodes[u].ID)
+					}
+					path = append(path, g.Nodes[start].ID)
+					// The path was collected from its end.
+					for i, j := 1, len(path)-2; i < j; i, j = i+1, j-1 {
+						path[i], path[j] = path[j], path[i]
+					}
+					return path
+				}
+				if _, seen := parent[w]; !seen {
+					parent[w] = v
+					following = append(following, w)
+				}
+			}
+		}
+		frontier = following
+	}
+	return nil
+}
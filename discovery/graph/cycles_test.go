@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// build returns the graph of edges such as "a>b", a depending on b, or
+// "a~b" for network reachability, with nodes added as they first appear.
+func build(edges string) *Graph {
+	g := New()
+	for _, e := range strings.Fields(edges) {
+		relation, sep := "dependsOn", ">"
+		if strings.Contains(e, "~") {
+			relation, sep = discovery.RelationNetwork, "~"
+		}
+		from, to, _ := strings.Cut(e, sep)
+		g.addEdge(Edge{From: g.addNode(Node{ID: from, Name: from}), To: g.addNode(Node{ID: to, Name: to}), Relation: relation})
+	}
+	return g
+}
+
+// ids returns the IDs of nodes.
+func ids(nodes []Node) []string {
+	var ids []string
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges string
+		// want are the cycles, as their nodes, path and edges.
+		want []string
+	}{
+		{name: "none", edges: "a>b b>c a>c"},
+		{name: "self", edges: "a>a a>b"},
+		{name: "network", edges: "a~b b~a"},
+		{name: "network and dependency", edges: "a>b b~a"},
+		{name: "pair", edges: "a>b b>a", want: []string{"[a b] [a b a] [a>b b>a]"}},
+		{name: "edges within", edges: "x>a a>b b>a b>c", want: []string{"[a b] [a b a] [a>b b>a]"}},
+		{
+			name:  "largest first",
+			edges: "a>b b>a c>d d>e e>c",
+			want:  []string{"[c d e] [c d e c] [c>d d>e e>c]", "[a b] [a b a] [a>b b>a]"},
+		},
+		{
+			name:  "same size in order",
+			edges: "c>d d>c a>b b>a",
+			want:  []string{"[c d] [c d c] [c>d d>c]", "[a b] [a b a] [a>b b>a]"},
+		},
+		{
+			name:  "shortest path",
+			edges: "a>d d>e e>f f>a a>b b>c c>a",
+			want:  []string{"[a d e f b c] [a b c a] [a>d d>e e>f f>a a>b b>c c>a]"},
+		},
+		{
+			name:  "shortest path through the first node",
+			edges: "a>b b>c c>d d>a c>b",
+			want:  []string{"[a b c d] [a b c d a] [a>b b>c c>d d>a c>b]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range build(tt.edges).Cycles() {
+				var edges []string
+				for _, e := range c.Edges {
+					edges = append(edges, e.From+">"+e.To)
+				}
+				got = append(got, fmt.Sprint(ids(c.Nodes), c.Path, edges))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got cycles %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// CypherLabel is the label of every node Cypher writes, alongside one for
+// its resource type.
+const CypherLabel = "Resource"
+
+// CypherStatement is an openCypher statement and the parameters it takes.
+type CypherStatement struct {
+	Cypher string
+	Params map[string]any
+}
+
+// CypherStatements returns the statements that merge g into a Neo4j or
+// other openCypher database: a uniqueness constraint on the nodes' id, then
+// for each resource type the nodes of that type, labelled Resource and e.g.
+// LambdaFunction for AWS::Lambda::Function, and for each relation the edges
+// as relationships of its type in upper snake case, e.g. EXECUTION_ROLE.
+// Tags are properties prefixed with "tag:". Merging again updates the
+// nodes and relationships in place; those no longer in g are left.
+func (g *Graph) CypherStatements() []CypherStatement {
+	statements := []CypherStatement{{
+		Cypher: "CREATE CONSTRAINT resource_id IF NOT EXISTS FOR (n:" + CypherLabel + ") REQUIRE n.id IS UNIQUE",
+	}}
+
+	nodes := map[string][]any{}
+	var labels []string
+	for _, n := range g.Nodes {
+		label := cypherLabel(n.ResourceType)
+		if _, ok := nodes[label]; !ok {
+			labels = append(labels, label)
+		}
+		props := map[string]any{"name": n.Name, "resourceType": string(n.ResourceType), "external": n.External}
+		for k, v := range map[string]string{"provider": n.Provider, "accountId": n.AccountID, "region": n.Region} {
+			if v != "" {
+				props[k] = v
+			}
+		}
+		for k, v := range n.Tags {
+			props[discovery.TagColumnPrefix+k] = v
+		}
+		nodes[label] = append(nodes[label], map[string]any{"id": n.ID, "props": props})
+	}
+	for _, label := range labels {
+		set := "SET n += row.props"
+		if label != "" {
+			set = "SET n:" + label + ", n += row.props"
+		}
+		statements = append(statements, CypherStatement{
+			Cypher: "UNWIND $rows AS row MERGE (n:" + CypherLabel + " {id: row.id}) " + set,
+			Params: map[string]any{"rows": nodes[label]},
+		})
+	}
+
+	edges := map[string][]any{}
+	var types []string
+	for _, e := range g.Edges {
+		typ := cypherType(e.Relation)
+		if _, ok := edges[typ]; !ok {
+			types = append(types, typ)
+		}
+		props := map[string]any{"relation": e.Relation}
+		if e.Confidence != "" {
+			props["confidence"] = e.Confidence
+		}
+		if e.Calls != 0 {
+			props["calls"] = e.Calls
+		}
+		if e.Ports != "" {
+			props["ports"] = e.Ports
+		}
+		if e.CrossAccount {
+			props["crossAccount"] = true
+		}
+		edges[typ] = append(edges[typ], map[string]any{"from": e.From, "to": e.To, "props": props})
+	}
+	for _, typ := range types {
+		statements = append(statements, CypherStatement{
+			Cypher: "UNWIND $rows AS row MATCH (a:" + CypherLabel + " {id: row.from}), (b:" + CypherLabel + " {id: row.to}) MERGE (a)-[r:" + typ + "]->(b) SET r += row.props",
+			Params: map[string]any{"rows": edges[typ]},
+		})
+	}
+	return statements
+}
+
+// WriteCypher writes the statements of CypherStatements with their
+// parameters inlined, one per line ending in ";", for cypher-shell or
+// another openCypher client, e.g.
+//
+//	discovery graph -o cypher | cypher-shell -u neo4j
+func (g *Graph) WriteCypher(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, s := range g.CypherStatements() {
+		cypher := s.Cypher
+		if rows, ok := s.Params["rows"]; ok {
+			cypher = strings.Replace(cypher, "$rows", cypherLiteral(rows), 1)
+		}
+		fmt.Fprintln(bw, cypher+";")
+	}
+	return bw.Flush()
+}
+
+// cypherLabel returns the node label of typ, its parts after the provider
+// joined, e.g. IAMRole for AWS::IAM::Role.
+func cypherLabel(typ discovery.ResourceType) string {
+	parts := strings.Split(string(typ), "::")
+	if len(parts) > 1 {
+		parts = parts[1:]
+	}
+	return cypherIdentifier(strings.Join(parts, ""))
+}
+
+// cypherType returns the relationship type of relation in upper snake case,
+// e.g. EVENT_SOURCE for eventSource.
+func cypherType(relation string) string {
+	var b strings.Builder
+	for i, r := range relation {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	if typ := cypherIdentifier(b.String()); typ != "" {
+		return typ
+	}
+	return "DEPENDS_ON"
+}
+
+// cypherIdentifier drops what cannot appear unquoted in a label or type.
+func cypherIdentifier(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// cypherLiteral returns v, built of maps, lists, strings, numbers and
+// booleans, as a Cypher literal. Map keys are sorted.
+func cypherLiteral(v any) string {
+	switch v := v.(type) {
+	case string:
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = cypherLiteral(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		entries := make([]string, len(keys))
+		for i, k := range keys {
+			entries[i] = "`" + strings.ReplaceAll(k, "`", "``") + "`: " + cypherLiteral(v[k])
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return fmt.Sprint(v)
+}
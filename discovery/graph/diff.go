@@ -0,0 +1,100 @@
+package graph
+
+import "sort"
+
+// Diff is the difference between two dependency graphs.
+type Diff struct {
+	// Added are the edges only the second graph has, and Removed those only
+	// the first has. Edges are matched by From, To and Relation.
+	Added   []Edge `json:"added"`
+	Removed []Edge `json:"removed"`
+	// Changed are the discovered services in both graphs depending on a
+	// different number of resources.
+	Changed []DependencyChange `json:"changed"`
+	// nodes names the nodes of both graphs, those of the second first.
+	nodes map[string]Node
+}
+
+// DependencyChange is a service whose number of dependencies changed.
+type DependencyChange struct {
+	Node   Node `json:"node"`
+	Before int  `json:"before"`
+	After  int  `json:"after"`
+}
+
+// Empty reports whether the graphs have the same edges.
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// Node returns the node with id in either graph, preferring the second.
+func (d *Diff) Node(id string) Node {
+	if n, ok := d.nodes[id]; ok {
+		return n
+	}
+	return Node{ID: id, Name: id}
+}
+
+// edgeKey identifies an edge across graphs.
+type edgeKey struct{ from, to, relation string }
+
+// Compare returns the difference from before to after. Added and Removed
+// are in the order of their graph, Changed is sorted by node ID.
+func Compare(before, after *Graph) *Diff {
+	d := &Diff{Added: []Edge{}, Removed: []Edge{}, Changed: []DependencyChange{}, nodes: map[string]Node{}}
+	for _, g := range []*Graph{before, after} {
+		for _, n := range g.Nodes {
+			d.nodes[n.ID] = n
+		}
+	}
+	edges := func(g *Graph) map[edgeKey]bool {
+		keys := make(map[edgeKey]bool, len(g.Edges))
+		for _, e := range g.Edges {
+			keys[edgeKey{e.From, e.To, e.Relation}] = true
+		}
+		return keys
+	}
+	was, is := edges(before), edges(after)
+	for _, e := range after.Edges {
+		if k := (edgeKey{e.From, e.To, e.Relation}); !was[k] {
+			d.Added = append(d.Added, e)
+			was[k] = true
+		}
+	}
+	for _, e := range before.Edges {
+		if k := (edgeKey{e.From, e.To, e.Relation}); !is[k] {
+			d.Removed = append(d.Removed, e)
+			is[k] = true
+		}
+	}
+
+	countBefore, countAfter := before.dependencies(), after.dependencies()
+	for _, n := range after.Nodes {
+		old, ok := before.Node(n.ID)
+		if n.External || !ok || old.External {
+			continue
+		}
+		if b, a := countBefore[n.ID], countAfter[n.ID]; b != a {
+			d.Changed = append(d.Changed, DependencyChange{Node: n, Before: b, After: a})
+		}
+	}
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Node.ID < d.Changed[j].Node.ID })
+	return d
+}
+
+// dependencies returns the number of distinct resources each node of g
+// depends on directly.
+func (g *Graph) dependencies() map[string]int {
+	targets := map[string]map[string]bool{}
+	for _, e := range g.Edges {
+		if targets[e.From] == nil {
+			targets[e.From] = map[string]bool{}
+		}
+		targets[e.From][e.To] = true
+	}
+	counts := make(map[string]int, len(targets))
+	for id, to := range targets {
+		counts[id] = len(to)
+	}
+	return counts
+}
@@ -0,0 +1,164 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// nodeStyle is how a resource type is drawn.
+type nodeStyle struct {
+	shape string
+	color string
+}
+
+// typeStyles styles the resource types discovery knows; others get a color
+// from typePalette.
+var typeStyles = map[discovery.ResourceType]nodeStyle{
+	discovery.ResourceTypeLambdaFunction: {"box", "#FFB26B"},
+	discovery.ResourceTypeIAMRole:        {"ellipse", "#F4A3AE"},
+	discovery.ResourceTypeECRRepository:  {"cylinder", "#FFD28A"},
+	discovery.ResourceTypeSQSQueue:       {"cylinder", "#D7BDE2"},
+	discovery.ResourceTypeKinesisStream:  {"cylinder", "#A7C7E7"},
+	discovery.ResourceTypeDynamoDBTable:  {"cylinder", "#A8D5BA"},
+	discovery.ResourceTypeAPIGateway:     {"hexagon", "#F9E79F"},
+	discovery.ResourceTypeHTTPAPI:        {"hexagon", "#F9E79F"},
+	discovery.ResourceTypeLoadBalancer:   {"octagon", "#AED6F1"},
+	discovery.ResourceTypeStateMachine:   {"component", "#F5CBA7"},
+	discovery.ResourceTypeSecurityGroup:  {"septagon", "#D5DBDB"},
+	discovery.ResourceTypeDNSName:        {"note", "#FDEBD0"},
+	discovery.ResourceTypeDistribution:   {"tab", "#D6EAF8"},
+	discovery.ResourceTypeEventBus:       {"cds", "#FADBD8"},
+	discovery.ResourceTypeAccount:        {"house", "#E5E7E9"},
+}
+
+var typePalette = []string{"#A8D5BA", "#A7C7E7", "#D7BDE2", "#F9E79F", "#AED6F1", "#F5CBA7"}
+
+// regionPalette fills the account and region clusters.
+var regionPalette = []string{"#F4F6F7", "#EBF5FB", "#FEF9E7", "#F5EEF8", "#E8F8F5", "#FDEDEC"}
+
+func styleOf(t discovery.ResourceType) nodeStyle {
+	if s, ok := typeStyles[t]; ok {
+		return s
+	}
+	return nodeStyle{"box", typePalette[hashIndex(string(t), len(typePalette))]}
+}
+
+func hashIndex(s string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return int(h.Sum32() % uint32(n))
+}
+
+// scope is the account and region a node is drawn in or, when the graph is
+// grouped, its group.
+type scope struct {
+	account, region string
+	grouped         bool
+	group           string
+}
+
+func (s scope) label() string {
+	if s.grouped {
+		if s.group == "" {
+			return "(none)"
+		}
+		return s.group
+	}
+	region := s.region
+	if region == "" {
+		region = "global"
+	}
+	return strings.TrimSpace(s.account + " " + region)
+}
+
+// scopeOf returns the scope n is drawn in.
+func (g *Graph) scopeOf(n Node) scope {
+	if g.GroupBy != "" {
+		return scope{grouped: true, group: n.Group(g.GroupBy)}
+	}
+	return scope{account: n.AccountID, region: n.Region}
+}
+
+// scopes groups node indexes by scope, in a stable order.
+func (g *Graph) scopes() ([]scope, map[scope][]int) {
+	members := map[scope][]int{}
+	for i, n := range g.Nodes {
+		sc := g.scopeOf(n)
+		members[sc] = append(members[sc], i)
+	}
+	keys := make([]scope, 0, len(members))
+	for sc := range members {
+		keys = append(keys, sc)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].account != keys[j].account {
+			return keys[i].account < keys[j].account
+		}
+		if keys[i].region != keys[j].region {
+			return keys[i].region < keys[j].region
+		}
+		return keys[i].group < keys[j].group
+	})
+	return keys, members
+}
+
+// WriteDOT writes g in the Graphviz DOT language. Nodes are grouped in a
+// cluster per account and region, or per group of GroupBy, shaped and
+// colored by resource type, and dashed when they were referenced but not
+// discovered. Edges between accounts are red.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph discovery {")
+	fmt.Fprintln(bw, "  rankdir=LR;")
+	fmt.Fprintln(bw, `  node [style=filled, fontname="Helvetica", fontsize=10];`)
+	fmt.Fprintln(bw, `  edge [fontname="Helvetica", fontsize=9];`)
+
+	keys, members := g.scopes()
+	for i, sc := range keys {
+		fmt.Fprintf(bw, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(bw, "    label=%s;\n    style=filled;\n    color=%q;\n", dotQuote(sc.label()), regionPalette[hashIndex(sc.region+sc.group, len(regionPalette))])
+		for _, ni := range members[sc] {
+			n := g.Nodes[ni]
+			style := styleOf(n.ResourceType)
+			attrs := fmt.Sprintf("label=%s, shape=%s, fillcolor=%q", dotQuote(n.Name+"\n"+string(n.ResourceType)), style.shape, style.color)
+			if n.External {
+				attrs += `, style="filled,dashed"`
+			}
+			fmt.Fprintf(bw, "    %s [%s];\n", dotQuote(n.ID), attrs)
+		}
+		fmt.Fprintln(bw, "  }")
+	}
+	for _, e := range g.Edges {
+		attrs := "label=" + dotQuote(e.Label())
+		switch {
+		case e.Inferred():
+			attrs += ", style=dashed"
+		case e.Observed():
+			attrs += `, style=bold, color="#2e7d32"`
+		case e.Network():
+			attrs += `, style=dotted, color="#5d6d7e", arrowhead=empty`
+		}
+		if e.CrossAccount {
+			attrs += `, fontcolor="#c0392b"`
+			if !e.Observed() && !e.Network() {
+				attrs += `, color="#c0392b"`
+			}
+		}
+		fmt.Fprintf(bw, "  %s -> %s [%s];\n", dotQuote(e.From), dotQuote(e.To), attrs)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// dotQuote returns s as a DOT quoted string. Newlines become DOT's centered
+// line breaks.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
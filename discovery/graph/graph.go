@@ -0,0 +1,312 @@
+// Package graph derives the dependency graph of discovered services: which
+// resources each one relies on, such as a Lambda function's execution role,
+// the repository of its container image, the queues and streams it consumes
+// or the functions a state machine invokes. Calls observed in traces or
+// logged by CloudTrail can be merged in, to tell dependencies in use from
+// those only configured or permitted.
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Node is a resource in the graph.
+type Node struct {
+	// ID is the resource's ARN, or discovery.Service.Key when it has none.
+	ID           string                 `json:"id"`
+	Name         string                 `json:"name"`
+	ResourceType discovery.ResourceType `json:"resourceType"`
+	Provider     string                 `json:"provider,omitempty"`
+	AccountID    string                 `json:"accountId,omitempty"`
+	// Region is empty for global resources such as IAM roles.
+	Region string `json:"region,omitempty"`
+	// Tags are the discovered resource's tags.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Owner is the discovered resource's discovery.Service.Owner.
+	Owner string `json:"owner,omitempty"`
+	// External is set for resources that services refer to but that were
+	// not discovered themselves.
+	External bool `json:"external,omitempty"`
+}
+
+// GroupKeys are the values Group takes besides "tag:<key>".
+var GroupKeys = []string{"owner", "account", "region", "type", "provider"}
+
+// CheckGroupKey reports whether Group knows by.
+func CheckGroupKey(by string) error {
+	if slices.Contains(GroupKeys, by) || strings.HasPrefix(by, discovery.TagColumnPrefix) && by != discovery.TagColumnPrefix {
+		return nil
+	}
+	return fmt.Errorf("unknown group %q (supported: %s, tag:<key>)", by, strings.Join(GroupKeys, ", "))
+}
+
+// Group returns what n is grouped by in by, one of GroupKeys or
+// "tag:<key>" for the value of a tag, e.g. its owner for "owner". It is
+// empty when n has none.
+func (n Node) Group(by string) string {
+	if key, ok := strings.CutPrefix(by, discovery.TagColumnPrefix); ok {
+		return n.Tags[key]
+	}
+	switch by {
+	case "owner":
+		return n.Owner
+	case "account":
+		return n.AccountID
+	case "region":
+		return n.Region
+	case "type":
+		return string(n.ResourceType)
+	case "provider":
+		return n.Provider
+	}
+	return ""
+}
+
+// Edge records that From depends on To.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Relation names the dependency, e.g. "executionRole", "image" or
+	// "eventSource".
+	Relation string `json:"relation"`
+	// Confidence is set on inferred dependencies, such as those from
+	// permissions, to one of the discovery.Confidence constants.
+	Confidence string `json:"confidence,omitempty"`
+	// Calls is set on observed and audited dependencies to the number of
+	// calls traced or logged.
+	Calls int64 `json:"calls,omitempty"`
+	// Ports is set on network reachability to the traffic admitted, e.g.
+	// "tcp/5432".
+	Ports string `json:"ports,omitempty"`
+	// CrossAccount is set when From and To are in different accounts.
+	CrossAccount bool `json:"crossAccount,omitempty"`
+}
+
+// Observed reports whether the dependency was seen in use, in traces or in
+// CloudTrail logs.
+func (e Edge) Observed() bool {
+	return e.Relation == discovery.RelationObserved || e.Relation == discovery.RelationAudited
+}
+
+// Network reports whether the edge is network reachability, which makes a
+// dependency possible rather than showing one.
+func (e Edge) Network() bool {
+	return e.Relation == discovery.RelationNetwork
+}
+
+// Inferred reports whether the dependency was inferred rather than found
+// configured.
+func (e Edge) Inferred() bool {
+	return e.Confidence != ""
+}
+
+// Evidence names what the dependency was found in: "traces" for calls
+// observed by X-Ray, "cloudtrail" for calls audited in CloudTrail logs,
+// "security groups" for network reachability, "policies" for dependencies
+// inferred from permissions or resource policies, and otherwise
+// "configuration".
+func (e Edge) Evidence() string {
+	switch {
+	case e.Relation == discovery.RelationObserved:
+		return "traces"
+	case e.Relation == discovery.RelationAudited:
+		return "cloudtrail"
+	case e.Network():
+		return "security groups"
+	case e.Inferred():
+		return "policies"
+	}
+	return "configuration"
+}
+
+// Label describes the dependency, e.g. "eventSource", "permission (high)"
+// "observed (1200 calls)" or "network (tcp/5432)".
+func (e Edge) Label() string {
+	switch {
+	case e.Inferred():
+		return e.Relation + " (" + e.Confidence + ")"
+	case e.Observed():
+		return e.Relation + " (" + strconv.FormatInt(e.Calls, 10) + " calls)"
+	case e.Network() && e.Ports != "":
+		return e.Relation + " (" + e.Ports + ")"
+	}
+	return e.Relation
+}
+
+// Graph is a set of resources and their dependencies. Nodes and edges are
+// kept in the order they were added.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+	// GroupBy, when set to a key Group takes, draws nodes grouped by it
+	// instead of by account and region.
+	GroupBy string `json:"-"`
+
+	nodes map[string]int
+	// edges indexes Edges by edge without its call count.
+	edges map[Edge]int
+}
+
+// New returns an empty graph.
+func New() *Graph {
+	return &Graph{Nodes: []Node{}, Edges: []Edge{}, nodes: map[string]int{}, edges: map[Edge]int{}}
+}
+
+// Add adds s and the resources it depends on.
+func (g *Graph) Add(s discovery.Service) {
+	from := g.addNode(Node{
+		ID:           s.Key(),
+		Name:         s.Name,
+		ResourceType: s.ResourceType,
+		Provider:     s.Provider,
+		AccountID:    s.AccountID,
+		Region:       s.Region,
+		Tags:         s.Tags,
+		Owner:        s.Owner,
+	})
+	for _, ref := range references(s) {
+		ref.node.External = true
+		to := g.addNode(ref.node)
+		from := from
+		if ref.from != nil {
+			ref.from.External = true
+			from = g.addNode(*ref.from)
+		}
+		g.addEdge(Edge{From: from, To: to, Relation: ref.relation, Confidence: ref.confidence, Calls: ref.calls})
+	}
+}
+
+// AddRelationship adds r between the resources it names, which must have
+// From set, such as the calls observed in traces or network reachability.
+// The calls of observed dependencies added more than once are summed.
+func (g *Graph) AddRelationship(r discovery.Relationship) {
+	from := arnNode(r.From, r.FromType)
+	from.External = true
+	to := arnNode(r.Target, r.TargetType)
+	to.External = true
+	e := Edge{From: g.addNode(from), To: g.addNode(to), Relation: r.Relation, Confidence: r.Confidence, Calls: r.Calls}
+	if r.Relation == discovery.RelationNetwork {
+		e.Ports = r.Via
+	}
+	g.addEdge(e)
+}
+
+func (g *Graph) addEdge(e Edge) {
+	from, to := g.Nodes[g.nodes[e.From]].AccountID, g.Nodes[g.nodes[e.To]].AccountID
+	e.CrossAccount = from != "" && to != "" && from != to
+	key := e
+	key.Calls = 0
+	if i, ok := g.edges[key]; ok {
+		g.Edges[i].Calls += e.Calls
+		return
+	}
+	g.edges[key] = len(g.Edges)
+	g.Edges = append(g.Edges, e)
+}
+
+// Node returns the node with id.
+func (g *Graph) Node(id string) (Node, bool) {
+	i, ok := g.nodes[id]
+	if !ok {
+		return Node{}, false
+	}
+	return g.Nodes[i], true
+}
+
+// addNode adds n unless it is present and returns its ID. A discovered
+// resource replaces an external placeholder for it.
+func (g *Graph) addNode(n Node) string {
+	if i, ok := g.nodes[n.ID]; ok {
+		if g.Nodes[i].External && !n.External {
+			g.Nodes[i] = n
+		}
+		return n.ID
+	}
+	g.nodes[n.ID] = len(g.Nodes)
+	g.Nodes = append(g.Nodes, n)
+	return n.ID
+}
+
+// reference is a resource a service depends on or, when from is set, a
+// dependency of from on node.
+type reference struct {
+	node       Node
+	from       *Node
+	relation   string
+	confidence string
+	calls      int64
+}
+
+// references returns the resources s depends on, as far as its recorded
+// details and relationships tell.
+func references(s discovery.Service) []reference {
+	var refs []reference
+	if l := s.Details.Lambda; l != nil {
+		if l.Role != "" {
+			refs = append(refs, reference{node: arnNode(l.Role, discovery.ResourceTypeIAMRole), relation: "executionRole"})
+		}
+		if n, ok := ecrRepository(l.Code.ImageURI); ok {
+			refs = append(refs, reference{node: n, relation: "image"})
+		}
+	}
+	if m := s.Details.StateMachine; m != nil && m.Role != "" {
+		refs = append(refs, reference{node: arnNode(m.Role, discovery.ResourceTypeIAMRole), relation: "executionRole"})
+	}
+	for _, r := range s.Relationships {
+		ref := reference{node: arnNode(r.Target, r.TargetType), relation: r.Relation, confidence: r.Confidence, calls: r.Calls}
+		if r.From != "" {
+			from := arnNode(r.From, r.FromType)
+			ref.from = &from
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// arnNode returns the node of the resource named by arn, e.g.
+// arn:aws:iam::123456789012:role/service/app named "app".
+func arnNode(arn string, typ discovery.ResourceType) Node {
+	n := Node{ID: arn, Name: arn, ResourceType: typ}
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) == 6 && parts[0] == "arn" {
+		n.Provider = "aws"
+		n.Region = parts[3]
+		n.AccountID = parts[4]
+		n.Name = parts[5][strings.LastIndexAny(parts[5], "/:")+1:]
+		if typ == discovery.ResourceTypeAccount {
+			n.Name = n.AccountID
+		}
+	}
+	return n
+}
+
+// ecrRepository returns the ECR repository node of a Lambda image URI such as
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com/app:latest.
+func ecrRepository(uri string) (Node, bool) {
+	host, path, ok := strings.Cut(uri, "/")
+	if !ok {
+		return Node{}, false
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 6 || labels[1] != "dkr" || labels[2] != "ecr" {
+		return Node{}, false
+	}
+	account, region := labels[0], labels[3]
+	repo, _, _ := strings.Cut(path, "@")
+	if i := strings.LastIndex(repo, ":"); i >= 0 {
+		repo = repo[:i]
+	}
+	return Node{
+		ID:           "arn:aws:ecr:" + region + ":" + account + ":repository/" + repo,
+		Name:         repo,
+		ResourceType: discovery.ResourceTypeECRRepository,
+		Provider:     "aws",
+		AccountID:    account,
+		Region:       region,
+	}, true
+}
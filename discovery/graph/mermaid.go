@@ -0,0 +1,95 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// mermaidShapes wraps a label in the Mermaid flowchart shape matching each
+// DOT shape.
+var mermaidShapes = map[string][2]string{
+	"box":      {"[", "]"},
+	"ellipse":  {"([", "])"},
+	"cylinder": {"[(", ")]"},
+	"hexagon":  {"{{", "}}"},
+}
+
+// WriteMermaid writes g as a Mermaid flowchart, for wikis and pull requests
+// that render Mermaid. It is styled like WriteDOT: a subgraph per account and
+// region or group, a class per resource type, and dashed borders for
+// resources that were referenced but not discovered.
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "flowchart LR")
+
+	// Mermaid IDs must be plain words, so nodes are numbered in order.
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+
+	keys, members := g.scopes()
+	for i, sc := range keys {
+		fmt.Fprintf(bw, "  subgraph s%d[%s]\n", i, mermaidQuote(sc.label()))
+		for _, ni := range members[sc] {
+			n := g.Nodes[ni]
+			shape, ok := mermaidShapes[styleOf(n.ResourceType).shape]
+			if !ok {
+				shape = mermaidShapes["box"]
+			}
+			fmt.Fprintf(bw, "    %s%s%s%s\n", ids[n.ID], shape[0], mermaidQuote(n.Name+"\n"+string(n.ResourceType)), shape[1])
+		}
+		fmt.Fprintln(bw, "  end")
+	}
+	var crossAccount []string
+	for i, e := range g.Edges {
+		if e.CrossAccount {
+			crossAccount = append(crossAccount, fmt.Sprint(i))
+		}
+		arrow := "-->"
+		switch {
+		case e.Inferred():
+			arrow = "-.->"
+		case e.Observed():
+			arrow = "==>"
+		case e.Network():
+			arrow = "-.-o"
+		}
+		fmt.Fprintf(bw, "  %s %s|%s| %s\n", ids[e.From], arrow, mermaidQuote(e.Label()), ids[e.To])
+	}
+	if len(crossAccount) > 0 {
+		fmt.Fprintf(bw, "  linkStyle %s stroke:#c0392b,color:#c0392b\n", strings.Join(crossAccount, ","))
+	}
+
+	// One class per resource type present, then the external marker.
+	classes := map[discovery.ResourceType]string{}
+	var external []string
+	for _, n := range g.Nodes {
+		class, ok := classes[n.ResourceType]
+		if !ok {
+			class = fmt.Sprintf("t%d", len(classes))
+			classes[n.ResourceType] = class
+			fmt.Fprintf(bw, "  classDef %s fill:%s,stroke:#555\n", class, styleOf(n.ResourceType).color)
+		}
+		fmt.Fprintf(bw, "  class %s %s\n", ids[n.ID], class)
+		if n.External {
+			external = append(external, ids[n.ID])
+		}
+	}
+	if len(external) > 0 {
+		fmt.Fprintln(bw, "  classDef external stroke-dasharray:5 5")
+		fmt.Fprintf(bw, "  class %s external\n", strings.Join(external, ","))
+	}
+	return bw.Flush()
+}
+
+// mermaidQuote returns s as a quoted Mermaid label. Quotes and markup are
+// written as entity codes and newlines as line breaks.
+func mermaidQuote(s string) string {
+	r := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "\n", "<br/>")
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,137 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Direction is the way Reachable follows edges.
+type Direction int
+
+const (
+	// Downstream follows edges from a node to what it depends on.
+	Downstream Direction = iota
+	// Upstream follows edges from a node to what depends on it.
+	Upstream
+)
+
+// ParseDirection parses "downstream" or "upstream".
+func ParseDirection(s string) (Direction, error) {
+	switch strings.ToLower(s) {
+	case "downstream", "down":
+		return Downstream, nil
+	case "upstream", "up":
+		return Upstream, nil
+	}
+	return 0, fmt.Errorf("unknown direction %q (supported: upstream, downstream)", s)
+}
+
+// Reached is a node found by Reachable.
+type Reached struct {
+	Node Node `json:"node"`
+	// Depth is the number of edges from the start.
+	Depth int `json:"depth"`
+	// Via is the edge Node was first reached by.
+	Via Edge `json:"via"`
+}
+
+// Lookup returns the nodes ref names: the node with ID ref or else those
+// named ref, of which there can be several, e.g. functions of the same name
+// in two regions.
+func (g *Graph) Lookup(ref string) []Node {
+	if n, ok := g.Node(ref); ok {
+		return []Node{n}
+	}
+	var named []Node
+	for _, n := range g.Nodes {
+		if n.Name == ref {
+			named = append(named, n)
+		}
+	}
+	return named
+}
+
+// Reachable returns the nodes reachable from the node id in direction by at
+// most depth edges, or any number when depth is below 1, nearest first and
+// in the order of the edges reaching them. The start is not included.
+func (g *Graph) Reachable(id string, direction Direction, depth int) []Reached {
+	next := map[string][]Edge{}
+	for _, e := range g.Edges {
+		if direction == Downstream {
+			next[e.From] = append(next[e.From], e)
+		} else {
+			next[e.To] = append(next[e.To], e)
+		}
+	}
+	seen := map[string]bool{id: true}
+	var reached []Reached
+	frontier := []string{id}
+	for d := 1; len(frontier) > 0 && (depth < 1 || d <= depth); d++ {
+		var following []string
+		for _, from := range frontier {
+			for _, e := range next[from] {
+				to := e.To
+				if direction == Upstream {
+					to = e.From
+				}
+				if seen[to] {
+					continue
+				}
+				seen[to] = true
+				n, _ := g.Node(to)
+				reached = append(reached, Reached{Node: n, Depth: d, Via: e})
+				following = append(following, to)
+			}
+		}
+		frontier = following
+	}
+	return reached
+}
+
+// Subgraph returns the graph of the nodes with ids and the edges between
+// them, in g's order, grouped like g.
+func (g *Graph) Subgraph(ids []string) *Graph {
+	keep := map[string]bool{}
+	for _, id := range ids {
+		keep[id] = true
+	}
+	sub := New()
+	sub.GroupBy = g.GroupBy
+	for _, n := range g.Nodes {
+		if keep[n.ID] {
+			sub.addNode(n)
+		}
+	}
+	for _, e := range g.Edges {
+		if keep[e.From] && keep[e.To] {
+			sub.addEdge(e)
+		}
+	}
+	return sub
+}
+
+// Unreferenced returns the discovered nodes that nothing in g depends on,
+// such as a function no API, bucket or state machine invokes, in the order
+// they were added. A function's event sources count as depending on it,
+// since they invoke it although its edges point to them.
+func (g *Graph) Unreferenced() []Node {
+	referenced := map[string]bool{}
+	for _, e := range g.Edges {
+		if e.From == e.To {
+			continue
+		}
+		referenced[e.To] = true
+		if e.Relation == discovery.RelationEventSource {
+			referenced[e.From] = true
+		}
+	}
+	var nodes []Node
+	for _, n := range g.Nodes {
+		if !n.External && !referenced[n.ID] {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,161 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SVG layout, in pixels.
+const (
+	svgNodeWidth  = 240
+	svgNodeHeight = 38
+	svgRowGap     = 10
+	svgColumnGap  = 140
+	svgMargin     = 20
+	svgNameLength = 34
+)
+
+// WriteSVG draws g as a standalone SVG image without needing Graphviz.
+// Resources are laid out in columns, each one to the left of what it depends
+// on, colored like WriteDOT and dashed when they were not discovered. Nodes
+// carry a data-search attribute with their name, type and region for
+// filtering in a page.
+func (g *Graph) WriteSVG(w io.Writer) error {
+	columns := g.layers()
+	pos := map[string][2]int{}
+	height := 0
+	for c, ids := range columns {
+		for r, id := range ids {
+			x := svgMargin + c*(svgNodeWidth+svgColumnGap)
+			y := svgMargin + r*(svgNodeHeight+svgRowGap)
+			pos[id] = [2]int{x, y}
+			height = max(height, y+svgNodeHeight+svgMargin)
+		}
+	}
+	width := svgMargin*2 + max(len(columns), 1)*svgNodeWidth + max(len(columns)-1, 0)*svgColumnGap
+	height = max(height, svgMargin*2)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Helvetica, Arial, sans-serif">`+"\n", width, height, width, height)
+	fmt.Fprintln(bw, `<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="7" markerHeight="7" orient="auto-start-reverse"><path d="M0,0 L10,5 L0,10 z" fill="#777"/></marker></defs>`)
+	for _, e := range g.Edges {
+		from, to := pos[e.From], pos[e.To]
+		x1, y1 := from[0]+svgNodeWidth, from[1]+svgNodeHeight/2
+		x2, y2 := to[0], to[1]+svgNodeHeight/2
+		mid := (x1 + x2) / 2
+		stroke := `stroke="#999"`
+		switch {
+		case e.Inferred():
+			stroke += ` stroke-dasharray="4 3"`
+		case e.Observed():
+			stroke = `stroke="#2e7d32" stroke-width="2"`
+		case e.Network():
+			stroke = `stroke="#5d6d7e" stroke-dasharray="1 3"`
+		}
+		if e.CrossAccount && !e.Observed() && !e.Network() {
+			stroke = strings.Replace(stroke, `stroke="#999"`, `stroke="#c0392b"`, 1)
+		}
+		fmt.Fprintf(bw, `<path class="edge" d="M%d,%d C%d,%d %d,%d %d,%d" fill="none" %s marker-end="url(#arrow)"><title>%s</title></path>`+"\n",
+			x1, y1, mid, y1, mid, y2, x2, y2, stroke, html.EscapeString(e.Label()))
+	}
+	for _, n := range g.Nodes {
+		p := pos[n.ID]
+		style := styleOf(n.ResourceType)
+		dash := ""
+		if n.External {
+			dash = ` stroke-dasharray="4 3"`
+		}
+		subtitle := string(n.ResourceType)
+		if n.Region != "" {
+			subtitle += " · " + n.Region
+		}
+		search := strings.ToLower(n.Name + " " + string(n.ResourceType) + " " + n.Region + " " + n.ID)
+		fmt.Fprintf(bw, `<g class="node" data-search="%s"><title>%s</title>`, html.EscapeString(search), html.EscapeString(n.ID))
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" rx="5" fill="%s" stroke="#555"%s/>`, p[0], p[1], svgNodeWidth, svgNodeHeight, style.color, dash)
+		fmt.Fprintf(bw, `<text x="%d" y="%d" font-size="12">%s</text>`, p[0]+8, p[1]+16, html.EscapeString(truncate(n.Name, svgNameLength)))
+		fmt.Fprintf(bw, `<text x="%d" y="%d" font-size="9" fill="#444">%s</text></g>`+"\n", p[0]+8, p[1]+30, html.EscapeString(subtitle))
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// layers assigns every node to a column: one past the deepest of the
+// resources depending on it, so edges point right. Within a column, nodes
+// are sorted by account and region, or group, and dependencies are placed
+// near the average row of their dependents to limit crossings.
+func (g *Graph) layers() [][]string {
+	layer := make(map[string]int, len(g.Nodes))
+	// Longest-path layering; the pass limit keeps a cycle from looping.
+	for range g.Nodes {
+		changed := false
+		for _, e := range g.Edges {
+			if layer[e.To] < layer[e.From]+1 {
+				layer[e.To] = layer[e.From] + 1
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	var columns [][]string
+	for _, n := range g.Nodes {
+		l := min(layer[n.ID], len(g.Nodes))
+		for len(columns) <= l {
+			columns = append(columns, nil)
+		}
+		columns[l] = append(columns[l], n.ID)
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	sort.SliceStable(columns[0], func(i, j int) bool {
+		a, _ := g.Node(columns[0][i])
+		b, _ := g.Node(columns[0][j])
+		return g.scopeOf(a).label() < g.scopeOf(b).label()
+	})
+
+	dependents := map[string][]string{}
+	for _, e := range g.Edges {
+		dependents[e.To] = append(dependents[e.To], e.From)
+	}
+	row := map[string]int{}
+	for i, id := range columns[0] {
+		row[id] = i
+	}
+	for c := 1; c < len(columns); c++ {
+		center := map[string]float64{}
+		for _, id := range columns[c] {
+			sum, n := 0.0, 0
+			for _, from := range dependents[id] {
+				if r, ok := row[from]; ok {
+					sum += float64(r)
+					n++
+				}
+			}
+			if n > 0 {
+				center[id] = sum / float64(n)
+			}
+		}
+		sort.SliceStable(columns[c], func(i, j int) bool {
+			return center[columns[c][i]] < center[columns[c][j]]
+		})
+		for i, id := range columns[c] {
+			row[id] = i
+		}
+	}
+	return columns
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,84 @@
+package discovery
+
+import (
+	"context"
+)
+
+// Result is one item produced by a discovery run: either a Service or an
+// error scoped to part of the scan (see Discover).
+type Result struct {
+	Service Service
+	Err     error
+}
+
+// ResultHandler consumes results as they are produced. Printing, storing,
+// aggregating and exporting are all handlers, so catalogers never need to
+// know where their output goes.
+type ResultHandler interface {
+	// HandleResult processes r. Returning an error aborts the run.
+	HandleResult(ctx context.Context, r Result) error
+}
+
+// ResultHandlerFunc adapts a function to ResultHandler.
+type ResultHandlerFunc func(ctx context.Context, r Result) error
+
+func (f ResultHandlerFunc) HandleResult(ctx context.Context, r Result) error {
+	return f(ctx, r)
+}
+
+// ServiceHandler returns a ResultHandler that calls fn for services only,
+// ignoring errors.
+func ServiceHandler(fn func(ctx context.Context, s Service) error) ResultHandler {
+	return ResultHandlerFunc(func(ctx context.Context, r Result) error {
+		if r.Err != nil {
+			return nil
+		}
+		return fn(ctx, r.Service)
+	})
+}
+
+// MultiHandler passes every result to each handler in order, stopping at the
+// first error.
+func MultiHandler(handlers ...ResultHandler) ResultHandler {
+	return ResultHandlerFunc(func(ctx context.Context, r Result) error {
+		for _, h := range handlers {
+			if err := h.HandleResult(ctx, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Run performs a discovery run, passing every result to h. It returns the
+// first error from h, or ctx's error if the run was cancelled.
+func Run(ctx context.Context, opts Options, h ResultHandler) error {
+	for svc, err := range Discover(ctx, opts) {
+		if err != nil && err == ctx.Err() {
+			return err
+		}
+		if herr := h.HandleResult(ctx, Result{Service: svc, Err: err}); herr != nil {
+			return herr
+		}
+	}
+	return ctx.Err()
+}
+
+// Stream performs a discovery run in the background and delivers results on
+// the returned channel, which is closed when the run ends. Cancel ctx to stop
+// the run early; the channel is still closed. Options.Buffer sets the channel
+// capacity, letting catalogers run ahead of a slow consumer.
+func Stream(ctx context.Context, opts Options) <-chan Result {
+	ch := make(chan Result, opts.Buffer)
+	go func() {
+		defer close(ch)
+		for svc, err := range Discover(ctx, opts) {
+			select {
+			case ch <- Result{Service: svc, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,170 @@
+// Package hooks runs user-configured shell commands and webhooks at fixed
+// points of a discovery run, handing each the run manifest as JSON. They are
+// meant for integrations such as opening tickets or sending notifications.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Event names a point in a run at which hooks are run.
+type Event string
+
+const (
+	// BeforeRun hooks run once the run is set up, before any region is
+	// scanned. A failing BeforeRun hook aborts the run.
+	BeforeRun Event = "before_run"
+	// ProviderDone hooks run after every region of a provider has been
+	// scanned.
+	ProviderDone Event = "provider_done"
+	// AfterRun hooks run after the run ends, however it ended.
+	AfterRun Event = "after_run"
+)
+
+// DefaultTimeout bounds a hook that sets no timeout of its own.
+const DefaultTimeout = 30 * time.Second
+
+// Hook is a shell command or a webhook. Exactly one of Command and URL is set.
+type Hook struct {
+	// Command is run with "sh -c". The payload is written to its stdin and
+	// the event, provider and run status are set in DISCOVERY_HOOK_EVENT,
+	// DISCOVERY_HOOK_PROVIDER and DISCOVERY_RUN_STATUS. A non-zero exit
+	// status is a failure.
+	Command string
+	// URL receives the payload in a POST request. A response status
+	// outside 2xx is a failure.
+	URL string
+	// Headers are added to webhook requests. Values may refer to
+	// environment variables, e.g. "Bearer ${TICKET_TOKEN}", so secrets need
+	// not be stored in the config file.
+	Headers map[string]string
+	Timeout time.Duration
+}
+
+// Validate reports whether h names exactly one command or URL.
+func (h Hook) Validate() error {
+	switch {
+	case h.Command == "" && h.URL == "":
+		return errors.New("hook needs a command or a url")
+	case h.Command != "" && h.URL != "":
+		return errors.New("hook has both a command and a url; use one per hook")
+	}
+	return nil
+}
+
+func (h Hook) String() string {
+	if h.URL != "" {
+		return h.URL
+	}
+	return h.Command
+}
+
+// Payload is the JSON document a hook receives.
+type Payload struct {
+	Event Event `json:"event"`
+	// Provider is the provider that finished, for ProviderDone hooks.
+	Provider string              `json:"provider,omitempty"`
+	Manifest *discovery.Manifest `json:"manifest"`
+}
+
+// Runner runs the hooks configured for each event.
+type Runner struct {
+	Hooks map[Event][]Hook
+	// Output receives the output of hook commands. It defaults to
+	// os.Stderr, keeping stdout for discovery results.
+	Output io.Writer
+	Client *http.Client
+}
+
+// Has reports whether any hooks are configured for e, so callers can skip
+// building the payload.
+func (r *Runner) Has(e Event) bool {
+	return r != nil && len(r.Hooks[e]) > 0
+}
+
+// Run runs every hook configured for p.Event, in order. A failing hook does
+// not stop the rest; their errors are joined.
+func (r *Runner) Run(ctx context.Context, p Payload) error {
+	if !r.Has(p.Event) {
+		return nil
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("encoding hook payload: %w", err)
+	}
+	var errs []error
+	for _, h := range r.Hooks[p.Event] {
+		if err := r.run(ctx, h, p, body); err != nil {
+			errs = append(errs, fmt.Errorf("%s hook %q: %w", p.Event, h, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Runner) run(ctx context.Context, h Hook, p Payload, body []byte) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if h.URL != "" {
+		return r.post(ctx, h, body)
+	}
+
+	out := r.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = append(os.Environ(),
+		"DISCOVERY_HOOK_EVENT="+string(p.Event),
+		"DISCOVERY_HOOK_PROVIDER="+p.Provider,
+	)
+	if p.Manifest != nil {
+		cmd.Env = append(cmd.Env, "DISCOVERY_RUN_STATUS="+p.Manifest.Status)
+	}
+	return cmd.Run()
+}
+
+func (r *Runner) post(ctx context.Context, h Hook, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
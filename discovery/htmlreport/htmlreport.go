@@ -0,0 +1,170 @@
+// Package htmlreport renders a snapshot as a single self-contained HTML page
+// for people who do not use the CLI: summary figures, a searchable table per
+// resource type and the dependency graph. The page loads nothing from the
+// network.
+package htmlreport
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/graph"
+	"github.com/jamesneb/causal/discovery/output"
+	"github.com/jamesneb/causal/discovery/snapshot"
+)
+
+//go:embed report.html.tmpl
+var pageTemplate string
+
+var page = template.Must(template.New("report").Parse(pageTemplate))
+
+// MaxGraphNodes is the largest graph drawn in a report; bigger graphs are
+// left out, since they are unreadable and slow the page down.
+const MaxGraphNodes = 500
+
+// typeColumns are the table columns for each resource type; other types use
+// defaultColumns.
+var typeColumns = map[discovery.ResourceType][]string{
+	discovery.ResourceTypeLambdaFunction: {
+		"name", "account", "region", "runtime", "memory", "timeout",
+		"package-type", "last-modified", "role", "owner", "tags",
+	},
+}
+
+var defaultColumns = []string{"name", "provider", "account", "region", "arn", "last-modified", "owner", "tags"}
+
+// Report is the content of a report.
+type Report struct {
+	Title    string
+	Snapshot snapshot.Snapshot
+	Services []discovery.Service
+	// GroupBy, when set to a column such as "owner", adds a table of the
+	// number of services of each type per value of it, and orders the
+	// graph by it where the graph can be grouped so.
+	GroupBy string
+}
+
+// rollup is the table of services per group of Report.GroupBy.
+type rollup struct {
+	By    string
+	Types []discovery.ResourceType
+	Rows  []rollupRow
+}
+
+type rollupRow struct {
+	Group    string
+	Services int
+	// Counts are the services of each of rollup.Types.
+	Counts []int
+}
+
+type section struct {
+	Type    discovery.ResourceType
+	Columns []string
+	Rows    [][]string
+}
+
+type pageData struct {
+	Title     string
+	Generated time.Time
+	Snapshot  snapshot.Snapshot
+	Report    *discovery.RunReport
+	Accounts  int
+	Regions   int
+	Sections  []section
+	Graph     template.HTML
+	// GraphNodes is the size of the graph, reported when it is too large
+	// to draw.
+	GraphNodes    int
+	GraphTooLarge bool
+	Rollup        *rollup
+}
+
+// Write renders r to w.
+func Write(w io.Writer, r Report) error {
+	data := pageData{
+		Title:     r.Title,
+		Generated: time.Now().UTC(),
+		Snapshot:  r.Snapshot,
+		Report:    r.Snapshot.Report,
+	}
+	if data.Title == "" {
+		data.Title = "Discovery report " + r.Snapshot.ID
+	}
+
+	accounts, regions := map[string]bool{}, map[string]bool{}
+	sections := map[discovery.ResourceType]*section{}
+	g := graph.New()
+	if graph.CheckGroupKey(r.GroupBy) == nil {
+		g.GroupBy = r.GroupBy
+	}
+	var groups *output.Rollup
+	if r.GroupBy != "" {
+		groups = output.NewRollup(r.GroupBy)
+	}
+	for _, s := range r.Services {
+		accounts[s.AccountID] = true
+		regions[s.Region] = true
+		sec, ok := sections[s.ResourceType]
+		if !ok {
+			columns, ok := typeColumns[s.ResourceType]
+			if !ok {
+				columns = defaultColumns
+			}
+			sec = &section{Type: s.ResourceType, Columns: columns}
+			sections[s.ResourceType] = sec
+		}
+		row := make([]string, len(sec.Columns))
+		for i, c := range sec.Columns {
+			row[i], _ = s.Column(c)
+		}
+		sec.Rows = append(sec.Rows, row)
+		g.Add(s)
+		if groups != nil {
+			if err := groups.Add(s); err != nil {
+				return err
+			}
+		}
+	}
+	delete(accounts, "")
+	data.Accounts, data.Regions = len(accounts), len(regions)
+	for _, sec := range sections {
+		data.Sections = append(data.Sections, *sec)
+	}
+	sort.Slice(data.Sections, func(i, j int) bool { return data.Sections[i].Type < data.Sections[j].Type })
+	if groups != nil {
+		data.Rollup = &rollup{By: r.GroupBy}
+		for _, sec := range data.Sections {
+			data.Rollup.Types = append(data.Rollup.Types, sec.Type)
+		}
+		for _, grp := range groups.Groups() {
+			row := rollupRow{Group: grp.Group, Services: grp.Services, Counts: make([]int, len(data.Rollup.Types))}
+			for i, t := range data.Rollup.Types {
+				row.Counts[i] = grp.ByType[string(t)]
+			}
+			data.Rollup.Rows = append(data.Rollup.Rows, row)
+		}
+	}
+
+	data.GraphNodes = len(g.Nodes)
+	data.GraphTooLarge = len(g.Nodes) > MaxGraphNodes
+	if len(g.Edges) > 0 && !data.GraphTooLarge {
+		var svg bytes.Buffer
+		if err := g.WriteSVG(&svg); err != nil {
+			return err
+		}
+		// WriteSVG escapes every value it writes.
+		data.Graph = template.HTML(svg.String())
+	}
+
+	if err := page.Execute(w, data); err != nil {
+		return fmt.Errorf("rendering report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+type Auth0Config struct {
+	Domain   string
+	ClientID string
+	Audience string
+	Token    *oauth2.Token
+	Verifier *oidc.IDTokenVerifier
+}
+
+// NewAuth0Config resolves the OIDC provider for domain, which also verifies that
+// the Auth0 tenant is reachable.
+func NewAuth0Config(ctx context.Context, domain, clientID, audience string) (*Auth0Config, error) {
+
+	provider, err := oidc.NewProvider(ctx, "https://"+domain+"/")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get provider: %w", err)
+	}
+
+	return &Auth0Config{
+		Domain:   domain,
+		ClientID: clientID,
+		Audience: audience,
+		Verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+// Login runs the device authorization flow, printing the verification URL to
+// stderr and polling until the user approves, the device code expires or ctx
+// is done. It asks for offline access, so the token can be renewed with
+// Refresh where the API allows it.
+func (cfg *Auth0Config) Login(ctx context.Context) error {
+
+	deviceEndpoint := fmt.Sprintf("https://%s/oauth/device/code", cfg.Domain)
+	tokenEndpoint := fmt.Sprintf("https://%s/oauth/token", cfg.Domain)
+
+	data := url.Values{}
+	data.Set("client_id", cfg.ClientID)
+	data.Set("scope", "openid profile email offline_access")
+
+	if cfg.Audience != "" {
+		data.Set("audience", cfg.Audience)
+	}
+
+	resp, err := postForm(ctx, deviceEndpoint, data)
+
+	if err != nil {
+		return fmt.Errorf("failed to request device code: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	var deviceResp struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to request device code: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&deviceResp); err != nil {
+		return fmt.Errorf("failed to decode device code response: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Please open this url in your browser:\n\n%s\n\n", deviceResp.VerificationURIComplete)
+
+	interval := time.Duration(deviceResp.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if deviceResp.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(deviceResp.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("login not completed in time: %w", ctx.Err())
+			}
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		form := url.Values{}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+		form.Set("device_code", deviceResp.DeviceCode)
+		form.Set("client_id", cfg.ClientID)
+
+		token, pending, err := cfg.poll(ctx, tokenEndpoint, form)
+		if err != nil {
+			return err
+		}
+		if token != nil {
+			cfg.Token = token
+			return nil
+		}
+		if pending == "slow_down" {
+			interval += 5 * time.Second
+		}
+	}
+
+}
+
+// Refresh renews cfg.Token with its refresh token, without the user. It
+// fails when Login was not granted a refresh token.
+func (cfg *Auth0Config) Refresh(ctx context.Context) error {
+	if cfg.Token == nil || cfg.Token.RefreshToken == "" {
+		return errors.New("no refresh token to renew the login with")
+	}
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", cfg.Token.RefreshToken)
+	form.Set("client_id", cfg.ClientID)
+
+	token, _, err := cfg.poll(ctx, fmt.Sprintf("https://%s/oauth/token", cfg.Domain), form)
+	if err != nil {
+		return fmt.Errorf("refreshing login: %w", err)
+	}
+	if token == nil {
+		return errors.New("refreshing login: no token received")
+	}
+	// Unless refresh tokens are rotated, the old one stays valid.
+	if token.RefreshToken == "" {
+		token.RefreshToken = cfg.Token.RefreshToken
+	}
+	cfg.Token = token
+	return nil
+}
+
+// poll makes one token request. It returns the token once the user has
+// approved, or the pending error code ("authorization_pending" or
+// "slow_down") while they have not.
+func (cfg *Auth0Config) poll(ctx context.Context, tokenEndpoint string, form url.Values) (*oauth2.Token, string, error) {
+	tokResp, err := postForm(ctx, tokenEndpoint, form)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tokResp.Body.Close()
+
+	var tokenData map[string]interface{}
+	json.NewDecoder(tokResp.Body).Decode(&tokenData)
+
+	if tokResp.StatusCode == http.StatusOK {
+
+		tokBytes, _ := json.Marshal(tokenData)
+		token := &oauth2.Token{}
+		json.Unmarshal(tokBytes, token)
+		if token.ExpiresIn > 0 {
+			token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+		}
+		return token, "", nil
+
+	}
+
+	switch code := tokenData["error"]; code {
+	case "authorization_pending", "slow_down":
+		return nil, code.(string), nil
+	case nil:
+		return nil, "", fmt.Errorf("login error: %s", tokResp.Status)
+	default:
+		return nil, "", fmt.Errorf("login error: %v", code)
+	}
+}
+
+func postForm(ctx context.Context, endpoint string, data url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return http.DefaultClient.Do(req)
+}
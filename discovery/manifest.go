@@ -0,0 +1,124 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Manifest is a machine-readable record of a run for auditing scheduled
+// jobs: who ran it, against what, and what happened.
+type Manifest struct {
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	// Status is the report's status, or "running" for a manifest taken
+	// while the run is still in progress.
+	Status string `json:"status"`
+
+	Host     string           `json:"host,omitempty"`
+	Command  []string         `json:"command,omitempty"`
+	Identity ManifestIdentity `json:"identity"`
+
+	Providers []string `json:"providers"`
+	Regions   []string `json:"regions"`
+
+	Services       int                  `json:"services"`
+	ServicesByType map[ResourceType]int `json:"servicesByType"`
+	APICalls       *APIStats            `json:"apiCalls,omitempty"`
+	Report         *RunReport           `json:"report"`
+}
+
+// ManifestIdentity is the principal a run used.
+type ManifestIdentity struct {
+	Provider  string `json:"provider"`
+	Principal string `json:"principal,omitempty"` // e.g. the assumed role ARN
+	AccountID string `json:"accountId,omitempty"`
+	Session   string `json:"session,omitempty"`
+}
+
+// NewManifest builds the manifest of a run from its report. Before the
+// report is finished, the manifest describes the run so far.
+func NewManifest(report *RunReport, identity ManifestIdentity, opts Options, calls *APIStats) *Manifest {
+	m := &Manifest{
+		Started:         report.Started,
+		Finished:        report.Finished,
+		DurationSeconds: report.Finished.Sub(report.Started).Seconds(),
+		Status:          report.Status(),
+		Command:         os.Args,
+		Identity:        identity,
+		Regions:         opts.Regions,
+		Services:        report.Services,
+		ServicesByType:  report.ServicesByType,
+		APICalls:        calls,
+		Report:          report,
+	}
+	if report.Finished.IsZero() {
+		m.DurationSeconds = time.Since(report.Started).Seconds()
+		m.Status = "running"
+	}
+	m.Host, _ = os.Hostname()
+	for _, p := range opts.Providers {
+		m.Providers = append(m.Providers, p.Name())
+	}
+	return m
+}
+
+// WriteFile writes the manifest as indented JSON to path.
+func (m *Manifest) WriteFile(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating manifest directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
+
+// APIStats counts the cloud API calls made during a run. Record is safe for
+// concurrent use.
+type APIStats struct {
+	Total     int `json:"total"`
+	Errors    int `json:"errors"`
+	Throttled int `json:"throttled"`
+	// ByOperation is keyed by "<service>:<operation>", e.g.
+	// "Lambda:GetFunction".
+	ByOperation map[string]int `json:"byOperation"`
+
+	mu sync.Mutex
+}
+
+// NewAPIStats returns empty call statistics.
+func NewAPIStats() *APIStats {
+	return &APIStats{ByOperation: map[string]int{}}
+}
+
+// MarshalJSON encodes the statistics. It is safe to call while calls are
+// still being recorded.
+func (s *APIStats) MarshalJSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	type stats APIStats
+	return json.Marshal((*stats)(s))
+}
+
+// Record counts one call attempt.
+func (s *APIStats) Record(service, operation string, err error, throttled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Total++
+	s.ByOperation[service+":"+operation]++
+	if err != nil {
+		s.Errors++
+	}
+	if throttled {
+		s.Throttled++
+	}
+}
@@ -0,0 +1,130 @@
+// Package metrics exposes Prometheus metrics for discovery runs, so a
+// scheduled discovery job can be monitored like any other service.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Metrics holds the discovery collectors. It is a discovery.ResultHandler;
+// pass it to discovery.Run alongside the other handlers.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	resources   *prometheus.CounterVec
+	errors      *prometheus.CounterVec
+	apiCalls    *prometheus.CounterVec
+	apiDuration *prometheus.HistogramVec
+	throttles   *prometheus.CounterVec
+	runs        *prometheus.CounterVec
+	runDuration prometheus.Histogram
+	lastRun     *prometheus.GaugeVec
+	lastCount   *prometheus.GaugeVec
+}
+
+// New returns Metrics registered on a fresh registry, together with the Go
+// runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		resources: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "discovery_resources_discovered_total",
+			Help: "Resources discovered, by provider and resource type.",
+		}, []string{"provider", "type"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "discovery_errors_total",
+			Help: "Scan errors, by provider, cataloger and cause.",
+		}, []string{"provider", "cataloger", "cause"}),
+		apiCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "discovery_api_calls_total",
+			Help: "Cloud API call attempts, by service, operation and outcome.",
+		}, []string{"service", "operation", "outcome"}),
+		apiDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "discovery_api_call_duration_seconds",
+			Help:    "Duration of cloud API call attempts.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"service", "operation"}),
+		throttles: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "discovery_api_throttles_total",
+			Help: "Cloud API call attempts rejected by throttling.",
+		}, []string{"service", "operation"}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "discovery_runs_total",
+			Help: "Discovery runs, by status (complete, partial, incomplete).",
+		}, []string{"status"}),
+		runDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "discovery_run_duration_seconds",
+			Help:    "Duration of discovery runs.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+		}),
+		lastRun: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "discovery_last_run_timestamp_seconds",
+			Help: "Unix time the last run finished, by status.",
+		}, []string{"status"}),
+		lastCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "discovery_last_run_resources",
+			Help: "Resources found by the last run, by resource type.",
+		}, []string{"type"}),
+	}
+	m.registry.MustRegister(
+		m.resources, m.errors, m.apiCalls, m.apiDuration, m.throttles,
+		m.runs, m.runDuration, m.lastRun, m.lastCount,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// HandleResult implements discovery.ResultHandler.
+func (m *Metrics) HandleResult(ctx context.Context, r discovery.Result) error {
+	if r.Err == nil {
+		m.resources.WithLabelValues(r.Service.Provider, string(r.Service.ResourceType)).Inc()
+		return nil
+	}
+	var provider, cataloger string
+	var se *discovery.ScanError
+	if errors.As(r.Err, &se) {
+		provider, cataloger = se.Provider, se.Cataloger
+	}
+	m.errors.WithLabelValues(provider, cataloger, discovery.ErrorCause(r.Err)).Inc()
+	return nil
+}
+
+// APICall records one API call attempt.
+func (m *Metrics) APICall(service, operation string, d time.Duration, err error, throttled bool) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	m.apiCalls.WithLabelValues(service, operation, outcome).Inc()
+	m.apiDuration.WithLabelValues(service, operation).Observe(d.Seconds())
+	if throttled {
+		m.throttles.WithLabelValues(service, operation).Inc()
+	}
+}
+
+// RunFinished records a finished run from its report.
+func (m *Metrics) RunFinished(r *discovery.RunReport) {
+	status := r.Status()
+	m.runs.WithLabelValues(status).Inc()
+	m.runDuration.Observe(r.Finished.Sub(r.Started).Seconds())
+	m.lastRun.WithLabelValues(status).Set(float64(r.Finished.Unix()))
+	m.lastCount.Reset()
+	for t, n := range r.ServicesByType {
+		m.lastCount.WithLabelValues(string(t)).Set(float64(n))
+	}
+}
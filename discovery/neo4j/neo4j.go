@@ -0,0 +1,88 @@
+// Package neo4j loads the dependency graph of discovered services into
+// Neo4j over Bolt, so it can be explored with graph tooling such as Neo4j
+// Browser and Bloom.
+package neo4j
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	driver "github.com/neo4j/neo4j-go-driver/v5/neo4j"
+
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+// Options configures a load.
+type Options struct {
+	// URI is the Bolt URI of the server, e.g. "neo4j://localhost:7687" or
+	// "neo4j+s://xxxx.databases.neo4j.io".
+	URI      string
+	Username string
+	Password string
+	// Database is the database to write to; the server's default when
+	// empty.
+	Database string
+	// Replace deletes the resources loaded before, and their
+	// relationships, in the same transaction as the load.
+	Replace bool
+}
+
+// Validate reports whether opts name a server.
+func (opts Options) Validate() error {
+	if opts.URI == "" {
+		return errors.New("neo4j needs a Bolt URI (--uri or NEO4J_URI)")
+	}
+	return nil
+}
+
+// Load merges g into the database at opts.URI with the statements of
+// graph.CypherStatements: the constraint first, since schema changes commit
+// on their own, then the nodes and relationships in one transaction.
+func Load(ctx context.Context, g *graph.Graph, opts Options) error {
+	auth := driver.NoAuth()
+	if opts.Username != "" {
+		auth = driver.BasicAuth(opts.Username, opts.Password, "")
+	}
+	d, err := driver.NewDriverWithContext(opts.URI, auth)
+	if err != nil {
+		return fmt.Errorf("neo4j: %w", err)
+	}
+	defer d.Close(ctx)
+	if err := d.VerifyConnectivity(ctx); err != nil {
+		return fmt.Errorf("neo4j: connecting to %s: %w", opts.URI, err)
+	}
+
+	session := d.NewSession(ctx, driver.SessionConfig{DatabaseName: opts.Database, AccessMode: driver.AccessModeWrite})
+	defer session.Close(ctx)
+
+	statements := g.CypherStatements()
+	constraint, data := statements[0], statements[1:]
+	if err := write(ctx, session, constraint); err != nil {
+		return err
+	}
+	if opts.Replace {
+		data = append([]graph.CypherStatement{{Cypher: "MATCH (n:" + graph.CypherLabel + ") DETACH DELETE n"}}, data...)
+	}
+	return write(ctx, session, data...)
+}
+
+// write runs statements in one write transaction.
+func write(ctx context.Context, session driver.SessionWithContext, statements ...graph.CypherStatement) error {
+	_, err := session.ExecuteWrite(ctx, func(tx driver.ManagedTransaction) (any, error) {
+		for _, s := range statements {
+			result, err := tx.Run(ctx, s.Cypher, s.Params)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := result.Consume(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("neo4j: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// title is the headline of a message, e.g. "Discovery run complete: 1203
+// services".
+func title(s Summary) string {
+	return fmt.Sprintf("Discovery run %s: %d services", s.Report.Status(), s.Report.Services)
+}
+
+// facts are the name-value lines of a message, in order.
+func facts(s Summary) [][2]string {
+	r := s.Report
+	f := [][2]string{
+		{"Duration", r.Finished.Sub(r.Started).Round(time.Second).String()},
+	}
+	if r.Incomplete {
+		f = append(f, [2]string{"Stopped", r.StopReason})
+	}
+	if len(r.Errors) > 0 {
+		f = append(f, [2]string{"Errors", fmt.Sprintf("%d resources skipped, %d regions or catalogers failed", r.SkippedResources, r.FailedScopes)})
+	}
+	if s.Baseline != "" {
+		change := fmt.Sprintf("%d added, %d changed, %d removed", s.Added, s.Changed, s.Removed)
+		if r.Status() != "complete" {
+			change = fmt.Sprintf("%d added, %d changed (removals are only reported for complete runs)", s.Added, s.Changed)
+		}
+		f = append(f, [2]string{"Since " + s.Baseline, change})
+	}
+	return f
+}
+
+// notableLines describes up to max notable changes, with code wrapping
+// service names, and a last line counting the rest.
+func notableLines(s Summary, max int, code func(string) string) []string {
+	var lines []string
+	for i, n := range s.Notable {
+		if i == max {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(s.Notable)-max))
+			break
+		}
+		svc := n.Service
+		line := fmt.Sprintf("%s %s (%s, %s)", capitalize(n.Kind), code(svc.Name), svc.AccountLabel(), svc.Region)
+		if n.Detail != "" {
+			line += ": " + n.Detail
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// slackMessage renders s for a Slack incoming webhook with Block Kit.
+func slackMessage(s Summary, max int) map[string]any {
+	var body strings.Builder
+	for _, f := range facts(s) {
+		fmt.Fprintf(&body, "*%s:* %s\n", f[0], f[1])
+	}
+	blocks := []map[string]any{
+		{"type": "header", "text": map[string]any{"type": "plain_text", "text": title(s)}},
+		{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": body.String()}},
+	}
+	if lines := notableLines(s, max, func(v string) string { return "`" + v + "`" }); len(lines) > 0 {
+		blocks = append(blocks, map[string]any{
+			"type": "section",
+			"text": map[string]any{"type": "mrkdwn", "text": "• " + strings.Join(lines, "\n• ")},
+		})
+	}
+	return map[string]any{"text": title(s), "blocks": blocks}
+}
+
+// teamsMessage renders s as an Adaptive Card, which both Teams workflow
+// webhooks and the older connector webhooks accept.
+func teamsMessage(s Summary, max int) map[string]any {
+	var factSet []map[string]any
+	for _, f := range facts(s) {
+		factSet = append(factSet, map[string]any{"title": f[0], "value": f[1]})
+	}
+	body := []map[string]any{
+		{"type": "TextBlock", "text": title(s), "weight": "Bolder", "size": "Medium", "wrap": true},
+		{"type": "FactSet", "facts": factSet},
+	}
+	if lines := notableLines(s, max, func(v string) string { return v }); len(lines) > 0 {
+		body = append(body, map[string]any{"type": "TextBlock", "text": "- " + strings.Join(lines, "\n- "), "wrap": true})
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+}
@@ -0,0 +1,235 @@
+// Package notify posts a summary of every discovery run to chat - Slack or
+// Microsoft Teams incoming webhooks - with the changes worth a human's
+// attention, such as removed services and runtime downgrades.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/sink"
+)
+
+// Webhook kinds.
+const (
+	Slack = "slack"
+	Teams = "teams"
+)
+
+// DefaultMaxNotable bounds the notable changes listed in a message when
+// Options sets no limit.
+const DefaultMaxNotable = 10
+
+// Webhook is an incoming webhook of a chat service.
+type Webhook struct {
+	// Kind is Slack or Teams.
+	Kind string
+	URL  string
+}
+
+// Options configure a Notifier.
+type Options struct {
+	Webhooks []Webhook
+	// Changes, if set, compares the run with a baseline snapshot, for the
+	// change counts and notable changes.
+	Changes *sink.Changes
+	// MaxNotable bounds the notable changes listed; the rest are counted.
+	MaxNotable int
+	Client     *http.Client
+}
+
+// Validate reports whether every webhook has a URL and a known kind.
+func (o Options) Validate() error {
+	for _, w := range o.Webhooks {
+		if w.URL == "" {
+			return fmt.Errorf("%s notification needs a webhook_url", w.Kind)
+		}
+		if w.Kind != Slack && w.Kind != Teams {
+			return fmt.Errorf("unknown notification kind %q (supported: %s, %s)", w.Kind, Slack, Teams)
+		}
+	}
+	return nil
+}
+
+// Notable kinds.
+const (
+	NotableRemoved          = "removed"
+	NotableRuntimeDowngrade = "runtime downgrade"
+)
+
+// Notable is a change called out by name in a message.
+type Notable struct {
+	Kind    string
+	Service discovery.Service
+	// Detail describes the change, e.g. "python3.12 → python3.9".
+	Detail string
+}
+
+// Summary is what a message reports about a run.
+type Summary struct {
+	Report *discovery.RunReport
+	// Baseline is the snapshot the run was compared with; the counts and
+	// Notable are only set with one.
+	Baseline                string
+	Added, Changed, Removed int
+	Notable                 []Notable
+}
+
+// Notifier collects a Summary as services are discovered and posts it to
+// every webhook once the run ends. It is a sink.Sink.
+type Notifier struct {
+	opts    Options
+	summary Summary
+}
+
+// New returns a notifier posting to opts.Webhooks.
+func New(opts Options) (*Notifier, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.MaxNotable <= 0 {
+		opts.MaxNotable = DefaultMaxNotable
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	n := &Notifier{opts: opts}
+	if opts.Changes != nil {
+		n.summary.Baseline = opts.Changes.Baseline()
+	}
+	return n, nil
+}
+
+func (n *Notifier) Name() string {
+	return "notifications"
+}
+
+func (n *Notifier) Write(ctx context.Context, s discovery.Service) error {
+	c := n.opts.Changes
+	if c == nil {
+		return nil
+	}
+	prev, _ := c.Previous(s)
+	switch kind, _ := c.Observe(s); kind {
+	case sink.ChangeAdded:
+		n.summary.Added++
+	case sink.ChangeChanged:
+		n.summary.Changed++
+		if before, after := runtime(prev), runtime(s); RuntimeDowngrade(before, after) {
+			n.summary.Notable = append(n.summary.Notable, Notable{
+				Kind:    NotableRuntimeDowngrade,
+				Service: s,
+				Detail:  before + " → " + after,
+			})
+		}
+	}
+	return nil
+}
+
+// Finish posts the summary. Removed services are only counted after a
+// complete run.
+func (n *Notifier) Finish(ctx context.Context, report *discovery.RunReport) error {
+	n.summary.Report = report
+	if c := n.opts.Changes; c != nil && report.Status() == "complete" {
+		for _, s := range c.Removed() {
+			n.summary.Removed++
+			n.summary.Notable = append(n.summary.Notable, Notable{Kind: NotableRemoved, Service: s})
+		}
+	}
+	var errs []error
+	for _, w := range n.opts.Webhooks {
+		var payload any
+		switch w.Kind {
+		case Slack:
+			payload = slackMessage(n.summary, n.opts.MaxNotable)
+		case Teams:
+			payload = teamsMessage(n.summary, n.opts.MaxNotable)
+		}
+		if err := n.post(ctx, w.URL, payload); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", w.Kind, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) post(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+func runtime(s discovery.Service) string {
+	if s.Details.Lambda == nil {
+		return ""
+	}
+	return s.Details.Lambda.Runtime
+}
+
+// RuntimeDowngrade reports whether a Lambda runtime changed to an older
+// version of the same language, e.g. from python3.12 to python3.9 or from
+// provided.al2023 to provided.al2.
+func RuntimeDowngrade(before, after string) bool {
+	lb, vb := runtimeVersion(before)
+	la, va := runtimeVersion(after)
+	if lb == "" || lb != la {
+		return false
+	}
+	for i := 0; i < len(vb) && i < len(va); i++ {
+		if va[i] != vb[i] {
+			return va[i] < vb[i]
+		}
+	}
+	return len(va) < len(vb)
+}
+
+// runtimeVersion splits a runtime identifier into its language and version
+// numbers: "python3.12" is python 3.12, "nodejs20.x" nodejs 20,
+// "dotnetcore3.1" dotnet 3.1 and "provided.al2023" provided 2023 (plain
+// "provided", on Amazon Linux 1, has no version).
+func runtimeVersion(r string) (string, []int) {
+	i := strings.IndexFunc(r, func(c rune) bool { return c < 'a' || c > 'z' })
+	if i < 0 {
+		i = len(r)
+	}
+	lang, rest := r[:i], r[i:]
+	switch lang {
+	case "dotnetcore":
+		lang = "dotnet"
+	case "provided":
+		rest = strings.TrimPrefix(rest, ".al")
+	}
+	var version []int
+	for _, part := range strings.Split(rest, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		version = append(version, n)
+	}
+	return lang, version
+}
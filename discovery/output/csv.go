@@ -0,0 +1,60 @@
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// csvWriter renders results as CSV, one row per result with a header row,
+// for loading into spreadsheets. Nested details are flattened through
+// Columnar, one column each.
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+	header  bool
+	rows    int
+}
+
+func newCSVWriter(w io.Writer, columns []string) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w), columns: columns}
+}
+
+func (c *csvWriter) Write(v any) error {
+	row, ok := v.(Columnar)
+	if !ok {
+		return fmt.Errorf("%T cannot be rendered as CSV", v)
+	}
+	if !c.header {
+		c.writeHeader()
+	}
+	cells := make([]string, len(c.columns))
+	for i, name := range c.columns {
+		value, ok := row.Column(name)
+		if !ok {
+			return fmt.Errorf("unknown column %q", name)
+		}
+		cells[i] = value
+	}
+	if err := c.w.Write(cells); err != nil {
+		return err
+	}
+	if c.rows++; c.rows%tableBlock == 0 {
+		c.w.Flush()
+		return c.w.Error()
+	}
+	return nil
+}
+
+func (c *csvWriter) writeHeader() {
+	c.header = true
+	c.w.Write(c.columns)
+}
+
+func (c *csvWriter) Close() error {
+	if !c.header {
+		c.writeHeader()
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,136 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// jsonWriter emits a single JSON document whose services are written as they
+// arrive, so memory stays flat however many results there are:
+//
+//	{"schemaVersion": "1.0", "services": [...], "report": {...}}
+//
+// The document is completed on Close, so it is valid even for partial runs.
+// A --query needs the whole document, so with one every value is kept until
+// Close instead.
+type jsonWriter struct {
+	w     *bufio.Writer
+	query *jmespath.JMESPath
+
+	// items holds encoded values when a query is set.
+	items []json.RawMessage
+	// n counts streamed values; raw and indented are reused for each one.
+	n             int
+	raw, indented bytes.Buffer
+	report        any
+}
+
+// jsonDocument is the top-level shape of JSON output, described by Schema.
+type jsonDocument struct {
+	SchemaVersion string            `json:"schemaVersion"`
+	Services      []json.RawMessage `json:"services"`
+	Report        any               `json:"report,omitempty"`
+}
+
+// jsonHeader opens the streamed document, up to the services array.
+const jsonHeader = "{\n  \"schemaVersion\": \"" + SchemaVersion + "\",\n  \"services\": ["
+
+func newJSONWriter(w io.Writer, query string) (*jsonWriter, error) {
+	jw := &jsonWriter{w: bufio.NewWriter(w)}
+	if query != "" {
+		q, err := jmespath.Compile(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --query expression: %w", err)
+		}
+		jw.query = q
+		jw.items = []json.RawMessage{}
+	}
+	return jw, nil
+}
+
+func (j *jsonWriter) Write(v any) error {
+	// Encode immediately: the caller may reuse v once Write returns.
+	if j.query != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("encoding result: %w", err)
+		}
+		j.items = append(j.items, data)
+		return nil
+	}
+
+	j.raw.Reset()
+	j.indented.Reset()
+	enc := json.NewEncoder(&j.raw)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("encoding result: %w", err)
+	}
+	if err := json.Indent(&j.indented, bytes.TrimSpace(j.raw.Bytes()), "    ", "  "); err != nil {
+		return err
+	}
+	sep := ",\n    "
+	if j.n == 0 {
+		sep = jsonHeader + "\n    "
+	}
+	j.n++
+	if _, err := j.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err := j.w.Write(j.indented.Bytes())
+	return err
+}
+
+// Summary implements Summarizer.
+func (j *jsonWriter) Summary(v any) {
+	j.report = v
+}
+
+func (j *jsonWriter) Close() error {
+	if j.query != nil {
+		return j.closeQuery()
+	}
+	if j.n == 0 {
+		j.w.WriteString(jsonHeader)
+	} else {
+		j.w.WriteString("\n  ")
+	}
+	j.w.WriteString("]")
+	if j.report != nil {
+		data, err := json.MarshalIndent(j.report, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		j.w.WriteString(",\n  \"report\": ")
+		j.w.Write(data)
+	}
+	j.w.WriteString("\n}\n")
+	return j.w.Flush()
+}
+
+func (j *jsonWriter) closeQuery() error {
+	// JMESPath evaluates against plain decoded JSON values.
+	raw, err := json.Marshal(jsonDocument{SchemaVersion: SchemaVersion, Services: j.items, Report: j.report})
+	if err != nil {
+		return err
+	}
+	var data any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return err
+	}
+	result, err := j.query.Search(data)
+	if err != nil {
+		return fmt.Errorf("evaluating --query: %w", err)
+	}
+
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
@@ -0,0 +1,145 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Writer renders discovered services to an underlying stream. Writers may
+// buffer, so Close must always be called, including after a cancelled run,
+// to flush whatever was written.
+type Writer interface {
+	// Write renders v. Implementations must not retain v after returning,
+	// since callers recycle the values they pass in; the exception is the
+	// writer New returns for Options.SortBy, which keeps every v until Close.
+	Write(v any) error
+	Close() error
+}
+
+// Summarizer is implemented by writers whose document includes a summary of
+// the run, such as the JSON writer. Summary must be called before Close.
+type Summarizer interface {
+	Summary(v any)
+}
+
+// Options shape how results are rendered.
+type Options struct {
+	// Query is a JMESPath expression applied to the JSON document of all
+	// results. Setting it implies JSON output.
+	Query string
+	// Template is a Go text/template executed once per result, e.g.
+	// '{{.Name}} {{.Details.Lambda.Runtime}}'. It overrides the format.
+	Template string
+	// Columns are the table or CSV columns, in order. Empty means
+	// DefaultColumns for tables and CSVColumns for CSV.
+	Columns []string
+	// Tags are the tag keys exported as their own CSV columns. When set,
+	// the default CSV columns leave out the combined "tags" column, so only
+	// these tags are exported.
+	Tags []string
+	// GroupBy, when set to a column, replaces the results with the number
+	// of them per value of the column, e.g. per owner.
+	GroupBy string
+	// SortBy, when set to a column, writes the results sorted by it: the
+	// discovery.NumericColumns, such as costs, largest first, other columns
+	// in ascending order.
+	// With GroupBy, only "cost" is accepted, and sorts the groups by their
+	// total cost.
+	SortBy string
+}
+
+// DefaultColumns are the table columns used when none are requested.
+var DefaultColumns = []string{"name", "region", "runtime", "last-modified"}
+
+// CSVColumns are the CSV columns used when none are requested: every
+// attribute of a service, so a row is its whole record.
+var CSVColumns = discovery.ServiceColumns
+
+// Formats lists the supported values for the format argument of New.
+var Formats = []string{"table", "text", "json", "yaml", "csv"}
+
+// New returns a Writer for format that writes to w.
+func New(format string, w io.Writer, opts Options) (Writer, error) {
+	if opts.Query != "" && opts.Template != "" {
+		return nil, errors.New("--query and --format cannot be combined")
+	}
+	if opts.GroupBy != "" {
+		if opts.Query != "" || opts.Template != "" {
+			return nil, errors.New("--group-by cannot be combined with --query or --format")
+		}
+		if opts.SortBy != "" && opts.SortBy != "cost" {
+			return nil, errors.New("--sort-by with --group-by only sorts groups by cost")
+		}
+		return newRollupWriter(w, strings.ToLower(format), opts.GroupBy, opts.SortBy == "cost")
+	}
+	out, err := newWriter(format, w, opts)
+	if err != nil || opts.SortBy == "" {
+		return out, err
+	}
+	return newSortWriter(out, opts.SortBy), nil
+}
+
+// newWriter returns the Writer for format, or for the template or query of
+// opts.
+func newWriter(format string, w io.Writer, opts Options) (Writer, error) {
+	if opts.Template != "" {
+		return newTemplateWriter(w, opts.Template)
+	}
+	if opts.Query != "" {
+		format = "json"
+	}
+
+	switch strings.ToLower(format) {
+	case "", "table":
+		columns := opts.Columns
+		if len(columns) == 0 {
+			columns = DefaultColumns
+		}
+		return newTableWriter(w, columns), nil
+	case "text":
+		return &textWriter{w: w}, nil
+	case "json":
+		return newJSONWriter(w, opts.Query)
+	case "yaml", "yml":
+		return newYAMLWriter(w), nil
+	case "csv":
+		return newCSVWriter(w, csvColumns(opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q (supported: %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// textWriter prints each value in Go's default format as soon as it arrives.
+type textWriter struct {
+	w io.Writer
+}
+
+func (t *textWriter) Write(v any) error {
+	_, err := fmt.Fprintln(t.w, v)
+	return err
+}
+
+func (t *textWriter) Close() error {
+	return nil
+}
+
+// csvColumns returns the CSV columns for opts: the requested or default
+// columns followed by one column per allowed tag.
+func csvColumns(opts Options) []string {
+	columns := opts.Columns
+	if len(columns) == 0 {
+		for _, c := range CSVColumns {
+			if c != "tags" || len(opts.Tags) == 0 {
+				columns = append(columns, c)
+			}
+		}
+	}
+	for _, t := range opts.Tags {
+		columns = append(columns, "tag:"+t)
+	}
+	return columns
+}
@@ -0,0 +1,195 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Ungrouped is the group of results without a value for the group-by
+// column.
+const Ungrouped = "(none)"
+
+// Group is one row of a rollup: the results sharing a value of the
+// group-by column.
+type Group struct {
+	Group    string `json:"group"`
+	Services int    `json:"services"`
+	// ByType counts the results of each resource type.
+	ByType map[string]int `json:"byType"`
+	// Cost sums the monthly costs of the results that have one. A cost
+	// attributed by tag is that of everything sharing the tag's value, so
+	// it is counted once per group however many results share it.
+	Cost float64 `json:"cost,omitempty"`
+	// tagged are the tag values, as "tag:<key>=<value>", whose cost is
+	// already in Cost.
+	tagged map[string]bool
+}
+
+// rollupDocument is the JSON and YAML form of a rollup.
+type rollupDocument struct {
+	GroupBy string  `json:"groupBy"`
+	Groups  []Group `json:"groups"`
+}
+
+// Rollup counts results per value of a column, e.g. their owner, and sums
+// their costs.
+type Rollup struct {
+	by     string
+	groups map[string]*Group
+	// ByCost orders the groups by cost instead of by size.
+	ByCost bool
+}
+
+// NewRollup returns an empty rollup by the column by.
+func NewRollup(by string) *Rollup {
+	return &Rollup{by: by, groups: map[string]*Group{}}
+}
+
+// Add counts row in its group.
+func (r *Rollup) Add(row Columnar) error {
+	key, ok := row.Column(r.by)
+	if !ok {
+		return fmt.Errorf("unknown column %q", r.by)
+	}
+	if key == "" {
+		key = Ungrouped
+	}
+	g, ok := r.groups[key]
+	if !ok {
+		g = &Group{Group: key, ByType: map[string]int{}, tagged: map[string]bool{}}
+		r.groups[key] = g
+	}
+	g.Services++
+	typ, _ := row.Column("type")
+	g.ByType[typ]++
+	cost, _ := row.Column("cost")
+	if cost == "" {
+		return nil
+	}
+	if source, _ := row.Column("cost-source"); strings.HasPrefix(source, discovery.TagColumnPrefix) {
+		value, _ := row.Column(source)
+		if g.tagged[source+"="+value] {
+			return nil
+		}
+		g.tagged[source+"="+value] = true
+	}
+	c, err := strconv.ParseFloat(cost, 64)
+	if err != nil {
+		return fmt.Errorf("parsing cost %q: %w", cost, err)
+	}
+	g.Cost += c
+	return nil
+}
+
+// Groups returns the groups, largest or, with ByCost, costliest first.
+func (r *Rollup) Groups() []Group {
+	groups := make([]Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if r.ByCost && groups[i].Cost != groups[j].Cost {
+			return groups[i].Cost > groups[j].Cost
+		}
+		if groups[i].Services != groups[j].Services {
+			return groups[i].Services > groups[j].Services
+		}
+		return groups[i].Group < groups[j].Group
+	})
+	return groups
+}
+
+// rollupWriter writes a Rollup of the results in its format on Close
+// instead of the results.
+type rollupWriter struct {
+	*Rollup
+	w      io.Writer
+	format string
+}
+
+func newRollupWriter(w io.Writer, format, by string, byCost bool) (*rollupWriter, error) {
+	switch format {
+	case "", "table", "csv", "json", "yaml", "yml":
+	default:
+		return nil, fmt.Errorf("--group-by only applies to table, csv, json and yaml output, not %q", format)
+	}
+	r := &rollupWriter{Rollup: NewRollup(by), w: w, format: format}
+	r.ByCost = byCost
+	return r, nil
+}
+
+func (r *rollupWriter) Write(v any) error {
+	row, ok := v.(Columnar)
+	if !ok {
+		return fmt.Errorf("%T cannot be grouped", v)
+	}
+	return r.Add(row)
+}
+
+func (r *rollupWriter) Close() error {
+	groups := r.Groups()
+	switch r.format {
+	case "json":
+		enc := json.NewEncoder(r.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rollupDocument{GroupBy: r.by, Groups: groups})
+	case "yaml", "yml":
+		return WriteYAML(r.w, rollupDocument{GroupBy: r.by, Groups: groups})
+	}
+	// Costs get a column only when there are any.
+	costs := false
+	for _, g := range groups {
+		costs = costs || g.Cost != 0
+	}
+	header := []string{r.by, "services", "types"}
+	if costs {
+		header = append(header, "cost")
+	}
+	rows := make([][]string, len(groups))
+	for i, g := range groups {
+		rows[i] = []string{g.Group, strconv.Itoa(g.Services), typeCounts(g.ByType)}
+		if costs {
+			rows[i] = append(rows[i], strconv.FormatFloat(g.Cost, 'f', 2, 64))
+		}
+	}
+	if r.format == "csv" {
+		cw := csv.NewWriter(r.w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	}
+	tw := tabwriter.NewWriter(r.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// typeCounts formats counts by type, largest first, e.g.
+// "AWS::Lambda::Function=10, AWS::SQS::Queue=2".
+func typeCounts(counts map[string]int) string {
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if counts[types[i]] != counts[types[j]] {
+			return counts[types[i]] > counts[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = t + "=" + strconv.Itoa(counts[t])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,112 @@
+package output_test
+
+import (
+	"testing"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/output"
+)
+
+// costed returns a service owned by owner with tags and a monthly cost
+// attributed by source.
+func costed(owner string, tags map[string]string, monthly float64, source string) discovery.Service {
+	s := discovery.Service{Name: "fn", ResourceType: discovery.ResourceTypeLambdaFunction, Owner: owner, Tags: tags}
+	if source != "" {
+		s.Cost = &discovery.Cost{Monthly: monthly, Currency: "USD", Source: source}
+	}
+	return s
+}
+
+func TestRollupCost(t *testing.T) {
+	payments := map[string]string{"team": "payments"}
+	search := map[string]string{"team": "search"}
+	tests := []struct {
+		name     string
+		services []discovery.Service
+		// want is the cost of each group.
+		want map[string]float64
+	}{
+		{
+			name: "resources",
+			services: []discovery.Service{
+				costed("payments", nil, 10, "resource"),
+				costed("payments", nil, 5.5, "resource"),
+				costed("search", nil, 1, "resource"),
+			},
+			want: map[string]float64{"payments": 15.5, "search": 1},
+		},
+		{
+			name: "tag value counted once",
+			services: []discovery.Service{
+				costed("payments", payments, 100, "tag:team"),
+				costed("payments", payments, 100, "tag:team"),
+				costed("payments", payments, 100, "tag:team"),
+			},
+			want: map[string]float64{"payments": 100},
+		},
+		{
+			name: "tag values and resources",
+			services: []discovery.Service{
+				costed("payments", payments, 100, "tag:team"),
+				costed("payments", payments, 7, "resource"),
+				costed("payments", search, 40, "tag:team"),
+				costed("payments", payments, 100, "tag:team"),
+				costed("payments", search, 40, "tag:team"),
+			},
+			want: map[string]float64{"payments": 147},
+		},
+		{
+			name: "tag value shared by groups",
+			services: []discovery.Service{
+				costed("payments", payments, 100, "tag:team"),
+				costed("search", payments, 100, "tag:team"),
+				costed("search", payments, 100, "tag:team"),
+			},
+			want: map[string]float64{"payments": 100, "search": 100},
+		},
+		{
+			name: "without costs",
+			services: []discovery.Service{
+				costed("payments", nil, 0, ""),
+				costed("", payments, 100, "tag:team"),
+				costed("", nil, 0, ""),
+			},
+			want: map[string]float64{"payments": 0, output.Ungrouped: 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := output.NewRollup("owner")
+			for _, s := range tt.services {
+				if err := r.Add(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+			groups := r.Groups()
+			if len(groups) != len(tt.want) {
+				t.Errorf("got %d groups, want %d", len(groups), len(tt.want))
+			}
+			for _, g := range groups {
+				if want, ok := tt.want[g.Group]; !ok || g.Cost != want {
+					t.Errorf("group %s costs %v, want %v", g.Group, g.Cost, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRollupByCost(t *testing.T) {
+	payments := map[string]string{"team": "payments"}
+	r := output.NewRollup("owner")
+	r.ByCost = true
+	// Ten services sharing a tag value cost less than one costly resource.
+	for i := 0; i < 10; i++ {
+		r.Add(costed("payments", payments, 20, "tag:team"))
+	}
+	r.Add(costed("search", nil, 50, "resource"))
+
+	groups := r.Groups()
+	if len(groups) != 2 || groups[0].Group != "search" || groups[1].Group != "payments" {
+		t.Errorf("got groups %+v, want search then payments", groups)
+	}
+}
@@ -0,0 +1,13 @@
+package output
+
+import _ "embed"
+
+// SchemaVersion is the version of the JSON output document, recorded in its
+// "schemaVersion" field. The minor version goes up when fields are added; the
+// major version only when existing fields change meaning or are removed.
+const SchemaVersion = "1.17"
+
+// Schema is the JSON Schema of the JSON output document, for SchemaVersion.
+//
+//go:embed schema/v1.json
+var Schema []byte
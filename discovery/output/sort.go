@@ -0,0 +1,105 @@
+package output
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// sortWriter passes the results it is given on to its writer on Close,
+// sorted by a column. It keeps every result until then, so its callers
+// must not reuse the values they pass in.
+type sortWriter struct {
+	Writer
+	by   string
+	rows []sortRow
+}
+
+type sortRow struct {
+	key sortKey
+	v   any
+}
+
+// sortKey is a column value as it sorts: by its class, then numbers largest
+// first and text in ascending order.
+type sortKey struct {
+	class  sortClass
+	number float64
+	text   string
+}
+
+// sortClass orders the kinds of column values: numbers, then text, which
+// a numeric column holds only if a value does not parse, then empty values.
+type sortClass int
+
+const (
+	sortNumber sortClass = iota
+	sortText
+	sortEmpty
+)
+
+func newSortWriter(w Writer, by string) *sortWriter {
+	return &sortWriter{Writer: w, by: by}
+}
+
+// sortKeyOf returns the sort key of the value of column by.
+func sortKeyOf(by, value string) sortKey {
+	if value == "" {
+		return sortKey{class: sortEmpty}
+	}
+	if slices.Contains(discovery.NumericColumns, by) {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return sortKey{class: sortNumber, number: n}
+		}
+	}
+	return sortKey{class: sortText, text: value}
+}
+
+func (s *sortWriter) Write(v any) error {
+	row, ok := v.(Columnar)
+	if !ok {
+		return fmt.Errorf("%T cannot be sorted", v)
+	}
+	key, ok := row.Column(s.by)
+	if !ok {
+		return fmt.Errorf("unknown column %q", s.by)
+	}
+	s.rows = append(s.rows, sortRow{key: sortKeyOf(s.by, key), v: v})
+	return nil
+}
+
+// Summary passes the summary of the run on to the writer, if it takes one.
+func (s *sortWriter) Summary(v any) {
+	if sum, ok := s.Writer.(Summarizer); ok {
+		sum.Summary(v)
+	}
+}
+
+func (s *sortWriter) Close() error {
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		return sortsBefore(s.rows[i].key, s.rows[j].key)
+	})
+	for _, r := range s.rows {
+		if err := s.Writer.Write(r.v); err != nil {
+			s.Writer.Close()
+			return err
+		}
+	}
+	s.rows = nil
+	return s.Writer.Close()
+}
+
+// sortsBefore reports whether a sorts before b: numbers, such as costs,
+// largest first, text in ascending order, and empty values last.
+func sortsBefore(a, b sortKey) bool {
+	switch {
+	case a.class != b.class:
+		return a.class < b.class
+	case a.class == sortNumber:
+		return a.number > b.number
+	}
+	return a.text < b.text
+}
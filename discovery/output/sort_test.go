@@ -0,0 +1,76 @@
+package output_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/output"
+)
+
+func TestSortBy(t *testing.T) {
+	// lambda returns a function named name with memory, or none when 0.
+	lambda := func(name string, memory int32) discovery.Service {
+		return discovery.Service{Name: name, Details: discovery.Details{Lambda: &discovery.LambdaDetails{MemorySize: memory}}}
+	}
+	tagged := func(name, team string) discovery.Service {
+		s := discovery.Service{Name: name}
+		if team != "" {
+			s.Tags = map[string]string{"team": team}
+		}
+		return s
+	}
+	tests := []struct {
+		name     string
+		by       string
+		services []discovery.Service
+		want     string
+	}{
+		{
+			name:     "numbers largest first",
+			by:       "memory",
+			services: []discovery.Service{lambda("a", 128), lambda("b", 0), lambda("c", 1024), lambda("d", 512)},
+			want:     "c d a b",
+		},
+		{
+			name:     "numeric names as text",
+			by:       "name",
+			services: []discovery.Service{lambda("2", 0), lambda("1", 0), lambda("15x", 0), lambda("10", 0)},
+			want:     "1 10 15x 2",
+		},
+		{
+			name:     "numeric tags as text",
+			by:       "tag:team",
+			services: []discovery.Service{tagged("a", "9"), tagged("b", "10"), tagged("c", ""), tagged("d", "x")},
+			want:     "b a d c",
+		},
+		{
+			name:     "stable for equal values",
+			by:       "tag:team",
+			services: []discovery.Service{tagged("a", "x"), tagged("b", ""), tagged("c", "x"), tagged("d", "")},
+			want:     "a c b d",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := output.New("csv", &buf, output.Options{Columns: []string{"name"}, SortBy: tt.by})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.services {
+				if err := w.Write(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			rows := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if got := strings.Join(rows[1:], " "); got != tt.want {
+				t.Errorf("sorted %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
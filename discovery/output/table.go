@@ -0,0 +1,83 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Columnar is implemented by results that can be rendered as table rows.
+type Columnar interface {
+	// Column returns the value of the named column and whether the column
+	// exists.
+	Column(name string) (string, bool)
+}
+
+// tableBlock is how many rows are aligned together. Rows are flushed in
+// blocks so a huge table never sits in memory; column widths may change from
+// one block to the next.
+const tableBlock = 1000
+
+// tableWriter renders results as aligned columns. Alignment needs the rows
+// of a block, so output appears a block at a time and when the writer is
+// closed.
+type tableWriter struct {
+	tw      *tabwriter.Writer
+	columns []string
+	header  bool
+	rows    int
+}
+
+func newTableWriter(w io.Writer, columns []string) *tableWriter {
+	return &tableWriter{
+		tw:      tabwriter.NewWriter(w, 0, 4, 2, ' ', 0),
+		columns: columns,
+	}
+}
+
+func (t *tableWriter) Write(v any) error {
+	row, ok := v.(Columnar)
+	if !ok {
+		return fmt.Errorf("%T cannot be rendered as a table", v)
+	}
+
+	if !t.header {
+		t.writeHeader()
+	}
+	cells := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		value, ok := row.Column(c)
+		if !ok {
+			return fmt.Errorf("unknown column %q", c)
+		}
+		if value == "" {
+			value = "-"
+		}
+		// Tabs and newlines would break the alignment.
+		cells[i] = strings.Join(strings.Fields(value), " ")
+	}
+	if _, err := fmt.Fprintln(t.tw, strings.Join(cells, "\t")); err != nil {
+		return err
+	}
+	if t.rows++; t.rows%tableBlock == 0 {
+		return t.tw.Flush()
+	}
+	return nil
+}
+
+func (t *tableWriter) writeHeader() {
+	t.header = true
+	names := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = strings.ToUpper(c)
+	}
+	fmt.Fprintln(t.tw, strings.Join(names, "\t"))
+}
+
+func (t *tableWriter) Close() error {
+	if !t.header {
+		t.writeHeader()
+	}
+	return t.tw.Flush()
+}
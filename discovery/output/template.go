@@ -0,0 +1,48 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are available to --format templates in addition to the
+// text/template builtins.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// templateWriter executes a Go template once per result, in the style of
+// `docker ps --format`. Each execution is terminated with a newline.
+type templateWriter struct {
+	w    io.Writer
+	tmpl *template.Template
+}
+
+func newTemplateWriter(w io.Writer, text string) (*templateWriter, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --format template: %w", err)
+	}
+	return &templateWriter{w: w, tmpl: tmpl}, nil
+}
+
+func (t *templateWriter) Write(v any) error {
+	if err := t.tmpl.Execute(t.w, v); err != nil {
+		return fmt.Errorf("executing --format template: %w", err)
+	}
+	_, err := io.WriteString(t.w, "\n")
+	return err
+}
+
+func (t *templateWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,139 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlWriter emits the same document as jsonWriter, in YAML and with the same
+// field names, streaming services as they arrive:
+//
+//	schemaVersion: "1.0"
+//	services:
+//	  - provider: aws
+//	    ...
+//	report:
+//	  ...
+type yamlWriter struct {
+	w      *bufio.Writer
+	n      int
+	buf    bytes.Buffer
+	report any
+}
+
+func newYAMLWriter(w io.Writer) *yamlWriter {
+	return &yamlWriter{w: bufio.NewWriter(w)}
+}
+
+func (y *yamlWriter) Write(v any) error {
+	node, err := yamlNode(v)
+	if err != nil {
+		return fmt.Errorf("encoding result: %w", err)
+	}
+	if y.n == 0 {
+		y.w.WriteString(yamlHeader + "\n")
+	}
+	y.n++
+
+	// Encode the service as a one-item sequence and indent it under
+	// "services:".
+	y.buf.Reset()
+	if err := encodeYAML(&y.buf, &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{node}}); err != nil {
+		return fmt.Errorf("encoding result: %w", err)
+	}
+	for _, line := range bytes.SplitAfter(y.buf.Bytes(), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		y.w.WriteString("  ")
+		if _, err := y.w.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Summary implements Summarizer.
+func (y *yamlWriter) Summary(v any) {
+	y.report = v
+}
+
+func (y *yamlWriter) Close() error {
+	if y.n == 0 {
+		y.w.WriteString(yamlHeader + " []\n")
+	}
+	if y.report != nil {
+		node, err := yamlNode(y.report)
+		if err != nil {
+			return err
+		}
+		doc := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "report"}, node,
+		}}
+		if err := encodeYAML(y.w, doc); err != nil {
+			return err
+		}
+	}
+	return y.w.Flush()
+}
+
+// yamlHeader opens the document, up to the services sequence.
+const yamlHeader = "schemaVersion: \"" + SchemaVersion + "\"\nservices:"
+
+// WriteYAML writes v to w as a YAML document using its JSON field names, so
+// YAML and JSON output describe values the same way.
+func WriteYAML(w io.Writer, v any) error {
+	node, err := yamlNode(v)
+	if err != nil {
+		return err
+	}
+	return encodeYAML(w, node)
+}
+
+// yamlNode converts v to a YAML node through its JSON encoding, keeping the
+// JSON field names and order.
+func yamlNode(v any) (*yaml.Node, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	node := doc.Content[0]
+	plainStyle(node)
+	return node, nil
+}
+
+// plainStyle drops the JSON flow and quoting styles from n, so it is written
+// as block YAML. The encoder still quotes strings that need it in YAML 1.2;
+// strings that YAML 1.1 parsers read as booleans, such as "yes", stay quoted.
+func plainStyle(n *yaml.Node) {
+	n.Style = 0
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!str" && yaml11Bools[strings.ToLower(n.Value)] {
+		n.Style = yaml.DoubleQuotedStyle
+	}
+	for _, c := range n.Content {
+		plainStyle(c)
+	}
+}
+
+var yaml11Bools = map[string]bool{
+	"y": true, "yes": true, "n": true, "no": true, "on": true, "off": true,
+}
+
+func encodeYAML(w io.Writer, v any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,251 @@
+package pagerduty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultEndpoint is the PagerDuty REST API.
+const DefaultEndpoint = "https://api.pagerduty.com"
+
+// maxRetries bounds the retries of rate-limited requests.
+const maxRetries = 5
+
+// Client calls the PagerDuty REST API.
+type Client struct {
+	// Token is a REST API key with write access.
+	Token string
+	// Endpoint defaults to DefaultEndpoint.
+	Endpoint string
+	HTTP     *http.Client
+}
+
+// Result counts what a sync did.
+type Result struct {
+	Created   []string `json:"created,omitempty"`
+	Updated   []string `json:"updated,omitempty"`
+	Unchanged int      `json:"unchanged"`
+	// Unmanaged lists services that already existed without having been
+	// created by discovery. They are left as they are, but their
+	// dependencies are recorded.
+	Unmanaged    []string `json:"unmanaged,omitempty"`
+	Dependencies int      `json:"dependencies"`
+}
+
+type reference struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type service struct {
+	ID               string    `json:"id,omitempty"`
+	Type             string    `json:"type,omitempty"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	EscalationPolicy reference `json:"escalation_policy"`
+}
+
+type relationship struct {
+	Supporting reference `json:"supporting_service"`
+	Dependent  reference `json:"dependent_service"`
+}
+
+// Sync creates the services of p that do not exist, updates those that
+// differ, and records its dependencies. Dependencies are only added; none
+// are removed.
+func (c *Client) Sync(ctx context.Context, p *Plan) (Result, error) {
+	var res Result
+	existing, err := c.services(ctx)
+	if err != nil {
+		return res, err
+	}
+	ids := map[string]string{}
+	var errs []error
+	for _, s := range p.Services {
+		want := service{
+			Type:             "service",
+			Name:             s.Name,
+			Description:      s.Description,
+			EscalationPolicy: reference{ID: s.EscalationPolicy, Type: "escalation_policy_reference"},
+		}
+		have, ok := existing[s.Name]
+		switch {
+		case !ok:
+			var out struct {
+				Service service `json:"service"`
+			}
+			if err := c.do(ctx, http.MethodPost, "/services", map[string]any{"service": want}, &out); err != nil {
+				errs = append(errs, fmt.Errorf("creating %s: %w", s.Name, err))
+				continue
+			}
+			ids[s.Name] = out.Service.ID
+			res.Created = append(res.Created, s.Name)
+		case !strings.HasSuffix(have.Description, descriptionSuffix):
+			ids[s.Name] = have.ID
+			res.Unmanaged = append(res.Unmanaged, s.Name)
+		case have.Description != want.Description || have.EscalationPolicy.ID != want.EscalationPolicy.ID:
+			ids[s.Name] = have.ID
+			if err := c.do(ctx, http.MethodPut, "/services/"+url.PathEscape(have.ID), map[string]any{"service": want}, nil); err != nil {
+				errs = append(errs, fmt.Errorf("updating %s: %w", s.Name, err))
+				continue
+			}
+			res.Updated = append(res.Updated, s.Name)
+		default:
+			ids[s.Name] = have.ID
+			res.Unchanged++
+		}
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+	}
+
+	n, err := c.associate(ctx, p.Dependencies, ids)
+	res.Dependencies = n
+	return res, errors.Join(append(errs, err)...)
+}
+
+// services returns every service in the account by name.
+func (c *Client) services(ctx context.Context) (map[string]service, error) {
+	const limit = 100
+	services := map[string]service{}
+	for offset := 0; ; offset += limit {
+		var out struct {
+			Services []service `json:"services"`
+			More     bool      `json:"more"`
+		}
+		if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/services?limit=%d&offset=%d", limit, offset), nil, &out); err != nil {
+			return nil, fmt.Errorf("listing services: %w", err)
+		}
+		for _, s := range out.Services {
+			services[s.Name] = s
+		}
+		if !out.More {
+			return services, nil
+		}
+	}
+}
+
+// associate records the dependencies that do not exist yet between the
+// services in ids, returning how many it added.
+func (c *Client) associate(ctx context.Context, deps []Dependency, ids map[string]string) (int, error) {
+	existing := map[relationship]bool{}
+	fetched := map[string]bool{}
+	var add []relationship
+	for _, d := range deps {
+		dependent, supporting := ids[d.Dependent], ids[d.Supporting]
+		if dependent == "" || supporting == "" {
+			continue
+		}
+		if !fetched[dependent] {
+			fetched[dependent] = true
+			var out struct {
+				Relationships []relationship `json:"relationships"`
+			}
+			if err := c.do(ctx, http.MethodGet, "/service_dependencies/technical_services/"+url.PathEscape(dependent), nil, &out); err != nil {
+				return 0, fmt.Errorf("listing dependencies of %s: %w", d.Dependent, err)
+			}
+			for _, r := range out.Relationships {
+				existing[relationship{Supporting: reference{ID: r.Supporting.ID}, Dependent: reference{ID: r.Dependent.ID}}] = true
+			}
+		}
+		key := relationship{Supporting: reference{ID: supporting}, Dependent: reference{ID: dependent}}
+		if existing[key] {
+			continue
+		}
+		existing[key] = true
+		add = append(add, relationship{
+			Supporting: reference{ID: supporting, Type: "service"},
+			Dependent:  reference{ID: dependent, Type: "service"},
+		})
+	}
+	// The API accepts a limited number of relationships per request.
+	const batch = 100
+	for i := 0; i < len(add); i += batch {
+		chunk := add[i:min(i+batch, len(add))]
+		if err := c.do(ctx, http.MethodPost, "/service_dependencies/associate", map[string]any{"relationships": chunk}, nil); err != nil {
+			return i, fmt.Errorf("adding dependencies: %w", err)
+		}
+	}
+	return len(add), nil
+}
+
+// do sends a request with body encoded as JSON, waiting out rate limits,
+// and decodes the response into out if it is set.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint+path, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Token token="+c.Token)
+		req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			select {
+			case <-time.After(time.Second << attempt):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if resp.StatusCode/100 != 2 {
+			return apiError(resp.Status, respBody)
+		}
+		if out == nil || len(respBody) == 0 {
+			return nil
+		}
+		return json.Unmarshal(respBody, out)
+	}
+}
+
+// apiError returns the message of a PagerDuty error response.
+func apiError(status string, body []byte) error {
+	var e struct {
+		Error struct {
+			Message string   `json:"message"`
+			Errors  []string `json:"errors"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Error.Message != "" {
+		msg := e.Error.Message
+		if len(e.Error.Errors) > 0 {
+			msg += ": " + strings.Join(e.Error.Errors, "; ")
+		}
+		return fmt.Errorf("pagerduty responded %s: %s", status, msg)
+	}
+	return fmt.Errorf("pagerduty responded %s", status)
+}
@@ -0,0 +1,122 @@
+// Package pagerduty mirrors discovered services into the PagerDuty service
+// directory: a technical service per function, on the escalation policy of
+// its owning team, with the dependencies of the discovery graph.
+package pagerduty
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+// descriptionSuffix ends the description of every service discovery
+// writes, so they can be told apart in PagerDuty.
+const descriptionSuffix = "(managed by discovery)"
+
+// Options control how services are mapped to PagerDuty.
+type Options struct {
+	// OwnerTags are the tag keys tried, in order, for the owning team, e.g.
+	// "team" and "owner".
+	OwnerTags []string
+	// EscalationPolicies maps owners to escalation policy IDs.
+	EscalationPolicies map[string]string
+	// DefaultEscalationPolicy is used for owners without a policy; empty
+	// skips their services.
+	DefaultEscalationPolicy string
+}
+
+// Service is a PagerDuty service to create or update.
+type Service struct {
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	EscalationPolicy string `json:"escalationPolicy"`
+	Owner            string `json:"owner,omitempty"`
+	// Key is the discovered service's key, usually its ARN.
+	Key string `json:"key"`
+}
+
+// Dependency records that the service named Dependent relies on the one
+// named Supporting.
+type Dependency struct {
+	Dependent  string `json:"dependent"`
+	Supporting string `json:"supporting"`
+}
+
+// Skipped is a discovered service left out of the plan.
+type Skipped struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// Plan is what a sync writes to PagerDuty.
+type Plan struct {
+	Services     []Service    `json:"services"`
+	Dependencies []Dependency `json:"dependencies"`
+	Skipped      []Skipped    `json:"skipped,omitempty"`
+}
+
+// NewPlan maps the Lambda functions in services to PagerDuty services and
+// the edges of g between them to dependencies. Names are the function names,
+// qualified with the region and then the account where they would collide.
+func NewPlan(services []discovery.Service, g *graph.Graph, opts Options) *Plan {
+	var functions []discovery.Service
+	for _, s := range services {
+		if s.ResourceType == discovery.ResourceTypeLambdaFunction {
+			functions = append(functions, s)
+		}
+	}
+	names := discovery.UniqueNames(functions, strings.TrimSpace)
+	p := &Plan{Services: []Service{}, Dependencies: []Dependency{}}
+	byKey := map[string]string{}
+	for i, s := range functions {
+		owner := owner(s.Tags, opts.OwnerTags)
+		policy := opts.EscalationPolicies[owner]
+		if policy == "" {
+			policy = opts.DefaultEscalationPolicy
+		}
+		if policy == "" {
+			reason := "no owner tag"
+			if owner != "" {
+				reason = "no escalation policy for owner " + owner
+			}
+			p.Skipped = append(p.Skipped, Skipped{Key: s.Key(), Reason: reason})
+			continue
+		}
+		p.Services = append(p.Services, Service{
+			Name:             names[i],
+			Description:      description(s),
+			EscalationPolicy: policy,
+			Owner:            owner,
+			Key:              s.Key(),
+		})
+		byKey[s.Key()] = names[i]
+	}
+	for _, e := range g.Edges {
+		from, to := byKey[e.From], byKey[e.To]
+		if from != "" && to != "" && from != to {
+			p.Dependencies = append(p.Dependencies, Dependency{Dependent: from, Supporting: to})
+		}
+	}
+	sort.Slice(p.Services, func(i, j int) bool { return p.Services[i].Name < p.Services[j].Name })
+	return p
+}
+
+func owner(tags map[string]string, keys []string) string {
+	for _, k := range keys {
+		if v := tags[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func description(s discovery.Service) string {
+	var parts []string
+	if l := s.Details.Lambda; l != nil && l.Description != "" {
+		parts = append(parts, l.Description)
+	}
+	parts = append(parts, "Lambda function "+s.Key(), descriptionSuffix)
+	return strings.Join(parts, " ")
+}
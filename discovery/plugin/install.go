@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Install copies the plugin executable at src, a file path or an https URL,
+// into dir and checks that it answers describe. sum is the hex SHA-256 the
+// executable must have before it is run; it is required for URLs, since
+// whoever serves the URL decides what is downloaded, and optional for files.
+// The installed file is named after src, with Prefix added if it is missing.
+func Install(ctx context.Context, dir, src, sum string) (*Plugin, error) {
+	if u, err := url.Parse(src); err == nil && u.Scheme == "https" && sum == "" {
+		return nil, fmt.Errorf("installing %s: a plugin downloaded from a URL needs its SHA-256 checksum", src)
+	}
+	name, r, err := open(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if !strings.HasPrefix(name, Prefix) {
+		name = Prefix + name
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating plugin directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".install-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("copying plugin: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); sum != "" && !strings.EqualFold(got, sum) {
+		return nil, fmt.Errorf("installing %s: SHA-256 is %s, not %s", src, got, sum)
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return nil, err
+	}
+	// Validate before replacing any installed version.
+	if _, err := Load(ctx, tmp.Name()); err != nil {
+		return nil, err
+	}
+	dest := filepath.Join(dir, name)
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return nil, fmt.Errorf("installing plugin: %w", err)
+	}
+	return Load(ctx, dest)
+}
+
+// Remove uninstalls the plugin with the given file name or provider name.
+func Remove(ctx context.Context, dir, name string) error {
+	paths, err := Find(dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		base := filepath.Base(p)
+		if base == name || base == Prefix+name {
+			return os.Remove(p)
+		}
+	}
+	for _, p := range paths {
+		if pl, err := Load(ctx, p); err == nil && pl.Name() == name {
+			return os.Remove(p)
+		}
+	}
+	return fmt.Errorf("plugin %s is not installed", name)
+}
+
+// open returns the base name and contents of src. Plain http URLs are
+// rejected, since anyone on the way could replace the executable.
+func open(ctx context.Context, src string) (string, io.ReadCloser, error) {
+	u, err := url.Parse(src)
+	if err == nil && u.Scheme == "http" {
+		return "", nil, fmt.Errorf("installing %s: plugins are only downloaded over https", src)
+	}
+	if err != nil || u.Scheme != "https" {
+		f, err := os.Open(src)
+		if err != nil {
+			return "", nil, fmt.Errorf("opening plugin: %w", err)
+		}
+		return filepath.Base(src), f, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("downloading plugin: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return "", nil, fmt.Errorf("downloading plugin: %s", resp.Status)
+	}
+	return path.Base(u.Path), resp.Body, nil
+}
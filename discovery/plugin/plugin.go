@@ -0,0 +1,275 @@
+// Package plugin runs external catalogers shipped as separate executables,
+// so teams can discover resources on internal platforms without forking the
+// tool.
+//
+// A plugin is any executable named discovery-plugin-<name> in the plugin
+// directory. It speaks a small JSON protocol over its command line and stdout:
+//
+//	discovery-plugin-foo describe
+//	    prints {"name": "foo", "catalogers": ["widgets"], "regions": ["global"]}
+//	    regions is optional and limits which of the requested regions the
+//	    plugin is run for; without it every requested region is scanned.
+//
+//	discovery-plugin-foo catalog --region <region> --cataloger <name>
+//	    prints one JSON object per line, either {"service": {...}} using the
+//	    JSON form of discovery.Service, or {"error": {"resource": "...",
+//	    "cause": "...", "message": "..."}} for a resource it could not
+//	    describe. A non-zero exit status fails the cataloger.
+//
+// Anything the plugin writes to stderr is passed through to discovery's
+// stderr.
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Prefix is the file name prefix that marks an executable as a plugin.
+const Prefix = "discovery-plugin-"
+
+// describeTimeout bounds the describe call, which should answer instantly.
+const describeTimeout = 10 * time.Second
+
+// Manifest is what a plugin reports about itself from describe.
+type Manifest struct {
+	Name       string   `json:"name"`
+	Catalogers []string `json:"catalogers"`
+	Regions    []string `json:"regions,omitempty"`
+}
+
+// Plugin is an installed plugin executable. It is a discovery.Provider named
+// after its manifest.
+type Plugin struct {
+	Path     string   `json:"path"`
+	Manifest Manifest `json:"manifest"`
+}
+
+// DefaultDir returns the per-user plugin directory,
+// e.g. ~/.local/share/discovery/plugins on Linux.
+func DefaultDir() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("locating home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "discovery", "plugins"), nil
+}
+
+// Find returns the plugin executables in dir, sorted by name. A missing
+// directory holds no plugins.
+func Find(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading plugin directory: %w", err)
+	}
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), Prefix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.Mode()&0o111 == 0 {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Load runs the plugin at path with "describe".
+func Load(ctx context.Context, path string) (*Plugin, error) {
+	ctx, cancel := context.WithTimeout(ctx, describeTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "describe")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: describe: %w%s", filepath.Base(path), err, stderrSuffix(stderr.Bytes()))
+	}
+	p := &Plugin{Path: path}
+	if err := json.Unmarshal(out, &p.Manifest); err != nil {
+		return nil, fmt.Errorf("plugin %s: parsing describe output: %w", filepath.Base(path), err)
+	}
+	if p.Manifest.Name == "" {
+		return nil, fmt.Errorf("plugin %s: describe output has no name", filepath.Base(path))
+	}
+	return p, nil
+}
+
+// LoadAll loads every plugin in dir.
+func LoadAll(ctx context.Context, dir string) ([]*Plugin, error) {
+	paths, err := Find(dir)
+	if err != nil {
+		return nil, err
+	}
+	plugins := make([]*Plugin, 0, len(paths))
+	for _, path := range paths {
+		p, err := Load(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins, nil
+}
+
+// Name implements discovery.Provider.
+func (p *Plugin) Name() string {
+	return p.Manifest.Name
+}
+
+// Catalogers implements discovery.Provider. Regions the plugin does not
+// declare have no catalogers.
+func (p *Plugin) Catalogers(ctx context.Context, region string) ([]discovery.Cataloger, error) {
+	if len(p.Manifest.Regions) > 0 && !slices.Contains(p.Manifest.Regions, region) {
+		return nil, nil
+	}
+	catalogers := make([]discovery.Cataloger, len(p.Manifest.Catalogers))
+	for i, name := range p.Manifest.Catalogers {
+		catalogers[i] = &execCataloger{plugin: p, name: name, region: region}
+	}
+	return catalogers, nil
+}
+
+// execCataloger runs one plugin cataloger for a region.
+type execCataloger struct {
+	plugin *Plugin
+	name   string
+	region string
+}
+
+func (c *execCataloger) Name() string {
+	return c.name
+}
+
+// message is one line of catalog output.
+type message struct {
+	Service *discovery.Service `json:"service"`
+	Error   *messageError      `json:"error"`
+}
+
+type messageError struct {
+	Resource string `json:"resource"`
+	Cause    string `json:"cause"`
+	Message  string `json:"message"`
+}
+
+// Error is a resource failure reported by a plugin. ErrorCode lets the run
+// report group it by the plugin's cause.
+type Error struct {
+	Cause   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) ErrorCode() string {
+	return e.Cause
+}
+
+func (c *execCataloger) Catalog(ctx context.Context, emit func(discovery.Result) error) error {
+	cmd := exec.CommandContext(ctx, c.plugin.Path, "catalog", "--region", c.region, "--cataloger", c.name)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting plugin: %w", err)
+	}
+
+	readErr := c.read(stdout, emit)
+	if readErr != nil {
+		// Stop the plugin rather than wait for output nobody reads.
+		cmd.Process.Kill()
+		io.Copy(io.Discard, stdout)
+	}
+	waitErr := cmd.Wait()
+	if readErr != nil {
+		return readErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if waitErr != nil {
+		return fmt.Errorf("plugin %s: %w", filepath.Base(c.plugin.Path), waitErr)
+	}
+	return nil
+}
+
+// read decodes catalog output and emits it, filling in the fields a plugin
+// may leave out.
+func (c *execCataloger) read(r io.Reader, emit func(discovery.Result) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var m message
+		if err := json.Unmarshal(line, &m); err != nil {
+			return fmt.Errorf("plugin %s: invalid output line: %w", filepath.Base(c.plugin.Path), err)
+		}
+		switch {
+		case m.Error != nil:
+			cause := m.Error.Cause
+			if cause == "" {
+				cause = "Error"
+			}
+			err := emit(discovery.SkipResource(m.Error.Resource, &Error{Cause: cause, Message: m.Error.Message}))
+			if err != nil {
+				return err
+			}
+		case m.Service != nil:
+			s := *m.Service
+			if s.Provider == "" {
+				s.Provider = c.plugin.Manifest.Name
+			}
+			if s.Region == "" {
+				s.Region = c.region
+			}
+			if s.DiscoveredAt.IsZero() {
+				s.DiscoveredAt = time.Now().UTC()
+			}
+			if err := emit(discovery.Result{Service: s}); err != nil {
+				return err
+			}
+		}
+	}
+	return sc.Err()
+}
+
+func stderrSuffix(b []byte) string {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return ""
+	}
+	return ": " + string(b)
+}
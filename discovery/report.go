@@ -0,0 +1,292 @@
+package discovery
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RunReport summarizes a discovery run: what was found and what could not be
+// scanned. It is a ResultHandler, so it can be fed directly by Run.
+type RunReport struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitempty"`
+
+	Services       int                  `json:"services"`
+	ServicesByType map[ResourceType]int `json:"servicesByType"`
+
+	// SkippedResources counts individual resources whose details could not
+	// be fetched; FailedScopes counts regions or catalogers that failed
+	// outright.
+	SkippedResources int `json:"skippedResources"`
+	FailedScopes     int `json:"failedScopes"`
+
+	// Causes counts errors by cause, e.g. "AccessDeniedException".
+	Causes map[string]int `json:"causes,omitempty"`
+	Errors []ReportError  `json:"errors,omitempty"`
+
+	// OmittedDetails lists details left out of otherwise complete results,
+	// e.g. because the role may list functions but not describe them. They
+	// do not make the run partial.
+	OmittedDetails []ReportError `json:"omittedDetails,omitempty"`
+
+	// Accounts summarizes the run per account, by account ID, for
+	// services and errors attributed to one.
+	Accounts map[string]*AccountReport `json:"accounts,omitempty"`
+
+	// Incomplete is set when the run was cancelled or timed out before
+	// every region was scanned.
+	Incomplete bool   `json:"incomplete"`
+	StopReason string `json:"stopReason,omitempty"`
+
+	mu sync.Mutex
+}
+
+// AccountReport summarizes the part of a run in one account.
+type AccountReport struct {
+	ID string `json:"id"`
+	// Alias and OrganizationalUnit are those of the account's services.
+	Alias              string               `json:"alias,omitempty"`
+	OrganizationalUnit string               `json:"organizationalUnit,omitempty"`
+	Services           int                  `json:"services"`
+	ServicesByType     map[ResourceType]int `json:"servicesByType"`
+	SkippedResources   int                  `json:"skippedResources"`
+	FailedScopes       int                  `json:"failedScopes"`
+	// Unreachable is why the account could not be accessed, when it could
+	// not be in some region, e.g. because its role could not be assumed.
+	Unreachable string `json:"unreachable,omitempty"`
+}
+
+// account returns the summary of account id, creating it on first use.
+func (r *RunReport) account(id string) *AccountReport {
+	if r.Accounts == nil {
+		r.Accounts = map[string]*AccountReport{}
+	}
+	a, ok := r.Accounts[id]
+	if !ok {
+		a = &AccountReport{ID: id, ServicesByType: map[ResourceType]int{}}
+		r.Accounts[id] = a
+	}
+	return a
+}
+
+// ReportError is the serializable form of a ScanError.
+type ReportError struct {
+	Provider  string `json:"provider,omitempty"`
+	Account   string `json:"account,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Cataloger string `json:"cataloger,omitempty"`
+	Resource  string `json:"resource,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	Cause     string `json:"cause"`
+	Message   string `json:"message"`
+}
+
+// NewRunReport returns an empty report with its start time set to now.
+func NewRunReport() *RunReport {
+	return &RunReport{
+		Started:        time.Now().UTC(),
+		ServicesByType: map[ResourceType]int{},
+		Causes:         map[string]int{},
+	}
+}
+
+// HandleResult implements ResultHandler.
+func (r *RunReport) HandleResult(ctx context.Context, res Result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if res.Err == nil {
+		r.Services++
+		r.ServicesByType[res.Service.ResourceType]++
+		if s := res.Service; s.AccountID != "" {
+			a := r.account(s.AccountID)
+			a.Services++
+			a.ServicesByType[s.ResourceType]++
+			a.Alias = cmp.Or(a.Alias, s.AccountAlias)
+			a.OrganizationalUnit = cmp.Or(a.OrganizationalUnit, s.OrganizationalUnit)
+		}
+		return nil
+	}
+
+	entry := ReportError{Cause: ErrorCause(res.Err), Message: res.Err.Error()}
+	var scanErr *ScanError
+	if errors.As(res.Err, &scanErr) {
+		entry.Provider = scanErr.Provider
+		entry.Account = scanErr.Account
+		entry.Region = scanErr.Region
+		entry.Cataloger = scanErr.Cataloger
+		entry.Resource = scanErr.Resource
+		entry.Detail = scanErr.Detail
+		entry.Message = scanErr.Err.Error()
+	}
+	if entry.Detail != "" {
+		r.OmittedDetails = append(r.OmittedDetails, entry)
+		return nil
+	}
+	var account *AccountReport
+	if entry.Account != "" {
+		account = r.account(entry.Account)
+	}
+	if entry.Resource != "" {
+		r.SkippedResources++
+		if account != nil {
+			account.SkippedResources++
+		}
+	} else {
+		r.FailedScopes++
+		if account != nil {
+			account.FailedScopes++
+			var accountErr *AccountError
+			if errors.As(res.Err, &accountErr) {
+				account.Unreachable = cmp.Or(account.Unreachable, accountErr.Error())
+			}
+		}
+	}
+	r.Causes[entry.Cause]++
+	r.Errors = append(r.Errors, entry)
+	return nil
+}
+
+// Finish records the end of the run. err is the error returned by Run, if
+// any.
+func (r *RunReport) Finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Finished = time.Now().UTC()
+	if err != nil {
+		r.Incomplete = true
+		r.StopReason = err.Error()
+	}
+}
+
+// Partial reports whether anything was skipped, failed or left unscanned.
+func (r *RunReport) Partial() bool {
+	return r.Incomplete || len(r.Errors) > 0
+}
+
+// Status classifies the run as "complete", "partial" or "incomplete".
+func (r *RunReport) Status() string {
+	switch {
+	case r.Incomplete:
+		return "incomplete"
+	case len(r.Errors) > 0:
+		return "partial"
+	}
+	return "complete"
+}
+
+// Print writes a human-readable summary of the report to w.
+func (r *RunReport) Print(w io.Writer) {
+	status := "complete"
+	switch {
+	case r.Incomplete:
+		status = "incomplete (" + r.StopReason + ")"
+	case len(r.Errors) > 0:
+		status = "partially complete"
+	}
+	fmt.Fprintf(w, "\nRun %s: %d services discovered in %s\n",
+		status, r.Services, r.Finished.Sub(r.Started).Round(time.Millisecond))
+	r.printAccounts(w)
+	for _, e := range r.OmittedDetails {
+		scope := strings.Join(strings.Fields(e.Provider+" "+e.Account+" "+e.Region+" "+e.Cataloger), " ")
+		fmt.Fprintf(w, "  omitted %s for %s (%s)\n", e.Detail, scope, e.Cause)
+	}
+	if len(r.Errors) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "%d resources skipped, %d regions or catalogers failed\n", r.SkippedResources, r.FailedScopes)
+	causes := make([]string, 0, len(r.Causes))
+	for c := range r.Causes {
+		causes = append(causes, c)
+	}
+	sort.Slice(causes, func(i, j int) bool { return r.Causes[causes[i]] > r.Causes[causes[j]] })
+	for _, c := range causes {
+		fmt.Fprintf(w, "  %5d  %s\n", r.Causes[c], c)
+	}
+
+	// Scope failures are rare and important; individual resources are
+	// summarized by cause above.
+	for _, e := range r.Errors {
+		if e.Resource == "" {
+			scope := strings.Join(strings.Fields(e.Provider+" "+e.Account+" "+e.Region+" "+e.Cataloger), " ")
+			fmt.Fprintf(w, "  failed: %s: %s\n", scope, e.Message)
+		}
+	}
+}
+
+// printAccounts writes the services and failures of each account to w,
+// grouped by organizational unit, when the run covered more than one.
+func (r *RunReport) printAccounts(w io.Writer) {
+	if len(r.Accounts) < 2 {
+		return
+	}
+	accounts := make([]*AccountReport, 0, len(r.Accounts))
+	for _, a := range r.Accounts {
+		accounts = append(accounts, a)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		a, b := accounts[i], accounts[j]
+		if a.OrganizationalUnit != b.OrganizationalUnit {
+			return a.OrganizationalUnit < b.OrganizationalUnit
+		}
+		return a.ID < b.ID
+	})
+	unit := ""
+	for i, a := range accounts {
+		if a.OrganizationalUnit != "" && (i == 0 || a.OrganizationalUnit != unit) {
+			unit = a.OrganizationalUnit
+			services, n := 0, 0
+			for _, b := range accounts[i:] {
+				if b.OrganizationalUnit != unit {
+					break
+				}
+				services += b.Services
+				n++
+			}
+			fmt.Fprintf(w, "  %s: %d accounts, %d services\n", unit, n, services)
+		}
+		line := "  " + a.ID
+		if a.OrganizationalUnit != "" {
+			line = "  " + line
+		}
+		if a.Alias != "" {
+			line += " (" + a.Alias + ")"
+		}
+		line += fmt.Sprintf(": %d services", a.Services)
+		if a.SkippedResources > 0 {
+			line += fmt.Sprintf(", %d resources skipped", a.SkippedResources)
+		}
+		if a.FailedScopes > 0 {
+			line += fmt.Sprintf(", %d regions or catalogers failed", a.FailedScopes)
+		}
+		if a.Unreachable != "" {
+			line += " (unreachable)"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// ErrorCause returns a short classification of err: the provider's error
+// code when it has one, otherwise a generic category.
+func ErrorCause(err error) string {
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &coded) && coded.ErrorCode() != "" {
+		return coded.ErrorCode()
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Timeout"
+	case errors.Is(err, context.Canceled):
+		return "Canceled"
+	}
+	return "Error"
+}
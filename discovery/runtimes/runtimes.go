@@ -0,0 +1,134 @@
+// Package runtimes tells which Lambda functions run on deprecated runtimes,
+// or on runtimes deprecated soon, from a table of deprecation dates. The
+// table is built in and can be extended or corrected from a file as AWS
+// publishes new dates.
+package runtimes
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+//go:embed runtimes.yaml
+var builtin []byte
+
+// Deprecation is when a runtime is deprecated: from then on it gets no more
+// security patches, and AWS goes on to block creating and then updating
+// functions that use it.
+type Deprecation struct {
+	Deprecated time.Time `yaml:"deprecated" json:"deprecated"`
+}
+
+// Table holds the deprecation of each runtime, by identifier, e.g.
+// "python3.9".
+type Table map[string]Deprecation
+
+// Default returns the built-in table.
+func Default() Table {
+	t := Table{}
+	if err := yaml.Unmarshal(builtin, &t); err != nil {
+		panic("runtimes: parsing built-in table: " + err.Error())
+	}
+	return t
+}
+
+// Load adds the deprecations in the YAML file at path to t, replacing those
+// of runtimes it already has.
+func (t Table) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var more Table
+	if err := yaml.Unmarshal(data, &more); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for runtime, d := range more {
+		if d.Deprecated.IsZero() {
+			return fmt.Errorf("%s: runtime %s has no deprecated date", path, runtime)
+		}
+		t[runtime] = d
+	}
+	return nil
+}
+
+// Status is how close a function's runtime is to deprecation.
+type Status string
+
+const (
+	// Deprecated runtimes are past their deprecation date.
+	Deprecated Status = "deprecated"
+	// Deprecating runtimes are deprecated within the warning window.
+	Deprecating Status = "deprecating"
+	// Supported runtimes are deprecated after the window, if at all.
+	Supported Status = "supported"
+	// Unknown runtimes are not in the table, e.g. ones newer than it.
+	Unknown Status = "unknown"
+)
+
+// Status returns the status of runtime at now, with a warning window of
+// within, and its deprecation date if the table has it.
+func (t Table) Status(runtime string, now time.Time, within time.Duration) (Status, time.Time) {
+	d, ok := t[runtime]
+	switch {
+	case !ok:
+		return Unknown, time.Time{}
+	case !now.Before(d.Deprecated):
+		return Deprecated, d.Deprecated
+	case now.Add(within).After(d.Deprecated):
+		return Deprecating, d.Deprecated
+	}
+	return Supported, d.Deprecated
+}
+
+// Finding is the runtime status of a function.
+type Finding struct {
+	Service discovery.Service `json:"service"`
+	Runtime string            `json:"runtime"`
+	Status  Status            `json:"status"`
+	// Deprecated is the runtime's deprecation date, if known.
+	Deprecated *time.Time `json:"deprecated,omitempty"`
+	// Days is the number of days from now until the deprecation date,
+	// negative once it has passed, and 0 when Deprecated is unknown.
+	Days int `json:"days"`
+}
+
+// Check returns the status of the runtime of every function among services
+// at now, with a warning window of within, the soonest deprecated first and
+// functions on unknown runtimes last. Functions deployed as container images
+// have no runtime and are left out.
+func (t Table) Check(services []discovery.Service, now time.Time, within time.Duration) []Finding {
+	var findings []Finding
+	for _, s := range services {
+		l := s.Details.Lambda
+		if l == nil || l.Runtime == "" {
+			continue
+		}
+		status, date := t.Status(l.Runtime, now, within)
+		f := Finding{Service: s, Runtime: l.Runtime, Status: status}
+		if !date.IsZero() {
+			f.Deprecated = &date
+			f.Days = int(math.Floor(date.Sub(now).Hours() / 24))
+		}
+		findings = append(findings, f)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i].Deprecated, findings[j].Deprecated
+		if (a == nil) != (b == nil) {
+			return b == nil
+		}
+		if a != nil && !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return findings[i].Service.Name < findings[j].Service.Name
+	})
+	return findings
+}
@@ -0,0 +1,762 @@
+package discovery
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResourceType identifies the kind of a discovered resource. Values use the
+// CloudFormation type names, e.g. "AWS::Lambda::Function".
+type ResourceType string
+
+const (
+	ResourceTypeLambdaFunction ResourceType = "AWS::Lambda::Function"
+
+	// Types of resources referenced by discovered services, which appear in
+	// the dependency graph.
+	ResourceTypeIAMRole       ResourceType = "AWS::IAM::Role"
+	ResourceTypeECRRepository ResourceType = "AWS::ECR::Repository"
+	ResourceTypeSQSQueue      ResourceType = "AWS::SQS::Queue"
+	ResourceTypeKinesisStream ResourceType = "AWS::Kinesis::Stream"
+	ResourceTypeDynamoDBTable ResourceType = "AWS::DynamoDB::Table"
+	ResourceTypeMSKCluster    ResourceType = "AWS::MSK::Cluster"
+	ResourceTypeMQBroker      ResourceType = "AWS::AmazonMQ::Broker"
+	ResourceTypeDocDBCluster  ResourceType = "AWS::DocDB::DBCluster"
+	ResourceTypeS3Bucket      ResourceType = "AWS::S3::Bucket"
+	ResourceTypeSNSTopic      ResourceType = "AWS::SNS::Topic"
+	ResourceTypeSecret        ResourceType = "AWS::SecretsManager::Secret"
+	ResourceTypeSSMParameter  ResourceType = "AWS::SSM::Parameter"
+	ResourceTypeKMSKey        ResourceType = "AWS::KMS::Key"
+	ResourceTypeEventBus      ResourceType = "AWS::Events::EventBus"
+	ResourceTypeStateMachine  ResourceType = "AWS::StepFunctions::StateMachine"
+	ResourceTypeEventRule     ResourceType = "AWS::Events::Rule"
+	ResourceTypeAPIGateway    ResourceType = "AWS::ApiGateway::RestApi"
+	ResourceTypeHTTPAPI       ResourceType = "AWS::ApiGatewayV2::Api"
+	ResourceTypeLoadBalancer  ResourceType = "AWS::ElasticLoadBalancingV2::LoadBalancer"
+	ResourceTypeTargetGroup   ResourceType = "AWS::ElasticLoadBalancingV2::TargetGroup"
+	ResourceTypeECSTaskDef    ResourceType = "AWS::ECS::TaskDefinition"
+	ResourceTypeActivity      ResourceType = "AWS::StepFunctions::Activity"
+	ResourceTypeSecurityGroup ResourceType = "AWS::EC2::SecurityGroup"
+	ResourceTypeDNSName       ResourceType = "AWS::Route53::RecordSet"
+	ResourceTypeDistribution  ResourceType = "AWS::CloudFront::Distribution"
+	// ResourceTypeAccount is a whole AWS account, named by the ARN of its
+	// root principal, e.g. arn:aws:iam::123456789012:root. Accounts are
+	// discovered as the delegated administrators of their organization.
+	ResourceTypeAccount ResourceType = "AWS::Organizations::Account"
+)
+
+// Service is a single discovered resource.
+type Service struct {
+	Provider     string       `json:"provider"`
+	AccountID    string       `json:"accountId,omitempty"`
+	Region       string       `json:"region"`
+	ARN          string       `json:"arn,omitempty"`
+	ResourceType ResourceType `json:"resourceType"`
+	Name         string       `json:"name"`
+	// AccountAlias is the human-readable name of the account: its IAM
+	// alias, or else its name in its organization.
+	AccountAlias string `json:"accountAlias,omitempty"`
+	// OrganizationalUnit is the name of the organizational unit holding
+	// the account, when it was scanned as part of its organization.
+	OrganizationalUnit string `json:"organizationalUnit,omitempty"`
+
+	// LastModified is when the resource was last changed, if the provider
+	// reports it. DiscoveredAt is when this record was produced.
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	DiscoveredAt time.Time  `json:"discoveredAt"`
+
+	Tags map[string]string `json:"tags,omitempty"`
+	// Owner is the team owning the resource, the value of the first owner
+	// tag set on it; see SetOwner.
+	Owner string `json:"owner,omitempty"`
+	// Cost is the resource's estimated monthly cost, when costs were
+	// attached.
+	Cost *Cost `json:"cost,omitempty"`
+	// StackSet is the CloudFormation StackSet that deployed the resource,
+	// when one did; see SetStackSet.
+	StackSet *StackSet `json:"stackSet,omitempty"`
+	Details  Details   `json:"details"`
+
+	// Relationships are the resources the service depends on that discovery
+	// found links to, such as the queues and streams a function consumes.
+	Relationships []Relationship `json:"relationships,omitempty"`
+}
+
+// Relationship records that a service depends on another resource or, when
+// From is set, that another resource depends on the service or on one of the
+// resources it relates to.
+type Relationship struct {
+	// From is the ARN of the dependent resource when it is not the service,
+	// e.g. the S3 bucket a function's resource policy lets invoke it.
+	From     string       `json:"from,omitempty"`
+	FromType ResourceType `json:"fromType,omitempty"`
+	// Relation names the dependency as the graph does, e.g. "eventSource".
+	Relation string `json:"relation"`
+	// Target is the ARN of the resource depended on.
+	Target     string       `json:"target"`
+	TargetType ResourceType `json:"targetType,omitempty"`
+	// Via identifies what links the two, e.g. the UUID of an event source
+	// mapping.
+	Via string `json:"via,omitempty"`
+	// State is the state of the link, e.g. "Enabled" or "Disabled" for an
+	// event source mapping.
+	State string `json:"state,omitempty"`
+	// Confidence is set on relationships inferred rather than configured,
+	// e.g. from permissions, to one of the Confidence constants.
+	Confidence string `json:"confidence,omitempty"`
+	// Actions are the API actions the relationship was inferred from, e.g.
+	// "dynamodb:GetItem".
+	Actions []string `json:"actions,omitempty"`
+	// Calls is set on observed and audited relationships to the number of
+	// calls traced or logged.
+	Calls int64 `json:"calls,omitempty"`
+}
+
+// Relations of a service to the resources it depends on.
+const (
+	// RelationEventSource is the relation of a function to a queue, stream
+	// or broker that an event source mapping invokes it with.
+	RelationEventSource = "eventSource"
+	// RelationPermission is the relation of a function to a resource its
+	// execution role is allowed to use.
+	RelationPermission = "permission"
+	// RelationResourcePolicy is the relation of a resource to one whose
+	// resource policy allows it access, e.g. of an S3 bucket to the
+	// function its notifications invoke.
+	RelationResourcePolicy = "resourcePolicy"
+	// RelationObserved is the relation of a resource to one it was seen
+	// calling in traces, e.g. by X-Ray.
+	RelationObserved = "observed"
+	// RelationIntegration is the relation of an API to the function, load
+	// balancer or HTTP endpoint its routes forward requests to.
+	RelationIntegration = "integration"
+	// RelationOrchestration is the relation of a state machine to a
+	// resource its Task states invoke, e.g. a function or a queue.
+	RelationOrchestration = "orchestration"
+	// RelationNetwork is the relation of a resource to one whose security
+	// groups admit traffic from its own, e.g. of a function to the security
+	// group of a database.
+	RelationNetwork = "network"
+	// RelationDNS is the relation of a DNS name to the endpoint it resolves
+	// to, e.g. of api.example.com to an API or load balancer.
+	RelationDNS = "dns"
+	// RelationOrigin is the relation of a CloudFront distribution to an
+	// endpoint it serves content from.
+	RelationOrigin = "origin"
+	// RelationEventTarget is the relation of an event bus to a resource
+	// its rules send events to, e.g. a function or another account's bus.
+	RelationEventTarget = "eventTarget"
+	// RelationDeadLetter is the relation of a function to the queue or
+	// topic its failed asynchronous events are sent to.
+	RelationDeadLetter = "deadLetter"
+	// RelationDestination is the relation of a function to a destination
+	// of its asynchronous invocations; Via is onSuccess or onFailure.
+	RelationDestination = "destination"
+	// RelationAudited is the relation of a resource to one CloudTrail
+	// logged it calling, e.g. a function sending messages to a queue.
+	RelationAudited = "audited"
+)
+
+// Confidence levels of inferred relationships.
+const (
+	// ConfidenceHigh is given to actions named explicitly on the resource.
+	ConfidenceHigh = "high"
+	// ConfidenceMedium is given to wildcard actions, e.g. "sqs:*".
+	ConfidenceMedium = "medium"
+	// ConfidenceLow is given to permissions that only apply under a
+	// condition beyond naming the resource they are for.
+	ConfidenceLow = "low"
+)
+
+// Key identifies the service across runs: its ARN when it has one, otherwise
+// its provider, region, type and name.
+func (s Service) Key() string {
+	if s.ARN != "" {
+		return s.ARN
+	}
+	return s.Provider + "/" + s.Region + "/" + string(s.ResourceType) + "/" + s.Name
+}
+
+// AccountLabel names the service's account for people: its alias, or its ID
+// when it has none.
+func (s Service) AccountLabel() string {
+	if s.AccountAlias != "" {
+		return s.AccountAlias
+	}
+	return s.AccountID
+}
+
+// Details holds the type-specific attributes of a Service. Exactly one field
+// is set, matching the Service's ResourceType.
+type Details struct {
+	Lambda       *LambdaDetails       `json:"lambda,omitempty"`
+	APIGateway   *APIGatewayDetails   `json:"apiGateway,omitempty"`
+	StateMachine *StateMachineDetails `json:"stateMachine,omitempty"`
+	Account      *AccountDetails      `json:"account,omitempty"`
+}
+
+// AccountDetails describes an account of an organization that
+// organization-wide services are delegated to.
+type AccountDetails struct {
+	Email string `json:"email,omitempty"`
+	// DelegatedServices are the services the account is a delegated
+	// administrator of, sorted by service principal.
+	DelegatedServices []DelegatedService `json:"delegatedServices"`
+}
+
+// DelegatedService is an organization-wide service, such as GuardDuty or
+// Config, administered from a delegated account.
+type DelegatedService struct {
+	// ServicePrincipal names the service, e.g. "guardduty.amazonaws.com".
+	ServicePrincipal string     `json:"servicePrincipal"`
+	DelegatedAt      *time.Time `json:"delegatedAt,omitempty"`
+}
+
+// StateMachineDetails describes a Step Functions state machine.
+type StateMachineDetails struct {
+	// Type is STANDARD or EXPRESS.
+	Type        string `json:"type"`
+	Status      string `json:"status,omitempty"`
+	Role        string `json:"role,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// APIGatewayDetails describes an API Gateway REST, HTTP or WebSocket API.
+type APIGatewayDetails struct {
+	ID string `json:"id"`
+	// Protocol is REST, HTTP or WEBSOCKET.
+	Protocol    string `json:"protocol"`
+	Description string `json:"description,omitempty"`
+	// Endpoint is the default invoke URL, empty when it is disabled.
+	Endpoint string `json:"endpoint,omitempty"`
+	// EndpointTypes of REST APIs: EDGE, REGIONAL or PRIVATE.
+	EndpointTypes []string `json:"endpointTypes,omitempty"`
+}
+
+// LambdaDetails describes a Lambda function.
+type LambdaDetails struct {
+	Runtime     string `json:"runtime,omitempty"`
+	Handler     string `json:"handler,omitempty"`
+	Role        string `json:"role,omitempty"`
+	Description string `json:"description,omitempty"`
+	MemorySize  int32  `json:"memorySize,omitempty"`
+	Timeout     int32  `json:"timeout,omitempty"`
+	PackageType string `json:"packageType,omitempty"`
+	// Architecture is the instruction set the function runs on: "x86_64"
+	// or "arm64", for Graviton.
+	Architecture string `json:"architecture,omitempty"`
+	// SnapStart is set for functions that can use SnapStart.
+	SnapStart *SnapStart `json:"snapStart,omitempty"`
+	// EnvironmentKeys are the names of the function's environment
+	// variables, sorted; their values are not recorded.
+	EnvironmentKeys []string `json:"environmentKeys,omitempty"`
+
+	Code LambdaCode `json:"code"`
+	// Layers are the layer versions the function uses, in order.
+	Layers []LambdaLayer `json:"layers,omitempty"`
+
+	// ReservedConcurrency is nil when the function has no reservation.
+	ReservedConcurrency *int32 `json:"reservedConcurrency,omitempty"`
+	// ProvisionedConcurrency lists the versions and aliases with
+	// provisioned concurrency, or whose provisioned concurrency Application
+	// Auto Scaling scales.
+	ProvisionedConcurrency []ProvisionedConcurrency `json:"provisionedConcurrency,omitempty"`
+
+	// VPC is set for functions connected to a VPC.
+	VPC *VPCConfig `json:"vpc,omitempty"`
+	// URL is set for functions with a function URL.
+	URL *FunctionURL `json:"url,omitempty"`
+	// DeadLetterTarget is the ARN of the queue or topic events whose
+	// asynchronous invocation failed are sent to, when there is one.
+	DeadLetterTarget string `json:"deadLetterTarget,omitempty"`
+	// EventInvokeConfigs list the versions and aliases with their own
+	// settings for asynchronous invocations.
+	EventInvokeConfigs []EventInvokeConfig `json:"eventInvokeConfigs,omitempty"`
+	// Dependencies are the libraries the dependency manifests in the
+	// function's package declare, when packages are read.
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+	// InvokePermissions are the statements of the function's resource
+	// policy allowing it to be invoked, directly or by its URL, when
+	// resource policies are read.
+	InvokePermissions []InvokePermission `json:"invokePermissions,omitempty"`
+	// Usage is how much the function was used before it was discovered,
+	// when usage metrics are read.
+	Usage *LambdaUsage `json:"usage,omitempty"`
+}
+
+// InvokePermission is a statement of a function's resource policy allowing
+// principals to invoke it.
+type InvokePermission struct {
+	Sid string `json:"sid,omitempty"`
+	// Principals are those allowed: "*", accounts, roles or service
+	// principals such as "s3.amazonaws.com".
+	Principals []string `json:"principals"`
+	// Actions are the statement's actions allowing invocation, e.g.
+	// "lambda:InvokeFunction" or "lambda:*".
+	Actions []string `json:"actions"`
+	// SourceARNs, SourceAccounts and OrgIDs are the values of the
+	// statement's aws:SourceArn, aws:SourceAccount (or aws:SourceOwner)
+	// and aws:PrincipalOrgID conditions, which restrict the principals.
+	SourceARNs     []string `json:"sourceArns,omitempty"`
+	SourceAccounts []string `json:"sourceAccounts,omitempty"`
+	OrgIDs         []string `json:"orgIds,omitempty"`
+	// FunctionURLAuthType is the value of the lambda:FunctionUrlAuthType
+	// condition of statements allowing calls to the function URL, e.g.
+	// "NONE".
+	FunctionURLAuthType string `json:"functionUrlAuthType,omitempty"`
+	// Public is set when a principal is a wildcard that none of these
+	// conditions restrict, so anyone may invoke the function.
+	Public bool `json:"public,omitempty"`
+}
+
+// LambdaUsage is how much a function was used over a window ending when it
+// was discovered, from its CloudWatch metrics.
+type LambdaUsage struct {
+	// Since is the start of the window.
+	Since       time.Time `json:"since"`
+	Invocations int64     `json:"invocations"`
+	Errors      int64     `json:"errors"`
+	// ErrorRate is Errors divided by Invocations, 0 without invocations.
+	ErrorRate float64 `json:"errorRate"`
+	Throttles int64   `json:"throttles"`
+	// DurationP95 is the 95th percentile of invocation durations, in
+	// milliseconds.
+	DurationP95 float64 `json:"durationP95"`
+}
+
+// Dependency is a library a dependency manifest declares, such as a
+// requirement in requirements.txt.
+type Dependency struct {
+	// Ecosystem is the package registry the name belongs to: "pypi",
+	// "npm", "go" or "maven".
+	Ecosystem string `json:"ecosystem"`
+	// Name is the library's name, e.g. "requests", "@aws-sdk/client-s3",
+	// "github.com/aws/aws-lambda-go" or "com.amazonaws:aws-lambda-java-core".
+	Name string `json:"name"`
+	// Version is the version or range declared, e.g. "==2.31.0" or
+	// "^3.400.0"; it is empty when none is.
+	Version string `json:"version,omitempty"`
+	// Manifest is the path of the manifest in the package, e.g.
+	// "requirements.txt".
+	Manifest string `json:"manifest"`
+}
+
+// ProvisionedConcurrency is the provisioned concurrency of a function
+// version or alias.
+type ProvisionedConcurrency struct {
+	// Qualifier is the alias or version number.
+	Qualifier string `json:"qualifier"`
+	Requested int32  `json:"requested"`
+	Allocated int32  `json:"allocated"`
+	// Status is READY, IN_PROGRESS or FAILED; it is empty for a scaling
+	// target with no provisioned concurrency configured.
+	Status string `json:"status,omitempty"`
+	// Scaling is set when Application Auto Scaling scales the provisioned
+	// concurrency.
+	Scaling *ConcurrencyScaling `json:"scaling,omitempty"`
+}
+
+// ConcurrencyScaling is how Application Auto Scaling scales provisioned
+// concurrency: between MinCapacity and MaxCapacity, by Policies.
+type ConcurrencyScaling struct {
+	MinCapacity int32           `json:"minCapacity"`
+	MaxCapacity int32           `json:"maxCapacity"`
+	Policies    []ScalingPolicy `json:"policies,omitempty"`
+}
+
+// ScalingPolicy is an Application Auto Scaling policy.
+type ScalingPolicy struct {
+	Name string `json:"name"`
+	// Type is TargetTrackingScaling or StepScaling.
+	Type string `json:"type"`
+	// Metric and TargetValue are the metric target tracking policies keep
+	// at a value, e.g. LambdaProvisionedConcurrencyUtilization at 0.7.
+	Metric      string  `json:"metric,omitempty"`
+	TargetValue float64 `json:"targetValue,omitempty"`
+}
+
+// EventInvokeConfig is how a function version or alias handles
+// asynchronous invocations.
+type EventInvokeConfig struct {
+	// Qualifier is the alias or version number, or $LATEST.
+	Qualifier string `json:"qualifier"`
+	// OnSuccess and OnFailure are the ARNs of the queue, topic, function,
+	// event bus or bucket records of invocations are sent to.
+	OnSuccess string `json:"onSuccess,omitempty"`
+	OnFailure string `json:"onFailure,omitempty"`
+	// MaximumRetryAttempts and MaximumEventAge, in seconds, are nil where
+	// Lambda's defaults, 2 attempts and 6 hours, apply.
+	MaximumRetryAttempts *int32 `json:"maximumRetryAttempts,omitempty"`
+	MaximumEventAge      *int32 `json:"maximumEventAge,omitempty"`
+}
+
+// FunctionURL is a function's dedicated HTTPS endpoint.
+type FunctionURL struct {
+	URL string `json:"url"`
+	// AuthType is AWS_IAM, or NONE for a public endpoint.
+	AuthType string `json:"authType"`
+}
+
+// VPCConfig is where in a VPC a resource's network interfaces are.
+type VPCConfig struct {
+	VPCID            string   `json:"vpcId"`
+	SubnetIDs        []string `json:"subnetIds,omitempty"`
+	SecurityGroupIDs []string `json:"securityGroupIds,omitempty"`
+}
+
+// LambdaLayer is a layer version used by a function.
+type LambdaLayer struct {
+	ARN      string `json:"arn"`
+	CodeSize int64  `json:"codeSize,omitempty"`
+	// Contents is what the layer's archive holds, when packages are read.
+	Contents *LayerContents `json:"contents,omitempty"`
+}
+
+// LayerContents is what a layer version's archive holds.
+type LayerContents struct {
+	Files int `json:"files"`
+	// Size is the size of the files unzipped, in bytes.
+	Size        int64            `json:"size"`
+	Directories []LayerDirectory `json:"directories,omitempty"`
+	// Libraries are the libraries installed in the layer: Python
+	// distributions in site-packages and Node.js packages in node_modules.
+	// Their Version is the version installed and their Manifest the path
+	// of their metadata, e.g.
+	// "python/lib/python3.12/site-packages/requests-2.31.0.dist-info".
+	Libraries []Dependency `json:"libraries,omitempty"`
+}
+
+// LayerDirectory is a top-level directory of a layer, as extracted under
+// /opt, e.g. "python" or "nodejs".
+type LayerDirectory struct {
+	Path string `json:"path"`
+	// Size is the size of its files unzipped, in bytes.
+	Size int64 `json:"size"`
+}
+
+// SnapStart is a function's SnapStart setting.
+type SnapStart struct {
+	// ApplyOn is "PublishedVersions" when versions are snapshotted as they
+	// are published, or "None".
+	ApplyOn string `json:"applyOn"`
+	// OptimizationStatus is "On" or "Off" for the version discovered.
+	OptimizationStatus string `json:"optimizationStatus,omitempty"`
+}
+
+// LambdaCode locates a function's deployment package.
+type LambdaCode struct {
+	RepositoryType string `json:"repositoryType,omitempty"`
+	// Location is a presigned URL valid for a few minutes after discovery.
+	Location string `json:"location,omitempty"`
+	ImageURI string `json:"imageUri,omitempty"`
+	// ResolvedImageURI is ImageURI pinned to the digest that was deployed.
+	ResolvedImageURI string `json:"resolvedImageUri,omitempty"`
+	// SHA256 is the base64-encoded SHA-256 of the deployment package.
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	// Image is what ECR has about the image of an Image function, when it
+	// can be read.
+	Image *ContainerImage `json:"image,omitempty"`
+}
+
+// ContainerImage is an image in an ECR repository.
+type ContainerImage struct {
+	// RegistryID is the account of the registry.
+	RegistryID string    `json:"registryId"`
+	Repository string    `json:"repository"`
+	Digest     string    `json:"digest"`
+	Tags       []string  `json:"tags,omitempty"`
+	PushedAt   time.Time `json:"pushedAt"`
+	// Size is the size of the image in the repository, in bytes.
+	Size int64 `json:"size,omitempty"`
+	// Labels are the labels of the image's configuration, e.g.
+	// "org.opencontainers.image.revision".
+	Labels map[string]string `json:"labels,omitempty"`
+	// Scan is the image's latest vulnerability scan, when it was scanned.
+	Scan *ImageScan `json:"scan,omitempty"`
+}
+
+// ImageScan summarizes a vulnerability scan of an image.
+type ImageScan struct {
+	// Status is the scan's status, e.g. "COMPLETE" or "FAILED".
+	Status      string     `json:"status"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// Findings are the number of findings by severity, e.g. "CRITICAL"
+	// or "HIGH".
+	Findings map[string]int32 `json:"findings,omitempty"`
+}
+
+// DefaultOwnerTags are the tag keys tried, in order, for a service's owner
+// unless others are configured.
+var DefaultOwnerTags = []string{"team", "owner", "cost-center"}
+
+// SetOwner sets s.Owner to the value of the first of keys tagged on s, or
+// clears it when none is.
+func (s *Service) SetOwner(keys []string) {
+	s.Owner = ""
+	for _, k := range keys {
+		if v := s.Tags[k]; v != "" {
+			s.Owner = v
+			return
+		}
+	}
+}
+
+// Cost is an estimate of what a resource costs a month.
+type Cost struct {
+	// Monthly is the estimated cost of 30 days, in Currency.
+	Monthly  float64 `json:"monthly"`
+	Currency string  `json:"currency"`
+	// Source is what the cost is attributed by: "resource" for the
+	// resource's own costs, or "tag:<key>" for the costs tagged with the
+	// value of a cost allocation tag the resource has.
+	Source string `json:"source"`
+}
+
+// StackSet is a CloudFormation StackSet deploying resources into accounts
+// from a central one.
+type StackSet struct {
+	Name string `json:"name"`
+	// AdministrationAccount is the account administering the stack set,
+	// and PermissionModel whether it is SELF_MANAGED or SERVICE_MANAGED by
+	// the organization; both are empty when the role listing stack sets
+	// does not administer it.
+	AdministrationAccount string `json:"administrationAccount,omitempty"`
+	PermissionModel       string `json:"permissionModel,omitempty"`
+}
+
+// Tags CloudFormation sets on the resources of the stacks it creates.
+const (
+	StackNameTag = "aws:cloudformation:stack-name"
+	StackIDTag   = "aws:cloudformation:stack-id"
+)
+
+// stackSetUUIDLength is the length of the UUID CloudFormation ends the names
+// of stack set instances with.
+const stackSetUUIDLength = 36
+
+// StackSetName returns the name of the stack set whose instance created a
+// resource with tags, or "" if it was not created by one. Stack set
+// instances are named StackSet-<stack set>-<UUID>.
+func StackSetName(tags map[string]string) string {
+	name, ok := strings.CutPrefix(tags[StackNameTag], "StackSet-")
+	if !ok || len(name) < stackSetUUIDLength+2 || name[len(name)-stackSetUUIDLength-1] != '-' {
+		return ""
+	}
+	return name[:len(name)-stackSetUUIDLength-1]
+}
+
+// SetStackSet sets s.StackSet to the stack set named by s's tags, or clears
+// it when s was not deployed by one. Only the account administering the
+// stack set knows its administration account and permission model, so they
+// are left empty.
+func (s *Service) SetStackSet() {
+	s.StackSet = nil
+	if name := StackSetName(s.Tags); name != "" {
+		s.StackSet = &StackSet{Name: name}
+	}
+}
+
+// ServiceColumns lists the table columns a Service can be rendered with.
+// Besides these, "tag:<key>" is the value of one tag.
+var ServiceColumns = []string{
+	"name", "provider", "account", "region", "type", "arn",
+	"runtime", "handler", "role", "description", "memory", "timeout",
+	"package-type", "image-uri", "last-modified", "discovered-at",
+	"repository-type", "reserved-concurrency", "tags", "owner", "cost",
+	"provisioned-concurrency", "invocations", "error-rate", "throttles",
+	"duration-p95", "architecture", "snapstart", "account-alias",
+	"organizational-unit", "stack-set", "delegated-services", "cost-source",
+}
+
+// NumericColumns are the ServiceColumns holding numbers, which sort
+// numerically rather than as text.
+var NumericColumns = []string{
+	"memory", "timeout", "reserved-concurrency", "cost",
+	"provisioned-concurrency", "invocations", "error-rate", "throttles",
+	"duration-p95",
+}
+
+// TagColumnPrefix starts the name of a column holding one tag's value.
+const TagColumnPrefix = "tag:"
+
+// Column implements output.Columnar.
+func (s Service) Column(name string) (string, bool) {
+	lambda := s.Details.Lambda
+	if lambda == nil {
+		lambda = &LambdaDetails{}
+	}
+
+	if key, ok := strings.CutPrefix(name, TagColumnPrefix); ok && key != "" {
+		return s.Tags[key], true
+	}
+
+	switch name {
+	case "name":
+		return s.Name, true
+	case "provider":
+		return s.Provider, true
+	case "account":
+		return s.AccountID, true
+	case "account-alias":
+		return s.AccountAlias, true
+	case "organizational-unit":
+		return s.OrganizationalUnit, true
+	case "region":
+		return s.Region, true
+	case "type":
+		return string(s.ResourceType), true
+	case "arn":
+		return s.ARN, true
+	case "runtime":
+		return lambda.Runtime, true
+	case "handler":
+		return lambda.Handler, true
+	case "role":
+		return lambda.Role, true
+	case "description":
+		return lambda.Description, true
+	case "memory":
+		return formatInt(lambda.MemorySize), true
+	case "timeout":
+		return formatInt(lambda.Timeout), true
+	case "package-type":
+		return lambda.PackageType, true
+	case "architecture":
+		return lambda.Architecture, true
+	case "snapstart":
+		if lambda.SnapStart == nil {
+			return "", true
+		}
+		return lambda.SnapStart.ApplyOn, true
+	case "image-uri":
+		return lambda.Code.ImageURI, true
+	case "last-modified":
+		if s.LastModified == nil {
+			return "", true
+		}
+		return formatTime(*s.LastModified), true
+	case "discovered-at":
+		return formatTime(s.DiscoveredAt), true
+	case "repository-type":
+		return lambda.Code.RepositoryType, true
+	case "reserved-concurrency":
+		if lambda.ReservedConcurrency == nil {
+			return "", true
+		}
+		return formatInt(*lambda.ReservedConcurrency), true
+	case "provisioned-concurrency":
+		var requested int32
+		for _, p := range lambda.ProvisionedConcurrency {
+			requested += p.Requested
+		}
+		return formatInt(requested), true
+	case "invocations", "error-rate", "throttles", "duration-p95":
+		u := lambda.Usage
+		if u == nil {
+			return "", true
+		}
+		switch name {
+		case "invocations":
+			return strconv.FormatInt(u.Invocations, 10), true
+		case "error-rate":
+			return strconv.FormatFloat(u.ErrorRate, 'f', 4, 64), true
+		case "throttles":
+			return strconv.FormatInt(u.Throttles, 10), true
+		}
+		return strconv.FormatFloat(u.DurationP95, 'f', 1, 64), true
+	case "tags":
+		tags := make([]string, 0, len(s.Tags))
+		for k, v := range s.Tags {
+			tags = append(tags, k+"="+v)
+		}
+		sort.Strings(tags)
+		return strings.Join(tags, ","), true
+	case "owner":
+		return s.Owner, true
+	case "delegated-services":
+		if s.Details.Account == nil {
+			return "", true
+		}
+		principals := make([]string, len(s.Details.Account.DelegatedServices))
+		for i, d := range s.Details.Account.DelegatedServices {
+			principals[i] = d.ServicePrincipal
+		}
+		return strings.Join(principals, ","), true
+	case "stack-set":
+		if s.StackSet == nil {
+			return "", true
+		}
+		return s.StackSet.Name, true
+	case "cost":
+		if s.Cost == nil {
+			return "", true
+		}
+		return strconv.FormatFloat(s.Cost.Monthly, 'f', 2, 64), true
+	case "cost-source":
+		if s.Cost == nil {
+			return "", true
+		}
+		return s.Cost.Source, true
+	}
+	return "", false
+}
+
+// UniqueNames names every service uniquely once passed through clean, which
+// may map several names to one: its own name where that is unique, qualified
+// with its region and then its account where it is not, and numbered as a
+// last resort.
+func UniqueNames(services []Service, clean func(string) string) []string {
+	qualify := []func(Service) string{
+		func(s Service) string { return s.Name },
+		func(s Service) string { return s.Name + "-" + s.Region },
+		func(s Service) string { return s.Name + "-" + s.Region + "-" + s.AccountID },
+	}
+	names := make([]string, len(services))
+	level := make([]int, len(services))
+	for {
+		seen := map[string][]int{}
+		for i, s := range services {
+			names[i] = clean(qualify[level[i]](s))
+			seen[names[i]] = append(seen[names[i]], i)
+		}
+		changed := false
+		for _, idx := range seen {
+			if len(idx) < 2 {
+				continue
+			}
+			for _, i := range idx {
+				if level[i] < len(qualify)-1 {
+					level[i]++
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	count := map[string]int{}
+	for i := range names {
+		if count[names[i]]++; count[names[i]] > 1 {
+			names[i] = names[i] + "-" + strconv.Itoa(count[names[i]])
+		}
+	}
+	return names
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatInt(n int32) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(n))
+}
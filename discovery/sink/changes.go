@@ -0,0 +1,75 @@
+package sink
+
+import (
+	"sort"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/snapshot"
+)
+
+// ChangeKind is how a service differs from the baseline of a run.
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeChanged ChangeKind = "changed"
+	ChangeRemoved ChangeKind = "removed"
+)
+
+// Changes tracks how the services of a run differ from a baseline, usually
+// the last complete snapshot, as they are discovered. A Changes belongs to
+// one sink.
+type Changes struct {
+	baseline string
+	previous map[string]discovery.Service
+}
+
+// NewChanges returns a tracker comparing with the services of the snapshot
+// with ID baseline.
+func NewChanges(baseline string, services []discovery.Service) *Changes {
+	c := &Changes{baseline: baseline, previous: make(map[string]discovery.Service, len(services))}
+	for _, s := range services {
+		c.previous[snapshot.Key(s)] = s
+	}
+	return c
+}
+
+// Baseline returns the ID of the snapshot compared with.
+func (c *Changes) Baseline() string {
+	return c.baseline
+}
+
+// Previous returns the baseline's state of s, if the baseline holds it and
+// it has not been observed yet.
+func (c *Changes) Previous(s discovery.Service) (discovery.Service, bool) {
+	prev, ok := c.previous[snapshot.Key(s)]
+	return prev, ok
+}
+
+// Observe records that s was discovered and returns how it differs from the
+// baseline: ChangeAdded, ChangeChanged with the JSON fields that differ, or
+// "" when it is unchanged.
+func (c *Changes) Observe(s discovery.Service) (ChangeKind, []string) {
+	k := snapshot.Key(s)
+	prev, ok := c.previous[k]
+	if !ok {
+		return ChangeAdded, nil
+	}
+	delete(c.previous, k)
+	if fields := snapshot.ChangedFields(prev, s); len(fields) > 0 {
+		return ChangeChanged, fields
+	}
+	return "", nil
+}
+
+// Removed returns the baseline services that were not observed. They are
+// only known to be gone when the run was complete; see
+// discovery.RunReport.Status.
+func (c *Changes) Removed() []discovery.Service {
+	removed := make([]discovery.Service, 0, len(c.previous))
+	for _, s := range c.previous {
+		removed = append(removed, s)
+	}
+	sort.Slice(removed, func(i, j int) bool { return snapshot.Key(removed[i]) < snapshot.Key(removed[j]) })
+	return removed
+}
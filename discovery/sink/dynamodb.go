@@ -0,0 +1,188 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// DynamoDBAPI is the subset of the DynamoDB client the sink uses.
+type DynamoDBAPI interface {
+	BatchWriteItem(ctx context.Context, in *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// KeyColumn is the column a key attribute is filled from.
+const KeyColumn = "key"
+
+// Key is a key attribute of the table and the service column holding its
+// value: KeyColumn for discovery.Service.Key, or any of
+// discovery.ServiceColumns, e.g. "account".
+type Key struct {
+	Attribute string
+	Column    string
+}
+
+func (k Key) value(s discovery.Service) (string, error) {
+	if k.Column == KeyColumn {
+		return s.Key(), nil
+	}
+	v, _ := s.Column(k.Column)
+	if v == "" {
+		return "", fmt.Errorf("%s has no %s for key attribute %s", s.Key(), k.Column, k.Attribute)
+	}
+	return v, nil
+}
+
+// DynamoDBOptions configure a DynamoDB sink.
+type DynamoDBOptions struct {
+	Table string
+	// PartitionKey defaults to attribute "id" holding the service key; its
+	// column defaults to KeyColumn.
+	PartitionKey Key
+	// SortKey is unset for tables without one.
+	SortKey Key
+	// TTLAttribute, if set, holds the epoch second TTL after a service was
+	// last written, for DynamoDB's time to live to delete services that are
+	// no longer discovered. TTL must then be positive.
+	TTLAttribute string
+	TTL          time.Duration
+}
+
+// Validate reports whether the options name a table and usable keys.
+func (o DynamoDBOptions) Validate() error {
+	if o.Table == "" {
+		return errors.New("dynamodb sink needs a table")
+	}
+	if o.SortKey.Attribute != "" && o.SortKey.Column == "" {
+		return fmt.Errorf("dynamodb sink: sort key %s needs a column", o.SortKey.Attribute)
+	}
+	for _, k := range []Key{o.PartitionKey, o.SortKey} {
+		if k.Column == "" || k.Column == KeyColumn {
+			continue
+		}
+		if _, ok := (discovery.Service{}).Column(k.Column); !ok {
+			return fmt.Errorf("dynamodb sink: unknown key column %q", k.Column)
+		}
+	}
+	if o.TTLAttribute != "" && o.TTL <= 0 {
+		return errors.New("dynamodb sink: ttl_attribute needs a positive ttl")
+	}
+	return nil
+}
+
+// dynamoBatch is the most items BatchWriteItem accepts.
+const dynamoBatch = 25
+
+// dynamoRetries bounds the retries of items DynamoDB leaves unprocessed.
+const dynamoRetries = 5
+
+// DynamoDB upserts every discovered service into a table, one item per
+// service, with the service's JSON fields as attributes.
+type DynamoDB struct {
+	client  DynamoDBAPI
+	opts    DynamoDBOptions
+	pending []types.WriteRequest
+	now     func() time.Time
+}
+
+// NewDynamoDB returns a sink writing to opts.Table with client.
+func NewDynamoDB(client DynamoDBAPI, opts DynamoDBOptions) (*DynamoDB, error) {
+	if opts.PartitionKey.Attribute == "" {
+		opts.PartitionKey = Key{Attribute: "id", Column: KeyColumn}
+	}
+	if opts.PartitionKey.Column == "" {
+		opts.PartitionKey.Column = KeyColumn
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return &DynamoDB{client: client, opts: opts, now: time.Now}, nil
+}
+
+func (d *DynamoDB) Name() string {
+	return "dynamodb"
+}
+
+func (d *DynamoDB) Write(ctx context.Context, s discovery.Service) error {
+	item, err := d.item(s)
+	if err != nil {
+		return err
+	}
+	d.pending = append(d.pending, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	if len(d.pending) < dynamoBatch {
+		return nil
+	}
+	return d.flush(ctx)
+}
+
+func (d *DynamoDB) Finish(ctx context.Context, report *discovery.RunReport) error {
+	return d.flush(ctx)
+}
+
+// item returns the attributes stored for s: its JSON fields plus the keys
+// and the TTL.
+func (d *DynamoDB) item(s discovery.Service) (map[string]types.AttributeValue, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	item, err := attributevalue.MarshalMap(fields)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", s.Key(), err)
+	}
+	for _, k := range []Key{d.opts.PartitionKey, d.opts.SortKey} {
+		if k.Attribute == "" {
+			continue
+		}
+		v, err := k.value(s)
+		if err != nil {
+			return nil, err
+		}
+		item[k.Attribute] = &types.AttributeValueMemberS{Value: v}
+	}
+	if d.opts.TTLAttribute != "" {
+		expires := d.now().Add(d.opts.TTL).Unix()
+		item[d.opts.TTLAttribute] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expires, 10)}
+	}
+	return item, nil
+}
+
+// flush writes the pending items, retrying those DynamoDB leaves
+// unprocessed when throttled.
+func (d *DynamoDB) flush(ctx context.Context) error {
+	requests := d.pending
+	d.pending = nil
+	for attempt := 0; len(requests) > 0; attempt++ {
+		if attempt > dynamoRetries {
+			return fmt.Errorf("writing to %s: %d items still unprocessed after %d retries", d.opts.Table, len(requests), dynamoRetries)
+		}
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(1<<attempt) * 50 * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		out, err := d.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{d.opts.Table: requests},
+		})
+		if err != nil {
+			return fmt.Errorf("writing to %s: %w", d.opts.Table, err)
+		}
+		requests = out.UnprocessedItems[d.opts.Table]
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/snapshot"
+)
+
+// EventBridgeAPI is the subset of the EventBridge client the sink uses.
+type EventBridgeAPI interface {
+	PutEvents(ctx context.Context, in *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// eventBridgeBatch is the most entries PutEvents accepts.
+const eventBridgeBatch = 10
+
+// eventBridgeRetries bounds the retries of entries EventBridge fails.
+const eventBridgeRetries = 5
+
+// DefaultEventSource is the source of events when none is configured.
+const DefaultEventSource = "discovery"
+
+// EventBridgeOptions configure an EventBridge sink.
+type EventBridgeOptions struct {
+	// Bus is the event bus name or ARN; it defaults to "default".
+	Bus string
+	// Source defaults to DefaultEventSource.
+	Source string
+}
+
+// ChangeEvent is the detail of an EventBridge event. Its detail type is
+// "Service Added", "Service Changed" or "Service Removed".
+type ChangeEvent struct {
+	Change ChangeKind `json:"change"`
+	// Run identifies the run, in the format of snapshot IDs.
+	Run string `json:"run"`
+	// Baseline is the snapshot the run was compared with.
+	Baseline string            `json:"baseline"`
+	Service  discovery.Service `json:"service"`
+	// Fields lists the top-level JSON fields of a changed service that
+	// differ from the baseline.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// EventBridge publishes an event for every service added, changed or
+// removed since a baseline snapshot, for rules to route to other
+// automation.
+type EventBridge struct {
+	client  EventBridgeAPI
+	opts    EventBridgeOptions
+	changes *Changes
+	run     string
+	pending []types.PutEventsRequestEntry
+}
+
+// NewEventBridge returns a sink putting events on opts.Bus with client.
+// Services are only reported removed after a complete run.
+func NewEventBridge(client EventBridgeAPI, opts EventBridgeOptions, changes *Changes) *EventBridge {
+	if opts.Bus == "" {
+		opts.Bus = "default"
+	}
+	if opts.Source == "" {
+		opts.Source = DefaultEventSource
+	}
+	return &EventBridge{client: client, opts: opts, changes: changes, run: snapshot.NewID(time.Now())}
+}
+
+func (e *EventBridge) Name() string {
+	return "eventbridge"
+}
+
+func (e *EventBridge) Write(ctx context.Context, s discovery.Service) error {
+	kind, fields := e.changes.Observe(s)
+	if kind == "" {
+		return nil
+	}
+	if err := e.add(kind, s, fields); err != nil {
+		return err
+	}
+	if len(e.pending) < eventBridgeBatch {
+		return nil
+	}
+	return e.flush(ctx)
+}
+
+func (e *EventBridge) Finish(ctx context.Context, report *discovery.RunReport) error {
+	if report.Status() == "complete" {
+		for _, s := range e.changes.Removed() {
+			if err := e.add(ChangeRemoved, s, nil); err != nil {
+				return err
+			}
+			if len(e.pending) == eventBridgeBatch {
+				if err := e.flush(ctx); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return e.flush(ctx)
+}
+
+var detailTypes = map[ChangeKind]string{
+	ChangeAdded:   "Service Added",
+	ChangeChanged: "Service Changed",
+	ChangeRemoved: "Service Removed",
+}
+
+func (e *EventBridge) add(kind ChangeKind, s discovery.Service, fields []string) error {
+	detail, err := json.Marshal(ChangeEvent{
+		Change:   kind,
+		Run:      e.run,
+		Baseline: e.changes.Baseline(),
+		Service:  s,
+		Fields:   fields,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", s.Key(), err)
+	}
+	entry := types.PutEventsRequestEntry{
+		EventBusName: aws.String(e.opts.Bus),
+		Source:       aws.String(e.opts.Source),
+		DetailType:   aws.String(detailTypes[kind]),
+		Detail:       aws.String(string(detail)),
+	}
+	if s.ARN != "" {
+		entry.Resources = []string{s.ARN}
+	}
+	e.pending = append(e.pending, entry)
+	return nil
+}
+
+// flush puts the pending events, retrying the entries EventBridge fails,
+// e.g. when throttled.
+func (e *EventBridge) flush(ctx context.Context) error {
+	entries := e.pending
+	e.pending = nil
+	for attempt := 0; len(entries) > 0; attempt++ {
+		if attempt > eventBridgeRetries {
+			return fmt.Errorf("putting events on %s: %d events still failing after %d retries", e.opts.Bus, len(entries), eventBridgeRetries)
+		}
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(1<<attempt) * 50 * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		out, err := e.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries})
+		if err != nil {
+			return fmt.Errorf("putting events on %s: %w", e.opts.Bus, err)
+		}
+		if out.FailedEntryCount == 0 {
+			return nil
+		}
+		var failed []types.PutEventsRequestEntry
+		for i, r := range out.Entries {
+			if r.ErrorCode != nil && i < len(entries) {
+				failed = append(failed, entries[i])
+			}
+		}
+		entries = failed
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/snapshot"
+)
+
+// kafkaBatch is how many messages are produced per request.
+const kafkaBatch = 500
+
+// SASL mechanisms.
+const (
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
+)
+
+// KafkaProducer is the part of kafka.Writer used by the sink.
+type KafkaProducer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaOptions configure the connection to a Kafka cluster.
+type KafkaOptions struct {
+	Brokers  []string
+	Topic    string
+	ClientID string
+	// TLS, if set, encrypts connections to the brokers.
+	TLS *KafkaTLS
+	// SASL, if set, authenticates with the brokers.
+	SASL *KafkaSASL
+}
+
+// KafkaTLS configures TLS. Without a CAFile the system roots are trusted;
+// CertFile and KeyFile, if set, authenticate the client.
+type KafkaTLS struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// KafkaSASL configures SASL authentication.
+type KafkaSASL struct {
+	// Mechanism is SASLPlain, SASLScramSHA256 or SASLScramSHA512.
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+// Validate reports whether the options name brokers, a topic and a known
+// SASL mechanism.
+func (o KafkaOptions) Validate() error {
+	if len(o.Brokers) == 0 {
+		return errors.New("kafka sink needs brokers")
+	}
+	if o.Topic == "" {
+		return errors.New("kafka sink needs a topic")
+	}
+	if t := o.TLS; t != nil && (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("kafka sink: tls needs both cert_file and key_file")
+	}
+	if o.SASL != nil {
+		switch o.SASL.Mechanism {
+		case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+		default:
+			return fmt.Errorf("kafka sink: unknown sasl mechanism %q (supported: %s, %s, %s)",
+				o.SASL.Mechanism, SASLPlain, SASLScramSHA256, SASLScramSHA512)
+		}
+	}
+	return nil
+}
+
+// NewKafkaWriter returns a writer producing to the topic named by opts.
+// Messages are partitioned by key, so the events of a service stay in order.
+func NewKafkaWriter(opts KafkaOptions) (*kafka.Writer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	transport := &kafka.Transport{ClientID: opts.ClientID}
+	if opts.TLS != nil {
+		cfg, err := opts.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLS = cfg
+	}
+	if opts.SASL != nil {
+		m, err := opts.SASL.mechanism()
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = m
+	}
+	return &kafka.Writer{
+		Addr:         kafka.TCP(opts.Brokers...),
+		Topic:        opts.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchSize:    kafkaBatch,
+		BatchTimeout: 100 * time.Millisecond,
+		Transport:    transport,
+	}, nil
+}
+
+func (t *KafkaTLS) config() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading kafka CA file: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka CA file %s holds no certificates", t.CAFile)
+		}
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading kafka client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (s *KafkaSASL) mechanism() (sasl.Mechanism, error) {
+	switch s.Mechanism {
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, s.Username, s.Password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, s.Username, s.Password)
+	}
+	return plain.Mechanism{Username: s.Username, Password: s.Password}, nil
+}
+
+// Kafka event types, also set in the "event" header of every message.
+const (
+	KafkaService = "service"
+	KafkaRun     = "run"
+)
+
+// KafkaEvent is the value of a Kafka message. Service events are keyed by
+// the service's key, run events by the run ID.
+type KafkaEvent struct {
+	// Event is KafkaService for every discovered service, a ChangeKind for
+	// a service that differs from the baseline, or KafkaRun once the run
+	// ends.
+	Event string `json:"event"`
+	// Run identifies the run, in the format of snapshot IDs.
+	Run string `json:"run"`
+	// Baseline is the snapshot change events compare with.
+	Baseline string             `json:"baseline,omitempty"`
+	Service  *discovery.Service `json:"service,omitempty"`
+	// Fields lists the top-level JSON fields of a changed service that
+	// differ from the baseline.
+	Fields []string             `json:"fields,omitempty"`
+	Report *discovery.RunReport `json:"report,omitempty"`
+}
+
+// Kafka publishes a run's services, and how they changed since a baseline,
+// to a Kafka topic.
+type Kafka struct {
+	w       KafkaProducer
+	changes *Changes
+	run     string
+	pending []kafka.Message
+}
+
+// NewKafka returns a sink producing with w. With changes, it also
+// publishes added, changed and removed events; services are only reported
+// removed after a complete run.
+func NewKafka(w KafkaProducer, changes *Changes) *Kafka {
+	return &Kafka{w: w, changes: changes, run: snapshot.NewID(time.Now())}
+}
+
+func (k *Kafka) Name() string {
+	return "kafka"
+}
+
+func (k *Kafka) Write(ctx context.Context, s discovery.Service) error {
+	if err := k.add(snapshot.Key(s), KafkaEvent{Event: KafkaService, Service: &s}); err != nil {
+		return err
+	}
+	if k.changes != nil {
+		if kind, fields := k.changes.Observe(s); kind != "" {
+			if err := k.add(snapshot.Key(s), KafkaEvent{Event: string(kind), Service: &s, Fields: fields}); err != nil {
+				return err
+			}
+		}
+	}
+	if len(k.pending) < kafkaBatch {
+		return nil
+	}
+	return k.flush(ctx)
+}
+
+// Finish publishes the remaining events, then the run's report.
+func (k *Kafka) Finish(ctx context.Context, report *discovery.RunReport) error {
+	defer k.w.Close()
+	if k.changes != nil && report.Status() == "complete" {
+		for _, s := range k.changes.Removed() {
+			s := s
+			if err := k.add(snapshot.Key(s), KafkaEvent{Event: string(ChangeRemoved), Service: &s}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := k.add(k.run, KafkaEvent{Event: KafkaRun, Report: report}); err != nil {
+		return err
+	}
+	return k.flush(ctx)
+}
+
+func (k *Kafka) add(key string, e KafkaEvent) error {
+	e.Run = k.run
+	if k.changes != nil {
+		e.Baseline = k.changes.Baseline()
+	}
+	value, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding kafka event: %w", err)
+	}
+	k.pending = append(k.pending, kafka.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: []kafka.Header{{Key: "event", Value: []byte(e.Event)}},
+	})
+	return nil
+}
+
+func (k *Kafka) flush(ctx context.Context) error {
+	if len(k.pending) == 0 {
+		return nil
+	}
+	err := k.w.WriteMessages(ctx, k.pending...)
+	k.pending = k.pending[:0]
+	if err != nil {
+		return fmt.Errorf("producing to kafka: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/snapshot"
+	"github.com/jamesneb/causal/discovery/sqldb"
+)
+
+// postgresBatch is how many services are written per transaction.
+const postgresBatch = 500
+
+// Postgres upserts every discovered service into a PostgreSQL database
+// laid out by package sqldb, recording the run in its runs table.
+type Postgres struct {
+	db      *sqldb.DB
+	run     string
+	pending []discovery.Service
+	// failed is set once a write fails, so the run is not recorded as
+	// complete.
+	failed bool
+}
+
+// NewPostgres connects to the database at url, migrating its schema, and
+// records the start of a run.
+func NewPostgres(ctx context.Context, url string) (*Postgres, error) {
+	if url == "" {
+		return nil, errors.New("postgres sink needs a url")
+	}
+	db, err := sqldb.OpenPostgres(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now().UTC()
+	p := &Postgres{db: db, run: snapshot.NewID(started)}
+	if err := db.StartRun(ctx, p.run, started); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Postgres) Name() string {
+	return "postgres"
+}
+
+func (p *Postgres) Write(ctx context.Context, s discovery.Service) error {
+	p.pending = append(p.pending, s)
+	if len(p.pending) < postgresBatch {
+		return nil
+	}
+	return p.flush(ctx)
+}
+
+func (p *Postgres) flush(ctx context.Context) error {
+	err := p.db.WriteServices(ctx, p.run, p.pending)
+	p.pending = p.pending[:0]
+	if err != nil {
+		p.failed = true
+	}
+	return err
+}
+
+// Finish writes the remaining services and records the run's status.
+func (p *Postgres) Finish(ctx context.Context, report *discovery.RunReport) error {
+	defer p.db.Close()
+	err := p.flush(ctx)
+	status := report.Status()
+	if p.failed {
+		status = "partial"
+	}
+	if ferr := p.db.FinishRun(ctx, p.run, time.Now(), status, report.Services); err == nil {
+		err = ferr
+	}
+	return err
+}
@@ -0,0 +1,256 @@
+package sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/snapshot"
+)
+
+// S3API is the subset of the S3 client the sink uses.
+type S3API interface {
+	PutObject(ctx context.Context, in *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3 object formats.
+const (
+	// S3JSON is gzip-compressed JSON Lines, one service per line.
+	S3JSON = "json"
+	// S3Parquet is zstd-compressed Parquet.
+	S3Parquet = "parquet"
+)
+
+// S3Options configure an S3 sink.
+type S3Options struct {
+	Bucket string
+	// Prefix is prepended to every key, e.g. "inventory/".
+	Prefix string
+	// Format is S3JSON (the default) or S3Parquet.
+	Format string
+}
+
+// Validate reports whether the options name a bucket and a known format.
+func (o S3Options) Validate() error {
+	if o.Bucket == "" {
+		return errors.New("s3 sink needs a bucket")
+	}
+	switch o.Format {
+	case "", S3JSON, S3Parquet:
+		return nil
+	}
+	return fmt.Errorf("s3 sink: unknown format %q (supported: %s, %s)", o.Format, S3JSON, S3Parquet)
+}
+
+// S3 writes every run to a bucket as one object per account and region,
+// under Hive-style partitions:
+//
+//	<prefix>dt=2024-05-01/account=123456789012/region_name=us-east-1/20240501T120000Z.json.gz
+//
+// so a partitioned Athena table over the prefix holds the inventory history.
+// The region partition is region_name since partition columns may not share
+// a name with the region field.
+// Services are spooled to one temporary file as they arrive, interleaved
+// across partitions, and each partition's object is encoded and uploaded in
+// turn when the run ends. Only one object is open at a time however many
+// accounts and regions an organization has.
+type S3 struct {
+	client S3API
+	opts   S3Options
+	// spool holds every service as a JSON line, and records locates those
+	// of each partition in it.
+	spool   *os.File
+	buf     *bufio.Writer
+	size    int64
+	records map[partition][]record
+}
+
+type partition struct {
+	account, region string
+}
+
+// record is the location of one service in the spool.
+type record struct {
+	offset int64
+	length int
+}
+
+// NewS3 returns a sink writing to opts.Bucket with client.
+func NewS3(client S3API, opts S3Options) (*S3, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Format == "" {
+		opts.Format = S3JSON
+	}
+	return &S3{client: client, opts: opts, records: map[partition][]record{}}, nil
+}
+
+func (s *S3) Name() string {
+	return "s3"
+}
+
+func (s *S3) Write(ctx context.Context, svc discovery.Service) error {
+	if s.spool == nil {
+		f, err := os.CreateTemp("", "discovery-s3-*")
+		if err != nil {
+			return fmt.Errorf("spooling services: %w", err)
+		}
+		s.spool, s.buf = f, bufio.NewWriter(f)
+	}
+	line, err := json.Marshal(svc)
+	if err != nil {
+		return fmt.Errorf("spooling services: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := s.buf.Write(line); err != nil {
+		return fmt.Errorf("spooling services: %w", err)
+	}
+	p := partition{account: partitionValue(svc.AccountID, "unknown"), region: partitionValue(svc.Region, "global")}
+	s.records[p] = append(s.records[p], record{offset: s.size, length: len(line)})
+	s.size += int64(len(line))
+	return nil
+}
+
+// Finish uploads an object per partition. Each object records the run's
+// status in its discovery-status metadata, since an interrupted run's
+// objects hold only part of the inventory.
+func (s *S3) Finish(ctx context.Context, report *discovery.RunReport) error {
+	defer s.remove()
+	if s.spool == nil {
+		return nil
+	}
+	if err := s.buf.Flush(); err != nil {
+		return fmt.Errorf("spooling services: %w", err)
+	}
+	keys := make([]partition, 0, len(s.records))
+	for p := range s.records {
+		keys = append(keys, p)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].account != keys[j].account {
+			return keys[i].account < keys[j].account
+		}
+		return keys[i].region < keys[j].region
+	})
+	for _, p := range keys {
+		if err := s.upload(ctx, p, s.records[p], report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upload encodes the services of partition p from the spool into a
+// temporary file and uploads it.
+func (s *S3) upload(ctx context.Context, p partition, records []record, report *discovery.RunReport) error {
+	f, err := os.CreateTemp("", "discovery-s3-*")
+	if err != nil {
+		return fmt.Errorf("spooling services: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := s.encode(f, records); err != nil {
+		return fmt.Errorf("spooling services: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("spooling services: %w", err)
+	}
+	key := s.key(p, report)
+	in := &s3.PutObjectInput{
+		Bucket:   aws.String(s.opts.Bucket),
+		Key:      aws.String(key),
+		Body:     f,
+		Metadata: map[string]string{"discovery-status": report.Status()},
+	}
+	if s.opts.Format != S3Parquet {
+		in.ContentType = aws.String("application/gzip")
+	}
+	if _, err := s.client.PutObject(ctx, in); err != nil {
+		return fmt.Errorf("uploading s3://%s/%s: %w", s.opts.Bucket, key, err)
+	}
+	return nil
+}
+
+// encode writes the spooled services of records to w in the sink's format.
+func (s *S3) encode(w io.Writer, records []record) error {
+	var line []byte
+	read := func(r record) error {
+		line = slices.Grow(line[:0], r.length)[:r.length]
+		_, err := s.spool.ReadAt(line, r.offset)
+		return err
+	}
+	if s.opts.Format == S3Parquet {
+		pw := snapshot.NewParquetWriter(w)
+		for _, r := range records {
+			if err := read(r); err != nil {
+				return err
+			}
+			var svc discovery.Service
+			if err := json.Unmarshal(line, &svc); err != nil {
+				return err
+			}
+			if err := pw.Write(svc); err != nil {
+				return err
+			}
+		}
+		return pw.Close()
+	}
+	gz := gzip.NewWriter(w)
+	for _, r := range records {
+		if err := read(r); err != nil {
+			return err
+		}
+		if _, err := gz.Write(line); err != nil {
+			return err
+		}
+	}
+	return gz.Close()
+}
+
+// key returns the object key of partition p for the run that started at
+// report.Started.
+func (s *S3) key(p partition, report *discovery.RunReport) string {
+	started := report.Started.UTC()
+	name := started.Format("20060102T150405Z") + ".json.gz"
+	if s.opts.Format == S3Parquet {
+		name = started.Format("20060102T150405Z") + ".parquet"
+	}
+	return s.opts.Prefix + path.Join(
+		"dt="+started.Format("2006-01-02"),
+		"account="+p.account,
+		"region_name="+p.region,
+		name,
+	)
+}
+
+func (s *S3) remove() {
+	if s.spool != nil {
+		s.spool.Close()
+		os.Remove(s.spool.Name())
+	}
+	s.spool, s.buf, s.size = nil, nil, 0
+	s.records = map[partition][]record{}
+}
+
+// partitionValue makes v usable as a partition value, replacing an empty
+// one with def.
+func partitionValue(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return strings.NewReplacer("/", "_", "=", "_").Replace(v)
+}
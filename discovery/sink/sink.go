@@ -0,0 +1,80 @@
+// Package sink delivers the services of every discovery run to external
+// stores, such as a DynamoDB table, so the catalog can be queried by other
+// systems. Sinks are best effort: a sink that fails is reported and dropped
+// for the rest of the run, and discovery carries on.
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Sink stores the services of a run.
+type Sink interface {
+	// Name identifies the sink in warnings, e.g. "dynamodb".
+	Name() string
+	// Write stores a discovered service. Sinks may buffer writes.
+	Write(ctx context.Context, s discovery.Service) error
+	// Finish stores anything buffered once the run has ended, however it
+	// ended, and releases the sink; report describes the run. It is called
+	// even after Write failed.
+	Finish(ctx context.Context, report *discovery.RunReport) error
+}
+
+// Set passes the services of a run to several sinks. It is a
+// discovery.ResultHandler.
+type Set struct {
+	sinks  []Sink
+	failed []Sink
+	// Warnings receives a line for every sink that fails.
+	Warnings io.Writer
+}
+
+// NewSet returns a set writing to sinks, warning on w.
+func NewSet(w io.Writer, sinks ...Sink) *Set {
+	return &Set{sinks: sinks, Warnings: w}
+}
+
+// Len returns the number of sinks still receiving services.
+func (s *Set) Len() int {
+	return len(s.sinks)
+}
+
+// HandleResult implements discovery.ResultHandler. It never fails the run.
+func (s *Set) HandleResult(ctx context.Context, r discovery.Result) error {
+	if r.Err != nil {
+		return nil
+	}
+	kept := s.sinks[:0]
+	for _, k := range s.sinks {
+		if err := k.Write(ctx, r.Service); err != nil {
+			s.warn(k, err)
+			s.failed = append(s.failed, k)
+			continue
+		}
+		kept = append(kept, k)
+	}
+	s.sinks = kept
+	return nil
+}
+
+// Finish finishes every sink. Errors are only reported for sinks that had
+// not already failed.
+func (s *Set) Finish(ctx context.Context, report *discovery.RunReport) {
+	for _, k := range s.sinks {
+		if err := k.Finish(ctx, report); err != nil {
+			s.warn(k, err)
+		}
+	}
+	for _, k := range s.failed {
+		k.Finish(ctx, report)
+	}
+	s.sinks, s.failed = nil, nil
+}
+
+func (s *Set) warn(k Sink, err error) {
+	fmt.Fprintf(s.Warnings, "Warning: %s sink: %v\n", k.Name(), err)
+}
@@ -0,0 +1,202 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/snapshot"
+)
+
+// Webhook modes.
+const (
+	// WebhookSnapshot posts the whole run once it ends.
+	WebhookSnapshot = "snapshot"
+	// WebhookStream posts an event per service as it is discovered, and a
+	// final event with the run report.
+	WebhookStream = "stream"
+)
+
+// Signature headers. The signature is the hex HMAC-SHA256, keyed with the
+// secret, of the timestamp, a ".", and the body, so receivers can reject
+// replayed requests by their timestamp.
+const (
+	SignatureHeader = "X-Discovery-Signature-256"
+	TimestampHeader = "X-Discovery-Timestamp"
+)
+
+// WebhookOptions configure a webhook sink.
+type WebhookOptions struct {
+	URL string
+	// Secret, if set, signs every request.
+	Secret string
+	// Mode is WebhookSnapshot (the default) or WebhookStream.
+	Mode    string
+	Headers map[string]string
+	// Timeout bounds each attempt; it defaults to 30s.
+	Timeout time.Duration
+	// Retries is how often a failed request is retried; nil means 3, and 0
+	// or less turns retries off. Responses other than 429 and 5xx are not
+	// retried.
+	Retries *int
+}
+
+// defaultWebhookRetries is the number of retries when none is configured.
+const defaultWebhookRetries = 3
+
+// Validate reports whether the options name a URL and a known mode.
+func (o WebhookOptions) Validate() error {
+	if o.URL == "" {
+		return errors.New("webhook sink needs a url")
+	}
+	switch o.Mode {
+	case "", WebhookSnapshot, WebhookStream:
+		return nil
+	}
+	return fmt.Errorf("webhook sink: unknown mode %q (supported: %s, %s)", o.Mode, WebhookSnapshot, WebhookStream)
+}
+
+// WebhookEvent is the body of a webhook request.
+type WebhookEvent struct {
+	// Event is "service" for a streamed service, "run" when a streamed run
+	// ends, or "snapshot" for a whole run.
+	Event string `json:"event"`
+	// Run identifies the run, in the format of snapshot IDs.
+	Run      string               `json:"run"`
+	Service  *discovery.Service   `json:"service,omitempty"`
+	Services []discovery.Service  `json:"services,omitempty"`
+	Report   *discovery.RunReport `json:"report,omitempty"`
+}
+
+// Webhook posts a run's services to a URL as JSON.
+type Webhook struct {
+	opts    WebhookOptions
+	retries int
+	client  *http.Client
+	run     string
+	pending []discovery.Service
+}
+
+// NewWebhook returns a sink posting to opts.URL.
+func NewWebhook(opts WebhookOptions) (*Webhook, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Mode == "" {
+		opts.Mode = WebhookSnapshot
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	retries := defaultWebhookRetries
+	if opts.Retries != nil {
+		retries = max(*opts.Retries, 0)
+	}
+	return &Webhook{
+		opts:    opts,
+		retries: retries,
+		client:  &http.Client{Timeout: opts.Timeout},
+		run:     snapshot.NewID(time.Now()),
+	}, nil
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+func (w *Webhook) Write(ctx context.Context, s discovery.Service) error {
+	if w.opts.Mode == WebhookStream {
+		return w.post(ctx, WebhookEvent{Event: "service", Run: w.run, Service: &s})
+	}
+	w.pending = append(w.pending, s)
+	return nil
+}
+
+func (w *Webhook) Finish(ctx context.Context, report *discovery.RunReport) error {
+	if w.opts.Mode == WebhookStream {
+		return w.post(ctx, WebhookEvent{Event: "run", Run: w.run, Report: report})
+	}
+	services := w.pending
+	w.pending = nil
+	if services == nil {
+		services = []discovery.Service{}
+	}
+	return w.post(ctx, WebhookEvent{Event: "snapshot", Run: w.run, Services: services, Report: report})
+}
+
+// post sends e, retrying failures with exponential backoff.
+func (w *Webhook) post(ctx context.Context, e WebhookEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding webhook event: %w", err)
+	}
+	var lastErr error
+	for attempt := 0; attempt <= w.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(1<<attempt) * 250 * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		retry, err := w.send(ctx, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+	return fmt.Errorf("posting to %s: %w", w.opts.URL, lastErr)
+}
+
+// send makes one attempt, reporting whether a failure is worth retrying.
+func (w *Webhook) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.opts.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	if w.opts.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.opts.Secret, ts, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook responded %s", resp.Status)
+}
+
+// Sign returns the hex signature of body sent at timestamp, for receivers to
+// compare with the SignatureHeader (after its "sha256=" prefix) using
+// hmac.Equal.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
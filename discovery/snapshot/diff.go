@@ -0,0 +1,174 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Change is a service present in both snapshots whose recorded state differs.
+type Change struct {
+	Before discovery.Service `json:"before"`
+	After  discovery.Service `json:"after"`
+	// Fields lists the top-level JSON fields that differ, e.g. "details".
+	Fields []string `json:"fields"`
+	// Code is set for functions whose code was deployed again in between.
+	Code *CodeChange `json:"code,omitempty"`
+}
+
+// Code identifies the code a function runs: its package checksum and size,
+// or the digest of its image, and when it was last deployed.
+type Code struct {
+	SHA256       string     `json:"sha256,omitempty"`
+	Size         int64      `json:"size,omitempty"`
+	Image        string     `json:"image,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+}
+
+// CodeChange is the code of a function before and after a new deployment.
+type CodeChange struct {
+	Before Code `json:"before"`
+	After  Code `json:"after"`
+}
+
+// CodeChanged returns the change in the code of the function a and b record,
+// or nil when they run the same code or are not functions.
+func CodeChanged(a, b discovery.Service) *CodeChange {
+	before, ok := codeOf(a)
+	if !ok {
+		return nil
+	}
+	after, ok := codeOf(b)
+	if !ok || (before.SHA256 == after.SHA256 && before.Image == after.Image) {
+		return nil
+	}
+	return &CodeChange{Before: before, After: after}
+}
+
+func codeOf(s discovery.Service) (Code, bool) {
+	l := s.Details.Lambda
+	if l == nil || (l.Code.SHA256 == "" && l.Code.ResolvedImageURI == "") {
+		return Code{}, false
+	}
+	return Code{SHA256: l.Code.SHA256, Size: l.Code.Size, Image: l.Code.ResolvedImageURI, LastModified: s.LastModified}, true
+}
+
+// Diff is the difference between two snapshots.
+type Diff struct {
+	From    string              `json:"from"`
+	To      string              `json:"to"`
+	Added   []discovery.Service `json:"added"`
+	Removed []discovery.Service `json:"removed"`
+	Changed []Change            `json:"changed"`
+	// Incomplete is set when either snapshot is not complete: services it
+	// lacks may simply not have been scanned, so Added and Removed can
+	// include services that did not change.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// Empty reports whether the snapshots hold the same services.
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Compare loads snapshots from and to and returns their difference.
+func (s *Store) Compare(from, to string) (*Diff, error) {
+	a, err := s.Get(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.Get(to)
+	if err != nil {
+		return nil, err
+	}
+	before, err := s.LoadServices(a.ID)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.LoadServices(b.ID)
+	if err != nil {
+		return nil, err
+	}
+	d := DiffServices(before, after)
+	d.From, d.To = a.ID, b.ID
+	d.Incomplete = !a.Complete() || !b.Complete()
+	return d, nil
+}
+
+// DiffServices compares two sets of services matched by Key. DiscoveredAt,
+// Cost, and the presigned code locations and usage of functions are ignored
+// since they change on every run.
+func DiffServices(before, after []discovery.Service) *Diff {
+	old := make(map[string]discovery.Service, len(before))
+	for _, s := range before {
+		old[Key(s)] = s
+	}
+	d := &Diff{}
+	for _, s := range after {
+		k := Key(s)
+		prev, ok := old[k]
+		if !ok {
+			d.Added = append(d.Added, s)
+			continue
+		}
+		delete(old, k)
+		if fields := ChangedFields(prev, s); len(fields) > 0 {
+			d.Changed = append(d.Changed, Change{Before: prev, After: s, Fields: fields, Code: CodeChanged(prev, s)})
+		}
+	}
+	for _, s := range old {
+		d.Removed = append(d.Removed, s)
+	}
+	byKey := func(list []discovery.Service) func(i, j int) bool {
+		return func(i, j int) bool { return Key(list[i]) < Key(list[j]) }
+	}
+	sort.Slice(d.Added, byKey(d.Added))
+	sort.Slice(d.Removed, byKey(d.Removed))
+	sort.Slice(d.Changed, func(i, j int) bool { return Key(d.Changed[i].After) < Key(d.Changed[j].After) })
+	return d
+}
+
+// ChangedFields returns the top-level JSON fields that differ between a and
+// b, ignoring DiscoveredAt, Cost and the code locations, image scans and
+// usage of functions.
+func ChangedFields(a, b discovery.Service) []string {
+	a.DiscoveredAt, b.DiscoveredAt = time.Time{}, time.Time{}
+	a.Cost, b.Cost = nil, nil
+	for _, s := range []*discovery.Service{&a, &b} {
+		if l := s.Details.Lambda; l != nil && (l.Code.Location != "" || l.Code.Image != nil || l.Usage != nil) {
+			copied := *l
+			copied.Code.Location = ""
+			if l.Code.Image != nil {
+				image := *l.Code.Image
+				image.Scan = nil
+				copied.Code.Image = &image
+			}
+			copied.Usage = nil
+			s.Details.Lambda = &copied
+		}
+	}
+	ma, mb := jsonFields(a), jsonFields(b)
+	var fields []string
+	for k, va := range ma {
+		if !reflect.DeepEqual(va, mb[k]) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range mb {
+		if _, ok := ma[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func jsonFields(s discovery.Service) map[string]any {
+	data, _ := json.Marshal(s)
+	var m map[string]any
+	json.Unmarshal(data, &m)
+	return m
+}
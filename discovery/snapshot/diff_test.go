@@ -0,0 +1,71 @@
+package snapshot_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/snapshot"
+)
+
+func TestChangedFields(t *testing.T) {
+	// function returns a discovered function with a package, an image and
+	// usage, so each can be changed.
+	function := func() discovery.Service {
+		return discovery.Service{
+			Name:         "orders",
+			DiscoveredAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			Tags:         map[string]string{"team": "a"},
+			Cost:         &discovery.Cost{Monthly: 1, Currency: "USD", Source: "resource"},
+			Details: discovery.Details{Lambda: &discovery.LambdaDetails{
+				MemorySize: 128,
+				Code: discovery.LambdaCode{
+					Location: "https://example.com/a",
+					SHA256:   "a",
+					Image:    &discovery.ContainerImage{Digest: "sha256:a", Scan: &discovery.ImageScan{Status: "COMPLETE"}},
+				},
+				Usage: &discovery.LambdaUsage{Invocations: 1},
+			}},
+		}
+	}
+	tests := []struct {
+		name   string
+		change func(s *discovery.Service)
+		want   []string
+	}{
+		{name: "unchanged", change: func(s *discovery.Service) {}},
+		{name: "discovered again", change: func(s *discovery.Service) { s.DiscoveredAt = s.DiscoveredAt.Add(time.Hour) }},
+		{name: "cost", change: func(s *discovery.Service) { s.Cost.Monthly = 2 }},
+		{name: "cost removed", change: func(s *discovery.Service) { s.Cost = nil }},
+		{name: "code location signed again", change: func(s *discovery.Service) { s.Details.Lambda.Code.Location = "https://example.com/b" }},
+		{name: "image scanned again", change: func(s *discovery.Service) { s.Details.Lambda.Code.Image.Scan.Status = "FAILED" }},
+		{name: "usage", change: func(s *discovery.Service) { s.Details.Lambda.Usage = &discovery.LambdaUsage{Invocations: 2} }},
+		{name: "usage removed", change: func(s *discovery.Service) { s.Details.Lambda.Usage = nil }},
+		{name: "memory", change: func(s *discovery.Service) { s.Details.Lambda.MemorySize = 256 }, want: []string{"details"}},
+		{name: "package", change: func(s *discovery.Service) { s.Details.Lambda.Code.SHA256 = "b" }, want: []string{"details"}},
+		{name: "image", change: func(s *discovery.Service) { s.Details.Lambda.Code.Image.Digest = "sha256:b" }, want: []string{"details"}},
+		{
+			name: "several fields",
+			change: func(s *discovery.Service) {
+				s.Tags = nil
+				s.Name = "payments"
+				s.Cost = nil
+			},
+			want: []string{"name", "tags"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := function(), function()
+			tt.change(&b)
+			if got := snapshot.ChangedFields(a, b); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			// Ignoring fields must not change the functions compared.
+			if l := a.Details.Lambda; l.Code.Location == "" || l.Code.Image.Scan == nil || l.Usage == nil {
+				t.Error("ChangedFields changed the services it compared")
+			}
+		})
+	}
+}
@@ -0,0 +1,444 @@
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// parquetService is the Parquet row layout of a discovery.Service. Columns
+// mirror the service model and its JSON names, nesting details in groups, so
+// queries read like the JSON output: details.lambda.runtime. Optional columns
+// are null when the service has no value.
+type parquetService struct {
+	Provider           string            `parquet:"provider"`
+	AccountID          string            `parquet:"accountId,optional"`
+	Region             string            `parquet:"region"`
+	ARN                string            `parquet:"arn,optional"`
+	ResourceType       string            `parquet:"resourceType"`
+	Name               string            `parquet:"name"`
+	AccountAlias       string            `parquet:"accountAlias,optional"`
+	OrganizationalUnit string            `parquet:"organizationalUnit,optional"`
+	LastModified       *time.Time        `parquet:"lastModified,optional"`
+	DiscoveredAt       time.Time         `parquet:"discoveredAt"`
+	Tags               map[string]string `parquet:"tags"`
+	Owner              string            `parquet:"owner,optional"`
+	Cost               *parquetCost      `parquet:"cost,optional"`
+	StackSet           *parquetStackSet  `parquet:"stackSet,optional"`
+	Details            parquetDetails    `parquet:"details"`
+
+	Relationships []parquetRelationship `parquet:"relationships,list"`
+}
+
+type parquetRelationship struct {
+	From       string   `parquet:"from,optional"`
+	FromType   string   `parquet:"fromType,optional"`
+	Relation   string   `parquet:"relation"`
+	Target     string   `parquet:"target"`
+	TargetType string   `parquet:"targetType,optional"`
+	Via        string   `parquet:"via,optional"`
+	State      string   `parquet:"state,optional"`
+	Confidence string   `parquet:"confidence,optional"`
+	Actions    []string `parquet:"actions,list"`
+	Calls      int64    `parquet:"calls,optional"`
+}
+
+type parquetCost struct {
+	Monthly  float64 `parquet:"monthly"`
+	Currency string  `parquet:"currency"`
+	Source   string  `parquet:"source"`
+}
+
+type parquetStackSet struct {
+	Name                  string `parquet:"name"`
+	AdministrationAccount string `parquet:"administrationAccount,optional"`
+	PermissionModel       string `parquet:"permissionModel,optional"`
+}
+
+type parquetDetails struct {
+	Lambda       *parquetLambda       `parquet:"lambda,optional"`
+	APIGateway   *parquetAPIGateway   `parquet:"apiGateway,optional"`
+	StateMachine *parquetStateMachine `parquet:"stateMachine,optional"`
+	Account      *parquetAccount      `parquet:"account,optional"`
+}
+
+type parquetAccount struct {
+	Email             string                    `parquet:"email,optional"`
+	DelegatedServices []parquetDelegatedService `parquet:"delegatedServices,list"`
+}
+
+type parquetDelegatedService struct {
+	ServicePrincipal string     `parquet:"servicePrincipal"`
+	DelegatedAt      *time.Time `parquet:"delegatedAt,optional"`
+}
+
+type parquetStateMachine struct {
+	Type        string `parquet:"type"`
+	Status      string `parquet:"status,optional"`
+	Role        string `parquet:"role,optional"`
+	Description string `parquet:"description,optional"`
+}
+
+type parquetAPIGateway struct {
+	ID            string   `parquet:"id"`
+	Protocol      string   `parquet:"protocol"`
+	Description   string   `parquet:"description,optional"`
+	Endpoint      string   `parquet:"endpoint,optional"`
+	EndpointTypes []string `parquet:"endpointTypes,list"`
+}
+
+type parquetLambda struct {
+	Runtime                string                          `parquet:"runtime,optional"`
+	Handler                string                          `parquet:"handler,optional"`
+	Role                   string                          `parquet:"role,optional"`
+	Description            string                          `parquet:"description,optional"`
+	MemorySize             int32                           `parquet:"memorySize,optional"`
+	Timeout                int32                           `parquet:"timeout,optional"`
+	PackageType            string                          `parquet:"packageType,optional"`
+	Architecture           string                          `parquet:"architecture,optional"`
+	SnapStart              *parquetSnapStart               `parquet:"snapStart,optional"`
+	EnvironmentKeys        []string                        `parquet:"environmentKeys,list"`
+	Code                   parquetLambdaCode               `parquet:"code"`
+	Layers                 []parquetLambdaLayer            `parquet:"layers,list"`
+	ReservedConcurrency    *int32                          `parquet:"reservedConcurrency,optional"`
+	ProvisionedConcurrency []parquetProvisionedConcurrency `parquet:"provisionedConcurrency,list"`
+	VPC                    *parquetVPC                     `parquet:"vpc,optional"`
+	URL                    *parquetFunctionURL             `parquet:"url,optional"`
+	DeadLetterTarget       string                          `parquet:"deadLetterTarget,optional"`
+	EventInvokeConfigs     []parquetEventInvokeConfig      `parquet:"eventInvokeConfigs,list"`
+	Dependencies           []parquetDependency             `parquet:"dependencies,list"`
+	InvokePermissions      []parquetInvokePermission       `parquet:"invokePermissions,list"`
+	Usage                  *parquetLambdaUsage             `parquet:"usage,optional"`
+}
+
+type parquetLambdaUsage struct {
+	Since       time.Time `parquet:"since"`
+	Invocations int64     `parquet:"invocations"`
+	Errors      int64     `parquet:"errors"`
+	ErrorRate   float64   `parquet:"errorRate"`
+	Throttles   int64     `parquet:"throttles"`
+	DurationP95 float64   `parquet:"durationP95"`
+}
+
+type parquetProvisionedConcurrency struct {
+	Qualifier string                     `parquet:"qualifier"`
+	Requested int32                      `parquet:"requested"`
+	Allocated int32                      `parquet:"allocated"`
+	Status    string                     `parquet:"status,optional"`
+	Scaling   *parquetConcurrencyScaling `parquet:"scaling,optional"`
+}
+
+type parquetConcurrencyScaling struct {
+	MinCapacity int32                  `parquet:"minCapacity"`
+	MaxCapacity int32                  `parquet:"maxCapacity"`
+	Policies    []parquetScalingPolicy `parquet:"policies,list"`
+}
+
+type parquetScalingPolicy struct {
+	Name        string  `parquet:"name"`
+	Type        string  `parquet:"type"`
+	Metric      string  `parquet:"metric,optional"`
+	TargetValue float64 `parquet:"targetValue,optional"`
+}
+
+type parquetInvokePermission struct {
+	Sid                 string   `parquet:"sid,optional"`
+	Principals          []string `parquet:"principals,list"`
+	Actions             []string `parquet:"actions,list"`
+	SourceARNs          []string `parquet:"sourceArns,list"`
+	SourceAccounts      []string `parquet:"sourceAccounts,list"`
+	OrgIDs              []string `parquet:"orgIds,list"`
+	FunctionURLAuthType string   `parquet:"functionUrlAuthType,optional"`
+	Public              bool     `parquet:"public"`
+}
+
+type parquetDependency struct {
+	Ecosystem string `parquet:"ecosystem"`
+	Name      string `parquet:"name"`
+	Version   string `parquet:"version,optional"`
+	Manifest  string `parquet:"manifest"`
+}
+
+type parquetEventInvokeConfig struct {
+	Qualifier            string `parquet:"qualifier"`
+	OnSuccess            string `parquet:"onSuccess,optional"`
+	OnFailure            string `parquet:"onFailure,optional"`
+	MaximumRetryAttempts *int32 `parquet:"maximumRetryAttempts,optional"`
+	MaximumEventAge      *int32 `parquet:"maximumEventAge,optional"`
+}
+
+type parquetFunctionURL struct {
+	URL      string `parquet:"url"`
+	AuthType string `parquet:"authType,optional"`
+}
+
+type parquetVPC struct {
+	VPCID            string   `parquet:"vpcId"`
+	SubnetIDs        []string `parquet:"subnetIds,list"`
+	SecurityGroupIDs []string `parquet:"securityGroupIds,list"`
+}
+
+type parquetLambdaLayer struct {
+	ARN      string                `parquet:"arn"`
+	CodeSize int64                 `parquet:"codeSize,optional"`
+	Contents *parquetLayerContents `parquet:"contents,optional"`
+}
+
+type parquetLayerContents struct {
+	Files       int                     `parquet:"files"`
+	Size        int64                   `parquet:"size"`
+	Directories []parquetLayerDirectory `parquet:"directories,list"`
+	Libraries   []parquetDependency     `parquet:"libraries,list"`
+}
+
+type parquetLayerDirectory struct {
+	Path string `parquet:"path"`
+	Size int64  `parquet:"size"`
+}
+
+type parquetSnapStart struct {
+	ApplyOn            string `parquet:"applyOn"`
+	OptimizationStatus string `parquet:"optimizationStatus,optional"`
+}
+
+type parquetLambdaCode struct {
+	RepositoryType   string                 `parquet:"repositoryType,optional"`
+	Location         string                 `parquet:"location,optional"`
+	ImageURI         string                 `parquet:"imageUri,optional"`
+	ResolvedImageURI string                 `parquet:"resolvedImageUri,optional"`
+	SHA256           string                 `parquet:"sha256,optional"`
+	Size             int64                  `parquet:"size,optional"`
+	Image            *parquetContainerImage `parquet:"image,optional"`
+}
+
+type parquetContainerImage struct {
+	RegistryID string            `parquet:"registryId"`
+	Repository string            `parquet:"repository"`
+	Digest     string            `parquet:"digest"`
+	Tags       []string          `parquet:"tags,list"`
+	PushedAt   time.Time         `parquet:"pushedAt"`
+	Size       int64             `parquet:"size,optional"`
+	Labels     map[string]string `parquet:"labels"`
+	Scan       *parquetImageScan `parquet:"scan,optional"`
+}
+
+type parquetImageScan struct {
+	Status      string           `parquet:"status"`
+	CompletedAt *time.Time       `parquet:"completedAt,optional"`
+	Findings    map[string]int32 `parquet:"findings"`
+}
+
+func newParquetService(s discovery.Service) parquetService {
+	row := parquetService{
+		Provider:           s.Provider,
+		AccountID:          s.AccountID,
+		AccountAlias:       s.AccountAlias,
+		OrganizationalUnit: s.OrganizationalUnit,
+		Region:             s.Region,
+		ARN:                s.ARN,
+		ResourceType:       string(s.ResourceType),
+		Name:               s.Name,
+		DiscoveredAt:       s.DiscoveredAt,
+		Tags:               s.Tags,
+		Owner:              s.Owner,
+		LastModified:       s.LastModified,
+	}
+	if c := s.Cost; c != nil {
+		row.Cost = &parquetCost{Monthly: c.Monthly, Currency: c.Currency, Source: c.Source}
+	}
+	if set := s.StackSet; set != nil {
+		row.StackSet = &parquetStackSet{Name: set.Name, AdministrationAccount: set.AdministrationAccount, PermissionModel: set.PermissionModel}
+	}
+	for _, r := range s.Relationships {
+		row.Relationships = append(row.Relationships, parquetRelationship{
+			From:       r.From,
+			FromType:   string(r.FromType),
+			Relation:   r.Relation,
+			Target:     r.Target,
+			TargetType: string(r.TargetType),
+			Via:        r.Via,
+			State:      r.State,
+			Confidence: r.Confidence,
+			Actions:    r.Actions,
+			Calls:      r.Calls,
+		})
+	}
+	if l := s.Details.Lambda; l != nil {
+		row.Details.Lambda = &parquetLambda{
+			Runtime:         l.Runtime,
+			Handler:         l.Handler,
+			Role:            l.Role,
+			Description:     l.Description,
+			MemorySize:      l.MemorySize,
+			Timeout:         l.Timeout,
+			PackageType:     l.PackageType,
+			Architecture:    l.Architecture,
+			EnvironmentKeys: l.EnvironmentKeys,
+			Code: parquetLambdaCode{
+				RepositoryType:   l.Code.RepositoryType,
+				Location:         l.Code.Location,
+				ImageURI:         l.Code.ImageURI,
+				ResolvedImageURI: l.Code.ResolvedImageURI,
+				SHA256:           l.Code.SHA256,
+				Size:             l.Code.Size,
+			},
+			ReservedConcurrency: l.ReservedConcurrency,
+			DeadLetterTarget:    l.DeadLetterTarget,
+		}
+		if s := l.SnapStart; s != nil {
+			row.Details.Lambda.SnapStart = &parquetSnapStart{ApplyOn: s.ApplyOn, OptimizationStatus: s.OptimizationStatus}
+		}
+		if i := l.Code.Image; i != nil {
+			image := &parquetContainerImage{
+				RegistryID: i.RegistryID,
+				Repository: i.Repository,
+				Digest:     i.Digest,
+				Tags:       i.Tags,
+				PushedAt:   i.PushedAt,
+				Size:       i.Size,
+				Labels:     i.Labels,
+			}
+			if sc := i.Scan; sc != nil {
+				image.Scan = &parquetImageScan{Status: sc.Status, CompletedAt: sc.CompletedAt, Findings: sc.Findings}
+			}
+			row.Details.Lambda.Code.Image = image
+		}
+		for _, layer := range l.Layers {
+			pl := parquetLambdaLayer{ARN: layer.ARN, CodeSize: layer.CodeSize}
+			if c := layer.Contents; c != nil {
+				pl.Contents = &parquetLayerContents{Files: c.Files, Size: c.Size}
+				for _, d := range c.Directories {
+					pl.Contents.Directories = append(pl.Contents.Directories, parquetLayerDirectory(d))
+				}
+				for _, d := range c.Libraries {
+					pl.Contents.Libraries = append(pl.Contents.Libraries, parquetDependency(d))
+				}
+			}
+			row.Details.Lambda.Layers = append(row.Details.Lambda.Layers, pl)
+		}
+		if v := l.VPC; v != nil {
+			row.Details.Lambda.VPC = &parquetVPC{VPCID: v.VPCID, SubnetIDs: v.SubnetIDs, SecurityGroupIDs: v.SecurityGroupIDs}
+		}
+		if u := l.URL; u != nil {
+			row.Details.Lambda.URL = &parquetFunctionURL{URL: u.URL, AuthType: u.AuthType}
+		}
+		for _, p := range l.ProvisionedConcurrency {
+			pc := parquetProvisionedConcurrency{Qualifier: p.Qualifier, Requested: p.Requested, Allocated: p.Allocated, Status: p.Status}
+			if sc := p.Scaling; sc != nil {
+				pc.Scaling = &parquetConcurrencyScaling{MinCapacity: sc.MinCapacity, MaxCapacity: sc.MaxCapacity}
+				for _, policy := range sc.Policies {
+					pc.Scaling.Policies = append(pc.Scaling.Policies, parquetScalingPolicy(policy))
+				}
+			}
+			row.Details.Lambda.ProvisionedConcurrency = append(row.Details.Lambda.ProvisionedConcurrency, pc)
+		}
+		for _, c := range l.EventInvokeConfigs {
+			row.Details.Lambda.EventInvokeConfigs = append(row.Details.Lambda.EventInvokeConfigs, parquetEventInvokeConfig(c))
+		}
+		for _, d := range l.Dependencies {
+			row.Details.Lambda.Dependencies = append(row.Details.Lambda.Dependencies, parquetDependency(d))
+		}
+		for _, p := range l.InvokePermissions {
+			row.Details.Lambda.InvokePermissions = append(row.Details.Lambda.InvokePermissions, parquetInvokePermission(p))
+		}
+		if u := l.Usage; u != nil {
+			usage := parquetLambdaUsage(*u)
+			row.Details.Lambda.Usage = &usage
+		}
+	}
+	if a := s.Details.APIGateway; a != nil {
+		row.Details.APIGateway = &parquetAPIGateway{
+			ID:            a.ID,
+			Protocol:      a.Protocol,
+			Description:   a.Description,
+			Endpoint:      a.Endpoint,
+			EndpointTypes: a.EndpointTypes,
+		}
+	}
+	if m := s.Details.StateMachine; m != nil {
+		row.Details.StateMachine = &parquetStateMachine{
+			Type:        m.Type,
+			Status:      m.Status,
+			Role:        m.Role,
+			Description: m.Description,
+		}
+	}
+	if a := s.Details.Account; a != nil {
+		row.Details.Account = &parquetAccount{Email: a.Email}
+		for _, d := range a.DelegatedServices {
+			service := parquetDelegatedService{ServicePrincipal: d.ServicePrincipal, DelegatedAt: d.DelegatedAt}
+			row.Details.Account.DelegatedServices = append(row.Details.Account.DelegatedServices, service)
+		}
+	}
+	return row
+}
+
+// ParquetWriter writes services as a zstd-compressed Parquet file, one row
+// per service.
+type ParquetWriter struct {
+	pw    *parquet.GenericWriter[parquetService]
+	batch []parquetService
+	rows  int
+}
+
+// NewParquetWriter returns a writer of Parquet rows to w. Close must be
+// called to complete the file.
+func NewParquetWriter(w io.Writer) *ParquetWriter {
+	return &ParquetWriter{
+		pw:    parquet.NewGenericWriter[parquetService](w, parquet.Compression(&zstd.Codec{})),
+		batch: make([]parquetService, 0, recorderBatch),
+	}
+}
+
+// Write adds s to the file.
+func (p *ParquetWriter) Write(s discovery.Service) error {
+	p.batch = append(p.batch, newParquetService(s))
+	if len(p.batch) == cap(p.batch) {
+		return p.flush()
+	}
+	return nil
+}
+
+// Rows returns the number of services written.
+func (p *ParquetWriter) Rows() int {
+	return p.rows + len(p.batch)
+}
+
+// Close writes the buffered rows and the file footer.
+func (p *ParquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if err := p.pw.Close(); err != nil {
+		return fmt.Errorf("writing parquet: %w", err)
+	}
+	return nil
+}
+
+func (p *ParquetWriter) flush() error {
+	if _, err := p.pw.Write(p.batch); err != nil {
+		return fmt.Errorf("writing parquet: %w", err)
+	}
+	p.rows += len(p.batch)
+	p.batch = p.batch[:0]
+	return nil
+}
+
+// ExportParquet writes the services of snapshot id to w as a
+// zstd-compressed Parquet file, one row per service, for querying with tools
+// such as Athena or DuckDB. It returns the number of rows written.
+func (s *Store) ExportParquet(id string, w io.Writer) (int, error) {
+	pw := NewParquetWriter(w)
+	if err := s.Services(id, pw.Write); err != nil {
+		return pw.Rows(), err
+	}
+	if err := pw.Close(); err != nil {
+		return pw.Rows(), err
+	}
+	return pw.Rows(), nil
+}
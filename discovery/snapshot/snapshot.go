@@ -0,0 +1,333 @@
+// Package snapshot persists discovery runs in a local embedded database so
+// they can be listed, inspected, pruned and compared later.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// ErrNotFound is returned when a snapshot ID does not exist.
+var ErrNotFound = errors.New("snapshot not found")
+
+var (
+	bucketSnapshots = []byte("snapshots")
+	bucketServices  = []byte("services")
+)
+
+// Snapshot statuses besides the run report's "complete", "partial" and
+// "incomplete".
+const (
+	// StatusRunning marks a snapshot that is still being recorded.
+	StatusRunning = "running"
+	// StatusInterrupted marks a snapshot whose run ended without committing
+	// it, e.g. because the process was killed. Its services are whatever had
+	// been written by then.
+	StatusInterrupted = "interrupted"
+)
+
+// Snapshot describes one stored discovery run. Its services are stored
+// separately and read with Store.Services.
+type Snapshot struct {
+	ID      string    `json:"id"`
+	Started time.Time `json:"started"`
+	// Finished is when the run ended or, for an interrupted snapshot, when
+	// its services were last written.
+	Finished time.Time `json:"finished"`
+	Regions  []string  `json:"regions,omitempty"`
+	Services int       `json:"services"`
+	// Status is the run report's status, or StatusInterrupted.
+	Status string               `json:"status,omitempty"`
+	Report *discovery.RunReport `json:"report,omitempty"`
+}
+
+// Complete reports whether every region was scanned without errors, so that
+// services missing from the snapshot are known not to exist.
+func (s *Snapshot) Complete() bool {
+	return s.Status == "complete"
+}
+
+// decodeSnapshot decodes a stored snapshot record. The database is locked
+// while a run records into it, so a record still marked running was left by
+// a run that never committed.
+func decodeSnapshot(v []byte, snap *Snapshot) error {
+	if err := json.Unmarshal(v, snap); err != nil {
+		return err
+	}
+	switch {
+	case snap.Status == StatusRunning:
+		snap.Status = StatusInterrupted
+	case snap.Status == "" && snap.Report != nil:
+		snap.Status = snap.Report.Status()
+	}
+	return nil
+}
+
+// Store is a snapshot database file.
+type Store struct {
+	db *bolt.DB
+}
+
+// DefaultPath returns the per-user snapshot database location,
+// e.g. ~/.local/share/discovery/snapshots.db on Linux.
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("locating home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "discovery", "snapshots.db"), nil
+}
+
+// Open opens or creates the database at path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("creating snapshot directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening snapshot database %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketSnapshots); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(bucketServices)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing snapshot database: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// NewID returns a snapshot ID for a run started at t. IDs sort in time order.
+func NewID(t time.Time) string {
+	return t.UTC().Format("20060102T150405.000Z")
+}
+
+// List returns all snapshots, newest first.
+func (s *Store) List() ([]Snapshot, error) {
+	var snaps []Snapshot
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketSnapshots).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var snap Snapshot
+			if err := decodeSnapshot(v, &snap); err != nil {
+				return fmt.Errorf("decoding snapshot %s: %w", k, err)
+			}
+			snaps = append(snaps, snap)
+		}
+		return nil
+	})
+	return snaps, err
+}
+
+// Get returns the snapshot with id. The ID "latest" names the newest one.
+func (s *Store) Get(id string) (Snapshot, error) {
+	var snap Snapshot
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSnapshots)
+		var v []byte
+		if id == "latest" {
+			_, v = b.Cursor().Last()
+		} else {
+			v = b.Get([]byte(id))
+		}
+		if v == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return decodeSnapshot(v, &snap)
+	})
+	return snap, err
+}
+
+// Services calls fn for every service in the snapshot, in key order, without
+// loading the whole snapshot into memory.
+func (s *Store) Services(id string, fn func(discovery.Service) error) error {
+	snap, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketServices).Bucket([]byte(snap.ID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var svc discovery.Service
+			if err := json.Unmarshal(v, &svc); err != nil {
+				return fmt.Errorf("decoding service %s: %w", k, err)
+			}
+			return fn(svc)
+		})
+	})
+}
+
+// LoadServices returns every service in the snapshot.
+func (s *Store) LoadServices(id string) ([]discovery.Service, error) {
+	var services []discovery.Service
+	err := s.Services(id, func(svc discovery.Service) error {
+		services = append(services, svc)
+		return nil
+	})
+	return services, err
+}
+
+// Delete removes the snapshot and its services.
+func (s *Store) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketSnapshots).Get([]byte(id)) == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		if err := tx.Bucket(bucketSnapshots).Delete([]byte(id)); err != nil {
+			return err
+		}
+		err := tx.Bucket(bucketServices).DeleteBucket([]byte(id))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Prune deletes snapshots beyond the newest keep and, if olderThan is
+// positive, any snapshot that finished longer ago than olderThan. It returns
+// the IDs it deleted.
+func (s *Store) Prune(keep int, olderThan time.Duration) ([]string, error) {
+	snaps, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var deleted []string
+	for i, snap := range snaps {
+		expired := olderThan > 0 && time.Since(snap.Finished) > olderThan
+		if (keep > 0 && i >= keep) || expired {
+			if err := s.Delete(snap.ID); err != nil {
+				return deleted, err
+			}
+			deleted = append(deleted, snap.ID)
+		}
+	}
+	return deleted, nil
+}
+
+// Key identifies a service across snapshots; see discovery.Service.Key.
+func Key(s discovery.Service) string {
+	return s.Key()
+}
+
+// A Recorder writes pending services every recorderBatch services or every
+// recorderInterval, whichever comes first, so a run that dies keeps nearly
+// everything it found.
+const (
+	recorderBatch    = 500
+	recorderInterval = 10 * time.Second
+)
+
+// Recorder writes a run into the store as it happens. It is a
+// discovery.ResultHandler; call Commit once the run ends. Until then the
+// snapshot is listed as running, or as interrupted if the run never commits.
+type Recorder struct {
+	store     *Store
+	snap      Snapshot
+	pending   map[string][]byte
+	lastFlush time.Time
+}
+
+// Record starts a new snapshot for a run over regions, writing its record
+// straight away.
+func (s *Store) Record(regions []string) (*Recorder, error) {
+	started := time.Now().UTC()
+	r := &Recorder{
+		store:   s,
+		snap:    Snapshot{ID: NewID(started), Started: started, Regions: regions, Status: StatusRunning},
+		pending: map[string][]byte{},
+	}
+	if err := r.flush(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ID returns the ID the snapshot will be stored under.
+func (r *Recorder) ID() string {
+	return r.snap.ID
+}
+
+// HandleResult implements discovery.ResultHandler.
+func (r *Recorder) HandleResult(ctx context.Context, res discovery.Result) error {
+	if res.Err != nil {
+		return nil
+	}
+	data, err := json.Marshal(res.Service)
+	if err != nil {
+		return fmt.Errorf("encoding service for snapshot: %w", err)
+	}
+	r.pending[Key(res.Service)] = data
+	if len(r.pending) >= recorderBatch || time.Since(r.lastFlush) >= recorderInterval {
+		return r.flush()
+	}
+	return nil
+}
+
+// Commit writes the remaining services and marks the snapshot with the
+// report's status. Commit a cancelled or failed run too: its snapshot is
+// kept, marked incomplete or partial.
+func (r *Recorder) Commit(report *discovery.RunReport) (Snapshot, error) {
+	r.snap.Report = report
+	r.snap.Status = "incomplete"
+	if report != nil {
+		r.snap.Status = report.Status()
+	}
+	err := r.flush()
+	return r.snap, err
+}
+
+// flush writes pending services and the snapshot record.
+func (r *Recorder) flush() error {
+	r.snap.Finished = time.Now().UTC()
+	err := r.store.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(bucketServices).CreateBucketIfNotExists([]byte(r.snap.ID))
+		if err != nil {
+			return err
+		}
+		for k, v := range r.pending {
+			if b.Get([]byte(k)) == nil {
+				r.snap.Services++
+			}
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(&r.snap); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketSnapshots).Put([]byte(r.snap.ID), buf.Bytes())
+	})
+	if err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	clear(r.pending)
+	r.lastFlush = r.snap.Finished
+	return nil
+}
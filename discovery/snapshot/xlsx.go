@@ -0,0 +1,244 @@
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// overviewSheet is the first sheet of an exported workbook.
+const overviewSheet = "Overview"
+
+// xlsxNumeric lists the service columns written as numbers, so they sort
+// and sum in a spreadsheet.
+var xlsxNumeric = map[string]bool{
+	"memory": true, "timeout": true, "reserved-concurrency": true, "provisioned-concurrency": true,
+	"invocations": true, "error-rate": true, "throttles": true, "duration-p95": true,
+}
+
+// ExportXLSX writes snapshot id to w as an Excel workbook: an overview sheet
+// with the snapshot's details and service counts by resource type and by
+// account and region, then one sheet per resource type with a row per
+// service. Resource sheets have the table columns of the list command, with
+// a column per tag key instead of a single tags column. It returns the
+// number of rows written.
+func (s *Store) ExportXLSX(id string, w io.Writer) (int, error) {
+	snap, err := s.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	services, err := s.LoadServices(snap.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	byType := map[discovery.ResourceType][]discovery.Service{}
+	for _, svc := range services {
+		byType[svc.ResourceType] = append(byType[svc.ResourceType], svc)
+	}
+	types := make([]discovery.ResourceType, 0, len(byType))
+	for t := range byType {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	sheets := sheetNames(types)
+
+	f := excelize.NewFile()
+	defer f.Close()
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return 0, err
+	}
+	if err := f.SetSheetName("Sheet1", overviewSheet); err != nil {
+		return 0, err
+	}
+	if err := writeOverview(f, bold, snap, services, types, sheets, byType); err != nil {
+		return 0, fmt.Errorf("writing overview: %w", err)
+	}
+	for i, t := range types {
+		if _, err := f.NewSheet(sheets[i]); err != nil {
+			return 0, err
+		}
+		if err := writeServiceSheet(f, bold, sheets[i], byType[t]); err != nil {
+			return 0, fmt.Errorf("writing %s: %w", sheets[i], err)
+		}
+	}
+	f.SetActiveSheet(0)
+	if _, err := f.WriteTo(w); err != nil {
+		return 0, err
+	}
+	return len(services), nil
+}
+
+func writeOverview(f *excelize.File, bold int, snap Snapshot, services []discovery.Service, types []discovery.ResourceType, sheets []string, byType map[discovery.ResourceType][]discovery.Service) error {
+	sw, err := f.NewStreamWriter(overviewSheet)
+	if err != nil {
+		return err
+	}
+	if err := sw.SetColWidth(1, 1, 28); err != nil {
+		return err
+	}
+	if err := sw.SetColWidth(2, 3, 24); err != nil {
+		return err
+	}
+
+	status := snap.Status
+	if status == "" {
+		status = "-"
+	}
+	rows := [][]any{
+		{excelize.Cell{StyleID: bold, Value: "Snapshot"}, snap.ID},
+		{excelize.Cell{StyleID: bold, Value: "Started"}, formatXLSXTime(snap.Started)},
+		{excelize.Cell{StyleID: bold, Value: "Finished"}, formatXLSXTime(snap.Finished)},
+		{excelize.Cell{StyleID: bold, Value: "Status"}, status},
+		{excelize.Cell{StyleID: bold, Value: "Services"}, len(services)},
+		nil,
+		{excelize.Cell{StyleID: bold, Value: "Resource type"}, excelize.Cell{StyleID: bold, Value: "Sheet"}, excelize.Cell{StyleID: bold, Value: "Services"}},
+	}
+	for i, t := range types {
+		rows = append(rows, []any{string(t), sheets[i], len(byType[t])})
+	}
+
+	type location struct{ account, region string }
+	counts := map[location]int{}
+	for _, svc := range services {
+		counts[location{svc.AccountID, svc.Region}]++
+	}
+	locations := make([]location, 0, len(counts))
+	for l := range counts {
+		locations = append(locations, l)
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].account != locations[j].account {
+			return locations[i].account < locations[j].account
+		}
+		return locations[i].region < locations[j].region
+	})
+	rows = append(rows, nil, []any{excelize.Cell{StyleID: bold, Value: "Account"}, excelize.Cell{StyleID: bold, Value: "Region"}, excelize.Cell{StyleID: bold, Value: "Services"}})
+	for _, l := range locations {
+		rows = append(rows, []any{l.account, l.region, counts[l]})
+	}
+
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := sw.SetRow(cell, row); err != nil {
+			return err
+		}
+	}
+	return sw.Flush()
+}
+
+func writeServiceSheet(f *excelize.File, bold int, sheet string, services []discovery.Service) error {
+	columns := make([]string, 0, len(discovery.ServiceColumns))
+	for _, c := range discovery.ServiceColumns {
+		// The sheet is the type, and tags get a column each.
+		if c != "type" && c != "tags" {
+			columns = append(columns, c)
+		}
+	}
+	keys := map[string]bool{}
+	for _, svc := range services {
+		for k := range svc.Tags {
+			keys[k] = true
+		}
+	}
+	tags := make([]string, 0, len(keys))
+	for k := range keys {
+		tags = append(tags, discovery.TagColumnPrefix+k)
+	}
+	sort.Strings(tags)
+	columns = append(columns, tags...)
+
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+	showStripes := true
+	if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return err
+	}
+	if err := sw.SetColWidth(1, len(columns), 18); err != nil {
+		return err
+	}
+
+	header := make([]any, len(columns))
+	for i, c := range columns {
+		header[i] = excelize.Cell{StyleID: bold, Value: c}
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return err
+	}
+	for i, svc := range services {
+		row := make([]any, len(columns))
+		for j, c := range columns {
+			v, _ := svc.Column(c)
+			row[j] = v
+			if n, err := strconv.Atoi(v); err == nil && xlsxNumeric[c] {
+				row[j] = n
+			}
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := sw.SetRow(cell, row); err != nil {
+			return err
+		}
+	}
+	last, _ := excelize.CoordinatesToCellName(len(columns), len(services)+1)
+	// A table gives every column a filter, and keeps it while rows are added.
+	if err := sw.AddTable(&excelize.Table{Range: "A1:" + last, StyleName: "TableStyleLight1", ShowRowStripes: &showStripes}); err != nil {
+		return err
+	}
+	return sw.Flush()
+}
+
+// sheetNames returns a sheet name for each resource type, e.g. "Lambda
+// Function" for AWS::Lambda::Function, within Excel's 31 characters and
+// unique among the workbook's sheets.
+func sheetNames(types []discovery.ResourceType) []string {
+	used := map[string]bool{strings.ToLower(overviewSheet): true}
+	names := make([]string, len(types))
+	for i, t := range types {
+		parts := strings.Split(string(t), "::")
+		if len(parts) > 1 {
+			parts = parts[1:]
+		}
+		base := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`:\/?*[]`, r) {
+				return ' '
+			}
+			return r
+		}, strings.Join(parts, " "))
+		base = strings.TrimSpace(base)
+		if base == "" {
+			base = "Services"
+		}
+		name := truncateSheetName(base, 31)
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			suffix := " (" + strconv.Itoa(n) + ")"
+			name = truncateSheetName(base, 31-len(suffix)) + suffix
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+func truncateSheetName(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return strings.TrimSpace(string(r[:n]))
+	}
+	return s
+}
+
+func formatXLSXTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
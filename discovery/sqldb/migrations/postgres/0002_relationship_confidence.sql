@@ -0,0 +1,3 @@
+-- Inferred relationships, e.g. from permissions, record how sure the
+-- inference is: high, medium or low. Configured ones leave it empty.
+ALTER TABLE relationships ADD COLUMN confidence TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,53 @@
+-- Timestamps are RFC 3339 text in UTC; details are JSON text.
+
+CREATE TABLE runs (
+    id        TEXT PRIMARY KEY,
+    started   TEXT NOT NULL,
+    finished  TEXT,
+    -- running until the run ends, then its report status, e.g. complete.
+    status    TEXT NOT NULL,
+    services  INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE services (
+    -- The ARN, or provider/account/region/type/name without one.
+    key            TEXT PRIMARY KEY,
+    provider       TEXT NOT NULL,
+    account_id     TEXT NOT NULL,
+    region         TEXT NOT NULL,
+    arn            TEXT NOT NULL,
+    resource_type  TEXT NOT NULL,
+    name           TEXT NOT NULL,
+    last_modified  TEXT,
+    discovered_at  TEXT NOT NULL,
+    -- The service's details object, e.g. {"lambda": {"runtime": ...}}.
+    details        TEXT NOT NULL,
+    first_run      TEXT NOT NULL REFERENCES runs (id),
+    last_run       TEXT NOT NULL REFERENCES runs (id)
+);
+
+CREATE INDEX services_resource_type ON services (resource_type);
+CREATE INDEX services_account_region ON services (account_id, region);
+CREATE INDEX services_last_run ON services (last_run);
+
+CREATE TABLE tags (
+    service_key  TEXT NOT NULL REFERENCES services (key) ON DELETE CASCADE,
+    key          TEXT NOT NULL,
+    value        TEXT NOT NULL,
+    PRIMARY KEY (service_key, key)
+);
+
+CREATE INDEX tags_key_value ON tags (key, value);
+
+-- from_key depends on to_key. The target need not be a discovered service,
+-- e.g. a Lambda function's execution role.
+CREATE TABLE relationships (
+    from_key          TEXT NOT NULL REFERENCES services (key) ON DELETE CASCADE,
+    to_key            TEXT NOT NULL,
+    relation          TEXT NOT NULL,
+    to_resource_type  TEXT NOT NULL,
+    to_name           TEXT NOT NULL,
+    PRIMARY KEY (from_key, to_key, relation)
+);
+
+CREATE INDEX relationships_to_key ON relationships (to_key);
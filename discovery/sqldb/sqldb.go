@@ -0,0 +1,265 @@
+// Package sqldb stores discovered services in a SQL database - the services,
+// their tags and the relationships between them, and the runs that found
+// them - so the inventory can be queried with standard SQL tools. The schema
+// is created and upgraded by embedded migrations.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// dialect is what differs between the supported databases.
+type dialect struct {
+	driver string
+	// migrations is the directory of the dialect's migrations.
+	migrations string
+	// numbered placeholders ($1, $2, ...) instead of "?".
+	numbered bool
+	// lock, if set, is run in the migration transaction to keep concurrent
+	// migrations apart.
+	lock string
+	// textTime stores timestamps as RFC 3339 text.
+	textTime bool
+}
+
+var postgres = dialect{
+	driver:     "pgx",
+	migrations: "migrations/postgres",
+	numbered:   true,
+	lock:       "SELECT pg_advisory_xact_lock(7426548517631)",
+}
+
+var sqlite = dialect{
+	driver:     "sqlite",
+	migrations: "migrations/sqlite",
+	textTime:   true,
+}
+
+// DB is an inventory database.
+type DB struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// OpenPostgres connects to the PostgreSQL database at url, e.g.
+// postgres://user@host/inventory, and migrates its schema.
+func OpenPostgres(ctx context.Context, url string) (*DB, error) {
+	return open(ctx, postgres, url)
+}
+
+// OpenSQLite opens or creates the SQLite database file at path and migrates
+// its schema.
+func OpenSQLite(ctx context.Context, path string) (*DB, error) {
+	return open(ctx, sqlite, "file:"+path+"?_pragma=foreign_keys(1)")
+}
+
+func open(ctx context.Context, d dialect, dsn string) (*DB, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &DB{db: db, dialect: d}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the connection.
+func (s *DB) Close() error {
+	return s.db.Close()
+}
+
+// migrate applies the migrations that have not run yet, each in its own
+// transaction, recording them in schema_migrations.
+func (s *DB) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied TEXT NOT NULL)`); err != nil {
+		return fmt.Errorf("migrating database: %w", err)
+	}
+	files, err := fs.Glob(migrations, s.dialect.migrations+"/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		version, err := strconv.Atoi(strings.SplitN(path.Base(f), "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", f, err)
+		}
+		if err := s.apply(ctx, f, version); err != nil {
+			return fmt.Errorf("migrating database to version %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (s *DB) apply(ctx context.Context, file string, version int) error {
+	script, err := migrations.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if s.dialect.lock != "" {
+		if _, err := tx.ExecContext(ctx, s.dialect.lock); err != nil {
+			return err
+		}
+	}
+	var applied int
+	if err := tx.QueryRowContext(ctx, s.query(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.query(`INSERT INTO schema_migrations (version, applied) VALUES (?, ?)`), version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// query rewrites the "?" placeholders of q for the dialect.
+func (s *DB) query(q string) string {
+	if !s.dialect.numbered {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// time returns t as stored by the dialect.
+func (s *DB) time(t time.Time) any {
+	if s.dialect.textTime {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return t.UTC()
+}
+
+// StartRun records the start of run id. Services written for it are marked
+// as last seen in it.
+func (s *DB) StartRun(ctx context.Context, id string, started time.Time) error {
+	_, err := s.db.ExecContext(ctx, s.query(`INSERT INTO runs (id, started, status) VALUES (?, ?, 'running')
+		ON CONFLICT (id) DO UPDATE SET started = excluded.started, status = excluded.status`), id, s.time(started))
+	if err != nil {
+		return fmt.Errorf("recording run: %w", err)
+	}
+	return nil
+}
+
+// FinishRun records the end of run id with status, e.g. "complete", and the
+// number of services it found.
+func (s *DB) FinishRun(ctx context.Context, id string, finished time.Time, status string, services int) error {
+	_, err := s.db.ExecContext(ctx, s.query(`UPDATE runs SET finished = ?, status = ?, services = ? WHERE id = ?`),
+		s.time(finished), status, services, id)
+	if err != nil {
+		return fmt.Errorf("recording run: %w", err)
+	}
+	return nil
+}
+
+// WriteServices upserts services found by run in one transaction, replacing
+// their tags and relationships.
+func (s *DB) WriteServices(ctx context.Context, run string, services []discovery.Service) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("writing services: %w", err)
+	}
+	defer tx.Rollback()
+	for _, svc := range services {
+		if err := s.writeService(ctx, tx, run, svc); err != nil {
+			return fmt.Errorf("writing %s: %w", svc.Key(), err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("writing services: %w", err)
+	}
+	return nil
+}
+
+func (s *DB) writeService(ctx context.Context, tx *sql.Tx, run string, svc discovery.Service) error {
+	key := svc.Key()
+	details, err := json.Marshal(svc.Details)
+	if err != nil {
+		return err
+	}
+	var lastModified any
+	if svc.LastModified != nil {
+		lastModified = s.time(*svc.LastModified)
+	}
+	_, err = tx.ExecContext(ctx, s.query(`INSERT INTO services
+		(key, provider, account_id, region, arn, resource_type, name, last_modified, discovered_at, details, first_run, last_run)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			provider = excluded.provider, account_id = excluded.account_id, region = excluded.region,
+			arn = excluded.arn, resource_type = excluded.resource_type, name = excluded.name,
+			last_modified = excluded.last_modified, discovered_at = excluded.discovered_at,
+			details = excluded.details, last_run = excluded.last_run`),
+		key, svc.Provider, svc.AccountID, svc.Region, svc.ARN, string(svc.ResourceType), svc.Name,
+		lastModified, s.time(svc.DiscoveredAt), string(details), run, run)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, s.query(`DELETE FROM tags WHERE service_key = ?`), key); err != nil {
+		return err
+	}
+	for k, v := range svc.Tags {
+		if _, err := tx.ExecContext(ctx, s.query(`INSERT INTO tags (service_key, key, value) VALUES (?, ?, ?)`), key, k, v); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, s.query(`DELETE FROM relationships WHERE from_key = ?`), key); err != nil {
+		return err
+	}
+	g := graph.New()
+	g.Add(svc)
+	for _, e := range g.Edges {
+		// Relationships between other resources, such as an S3 bucket a
+		// function's resource policy lets invoke it, have no service row.
+		if e.From != key {
+			continue
+		}
+		to, _ := g.Node(e.To)
+		if _, err := tx.ExecContext(ctx, s.query(`INSERT INTO relationships (from_key, to_key, relation, to_resource_type, to_name, confidence) VALUES (?, ?, ?, ?, ?, ?)`),
+			key, e.To, e.Relation, string(to.ResourceType), to.Name, e.Confidence); err != nil {
+			return err
+		}
+	}
+	return nil
+}
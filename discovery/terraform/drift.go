@@ -0,0 +1,218 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+)
+
+// Drift is the difference between Terraform state and a snapshot.
+type Drift struct {
+	// Unmanaged lists discovered resources that no state manages.
+	Unmanaged []discovery.Service `json:"unmanaged"`
+	// Missing lists managed resources that were not discovered.
+	Missing []Resource `json:"missing"`
+	// Changed lists managed resources whose discovered attributes differ
+	// from state.
+	Changed []Change `json:"changed"`
+	// Incomplete is set when the snapshot is not complete, so Missing may
+	// list resources that were simply not scanned.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// Change is a managed resource that drifted from its state.
+type Change struct {
+	Resource   Resource        `json:"resource"`
+	Attributes []AttributeDiff `json:"attributes"`
+}
+
+// AttributeDiff is one attribute whose state and discovered values differ.
+type AttributeDiff struct {
+	// Name is the attribute's name in Terraform, e.g. memory_size or
+	// tags.owner.
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	Discovered string `json:"discovered"`
+}
+
+// Empty reports whether state and the snapshot agree.
+func (d *Drift) Empty() bool {
+	return len(d.Unmanaged) == 0 && len(d.Missing) == 0 && len(d.Changed) == 0
+}
+
+// Scope is what a snapshot covered. A managed resource outside it is not
+// reported missing.
+type Scope struct {
+	Regions []string
+	// Accounts lists the accounts scanned; empty allows any.
+	Accounts []string
+}
+
+// Compare matches services with the managed resources by ARN. Only resource
+// types with a Terraform mapping are compared, and only types that are
+// discovered (not just referenced) can be missing.
+func Compare(services []discovery.Service, resources []Resource, scope Scope) *Drift {
+	managed := map[string]Resource{}
+	for _, r := range resources {
+		if r.ARN != "" && terraformTypes[r.Type] != "" {
+			managed[unqualified(r.ARN)] = r
+		}
+	}
+	d := &Drift{Unmanaged: []discovery.Service{}, Missing: []Resource{}, Changed: []Change{}}
+	seen := map[string]bool{}
+	for _, s := range services {
+		if _, ok := mappings[s.ResourceType]; !ok || s.ARN == "" {
+			continue
+		}
+		arn := unqualified(s.ARN)
+		seen[arn] = true
+		r, ok := managed[arn]
+		if !ok {
+			d.Unmanaged = append(d.Unmanaged, s)
+			continue
+		}
+		if attrs := attributeDiffs(r, s); len(attrs) > 0 {
+			d.Changed = append(d.Changed, Change{Resource: r, Attributes: attrs})
+		}
+	}
+	for _, r := range resources {
+		arn := unqualified(r.ARN)
+		if arn == "" || seen[arn] || !mappings[terraformTypes[r.Type]].discovered || !scope.covers(arn) {
+			continue
+		}
+		d.Missing = append(d.Missing, r)
+	}
+	sort.Slice(d.Missing, func(i, j int) bool { return d.Missing[i].Address < d.Missing[j].Address })
+	return d
+}
+
+// terraformTypes maps Terraform resource types back to resource types.
+var terraformTypes = func() map[string]discovery.ResourceType {
+	m := make(map[string]discovery.ResourceType, len(mappings))
+	for t, mp := range mappings {
+		m[mp.resource] = t
+	}
+	return m
+}()
+
+// unqualified strips the version or alias from a Lambda function ARN.
+func unqualified(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) == 8 && parts[2] == "lambda" && parts[5] == "function" {
+		return strings.Join(parts[:7], ":")
+	}
+	return arn
+}
+
+func (sc Scope) covers(arn string) bool {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return false
+	}
+	return contains(sc.Regions, parts[3]) && (len(sc.Accounts) == 0 || contains(sc.Accounts, parts[4]))
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeDiffs compares the attributes of a managed Lambda function with
+// what was discovered. Other types are matched only by ARN.
+func attributeDiffs(r Resource, s discovery.Service) []AttributeDiff {
+	l := s.Details.Lambda
+	if r.Type != "aws_lambda_function" || l == nil {
+		return nil
+	}
+	var diffs []AttributeDiff
+	compare := func(name, discovered string) {
+		if state := stateValue(r.attributes[name]); state != discovered {
+			diffs = append(diffs, AttributeDiff{Name: name, State: state, Discovered: discovered})
+		}
+	}
+	compare("runtime", l.Runtime)
+	compare("handler", l.Handler)
+	compare("role", l.Role)
+	compare("description", l.Description)
+	compare("memory_size", fmt.Sprint(l.MemorySize))
+	compare("timeout", fmt.Sprint(l.Timeout))
+	compare("package_type", l.PackageType)
+
+	// Only the names of environment variables are discovered, not their
+	// values; layers compare in order.
+	var envKeys []string
+	if env, _ := r.attributes["environment"].([]any); len(env) > 0 {
+		block, _ := env[0].(map[string]any)
+		vars, _ := block["variables"].(map[string]any)
+		for k := range vars {
+			envKeys = append(envKeys, k)
+		}
+		sort.Strings(envKeys)
+	}
+	if state, discovered := strings.Join(envKeys, ","), strings.Join(l.EnvironmentKeys, ","); state != discovered {
+		diffs = append(diffs, AttributeDiff{Name: "environment.variables", State: state, Discovered: discovered})
+	}
+	var stateLayers, layers []string
+	list, _ := r.attributes["layers"].([]any)
+	for _, v := range list {
+		stateLayers = append(stateLayers, stateValue(v))
+	}
+	for _, layer := range l.Layers {
+		layers = append(layers, layer.ARN)
+	}
+	if state, discovered := strings.Join(stateLayers, ","), strings.Join(layers, ","); state != discovered {
+		diffs = append(diffs, AttributeDiff{Name: "layers", State: state, Discovered: discovered})
+	}
+
+	// The code location, concurrency and tags come from GetFunction; a
+	// function known only from the listing has none of them.
+	if l.Code.RepositoryType == "" {
+		return diffs
+	}
+	compare("image_uri", l.Code.ImageURI)
+	reserved := ""
+	if l.ReservedConcurrency != nil {
+		reserved = fmt.Sprint(*l.ReservedConcurrency)
+	}
+	if state := stateValue(r.attributes["reserved_concurrent_executions"]); state != reserved && !(state == "-1" && reserved == "") {
+		diffs = append(diffs, AttributeDiff{Name: "reserved_concurrent_executions", State: state, Discovered: reserved})
+	}
+
+	// tags_all includes the provider's default tags, as AWS reports them.
+	tags, _ := r.attributes["tags_all"].(map[string]any)
+	if tags == nil {
+		tags, _ = r.attributes["tags"].(map[string]any)
+	}
+	keys := map[string]bool{}
+	for k := range tags {
+		keys[k] = true
+	}
+	for k := range s.Tags {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		if state := stateValue(tags[k]); state != s.Tags[k] {
+			diffs = append(diffs, AttributeDiff{Name: "tags." + k, State: state, Discovered: s.Tags[k]})
+		}
+	}
+	return diffs
+}
+
+// stateValue formats a state attribute for comparison; null is empty.
+func stateValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,185 @@
+// Package terraform connects discovered resources with Terraform: it writes
+// import blocks that bring unmanaged resources under management, and compares
+// Terraform state with what was discovered.
+package terraform
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jamesneb/causal/discovery"
+	"github.com/jamesneb/causal/discovery/graph"
+)
+
+// mapping is how a resource type is imported into Terraform.
+type mapping struct {
+	// resource is the Terraform resource type, e.g. aws_lambda_function.
+	resource string
+	// id returns the import ID of a node.
+	id func(graph.Node) string
+	// discovered is set for types the AWS provider discovers, rather than
+	// knowing of them only through references.
+	discovered bool
+}
+
+func nodeName(n graph.Node) string { return n.Name }
+
+// mappings lists the resource types that can be imported.
+var mappings = map[discovery.ResourceType]mapping{
+	discovery.ResourceTypeLambdaFunction: {"aws_lambda_function", nodeName, true},
+	discovery.ResourceTypeIAMRole:        {"aws_iam_role", nodeName, false},
+	discovery.ResourceTypeECRRepository:  {"aws_ecr_repository", nodeName, false},
+}
+
+// ResourceType returns the Terraform resource type of t, if it has one.
+func ResourceType(t discovery.ResourceType) (string, bool) {
+	m, ok := mappings[t]
+	return m.resource, ok
+}
+
+// Import is one resource to import.
+type Import struct {
+	// To is the Terraform address, e.g. aws_lambda_function.orders.
+	To string
+	ID string
+	// Provider is the provider configuration to import with, e.g.
+	// aws.eu_west_1, or empty for the default one.
+	Provider string
+	// Source is the discovered resource.
+	Source graph.Node
+}
+
+// ImportOptions control which imports are generated.
+type ImportOptions struct {
+	// Dependencies includes referenced resources that were not discovered
+	// themselves, such as execution roles.
+	Dependencies bool
+	// RegionProviders sets Provider to a per-region alias of the aws
+	// provider, e.g. aws.eu_west_1, for configurations that manage several
+	// regions.
+	RegionProviders bool
+}
+
+// Imports returns the imports for the nodes of g, in order. It also returns,
+// by resource type, how many nodes have no Terraform mapping.
+func Imports(g *graph.Graph, opts ImportOptions) ([]Import, map[discovery.ResourceType]int) {
+	var imports []Import
+	unsupported := map[discovery.ResourceType]int{}
+	for _, n := range g.Nodes {
+		if n.External && !opts.Dependencies {
+			continue
+		}
+		m, ok := mappings[n.ResourceType]
+		if !ok {
+			unsupported[n.ResourceType]++
+			continue
+		}
+		imp := Import{ID: m.id(n), Source: n}
+		if opts.RegionProviders && n.Region != "" {
+			imp.Provider = "aws." + strings.ReplaceAll(n.Region, "-", "_")
+		}
+		imports = append(imports, imp)
+	}
+	names := addressNames(imports)
+	for i := range imports {
+		imports[i].To = mappings[imports[i].Source.ResourceType].resource + "." + names[i]
+	}
+	return imports, unsupported
+}
+
+// WriteHCL writes imports as Terraform import blocks, for
+// "terraform plan -generate-config-out=generated.tf".
+func WriteHCL(w io.Writer, imports []Import) error {
+	bw := bufio.NewWriter(w)
+	for i, imp := range imports {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "# %s\n", imp.Source.ID)
+		fmt.Fprintf(bw, "import {\n  to = %s\n  id = %s\n", imp.To, hclQuote(imp.ID))
+		if imp.Provider != "" {
+			fmt.Fprintf(bw, "  provider = %s\n", imp.Provider)
+		}
+		bw.WriteString("}\n")
+	}
+	return bw.Flush()
+}
+
+// WriteCommands writes imports as terraform import commands, for
+// Terraform versions without import blocks. The command takes its provider
+// from the resource's configuration, so Provider is not used.
+func WriteCommands(w io.Writer, imports []Import) error {
+	bw := bufio.NewWriter(w)
+	for _, imp := range imports {
+		fmt.Fprintf(bw, "terraform import %s %s\n", shellQuote(imp.To), shellQuote(imp.ID))
+	}
+	return bw.Flush()
+}
+
+// addressNames gives every import a valid resource name, unique within its
+// Terraform type, qualified with the region where names repeat.
+func addressNames(imports []Import) []string {
+	names := make([]string, len(imports))
+	byType := map[string][]int{}
+	for i, imp := range imports {
+		names[i] = identifier(imp.Source.Name)
+		key := mappings[imp.Source.ResourceType].resource + "." + names[i]
+		byType[key] = append(byType[key], i)
+	}
+	keys := make([]string, 0, len(byType))
+	for k := range byType {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	used := map[string]bool{}
+	for _, k := range keys {
+		if len(byType[k]) == 1 {
+			used[k] = true
+		}
+	}
+	for _, k := range keys {
+		idx := byType[k]
+		if len(idx) == 1 {
+			continue
+		}
+		for _, i := range idx {
+			src := imports[i].Source
+			typ := mappings[src.ResourceType].resource
+			name := identifier(src.Name + "_" + src.Region)
+			for n := 2; used[typ+"."+name]; n++ {
+				name = identifier(fmt.Sprintf("%s_%s_%d", src.Name, src.Region, n))
+			}
+			used[typ+"."+name] = true
+			names[i] = name
+		}
+	}
+	return names
+}
+
+var notIdentifier = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// identifier makes s a Terraform resource name: lower case letters, digits
+// and underscores, not starting with a digit.
+func identifier(s string) string {
+	s = strings.Trim(notIdentifier.ReplaceAllString(strings.ToLower(s), "_"), "_")
+	if s == "" {
+		return "unnamed"
+	}
+	if s[0] >= '0' && s[0] <= '9' {
+		s = "r_" + s
+	}
+	return s
+}
+
+func hclQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", "$${", "%{", "%%{")
+	return `"` + r.Replace(s) + `"`
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
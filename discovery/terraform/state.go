@@ -0,0 +1,116 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Resource is a resource instance managed by Terraform, as recorded in state.
+type Resource struct {
+	// Address is the instance's address, e.g.
+	// module.api.aws_lambda_function.orders["eu"].
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	ARN     string `json:"arn,omitempty"`
+	// Source is the state the resource was read from.
+	Source string `json:"source"`
+
+	attributes map[string]any
+}
+
+// stateFile is the part of a version 4 state file that is compared.
+type stateFile struct {
+	Version   int `json:"version"`
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   any            `json:"index_key"`
+			Attributes map[string]any `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// ReadState returns the managed resources in the state read from r. source
+// names the state in errors and in the resources returned.
+func ReadState(r io.Reader, source string) ([]Resource, error) {
+	var st stateFile
+	if err := json.NewDecoder(r).Decode(&st); err != nil {
+		return nil, fmt.Errorf("reading state %s: %w", source, err)
+	}
+	if st.Version != 4 {
+		return nil, fmt.Errorf("reading state %s: unsupported state version %d (Terraform 0.12 and later write version 4)", source, st.Version)
+	}
+	var resources []Resource
+	for _, rs := range st.Resources {
+		if rs.Mode != "managed" {
+			continue
+		}
+		addr := rs.Type + "." + rs.Name
+		if rs.Module != "" {
+			addr = rs.Module + "." + addr
+		}
+		for _, inst := range rs.Instances {
+			res := Resource{Address: addr, Type: rs.Type, Source: source, attributes: inst.Attributes}
+			switch k := inst.IndexKey.(type) {
+			case string:
+				res.Address += fmt.Sprintf("[%q]", k)
+			case float64:
+				res.Address += fmt.Sprintf("[%d]", int(k))
+			}
+			res.ARN, _ = inst.Attributes["arn"].(string)
+			resources = append(resources, res)
+		}
+	}
+	return resources, nil
+}
+
+// LoadState reads the state at source: a file, "-" for standard input, or an
+// http(s) URL such as the address of Terraform's http backend.
+func LoadState(ctx context.Context, source string) ([]Resource, error) {
+	switch {
+	case source == "-":
+		return ReadState(os.Stdin, "stdin")
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, fmt.Errorf("reading state %s: %w", source, err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("reading state %s: %w", source, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("reading state %s: %s", source, resp.Status)
+		}
+		return ReadState(resp.Body, source)
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("reading state: %w", err)
+	}
+	defer f.Close()
+	return ReadState(f, source)
+}
+
+// PullState reads the state of the Terraform configuration in dir with
+// "terraform state pull", so any backend Terraform is configured for works.
+func PullState(ctx context.Context, dir string) ([]Resource, error) {
+	cmd := exec.CommandContext(ctx, "terraform", "-chdir="+dir, "state", "pull")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pulling state in %s: %w", dir, err)
+	}
+	return ReadState(bytes.NewReader(out), dir)
+}
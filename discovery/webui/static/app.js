@@ -0,0 +1,562 @@
+// The catalog's web interface: a single page routed by the URL fragment,
+//
+//   #/?q=&type=&region=&account=&offset=   the services table
+//   #/service/<key>                         a service and its dependencies
+//   #/graph?node=&direction=&depth=         the dependency graph
+//
+// reading the catalog API of "discovery serve", which is found relative to
+// the page so that it works behind a path prefix.
+'use strict';
+
+(function () {
+  var API = '../api/v1/';
+  var PAGE_SIZE = 100;
+  // Graphs bigger than this are not drawn, as for the HTML report; the
+  // graph view asks for a node to narrow them to instead.
+  var MAX_GRAPH_NODES = 500;
+  var PALETTE = ['#4e79a7', '#f28e2b', '#e15759', '#76b7b2', '#59a14f', '#edc948',
+    '#b07aa1', '#ff9da7', '#9c755f', '#bab0ac', '#2f4b7c', '#a05195'];
+
+  var view = document.getElementById('view');
+  var snapshot = null;
+  var renders = 0;
+
+  // el returns a new element with attributes and children; strings become
+  // text, so values from the catalog are never parsed as markup.
+  function el(tag, attrs) {
+    var e = document.createElement(tag);
+    for (var k in attrs || {}) {
+      if (attrs[k] == null || attrs[k] === false) continue;
+      if (k.slice(0, 2) === 'on') e.addEventListener(k.slice(2), attrs[k]);
+      else e.setAttribute(k, attrs[k]);
+    }
+    for (var i = 2; i < arguments.length; i++) append(e, arguments[i]);
+    return e;
+  }
+
+  function append(parent, child) {
+    if (child == null || child === false) return;
+    if (Array.isArray(child)) child.forEach(function (c) { append(parent, c); });
+    else parent.appendChild(typeof child === 'object' ? child : document.createTextNode(String(child)));
+  }
+
+  function svg(tag, attrs) {
+    var e = document.createElementNS('http://www.w3.org/2000/svg', tag);
+    for (var k in attrs || {}) e.setAttribute(k, attrs[k]);
+    return e;
+  }
+
+  function getJSON(path) {
+    return fetch(API + path, { headers: { Accept: 'application/json' } }).then(function (res) {
+      return res.json().catch(function () { return {}; }).then(function (body) {
+        if (!res.ok) throw new Error(body.error || res.status + ' ' + res.statusText);
+        return body;
+      });
+    });
+  }
+
+  function graphQL(query, variables) {
+    return fetch(API + 'graphql', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', Accept: 'application/json' },
+      body: JSON.stringify({ query: query, variables: variables })
+    }).then(function (res) {
+      return res.json().catch(function () { return {}; }).then(function (body) {
+        if (!res.ok) throw new Error(body.error || res.status + ' ' + res.statusText);
+        if (body.errors && body.errors.length) {
+          throw new Error(body.errors.map(function (e) { return e.message; }).join('; '));
+        }
+        return body.data;
+      });
+    });
+  }
+
+  function serviceHref(key) { return '#/service/' + encodeURIComponent(key); }
+
+  function graphHref(params) { return '#/graph?' + new URLSearchParams(params).toString(); }
+
+  function when(t) { return t && t.slice(0, 4) !== '0001' ? new Date(t).toLocaleString() : ''; }
+
+  function account(id, alias) { return alias ? alias + ' (' + id + ')' : id || ''; }
+
+  // show replaces the view with children, unless the user has moved on to
+  // another view since render started.
+  function show(render) {
+    if (render !== renders) return false;
+    view.replaceChildren.apply(view, Array.prototype.slice.call(arguments, 1));
+    return true;
+  }
+
+  function failed(render) {
+    return function (err) { show(render, el('p', { class: 'error' }, err.message)); };
+  }
+
+  // loadSnapshot shows the snapshot served in the header. The API answers
+  // 503 until the first run is recorded.
+  function loadSnapshot() {
+    var out = document.getElementById('snapshot');
+    return getJSON('snapshot').then(function (s) {
+      snapshot = s;
+      out.replaceChildren('Snapshot ' + s.id + ', ', el('span', { class: 'status-' + s.status }, s.status || 'unknown'),
+        ', ' + s.services + ' services, finished ' + when(s.finished));
+    }, function (err) {
+      snapshot = null;
+      out.replaceChildren(el('span', { class: 'error' }, err.message));
+    });
+  }
+
+  function route() {
+    var render = ++renders;
+    var hash = location.hash.slice(1) || '/';
+    var q = hash.indexOf('?');
+    var path = q < 0 ? hash : hash.slice(0, q);
+    var params = new URLSearchParams(q < 0 ? '' : hash.slice(q + 1));
+    var name = path === '/graph' ? 'graph' : 'services';
+    document.querySelectorAll('nav a').forEach(function (a) {
+      a.classList.toggle('active', a.getAttribute('data-view') === name);
+    });
+    loadSnapshot().then(function () {
+      if (path.indexOf('/service/') === 0) serviceView(render, decodeURIComponent(path.slice('/service/'.length)));
+      else if (path === '/graph') graphView(render, params);
+      else servicesView(render, params);
+    });
+  }
+
+  // The services table.
+
+  function servicesView(render, params) {
+    var offset = Math.max(0, parseInt(params.get('offset'), 10) || 0);
+    var form = el('form', { class: 'filters', onsubmit: function (e) { e.preventDefault(); } },
+      el('input', { type: 'search', name: 'q', placeholder: 'Search names, ARNs, tags…', value: params.get('q') || '' }),
+      filterSelect('type', 'Any type', facets().types, params.get('type')),
+      filterSelect('region', 'Any region', facets().regions, params.get('region')),
+      filterSelect('account', 'Any account', facets().accounts, params.get('account')));
+    var results = el('div', {}, el('p', { class: 'meta' }, 'Loading…'));
+    var timer;
+    function update() {
+      var next = new URLSearchParams();
+      new FormData(form).forEach(function (v, k) { if (v) next.set(k, v); });
+      // Searching replaces the entry rather than adding one per keystroke.
+      history.replaceState(null, '', '#/?' + next.toString());
+      load(next, 0);
+    }
+    form.addEventListener('input', function () { clearTimeout(timer); timer = setTimeout(update, 250); });
+    form.addEventListener('change', function (e) { if (e.target.tagName === 'SELECT') update(); });
+
+    function load(filters, offset) {
+      var query = new URLSearchParams(filters);
+      query.set('offset', offset);
+      query.set('limit', PAGE_SIZE);
+      getJSON('services?' + query.toString()).then(function (page) {
+        if (render !== renders) return;
+        results.replaceChildren(servicesTable(page, filters));
+      }, function (err) {
+        results.replaceChildren(el('p', { class: 'error' }, err.message));
+      });
+    }
+
+    var filters = new URLSearchParams(params);
+    filters.delete('offset');
+    if (!show(render, el('h2', {}, 'Services'), form, results)) return;
+    form.querySelector('input').focus();
+    if (snapshot) load(filters, offset);
+    else results.replaceChildren(el('p', { class: 'meta' }, 'No snapshot to show yet.'));
+  }
+
+  // facets returns the types, regions and accounts of the snapshot to offer
+  // as filters, from its run report.
+  function facets() {
+    var report = (snapshot && snapshot.report) || {};
+    var accounts = Object.keys(report.accounts || {}).sort().map(function (id) {
+      var a = report.accounts[id];
+      return { value: id, label: account(id, a.alias) };
+    });
+    return {
+      types: Object.keys(report.servicesByType || {}).sort(),
+      regions: ((snapshot && snapshot.regions) || []).slice().sort(),
+      accounts: accounts
+    };
+  }
+
+  function filterSelect(name, any, options, selected) {
+    var select = el('select', { name: name }, el('option', { value: '' }, any));
+    options.forEach(function (o) {
+      var value = typeof o === 'string' ? o : o.value;
+      select.appendChild(el('option', { value: value, selected: value === selected }, typeof o === 'string' ? o : o.label));
+    });
+    if (selected && !select.querySelector('option[selected]')) {
+      select.appendChild(el('option', { value: selected, selected: true }, selected));
+    }
+    return select;
+  }
+
+  function servicesTable(page, filters) {
+    var pageHref = function (offset) {
+      var p = new URLSearchParams(filters);
+      if (offset) p.set('offset', offset);
+      return '#/?' + p.toString();
+    };
+    var last = Math.min(page.offset + page.services.length, page.total);
+    var pager = el('div', { class: 'pager' },
+      el('span', { class: 'meta' }, page.total ? (page.offset + 1) + '–' + last + ' of ' + page.total + ' services' : 'No matching services'),
+      page.offset > 0 && el('a', { href: pageHref(Math.max(0, page.offset - page.limit)) }, '← Previous'),
+      page.next && el('a', { href: pageHref(page.offset + page.limit) }, 'Next →'));
+    if (!page.services.length) return pager;
+    return el('div', {}, pager, el('table', {},
+      el('thead', {}, el('tr', {}, ['Name', 'Type', 'Account', 'Region', 'Owner', 'Last modified'].map(function (h) { return el('th', {}, h); }))),
+      el('tbody', {}, page.services.map(function (s) {
+        return el('tr', {},
+          el('td', {}, el('a', { href: serviceHref(s.arn || serviceKey(s)) }, s.name)),
+          el('td', {}, s.resourceType),
+          el('td', {}, account(s.accountId, s.accountAlias)),
+          el('td', {}, s.region || ''),
+          el('td', {}, s.owner || ''),
+          el('td', {}, when(s.lastModified)));
+      }))), page.next && pager.cloneNode(true));
+  }
+
+  // serviceKey is discovery.Service.Key for services without an ARN.
+  function serviceKey(s) { return [s.provider, s.region, s.resourceType, s.name].join('/'); }
+
+  // A service's page.
+
+  var SERVICE_QUERY = 'query ($key: String!) { service(key: $key) {' +
+    ' key name arn provider accountId accountAlias organizationalUnit region resourceType' +
+    ' owner { name } tags { key value } lastModified discoveredAt json' +
+    ' dependencies { ...edge } dependents { ...edge } } }' +
+    ' fragment edge on Dependency { relation confidence calls ports crossAccount' +
+    ' node { id name resourceType external accountId region } }';
+
+  function serviceView(render, key) {
+    show(render, el('p', { class: 'meta' }, 'Loading…'));
+    graphQL(SERVICE_QUERY, { key: key }).then(function (data) {
+      var s = data.service;
+      if (!s) {
+        show(render, el('p', { class: 'error' }, 'No service ' + key + ' in the snapshot.'));
+        return;
+      }
+      var record = JSON.parse(s.json);
+      var fields = [
+        ['Key', s.key], ['ARN', s.arn], ['Type', s.resourceType], ['Provider', s.provider],
+        ['Account', account(s.accountId, s.accountAlias)], ['Organizational unit', s.organizationalUnit],
+        ['Region', s.region], ['Owner', s.owner && s.owner.name],
+        ['Last modified', when(s.lastModified)], ['Discovered', when(s.discoveredAt)]
+      ];
+      var graph = el('div', { class: 'graph small' });
+      var shown = show(render,
+        el('h2', {}, s.name), el('div', { class: 'meta' }, s.resourceType),
+        el('table', { class: 'fields' }, el('tbody', {}, fields.filter(function (f) { return f[1]; }).map(function (f) {
+          return el('tr', {}, el('th', {}, f[0]), el('td', {}, f[1]));
+        }), s.tags.length > 0 && el('tr', {}, el('th', {}, 'Tags'), el('td', {}, s.tags.map(function (t) {
+          return el('span', { class: 'tag' }, t.key + '=' + t.value);
+        }))))),
+        el('h2', {}, 'Dependencies (' + s.dependencies.length + ')'), dependencyTable(s.dependencies, 'No dependencies found.'),
+        el('h2', {}, 'Dependents (' + s.dependents.length + ')'), dependencyTable(s.dependents, 'Nothing found depends on it.'),
+        el('h2', {}, 'Neighbourhood'),
+        el('p', { class: 'meta' }, 'Its direct dependencies and dependents. ',
+          el('a', { href: graphHref({ node: s.key, direction: 'downstream' }) }, 'Everything it depends on'), ', ',
+          el('a', { href: graphHref({ node: s.key, direction: 'upstream' }) }, 'everything depending on it'), '.'),
+        graph,
+        el('h2', {}, 'Details'), el('pre', {}, JSON.stringify(record.details || {}, null, 2)));
+      if (shown) drawGraph(graph, neighbourhood(s), { focus: s.key });
+    }, failed(render));
+  }
+
+  function dependencyTable(deps, none) {
+    if (!deps.length) return el('p', { class: 'meta' }, none);
+    return el('table', {},
+      el('thead', {}, el('tr', {}, ['Relation', 'Evidence', 'Resource', 'Type', 'Account', 'Region'].map(function (h) { return el('th', {}, h); }))),
+      el('tbody', {}, deps.map(function (d) {
+        var n = d.node;
+        return el('tr', {},
+          el('td', {}, d.relation),
+          el('td', {}, evidence(d)),
+          el('td', {}, nodeLink(n)),
+          el('td', {}, n.resourceType),
+          el('td', {}, (n.accountId || '') + (d.crossAccount ? ' (cross-account)' : '')),
+          el('td', {}, n.region || ''));
+      })));
+  }
+
+  function evidence(e) {
+    var parts = [];
+    if (e.confidence) parts.push(e.confidence + ' confidence');
+    if (e.calls) parts.push(e.calls + ' calls');
+    if (e.ports) parts.push(e.ports);
+    return parts.join(', ');
+  }
+
+  function nodeLink(n) {
+    if (n.external) return el('span', { class: 'external', title: 'Not discovered itself' }, n.name || n.id);
+    return el('a', { href: serviceHref(n.id) }, n.name || n.id);
+  }
+
+  // neighbourhood returns the graph of s and the resources at the other end
+  // of its dependencies and dependents.
+  function neighbourhood(s) {
+    var g = { nodes: [{ id: s.key, name: s.name, resourceType: s.resourceType }], edges: [] };
+    var seen = {};
+    seen[s.key] = true;
+    function add(n) {
+      if (!seen[n.id]) g.nodes.push(n);
+      seen[n.id] = true;
+    }
+    s.dependencies.forEach(function (d) {
+      add(d.node);
+      g.edges.push({ from: s.key, to: d.node.id, relation: d.relation, confidence: d.confidence, calls: d.calls, ports: d.ports });
+    });
+    s.dependents.forEach(function (d) {
+      add(d.node);
+      g.edges.push({ from: d.node.id, to: s.key, relation: d.relation, confidence: d.confidence, calls: d.calls, ports: d.ports });
+    });
+    return g;
+  }
+
+  // The graph view.
+
+  function graphView(render, params) {
+    var form = el('form', { class: 'filters', onsubmit: function (e) {
+      e.preventDefault();
+      var next = {};
+      new FormData(form).forEach(function (v, k) { if (v && k !== 'highlight') next[k] = v; });
+      if (!next.node) { delete next.direction; delete next.depth; }
+      location.hash = graphHref(next);
+    } },
+      el('input', { type: 'search', name: 'node', placeholder: 'Node ID or name (default all)', value: params.get('node') || '' }),
+      el('select', { name: 'direction' },
+        el('option', { value: 'downstream', selected: params.get('direction') !== 'upstream' }, 'its dependencies'),
+        el('option', { value: 'upstream', selected: params.get('direction') === 'upstream' }, 'its dependents')),
+      el('input', { type: 'number', name: 'depth', min: 0, placeholder: 'Depth (any)', value: params.get('depth') || '', style: 'width: 8rem' }),
+      el('button', { type: 'submit' }, 'Show'),
+      el('input', { type: 'search', name: 'highlight', placeholder: 'Highlight…' }));
+    var out = el('div', {}, el('p', { class: 'meta' }, 'Loading…'));
+    if (!show(render, el('h2', {}, 'Dependency graph'), form, out)) return;
+    if (!snapshot) {
+      out.replaceChildren(el('p', { class: 'meta' }, 'No snapshot to show yet.'));
+      return;
+    }
+    var query = new URLSearchParams();
+    ['node', 'direction', 'depth'].forEach(function (k) { if (params.get(k)) query.set(k, params.get(k)); });
+    getJSON('graph?' + query.toString()).then(function (g) {
+      if (render !== renders) return;
+      if (!g.nodes.length) {
+        out.replaceChildren(el('p', { class: 'meta' }, 'No dependencies were found between the discovered services.'));
+        return;
+      }
+      if (g.nodes.length > MAX_GRAPH_NODES) {
+        out.replaceChildren(el('p', { class: 'meta' }, 'The graph has ' + g.nodes.length +
+          ' resources, too many to draw here. Give a node to show what it depends on or what depends on it, or use ',
+          el('code', {}, 'discovery graph'), ' to export it.'));
+        return;
+      }
+      var graph = el('div', { class: 'graph' });
+      out.replaceChildren(el('p', { class: 'meta' }, g.nodes.length + ' resources, ' + g.edges.length +
+        ' dependencies. Drag to pan, scroll to zoom, hover to trace a resource, click to open it.'), graph);
+      var drawn = drawGraph(graph, g, { focus: params.get('node') });
+      form.elements.highlight.addEventListener('input', function (e) { drawn.highlight(e.target.value); });
+    }, function (err) {
+      out.replaceChildren(el('p', { class: 'error' }, err.message));
+    });
+  }
+
+  // drawGraph draws g, of graph -o json's shape, into container with a
+  // force-directed layout, and returns a handle to highlight nodes by text.
+  function drawGraph(container, g, opts) {
+    var types = [];
+    g.nodes.forEach(function (n) { if (types.indexOf(n.resourceType) < 0) types.push(n.resourceType); });
+    types.sort();
+    var color = function (type) { return PALETTE[types.indexOf(type) % PALETTE.length]; };
+
+    var root = svg('svg');
+    var defs = svg('defs');
+    var marker = svg('marker', { id: 'arrow', viewBox: '0 0 10 10', refX: 19, refY: 5, markerWidth: 7, markerHeight: 7, orient: 'auto-start-reverse' });
+    marker.appendChild(svg('path', { d: 'M0,0 L10,5 L0,10 z', fill: '#999' }));
+    defs.appendChild(marker);
+    root.appendChild(defs);
+    var world = svg('g');
+    root.appendChild(world);
+    container.replaceChildren(root);
+    container.parentNode.insertBefore(el('div', { class: 'legend' }, types.map(function (t) {
+      return el('span', {}, el('i', { style: 'background:' + color(t) }), t);
+    })), container.nextSibling);
+
+    var byID = {};
+    var nodes = g.nodes.map(function (n, i) {
+      // Start on a spiral, so that layouts are the same every time.
+      var r = 12 * Math.sqrt(i + 1), a = i * 2.39996;
+      var node = { data: n, x: r * Math.cos(a), y: r * Math.sin(a), vx: 0, vy: 0, fixed: false, edges: [] };
+      byID[n.id] = node;
+      return node;
+    });
+    var edges = g.edges.filter(function (e) { return byID[e.from] && byID[e.to]; }).map(function (e) {
+      var edge = { data: e, from: byID[e.from], to: byID[e.to] };
+      edge.from.edges.push(edge);
+      edge.to.edges.push(edge);
+      edge.line = svg('line', { 'marker-end': 'url(#arrow)' });
+      if (e.relation === 'observed' || e.relation === 'audited') edge.line.classList.add('observed');
+      if (e.confidence) edge.line.classList.add('inferred');
+      var title = svg('title');
+      title.textContent = e.from + ' → ' + e.to + ': ' + e.relation + (evidence(e) ? ' (' + evidence(e) + ')' : '');
+      edge.line.appendChild(title);
+      world.appendChild(edge.line);
+      return edge;
+    });
+    nodes.forEach(function (node) {
+      var n = node.data;
+      node.g = svg('g');
+      node.g.classList.add('node');
+      if (n.external) node.g.classList.add('external');
+      if (n.id === opts.focus || n.name === opts.focus) node.g.classList.add('focus');
+      var circle = svg('circle', { r: n.external ? 6 : 8, fill: color(n.resourceType) });
+      var title = svg('title');
+      title.textContent = n.id + '\n' + n.resourceType + (n.owner ? '\nowner: ' + n.owner : '') + (n.external ? '\n(not discovered)' : '');
+      circle.appendChild(title);
+      var label = svg('text', { x: 11, y: 4 });
+      label.textContent = n.name || n.id;
+      node.g.appendChild(circle);
+      node.g.appendChild(label);
+      node.search = [n.id, n.name, n.resourceType, n.owner, n.accountId, n.region].concat(
+        Object.keys(n.tags || {}).map(function (k) { return k + '=' + n.tags[k]; })).join(' ').toLowerCase();
+      world.appendChild(node.g);
+    });
+
+    // The view: a translation and a scale, changed by panning and zooming.
+    var view = { x: 0, y: 0, k: 1 }, touched = false;
+    function applyView() { world.setAttribute('transform', 'translate(' + view.x + ',' + view.y + ') scale(' + view.k + ')'); }
+    function fit() {
+      var box = root.getBoundingClientRect();
+      if (!box.width || !box.height) return;
+      var minX = Infinity, minY = Infinity, maxX = -Infinity, maxY = -Infinity;
+      nodes.forEach(function (n) {
+        minX = Math.min(minX, n.x); maxX = Math.max(maxX, n.x + 80);
+        minY = Math.min(minY, n.y); maxY = Math.max(maxY, n.y);
+      });
+      var k = Math.min(2, 0.9 * Math.min(box.width / (maxX - minX + 40), box.height / (maxY - minY + 40)));
+      view = { k: k, x: box.width / 2 - k * (minX + maxX) / 2, y: box.height / 2 - k * (minY + maxY) / 2 };
+      applyView();
+    }
+    function position() {
+      edges.forEach(function (e) {
+        e.line.setAttribute('x1', e.from.x); e.line.setAttribute('y1', e.from.y);
+        e.line.setAttribute('x2', e.to.x); e.line.setAttribute('y2', e.to.y);
+      });
+      nodes.forEach(function (n) { n.g.setAttribute('transform', 'translate(' + n.x + ',' + n.y + ')'); });
+    }
+
+    // The layout: nodes repel each other, edges pull their ends together
+    // and a weak pull to the centre keeps components from drifting apart.
+    var alpha = 1;
+    function tick() {
+      var i, j, a, b, dx, dy, d2, d, f;
+      for (i = 0; i < nodes.length; i++) {
+        a = nodes[i];
+        for (j = i + 1; j < nodes.length; j++) {
+          b = nodes[j];
+          dx = a.x - b.x; dy = a.y - b.y;
+          d2 = dx * dx + dy * dy || 0.01;
+          if (d2 > 90000) continue;
+          f = 900 * alpha / d2;
+          a.vx += dx * f; a.vy += dy * f;
+          b.vx -= dx * f; b.vy -= dy * f;
+        }
+      }
+      edges.forEach(function (e) {
+        dx = e.to.x - e.from.x; dy = e.to.y - e.from.y;
+        d = Math.sqrt(dx * dx + dy * dy) || 0.01;
+        f = (d - 70) / d * 0.06 * alpha;
+        e.from.vx += dx * f; e.from.vy += dy * f;
+        e.to.vx -= dx * f; e.to.vy -= dy * f;
+      });
+      nodes.forEach(function (n) {
+        n.vx -= n.x * 0.004 * alpha; n.vy -= n.y * 0.004 * alpha;
+        if (!n.fixed) { n.x += n.vx; n.y += n.vy; }
+        n.vx *= 0.6; n.vy *= 0.6;
+      });
+      alpha *= 0.985;
+    }
+    function animate() {
+      if (!root.isConnected) return;
+      tick(); tick();
+      position();
+      if (!touched) fit();
+      if (alpha > 0.02) requestAnimationFrame(animate);
+    }
+    // Warm the layout up before the first frame, so the graph does not
+    // start as a tangle.
+    for (var w = 0; w < 60 && alpha > 0.4; w++) tick();
+    position();
+    requestAnimationFrame(animate);
+
+    // Zooming centres on the pointer; dragging the background pans and
+    // dragging a node moves it, while a click opens it.
+    root.addEventListener('wheel', function (e) {
+      e.preventDefault();
+      touched = true;
+      var box = root.getBoundingClientRect();
+      var px = e.clientX - box.left, py = e.clientY - box.top;
+      var k = Math.max(0.1, Math.min(8, view.k * Math.exp(-e.deltaY * 0.0015)));
+      view.x = px - (px - view.x) * k / view.k;
+      view.y = py - (py - view.y) * k / view.k;
+      view.k = k;
+      applyView();
+    }, { passive: false });
+    var drag = null;
+    root.addEventListener('pointerdown', function (e) {
+      var target = nodes.filter(function (n) { return n.g.contains(e.target); })[0];
+      drag = { node: target, x: e.clientX, y: e.clientY, moved: false };
+      root.setPointerCapture(e.pointerId);
+      if (!target) root.classList.add('panning');
+    });
+    root.addEventListener('pointermove', function (e) {
+      if (!drag) return;
+      var dx = e.clientX - drag.x, dy = e.clientY - drag.y;
+      if (!drag.moved && Math.abs(dx) + Math.abs(dy) < 4) return;
+      drag.moved = touched = true;
+      drag.x = e.clientX; drag.y = e.clientY;
+      if (drag.node) {
+        drag.node.fixed = true;
+        drag.node.x += dx / view.k; drag.node.y += dy / view.k;
+        position();
+      } else {
+        view.x += dx; view.y += dy;
+        applyView();
+      }
+    });
+    root.addEventListener('pointerup', function () {
+      root.classList.remove('panning');
+      var d = drag;
+      drag = null;
+      if (!d || d.moved || !d.node) return;
+      var n = d.node.data;
+      location.hash = n.external ? graphHref({ node: n.id, direction: 'upstream' }) : serviceHref(n.id);
+    });
+
+    // Hovering a node shows only it and its neighbours; otherwise the
+    // highlight text, when given, dims the nodes that do not match it.
+    var text = '';
+    function dim(shown) {
+      nodes.forEach(function (n) { n.g.classList.toggle('dim', !!shown && !shown(n)); });
+      edges.forEach(function (e) { e.line.classList.toggle('dim', !!shown && !(shown(e.from) && shown(e.to))); });
+    }
+    function restore() { dim(text ? function (n) { return n.search.indexOf(text) >= 0; } : null); }
+    nodes.forEach(function (node) {
+      node.g.addEventListener('mouseenter', function () {
+        if (drag) return;
+        var near = [node];
+        node.edges.forEach(function (e) { near.push(e.from, e.to); });
+        dim(function (n) { return near.indexOf(n) >= 0; });
+      });
+      node.g.addEventListener('mouseleave', function () { if (!drag) restore(); });
+    });
+
+    return {
+      highlight: function (q) {
+        text = q.trim().toLowerCase();
+        restore();
+      }
+    };
+  }
+
+  window.addEventListener('hashchange', route);
+  route();
+})();
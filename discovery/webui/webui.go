@@ -0,0 +1,33 @@
+// Package webui is the web interface of "discovery serve" and "discovery
+// daemon", for people who do not use the CLI: a searchable table of the
+// newest snapshot's services, a page per service with its dependencies and
+// dependents, and an interactive dependency graph. It is a static page
+// reading the catalog API under /api/v1, and loads nothing else from the
+// network.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the interface. It expects to be mounted one level below
+// the catalog API, e.g. on /ui/ with the prefix stripped, as the page finds
+// the API at ../api/v1.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.FileServerFS(files)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The files carry no modification time to revalidate with, so make
+		// browsers fetch them again after an upgrade.
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	})
+}